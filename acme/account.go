@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"crypto"
 	"encoding/base64"
 	"encoding/json"
@@ -36,6 +37,32 @@ func (a *Account) IsValid() bool {
 	return a.Status == StatusValid
 }
 
+// DeactivateAuthorizations deactivates the pending and valid authorizations
+// of the Account, so they cannot be reused once the Account is deactivated.
+// Orders depending on those authorizations become invalid, pending orders
+// right away and ready orders when they are finalized.
+func (a *Account) DeactivateAuthorizations(ctx context.Context, db DB) error {
+	azs, err := db.GetAuthorizationsByAccountID(ctx, a.ID)
+	if err != nil {
+		return WrapErrorISE(err, "error retrieving authorizations for account %s", a.ID)
+	}
+	for _, az := range azs {
+		if az.Status != StatusPending && az.Status != StatusValid {
+			continue
+		}
+		if err := az.Deactivate(ctx, db); err != nil {
+			return WrapErrorISE(err, "error deactivating authorization %s", az.ID)
+		}
+	}
+
+	// Retrieving the orders updates their status, marking the pending orders
+	// as invalid.
+	if _, err := db.GetOrdersByAccountID(ctx, a.ID); err != nil {
+		return WrapErrorISE(err, "error updating orders for account %s", a.ID)
+	}
+	return nil
+}
+
 // KeyToID converts a JWK to a thumbprint.
 func KeyToID(jwk *jose.JSONWebKey) (string, error) {
 	kid, err := jwk.Thumbprint(crypto.SHA256)
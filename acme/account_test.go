@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"crypto"
 	"encoding/base64"
 	"testing"
@@ -82,6 +83,96 @@ func TestAccount_IsValid(t *testing.T) {
 	}
 }
 
+func TestAccount_DeactivateAuthorizations(t *testing.T) {
+	type test struct {
+		db  DB
+		err error
+	}
+	acc := &Account{ID: "accID", Status: StatusDeactivated}
+	tests := map[string]func(t *testing.T) test{
+		"fail/db.GetAuthorizationsByAccountID-error": func(t *testing.T) test {
+			return test{
+				db: &MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*Authorization, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error retrieving authorizations for account accID: force"),
+			}
+		},
+		"fail/db.UpdateAuthorization-error": func(t *testing.T) test {
+			return test{
+				db: &MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*Authorization, error) {
+						return []*Authorization{{ID: "az1", Status: StatusPending}}, nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+						return errors.New("force")
+					},
+				},
+				err: errors.New("error deactivating authorization az1: error updating authorization: force"),
+			}
+		},
+		"fail/db.GetOrdersByAccountID-error": func(t *testing.T) test {
+			return test{
+				db: &MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*Authorization, error) {
+						return []*Authorization{}, nil
+					},
+					MockGetOrdersByAccountID: func(ctx context.Context, accountID string) ([]string, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error updating orders for account accID: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			var deactivated []string
+			return test{
+				db: &MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*Authorization, error) {
+						assert.Equals(t, accountID, acc.ID)
+						return []*Authorization{
+							{ID: "az1", Status: StatusPending},
+							{ID: "az2", Status: StatusValid},
+							{ID: "az3", Status: StatusInvalid},
+							{ID: "az4", Status: StatusDeactivated},
+						}, nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+						assert.Equals(t, az.Status, StatusDeactivated)
+						deactivated = append(deactivated, az.ID)
+						return nil
+					},
+					MockGetOrdersByAccountID: func(ctx context.Context, accountID string) ([]string, error) {
+						assert.Equals(t, accountID, acc.ID)
+						assert.Equals(t, deactivated, []string{"az1", "az2"})
+						return []string{}, nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := run(t)
+			if err := acc.DeactivateAuthorizations(context.Background(), tc.db); err != nil {
+				if assert.NotNil(t, tc.err) {
+					var k *Error
+					if errors.As(err, &k) {
+						assert.Equals(t, k.Type, "urn:ietf:params:acme:error:serverInternal")
+						assert.Equals(t, k.Err.Error(), tc.err.Error())
+					} else {
+						assert.FatalError(t, errors.New("unexpected error type"))
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
 func TestExternalAccountKey_BindTo(t *testing.T) {
 	boundAt := time.Now()
 	tests := []struct {
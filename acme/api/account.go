@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi"
 
+	"go.step.sm/crypto/jose"
+
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/logging"
@@ -197,6 +200,14 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 				render.Error(w, acme.WrapErrorISE(err, "error updating account"))
 				return
 			}
+
+			// Authorizations of a deactivated account cannot be reused.
+			if uar.Status == acme.StatusDeactivated {
+				if err := acc.DeactivateAuthorizations(ctx, db); err != nil {
+					render.Error(w, err)
+					return
+				}
+			}
 		}
 	}
 
@@ -206,6 +217,199 @@ func GetOrUpdateAccount(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, acc)
 }
 
+// KeyChangeRequest represents the payload of the inner JWS of a key-change
+// request.
+type KeyChangeRequest struct {
+	Account string           `json:"account"`
+	OldKey  *jose.JSONWebKey `json:"oldKey"`
+}
+
+// Validate validates a key-change request body.
+func (k *KeyChangeRequest) Validate() error {
+	switch {
+	case k.Account == "":
+		return acme.NewError(acme.ErrorMalformedType, "account cannot be empty")
+	case k.OldKey == nil:
+		return acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty")
+	default:
+		return nil
+	}
+}
+
+// KeyChange is the handler resource for rolling over the key of an ACME
+// account, as described in https://tools.ietf.org/html/rfc8555#section-7.3.5.
+//
+// The payload of the request is a JWS signed by the new key, its payload
+// references the account and the old key.
+func KeyChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	jws, err := jwsFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	outer := jws.Signatures[0].Protected
+	inner, err := jose.ParseJWS(string(payload.value))
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse inner JWS from key-change request payload"))
+		return
+	}
+	newKey, err := validateKeyChangeJWS(inner, outer)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	innerPayload, err := inner.Verify(newKey)
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "error verifying inner jws"))
+		return
+	}
+
+	var kcr KeyChangeRequest
+	if err := json.Unmarshal(innerPayload, &kcr); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal key-change request payload"))
+		return
+	}
+	if err := kcr.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+	if kcr.Account != outer.KeyID {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType,
+			"account in key-change request (%s) does not match kid in jws (%s)", kcr.Account, outer.KeyID))
+		return
+	}
+	oldKid, err := acme.KeyToID(kcr.OldKey)
+	if err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err, "error getting KeyID from oldKey"))
+		return
+	}
+	if oldKid != acc.Key.KeyID {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "oldKey does not match the current account key"))
+		return
+	}
+
+	// Overwrite KeyID with the JWK thumbprint.
+	newKey.KeyID, err = acme.KeyToID(newKey)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error getting KeyID from JWK"))
+		return
+	}
+
+	// The new key cannot be bound to another account.
+	existing, err := db.GetAccountByKeyID(ctx, newKey.KeyID)
+	switch {
+	case errors.Is(err, acme.ErrNotFound):
+		break
+	case err != nil:
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving account by key"))
+		return
+	default:
+		renderKeyInUse(ctx, w, linker, existing.ID)
+		return
+	}
+
+	acc.Key = newKey
+	if err := db.UpdateAccountKey(ctx, acc); err != nil {
+		if !errors.Is(err, acme.ErrKeyInUse) {
+			render.Error(w, acme.WrapErrorISE(err, "error updating account key"))
+			return
+		}
+		// Another account took the key after it was checked.
+		existing, err := db.GetAccountByKeyID(ctx, newKey.KeyID)
+		if err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving account by key"))
+			return
+		}
+		renderKeyInUse(ctx, w, linker, existing.ID)
+		return
+	}
+
+	linker.LinkAccount(ctx, acc)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, acc.ID))
+	render.JSON(w, acc)
+}
+
+// renderKeyInUse writes the error returned when the new key of a key-change
+// request is bound to another account. As required by RFC 8555, section
+// 7.3.5, it is a malformed error with status 409 and the Location header of
+// the account that has the key.
+func renderKeyInUse(ctx context.Context, w http.ResponseWriter, linker acme.Linker, accID string) {
+	acmeErr := acme.NewError(acme.ErrorMalformedType, "new key is already in use by account %s", accID)
+	acmeErr.Status = http.StatusConflict
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, accID))
+	render.Error(w, acmeErr)
+}
+
+// validateKeyChangeJWS checks that the inner JWS of a key-change request meets
+// the requirements of RFC 8555, and returns the new key in its protected
+// header.
+//
+// The inner JWS MUST have a single signature
+// The inner JWS MUST NOT use the JWS Unprotected Header
+// The inner JWS MUST have a "jwk" header parameter and MUST NOT have a "kid"
+// The inner JWS MUST omit the "nonce" header parameter
+// The inner JWS MUST have the same "url" header parameter as the outer JWS
+func validateKeyChangeJWS(inner *jose.JSONWebSignature, outer jose.Header) (*jose.JSONWebKey, error) {
+	if len(inner.Signatures) != 1 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "inner jws must contain exactly one signature")
+	}
+
+	sig := inner.Signatures[0]
+	uh := sig.Unprotected
+	if len(uh.KeyID) > 0 ||
+		uh.JSONWebKey != nil ||
+		len(uh.Algorithm) > 0 ||
+		len(uh.Nonce) > 0 ||
+		len(uh.ExtraHeaders) > 0 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "unprotected header must not be used in inner jws")
+	}
+
+	hdr := sig.Protected
+	if err := validateJWSAlgorithm(hdr); err != nil {
+		return nil, err
+	}
+	if hdr.JSONWebKey == nil {
+		return nil, acme.NewError(acme.ErrorMalformedType, "jwk expected in inner jws protected header")
+	}
+	if len(hdr.KeyID) > 0 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "kid must not be used in inner jws protected header")
+	}
+	if !hdr.JSONWebKey.Valid() {
+		return nil, acme.NewError(acme.ErrorMalformedType, "invalid jwk in inner jws protected header")
+	}
+	if len(hdr.Nonce) > 0 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "nonce must not be used in inner jws protected header")
+	}
+
+	innerURL, ok := hdr.ExtraHeaders["url"].(string)
+	if !ok {
+		return nil, acme.NewError(acme.ErrorMalformedType, "inner jws missing url protected header")
+	}
+	outerURL, _ := outer.ExtraHeaders["url"].(string)
+	if innerURL != outerURL {
+		return nil, acme.NewError(acme.ErrorMalformedType,
+			"url header in inner JWS (%s) does not match outer JWS url (%s)", innerURL, outerURL)
+	}
+	return hdr.JSONWebKey, nil
+}
+
 func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 	if rl, ok := w.(logging.ResponseLogger); ok {
 		m := map[string]interface{}{
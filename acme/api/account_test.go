@@ -54,6 +54,14 @@ func (*fakeProvisioner) GetAttestationRoots() (*x509.CertPool, bool) {
 	return nil, false
 }
 
+func (*fakeProvisioner) GetEndorsementRoots() (*x509.CertPool, bool) {
+	return nil, false
+}
+
+func (*fakeProvisioner) LookupDevice(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
 func (*fakeProvisioner) AuthorizeRevoke(ctx context.Context, token string) error { return nil }
 func (*fakeProvisioner) GetID() string                                           { return "" }
 func (*fakeProvisioner) GetName() string                                         { return "" }
@@ -944,6 +952,28 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 				err:        acme.NewErrorISE("force"),
 			}
 		},
+		"fail/deactivate-authorizations-error": func(t *testing.T) test {
+			uar := &UpdateAccountRequest{
+				Status: "deactivated",
+			}
+			b, err := json.Marshal(uar)
+			assert.FatalError(t, err)
+			ctx := context.WithValue(context.Background(), accContextKey, &acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				db: &acme.MockDB{
+					MockUpdateAccount: func(ctx context.Context, upd *acme.Account) error {
+						return nil
+					},
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving authorizations for account accountID: force"),
+			}
+		},
 		"ok/deactivate": func(t *testing.T) test {
 			uar := &UpdateAccountRequest{
 				Status: "deactivated",
@@ -960,6 +990,22 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 						assert.Equals(t, upd.ID, acc.ID)
 						return nil
 					},
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, accountID, acc.ID)
+						return []*acme.Authorization{
+							{ID: "az1", AccountID: acc.ID, Status: acme.StatusPending},
+							{ID: "az2", AccountID: acc.ID, Status: acme.StatusInvalid},
+						}, nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.Equals(t, az.ID, "az1")
+						assert.Equals(t, az.Status, acme.StatusDeactivated)
+						return nil
+					},
+					MockGetOrdersByAccountID: func(ctx context.Context, accountID string) ([]string, error) {
+						assert.Equals(t, accountID, acc.ID)
+						return []string{}, nil
+					},
 				},
 				ctx:        ctx,
 				statusCode: 200,
@@ -1047,3 +1093,296 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_KeyChange(t *testing.T) {
+	accID := "accountID"
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	kid := fmt.Sprintf("%s/acme/%s/account/%s", baseURL.String(), escProvName, accID)
+	keyChangeURL := fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), escProvName)
+
+	oldJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldJWK.KeyID, err = acme.KeyToID(oldJWK)
+	assert.FatalError(t, err)
+	newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newKid, err := acme.KeyToID(newJWK)
+	assert.FatalError(t, err)
+
+	newAccount := func() *acme.Account {
+		return &acme.Account{
+			ID:        accID,
+			Key:       oldJWK,
+			Status:    "valid",
+			OrdersURL: fmt.Sprintf("%s/acme/%s/account/%s/orders", baseURL.String(), escProvName, accID),
+		}
+	}
+	newKeyInUseError := func(id string) *acme.Error {
+		err := acme.NewError(acme.ErrorMalformedType, "new key is already in use by account %s", id)
+		err.Status = 409
+		return err
+	}
+	sign := func(key *jose.JSONWebKey, so *jose.SignerOptions, payload []byte) *jose.JSONWebSignature {
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(key.Algorithm),
+			Key:       key.Key,
+		}, so)
+		assert.FatalError(t, err)
+		jws, err := signer.Sign(payload)
+		assert.FatalError(t, err)
+		raw, err := jws.CompactSerialize()
+		assert.FatalError(t, err)
+		parsed, err := jose.ParseJWS(raw)
+		assert.FatalError(t, err)
+		return parsed
+	}
+	innerJWS := func(so *jose.SignerOptions, kcr *KeyChangeRequest) []byte {
+		b, err := json.Marshal(kcr)
+		assert.FatalError(t, err)
+		return []byte(sign(newJWK, so, b).FullSerialize())
+	}
+	innerOptions := func() *jose.SignerOptions {
+		so := &jose.SignerOptions{EmbedJWK: true}
+		so.WithHeader("url", keyChangeURL)
+		return so
+	}
+	outerJWS := func() *jose.JSONWebSignature {
+		so := new(jose.SignerOptions)
+		so.WithHeader("kid", kid)
+		so.WithHeader("url", keyChangeURL)
+		return sign(oldJWK, so, []byte("{}"))
+	}
+	newContext := func(acc *acme.Account, payload []byte) context.Context {
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, jwsContextKey, outerJWS())
+		return context.WithValue(ctx, payloadContextKey, &payloadInfo{value: payload})
+	}
+	publicOldJWK := oldJWK.Public()
+	validRequest := &KeyChangeRequest{Account: kid, OldKey: &publicOldJWK}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		acc        *acme.Account
+		statusCode int
+		location   string
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/no-jws": func(t *testing.T) test {
+			ctx := context.WithValue(context.Background(), accContextKey, newAccount())
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("jws expected in request context"),
+			}
+		},
+		"fail/no-payload": func(t *testing.T) test {
+			ctx := context.WithValue(context.Background(), accContextKey, newAccount())
+			ctx = context.WithValue(ctx, jwsContextKey, outerJWS())
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				statusCode: 500,
+				err:        acme.NewErrorISE("payload expected in request context"),
+			}
+		},
+		"fail/parse-inner-jws-error": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), []byte("foo")),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to parse inner JWS from key-change request payload"),
+			}
+		},
+		"fail/inner-jws-no-jwk": func(t *testing.T) test {
+			so := new(jose.SignerOptions)
+			so.WithHeader("url", keyChangeURL)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), innerJWS(so, validRequest)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "jwk expected in inner jws protected header"),
+			}
+		},
+		"fail/inner-jws-nonce": func(t *testing.T) test {
+			so := innerOptions()
+			so.WithHeader("nonce", "the-nonce")
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), innerJWS(so, validRequest)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "nonce must not be used in inner jws protected header"),
+			}
+		},
+		"fail/inner-jws-url-mismatch": func(t *testing.T) test {
+			so := &jose.SignerOptions{EmbedJWK: true}
+			so.WithHeader("url", "https://test.ca.smallstep.com/foo")
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), innerJWS(so, validRequest)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "url header in inner JWS does not match outer JWS url"),
+			}
+		},
+		"fail/empty-old-key": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), &KeyChangeRequest{Account: kid})),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty"),
+			}
+		},
+		"fail/account-mismatch": func(t *testing.T) test {
+			kcr := &KeyChangeRequest{Account: kid + "foo", OldKey: &publicOldJWK}
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), kcr)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "account in key-change request does not match kid in jws"),
+			}
+		},
+		"fail/old-key-mismatch": func(t *testing.T) test {
+			publicNewJWK := newJWK.Public()
+			kcr := &KeyChangeRequest{Account: kid, OldKey: &publicNewJWK}
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), kcr)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "oldKey does not match the current account key"),
+			}
+		},
+		"fail/db.GetAccountByKeyID-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, kid, newKid)
+						return nil, errors.New("force")
+					},
+				},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), validRequest)),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving account by key: force"),
+			}
+		},
+		"fail/conflict": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, kid, newKid)
+						return &acme.Account{ID: "otherAccountID"}, nil
+					},
+				},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), validRequest)),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/otherAccountID", baseURL.String(), escProvName),
+				err:        newKeyInUseError("otherAccountID"),
+			}
+		},
+		"fail/db.UpdateAccountKey-conflict": func(t *testing.T) test {
+			var updated bool
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						if updated {
+							return &acme.Account{ID: "otherAccountID"}, nil
+						}
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccountKey: func(ctx context.Context, acc *acme.Account) error {
+						updated = true
+						return acme.ErrKeyInUse
+					},
+				},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), validRequest)),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/otherAccountID", baseURL.String(), escProvName),
+				err:        newKeyInUseError("otherAccountID"),
+			}
+		},
+		"fail/db.UpdateAccountKey-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccountKey: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(newAccount(), innerJWS(innerOptions(), validRequest)),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating account key: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			acc := newAccount()
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, kid, newKid)
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccountKey: func(ctx context.Context, upd *acme.Account) error {
+						assert.Equals(t, upd.ID, accID)
+						assert.Equals(t, upd.Key.KeyID, newKid)
+						return nil
+					},
+				},
+				ctx:        newContext(acc, innerJWS(innerOptions(), validRequest)),
+				acc:        acc,
+				statusCode: 200,
+				location:   kid,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := acme.NewContext(tc.ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("POST", "/foo/bar", nil)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			KeyChange(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.location != "" {
+				assert.Equals(t, res.Header["Location"], []string{tc.location})
+			}
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, ae.Identifier, tc.err.Identifier)
+				assert.Equals(t, ae.Subproblems, tc.err.Subproblems)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				expB, err := json.Marshal(tc.acc)
+				assert.FatalError(t, err)
+				assert.Equals(t, bytes.TrimSpace(body), expB)
+				assert.Equals(t, tc.acc.Key.KeyID, newKid)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
@@ -156,13 +156,15 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 		commonMiddleware(GetDirectory))
 	r.MethodFunc("HEAD", getPath(acme.DirectoryLinkType, "{provisionerID}"),
 		commonMiddleware(GetDirectory))
+	r.MethodFunc("GET", getPath(acme.RenewalInfoLinkType, "{provisionerID}", "{certID}"),
+		commonMiddleware(GetRenewalInfo))
 
 	r.MethodFunc("POST", getPath(acme.NewAccountLinkType, "{provisionerID}"),
 		extractPayloadByJWK(NewAccount))
 	r.MethodFunc("POST", getPath(acme.AccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(GetOrUpdateAccount))
 	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}", "{accID}"),
-		extractPayloadByKid(NotImplemented))
+		extractPayloadByKid(KeyChange))
 	r.MethodFunc("POST", getPath(acme.NewOrderLinkType, "{provisionerID}"),
 		extractPayloadByKid(NewOrder))
 	r.MethodFunc("POST", getPath(acme.OrderLinkType, "{provisionerID}", "{ordID}"),
@@ -172,7 +174,7 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 	r.MethodFunc("POST", getPath(acme.FinalizeLinkType, "{provisionerID}", "{ordID}"),
 		extractPayloadByKid(FinalizeOrder))
 	r.MethodFunc("POST", getPath(acme.AuthzLinkType, "{provisionerID}", "{authzID}"),
-		extractPayloadByKid(isPostAsGet(GetAuthorization)))
+		extractPayloadByKid(GetOrUpdateAuthorization))
 	r.MethodFunc("POST", getPath(acme.ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}"),
 		extractPayloadByKid(GetChallenge))
 	r.MethodFunc("POST", getPath(acme.CertificateLinkType, "{provisionerID}", "{certID}"),
@@ -200,12 +202,13 @@ type Meta struct {
 
 // Directory represents an ACME directory for configuring clients.
 type Directory struct {
-	NewNonce   string `json:"newNonce"`
-	NewAccount string `json:"newAccount"`
-	NewOrder   string `json:"newOrder"`
-	RevokeCert string `json:"revokeCert"`
-	KeyChange  string `json:"keyChange"`
-	Meta       Meta   `json:"meta"`
+	NewNonce    string `json:"newNonce"`
+	NewAccount  string `json:"newAccount"`
+	NewOrder    string `json:"newOrder"`
+	RevokeCert  string `json:"revokeCert"`
+	KeyChange   string `json:"keyChange"`
+	RenewalInfo string `json:"renewalInfo"`
+	Meta        Meta   `json:"meta"`
 }
 
 // ToLog enables response logging for the Directory type.
@@ -229,11 +232,12 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 
 	linker := acme.MustLinkerFromContext(ctx)
 	render.JSON(w, &Directory{
-		NewNonce:   linker.GetLink(ctx, acme.NewNonceLinkType),
-		NewAccount: linker.GetLink(ctx, acme.NewAccountLinkType),
-		NewOrder:   linker.GetLink(ctx, acme.NewOrderLinkType),
-		RevokeCert: linker.GetLink(ctx, acme.RevokeCertLinkType),
-		KeyChange:  linker.GetLink(ctx, acme.KeyChangeLinkType),
+		NewNonce:    linker.GetLink(ctx, acme.NewNonceLinkType),
+		NewAccount:  linker.GetLink(ctx, acme.NewAccountLinkType),
+		NewOrder:    linker.GetLink(ctx, acme.NewOrderLinkType),
+		RevokeCert:  linker.GetLink(ctx, acme.RevokeCertLinkType),
+		KeyChange:   linker.GetLink(ctx, acme.KeyChangeLinkType),
+		RenewalInfo: linker.GetLink(ctx, acme.RenewalInfoLinkType),
 		Meta: Meta{
 			ExternalAccountRequired: acmeProv.RequireEAB,
 		},
@@ -278,6 +282,78 @@ func GetAuthorization(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, az)
 }
 
+// UpdateAuthorizationRequest represents an update-authorization request.
+type UpdateAuthorizationRequest struct {
+	Status acme.Status `json:"status"`
+}
+
+// Validate validates an update-authorization request body.
+func (u *UpdateAuthorizationRequest) Validate() error {
+	if u.Status != acme.StatusDeactivated {
+		return acme.NewError(acme.ErrorMalformedType, "cannot update authorization "+
+			"status to %s, only deactivated", u.Status)
+	}
+	return nil
+}
+
+// GetOrUpdateAuthorization ACME api for retrieving an Authz or deactivating
+// it as described in RFC 8555 section 7.5.2.
+func GetOrUpdateAuthorization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if payload.isPostAsGet {
+		GetAuthorization(w, r)
+		return
+	}
+
+	var uar UpdateAuthorizationRequest
+	if err := json.Unmarshal(payload.value, &uar); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal update-authorization request payload"))
+		return
+	}
+	if err := uar.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	az, err := db.GetAuthorization(ctx, chi.URLParam(r, "authzID"))
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving authorization"))
+		return
+	}
+	if acc.ID != az.AccountID {
+		render.Error(w, acme.NewError(acme.ErrorUnauthorizedType,
+			"account '%s' does not own authorization '%s'", acc.ID, az.ID))
+		return
+	}
+	if err = az.UpdateStatus(ctx, db); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating authorization status"))
+		return
+	}
+	if err = az.Deactivate(ctx, db); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	linker.LinkAuthorization(ctx, az)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	render.JSON(w, az)
+}
+
 // GetChallenge ACME api for retrieving a Challenge.
 func GetChallenge(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
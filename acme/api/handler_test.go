@@ -105,11 +105,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 			}
 			return test{
 				ctx:        ctx,
@@ -124,11 +125,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: Meta{
 					ExternalAccountRequired: true,
 				},
@@ -351,6 +353,233 @@ func TestHandler_GetAuthorization(t *testing.T) {
 	}
 }
 
+func TestUpdateAuthorizationRequest_Validate(t *testing.T) {
+	type test struct {
+		uar *UpdateAuthorizationRequest
+		err *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/empty-status": func(t *testing.T) test {
+			return test{
+				uar: &UpdateAuthorizationRequest{},
+				err: acme.NewError(acme.ErrorMalformedType, "cannot update authorization status to , only deactivated"),
+			}
+		},
+		"fail/bad-status": func(t *testing.T) test {
+			return test{
+				uar: &UpdateAuthorizationRequest{Status: acme.StatusValid},
+				err: acme.NewError(acme.ErrorMalformedType, "cannot update authorization status to valid, only deactivated"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				uar: &UpdateAuthorizationRequest{Status: acme.StatusDeactivated},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			if err := tc.uar.Validate(); err != nil {
+				if assert.NotNil(t, tc.err) {
+					var ae *acme.Error
+					if assert.True(t, errors.As(err, &ae)) {
+						assert.Equals(t, ae.Type, tc.err.Type)
+						assert.Equals(t, ae.Err.Error(), tc.err.Err.Error())
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
+
+func TestHandler_GetOrUpdateAuthorization(t *testing.T) {
+	expiry := time.Now().UTC().Add(6 * time.Hour)
+	newAuthz := func(status acme.Status) *acme.Authorization {
+		return &acme.Authorization{
+			ID:        "authzID",
+			AccountID: "accID",
+			Identifier: acme.Identifier{
+				Type:  "dns",
+				Value: "example.com",
+			},
+			Status:    status,
+			ExpiresAt: expiry,
+			Challenges: []*acme.Challenge{
+				{
+					Type:   "http-01",
+					Status: "pending",
+					Token:  "tok2",
+					ID:     "chHTTP01ID",
+				},
+			},
+		}
+	}
+	prov := newProv()
+	provName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+
+	// Request with chi context
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("authzID", "authzID")
+	u := fmt.Sprintf("%s/acme/%s/authz/%s",
+		baseURL.String(), provName, "authzID")
+
+	deactivate, err := json.Marshal(&UpdateAuthorizationRequest{Status: acme.StatusDeactivated})
+	assert.FatalError(t, err)
+	newContext := func(payload *payloadInfo) context.Context {
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, &acme.Account{ID: "accID"})
+		ctx = context.WithValue(ctx, payloadContextKey, payload)
+		return context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+	}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		az         *acme.Authorization
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-payload": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 500,
+				err:        acme.NewErrorISE("payload expected in request context"),
+			}
+		},
+		"fail/unmarshal-payload-error": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(&payloadInfo{value: []byte("{")}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "failed to unmarshal update-authorization request payload"),
+			}
+		},
+		"fail/malformed-payload-error": func(t *testing.T) test {
+			b, err := json.Marshal(&UpdateAuthorizationRequest{Status: acme.StatusValid})
+			assert.FatalError(t, err)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(&payloadInfo{value: b}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "cannot update authorization status to valid, only deactivated"),
+			}
+		},
+		"fail/account-id-mismatch": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						az := newAuthz(acme.StatusPending)
+						az.AccountID = "foo"
+						return az, nil
+					},
+				},
+				ctx:        newContext(&payloadInfo{value: deactivate}),
+				statusCode: 401,
+				err:        acme.NewError(acme.ErrorUnauthorizedType, "account id mismatch"),
+			}
+		},
+		"fail/already-invalid": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						return newAuthz(acme.StatusInvalid), nil
+					},
+				},
+				ctx:        newContext(&payloadInfo{value: deactivate}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "cannot deactivate authorization with status invalid"),
+			}
+		},
+		"fail/db.UpdateAuthorization-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						return newAuthz(acme.StatusPending), nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						return acme.NewErrorISE("force")
+					},
+				},
+				ctx:        newContext(&payloadInfo{value: deactivate}),
+				statusCode: 500,
+				err:        acme.NewErrorISE("force"),
+			}
+		},
+		"ok/post-as-get": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						return newAuthz(acme.StatusPending), nil
+					},
+				},
+				ctx:        newContext(&payloadInfo{isPostAsGet: true}),
+				az:         newAuthz(acme.StatusPending),
+				statusCode: 200,
+			}
+		},
+		"ok/deactivate": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						assert.Equals(t, id, "authzID")
+						return newAuthz(acme.StatusValid), nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.Equals(t, az.ID, "authzID")
+						assert.Equals(t, az.Status, acme.StatusDeactivated)
+						return nil
+					},
+				},
+				ctx:        newContext(&payloadInfo{value: deactivate}),
+				az:         newAuthz(acme.StatusDeactivated),
+				statusCode: 200,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			linker := acme.NewLinker("test.ca.smallstep.com", "acme")
+			ctx := acme.NewContext(tc.ctx, tc.db, nil, linker, nil)
+			req := httptest.NewRequest("POST", "/foo/bar", nil)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetOrUpdateAuthorization(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, ae.Identifier, tc.err.Identifier)
+				assert.Equals(t, ae.Subproblems, tc.err.Subproblems)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				linker.LinkAuthorization(ctx, tc.az)
+				expB, err := json.Marshal(tc.az)
+				assert.FatalError(t, err)
+				assert.Equals(t, bytes.TrimSpace(body), expB)
+				assert.Equals(t, res.Header["Location"], []string{u})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
+
 func TestHandler_GetCertificate(t *testing.T) {
 	leaf, err := pemutil.ReadCertificate("../../authority/testdata/certs/foo.crt")
 	assert.FatalError(t, err)
@@ -26,6 +26,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Replaces    string            `json:"replaces,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -125,6 +126,14 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The replaced certificate must belong to the account, see ACME ARI.
+	if nor.Replaces != "" {
+		if err := validateReplaces(r, acc.ID, nor.Replaces, nor.Identifiers); err != nil {
+			render.Error(w, err)
+			return
+		}
+	}
+
 	// TODO(hs): gather all errors, so that we can build one response with ACME subproblems
 	// include the nor.Validate() error here too, like in the example in the ACME RFC?
 
@@ -178,6 +187,7 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		Replaces:         nor.Replaces,
 	}
 
 	for i, identifier := range o.Identifiers {
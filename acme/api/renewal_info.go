@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/internal/tpm"
+)
+
+// renewalInfoRetryAfter is the time a client should wait before polling the
+// renewal information of a certificate again.
+const renewalInfoRetryAfter = 6 * time.Hour
+
+// GetRenewalInfo is the ACME api for retrieving the renewal information of a
+// certificate, as defined in the ACME Renewal Information (ARI) extension.
+//
+// The suggested renewal window is computed from the validity of the
+// certificate, and it's moved to the past if the certificate has been revoked
+// or if the CA wants it to be rotated.
+func GetRenewalInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ca := mustAuthority(ctx)
+	db := acme.MustDatabaseFromContext(ctx)
+
+	aki, serial, err := acme.ParseCertificateID(chi.URLParam(r, "certID"))
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	cert, err := db.GetCertificateBySerial(ctx, serial.String())
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving certificate by serial"))
+		return
+	}
+	if !acme.MatchesCertificateID(cert.Leaf, aki, serial) {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType,
+			"certificate with serial %s was not issued by the given authority key identifier", serial))
+		return
+	}
+
+	ri := acme.NewRenewalInfo(cert.Leaf)
+	revoked, err := ca.IsRevoked(serial.String())
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error checking revocation status"))
+		return
+	}
+	if revoked {
+		ri.RenewNow(cert.Leaf, clock.Now())
+	} else if rc, ok := ca.(acme.RotationChecker); ok && rc.ShouldRotate(cert.Leaf) {
+		ri.RenewNow(cert.Leaf, clock.Now())
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(renewalInfoRetryAfter.Seconds())))
+	render.JSON(w, ri)
+}
+
+// validateReplaces checks that the certificate identified by the replaces
+// field of a new-order request can be replaced by the given account with an
+// order for the given identifiers.
+func validateReplaces(r *http.Request, accID, replaces string, identifiers []acme.Identifier) error {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	aki, serial, err := acme.ParseCertificateID(replaces)
+	if err != nil {
+		return err
+	}
+	cert, err := db.GetCertificateBySerial(ctx, serial.String())
+	if err != nil {
+		return acme.WrapErrorISE(err, "error retrieving certificate by serial")
+	}
+	if !acme.MatchesCertificateID(cert.Leaf, aki, serial) {
+		return acme.NewError(acme.ErrorMalformedType,
+			"certificate with serial %s was not issued by the given authority key identifier", serial)
+	}
+	if cert.AccountID != accID {
+		return acme.NewError(acme.ErrorUnauthorizedType,
+			"account '%s' does not own certificate '%s'", accID, cert.ID)
+	}
+
+	if cert.ReplacedBy != "" {
+		return acme.NewError(acme.ErrorAlreadyReplacedType,
+			"certificate with serial %s has already been replaced", serial)
+	}
+
+	// The new order must share at least one identifier with the certificate.
+	var shared bool
+	for _, identifier := range identifiers {
+		switch identifier.Type {
+		case acme.DNS:
+			for _, name := range cert.Leaf.DNSNames {
+				shared = shared || name == identifier.Value
+			}
+		case acme.IP:
+			for _, ip := range cert.Leaf.IPAddresses {
+				shared = shared || ip.Equal(net.ParseIP(identifier.Value))
+			}
+		case acme.PermanentIdentifier:
+			ids, err := tpm.PermanentIdentifiers(cert.Leaf)
+			if err != nil {
+				return acme.WrapErrorISE(err, "error parsing permanent identifiers")
+			}
+			for _, id := range ids {
+				shared = shared || id == identifier.Value
+			}
+		default:
+			return acme.NewError(acme.ErrorMalformedType,
+				"identifier type %s is not supported in replacement orders", identifier.Type)
+		}
+	}
+	if shared {
+		return nil
+	}
+	return acme.NewError(acme.ErrorMalformedType,
+		"certificate with serial %s does not share any identifier with the order", serial)
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/internal/tpm/tpmtest"
+)
+
+type mockRotationCA struct {
+	mockCA
+	MockShouldRotate func(crt *x509.Certificate) bool
+}
+
+func (m *mockRotationCA) ShouldRotate(crt *x509.Certificate) bool {
+	if m.MockShouldRotate != nil {
+		return m.MockShouldRotate(crt)
+	}
+	return false
+}
+
+func mustRenewalInfoCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "example.com"},
+		DNSNames:    []string{"example.com"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		PublicKey:   signer.Public(),
+		NotBefore:   time.Now().Truncate(time.Second),
+		NotAfter:    time.Now().Truncate(time.Second).Add(24 * time.Hour),
+	})
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestHandler_GetRenewalInfo(t *testing.T) {
+	leaf := mustRenewalInfoCertificate(t)
+	other := mustRenewalInfoCertificate(t)
+	certID := acme.CertificateID(leaf)
+
+	type test struct {
+		db         acme.DB
+		ca         acme.CertificateAuthority
+		certID     string
+		statusCode int
+		renewNow   bool
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/bad-certID": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ca:         &mockCA{},
+				certID:     "foo",
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "certificate identifier foo is not valid"),
+			}
+		},
+		"fail/db.GetCertificateBySerial-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						assert.Equals(t, serial, leaf.SerialNumber.String())
+						return nil, errors.New("force")
+					},
+				},
+				ca:         &mockCA{},
+				certID:     certID,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error retrieving certificate by serial: force"),
+			}
+		},
+		"fail/authority-key-id-mismatch": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{ID: "certID", Leaf: leaf}, nil
+					},
+				},
+				ca:         &mockCA{},
+				certID:     acme.CertificateID(&x509.Certificate{AuthorityKeyId: other.AuthorityKeyId, SerialNumber: leaf.SerialNumber}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "certificate was not issued by the given authority key identifier"),
+			}
+		},
+		"fail/ca.IsRevoked-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{ID: "certID", Leaf: leaf}, nil
+					},
+				},
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						return false, errors.New("force")
+					},
+				},
+				certID:     certID,
+				statusCode: 500,
+				err:        acme.NewErrorISE("error checking revocation status: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{ID: "certID", Leaf: leaf}, nil
+					},
+				},
+				ca: &mockRotationCA{
+					MockShouldRotate: func(crt *x509.Certificate) bool {
+						assert.Equals(t, crt, leaf)
+						return false
+					},
+				},
+				certID:     certID,
+				statusCode: 200,
+			}
+		},
+		"ok/revoked": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{ID: "certID", Leaf: leaf}, nil
+					},
+				},
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						assert.Equals(t, sn, leaf.SerialNumber.String())
+						return true, nil
+					},
+				},
+				certID:     certID,
+				statusCode: 200,
+				renewNow:   true,
+			}
+		},
+		"ok/rotated": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{ID: "certID", Leaf: leaf}, nil
+					},
+				},
+				ca: &mockRotationCA{
+					MockShouldRotate: func(crt *x509.Certificate) bool {
+						return true
+					},
+				},
+				certID:     certID,
+				statusCode: 200,
+				renewNow:   true,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.ca)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", tc.certID)
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewContext(ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
+			req := httptest.NewRequest("GET", "/foo/bar", nil)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetRenewalInfo(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				var ri acme.RenewalInfo
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ri))
+				if tc.renewNow {
+					assert.True(t, leaf.NotBefore.Equal(ri.SuggestedWindow.Start))
+					assert.True(t, ri.SuggestedWindow.End.Before(leaf.NotBefore.Add(time.Hour)))
+				} else {
+					exp := acme.NewRenewalInfo(leaf)
+					assert.True(t, exp.SuggestedWindow.Start.Equal(ri.SuggestedWindow.Start))
+					assert.True(t, exp.SuggestedWindow.End.Equal(ri.SuggestedWindow.End))
+				}
+				assert.Equals(t, res.Header["Retry-After"], []string{"21600"})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
+
+func Test_validateReplaces(t *testing.T) {
+	leaf := mustRenewalInfoCertificate(t)
+	certID := acme.CertificateID(leaf)
+	replaced := mustRenewalInfoCertificate(t)
+	replacedID := acme.CertificateID(replaced)
+
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	device, err := ca.Sign(&x509.Certificate{
+		PublicKey:       signer.Public(),
+		NotBefore:       time.Now().Truncate(time.Second),
+		NotAfter:        time.Now().Truncate(time.Second).Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{tpmtest.PermanentIdentifierExtension(t, "1234")},
+	})
+	assert.FatalError(t, err)
+	deviceID := acme.CertificateID(device)
+
+	db := &acme.MockDB{
+		MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+			switch serial {
+			case leaf.SerialNumber.String():
+				return &acme.Certificate{ID: "certID", AccountID: "accID", Leaf: leaf}, nil
+			case replaced.SerialNumber.String():
+				return &acme.Certificate{ID: "replacedID", AccountID: "accID", Leaf: replaced, ReplacedBy: "orderID"}, nil
+			case device.SerialNumber.String():
+				return &acme.Certificate{ID: "deviceID", AccountID: "accID", Leaf: device}, nil
+			default:
+				return nil, acme.NewError(acme.ErrorMalformedType, "certificate with serial %s not found", serial)
+			}
+		},
+	}
+
+	tests := []struct {
+		name        string
+		accID       string
+		replaces    string
+		identifiers []acme.Identifier
+		wantType    string
+	}{
+		{"ok dns", "accID", certID, []acme.Identifier{{Type: "dns", Value: "foo.com"}, {Type: "dns", Value: "example.com"}}, ""},
+		{"ok ip", "accID", certID, []acme.Identifier{{Type: "ip", Value: "127.0.0.1"}}, ""},
+		{"ok permanent-identifier", "accID", deviceID, []acme.Identifier{{Type: "permanent-identifier", Value: "1234"}}, ""},
+		{"fail certID", "accID", "foo", []acme.Identifier{{Type: "dns", Value: "example.com"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail not found", "accID", acme.CertificateID(&x509.Certificate{AuthorityKeyId: leaf.AuthorityKeyId, SerialNumber: new(big.Int).Add(leaf.SerialNumber, big.NewInt(1))}), []acme.Identifier{{Type: "dns", Value: "example.com"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail account", "otherAccID", certID, []acme.Identifier{{Type: "dns", Value: "example.com"}}, "urn:ietf:params:acme:error:unauthorized"},
+		{"fail identifiers", "accID", certID, []acme.Identifier{{Type: "dns", Value: "foo.com"}, {Type: "ip", Value: "10.0.0.1"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail permanent-identifier", "accID", deviceID, []acme.Identifier{{Type: "permanent-identifier", Value: "5678"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail unknown type", "accID", certID, []acme.Identifier{{Type: "dns", Value: "example.com"}, {Type: "foo", Value: "example.com"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail already replaced", "accID", replacedID, []acme.Identifier{{Type: "dns", Value: "example.com"}}, "urn:ietf:params:acme:error:alreadyReplaced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := acme.NewDatabaseContext(context.Background(), db)
+			req := httptest.NewRequest("POST", "/foo/bar", nil).WithContext(ctx)
+			err := validateReplaces(req, tt.accID, tt.replaces, tt.identifiers)
+			if tt.wantType == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			var ae *acme.Error
+			if assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, tt.wantType, ae.Type)
+			}
+		})
+	}
+}
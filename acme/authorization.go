@@ -38,6 +38,8 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 		return nil
 	case StatusValid:
 		return nil
+	case StatusDeactivated:
+		return nil
 	case StatusPending:
 		// check expiry
 		if now.After(az.ExpiresAt) {
@@ -67,3 +69,20 @@ func (az *Authorization) UpdateStatus(ctx context.Context, db DB) error {
 	}
 	return nil
 }
+
+// Deactivate deactivates a pending or valid ACME Authorization, as described
+// in RFC 8555 section 7.5.2. Changes to the Authorization are saved using the
+// database interface.
+func (az *Authorization) Deactivate(ctx context.Context, db DB) error {
+	switch az.Status {
+	case StatusPending, StatusValid:
+		az.Status = StatusDeactivated
+	default:
+		return NewError(ErrorMalformedType, "cannot deactivate authorization with status %s", az.Status)
+	}
+
+	if err := db.UpdateAuthorization(ctx, az); err != nil {
+		return WrapErrorISE(err, "error updating authorization")
+	}
+	return nil
+}
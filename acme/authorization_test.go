@@ -32,6 +32,14 @@ func TestAuthorization_UpdateStatus(t *testing.T) {
 				az: az,
 			}
 		},
+		"ok/already-deactivated": func(t *testing.T) test {
+			az := &Authorization{
+				Status: StatusDeactivated,
+			}
+			return test{
+				az: az,
+			}
+		},
 		"fail/error-unexpected-status": func(t *testing.T) test {
 			az := &Authorization{
 				Status: "foo",
@@ -148,3 +156,100 @@ func TestAuthorization_UpdateStatus(t *testing.T) {
 
 	}
 }
+
+func TestAuthorization_Deactivate(t *testing.T) {
+	type test struct {
+		az  *Authorization
+		err *Error
+		db  DB
+	}
+	tests := map[string]func(t *testing.T) test{
+		"fail/already-invalid": func(t *testing.T) test {
+			az := &Authorization{
+				Status: StatusInvalid,
+			}
+			return test{
+				az:  az,
+				err: NewError(ErrorMalformedType, "cannot deactivate authorization with status invalid"),
+			}
+		},
+		"fail/already-deactivated": func(t *testing.T) test {
+			az := &Authorization{
+				Status: StatusDeactivated,
+			}
+			return test{
+				az:  az,
+				err: NewError(ErrorMalformedType, "cannot deactivate authorization with status deactivated"),
+			}
+		},
+		"fail/db.UpdateAuthorization-error": func(t *testing.T) test {
+			az := &Authorization{
+				ID:     "azID",
+				Status: StatusPending,
+			}
+			return test{
+				az: az,
+				db: &MockDB{
+					MockUpdateAuthorization: func(ctx context.Context, updaz *Authorization) error {
+						return errors.New("force")
+					},
+				},
+				err: NewErrorISE("error updating authorization: force"),
+			}
+		},
+		"ok/pending": func(t *testing.T) test {
+			az := &Authorization{
+				ID:     "azID",
+				Status: StatusPending,
+			}
+			return test{
+				az: az,
+				db: &MockDB{
+					MockUpdateAuthorization: func(ctx context.Context, updaz *Authorization) error {
+						assert.Equals(t, updaz.ID, az.ID)
+						assert.Equals(t, updaz.Status, StatusDeactivated)
+						return nil
+					},
+				},
+			}
+		},
+		"ok/valid": func(t *testing.T) test {
+			az := &Authorization{
+				ID:     "azID",
+				Status: StatusValid,
+			}
+			return test{
+				az: az,
+				db: &MockDB{
+					MockUpdateAuthorization: func(ctx context.Context, updaz *Authorization) error {
+						assert.Equals(t, updaz.ID, az.ID)
+						assert.Equals(t, updaz.Status, StatusDeactivated)
+						return nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := run(t)
+			if err := tc.az.Deactivate(context.Background(), tc.db); err != nil {
+				if assert.NotNil(t, tc.err) {
+					var k *Error
+					if errors.As(err, &k) {
+						assert.Equals(t, k.Type, tc.err.Type)
+						assert.Equals(t, k.Detail, tc.err.Detail)
+						assert.Equals(t, k.Status, tc.err.Status)
+						assert.Equals(t, k.Err.Error(), tc.err.Err.Error())
+					} else {
+						assert.FatalError(t, errors.New("unexpected error type"))
+					}
+				}
+			} else {
+				if assert.Nil(t, tc.err) {
+					assert.Equals(t, tc.az.Status, StatusDeactivated)
+				}
+			}
+		})
+	}
+}
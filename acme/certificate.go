@@ -11,4 +11,7 @@ type Certificate struct {
 	OrderID       string
 	Leaf          *x509.Certificate
 	Intermediates []*x509.Certificate
+	// ReplacedBy is the ID of the order that replaced the certificate, as
+	// defined in the ACME Renewal Information (ARI) extension.
+	ReplacedBy string
 }
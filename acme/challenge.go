@@ -27,6 +27,7 @@ import (
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/internal/tpm"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/pemutil"
 )
@@ -372,8 +373,6 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 
 		// Validate Apple's ClientIdentifier (Identifier.Value) with device
 		// identifiers.
-		//
-		// Note: We might want to use an external service for this.
 		if data.UDID != ch.Value && data.SerialNumber != ch.Value {
 			return storeError(ctx, db, ch, true, NewError(ErrorBadAttestationStatementType, "permanent identifier does not match"))
 		}
@@ -390,17 +389,48 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 			return WrapErrorISE(err, "error validating attestation")
 		}
 
-		// Validate Apple's ClientIdentifier (Identifier.Value) with device
+		// Validate the YubiKey serial number (Identifier.Value) with device
 		// identifiers.
-		//
-		// Note: We might want to use an external service for this.
 		if data.SerialNumber != ch.Value {
 			return storeError(ctx, db, ch, true, NewError(ErrorBadAttestationStatementType, "permanent identifier does not match"))
 		}
+	case "tpm":
+		data, err := doTPMAttestationFormat(ctx, prov, ch, jwk, &att)
+		if err != nil {
+			var acmeError *Error
+			if errors.As(err, &acmeError) {
+				if acmeError.Status == 500 {
+					return acmeError
+				}
+				return storeError(ctx, db, ch, true, acmeError)
+			}
+			return WrapErrorISE(err, "error validating attestation")
+		}
+
+		// Validate the permanent identifier of the TPM with the identifier
+		// value.
+		var found bool
+		for _, id := range data.PermanentIdentifiers {
+			if id == ch.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return storeError(ctx, db, ch, true, NewError(ErrorBadAttestationStatementType, "permanent identifier does not match"))
+		}
 	default:
 		return storeError(ctx, db, ch, true, NewError(ErrorBadAttestationStatementType, "unexpected attestation object format"))
 	}
 
+	// Confirm that the device is enrolled in the device inventory.
+	if _, err := prov.LookupDevice(ctx, ch.Value); err != nil {
+		if errors.Is(err, provisioner.ErrDeviceNotEnrolled) || errors.Is(err, provisioner.ErrDeviceDecommissioned) {
+			return storeError(ctx, db, ch, true, WrapError(ErrorRejectedIdentifierType, err, "device %s is not allowed", ch.Value))
+		}
+		return WrapErrorISE(err, "error looking up device %s", ch.Value)
+	}
+
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
@@ -654,6 +684,215 @@ func doStepAttestationFormat(ctx context.Context, prov Provisioner, ch *Challeng
 	return data, nil
 }
 
+type tpmAttestationData struct {
+	Certificate          *x509.Certificate
+	PermanentIdentifiers []string
+	PublicKey            crypto.PublicKey
+}
+
+// doTPMAttestationFormat validates a TPM 2.0 attestation statement as defined
+// in https://www.w3.org/TR/webauthn-2/#sctn-tpm-attestation. The statement
+// contains the attestation key certificate chain in x5c, a TPMS_ATTEST
+// structure of type certify in certInfo, the TPMT_PUBLIC structure of the
+// certified key in pubArea, and the signature of certInfo with the attestation
+// key in sig.
+//
+// The statement must also contain the endorsement key certificate chain in
+// ekx5c. The attestation key chain must be valid for the attestation roots,
+// and the endorsement key chain for the endorsement roots, the roots of the
+// TPM manufacturers. The attestation key certificate must bind the
+// attestation key to the endorsement key with a permanent identifier with the
+// tcg-on-ekPermIdSha256 assigner and the SHA-256 of the endorsement key, as
+// the attestation CA asserts after the credential activation.
+//
+// The certified key must be the ACME account key, it must have been generated
+// by the TPM and not be exportable, and the extra data in certInfo must be the
+// SHA-256 of the key authorization.
+func doTPMAttestationFormat(ctx context.Context, prov Provisioner, ch *Challenge, jwk *jose.JSONWebKey, att *AttestationObject) (*tpmAttestationData, error) {
+	// There are no default roots for TPMs, the roots of the attestation CAs
+	// and the TPM manufacturers must be configured.
+	roots, ok := prov.GetAttestationRoots()
+	if !ok {
+		return nil, NewErrorISE("no attestation roots configured for tpm format")
+	}
+	ekRoots, ok := prov.GetEndorsementRoots()
+	if !ok {
+		return nil, NewErrorISE("no endorsement roots configured for tpm format")
+	}
+
+	if ver, ok := att.AttStatement["ver"].(string); !ok || ver != "2.0" {
+		return nil, NewError(ErrorBadAttestationStatementType, "ver must be 2.0")
+	}
+
+	// Extract x5c and ekx5c and verify the certificates
+	akCert, err := verifyTPMCertificateChain(att.AttStatement, "x5c", roots)
+	if err != nil {
+		return nil, err
+	}
+	ekCert, err := verifyTPMCertificateChain(att.AttStatement, "ekx5c", ekRoots)
+	if err != nil {
+		return nil, err
+	}
+
+	// The attestation key certificate must be an end-entity certificate with
+	// the tcg-kp-AIKCertificate extended key usage.
+	if akCert.IsCA {
+		return nil, NewError(ErrorBadAttestationStatementType, "x5c is not valid: attestation key certificate is a CA")
+	}
+	var hasAIKUsage bool
+	for _, eku := range akCert.UnknownExtKeyUsage {
+		if eku.Equal(tpm.OIDTCGKpAIKCertificate) {
+			hasAIKUsage = true
+			break
+		}
+	}
+	if !hasAIKUsage {
+		return nil, NewError(ErrorBadAttestationStatementType, "x5c is not valid: attestation key certificate does not have the tcg-kp-AIKCertificate extended key usage")
+	}
+
+	// Verify the signature of certInfo with the attestation key.
+	certInfo, ok := att.AttStatement["certInfo"].([]byte)
+	if !ok {
+		return nil, NewError(ErrorBadAttestationStatementType, "certInfo not present")
+	}
+	pubArea, ok := att.AttStatement["pubArea"].([]byte)
+	if !ok {
+		return nil, NewError(ErrorBadAttestationStatementType, "pubArea not present")
+	}
+	sig, ok := att.AttStatement["sig"].([]byte)
+	if !ok {
+		return nil, NewError(ErrorBadAttestationStatementType, "sig not present")
+	}
+	alg, ok := coseAlgorithm(att.AttStatement["alg"])
+	if !ok {
+		return nil, NewError(ErrorBadAttestationStatementType, "alg not present")
+	}
+	sigAlg, err := tpm.SignatureAlgorithm(alg)
+	if err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "alg is not valid")
+	}
+	if err := akCert.CheckSignature(sigAlg, certInfo, sig); err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "failed to validate signature")
+	}
+
+	// Verify that certInfo certifies the key in pubArea.
+	info, err := tpm.ParseCertifyInfo(certInfo)
+	if err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "certInfo is malformed")
+	}
+	pub, err := tpm.ParsePublic(pubArea)
+	if err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "pubArea is malformed")
+	}
+	name, err := tpm.Name(pub.NameAlg, pubArea)
+	if err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "pubArea is malformed")
+	}
+	if subtle.ConstantTimeCompare(info.Name, name) != 1 {
+		return nil, NewError(ErrorBadAttestationStatementType, "certInfo does not certify pubArea")
+	}
+
+	// A key imported into the TPM can also exist outside of it.
+	if err := pub.VerifyHardwareBound(); err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "pubArea is not valid")
+	}
+
+	// Verify the binding with the ACME account key and the challenge.
+	if k, ok := pub.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(jwk.Key) {
+		return nil, NewError(ErrorBadAttestationStatementType, "attested key does not match the account key")
+	}
+	keyAuth, err := KeyAuthorization(ch.Token, jwk)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	if subtle.ConstantTimeCompare(info.ExtraData, sum[:]) != 1 {
+		return nil, NewError(ErrorBadAttestationStatementType, "key authorization does not match")
+	}
+
+	pids, err := tpm.ParsePermanentIdentifiers(akCert)
+	if err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "error parsing permanent identifiers")
+	}
+
+	// Verify the binding of the attestation key with the endorsement key.
+	ekID := tpm.EKPermanentIdentifier(ekCert)
+	var ids []string
+	var boundToEK bool
+	for _, pid := range pids {
+		if pid.Value != "" {
+			ids = append(ids, pid.Value)
+		}
+		boundToEK = boundToEK || pid.Equal(ekID)
+	}
+	if !boundToEK {
+		return nil, NewError(ErrorBadAttestationStatementType, "x5c is not valid: attestation key certificate is not bound to the endorsement key")
+	}
+
+	return &tpmAttestationData{
+		Certificate:          akCert,
+		PermanentIdentifiers: ids,
+		PublicKey:            pub.PublicKey,
+	}, nil
+}
+
+// verifyTPMCertificateChain parses the certificate chain in the given property
+// of a TPM attestation statement and verifies it with the given roots.
+// It returns the leaf certificate.
+func verifyTPMCertificateChain(stmt map[string]interface{}, property string, roots *x509.CertPool) (*x509.Certificate, error) {
+	chain, ok := stmt[property].([]interface{})
+	if !ok {
+		return nil, NewError(ErrorBadAttestationStatementType, "%s not present", property)
+	}
+	if len(chain) == 0 {
+		return nil, NewError(ErrorRejectedIdentifierType, "%s is empty", property)
+	}
+	der, ok := chain[0].([]byte)
+	if !ok {
+		return nil, NewError(ErrorBadAttestationStatementType, "%s is malformed", property)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "%s is malformed", property)
+	}
+	intermediates := x509.NewCertPool()
+	for _, v := range chain[1:] {
+		der, ok = v.([]byte)
+		if !ok {
+			return nil, NewError(ErrorBadAttestationStatementType, "%s is malformed", property)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, WrapError(ErrorBadAttestationStatementType, err, "%s is malformed", property)
+		}
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         roots,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, WrapError(ErrorBadAttestationStatementType, err, "%s is not valid", property)
+	}
+	return leaf, nil
+}
+
+// coseAlgorithm returns the COSE algorithm identifier in an attestation
+// statement. Depending on the sign CBOR decodes it as an int64 or uint64.
+func coseAlgorithm(v interface{}) (int64, bool) {
+	switch alg := v.(type) {
+	case int64:
+		return alg, true
+	case int:
+		return int64(alg), true
+	case uint64:
+		return int64(alg), true
+	default:
+		return 0, false
+	}
+}
+
 // serverName determines the SNI HostName to set based on an acme.Challenge
 // for TLS-ALPN-01 challenges RFC8738 states that, if HostName is an IP, it
 // should be the ARPA address https://datatracker.ietf.org/doc/html/rfc8738#section-6.
@@ -32,6 +32,8 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/internal/tpm"
+	"github.com/smallstep/certificates/internal/tpm/tpmtest"
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
@@ -66,6 +68,24 @@ func mustAttestationProvisioner(t *testing.T, roots []byte) Provisioner {
 	return prov
 }
 
+func mustTPMAttestationProvisioner(t *testing.T, roots, ekRoots []byte) Provisioner {
+	t.Helper()
+
+	prov := &provisioner.ACME{
+		Type:             "ACME",
+		Name:             "acme",
+		Challenges:       []provisioner.ACMEChallenge{provisioner.DEVICE_ATTEST_01},
+		AttestationRoots: roots,
+		EndorsementRoots: ekRoots,
+	}
+	if err := prov.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return prov
+}
+
 func Test_storeError(t *testing.T) {
 	type test struct {
 		ch          *Challenge
@@ -2774,3 +2794,266 @@ func Test_doStepAttestationFormat(t *testing.T) {
 		})
 	}
 }
+
+func Test_doTPMAttestationFormat(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caRoot := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+
+	ekCA, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ekRoot := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ekCA.Root.Raw})
+
+	otherCA, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ekSigner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ekCert, err := ekCA.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "EK"},
+		PublicKey: ekSigner.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An endorsement key certificate signed by the attestation CA.
+	akCAEKCert, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "EK"},
+		PublicKey: ekSigner.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEKCert, err := otherCA.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "EK"},
+		PublicKey: ekSigner.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ekID := tpm.EKPermanentIdentifier(ekCert)
+
+	akSigner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeAKCert := func(ekus []asn1.ObjectIdentifier, id tpm.PermanentIdentifier) *x509.Certificate {
+		crt, err := ca.Sign(&x509.Certificate{
+			PublicKey:          akSigner.Public(),
+			UnknownExtKeyUsage: ekus,
+			ExtraExtensions: []pkix.Extension{
+				tpmtest.PermanentIdentifiersExtension(t, id),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crt
+	}
+	akCert := makeAKCert([]asn1.ObjectIdentifier{tpm.OIDTCGKpAIKCertificate}, ekID)
+	noAIKCert := makeAKCert(nil, ekID)
+	unboundAKCert := makeAKCert([]asn1.ObjectIdentifier{tpm.OIDTCGKpAIKCertificate}, tpm.PermanentIdentifier{Value: "ek-1234"})
+	noAssignerAKCert := makeAKCert([]asn1.ObjectIdentifier{tpm.OIDTCGKpAIKCertificate}, tpm.PermanentIdentifier{Value: ekID.Value})
+
+	// The account key is the attested key.
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := jwk.Public()
+	accountKey := &pub
+	otherJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub := otherJWK.Public()
+
+	keyAuth, err := KeyAuthorization("token", accountKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyAuthSum := sha256.Sum256([]byte(keyAuth))
+
+	pubArea := tpmtest.Public(t, pub.Key)
+	name, err := tpm.Name(tpm.AlgSHA256, pubArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(certInfo []byte) []byte {
+		sum := sha256.Sum256(certInfo)
+		sig, err := akSigner.Sign(rand.Reader, sum[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	certInfo := tpmtest.CertifyInfo(t, keyAuthSum[:], name)
+	sig := sign(certInfo)
+
+	badNameInfo := tpmtest.CertifyInfo(t, keyAuthSum[:], []byte("name"))
+	badExtraDataInfo := tpmtest.CertifyInfo(t, []byte("extra data"), name)
+	otherPubArea := tpmtest.Public(t, otherPub.Key)
+	otherName, err := tpm.Name(tpm.AlgSHA256, otherPubArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKeyInfo := tpmtest.CertifyInfo(t, keyAuthSum[:], otherName)
+	importedPubArea := tpmtest.PublicWithAttributes(t, pub.Key, tpm.AttrFixedTPM|tpm.AttrFixedParent)
+	importedName, err := tpm.Name(tpm.AlgSHA256, importedPubArea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	importedKeyInfo := tpmtest.CertifyInfo(t, keyAuthSum[:], importedName)
+
+	attStatement := func(fn func(m map[string]interface{})) *AttestationObject {
+		m := map[string]interface{}{
+			"ver":      "2.0",
+			"x5c":      []interface{}{akCert.Raw, ca.Intermediate.Raw},
+			"ekx5c":    []interface{}{ekCert.Raw, ekCA.Intermediate.Raw},
+			"alg":      int64(-7),
+			"sig":      sig,
+			"certInfo": certInfo,
+			"pubArea":  pubArea,
+		}
+		if fn != nil {
+			fn(m)
+		}
+		return &AttestationObject{Format: "tpm", AttStatement: m}
+	}
+
+	type args struct {
+		ctx  context.Context
+		prov Provisioner
+		ch   *Challenge
+		jwk  *jose.JSONWebKey
+		att  *AttestationObject
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *tpmAttestationData
+		wantErr bool
+	}{
+		{"ok", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(nil)}, &tpmAttestationData{
+			Certificate:          akCert,
+			PermanentIdentifiers: []string{ekID.Value},
+			PublicKey:            pub.Key,
+		}, false},
+		{"ok int alg", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["alg"] = -7
+		})}, &tpmAttestationData{
+			Certificate:          akCert,
+			PermanentIdentifiers: []string{ekID.Value},
+			PublicKey:            pub.Key,
+		}, false},
+		{"fail no roots", args{ctx, mustTPMAttestationProvisioner(t, nil, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(nil)}, nil, true},
+		{"fail no endorsement roots", args{ctx, mustTPMAttestationProvisioner(t, caRoot, nil), &Challenge{Token: "token"}, accountKey, attStatement(nil)}, nil, true},
+		{"fail ver", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["ver"] = "1.2"
+		})}, nil, true},
+		{"fail x5c type", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = [][]byte{akCert.Raw, ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail x5c empty", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{}
+		})}, nil, true},
+		{"fail leaf parse", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{akCert.Raw[:100], ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail intermediate parse", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{akCert.Raw, ca.Intermediate.Raw[:100]}
+		})}, nil, true},
+		{"fail verify", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{akCert.Raw}
+		})}, nil, true},
+		{"fail ca", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail aik usage", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{noAIKCert.Raw, ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail ekx5c missing", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			delete(m, "ekx5c")
+		})}, nil, true},
+		{"fail ekx5c empty", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["ekx5c"] = []interface{}{}
+		})}, nil, true},
+		{"fail ekx5c verify", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["ekx5c"] = []interface{}{otherEKCert.Raw, otherCA.Intermediate.Raw}
+		})}, nil, true},
+		{"fail ekx5c attestation roots", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["ekx5c"] = []interface{}{akCAEKCert.Raw, ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail ek binding", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{unboundAKCert.Raw, ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail ek binding assigner", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["x5c"] = []interface{}{noAssignerAKCert.Raw, ca.Intermediate.Raw}
+		})}, nil, true},
+		{"fail imported key", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["certInfo"] = importedKeyInfo
+			m["sig"] = sign(importedKeyInfo)
+			m["pubArea"] = importedPubArea
+		})}, nil, true},
+		{"fail certInfo missing", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			delete(m, "certInfo")
+		})}, nil, true},
+		{"fail pubArea missing", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			delete(m, "pubArea")
+		})}, nil, true},
+		{"fail sig missing", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			delete(m, "sig")
+		})}, nil, true},
+		{"fail alg missing", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			delete(m, "alg")
+		})}, nil, true},
+		{"fail alg unsupported", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["alg"] = int64(-8)
+		})}, nil, true},
+		{"fail sig verify", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["sig"] = sign([]byte("other"))
+		})}, nil, true},
+		{"fail certInfo parse", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["certInfo"] = []byte("certInfo")
+			m["sig"] = sign([]byte("certInfo"))
+		})}, nil, true},
+		{"fail pubArea parse", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["pubArea"] = []byte("pubArea")
+		})}, nil, true},
+		{"fail name", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["certInfo"] = badNameInfo
+			m["sig"] = sign(badNameInfo)
+		})}, nil, true},
+		{"fail account key", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["certInfo"] = otherKeyInfo
+			m["sig"] = sign(otherKeyInfo)
+			m["pubArea"] = otherPubArea
+		})}, nil, true},
+		{"fail keyAuthorization", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "token"}, accountKey, attStatement(func(m map[string]interface{}) {
+			m["certInfo"] = badExtraDataInfo
+			m["sig"] = sign(badExtraDataInfo)
+		})}, nil, true},
+		{"fail token", args{ctx, mustTPMAttestationProvisioner(t, caRoot, ekRoot), &Challenge{Token: "other-token"}, accountKey, attStatement(nil)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := doTPMAttestationFormat(tt.args.ctx, tt.args.prov, tt.args.ch, tt.args.jwk, tt.args.att)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("doTPMAttestationFormat() error = %#v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("doTPMAttestationFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -74,6 +74,8 @@ type Provisioner interface {
 	IsChallengeEnabled(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	IsAttestationFormatEnabled(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	GetAttestationRoots() (*x509.CertPool, bool)
+	GetEndorsementRoots() (*x509.CertPool, bool)
+	LookupDevice(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error)
 	GetID() string
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
@@ -115,6 +117,8 @@ type MockProvisioner struct {
 	MisChallengeEnabled       func(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	MisAttFormatEnabled       func(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	MgetAttestationRoots      func() (*x509.CertPool, bool)
+	MgetEndorsementRoots      func() (*x509.CertPool, bool)
+	MlookupDevice             func(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error)
 	MdefaultTLSCertDuration   func() time.Duration
 	MgetOptions               func() *provisioner.Options
 }
@@ -174,6 +178,22 @@ func (m *MockProvisioner) GetAttestationRoots() (*x509.CertPool, bool) {
 	return m.Mret1.(*x509.CertPool), m.Mret1 != nil
 }
 
+// GetEndorsementRoots mock
+func (m *MockProvisioner) GetEndorsementRoots() (*x509.CertPool, bool) {
+	if m.MgetEndorsementRoots != nil {
+		return m.MgetEndorsementRoots()
+	}
+	return m.Mret1.(*x509.CertPool), m.Mret1 != nil
+}
+
+// LookupDevice mock
+func (m *MockProvisioner) LookupDevice(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error) {
+	if m.MlookupDevice != nil {
+		return m.MlookupDevice(ctx, permanentIdentifier)
+	}
+	return nil, m.Merr
+}
+
 // DefaultTLSCertDuration mock
 func (m *MockProvisioner) DefaultTLSCertDuration() time.Duration {
 	if m.MdefaultTLSCertDuration != nil {
@@ -12,12 +12,17 @@ import (
 // account.
 var ErrNotFound = errors.New("not found")
 
+// ErrKeyInUse is an error that should be used by the acme.DB interface to
+// indicate that an account key is already bound to another account.
+var ErrKeyInUse = errors.New("key is already in use")
+
 // DB is the DB interface expected by the step-ca ACME API.
 type DB interface {
 	CreateAccount(ctx context.Context, acc *Account) error
 	GetAccount(ctx context.Context, id string) (*Account, error)
 	GetAccountByKeyID(ctx context.Context, kid string) (*Account, error)
 	UpdateAccount(ctx context.Context, acc *Account) error
+	UpdateAccountKey(ctx context.Context, acc *Account) error
 
 	CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
 	GetExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
@@ -38,6 +43,7 @@ type DB interface {
 	CreateCertificate(ctx context.Context, cert *Certificate) error
 	GetCertificate(ctx context.Context, id string) (*Certificate, error)
 	GetCertificateBySerial(ctx context.Context, serial string) (*Certificate, error)
+	UpdateCertificateReplacedBy(ctx context.Context, id, orderID string) error
 
 	CreateChallenge(ctx context.Context, ch *Challenge) error
 	GetChallenge(ctx context.Context, id, authzID string) (*Challenge, error)
@@ -79,6 +85,7 @@ type MockDB struct {
 	MockGetAccount        func(ctx context.Context, id string) (*Account, error)
 	MockGetAccountByKeyID func(ctx context.Context, kid string) (*Account, error)
 	MockUpdateAccount     func(ctx context.Context, acc *Account) error
+	MockUpdateAccountKey  func(ctx context.Context, acc *Account) error
 
 	MockCreateExternalAccountKey         func(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
 	MockGetExternalAccountKey            func(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
@@ -96,9 +103,10 @@ type MockDB struct {
 	MockUpdateAuthorization          func(ctx context.Context, az *Authorization) error
 	MockGetAuthorizationsByAccountID func(ctx context.Context, accountID string) ([]*Authorization, error)
 
-	MockCreateCertificate      func(ctx context.Context, cert *Certificate) error
-	MockGetCertificate         func(ctx context.Context, id string) (*Certificate, error)
-	MockGetCertificateBySerial func(ctx context.Context, serial string) (*Certificate, error)
+	MockCreateCertificate           func(ctx context.Context, cert *Certificate) error
+	MockGetCertificate              func(ctx context.Context, id string) (*Certificate, error)
+	MockGetCertificateBySerial      func(ctx context.Context, serial string) (*Certificate, error)
+	MockUpdateCertificateReplacedBy func(ctx context.Context, id, orderID string) error
 
 	MockCreateChallenge func(ctx context.Context, ch *Challenge) error
 	MockGetChallenge    func(ctx context.Context, id, authzID string) (*Challenge, error)
@@ -153,6 +161,16 @@ func (m *MockDB) UpdateAccount(ctx context.Context, acc *Account) error {
 	return m.MockError
 }
 
+// UpdateAccountKey mock
+func (m *MockDB) UpdateAccountKey(ctx context.Context, acc *Account) error {
+	if m.MockUpdateAccountKey != nil {
+		return m.MockUpdateAccountKey(ctx, acc)
+	} else if m.MockError != nil {
+		return m.MockError
+	}
+	return m.MockError
+}
+
 // CreateExternalAccountKey mock
 func (m *MockDB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error) {
 	if m.MockCreateExternalAccountKey != nil {
@@ -313,6 +331,16 @@ func (m *MockDB) GetCertificateBySerial(ctx context.Context, serial string) (*Ce
 	return m.MockRet1.(*Certificate), m.MockError
 }
 
+// UpdateCertificateReplacedBy mock
+func (m *MockDB) UpdateCertificateReplacedBy(ctx context.Context, id, orderID string) error {
+	if m.MockUpdateCertificateReplacedBy != nil {
+		return m.MockUpdateCertificateReplacedBy(ctx, id, orderID)
+	} else if m.MockError != nil {
+		return m.MockError
+	}
+	return m.MockError
+}
+
 // CreateChallenge mock
 func (m *MockDB) CreateChallenge(ctx context.Context, ch *Challenge) error {
 	if m.MockCreateChallenge != nil {
@@ -134,3 +134,48 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 
 	return db.save(ctx, old.ID, nu, old, "account", accountTable)
 }
+
+// UpdateAccountKey imlements the AcmeDB.UpdateAccountKey interface. It replaces
+// the key of the stored account with the one in the given account. The new
+// key is reserved in the key-id to account-id index before the account is
+// updated, so the same key can never be bound to two accounts.
+func (db *DB) UpdateAccountKey(ctx context.Context, acc *acme.Account) error {
+	old, err := db.getDBAccount(ctx, acc.ID)
+	if err != nil {
+		return err
+	}
+
+	oldKid, err := acme.KeyToID(old.Key)
+	if err != nil {
+		return err
+	}
+	newKid, err := acme.KeyToID(acc.Key)
+	if err != nil {
+		return err
+	}
+	newKidB := []byte(newKid)
+
+	nu := old.clone()
+	nu.Key = acc.Key
+
+	// Set the new jwkID -> acme account ID index
+	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, newKidB, nil, []byte(acc.ID))
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped:
+		// Another account took the key after the handler checked it.
+		return errors.Wrap(acme.ErrKeyInUse, "key-id to account-id index already exists")
+	}
+
+	if err := db.save(ctx, old.ID, nu, old, "account", accountTable); err != nil {
+		db.db.Del(accountByKeyIDTable, newKidB)
+		return err
+	}
+
+	// Remove the old jwkID -> acme account ID index
+	if err := db.db.Del(accountByKeyIDTable, []byte(oldKid)); err != nil {
+		return errors.Wrapf(err, "error deleting keyID to accountID index for key %s", oldKid)
+	}
+	return nil
+}
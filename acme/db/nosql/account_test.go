@@ -696,3 +696,189 @@ func TestDB_UpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_UpdateAccountKey(t *testing.T) {
+	accID := "accID"
+	now := clock.Now()
+	oldJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	oldKid, err := acme.KeyToID(oldJWK)
+	assert.FatalError(t, err)
+	newKid, err := acme.KeyToID(newJWK)
+	assert.FatalError(t, err)
+	dbacc := &dbAccount{
+		ID:        accID,
+		Status:    acme.StatusValid,
+		CreatedAt: now,
+		Contact:   []string{"foo", "bar"},
+		Key:       oldJWK,
+	}
+	b, err := json.Marshal(dbacc)
+	assert.FatalError(t, err)
+	type test struct {
+		db  nosql.DB
+		acc *acme.Account
+		err error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				acc: &acme.Account{ID: accID, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, accountTable)
+						assert.Equals(t, string(key), accID)
+
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading account accID: force"),
+			}
+		},
+		"fail/keyID-cmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				acc: &acme.Account{ID: accID, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						assert.Equals(t, old, nil)
+						assert.Equals(t, nu, []byte(accID))
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error storing keyID to accountID index: force"),
+			}
+		},
+		"fail/keyID-cmpAndSwap-false": func(t *testing.T) test {
+			return test{
+				acc: &acme.Account{ID: accID, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						return []byte("otherAccID"), false, nil
+					},
+				},
+				err: acme.ErrKeyInUse,
+			}
+		},
+		"fail/account-save-error": func(t *testing.T) test {
+			var deleted bool
+			return test{
+				acc: &acme.Account{ID: accID, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							return nu, true, nil
+						case string(accountTable):
+							assert.Equals(t, string(key), accID)
+							assert.Equals(t, old, b)
+							return nil, false, errors.New("force")
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+							return nil, false, errors.New("force")
+						}
+					},
+					MDel: func(bucket, key []byte) error {
+						// The new index is rolled back.
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						assert.False(t, deleted)
+						deleted = true
+						return nil
+					},
+				},
+				err: errors.New("error saving acme account: force"),
+			}
+		},
+		"fail/db.Del-error": func(t *testing.T) test {
+			return test{
+				acc: &acme.Account{ID: accID, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), oldKid)
+						return errors.New("force")
+					},
+				},
+				err: errors.Errorf("error deleting keyID to accountID index for key %s: force", oldKid),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				acc: &acme.Account{ID: accID, Key: newJWK},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, accountTable)
+						assert.Equals(t, string(key), accID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), newKid)
+							assert.Equals(t, old, nil)
+							assert.Equals(t, nu, []byte(accID))
+							return nu, true, nil
+						case string(accountTable):
+							assert.Equals(t, string(key), accID)
+							assert.Equals(t, old, b)
+
+							dbNew := new(dbAccount)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, dbNew.ID, dbacc.ID)
+							assert.Equals(t, dbNew.Status, dbacc.Status)
+							assert.Equals(t, dbNew.Contact, dbacc.Contact)
+							assert.Equals(t, dbNew.Key.KeyID, newJWK.KeyID)
+							return nu, true, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
+							return nil, false, errors.New("force")
+						}
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), oldKid)
+						return nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			if err := d.UpdateAccountKey(context.Background(), tc.acc); err != nil {
+				if assert.NotNil(t, tc.err) {
+					if errors.Is(tc.err, acme.ErrKeyInUse) {
+						assert.True(t, errors.Is(err, acme.ErrKeyInUse))
+					} else {
+						assert.HasPrefix(t, err.Error(), tc.err.Error())
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+			}
+		})
+	}
+}
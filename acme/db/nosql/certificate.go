@@ -19,6 +19,7 @@ type dbCert struct {
 	OrderID       string    `json:"orderID"`
 	Leaf          []byte    `json:"leaf"`
 	Intermediates []byte    `json:"intermediates"`
+	ReplacedBy    string    `json:"replacedBy,omitempty"`
 }
 
 type dbSerial struct {
@@ -92,9 +93,37 @@ func (db *DB) GetCertificate(ctx context.Context, id string) (*acme.Certificate,
 		OrderID:       dbC.OrderID,
 		Leaf:          certs[0],
 		Intermediates: certs[1:],
+		ReplacedBy:    dbC.ReplacedBy,
 	}, nil
 }
 
+// UpdateCertificateReplacedBy marks an ACME certificate as replaced by the
+// given order. It fails with an alreadyReplaced error if the certificate has
+// been replaced by another order.
+func (db *DB) UpdateCertificateReplacedBy(ctx context.Context, id, orderID string) error {
+	b, err := db.db.Get(certTable, []byte(id))
+	if nosql.IsErrNotFound(err) {
+		return acme.NewError(acme.ErrorMalformedType, "certificate %s not found", id)
+	} else if err != nil {
+		return errors.Wrapf(err, "error loading certificate %s", id)
+	}
+	old := new(dbCert)
+	if err := json.Unmarshal(b, old); err != nil {
+		return errors.Wrapf(err, "error unmarshaling certificate %s", id)
+	}
+	switch old.ReplacedBy {
+	case orderID:
+		return nil
+	case "":
+		nu := *old
+		nu.ReplacedBy = orderID
+		return db.save(ctx, id, &nu, old, "certificate", certTable)
+	default:
+		return acme.NewError(acme.ErrorAlreadyReplacedType,
+			"certificate %s has already been replaced by order %s", id, old.ReplacedBy)
+	}
+}
+
 // GetCertificateBySerial retrieves and unmarshals an ACME certificate type from the
 // datastore based on a certificate serial number.
 func (db *DB) GetCertificateBySerial(ctx context.Context, serial string) (*acme.Certificate, error) {
@@ -275,6 +275,122 @@ func TestDB_GetCertificate(t *testing.T) {
 	}
 }
 
+func TestDB_UpdateCertificateReplacedBy(t *testing.T) {
+	certID := "certID"
+	mustCert := func(replacedBy string) []byte {
+		b, err := json.Marshal(dbCert{
+			ID:         certID,
+			AccountID:  "accountID",
+			OrderID:    "orderID",
+			CreatedAt:  clock.Now(),
+			ReplacedBy: replacedBy,
+		})
+		assert.FatalError(t, err)
+		return b
+	}
+	type test struct {
+		db      nosql.DB
+		err     error
+		acmeErr *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorMalformedType, "certificate certID not found"),
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading certificate certID: force"),
+			}
+		},
+		"fail/already-replaced": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return mustCert("otherOrderID"), nil
+					},
+				},
+				acmeErr: acme.NewError(acme.ErrorAlreadyReplacedType, "certificate certID has already been replaced by order otherOrderID"),
+			}
+		},
+		"fail/db.CmpAndSwap-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return mustCert(""), nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						return nil, false, errors.New("force")
+					},
+				},
+				err: errors.New("error saving acme certificate: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, certTable)
+						assert.Equals(t, string(key), certID)
+						return mustCert(""), nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, certTable)
+						assert.Equals(t, string(key), certID)
+						assert.Equals(t, old, mustCert(""))
+						dbc := new(dbCert)
+						assert.FatalError(t, json.Unmarshal(nu, dbc))
+						assert.Equals(t, dbc.ReplacedBy, "newOrderID")
+						return nu, true, nil
+					},
+				},
+			}
+		},
+		"ok/same-order": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return mustCert("newOrderID"), nil
+					},
+				},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			err := d.UpdateCertificateReplacedBy(context.Background(), certID, "newOrderID")
+			if err != nil {
+				var acmeErr *acme.Error
+				if errors.As(err, &acmeErr) {
+					if assert.NotNil(t, tc.acmeErr) {
+						assert.Equals(t, acmeErr.Type, tc.acmeErr.Type)
+						assert.Equals(t, acmeErr.Status, tc.acmeErr.Status)
+						assert.Equals(t, acmeErr.Err.Error(), tc.acmeErr.Err.Error())
+					}
+				} else if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Nil(t, tc.acmeErr)
+			}
+		})
+	}
+}
+
 func Test_parseBundle(t *testing.T) {
 	leaf, err := pemutil.ReadCertificate("../../../authority/testdata/certs/foo.crt")
 	assert.FatalError(t, err)
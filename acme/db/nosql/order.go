@@ -27,6 +27,7 @@ type dbOrder struct {
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
 	Error            *acme.Error       `json:"error,omitempty"`
+	Replaces         string            `json:"replaces,omitempty"`
 }
 
 func (a *dbOrder) clone() *dbOrder {
@@ -68,6 +69,7 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 		NotAfter:         dbo.NotAfter,
 		AuthorizationIDs: dbo.AuthorizationIDs,
 		Error:            dbo.Error,
+		Replaces:         dbo.Replaces,
 	}
 
 	return o, nil
@@ -93,6 +95,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
 		AuthorizationIDs: o.AuthorizationIDs,
+		Replaces:         o.Replaces,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
 		return err
@@ -81,6 +81,7 @@ func TestDB_getDBOrder(t *testing.T) {
 				},
 				AuthorizationIDs: []string{"foo", "bar"},
 				Error:            acme.NewError(acme.ErrorMalformedType, "The request message was malformed"),
+				Replaces:         "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE",
 			}
 			b, err := json.Marshal(dbo)
 			assert.FatalError(t, err)
@@ -186,6 +187,7 @@ func TestDB_GetOrder(t *testing.T) {
 				},
 				AuthorizationIDs: []string{"foo", "bar"},
 				Error:            acme.NewError(acme.ErrorMalformedType, "The request message was malformed"),
+				Replaces:         "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE",
 			}
 			b, err := json.Marshal(dbo)
 			assert.FatalError(t, err)
@@ -225,6 +227,7 @@ func TestDB_GetOrder(t *testing.T) {
 				assert.Equals(t, o.AccountID, tc.dbo.AccountID)
 				assert.Equals(t, o.ProvisionerID, tc.dbo.ProvisionerID)
 				assert.Equals(t, o.CertificateID, tc.dbo.CertificateID)
+				assert.Equals(t, o.Replaces, tc.dbo.Replaces)
 				assert.Equals(t, o.Status, tc.dbo.Status)
 				assert.Equals(t, o.ExpiresAt, tc.dbo.ExpiresAt)
 				assert.Equals(t, o.NotBefore, tc.dbo.NotBefore)
@@ -65,6 +65,8 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorAlreadyReplacedType request specified a certificate to be replaced that has already been replaced
+	ErrorAlreadyReplacedType
 )
 
 // String returns the string representation of the acme problem type,
@@ -119,6 +121,8 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorAlreadyReplacedType:
+		return "alreadyReplaced"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -239,6 +243,11 @@ var (
 			details: "The requested operation is not implemented",
 			status:  501,
 		},
+		ErrorAlreadyReplacedType: {
+			typ:     officialACMEPrefix + ErrorAlreadyReplacedType.String(),
+			details: "Certificate already replaced",
+			status:  409,
+		},
 		ErrorTLSType: {
 			typ:     officialACMEPrefix + ErrorTLSType.String(),
 			details: "The server received a TLS error during validation",
@@ -46,6 +46,8 @@ const (
 	RevokeCertLinkType
 	// KeyChangeLinkType key rollover
 	KeyChangeLinkType
+	// RenewalInfoLinkType renewal information
+	RenewalInfoLinkType
 )
 
 func (l LinkType) String() string {
@@ -74,6 +76,8 @@ func (l LinkType) String() string {
 		return "revoke-cert"
 	case KeyChangeLinkType:
 		return "key-change"
+	case RenewalInfoLinkType:
+		return "renewal-info"
 	default:
 		return fmt.Sprintf("unexpected LinkType '%d'", int(l))
 	}
@@ -91,6 +95,12 @@ func GetUnescapedPathSuffix(typ LinkType, provisionerName string, inputs ...stri
 		return fmt.Sprintf("/%s/%s/%s/orders", provisionerName, AccountLinkType, inputs[0])
 	case FinalizeLinkType:
 		return fmt.Sprintf("/%s/%s/%s/finalize", provisionerName, OrderLinkType, inputs[0])
+	case RenewalInfoLinkType:
+		// The directory links to the base url of the resource.
+		if len(inputs) == 0 {
+			return fmt.Sprintf("/%s/%s", provisionerName, typ)
+		}
+		return fmt.Sprintf("/%s/%s/%s", provisionerName, typ, inputs[0])
 	default:
 		return ""
 	}
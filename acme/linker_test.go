@@ -46,6 +46,8 @@ func TestGetUnescapedPathSuffix(t *testing.T) {
 	assert.Equals(t, getPath(AuthzLinkType, "{provisionerID}", "{authzID}"), "/{provisionerID}/authz/{authzID}")
 	assert.Equals(t, getPath(ChallengeLinkType, "{provisionerID}", "{authzID}", "{chID}"), "/{provisionerID}/challenge/{authzID}/{chID}")
 	assert.Equals(t, getPath(CertificateLinkType, "{provisionerID}", "{certID}"), "/{provisionerID}/certificate/{certID}")
+	assert.Equals(t, getPath(RenewalInfoLinkType, "{provisionerID}"), "/{provisionerID}/renewal-info")
+	assert.Equals(t, getPath(RenewalInfoLinkType, "{provisionerID}", "{certID}"), "/{provisionerID}/renewal-info/{certID}")
 }
 
 func TestLinker_DNS(t *testing.T) {
@@ -173,6 +175,10 @@ func TestLinker_GetLink(t *testing.T) {
 
 	assert.Equals(t, linker.GetLink(ctx, KeyChangeLinkType), fmt.Sprintf("%s/acme/%s/key-change", baseURL, escProvName))
 
+	assert.Equals(t, linker.GetLink(ctx, RenewalInfoLinkType), fmt.Sprintf("%s/acme/%s/renewal-info", baseURL, escProvName))
+
+	assert.Equals(t, linker.GetLink(ctx, RenewalInfoLinkType, id), fmt.Sprintf("%s/acme/%s/renewal-info/1234", baseURL, escProvName))
+
 	assert.Equals(t, linker.GetLink(ctx, ChallengeLinkType, id, id), fmt.Sprintf("%s/acme/%s/challenge/%s/%s", baseURL, escProvName, id, id))
 
 	assert.Equals(t, linker.GetLink(ctx, CertificateLinkType, id), fmt.Sprintf("%s/acme/%s/certificate/1234", baseURL, escProvName))
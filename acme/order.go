@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"net"
 	"sort"
 	"strings"
@@ -48,6 +49,7 @@ type Order struct {
 	FinalizeURL       string       `json:"finalize"`
 	CertificateID     string       `json:"-"`
 	CertificateURL    string       `json:"certificate,omitempty"`
+	Replaces          string       `json:"replaces,omitempty"`
 }
 
 // ToLog enables response logging.
@@ -69,15 +71,7 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 		return nil
 	case StatusValid:
 		return nil
-	case StatusReady:
-		// Check expiry
-		if now.After(o.ExpiresAt) {
-			o.Status = StatusInvalid
-			o.Error = NewError(ErrorMalformedType, "order has expired")
-			break
-		}
-		return nil
-	case StatusPending:
+	case StatusReady, StatusPending:
 		// Check expiry
 		if now.After(o.ExpiresAt) {
 			o.Status = StatusInvalid
@@ -86,9 +80,10 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 		}
 
 		var count = map[Status]int{
-			StatusValid:   0,
-			StatusInvalid: 0,
-			StatusPending: 0,
+			StatusValid:       0,
+			StatusInvalid:     0,
+			StatusPending:     0,
+			StatusDeactivated: 0,
 		}
 		for _, azID := range o.AuthorizationIDs {
 			az, err := db.GetAuthorization(ctx, azID)
@@ -102,12 +97,17 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 			count[st]++
 		}
 		switch {
-		case count[StatusInvalid] > 0:
+		// A ready order also becomes invalid if one of its authorizations is
+		// deactivated before it is finalized.
+		case count[StatusInvalid] > 0, count[StatusDeactivated] > 0:
 			o.Status = StatusInvalid
 
 		// No change in the order status, so just return the order as is -
 		// without writing any changes.
-		case count[StatusPending] > 0:
+		case o.Status == StatusReady && count[StatusValid] == len(o.AuthorizationIDs):
+			return nil
+
+		case o.Status == StatusPending && count[StatusPending] > 0:
 			return nil
 
 		case count[StatusValid] == len(o.AuthorizationIDs):
@@ -128,10 +128,9 @@ func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
 // Finalize signs a certificate if the necessary conditions for Order completion
 // have been met.
 //
-// TODO(mariano): Here or in the challenge validation we should perform some
-// external validation using the identifier value and the attestation data. From
-// a validation service we can get the list of SANs to set in the final
-// certificate.
+// For orders with a permanent identifier, the device inventory of the
+// provisioner is consulted again, and the data of the device is added to the
+// template data as .Device.
 func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateRequest, auth CertificateAuthority, p Provisioner) error {
 	if err := o.UpdateStatus(ctx, db); err != nil {
 		return err
@@ -179,6 +178,17 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		extraOptions = append(extraOptions, provisioner.AttestationData{
 			PermanentIdentifier: permanentIdentifier,
 		})
+
+		device, err := p.LookupDevice(ctx, permanentIdentifier)
+		if err != nil {
+			if errors.Is(err, provisioner.ErrDeviceNotEnrolled) || errors.Is(err, provisioner.ErrDeviceDecommissioned) {
+				return WrapError(ErrorRejectedIdentifierType, err, "device %s is not allowed", permanentIdentifier)
+			}
+			return WrapErrorISE(err, "error looking up device %s", permanentIdentifier)
+		}
+		if device != nil {
+			data.Set("Device", device)
+		}
 	} else {
 		defaultTemplate = x509util.DefaultLeafTemplate
 		sans, err := o.sans(csr)
@@ -188,6 +198,12 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		data.SetSubjectAlternativeNames(sans...)
 	}
 
+	// A certificate can only be replaced once, see ACME ARI.
+	replaced, err := o.replacedCertificate(ctx, db)
+	if err != nil {
+		return err
+	}
+
 	// Get authorizations from the ACME provisioner.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 	signOps, err := p.AuthorizeSign(ctx, "")
@@ -222,6 +238,11 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	if err := db.CreateCertificate(ctx, cert); err != nil {
 		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
 	}
+	if replaced != nil {
+		if err := db.UpdateCertificateReplacedBy(ctx, replaced.ID, o.ID); err != nil {
+			return WrapErrorISE(err, "error marking certificate %s as replaced", replaced.ID)
+		}
+	}
 
 	o.CertificateID = cert.ID
 	o.Status = StatusValid
@@ -231,6 +252,28 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 	return nil
 }
 
+// replacedCertificate returns the certificate replaced by the order, or nil if
+// the order does not replace a certificate. It fails if the certificate has
+// already been replaced by another order.
+func (o *Order) replacedCertificate(ctx context.Context, db DB) (*Certificate, error) {
+	if o.Replaces == "" {
+		return nil, nil
+	}
+	_, serial, err := ParseCertificateID(o.Replaces)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := db.GetCertificateBySerial(ctx, serial.String())
+	if err != nil {
+		return nil, WrapErrorISE(err, "error retrieving certificate by serial")
+	}
+	if cert.ReplacedBy != "" && cert.ReplacedBy != o.ID {
+		return nil, NewError(ErrorAlreadyReplacedType,
+			"certificate with serial %s has already been replaced", serial)
+	}
+	return cert, nil
+}
+
 func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativeName, error) {
 	var sans []x509util.SubjectAlternativeName
 	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
+	"math/big"
 	"net"
 	"net/url"
 	"reflect"
@@ -164,6 +165,107 @@ func TestOrder_UpdateStatus(t *testing.T) {
 				},
 			}
 		},
+		"ok/invalid-deactivated-authz": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusPending,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+			}
+			az1 := &Authorization{
+				ID:     "a",
+				Status: StatusValid,
+			}
+			az2 := &Authorization{
+				ID:     "b",
+				Status: StatusDeactivated,
+			}
+
+			return test{
+				o: o,
+				db: &MockDB{
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.ID, o.ID)
+						assert.Equals(t, updo.AccountID, o.AccountID)
+						assert.Equals(t, updo.Status, StatusInvalid)
+						assert.Equals(t, updo.ExpiresAt, o.ExpiresAt)
+						return nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						switch id {
+						case az1.ID:
+							return az1, nil
+						case az2.ID:
+							return az2, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected authz key %s", id))
+							return nil, errors.New("force")
+						}
+					},
+				},
+			}
+		},
+		"ok/ready-deactivated-authz": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+			}
+			az1 := &Authorization{
+				ID:     "a",
+				Status: StatusValid,
+			}
+			az2 := &Authorization{
+				ID:     "b",
+				Status: StatusDeactivated,
+			}
+
+			return test{
+				o: o,
+				db: &MockDB{
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.ID, o.ID)
+						assert.Equals(t, updo.Status, StatusInvalid)
+						return nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						switch id {
+						case az1.ID:
+							return az1, nil
+						case az2.ID:
+							return az2, nil
+						default:
+							assert.FatalError(t, errors.Errorf("unexpected authz key %s", id))
+							return nil, errors.New("force")
+						}
+					},
+				},
+			}
+		},
+		"ok/still-ready": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+			}
+
+			return test{
+				o: o,
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusValid}, nil
+					},
+				},
+			}
+		},
 		"ok/still-pending": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -314,6 +416,10 @@ func TestOrder_Finalize(t *testing.T) {
 		csr  *x509.CertificateRequest
 		prov Provisioner
 	}
+	validAuthorization := func(ctx context.Context, id string) (*Authorization, error) {
+		return &Authorization{ID: id, Status: StatusValid}, nil
+	}
+	replaces := CertificateID(&x509.Certificate{AuthorityKeyId: []byte{1, 2, 3, 4}, SerialNumber: big.NewInt(1234)})
 	tests := map[string]func(t *testing.T) test{
 		"fail/invalid": func(t *testing.T) test {
 			o := &Order{
@@ -362,6 +468,30 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewError(ErrorOrderNotReadyType, "order %s is not ready", o.ID),
 			}
 		},
+		"fail/ready-deactivated-authz": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+			}
+
+			return test{
+				o: o,
+				db: &MockDB{
+					MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+						return &Authorization{ID: id, Status: StatusDeactivated}, nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.Status, StatusInvalid)
+						return nil
+					},
+				},
+				err: NewError(ErrorOrderNotReadyType, "order %s has been abandoned", o.ID),
+			}
+		},
 		"ok/already-valid": func(t *testing.T) test {
 			o := &Order{
 				ID:     "oid",
@@ -407,6 +537,7 @@ func TestOrder_Finalize(t *testing.T) {
 			}
 
 			return test{
+				db:  &MockDB{MockGetAuthorization: validAuthorization},
 				o:   o,
 				csr: csr,
 				prov: &MockProvisioner{
@@ -439,6 +570,7 @@ func TestOrder_Finalize(t *testing.T) {
 			}
 
 			return test{
+				db:  &MockDB{MockGetAuthorization: validAuthorization},
 				o:   o,
 				csr: csr,
 				prov: &MockProvisioner{
@@ -478,6 +610,7 @@ func TestOrder_Finalize(t *testing.T) {
 			}
 
 			return test{
+				db:  &MockDB{MockGetAuthorization: validAuthorization},
 				o:   o,
 				csr: csr,
 				prov: &MockProvisioner{
@@ -541,6 +674,7 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
 					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
 						assert.Equals(t, cert.AccountID, o.AccountID)
 						assert.Equals(t, cert.OrderID, o.ID)
@@ -595,6 +729,7 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
 					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
 						cert.ID = "certID"
 						assert.Equals(t, cert.AccountID, o.AccountID)
@@ -617,6 +752,131 @@ func TestOrder_Finalize(t *testing.T) {
 				err: NewErrorISE("error updating order oID: force"),
 			}
 		},
+		"fail/error-device-not-enrolled": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "permanent-identifier", Value: "1234"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "1234",
+				},
+			}
+
+			return test{
+				db:  &MockDB{MockGetAuthorization: validAuthorization},
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MlookupDevice: func(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error) {
+						assert.Equals(t, permanentIdentifier, "1234")
+						return nil, provisioner.ErrDeviceNotEnrolled
+					},
+				},
+				err: NewError(ErrorRejectedIdentifierType, "device 1234 is not allowed: device is not enrolled"),
+			}
+		},
+		"fail/error-device-lookup": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "permanent-identifier", Value: "1234"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "1234",
+				},
+			}
+
+			return test{
+				db:  &MockDB{MockGetAuthorization: validAuthorization},
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MlookupDevice: func(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: NewErrorISE("error looking up device 1234: force"),
+			}
+		},
+		"ok/new-cert-permanent-identifier": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Identifiers: []Identifier{
+					{Type: "permanent-identifier", Value: "1234"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "1234",
+				},
+			}
+
+			foo := &x509.Certificate{Subject: pkix.Name{CommonName: "foo"}}
+			bar := &x509.Certificate{Subject: pkix.Name{CommonName: "bar"}}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MlookupDevice: func(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error) {
+						assert.Equals(t, permanentIdentifier, "1234")
+						return map[string]interface{}{"owner": "jane"}, nil
+					},
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					sign: func(_csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						assert.Equals(t, _csr, csr)
+						var found bool
+						for _, opt := range extraOpts {
+							if ad, ok := opt.(provisioner.AttestationData); ok {
+								assert.Equals(t, ad.PermanentIdentifier, "1234")
+								found = true
+							}
+						}
+						assert.True(t, found)
+						return []*x509.Certificate{foo, bar}, nil
+					},
+				},
+				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
+					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+						cert.ID = "certID"
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.CertificateID, "certID")
+						assert.Equals(t, updo.Status, StatusValid)
+						return nil
+					},
+				},
+			}
+		},
 		"ok/new-cert-dns": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -660,6 +920,82 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
+					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
+						cert.ID = "certID"
+						assert.Equals(t, cert.AccountID, o.AccountID)
+						assert.Equals(t, cert.OrderID, o.ID)
+						assert.Equals(t, cert.Leaf, foo)
+						assert.Equals(t, cert.Intermediates, []*x509.Certificate{bar, baz})
+						return nil
+					},
+					MockUpdateOrder: func(ctx context.Context, updo *Order) error {
+						assert.Equals(t, updo.CertificateID, "certID")
+						assert.Equals(t, updo.Status, StatusValid)
+						assert.Equals(t, updo.ID, o.ID)
+						assert.Equals(t, updo.AccountID, o.AccountID)
+						assert.Equals(t, updo.ExpiresAt, o.ExpiresAt)
+						assert.Equals(t, updo.AuthorizationIDs, o.AuthorizationIDs)
+						assert.Equals(t, updo.Identifiers, o.Identifiers)
+						return nil
+					},
+				},
+			}
+		},
+		"ok/new-cert-replaces": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a", "b"},
+				Replaces:         replaces,
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+					{Type: "dns", Value: "bar.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+				DNSNames: []string{"bar.internal"},
+			}
+
+			foo := &x509.Certificate{Subject: pkix.Name{CommonName: "foo"}}
+			bar := &x509.Certificate{Subject: pkix.Name{CommonName: "bar"}}
+			baz := &x509.Certificate{Subject: pkix.Name{CommonName: "baz"}}
+
+			return test{
+				o:   o,
+				csr: csr,
+				prov: &MockProvisioner{
+					MauthorizeSign: func(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+						assert.Equals(t, token, "")
+						return nil, nil
+					},
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				ca: &mockSignAuth{
+					sign: func(_csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+						assert.Equals(t, _csr, csr)
+						return []*x509.Certificate{foo, bar, baz}, nil
+					},
+				},
+				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*Certificate, error) {
+						assert.Equals(t, serial, "1234")
+						return &Certificate{ID: "replacedID"}, nil
+					},
+					MockUpdateCertificateReplacedBy: func(ctx context.Context, id, orderID string) error {
+						assert.Equals(t, id, "replacedID")
+						assert.Equals(t, orderID, o.ID)
+						return nil
+					},
 					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
 						cert.ID = "certID"
 						assert.Equals(t, cert.AccountID, o.AccountID)
@@ -681,6 +1017,42 @@ func TestOrder_Finalize(t *testing.T) {
 				},
 			}
 		},
+		"fail/already-replaced": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				AccountID:        "accID",
+				Status:           StatusReady,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+				Replaces:         replaces,
+				Identifiers: []Identifier{
+					{Type: "dns", Value: "foo.internal"},
+				},
+			}
+			csr := &x509.CertificateRequest{
+				Subject: pkix.Name{
+					CommonName: "foo.internal",
+				},
+			}
+
+			return test{
+				o:   o,
+				csr: csr,
+				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*Certificate, error) {
+						return &Certificate{ID: "replacedID", ReplacedBy: "otherOrderID"}, nil
+					},
+				},
+				prov: &MockProvisioner{
+					MgetOptions: func() *provisioner.Options {
+						return nil
+					},
+				},
+				err: NewError(ErrorAlreadyReplacedType, "certificate with serial 1234 has already been replaced"),
+			}
+		},
 		"ok/new-cert-ip": func(t *testing.T) test {
 			now := clock.Now()
 			o := &Order{
@@ -721,6 +1093,7 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
 					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
 						cert.ID = "certID"
 						assert.Equals(t, cert.AccountID, o.AccountID)
@@ -785,6 +1158,7 @@ func TestOrder_Finalize(t *testing.T) {
 					},
 				},
 				db: &MockDB{
+					MockGetAuthorization: validAuthorization,
 					MockCreateCertificate: func(ctx context.Context, cert *Certificate) error {
 						cert.ID = "certID"
 						assert.Equals(t, cert.AccountID, o.AccountID)
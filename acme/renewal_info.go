@@ -0,0 +1,109 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// RenewalInfo represents the renewal information of a certificate as defined
+// in the ACME Renewal Information (ARI) extension (draft-ietf-acme-ari).
+type RenewalInfo struct {
+	SuggestedWindow RenewalWindow `json:"suggestedWindow"`
+	ExplanationURL  string        `json:"explanationURL,omitempty"`
+}
+
+// RenewalWindow is the window in which a client should renew a certificate.
+type RenewalWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ToLog enables response logging.
+func (ri *RenewalInfo) ToLog() (interface{}, error) {
+	b, err := json.Marshal(ri)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error marshaling renewal info for logging")
+	}
+	return string(b), nil
+}
+
+// RotationChecker is an optional interface that can be implemented by a
+// CertificateAuthority to signal that a certificate must be renewed as soon as
+// possible, for example, if the intermediate that issued it is being rotated.
+type RotationChecker interface {
+	ShouldRotate(crt *x509.Certificate) bool
+}
+
+// NewRenewalInfo returns the default renewal information for a certificate.
+// The suggested window starts after two thirds of the validity of the
+// certificate and ends after five sixths of it.
+func NewRenewalInfo(crt *x509.Certificate) *RenewalInfo {
+	lifetime := crt.NotAfter.Sub(crt.NotBefore)
+	return &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: crt.NotBefore.Add(lifetime * 2 / 3).UTC(),
+			End:   crt.NotBefore.Add(lifetime * 5 / 6).UTC(),
+		},
+	}
+}
+
+// RenewNow shortens the suggested window so it lies in the past, as it is
+// recommended for revoked certificates or those that must be rotated. Clients
+// seeing a window in the past will attempt to renew immediately.
+func (ri *RenewalInfo) RenewNow(crt *x509.Certificate, now time.Time) {
+	ri.SuggestedWindow = RenewalWindow{
+		Start: crt.NotBefore.UTC(),
+		End:   now.UTC(),
+	}
+}
+
+// CertificateID returns the ARI unique identifier of the certificate. It is
+// made of the base64url encoded key identifier of the authority key identifier
+// extension and the base64url encoded DER serial number, separated by a dot.
+func CertificateID(crt *x509.Certificate) string {
+	return base64.RawURLEncoding.EncodeToString(crt.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serialBytes(crt.SerialNumber))
+}
+
+// ParseCertificateID parses an ARI unique identifier and returns the authority
+// key identifier and the serial number of the certificate.
+func ParseCertificateID(id string) ([]byte, *big.Int, error) {
+	parts := strings.Split(id, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, nil, NewError(ErrorMalformedType, "certificate identifier %s is not valid", id)
+	}
+	aki, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		return nil, nil, WrapError(ErrorMalformedType, err, "error decoding authority key identifier of %s", id)
+	}
+	sn, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, nil, WrapError(ErrorMalformedType, err, "error decoding serial number of %s", id)
+	}
+	// DER encoded serial numbers are positive, the first bit cannot be set.
+	if len(sn) == 0 || sn[0]&0x80 != 0 {
+		return nil, nil, NewError(ErrorMalformedType, "serial number of %s is not valid", id)
+	}
+	return aki, new(big.Int).SetBytes(sn), nil
+}
+
+// MatchesCertificateID returns true if the certificate has the authority key
+// identifier and serial number encoded in the given ARI unique identifier.
+func MatchesCertificateID(crt *x509.Certificate, aki []byte, serial *big.Int) bool {
+	return bytes.Equal(crt.AuthorityKeyId, aki) && crt.SerialNumber.Cmp(serial) == 0
+}
+
+// serialBytes returns the bytes of the DER encoding of a serial number, without
+// the tag and length.
+func serialBytes(sn *big.Int) []byte {
+	b := sn.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestCertificateID(t *testing.T) {
+	tests := []struct {
+		name string
+		crt  *x509.Certificate
+		want string
+	}{
+		{"ok", &x509.Certificate{AuthorityKeyId: []byte{0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3, 0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4}, SerialNumber: big.NewInt(0x87654321)}, "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"},
+		{"ok no padding", &x509.Certificate{AuthorityKeyId: []byte{1, 2, 3}, SerialNumber: big.NewInt(0x7f)}, "AQID.fw"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CertificateID(tt.crt)
+			assert.Equals(t, tt.want, got)
+
+			aki, serial, err := ParseCertificateID(got)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.crt.AuthorityKeyId, aki)
+			assert.Equals(t, 0, tt.crt.SerialNumber.Cmp(serial))
+			assert.True(t, MatchesCertificateID(tt.crt, aki, serial))
+		})
+	}
+}
+
+func TestParseCertificateID(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		wantAKI []byte
+		wantSN  *big.Int
+		wantErr bool
+	}{
+		{"ok", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", []byte{0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3, 0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4}, big.NewInt(0x87654321), false},
+		{"ok padding", "AQID.fw==", []byte{1, 2, 3}, big.NewInt(0x7f), false},
+		{"fail empty", "", nil, nil, true},
+		{"fail no dot", "AQID", nil, nil, true},
+		{"fail too many dots", "AQID.fw.fw", nil, nil, true},
+		{"fail aki", "!!!.fw", nil, nil, true},
+		{"fail serial", "AQID.!!!", nil, nil, true},
+		{"fail negative serial", "AQID.gA", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aki, serial, err := ParseCertificateID(tt.id)
+			if tt.wantErr {
+				if assert.Error(t, err) {
+					var k *Error
+					assert.True(t, errors.As(err, &k))
+					assert.Equals(t, "urn:ietf:params:acme:error:malformed", k.Type)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantAKI, aki)
+			assert.Equals(t, 0, tt.wantSN.Cmp(serial))
+		})
+	}
+}
+
+func TestNewRenewalInfo(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	crt := &x509.Certificate{
+		NotBefore: now,
+		NotAfter:  now.Add(24 * time.Hour),
+	}
+
+	ri := NewRenewalInfo(crt)
+	assert.True(t, now.Add(16*time.Hour).Equal(ri.SuggestedWindow.Start))
+	assert.True(t, now.Add(20*time.Hour).Equal(ri.SuggestedWindow.End))
+
+	ri.RenewNow(crt, now.Add(time.Hour))
+	assert.True(t, now.Equal(ri.SuggestedWindow.Start))
+	assert.True(t, now.Add(time.Hour).Equal(ri.SuggestedWindow.End))
+}
@@ -20,6 +20,8 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
+	nebula "github.com/slackhq/nebula/cert"
+	"golang.org/x/crypto/ocsp"
 
 	"github.com/smallstep/certificates/api/log"
 	"github.com/smallstep/certificates/api/render"
@@ -48,6 +50,9 @@ type Authority interface {
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() ([]*x509.Certificate, error)
 	GetFederation() ([]*x509.Certificate, error)
+	GetCertificateRevocationList() ([]byte, error)
+	GetOCSPResponse(req *ocsp.Request) (*authority.OCSPResponse, error)
+	SignNebula(ctx context.Context, key []byte, opts provisioner.SignNebulaOptions, signOpts ...provisioner.SignOption) (*nebula.NebulaCertificate, error)
 	Version() authority.Version
 }
 
@@ -272,6 +277,9 @@ func Route(r Router) {
 	r.MethodFunc("GET", "/roots", Roots)
 	r.MethodFunc("GET", "/roots.pem", RootsPEM)
 	r.MethodFunc("GET", "/federation", Federation)
+	r.MethodFunc("GET", "/crl", CRL)
+	r.MethodFunc("GET", "/ocsp/*", OCSP)
+	r.MethodFunc("POST", "/ocsp", OCSP)
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", SSHSign)
 	r.MethodFunc("POST", "/ssh/renew", SSHRenew)
@@ -284,6 +292,10 @@ func Route(r Router) {
 	r.MethodFunc("POST", "/ssh/check-host", SSHCheckHost)
 	r.MethodFunc("GET", "/ssh/hosts", SSHGetHosts)
 	r.MethodFunc("POST", "/ssh/bastion", SSHBastion)
+	r.MethodFunc("GET", "/ssh/krl", SSHKRL)
+	r.MethodFunc("GET", "/ssh/step-up/{id}", SSHStepUp)
+	// Nebula CA
+	r.MethodFunc("POST", "/nebula/sign", NebulaSign)
 
 	// For compatibility with old code:
 	r.MethodFunc("POST", "/re-sign", Renew)
@@ -28,6 +28,8 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
+	nebula "github.com/slackhq/nebula/cert"
+	"golang.org/x/crypto/ocsp"
 	"golang.org/x/crypto/ssh"
 
 	"go.step.sm/crypto/jose"
@@ -36,6 +38,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
@@ -199,6 +202,9 @@ type mockAuthority struct {
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
 	getFederation                func() ([]*x509.Certificate, error)
+	getCertificateRevocationList func() ([]byte, error)
+	getOCSPResponse              func(req *ocsp.Request) (*authority.OCSPResponse, error)
+	signNebula                   func(ctx context.Context, key []byte, opts provisioner.SignNebulaOptions, signOpts ...provisioner.SignOption) (*nebula.NebulaCertificate, error)
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renewSSH                     func(ctx context.Context, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -209,6 +215,9 @@ type mockAuthority struct {
 	getSSHConfig                 func(ctx context.Context, typ string, data map[string]string) ([]templates.Output, error)
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
+	getSSHKeyRevocationList      func(ctx context.Context) (*db.SSHKeyRevocationListInfo, error)
+	createSSHStepUpRequest       func(ctx context.Context, cert *ssh.Certificate, principals []string, justification string, signOpts ...provisioner.SignOption) (*db.SSHStepUpRequest, error)
+	pollSSHStepUpRequest         func(ctx context.Context, id string) (*db.SSHStepUpRequest, *ssh.Certificate, error)
 	version                      func() authority.Version
 }
 
@@ -311,6 +320,27 @@ func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetCertificateRevocationList() ([]byte, error) {
+	if m.getCertificateRevocationList != nil {
+		return m.getCertificateRevocationList()
+	}
+	return m.ret1.([]byte), m.err
+}
+
+func (m *mockAuthority) GetOCSPResponse(req *ocsp.Request) (*authority.OCSPResponse, error) {
+	if m.getOCSPResponse != nil {
+		return m.getOCSPResponse(req)
+	}
+	return m.ret1.(*authority.OCSPResponse), m.err
+}
+
+func (m *mockAuthority) SignNebula(ctx context.Context, key []byte, opts provisioner.SignNebulaOptions, signOpts ...provisioner.SignOption) (*nebula.NebulaCertificate, error) {
+	if m.signNebula != nil {
+		return m.signNebula(ctx, key, opts, signOpts...)
+	}
+	return m.ret1.(*nebula.NebulaCertificate), m.err
+}
+
 func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSH != nil {
 		return m.signSSH(ctx, key, opts, signOpts...)
@@ -381,6 +411,27 @@ func (m *mockAuthority) GetSSHBastion(ctx context.Context, user, hostname string
 	return m.ret1.(*authority.Bastion), m.err
 }
 
+func (m *mockAuthority) GetSSHKeyRevocationList(ctx context.Context) (*db.SSHKeyRevocationListInfo, error) {
+	if m.getSSHKeyRevocationList != nil {
+		return m.getSSHKeyRevocationList(ctx)
+	}
+	return m.ret1.(*db.SSHKeyRevocationListInfo), m.err
+}
+
+func (m *mockAuthority) CreateSSHStepUpRequest(ctx context.Context, cert *ssh.Certificate, principals []string, justification string, signOpts ...provisioner.SignOption) (*db.SSHStepUpRequest, error) {
+	if m.createSSHStepUpRequest != nil {
+		return m.createSSHStepUpRequest(ctx, cert, principals, justification, signOpts...)
+	}
+	return m.ret1.(*db.SSHStepUpRequest), m.err
+}
+
+func (m *mockAuthority) PollSSHStepUpRequest(ctx context.Context, id string) (*db.SSHStepUpRequest, *ssh.Certificate, error) {
+	if m.pollSSHStepUpRequest != nil {
+		return m.pollSSHStepUpRequest(ctx, id)
+	}
+	return m.ret1.(*db.SSHStepUpRequest), m.ret2.(*ssh.Certificate), m.err
+}
+
 func (m *mockAuthority) Version() authority.Version {
 	if m.version != nil {
 		return m.version()
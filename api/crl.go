@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// CRL is an HTTP handler that returns the current certificate revocation list
+// in DER format, or in PEM format if the pem query parameter is present.
+func CRL(w http.ResponseWriter, r *http.Request) {
+	crlBytes, err := mustAuthority(r.Context()).GetCertificateRevocationList()
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if _, ok := r.URL.Query()["pem"]; ok {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"crl.pem\"")
+		if err := pem.Encode(w, &pem.Block{Type: "X509 CRL", Bytes: crlBytes}); err != nil {
+			log.Error(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"crl.der\"")
+	if _, err := w.Write(crlBytes); err != nil {
+		log.Error(w, err)
+	}
+}
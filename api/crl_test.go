@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_CRL(t *testing.T) {
+	crlBytes := []byte("the crl")
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlBytes})
+
+	tests := []struct {
+		name        string
+		url         string
+		crl         []byte
+		err         error
+		statusCode  int
+		contentType string
+		expected    []byte
+	}{
+		{"ok", "https://example.com/crl", crlBytes, nil, http.StatusOK, "application/pkix-crl", crlBytes},
+		{"ok pem", "https://example.com/crl?pem", crlBytes, nil, http.StatusOK, "application/x-pem-file", crlPEM},
+		{"fail not enabled", "https://example.com/crl", nil, errs.NotFound("crl is not enabled"), http.StatusNotFound, "", nil},
+		{"fail not implemented", "https://example.com/crl", nil, errs.NotImplemented("crl is not implemented"), http.StatusNotImplemented, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.crl, err: tt.err})
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			CRL(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("CRL StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("CRL unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if ct := res.Header.Get("Content-Type"); ct != tt.contentType {
+					t.Errorf("CRL Content-Type = %s, wants %s", ct, tt.contentType)
+				}
+				if !bytes.Equal(body, tt.expected) {
+					t.Errorf("CRL Body = %s, wants %s", body, tt.expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	nebula "github.com/slackhq/nebula/cert"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/logging"
+)
+
+// NebulaSignRequest is the request body of a Nebula certificate request. The
+// public key is a raw X25519 key, base64 encoded in JSON, and the IPs are the
+// addresses of the host in CIDR notation.
+type NebulaSignRequest struct {
+	PublicKey []byte       `json:"publicKey"`
+	OTT       string       `json:"ott"`
+	Name      string       `json:"name"`
+	IPs       []string     `json:"ips"`
+	Groups    []string     `json:"groups,omitempty"`
+	NotBefore TimeDuration `json:"notBefore,omitempty"`
+	NotAfter  TimeDuration `json:"notAfter,omitempty"`
+}
+
+// Validate validates the NebulaSignRequest.
+func (s *NebulaSignRequest) Validate() error {
+	switch {
+	case len(s.PublicKey) == 0:
+		return errs.BadRequest("missing or empty publicKey")
+	case s.OTT == "":
+		return errs.BadRequest("missing or empty ott")
+	case s.Name == "":
+		return errs.BadRequest("missing or empty name")
+	case len(s.IPs) == 0:
+		return errs.BadRequest("missing or empty ips")
+	default:
+		return nil
+	}
+}
+
+// NebulaSignResponse is the response object of a Nebula certificate request.
+type NebulaSignResponse struct {
+	Certificate NebulaCertificate `json:"crt"`
+}
+
+// NebulaCertificate represents a Nebula certificate, it's encoded as a PEM
+// string in JSON.
+type NebulaCertificate struct {
+	*nebula.NebulaCertificate
+}
+
+// MarshalJSON implements the json.Marshaler interface. Returns a quoted, PEM
+// encoded version of the certificate.
+func (c NebulaCertificate) MarshalJSON() ([]byte, error) {
+	if c.NebulaCertificate == nil {
+		return []byte("null"), nil
+	}
+	b, err := c.NebulaCertificate.MarshalToPEM()
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding nebula certificate")
+	}
+	return json.Marshal(string(b))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The certificate is
+// expected to be a quoted, PEM encoded Nebula certificate.
+func (c *NebulaCertificate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "error decoding nebula certificate")
+	}
+	if s == "" {
+		c.NebulaCertificate = nil
+		return nil
+	}
+	crt, _, err := nebula.UnmarshalNebulaCertificateFromPEM([]byte(s))
+	if err != nil {
+		return errors.Wrap(err, "error parsing nebula certificate")
+	}
+	c.NebulaCertificate = crt
+	return nil
+}
+
+// NebulaSign is an HTTP handler that reads a NebulaSignRequest with a one-time
+// token and returns a Nebula certificate signed by the Nebula CA.
+func NebulaSign(w http.ResponseWriter, r *http.Request) {
+	var body NebulaSignRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	opts := provisioner.SignNebulaOptions{
+		Name:      body.Name,
+		IPs:       body.IPs,
+		Groups:    body.Groups,
+		NotBefore: body.NotBefore,
+		NotAfter:  body.NotAfter,
+	}
+
+	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.NebulaSignMethod)
+	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
+
+	a := mustAuthority(ctx)
+	signOpts, err := a.Authorize(ctx, body.OTT)
+	if err != nil {
+		render.Error(w, errs.UnauthorizedErr(err))
+		return
+	}
+
+	crt, err := a.SignNebula(ctx, body.PublicKey, opts, signOpts...)
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error signing nebula certificate"))
+		return
+	}
+
+	logNebulaCertificate(w, crt)
+	render.JSONStatus(w, &NebulaSignResponse{
+		Certificate: NebulaCertificate{crt},
+	}, http.StatusCreated)
+}
+
+// logNebulaCertificate adds the Nebula certificate fields to the log message.
+func logNebulaCertificate(w http.ResponseWriter, crt *nebula.NebulaCertificate) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		m := map[string]interface{}{
+			"name":       crt.Details.Name,
+			"groups":     crt.Details.Groups,
+			"issuer":     crt.Details.Issuer,
+			"valid-from": crt.Details.NotBefore.Format(time.RFC3339),
+			"valid-to":   crt.Details.NotAfter.Format(time.RFC3339),
+		}
+		ips := make([]string, len(crt.Details.Ips))
+		for i, ip := range crt.Details.Ips {
+			ips[i] = ip.String()
+		}
+		m["ips"] = ips
+		if fp, err := crt.Sha256Sum(); err == nil {
+			m["fingerprint"] = fp
+		}
+		if b, err := crt.Marshal(); err == nil {
+			m["certificate"] = base64.StdEncoding.EncodeToString(b)
+		}
+		rl.WithFields(m)
+	}
+}
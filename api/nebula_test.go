@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nebula "github.com/slackhq/nebula/cert"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/logging"
+)
+
+func mustNebulaCertificate(t *testing.T) *nebula.NebulaCertificate {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ipNet, err := net.ParseCIDR("10.1.0.10/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipNet.IP = net.ParseIP("10.1.0.10").To4()
+	now := time.Now().Truncate(time.Second)
+	crt := &nebula.NebulaCertificate{
+		Details: nebula.NebulaCertificateDetails{
+			Name:      "host.example.com",
+			Ips:       []*net.IPNet{ipNet},
+			Subnets:   []*net.IPNet{},
+			Groups:    []string{"servers"},
+			NotBefore: now,
+			NotAfter:  now.Add(time.Hour),
+			PublicKey: pub,
+		},
+	}
+	if err := crt.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+func Test_NebulaSign(t *testing.T) {
+	crt := mustNebulaCertificate(t)
+	crtPEM, err := crt.MarshalToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := crt.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := json.Marshal(NebulaSignRequest{
+		PublicKey: crt.Details.PublicKey,
+		OTT:       "ott",
+		Name:      "host.example.com",
+		IPs:       []string{"10.1.0.10/16"},
+		Groups:    []string{"servers"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		req        []byte
+		authErr    error
+		signCert   *nebula.NebulaCertificate
+		signErr    error
+		body       []byte
+		statusCode int
+	}{
+		{"ok", req, nil, crt, nil, []byte(fmt.Sprintf(`{"crt":%q}`, crtPEM)), http.StatusCreated},
+		{"fail-body", []byte("bad-json"), nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail-validate", []byte("{}"), nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail-name", []byte(`{"publicKey":"Zm9v","ott":"ott","ips":["10.1.0.10/16"]}`), nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail-ips", []byte(`{"publicKey":"Zm9v","ott":"ott","name":"host.example.com"}`), nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail-authorize", req, fmt.Errorf("an-error"), nil, nil, nil, http.StatusUnauthorized},
+		{"fail-signNebula", req, nil, nil, fmt.Errorf("an-error"), nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					if m := provisioner.MethodFromContext(ctx); m != provisioner.NebulaSignMethod {
+						t.Errorf("method = %v, want %v", m, provisioner.NebulaSignMethod)
+					}
+					return []provisioner.SignOption{}, tt.authErr
+				},
+				signNebula: func(ctx context.Context, key []byte, opts provisioner.SignNebulaOptions, signOpts ...provisioner.SignOption) (*nebula.NebulaCertificate, error) {
+					return tt.signCert, tt.signErr
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/nebula/sign", bytes.NewReader(tt.req))
+			w := httptest.NewRecorder()
+			rl := logging.NewResponseLogger(w)
+			NebulaSign(rl, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("NebulaSign StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("NebulaSign unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+					t.Errorf("NebulaSign Body = %s, wants %s", body, tt.body)
+				}
+				if got := rl.Fields()["fingerprint"]; got != fp {
+					t.Errorf("NebulaSign log fingerprint = %v, wants %v", got, fp)
+				}
+			}
+		})
+	}
+}
+
+func TestNebulaCertificate_JSON(t *testing.T) {
+	crt := mustNebulaCertificate(t)
+	b, err := json.Marshal(NebulaCertificate{crt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got NebulaCertificate
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want, err := crt.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp, err := got.Sha256Sum(); err != nil || fp != want {
+		t.Errorf("NebulaCertificate.UnmarshalJSON() fingerprint = %s, want %s", fp, want)
+	}
+
+	b, err = json.Marshal(NebulaCertificate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "null" {
+		t.Errorf("NebulaCertificate.MarshalJSON() = %s, want null", b)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// maxOCSPRequestSize is the maximum size of an OCSP request sent using POST.
+const maxOCSPRequestSize = 10 * 1024
+
+// OCSP is an HTTP handler that implements an OCSP responder as defined in RFC
+// 6960. Requests can be sent using GET, with the base64 encoded request in the
+// path, or using POST, with the DER encoded request in the body.
+//
+// Following the RFC, errors processing the request are reported as OCSP error
+// responses with a 200 status code. If the responder is not enabled, a
+// regular HTTP error is returned.
+func OCSP(w http.ResponseWriter, r *http.Request) {
+	var (
+		body []byte
+		err  error
+	)
+	if r.Method == http.MethodGet {
+		body, err = decodeOCSPRequest(chi.URLParam(r, "*"))
+	} else {
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxOCSPRequestSize))
+	}
+	if err != nil {
+		log.Error(w, errors.Wrap(err, "error reading ocsp request"))
+		writeOCSPResponse(w, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		log.Error(w, errors.Wrap(err, "error parsing ocsp request"))
+		writeOCSPResponse(w, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+
+	resp, err := mustAuthority(r.Context()).GetOCSPResponse(req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var sc render.StatusCodedError
+		if errors.As(err, &sc) {
+			status = sc.StatusCode()
+		}
+		switch status {
+		case http.StatusNotFound, http.StatusNotImplemented:
+			render.Error(w, err)
+		case http.StatusBadRequest:
+			log.Error(w, err)
+			writeOCSPResponse(w, ocsp.MalformedRequestErrorResponse)
+		case http.StatusUnauthorized:
+			log.Error(w, err)
+			writeOCSPResponse(w, ocsp.UnauthorizedErrorResponse)
+		default:
+			log.Error(w, err)
+			writeOCSPResponse(w, ocsp.InternalErrorErrorResponse)
+		}
+		return
+	}
+
+	// Responses to GET requests can be cached by HTTP proxies as described in
+	// RFC 5019.
+	if r.Method == http.MethodGet {
+		maxAge := int64(time.Until(resp.NextUpdate).Seconds())
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(maxAge, 10)+", public, no-transform, must-revalidate")
+		w.Header().Set("Last-Modified", resp.ThisUpdate.Format(http.TimeFormat))
+		w.Header().Set("Expires", resp.NextUpdate.Format(http.TimeFormat))
+	}
+
+	writeOCSPResponse(w, resp.Raw)
+}
+
+// decodeOCSPRequest decodes the url and base64 encoded OCSP request sent using
+// GET.
+func decodeOCSPRequest(s string) ([]byte, error) {
+	s, err := url.PathUnescape(s)
+	if err != nil {
+		return nil, err
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// writeOCSPResponse writes the given DER encoded OCSP response.
+func writeOCSPResponse(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		log.Error(w, err)
+	}
+}
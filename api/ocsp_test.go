@@ -0,0 +1,124 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/ocsp"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_OCSP(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:  []string{"leaf.example.com"},
+		PublicKey: signer.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ocspReq, err := ocsp.CreateRequest(leaf, ca.Intermediate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	ocspResp := &authority.OCSPResponse{
+		Raw:        []byte("the response"),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+	}
+
+	getRequest := func(s string) *http.Request {
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("*", s)
+		req := httptest.NewRequest("GET", "http://example.com/ocsp/"+s, nil)
+		return req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+	}
+	postRequest := func(b []byte) *http.Request {
+		req := httptest.NewRequest("POST", "http://example.com/ocsp", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/ocsp-request")
+		return req
+	}
+
+	tests := []struct {
+		name         string
+		req          *http.Request
+		resp         *authority.OCSPResponse
+		err          error
+		statusCode   int
+		cacheControl bool
+		expected     []byte
+	}{
+		{"ok get", getRequest(base64.StdEncoding.EncodeToString(ocspReq)), ocspResp, nil, http.StatusOK, true, ocspResp.Raw},
+		{"ok get escaped", getRequest(url.PathEscape(base64.StdEncoding.EncodeToString(ocspReq))), ocspResp, nil, http.StatusOK, true, ocspResp.Raw},
+		{"ok get no padding", getRequest(base64.RawStdEncoding.EncodeToString(ocspReq)), ocspResp, nil, http.StatusOK, true, ocspResp.Raw},
+		{"ok post", postRequest(ocspReq), ocspResp, nil, http.StatusOK, false, ocspResp.Raw},
+		{"fail get base64", getRequest("!!!"), nil, nil, http.StatusOK, false, ocsp.MalformedRequestErrorResponse},
+		{"fail post malformed", postRequest([]byte("foo")), nil, nil, http.StatusOK, false, ocsp.MalformedRequestErrorResponse},
+		{"fail bad request", postRequest(ocspReq), nil, errs.BadRequest("bad request"), http.StatusOK, false, ocsp.MalformedRequestErrorResponse},
+		{"fail unauthorized", postRequest(ocspReq), nil, errs.Unauthorized("unauthorized"), http.StatusOK, false, ocsp.UnauthorizedErrorResponse},
+		{"fail internal", postRequest(ocspReq), nil, errs.InternalServer("internal error"), http.StatusOK, false, ocsp.InternalErrorErrorResponse},
+		{"fail not enabled", postRequest(ocspReq), nil, errs.NotFound("ocsp is not enabled"), http.StatusNotFound, false, nil},
+		{"fail not implemented", postRequest(ocspReq), nil, errs.NotImplemented("ocsp is not implemented"), http.StatusNotImplemented, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				getOCSPResponse: func(req *ocsp.Request) (*authority.OCSPResponse, error) {
+					if req.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+						t.Errorf("OCSP SerialNumber = %s, wants %s", req.SerialNumber, leaf.SerialNumber)
+					}
+					return tt.resp, tt.err
+				},
+			})
+			w := httptest.NewRecorder()
+			OCSP(w, tt.req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("OCSP StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("OCSP unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if ct := res.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+					t.Errorf("OCSP Content-Type = %s, wants application/ocsp-response", ct)
+				}
+				if cc := res.Header.Get("Cache-Control"); (cc != "") != tt.cacheControl {
+					t.Errorf("OCSP Cache-Control = %s, wants %v", cc, tt.cacheControl)
+				}
+				if !bytes.Equal(body, tt.expected) {
+					t.Errorf("OCSP Body = %x, wants %x", body, tt.expected)
+				}
+			}
+		})
+	}
+}
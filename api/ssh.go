@@ -5,9 +5,11 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 
@@ -16,6 +18,7 @@ import (
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/templates"
 )
@@ -32,20 +35,32 @@ type SSHAuthority interface {
 	CheckSSHHost(ctx context.Context, principal string, token string) (bool, error)
 	GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]config.Host, error)
 	GetSSHBastion(ctx context.Context, user string, hostname string) (*config.Bastion, error)
+	GetSSHKeyRevocationList(ctx context.Context) (*db.SSHKeyRevocationListInfo, error)
+	CreateSSHStepUpRequest(ctx context.Context, cert *ssh.Certificate, principals []string, justification string, signOpts ...provisioner.SignOption) (*db.SSHStepUpRequest, error)
+	PollSSHStepUpRequest(ctx context.Context, id string) (*db.SSHStepUpRequest, *ssh.Certificate, error)
 }
 
 // SSHSignRequest is the request body of an SSH certificate request.
 type SSHSignRequest struct {
-	PublicKey        []byte             `json:"publicKey"` // base64 encoded
-	OTT              string             `json:"ott"`
-	CertType         string             `json:"certType,omitempty"`
-	KeyID            string             `json:"keyID,omitempty"`
-	Principals       []string           `json:"principals,omitempty"`
-	ValidAfter       TimeDuration       `json:"validAfter,omitempty"`
-	ValidBefore      TimeDuration       `json:"validBefore,omitempty"`
-	AddUserPublicKey []byte             `json:"addUserPublicKey,omitempty"`
-	IdentityCSR      CertificateRequest `json:"identityCSR,omitempty"`
-	TemplateData     json.RawMessage    `json:"templateData,omitempty"`
+	PublicKey        []byte                       `json:"publicKey"` // base64 encoded
+	OTT              string                       `json:"ott"`
+	CertType         string                       `json:"certType,omitempty"`
+	KeyID            string                       `json:"keyID,omitempty"`
+	Principals       []string                     `json:"principals,omitempty"`
+	ValidAfter       TimeDuration                 `json:"validAfter,omitempty"`
+	ValidBefore      TimeDuration                 `json:"validBefore,omitempty"`
+	AddUserPublicKey []byte                       `json:"addUserPublicKey,omitempty"`
+	IdentityCSR      CertificateRequest           `json:"identityCSR,omitempty"`
+	TemplateData     json.RawMessage              `json:"templateData,omitempty"`
+	HostKeyProof     *provisioner.SSHHostKeyProof `json:"hostKeyProof,omitempty"`
+	StepUp           *SSHStepUpRequest            `json:"stepUp,omitempty"`
+}
+
+// SSHStepUpRequest is the part of an SSH certificate request used to request
+// additional principals that require the approval of an administrator.
+type SSHStepUpRequest struct {
+	Principals    []string `json:"principals"`
+	Justification string   `json:"justification"`
 }
 
 // Validate validates the SSHSignRequest.
@@ -57,6 +72,12 @@ func (s *SSHSignRequest) Validate() error {
 		return errs.BadRequest("missing or empty publicKey")
 	case s.OTT == "":
 		return errs.BadRequest("missing or empty ott")
+	case s.StepUp != nil && s.CertType == provisioner.SSHHostCert:
+		return errs.BadRequest("stepUp is not supported for host certificates")
+	case s.StepUp != nil && len(s.StepUp.Principals) == 0:
+		return errs.BadRequest("missing or empty stepUp principals")
+	case s.StepUp != nil && s.StepUp.Justification == "":
+		return errs.BadRequest("missing or empty stepUp justification")
 	default:
 		// Validate identity signature if provided
 		if s.IdentityCSR.CertificateRequest != nil {
@@ -70,9 +91,20 @@ func (s *SSHSignRequest) Validate() error {
 
 // SSHSignResponse is the response object that returns the SSH certificate.
 type SSHSignResponse struct {
-	Certificate         SSHCertificate  `json:"crt"`
-	AddUserCertificate  *SSHCertificate `json:"addUserCrt,omitempty"`
-	IdentityCertificate []Certificate   `json:"identityCrt,omitempty"`
+	Certificate         SSHCertificate     `json:"crt"`
+	AddUserCertificate  *SSHCertificate    `json:"addUserCrt,omitempty"`
+	IdentityCertificate []Certificate      `json:"identityCrt,omitempty"`
+	StepUp              *SSHStepUpResponse `json:"stepUp,omitempty"`
+}
+
+// SSHStepUpResponse is the response object that returns the status of an SSH
+// step-up request, and the certificate with the additional principals once
+// it has been approved.
+type SSHStepUpResponse struct {
+	ID          string          `json:"id"`
+	Status      string          `json:"status"`
+	ExpiresAt   time.Time       `json:"expiresAt"`
+	Certificate *SSHCertificate `json:"crt,omitempty"`
 }
 
 // SSHRootsResponse represents the response object that returns the SSH user and
@@ -289,6 +321,10 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 
 	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHSignMethod)
 	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
+	ctx = provisioner.NewContextWithRemoteAddress(ctx, remoteAddress(r))
+	if body.HostKeyProof != nil {
+		ctx = provisioner.NewContextWithSSHHostKeyProof(ctx, body.HostKeyProof)
+	}
 
 	a := mustAuthority(ctx)
 	signOpts, err := a.Authorize(ctx, body.OTT)
@@ -338,13 +374,55 @@ func SSHSign(w http.ResponseWriter, r *http.Request) {
 		identityCertificate = certChainToPEM(certChain)
 	}
 
+	// Store the request for additional principals, the certificate will be
+	// available using SSHStepUp once it's approved.
+	var stepUp *SSHStepUpResponse
+	if body.StepUp != nil {
+		req, err := a.CreateSSHStepUpRequest(ctx, cert, body.StepUp.Principals, body.StepUp.Justification, signOpts...)
+		if err != nil {
+			render.Error(w, err)
+			return
+		}
+		stepUp = &SSHStepUpResponse{
+			ID:        req.ID,
+			Status:    string(req.Status),
+			ExpiresAt: req.ExpiresAt,
+		}
+	}
+
 	render.JSONStatus(w, &SSHSignResponse{
 		Certificate:         SSHCertificate{cert},
 		AddUserCertificate:  addUserCertificate,
 		IdentityCertificate: identityCertificate,
+		StepUp:              stepUp,
 	}, http.StatusCreated)
 }
 
+// SSHStepUp is an HTTP handler that returns the status of an SSH step-up
+// request. If the request has been approved, it returns the SSH user
+// certificate with the additional principals, otherwise it returns a
+// "202 Accepted" and the client is expected to poll again later.
+func SSHStepUp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req, cert, err := mustAuthority(ctx).PollSSHStepUpRequest(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	resp := &SSHStepUpResponse{
+		ID:        req.ID,
+		Status:    string(req.Status),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if cert == nil {
+		render.JSONStatus(w, resp, http.StatusAccepted)
+		return
+	}
+	resp.Certificate = &SSHCertificate{cert}
+	render.JSON(w, resp)
+}
+
 // SSHRoots is an HTTP handler that returns the SSH public keys for user and host
 // certificates.
 func SSHRoots(w http.ResponseWriter, r *http.Request) {
@@ -508,3 +586,19 @@ func (m *identityModifier) Enforce(cert *x509.Certificate) error {
 	cert.NotAfter = m.NotAfter
 	return nil
 }
+
+// remoteAddress returns the IP address of the client that sent the request.
+//
+// The address is always the peer of the connection, r.RemoteAddr. Headers like
+// X-Forwarded-For or X-Real-IP are ignored on purpose, as any client can set
+// them, and the CA does not have a list of trusted proxies. If the CA is
+// behind a proxy or a load balancer, the address returned is the one of the
+// proxy, so the policies using fromRemoteAddress should not be used in that
+// case.
+func remoteAddress(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return addr
+}
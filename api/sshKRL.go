@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// SSHKRL is an HTTP handler that returns the OpenSSH key revocation list (KRL)
+// with the revoked SSH certificates in the binary format. The response
+// includes an ETag with the version of the list, and if the If-None-Match
+// header matches it, a "304 Not Modified" is returned, so hosts can poll the
+// endpoint cheaply.
+func SSHKRL(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	krl, err := mustAuthority(ctx).GetSSHKeyRevocationList(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	etag := `"` + strconv.FormatUint(krl.Version, 10) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"revoked_keys\"")
+	if _, err := w.Write(krl.Data); err != nil {
+		log.Error(w, err)
+	}
+}
+
+// matchesETag returns true if the value of an If-None-Match header matches the
+// given ETag.
+func matchesETag(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+func Test_SSHKRL(t *testing.T) {
+	krlBytes := []byte("the krl")
+	krl := &db.SSHKeyRevocationListInfo{Version: 1665000000, Data: krlBytes}
+	etag := `"1665000000"`
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		krl         *db.SSHKeyRevocationListInfo
+		err         error
+		statusCode  int
+		expected    []byte
+	}{
+		{"ok", "", krl, nil, http.StatusOK, krlBytes},
+		{"ok other etag", `"foo"`, krl, nil, http.StatusOK, krlBytes},
+		{"ok not modified", etag, krl, nil, http.StatusNotModified, []byte{}},
+		{"ok not modified list", `"foo", W/` + etag, krl, nil, http.StatusNotModified, []byte{}},
+		{"ok not modified any", "*", krl, nil, http.StatusNotModified, []byte{}},
+		{"fail not configured", "", nil, errs.NotFound("ssh is not configured"), http.StatusNotFound, nil},
+		{"fail not implemented", "", nil, errs.NotImplemented("krl is not implemented"), http.StatusNotImplemented, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.krl, err: tt.err})
+			req := httptest.NewRequest("GET", "https://example.com/ssh/krl", http.NoBody)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			SSHKRL(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("SSHKRL StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("SSHKRL unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if got := res.Header.Get("ETag"); got != etag {
+					t.Errorf("SSHKRL ETag = %s, wants %s", got, etag)
+				}
+				if !bytes.Equal(body, tt.expected) {
+					t.Errorf("SSHKRL Body = %s, wants %s", body, tt.expected)
+				}
+			}
+			if tt.statusCode == http.StatusOK {
+				if ct := res.Header.Get("Content-Type"); ct != "application/octet-stream" {
+					t.Errorf("SSHKRL Content-Type = %s, wants application/octet-stream", ct)
+				}
+			}
+		})
+	}
+}
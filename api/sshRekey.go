@@ -14,8 +14,9 @@ import (
 
 // SSHRekeyRequest is the request body of an SSH certificate request.
 type SSHRekeyRequest struct {
-	OTT       string `json:"ott"`
-	PublicKey []byte `json:"publicKey"` //base64 encoded
+	OTT          string                       `json:"ott"`
+	PublicKey    []byte                       `json:"publicKey"` //base64 encoded
+	HostKeyProof *provisioner.SSHHostKeyProof `json:"hostKeyProof,omitempty"`
 }
 
 // Validate validates the SSHSignRekey.
@@ -60,6 +61,9 @@ func SSHRekey(w http.ResponseWriter, r *http.Request) {
 
 	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHRekeyMethod)
 	ctx = provisioner.NewContextWithToken(ctx, body.OTT)
+	if body.HostKeyProof != nil {
+		ctx = provisioner.NewContextWithSSHHostKeyProof(ctx, body.HostKeyProof)
+	}
 
 	a := mustAuthority(ctx)
 	signOpts, err := a.Authorize(ctx, body.OTT)
@@ -25,6 +25,7 @@ type SSHRevokeRequest struct {
 	ReasonCode int    `json:"reasonCode"`
 	Reason     string `json:"reason"`
 	Passive    bool   `json:"passive"`
+	KeyID      string `json:"keyID,omitempty"`
 }
 
 // Validate checks the fields of the RevokeRequest and returns nil if they are ok
@@ -65,6 +66,7 @@ func SSHRevoke(w http.ResponseWriter, r *http.Request) {
 		Reason:      body.Reason,
 		ReasonCode:  body.ReasonCode,
 		PassiveOnly: body.Passive,
+		KeyID:       body.KeyID,
 	}
 
 	ctx := provisioner.NewContextWithMethod(r.Context(), provisioner.SSHRevokeMethod)
@@ -96,6 +98,7 @@ func logSSHRevoke(w http.ResponseWriter, ri *authority.RevokeOptions) {
 			"reasonCode":  ri.ReasonCode,
 			"reason":      ri.Reason,
 			"passiveOnly": ri.PassiveOnly,
+			"keyID":       ri.KeyID,
 			"mTLS":        ri.MTLS,
 			"ssh":         true,
 		})
@@ -9,6 +9,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,11 +19,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/templates"
 )
@@ -214,22 +218,27 @@ func TestSignSSHRequest_Validate(t *testing.T) {
 		AddUserPublicKey []byte
 		KeyID            string
 		IdentityCSR      CertificateRequest
+		StepUp           *SSHStepUpRequest
 	}
 	tests := []struct {
 		name    string
 		fields  fields
 		wantErr bool
 	}{
-		{"ok-empty", fields{[]byte("Zm9v"), "ott", "", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-user", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, false},
-		{"ok-keyID", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{}}, false},
-		{"ok-identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: csr}}, false},
-		{"key", fields{nil, "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"key", fields{[]byte(""), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"type", fields{[]byte("Zm9v"), "ott", "foo", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"ott", fields{[]byte("Zm9v"), "", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}}, true},
-		{"identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: badCSR}}, true},
+		{"ok-empty", fields{[]byte("Zm9v"), "ott", "", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, false},
+		{"ok-user", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, false},
+		{"ok-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, false},
+		{"ok-keyID", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{}, nil}, false},
+		{"ok-identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: csr}, nil}, false},
+		{"key", fields{nil, "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"key", fields{[]byte(""), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"type", fields{[]byte("Zm9v"), "ott", "foo", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"ott", fields{[]byte("Zm9v"), "", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, nil}, true},
+		{"identityCSR", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "key-id", CertificateRequest{CertificateRequest: badCSR}, nil}, true},
+		{"ok-stepUp", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &SSHStepUpRequest{Principals: []string{"root"}, Justification: "incident 1234"}}, false},
+		{"stepUp-host", fields{[]byte("Zm9v"), "ott", "host", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &SSHStepUpRequest{Principals: []string{"root"}, Justification: "incident 1234"}}, true},
+		{"stepUp-principals", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &SSHStepUpRequest{Justification: "incident 1234"}}, true},
+		{"stepUp-justification", fields{[]byte("Zm9v"), "ott", "user", []string{"user"}, TimeDuration{}, TimeDuration{}, nil, "", CertificateRequest{}, &SSHStepUpRequest{Principals: []string{"root"}}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -243,6 +252,7 @@ func TestSignSSHRequest_Validate(t *testing.T) {
 				AddUserPublicKey: tt.fields.AddUserPublicKey,
 				KeyID:            tt.fields.KeyID,
 				IdentityCSR:      tt.fields.IdentityCSR,
+				StepUp:           tt.fields.StepUp,
 			}
 			if err := s.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("SignSSHRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -353,6 +363,129 @@ func Test_SSHSign(t *testing.T) {
 	}
 }
 
+func Test_SSHSign_stepUp(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+	userB64 := base64.StdEncoding.EncodeToString(user.Marshal())
+
+	stepUpReq, err := json.Marshal(SSHSignRequest{
+		PublicKey: user.Key.Marshal(),
+		OTT:       "ott",
+		StepUp: &SSHStepUpRequest{
+			Principals:    []string{"root"},
+			Justification: "incident 1234",
+		},
+	})
+	assert.FatalError(t, err)
+	expiresAt := time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		stepUp     *db.SSHStepUpRequest
+		stepUpErr  error
+		body       []byte
+		statusCode int
+	}{
+		{"ok", &db.SSHStepUpRequest{ID: "id", Status: db.SSHStepUpRequestPending, ExpiresAt: expiresAt}, nil, []byte(fmt.Sprintf(`{"crt":%q,"stepUp":{"id":"id","status":"pending","expiresAt":"2022-10-01T16:00:00Z"}}`, userB64)), http.StatusCreated},
+		{"fail-forbidden", nil, errs.Forbidden("ssh step-up principal \"root\" is not allowed"), nil, http.StatusForbidden},
+		{"fail-not-implemented", nil, errs.NotImplemented("not implemented"), nil, http.StatusNotImplemented},
+		{"fail-bad-request", nil, errs.BadRequest("ssh step-up requests require a justification"), nil, http.StatusBadRequest},
+		{"fail-internal", nil, errors.New("force"), nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					return []provisioner.SignOption{}, nil
+				},
+				signSSH: func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+					return user, nil
+				},
+				createSSHStepUpRequest: func(ctx context.Context, cert *ssh.Certificate, principals []string, justification string, signOpts ...provisioner.SignOption) (*db.SSHStepUpRequest, error) {
+					assert.Equals(t, user, cert)
+					assert.Equals(t, []string{"root"}, principals)
+					assert.Equals(t, "incident 1234", justification)
+					return tt.stepUp, tt.stepUpErr
+				},
+			})
+
+			req := httptest.NewRequest("POST", "http://example.com/ssh/sign", bytes.NewReader(stepUpReq))
+			w := httptest.NewRecorder()
+			SSHSign(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.SignSSH StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.SignSSH unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+					t.Errorf("caHandler.SignSSH Body = %s, wants %s", body, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func Test_SSHStepUp(t *testing.T) {
+	user, err := getSignedUserCertificate()
+	assert.FatalError(t, err)
+	userB64 := base64.StdEncoding.EncodeToString(user.Marshal())
+	expiresAt := time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		req        *db.SSHStepUpRequest
+		cert       *ssh.Certificate
+		err        error
+		body       []byte
+		statusCode int
+	}{
+		{"ok-pending", &db.SSHStepUpRequest{ID: "id", Status: db.SSHStepUpRequestPending, ExpiresAt: expiresAt}, nil, nil, []byte(`{"id":"id","status":"pending","expiresAt":"2022-10-01T16:00:00Z"}`), http.StatusAccepted},
+		{"ok-issued", &db.SSHStepUpRequest{ID: "id", Status: db.SSHStepUpRequestIssued, ExpiresAt: expiresAt}, user, nil, []byte(fmt.Sprintf(`{"id":"id","status":"issued","expiresAt":"2022-10-01T16:00:00Z","crt":%q}`, userB64)), http.StatusOK},
+		{"fail-not-found", nil, nil, errs.NotFound("ssh step-up request id not found"), nil, http.StatusNotFound},
+		{"fail-rejected", nil, nil, errs.Forbidden("ssh step-up request id has been rejected"), nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{
+				pollSSHStepUpRequest: func(ctx context.Context, id string) (*db.SSHStepUpRequest, *ssh.Certificate, error) {
+					assert.Equals(t, "id", id)
+					return tt.req, tt.cert, tt.err
+				},
+			})
+
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "id")
+			req := httptest.NewRequest("GET", "http://example.com/ssh/step-up/id", http.NoBody)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			SSHStepUp(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("caHandler.SSHStepUp StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.SSHStepUp unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if !bytes.Equal(bytes.TrimSpace(body), tt.body) {
+					t.Errorf("caHandler.SSHStepUp Body = %s, wants %s", body, tt.body)
+				}
+			}
+		})
+	}
+}
+
 func Test_SSHRoots(t *testing.T) {
 	user, err := ssh.NewPublicKey(sshUserKey.Public())
 	assert.FatalError(t, err)
@@ -736,3 +869,24 @@ func TestSSHPublicKey_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func Test_remoteAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"ipv4", "127.0.0.1:1234", "127.0.0.1"},
+		{"ipv6", "[::1]:1234", "::1"},
+		{"no port", "127.0.0.1", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/ssh/sign", http.NoBody)
+			req.RemoteAddr = tt.remoteAddr
+			if got := remoteAddress(req); got != tt.want {
+				t.Errorf("remoteAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
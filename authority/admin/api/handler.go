@@ -81,6 +81,24 @@ func Route(r api.Router, acmeResponder ACMEAdminResponder, policyResponder Polic
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(DeleteAdmin))
 
+	// SSH host inventory
+	r.MethodFunc("GET", "/ssh/hosts/{id}", authnz(GetSSHHost))
+	r.MethodFunc("GET", "/ssh/hosts", authnz(GetSSHHosts))
+	r.MethodFunc("POST", "/ssh/hosts", authnz(CreateSSHHost))
+	r.MethodFunc("PUT", "/ssh/hosts/{id}", authnz(UpdateSSHHost))
+	r.MethodFunc("DELETE", "/ssh/hosts/{id}", authnz(DeleteSSHHost))
+
+	// SSH step-up requests pending approval
+	r.MethodFunc("GET", "/ssh/step-up", authnz(GetSSHStepUpRequests))
+	r.MethodFunc("PATCH", "/ssh/step-up/{id}", authnz(UpdateSSHStepUpRequest))
+
+	// SCEP dynamic challenges
+	r.MethodFunc("POST", "/scep/challenges/{provisionerName}", authnz(CreateSCEPChallenge))
+
+	// SCEP requests pending approval
+	r.MethodFunc("GET", "/scep/requests/{provisionerName}", authnz(GetSCEPRequests))
+	r.MethodFunc("PATCH", "/scep/requests/{provisionerName}/{id}", authnz(UpdateSCEPRequest))
+
 	// ACME responder
 	if acmeResponder != nil {
 		// ACME External Account Binding Keys
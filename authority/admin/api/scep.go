@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/nosql"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/scep"
+)
+
+// defaultSCEPChallengeExpiration is the default validity of a dynamic SCEP
+// challenge.
+const defaultSCEPChallengeExpiration = time.Hour
+
+// CreateSCEPChallengeRequest is the type for POST /admin/scep/challenges
+// requests. The challenge can optionally be bound to the subject common name
+// and the subject alternative names of the CSR.
+type CreateSCEPChallengeRequest struct {
+	Subject   string   `json:"subject,omitempty"`
+	SANs      []string `json:"sans,omitempty"`
+	ExpiresIn string   `json:"expiresIn,omitempty"`
+}
+
+// Validate validates a new SCEP challenge request body.
+func (r *CreateSCEPChallengeRequest) Validate() error {
+	if r.ExpiresIn != "" {
+		d, err := time.ParseDuration(r.ExpiresIn)
+		if err != nil {
+			return admin.WrapError(admin.ErrorBadRequestType, err, "error parsing expiresIn %s", r.ExpiresIn)
+		}
+		if d <= 0 {
+			return admin.NewError(admin.ErrorBadRequestType, "expiresIn must be greater than 0")
+		}
+	}
+	for _, san := range r.SANs {
+		if san == "" {
+			return admin.NewError(admin.ErrorBadRequestType, "sans cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// CreateSCEPChallengeResponse is the type for POST /admin/scep/challenges
+// responses.
+type CreateSCEPChallengeResponse struct {
+	Challenge   string    `json:"challenge"`
+	Provisioner string    `json:"provisioner"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// CreateSCEPChallenge creates a one-time challenge password for a SCEP
+// provisioner with dynamic challenges enabled.
+func CreateSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	var body CreateSCEPChallengeRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	prov, err := loadSCEPProvisioner(ctx, name)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if !prov.HasDynamicChallenges() {
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "dynamic challenges not enabled for provisioner %s", name))
+		return
+	}
+
+	var challengeDB db.SCEPChallengeDB
+	if authDB, ok := db.FromContext(ctx); ok {
+		challengeDB, _ = authDB.(db.SCEPChallengeDB)
+	}
+	if challengeDB == nil {
+		render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "dynamic SCEP challenges are not supported by the database"))
+		return
+	}
+
+	expiresIn := defaultSCEPChallengeExpiration
+	if body.ExpiresIn != "" {
+		expiresIn, _ = time.ParseDuration(body.ExpiresIn)
+	}
+
+	challenge, err := randutil.Alphanumeric(32)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error generating challenge"))
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	ch := &db.SCEPChallenge{
+		ID:          scep.ChallengeID(challenge),
+		Provisioner: prov.GetName(),
+		Subject:     body.Subject,
+		SANs:        body.SANs,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(expiresIn),
+	}
+	if err := challengeDB.CreateSCEPChallenge(ch); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error storing challenge"))
+		return
+	}
+
+	render.JSONStatus(w, &CreateSCEPChallengeResponse{
+		Challenge:   challenge,
+		Provisioner: ch.Provisioner,
+		Subject:     ch.Subject,
+		SANs:        ch.SANs,
+		ExpiresAt:   ch.ExpiresAt,
+	}, http.StatusCreated)
+}
+
+// SCEPRequestResponse is the type used to represent a SCEP request that
+// requires a manual approval.
+type SCEPRequestResponse struct {
+	ID            string    `json:"id"`
+	Provisioner   string    `json:"provisioner"`
+	TransactionID string    `json:"transactionID"`
+	Subject       string    `json:"subject"`
+	SANs          []string  `json:"sans,omitempty"`
+	Status        string    `json:"status"`
+	SerialNumber  string    `json:"serialNumber,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// GetSCEPRequestsResponse is the type for GET /admin/scep/requests responses.
+type GetSCEPRequestsResponse struct {
+	Requests []*SCEPRequestResponse `json:"requests"`
+}
+
+// UpdateSCEPRequestRequest is the type for PATCH /admin/scep/requests
+// requests.
+type UpdateSCEPRequestRequest struct {
+	Status string `json:"status"`
+}
+
+// Validate validates an update SCEP request body.
+func (r *UpdateSCEPRequestRequest) Validate() error {
+	switch db.SCEPRequestStatus(r.Status) {
+	case db.SCEPRequestApproved, db.SCEPRequestRejected:
+		return nil
+	default:
+		return admin.NewError(admin.ErrorBadRequestType, "status must be %s or %s", db.SCEPRequestApproved, db.SCEPRequestRejected)
+	}
+}
+
+// GetSCEPRequests returns the SCEP requests of a provisioner that requires a
+// manual approval. The results can be filtered using the status query
+// parameter.
+func GetSCEPRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	prov, err := loadSCEPProvisioner(ctx, name)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	requestDB, err := scepRequestDB(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	reqs, err := requestDB.GetSCEPRequests()
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving scep requests"))
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	res := &GetSCEPRequestsResponse{
+		Requests: []*SCEPRequestResponse{},
+	}
+	for _, req := range reqs {
+		if req.Provisioner != prov.GetName() || (status != "" && string(req.Status) != status) {
+			continue
+		}
+		resp, err := newSCEPRequestResponse(req)
+		if err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error parsing scep request %s", req.ID))
+			return
+		}
+		res.Requests = append(res.Requests, resp)
+	}
+
+	render.JSON(w, res)
+}
+
+// UpdateSCEPRequest approves or rejects a pending SCEP request. The
+// certificate of an approved request is issued the next time the client polls
+// for it.
+func UpdateSCEPRequest(w http.ResponseWriter, r *http.Request) {
+	var body UpdateSCEPRequestRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	name := chi.URLParam(r, "provisionerName")
+	prov, err := loadSCEPProvisioner(ctx, name)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	requestDB, err := scepRequestDB(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	req, err := requestDB.GetSCEPRequest(id)
+	switch {
+	case nosql.IsErrNotFound(err):
+		render.Error(w, admin.NewError(admin.ErrorNotFoundType, "scep request %s not found", id))
+		return
+	case err != nil:
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving scep request %s", id))
+		return
+	case req.Provisioner != prov.GetName():
+		render.Error(w, admin.NewError(admin.ErrorNotFoundType, "scep request %s not found", id))
+		return
+	case req.Status != db.SCEPRequestPending:
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "scep request %s is %s", id, req.Status))
+		return
+	}
+
+	updated := *req
+	updated.Status = db.SCEPRequestStatus(body.Status)
+	updated.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := requestDB.UpdateSCEPRequest(&updated, db.SCEPRequestPending); err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			render.Error(w, admin.NewError(admin.ErrorBadRequestType, "scep request %s is no longer pending", id))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error updating scep request %s", id))
+		return
+	}
+
+	resp, err := newSCEPRequestResponse(&updated)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error parsing scep request %s", id))
+		return
+	}
+	render.JSON(w, resp)
+}
+
+// loadSCEPProvisioner returns the SCEP provisioner with the given name.
+func loadSCEPProvisioner(ctx context.Context, name string) (*provisioner.SCEP, error) {
+	p, err := mustAuthority(ctx).LoadProvisionerByName(name)
+	if err != nil {
+		return nil, admin.WrapErrorISE(err, "error loading provisioner %s", name)
+	}
+	prov, ok := p.(*provisioner.SCEP)
+	if !ok {
+		return nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a SCEP provisioner", name)
+	}
+	return prov, nil
+}
+
+// scepRequestDB returns the database used to store the SCEP requests that
+// require a manual approval.
+func scepRequestDB(ctx context.Context) (db.SCEPRequestDB, error) {
+	if authDB, ok := db.FromContext(ctx); ok {
+		if requestDB, ok := authDB.(db.SCEPRequestDB); ok {
+			return requestDB, nil
+		}
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "pending SCEP requests are not supported by the database")
+}
+
+func newSCEPRequestResponse(req *db.SCEPRequest) (*SCEPRequestResponse, error) {
+	csr, err := x509.ParseCertificateRequest(req.CSR)
+	if err != nil {
+		return nil, err
+	}
+	return &SCEPRequestResponse{
+		ID:            req.ID,
+		Provisioner:   req.Provisioner,
+		TransactionID: req.TransactionID,
+		Subject:       csr.Subject.CommonName,
+		SANs:          scep.CSRSANs(csr),
+		Status:        string(req.Status),
+		SerialNumber:  req.SerialNumber,
+		CreatedAt:     req.CreatedAt,
+		UpdatedAt:     req.UpdatedAt,
+	}, nil
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// SSHHostRequest is the type for POST /admin/ssh/hosts and PUT
+// /admin/ssh/hosts/{id} requests.
+type SSHHostRequest struct {
+	Hostname string             `json:"hostname"`
+	Tags     []admin.SSHHostTag `json:"tags,omitempty"`
+}
+
+// Validate validates an SSH host request body.
+func (r *SSHHostRequest) Validate() error {
+	if r.Hostname == "" {
+		return admin.NewError(admin.ErrorBadRequestType, "hostname cannot be empty")
+	}
+	if strings.ContainsAny(r.Hostname, " \t\r\n,") {
+		return admin.NewError(admin.ErrorBadRequestType, "hostname %q is not valid", r.Hostname)
+	}
+	seen := make(map[string]bool, len(r.Tags))
+	for _, t := range r.Tags {
+		if t.Name == "" {
+			return admin.NewError(admin.ErrorBadRequestType, "tag name cannot be empty")
+		}
+		if strings.Contains(t.Name, "=") {
+			return admin.NewError(admin.ErrorBadRequestType, "tag name %q is not valid", t.Name)
+		}
+		if seen[t.String()] {
+			return admin.NewError(admin.ErrorBadRequestType, "tag %s is duplicated", t.String())
+		}
+		seen[t.String()] = true
+	}
+	return nil
+}
+
+// GetSSHHostsResponse is the type for GET /admin/ssh/hosts responses.
+type GetSSHHostsResponse struct {
+	Hosts []*admin.SSHHost `json:"hosts"`
+}
+
+// GetSSHHosts returns the hosts in the SSH host inventory.
+func GetSSHHosts(w http.ResponseWriter, r *http.Request) {
+	hostDB, err := sshHostDB(r.Context())
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	hosts, err := hostDB.GetSSHHosts(r.Context())
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving ssh hosts"))
+		return
+	}
+
+	render.JSON(w, &GetSSHHostsResponse{
+		Hosts: hosts,
+	})
+}
+
+// GetSSHHost returns the requested host in the SSH host inventory.
+func GetSSHHost(w http.ResponseWriter, r *http.Request) {
+	hostDB, err := sshHostDB(r.Context())
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	host, err := hostDB.GetSSHHost(r.Context(), id)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving ssh host %s", id))
+		return
+	}
+
+	render.JSON(w, host)
+}
+
+// CreateSSHHost adds a new host to the SSH host inventory.
+func CreateSSHHost(w http.ResponseWriter, r *http.Request) {
+	var body SSHHostRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	hostDB, err := sshHostDB(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if err := checkSSHHostname(ctx, hostDB, "", body.Hostname); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	host := &admin.SSHHost{
+		Hostname: body.Hostname,
+		Tags:     body.Tags,
+	}
+	if err := hostDB.CreateSSHHost(ctx, host); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error storing ssh host"))
+		return
+	}
+
+	render.JSONStatus(w, host, http.StatusCreated)
+}
+
+// UpdateSSHHost updates the hostname and the tags of a host in the SSH host
+// inventory.
+func UpdateSSHHost(w http.ResponseWriter, r *http.Request) {
+	var body SSHHostRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	hostDB, err := sshHostDB(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := checkSSHHostname(ctx, hostDB, id, body.Hostname); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	host := &admin.SSHHost{
+		ID:       id,
+		Hostname: body.Hostname,
+		Tags:     body.Tags,
+	}
+	if err := hostDB.UpdateSSHHost(ctx, host); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error updating ssh host %s", id))
+		return
+	}
+
+	render.JSON(w, host)
+}
+
+// DeleteSSHHost removes a host from the SSH host inventory.
+func DeleteSSHHost(w http.ResponseWriter, r *http.Request) {
+	hostDB, err := sshHostDB(r.Context())
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := hostDB.DeleteSSHHost(r.Context(), id); err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error deleting ssh host %s", id))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
+
+func sshHostDB(ctx context.Context) (admin.SSHHostDB, error) {
+	if adminDB, ok := admin.FromContext(ctx); ok {
+		if hostDB, ok := adminDB.(admin.SSHHostDB); ok {
+			return hostDB, nil
+		}
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "ssh host inventory is not supported by the admin database")
+}
+
+// checkSSHHostname returns a conflict error if a host other than the one with
+// the given id has the same hostname.
+func checkSSHHostname(ctx context.Context, hostDB admin.SSHHostDB, id, hostname string) error {
+	host, err := hostDB.GetSSHHostByHostname(ctx, hostname)
+	if err != nil {
+		var ae *admin.Error
+		if errors.As(err, &ae) && ae.IsType(admin.ErrorNotFoundType) {
+			return nil
+		}
+		return admin.WrapErrorISE(err, "error retrieving ssh host %s", hostname)
+	}
+	if host != nil && host.ID != id {
+		return admin.NewError(admin.ErrorConflictType, "ssh host %s already exists", hostname)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/nosql"
+
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// SSHStepUpRequestResponse is the type used to represent a request for
+// additional principals in an SSH user certificate.
+type SSHStepUpRequestResponse struct {
+	ID            string    `json:"id"`
+	Provisioner   string    `json:"provisioner"`
+	KeyID         string    `json:"keyID"`
+	Principals    []string  `json:"principals"`
+	Justification string    `json:"justification"`
+	Duration      string    `json:"duration"`
+	Status        string    `json:"status"`
+	ReviewedBy    string    `json:"reviewedBy,omitempty"`
+	SerialNumber  string    `json:"serialNumber,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+// GetSSHStepUpRequestsResponse is the type for GET /admin/ssh/step-up
+// responses.
+type GetSSHStepUpRequestsResponse struct {
+	Requests []*SSHStepUpRequestResponse `json:"requests"`
+}
+
+// UpdateSSHStepUpRequestRequest is the type for PATCH /admin/ssh/step-up/{id}
+// requests.
+type UpdateSSHStepUpRequestRequest struct {
+	Status string `json:"status"`
+}
+
+// Validate validates an update SSH step-up request body.
+func (r *UpdateSSHStepUpRequestRequest) Validate() error {
+	switch db.SSHStepUpRequestStatus(r.Status) {
+	case db.SSHStepUpRequestApproved, db.SSHStepUpRequestRejected:
+		return nil
+	default:
+		return admin.NewError(admin.ErrorBadRequestType, "status must be %s or %s", db.SSHStepUpRequestApproved, db.SSHStepUpRequestRejected)
+	}
+}
+
+// GetSSHStepUpRequests returns the requests for additional principals in SSH
+// user certificates. The results can be filtered using the status and
+// provisioner query parameters.
+func GetSSHStepUpRequests(w http.ResponseWriter, r *http.Request) {
+	requestDB, err := sshStepUpRequestDB(r.Context())
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	reqs, err := requestDB.GetSSHStepUpRequests()
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving ssh step-up requests"))
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	provisionerName := r.URL.Query().Get("provisioner")
+	res := &GetSSHStepUpRequestsResponse{
+		Requests: []*SSHStepUpRequestResponse{},
+	}
+	for _, req := range reqs {
+		if (status != "" && string(req.Status) != status) || (provisionerName != "" && req.Provisioner != provisionerName) {
+			continue
+		}
+		res.Requests = append(res.Requests, newSSHStepUpRequestResponse(req))
+	}
+
+	render.JSON(w, res)
+}
+
+// UpdateSSHStepUpRequest approves or rejects a pending SSH step-up request.
+// The certificate of an approved request is issued the next time the
+// requester polls for it.
+func UpdateSSHStepUpRequest(w http.ResponseWriter, r *http.Request) {
+	var body UpdateSSHStepUpRequestRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	requestDB, err := sshStepUpRequestDB(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	id := chi.URLParam(r, "id")
+	req, err := requestDB.GetSSHStepUpRequest(id)
+	switch {
+	case nosql.IsErrNotFound(err):
+		render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ssh step-up request %s not found", id))
+		return
+	case err != nil:
+		render.Error(w, admin.WrapErrorISE(err, "error retrieving ssh step-up request %s", id))
+		return
+	case req.Status != db.SSHStepUpRequestPending:
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "ssh step-up request %s is %s", id, req.Status))
+		return
+	case now.After(req.ExpiresAt):
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "ssh step-up request %s has expired", id))
+		return
+	}
+
+	updated := *req
+	updated.Status = db.SSHStepUpRequestStatus(body.Status)
+	updated.UpdatedAt = now
+	if adm, ok := linkedca.AdminFromContext(ctx); ok {
+		updated.ReviewedBy = adm.GetSubject()
+	}
+	if err := requestDB.UpdateSSHStepUpRequest(&updated, db.SSHStepUpRequestPending); err != nil {
+		if errors.Is(err, db.ErrAlreadyExists) {
+			render.Error(w, admin.NewError(admin.ErrorBadRequestType, "ssh step-up request %s is no longer pending", id))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error updating ssh step-up request %s", id))
+		return
+	}
+
+	render.JSON(w, newSSHStepUpRequestResponse(&updated))
+}
+
+// sshStepUpRequestDB returns the database used to store the SSH step-up
+// requests.
+func sshStepUpRequestDB(ctx context.Context) (db.SSHStepUpRequestDB, error) {
+	if authDB, ok := db.FromContext(ctx); ok {
+		if requestDB, ok := authDB.(db.SSHStepUpRequestDB); ok {
+			return requestDB, nil
+		}
+	}
+	return nil, admin.NewError(admin.ErrorNotImplementedType, "ssh step-up requests are not supported by the database")
+}
+
+func newSSHStepUpRequestResponse(req *db.SSHStepUpRequest) *SSHStepUpRequestResponse {
+	return &SSHStepUpRequestResponse{
+		ID:            req.ID,
+		Provisioner:   req.Provisioner,
+		KeyID:         req.KeyID,
+		Principals:    req.Principals,
+		Justification: req.Justification,
+		Duration:      req.Duration.String(),
+		Status:        string(req.Status),
+		ReviewedBy:    req.ReviewedBy,
+		SerialNumber:  req.SerialNumber,
+		CreatedAt:     req.CreatedAt,
+		UpdatedAt:     req.UpdatedAt,
+		ExpiresAt:     req.ExpiresAt,
+	}
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.step.sm/linkedca"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestUpdateSSHStepUpRequestRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     UpdateSSHStepUpRequestRequest
+		wantErr bool
+	}{
+		{"ok/approved", UpdateSSHStepUpRequestRequest{Status: "approved"}, false},
+		{"ok/rejected", UpdateSSHStepUpRequestRequest{Status: "rejected"}, false},
+		{"fail/empty", UpdateSSHStepUpRequestRequest{}, true},
+		{"fail/pending", UpdateSSHStepUpRequestRequest{Status: "pending"}, true},
+		{"fail/issued", UpdateSSHStepUpRequestRequest{Status: "issued"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("UpdateSSHStepUpRequestRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetSSHStepUpRequests(t *testing.T) {
+	createdAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC)
+	reqs := []*db.SSHStepUpRequest{
+		{ID: "pendingID", Provisioner: "jwk", KeyID: "jane@example.com", Principals: []string{"root"}, Justification: "incident 1234", Duration: time.Hour, Status: db.SSHStepUpRequestPending, CreatedAt: createdAt, UpdatedAt: createdAt, ExpiresAt: expiresAt},
+		{ID: "issuedID", Provisioner: "oidc", KeyID: "joe@example.com", Principals: []string{"admin"}, Justification: "deploy", Duration: 15 * time.Minute, Status: db.SSHStepUpRequestIssued, ReviewedBy: "admin@example.com", SerialNumber: "1234", CreatedAt: createdAt, UpdatedAt: createdAt, ExpiresAt: expiresAt},
+	}
+	pending := &SSHStepUpRequestResponse{ID: "pendingID", Provisioner: "jwk", KeyID: "jane@example.com", Principals: []string{"root"}, Justification: "incident 1234", Duration: "1h0m0s", Status: "pending", CreatedAt: createdAt, UpdatedAt: createdAt, ExpiresAt: expiresAt}
+	issued := &SSHStepUpRequestResponse{ID: "issuedID", Provisioner: "oidc", KeyID: "joe@example.com", Principals: []string{"admin"}, Justification: "deploy", Duration: "15m0s", Status: "issued", ReviewedBy: "admin@example.com", SerialNumber: "1234", CreatedAt: createdAt, UpdatedAt: createdAt, ExpiresAt: expiresAt}
+
+	tests := []struct {
+		name       string
+		authDB     db.AuthDB
+		query      string
+		statusCode int
+		want       []*SSHStepUpRequestResponse
+	}{
+		{"ok", &db.MockAuthDB{Ret1: reqs}, "", 200, []*SSHStepUpRequestResponse{pending, issued}},
+		{"ok/status", &db.MockAuthDB{Ret1: reqs}, "?status=pending", 200, []*SSHStepUpRequestResponse{pending}},
+		{"ok/provisioner", &db.MockAuthDB{Ret1: reqs}, "?provisioner=oidc", 200, []*SSHStepUpRequestResponse{issued}},
+		{"ok/empty", &db.MockAuthDB{Ret1: reqs}, "?status=rejected", 200, []*SSHStepUpRequestResponse{}},
+		{"fail/not implemented", &db.SimpleDB{}, "", 501, nil},
+		{"fail/db.GetSSHStepUpRequests", &db.MockAuthDB{Err: errors.New("force")}, "", 500, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/foo"+tt.query, nil)
+			req = req.WithContext(db.NewContext(context.Background(), tt.authDB))
+			w := httptest.NewRecorder()
+			GetSSHStepUpRequests(w, req)
+			res := w.Result()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if res.StatusCode >= 400 {
+				return
+			}
+
+			var resp GetSSHStepUpRequestsResponse
+			assert.FatalError(t, json.NewDecoder(res.Body).Decode(&resp))
+			assert.Equals(t, tt.want, resp.Requests)
+		})
+	}
+}
+
+func TestUpdateSSHStepUpRequest(t *testing.T) {
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := createdAt.Add(16 * time.Hour)
+	newRequest := func(status db.SSHStepUpRequestStatus, expiresAt time.Time) *db.SSHStepUpRequest {
+		return &db.SSHStepUpRequest{
+			ID:            "id",
+			Provisioner:   "jwk",
+			KeyID:         "jane@example.com",
+			Principals:    []string{"root"},
+			Justification: "incident 1234",
+			Duration:      time.Hour,
+			Status:        status,
+			CreatedAt:     createdAt,
+			UpdatedAt:     createdAt,
+			ExpiresAt:     expiresAt,
+		}
+	}
+
+	type test struct {
+		authDB     db.AuthDB
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		want       *SSHStepUpRequestResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read.JSON": func(t *testing.T) test {
+			return test{
+				authDB:     &db.MockAuthDB{},
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				authDB:     &db.MockAuthDB{},
+				body:       []byte(`{"status":"issued"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "status must be approved or rejected",
+				},
+			}
+		},
+		"fail/not implemented": func(t *testing.T) test {
+			return test{
+				authDB:     &db.SimpleDB{},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    admin.ErrorNotImplementedType.String(),
+					Detail:  "not implemented",
+					Message: "ssh step-up requests are not supported by the database",
+				},
+			}
+		},
+		"fail/not found": func(t *testing.T) test {
+			return test{
+				authDB:     &db.MockAuthDB{Err: database.ErrNotFound},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Detail:  "resource not found",
+					Message: "ssh step-up request id not found",
+				},
+			}
+		},
+		"fail/not pending": func(t *testing.T) test {
+			return test{
+				authDB:     &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestIssued, expiresAt)},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "ssh step-up request id is issued",
+				},
+			}
+		},
+		"fail/expired": func(t *testing.T) test {
+			return test{
+				authDB:     &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestPending, createdAt.Add(-time.Minute))},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "ssh step-up request id has expired",
+				},
+			}
+		},
+		"fail/db.UpdateSSHStepUpRequest conflict": func(t *testing.T) test {
+			return test{
+				authDB: &db.MockAuthDB{
+					Ret1: newRequest(db.SSHStepUpRequestPending, expiresAt),
+					MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+						return db.ErrAlreadyExists
+					},
+				},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "ssh step-up request id is no longer pending",
+				},
+			}
+		},
+		"fail/db.UpdateSSHStepUpRequest": func(t *testing.T) test {
+			return test{
+				authDB: &db.MockAuthDB{
+					Ret1: newRequest(db.SSHStepUpRequestPending, expiresAt),
+					MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+						return errors.New("force")
+					},
+				},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Detail:  "the server experienced an internal error",
+					Message: "error updating ssh step-up request id: force",
+				},
+			}
+		},
+		"ok/approved": func(t *testing.T) test {
+			return test{
+				authDB: &db.MockAuthDB{
+					Ret1: newRequest(db.SSHStepUpRequestPending, expiresAt),
+					MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+						assert.Equals(t, db.SSHStepUpRequestPending, status)
+						assert.Equals(t, db.SSHStepUpRequestApproved, req.Status)
+						assert.Equals(t, "admin@example.com", req.ReviewedBy)
+						return nil
+					},
+				},
+				body:       []byte(`{"status":"approved"}`),
+				statusCode: 200,
+				want: &SSHStepUpRequestResponse{
+					ID:            "id",
+					Provisioner:   "jwk",
+					KeyID:         "jane@example.com",
+					Principals:    []string{"root"},
+					Justification: "incident 1234",
+					Duration:      "1h0m0s",
+					Status:        "approved",
+					ReviewedBy:    "admin@example.com",
+					CreatedAt:     createdAt,
+					ExpiresAt:     expiresAt,
+				},
+			}
+		},
+		"ok/rejected": func(t *testing.T) test {
+			return test{
+				authDB: &db.MockAuthDB{
+					Ret1: newRequest(db.SSHStepUpRequestPending, expiresAt),
+					MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+						assert.Equals(t, db.SSHStepUpRequestRejected, req.Status)
+						return nil
+					},
+				},
+				body:       []byte(`{"status":"rejected"}`),
+				statusCode: 200,
+				want: &SSHStepUpRequestResponse{
+					ID:            "id",
+					Provisioner:   "jwk",
+					KeyID:         "jane@example.com",
+					Principals:    []string{"root"},
+					Justification: "incident 1234",
+					Duration:      "1h0m0s",
+					Status:        "rejected",
+					ReviewedBy:    "admin@example.com",
+					CreatedAt:     createdAt,
+					ExpiresAt:     expiresAt,
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "id")
+			ctx := db.NewContext(context.Background(), tc.authDB)
+			ctx = linkedca.NewContextWithAdmin(ctx, &linkedca.Admin{Subject: "admin@example.com"})
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+
+			req := httptest.NewRequest("PATCH", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			UpdateSSHStepUpRequest(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			resp := &SSHStepUpRequestResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), resp))
+			// UpdatedAt is set to the current time.
+			assert.False(t, resp.UpdatedAt.Before(tc.want.CreatedAt))
+			resp.UpdatedAt = time.Time{}
+			assert.Equals(t, tc.want, resp)
+		})
+	}
+}
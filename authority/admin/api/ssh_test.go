@@ -0,0 +1,365 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+func TestSSHHostRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     SSHHostRequest
+		wantErr bool
+	}{
+		{"ok", SSHHostRequest{Hostname: "web1.example.com"}, false},
+		{"ok/tags", SSHHostRequest{Hostname: "web1.example.com", Tags: []admin.SSHHostTag{{Name: "env", Value: "prod"}, {Name: "role", Value: "web"}}}, false},
+		{"ok/empty value", SSHHostRequest{Hostname: "web1.example.com", Tags: []admin.SSHHostTag{{Name: "web"}}}, false},
+		{"fail/hostname", SSHHostRequest{}, true},
+		{"fail/hostname spaces", SSHHostRequest{Hostname: "web1 web2"}, true},
+		{"fail/hostname comma", SSHHostRequest{Hostname: "web1,web2"}, true},
+		{"fail/tag name", SSHHostRequest{Hostname: "web1.example.com", Tags: []admin.SSHHostTag{{Value: "prod"}}}, true},
+		{"fail/tag name equal", SSHHostRequest{Hostname: "web1.example.com", Tags: []admin.SSHHostTag{{Name: "env=prod"}}}, true},
+		{"fail/tag duplicated", SSHHostRequest{Hostname: "web1.example.com", Tags: []admin.SSHHostTag{{Name: "env", Value: "prod"}, {Name: "env", Value: "prod"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHHostRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateSSHHost(t *testing.T) {
+	existing := &admin.SSHHost{ID: "hostID", Hostname: "web1.example.com"}
+	type test struct {
+		ctx        context.Context
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		want       *admin.SSHHost
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read.JSON": func(t *testing.T) test {
+			return test{
+				ctx:        context.Background(),
+				body:       []byte("{!?}"),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
+					Message: "error reading request body: error decoding json: invalid character '!' looking for beginning of object key string",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				ctx:        context.Background(),
+				body:       []byte(`{"hostname":""}`),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
+					Message: "hostname cannot be empty",
+				},
+			}
+		},
+		"fail/not implemented": func(t *testing.T) test {
+			return test{
+				ctx:        context.Background(),
+				body:       []byte(`{"hostname":"web2.example.com"}`),
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    admin.ErrorNotImplementedType.String(),
+					Status:  501,
+					Detail:  "not implemented",
+					Message: "ssh host inventory is not supported by the admin database",
+				},
+			}
+		},
+		"fail/conflict": func(t *testing.T) test {
+			db := &admin.MockDB{
+				MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+					assert.Equals(t, "WEB1.example.com", hostname)
+					return existing, nil
+				},
+			}
+			return test{
+				ctx:        admin.NewContext(context.Background(), db),
+				body:       []byte(`{"hostname":"WEB1.example.com"}`),
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorConflictType.String(),
+					Status:  409,
+					Detail:  "conflict",
+					Message: "ssh host WEB1.example.com already exists",
+				},
+			}
+		},
+		"fail/db.GetSSHHostByHostname": func(t *testing.T) test {
+			db := &admin.MockDB{
+				MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+					return nil, errors.New("force")
+				},
+			}
+			return test{
+				ctx:        admin.NewContext(context.Background(), db),
+				body:       []byte(`{"hostname":"web2.example.com"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Detail:  "the server experienced an internal error",
+					Message: "error retrieving ssh host web2.example.com: force",
+				},
+			}
+		},
+		"fail/db.CreateSSHHost": func(t *testing.T) test {
+			db := &admin.MockDB{
+				MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+					return nil, admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", hostname)
+				},
+				MockCreateSSHHost: func(ctx context.Context, host *admin.SSHHost) error {
+					return errors.New("force")
+				},
+			}
+			return test{
+				ctx:        admin.NewContext(context.Background(), db),
+				body:       []byte(`{"hostname":"web2.example.com"}`),
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Status:  500,
+					Detail:  "the server experienced an internal error",
+					Message: "error storing ssh host: force",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			now := time.Now().UTC().Truncate(time.Second)
+			db := &admin.MockDB{
+				MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+					return nil, admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", hostname)
+				},
+				MockCreateSSHHost: func(ctx context.Context, host *admin.SSHHost) error {
+					assert.Equals(t, "web2.example.com", host.Hostname)
+					assert.Equals(t, []admin.SSHHostTag{{Name: "env", Value: "prod"}}, host.Tags)
+					host.ID = "newID"
+					host.CreatedAt = now
+					host.UpdatedAt = now
+					return nil
+				},
+			}
+			return test{
+				ctx:        admin.NewContext(context.Background(), db),
+				body:       []byte(`{"hostname":"web2.example.com","tags":[{"name":"env","value":"prod"}]}`),
+				statusCode: 201,
+				want: &admin.SSHHost{
+					ID:        "newID",
+					Hostname:  "web2.example.com",
+					Tags:      []admin.SSHHostTag{{Name: "env", Value: "prod"}},
+					CreatedAt: now,
+					UpdatedAt: now,
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			CreateSSHHost(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			host := &admin.SSHHost{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), host))
+			assert.Equals(t, tc.want, host)
+		})
+	}
+}
+
+func TestUpdateSSHHost(t *testing.T) {
+	type test struct {
+		ctx        context.Context
+		body       []byte
+		statusCode int
+		err        *admin.Error
+		want       *admin.SSHHost
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/conflict": func(t *testing.T) test {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "hostID")
+			db := &admin.MockDB{
+				MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+					return &admin.SSHHost{ID: "otherID", Hostname: "web2.example.com"}, nil
+				},
+			}
+			ctx := context.WithValue(admin.NewContext(context.Background(), db), chi.RouteCtxKey, chiCtx)
+			return test{
+				ctx:        ctx,
+				body:       []byte(`{"hostname":"web2.example.com"}`),
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorConflictType.String(),
+					Status:  409,
+					Detail:  "conflict",
+					Message: "ssh host web2.example.com already exists",
+				},
+			}
+		},
+		"fail/db.UpdateSSHHost": func(t *testing.T) test {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "hostID")
+			db := &admin.MockDB{
+				MockUpdateSSHHost: func(ctx context.Context, host *admin.SSHHost) error {
+					return admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", host.ID)
+				},
+			}
+			ctx := context.WithValue(admin.NewContext(context.Background(), db), chi.RouteCtxKey, chiCtx)
+			return test{
+				ctx:        ctx,
+				body:       []byte(`{"hostname":"web1.example.com"}`),
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Status:  404,
+					Detail:  "resource not found",
+					Message: "error updating ssh host hostID: ssh host hostID not found",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("id", "hostID")
+			db := &admin.MockDB{
+				MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+					return &admin.SSHHost{ID: "hostID", Hostname: "web1.example.com"}, nil
+				},
+				MockUpdateSSHHost: func(ctx context.Context, host *admin.SSHHost) error {
+					assert.Equals(t, "hostID", host.ID)
+					assert.Equals(t, "web1.example.com", host.Hostname)
+					assert.Equals(t, []admin.SSHHostTag{{Name: "env", Value: "dev"}}, host.Tags)
+					return nil
+				},
+			}
+			ctx := context.WithValue(admin.NewContext(context.Background(), db), chi.RouteCtxKey, chiCtx)
+			return test{
+				ctx:        ctx,
+				body:       []byte(`{"hostname":"web1.example.com","tags":[{"name":"env","value":"dev"}]}`),
+				statusCode: 200,
+				want: &admin.SSHHost{
+					ID:       "hostID",
+					Hostname: "web1.example.com",
+					Tags:     []admin.SSHHostTag{{Name: "env", Value: "dev"}},
+				},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/foo", io.NopCloser(bytes.NewBuffer(tc.body)))
+			req = req.WithContext(tc.ctx)
+			w := httptest.NewRecorder()
+			UpdateSSHHost(w, req)
+			res := w.Result()
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			host := &admin.SSHHost{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), host))
+			assert.Equals(t, tc.want, host)
+		})
+	}
+}
+
+func TestGetSSHHosts(t *testing.T) {
+	hosts := []*admin.SSHHost{
+		{ID: "hostID", Hostname: "web1.example.com", Tags: []admin.SSHHostTag{{Name: "env", Value: "prod"}}},
+	}
+	t.Run("fail/db.GetSSHHosts", func(t *testing.T) {
+		db := &admin.MockDB{MockError: errors.New("force")}
+		req := httptest.NewRequest("GET", "/foo", nil)
+		req = req.WithContext(admin.NewContext(context.Background(), db))
+		w := httptest.NewRecorder()
+		GetSSHHosts(w, req)
+		assert.Equals(t, 500, w.Result().StatusCode)
+	})
+	t.Run("ok", func(t *testing.T) {
+		db := &admin.MockDB{MockRet1: hosts}
+		req := httptest.NewRequest("GET", "/foo", nil)
+		req = req.WithContext(admin.NewContext(context.Background(), db))
+		w := httptest.NewRecorder()
+		GetSSHHosts(w, req)
+		res := w.Result()
+		assert.Equals(t, 200, res.StatusCode)
+
+		var resp GetSSHHostsResponse
+		assert.FatalError(t, json.NewDecoder(res.Body).Decode(&resp))
+		assert.Equals(t, hosts, resp.Hosts)
+	})
+}
+
+func TestDeleteSSHHost(t *testing.T) {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("id", "hostID")
+	db := &admin.MockDB{
+		MockDeleteSSHHost: func(ctx context.Context, id string) error {
+			assert.Equals(t, "hostID", id)
+			return nil
+		},
+	}
+	ctx := context.WithValue(admin.NewContext(context.Background(), db), chi.RouteCtxKey, chiCtx)
+	req := httptest.NewRequest("DELETE", "/foo", nil)
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+	DeleteSSHHost(w, req)
+	res := w.Result()
+	assert.Equals(t, 200, res.StatusCode)
+
+	var resp DeleteResponse
+	assert.FatalError(t, json.NewDecoder(res.Body).Decode(&resp))
+	assert.Equals(t, "ok", resp.Status)
+}
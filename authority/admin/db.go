@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.step.sm/linkedca"
@@ -76,6 +77,38 @@ type DB interface {
 	DeleteAuthorityPolicy(ctx context.Context) error
 }
 
+// SSHHostTag is a name and value pair assigned to a host in the SSH host
+// inventory. Users are authorized to access a host using its tags.
+type SSHHostTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// String returns the tag in the name=value format.
+func (t SSHHostTag) String() string {
+	return t.Name + "=" + t.Value
+}
+
+// SSHHost is a host in the SSH host inventory.
+type SSHHost struct {
+	ID        string       `json:"id"`
+	Hostname  string       `json:"hostname"`
+	Tags      []SSHHostTag `json:"tags"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// SSHHostDB is the interface implemented by the admin databases that support
+// an SSH host inventory.
+type SSHHostDB interface {
+	CreateSSHHost(ctx context.Context, host *SSHHost) error
+	GetSSHHost(ctx context.Context, id string) (*SSHHost, error)
+	GetSSHHostByHostname(ctx context.Context, hostname string) (*SSHHost, error)
+	GetSSHHosts(ctx context.Context) ([]*SSHHost, error)
+	UpdateSSHHost(ctx context.Context, host *SSHHost) error
+	DeleteSSHHost(ctx context.Context, id string) error
+}
+
 type dbKey struct{}
 
 // NewContext adds the given admin database to the context.
@@ -119,6 +152,13 @@ type MockDB struct {
 	MockUpdateAuthorityPolicy func(ctx context.Context, policy *linkedca.Policy) error
 	MockDeleteAuthorityPolicy func(ctx context.Context) error
 
+	MockCreateSSHHost        func(ctx context.Context, host *SSHHost) error
+	MockGetSSHHost           func(ctx context.Context, id string) (*SSHHost, error)
+	MockGetSSHHostByHostname func(ctx context.Context, hostname string) (*SSHHost, error)
+	MockGetSSHHosts          func(ctx context.Context) ([]*SSHHost, error)
+	MockUpdateSSHHost        func(ctx context.Context, host *SSHHost) error
+	MockDeleteSSHHost        func(ctx context.Context, id string) error
+
 	MockError error
 	MockRet1  interface{}
 }
@@ -244,3 +284,60 @@ func (m *MockDB) DeleteAuthorityPolicy(ctx context.Context) error {
 	}
 	return m.MockError
 }
+
+// CreateSSHHost mock
+func (m *MockDB) CreateSSHHost(ctx context.Context, host *SSHHost) error {
+	if m.MockCreateSSHHost != nil {
+		return m.MockCreateSSHHost(ctx, host)
+	}
+	return m.MockError
+}
+
+// GetSSHHost mock
+func (m *MockDB) GetSSHHost(ctx context.Context, id string) (*SSHHost, error) {
+	if m.MockGetSSHHost != nil {
+		return m.MockGetSSHHost(ctx, id)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	host, _ := m.MockRet1.(*SSHHost)
+	return host, nil
+}
+
+// GetSSHHostByHostname mock
+func (m *MockDB) GetSSHHostByHostname(ctx context.Context, hostname string) (*SSHHost, error) {
+	if m.MockGetSSHHostByHostname != nil {
+		return m.MockGetSSHHostByHostname(ctx, hostname)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	host, _ := m.MockRet1.(*SSHHost)
+	return host, nil
+}
+
+// GetSSHHosts mock
+func (m *MockDB) GetSSHHosts(ctx context.Context) ([]*SSHHost, error) {
+	if m.MockGetSSHHosts != nil {
+		return m.MockGetSSHHosts(ctx)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	hosts, _ := m.MockRet1.([]*SSHHost)
+	return hosts, nil
+}
+
+// UpdateSSHHost mock
+func (m *MockDB) UpdateSSHHost(ctx context.Context, host *SSHHost) error {
+	if m.MockUpdateSSHHost != nil {
+		return m.MockUpdateSSHHost(ctx, host)
+	}
+	return m.MockError
+}
+
+// DeleteSSHHost mock
+func (m *MockDB) DeleteSSHHost(ctx context.Context, id string) error {
+	if m.MockDeleteSSHHost != nil {
+		return m.MockDeleteSSHHost(ctx, id)
+	}
+	return m.MockError
+}
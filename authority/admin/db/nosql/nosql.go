@@ -14,6 +14,8 @@ var (
 	adminsTable            = []byte("admins")
 	provisionersTable      = []byte("provisioners")
 	authorityPoliciesTable = []byte("authority_policies")
+	sshHostsTable          = []byte("ssh_hosts")
+	sshHostnamesTable      = []byte("ssh_hostnames")
 )
 
 // DB is a struct that implements the AdminDB interface.
@@ -24,7 +26,7 @@ type DB struct {
 
 // New configures and returns a new Authority DB backend implemented using a nosql DB.
 func New(db nosqlDB.DB, authorityID string) (*DB, error) {
-	tables := [][]byte{adminsTable, provisionersTable, authorityPoliciesTable}
+	tables := [][]byte{adminsTable, provisionersTable, authorityPoliciesTable, sshHostsTable, sshHostnamesTable}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
 			return nil, errors.Wrapf(err, "error creating table %s",
@@ -0,0 +1,231 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/nosql"
+)
+
+// dbSSHHost is the database representation of a host in the SSH host
+// inventory.
+type dbSSHHost struct {
+	ID          string             `json:"id"`
+	AuthorityID string             `json:"authorityID"`
+	Hostname    string             `json:"hostname"`
+	Tags        []admin.SSHHostTag `json:"tags"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+	DeletedAt   time.Time          `json:"deletedAt"`
+}
+
+func (dbh *dbSSHHost) convert() *admin.SSHHost {
+	return &admin.SSHHost{
+		ID:        dbh.ID,
+		Hostname:  dbh.Hostname,
+		Tags:      dbh.Tags,
+		CreatedAt: dbh.CreatedAt,
+		UpdatedAt: dbh.UpdatedAt,
+	}
+}
+
+func (dbh *dbSSHHost) clone() *dbSSHHost {
+	u := *dbh
+	return &u
+}
+
+func (db *DB) unmarshalDBSSHHost(data []byte, id string) (*dbSSHHost, error) {
+	var dbh = new(dbSSHHost)
+	if err := json.Unmarshal(data, dbh); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh host %s into dbSSHHost", id)
+	}
+	if !dbh.DeletedAt.IsZero() {
+		return nil, admin.NewError(admin.ErrorDeletedType, "ssh host %s is deleted", id)
+	}
+	if dbh.AuthorityID != db.authorityID {
+		return nil, admin.NewError(admin.ErrorAuthorityMismatchType,
+			"ssh host %s is not owned by authority %s", dbh.ID, db.authorityID)
+	}
+	return dbh, nil
+}
+
+func (db *DB) getDBSSHHost(ctx context.Context, id string) (*dbSSHHost, error) {
+	data, err := db.db.Get(sshHostsTable, []byte(id))
+	if nosql.IsErrNotFound(err) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", id)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh host %s", id)
+	}
+	return db.unmarshalDBSSHHost(data, id)
+}
+
+// sshHostnameKey returns the key in the hostname index of the given hostname.
+// Hostnames are unique per authority regardless of the case.
+func (db *DB) sshHostnameKey(hostname string) []byte {
+	return []byte(db.authorityID + "/" + strings.ToLower(hostname))
+}
+
+// indexSSHHostname adds the hostname of the host with the given id to the
+// hostname index. It returns a conflict error if another host uses it.
+func (db *DB) indexSSHHostname(id, hostname string) error {
+	_, swapped, err := db.db.CmpAndSwap(sshHostnamesTable, db.sshHostnameKey(hostname), nil, []byte(id))
+	switch {
+	case err != nil:
+		return errors.Wrapf(err, "error indexing ssh host %s", hostname)
+	case !swapped:
+		return admin.NewError(admin.ErrorConflictType, "ssh host %s already exists", hostname)
+	default:
+		return nil
+	}
+}
+
+// unindexSSHHostname removes the hostname from the hostname index if it
+// belongs to the host with the given id.
+func (db *DB) unindexSSHHostname(id, hostname string) error {
+	key := db.sshHostnameKey(hostname)
+	b, err := db.db.Get(sshHostnamesTable, key)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil
+	case err != nil:
+		return errors.Wrapf(err, "error loading ssh hostname %s", hostname)
+	case string(b) != id:
+		return nil
+	}
+	if err := db.db.Del(sshHostnamesTable, key); err != nil {
+		return errors.Wrapf(err, "error deleting ssh hostname %s", hostname)
+	}
+	return nil
+}
+
+// GetSSHHost retrieves and unmarshals an SSH host from the database.
+func (db *DB) GetSSHHost(ctx context.Context, id string) (*admin.SSHHost, error) {
+	dbh, err := db.getDBSSHHost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return dbh.convert(), nil
+}
+
+// GetSSHHostByHostname retrieves the SSH host with the given hostname using
+// the hostname index. Hostnames are compared regardless of the case.
+func (db *DB) GetSSHHostByHostname(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+	id, err := db.db.Get(sshHostnamesTable, db.sshHostnameKey(hostname))
+	if nosql.IsErrNotFound(err) {
+		return nil, admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", hostname)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error loading ssh hostname %s", hostname)
+	}
+	dbh, err := db.getDBSSHHost(ctx, string(id))
+	if err != nil {
+		return nil, err
+	}
+	return dbh.convert(), nil
+}
+
+// GetSSHHosts retrieves and unmarshals all active (not deleted) SSH hosts
+// from the database.
+func (db *DB) GetSSHHosts(ctx context.Context) ([]*admin.SSHHost, error) {
+	dbEntries, err := db.db.List(sshHostsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading ssh hosts")
+	}
+	var hosts = []*admin.SSHHost{}
+	for _, entry := range dbEntries {
+		dbh, err := db.unmarshalDBSSHHost(entry.Value, string(entry.Key))
+		if err != nil {
+			var ae *admin.Error
+			if errors.As(err, &ae) && (ae.IsType(admin.ErrorDeletedType) || ae.IsType(admin.ErrorAuthorityMismatchType)) {
+				continue
+			}
+			return nil, err
+		}
+		hosts = append(hosts, dbh.convert())
+	}
+	return hosts, nil
+}
+
+// CreateSSHHost stores a new SSH host to the database.
+func (db *DB) CreateSSHHost(ctx context.Context, host *admin.SSHHost) error {
+	var err error
+	host.ID, err = randID()
+	if err != nil {
+		return admin.WrapErrorISE(err, "error generating random id for ssh host")
+	}
+	host.CreatedAt = clock.Now()
+	host.UpdatedAt = host.CreatedAt
+
+	dbh := &dbSSHHost{
+		ID:          host.ID,
+		AuthorityID: db.authorityID,
+		Hostname:    host.Hostname,
+		Tags:        host.Tags,
+		CreatedAt:   host.CreatedAt,
+		UpdatedAt:   host.UpdatedAt,
+	}
+
+	if err := db.indexSSHHostname(dbh.ID, dbh.Hostname); err != nil {
+		return err
+	}
+	if err := db.save(ctx, dbh.ID, dbh, nil, "ssh_host", sshHostsTable); err != nil {
+		_ = db.unindexSSHHostname(dbh.ID, dbh.Hostname)
+		return err
+	}
+	return nil
+}
+
+// UpdateSSHHost saves an updated SSH host to the database. Only the hostname
+// and the tags can be updated.
+func (db *DB) UpdateSSHHost(ctx context.Context, host *admin.SSHHost) error {
+	old, err := db.getDBSSHHost(ctx, host.ID)
+	if err != nil {
+		return err
+	}
+
+	nu := old.clone()
+	nu.Hostname = host.Hostname
+	nu.Tags = host.Tags
+	nu.UpdatedAt = clock.Now()
+
+	renamed := !strings.EqualFold(old.Hostname, nu.Hostname)
+	if renamed {
+		if err := db.indexSSHHostname(nu.ID, nu.Hostname); err != nil {
+			return err
+		}
+	}
+	if err := db.save(ctx, old.ID, nu, old, "ssh_host", sshHostsTable); err != nil {
+		if renamed {
+			_ = db.unindexSSHHostname(nu.ID, nu.Hostname)
+		}
+		return err
+	}
+	if renamed {
+		if err := db.unindexSSHHostname(old.ID, old.Hostname); err != nil {
+			return err
+		}
+	}
+
+	host.CreatedAt = nu.CreatedAt
+	host.UpdatedAt = nu.UpdatedAt
+	return nil
+}
+
+// DeleteSSHHost marks an SSH host as deleted in the database.
+func (db *DB) DeleteSSHHost(ctx context.Context, id string) error {
+	old, err := db.getDBSSHHost(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	nu := old.clone()
+	nu.DeletedAt = clock.Now()
+
+	if err := db.save(ctx, old.ID, nu, old, "ssh_host", sshHostsTable); err != nil {
+		return err
+	}
+	return db.unindexSSHHostname(old.ID, old.Hostname)
+}
@@ -0,0 +1,382 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	nosqldb "github.com/smallstep/nosql/database"
+)
+
+func TestDB_GetSSHHost(t *testing.T) {
+	hostID := "hostID"
+	now := clock.Now()
+	type test struct {
+		db       nosql.DB
+		err      error
+		adminErr *admin.Error
+		want     *admin.SSHHost
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, sshHostsTable)
+						assert.Equals(t, string(key), hostID)
+						return nil, nosqldb.ErrNotFound
+					},
+				},
+				adminErr: admin.NewError(admin.ErrorNotFoundType, "ssh host hostID not found"),
+			}
+		},
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error loading ssh host hostID: force"),
+			}
+		},
+		"fail/deleted": func(t *testing.T) test {
+			data, err := json.Marshal(&dbSSHHost{ID: hostID, AuthorityID: admin.DefaultAuthorityID, Hostname: "web1", DeletedAt: now})
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return data, nil
+					},
+				},
+				adminErr: admin.NewError(admin.ErrorDeletedType, "ssh host hostID is deleted"),
+			}
+		},
+		"fail/authority-mismatch": func(t *testing.T) test {
+			data, err := json.Marshal(&dbSSHHost{ID: hostID, AuthorityID: "foo", Hostname: "web1"})
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return data, nil
+					},
+				},
+				adminErr: admin.NewError(admin.ErrorAuthorityMismatchType, "ssh host hostID is not owned by authority %s", admin.DefaultAuthorityID),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			tags := []admin.SSHHostTag{{Name: "env", Value: "prod"}}
+			data, err := json.Marshal(&dbSSHHost{ID: hostID, AuthorityID: admin.DefaultAuthorityID, Hostname: "web1", Tags: tags, CreatedAt: now, UpdatedAt: now})
+			assert.FatalError(t, err)
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return data, nil
+					},
+				},
+				want: &admin.SSHHost{ID: hostID, Hostname: "web1", Tags: tags, CreatedAt: now, UpdatedAt: now},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db, authorityID: admin.DefaultAuthorityID}
+			got, err := d.GetSSHHost(context.Background(), hostID)
+			switch {
+			case tc.adminErr != nil:
+				var ae *admin.Error
+				if assert.True(t, errors.As(err, &ae)) {
+					assert.Equals(t, ae.Type, tc.adminErr.Type)
+					assert.Equals(t, ae.Err.Error(), tc.adminErr.Err.Error())
+				}
+			case tc.err != nil:
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			default:
+				assert.FatalError(t, err)
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHHosts(t *testing.T) {
+	now := clock.Now()
+	marshal := func(t *testing.T, h *dbSSHHost) []byte {
+		data, err := json.Marshal(h)
+		assert.FatalError(t, err)
+		return data
+	}
+
+	t.Run("fail/db.List-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+				return nil, errors.New("force")
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		_, err := d.GetSSHHosts(context.Background())
+		assert.Equals(t, "error loading ssh hosts: force", err.Error())
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+				assert.Equals(t, bucket, sshHostsTable)
+				return []*nosqldb.Entry{
+					{Key: []byte("a"), Value: marshal(t, &dbSSHHost{ID: "a", AuthorityID: admin.DefaultAuthorityID, Hostname: "web1", CreatedAt: now, UpdatedAt: now})},
+					{Key: []byte("b"), Value: marshal(t, &dbSSHHost{ID: "b", AuthorityID: admin.DefaultAuthorityID, Hostname: "web2", DeletedAt: now})},
+					{Key: []byte("c"), Value: marshal(t, &dbSSHHost{ID: "c", AuthorityID: "foo", Hostname: "web3"})},
+				}, nil
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		hosts, err := d.GetSSHHosts(context.Background())
+		assert.FatalError(t, err)
+		assert.Equals(t, []*admin.SSHHost{{ID: "a", Hostname: "web1", CreatedAt: now, UpdatedAt: now}}, hosts)
+	})
+}
+
+func TestDB_GetSSHHostByHostname(t *testing.T) {
+	now := clock.Now()
+	data, err := json.Marshal(&dbSSHHost{ID: "hostID", AuthorityID: admin.DefaultAuthorityID, Hostname: "web1", CreatedAt: now, UpdatedAt: now})
+	assert.FatalError(t, err)
+
+	t.Run("fail/not-found", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, sshHostnamesTable)
+				assert.Equals(t, admin.DefaultAuthorityID+"/web1", string(key))
+				return nil, nosqldb.ErrNotFound
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		_, err := d.GetSSHHostByHostname(context.Background(), "WEB1")
+		var ae *admin.Error
+		if assert.True(t, errors.As(err, &ae)) {
+			assert.True(t, ae.IsType(admin.ErrorNotFoundType))
+		}
+	})
+
+	t.Run("fail/db.Get-error", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("force")
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		_, err := d.GetSSHHostByHostname(context.Background(), "web1")
+		assert.Equals(t, "error loading ssh hostname web1: force", err.Error())
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				switch string(bucket) {
+				case string(sshHostnamesTable):
+					return []byte("hostID"), nil
+				case string(sshHostsTable):
+					assert.Equals(t, "hostID", string(key))
+					return data, nil
+				default:
+					return nil, errors.New("unexpected bucket")
+				}
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		host, err := d.GetSSHHostByHostname(context.Background(), "web1")
+		assert.FatalError(t, err)
+		assert.Equals(t, &admin.SSHHost{ID: "hostID", Hostname: "web1", CreatedAt: now, UpdatedAt: now}, host)
+	})
+}
+
+func TestDB_CreateSSHHost(t *testing.T) {
+	tags := []admin.SSHHostTag{{Name: "env", Value: "prod"}}
+	t.Run("fail/conflict", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, sshHostnamesTable)
+				return []byte("otherID"), false, nil
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		err := d.CreateSSHHost(context.Background(), &admin.SSHHost{Hostname: "web1", Tags: tags})
+		var ae *admin.Error
+		if assert.True(t, errors.As(err, &ae)) {
+			assert.True(t, ae.IsType(admin.ErrorConflictType))
+		}
+	})
+
+	t.Run("fail/save-error", func(t *testing.T) {
+		var indexed []byte
+		var deleted bool
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				if string(bucket) == string(sshHostnamesTable) {
+					indexed = nu
+					return nu, true, nil
+				}
+				return nil, false, errors.New("force")
+			},
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, sshHostnamesTable)
+				return indexed, nil
+			},
+			MDel: func(bucket, key []byte) error {
+				deleted = true
+				return nil
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		err := d.CreateSSHHost(context.Background(), &admin.SSHHost{Hostname: "web1", Tags: tags})
+		assert.Equals(t, "error saving authority ssh_host: force", err.Error())
+		// The hostname is removed from the index.
+		assert.True(t, deleted)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var saved dbSSHHost
+		var indexed string
+		d := DB{db: &db.MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+				assert.Nil(t, old)
+				if string(bucket) == string(sshHostnamesTable) {
+					assert.Equals(t, admin.DefaultAuthorityID+"/web1", string(key))
+					indexed = string(nu)
+					return nu, true, nil
+				}
+				assert.Equals(t, bucket, sshHostsTable)
+				assert.FatalError(t, json.Unmarshal(nu, &saved))
+				assert.Equals(t, string(key), saved.ID)
+				return nu, true, nil
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		host := &admin.SSHHost{Hostname: "Web1", Tags: tags}
+		assert.FatalError(t, d.CreateSSHHost(context.Background(), host))
+		assert.NotEquals(t, "", host.ID)
+		assert.False(t, host.CreatedAt.IsZero())
+		assert.Equals(t, host.ID, indexed)
+		assert.Equals(t, dbSSHHost{
+			ID:          host.ID,
+			AuthorityID: admin.DefaultAuthorityID,
+			Hostname:    "Web1",
+			Tags:        tags,
+			CreatedAt:   host.CreatedAt,
+			UpdatedAt:   host.UpdatedAt,
+		}, saved)
+	})
+}
+
+func TestDB_UpdateSSHHost(t *testing.T) {
+	createdAt := clock.Now().Add(-time.Hour)
+	old := &dbSSHHost{ID: "hostID", AuthorityID: admin.DefaultAuthorityID, Hostname: "web1", CreatedAt: createdAt, UpdatedAt: createdAt}
+	oldData, err := json.Marshal(old)
+	assert.FatalError(t, err)
+
+	t.Run("fail/conflict", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return oldData, nil
+			},
+			MCmpAndSwap: func(bucket, key, o, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, sshHostnamesTable)
+				return []byte("otherID"), false, nil
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		err := d.UpdateSSHHost(context.Background(), &admin.SSHHost{ID: "hostID", Hostname: "web2"})
+		var ae *admin.Error
+		if assert.True(t, errors.As(err, &ae)) {
+			assert.True(t, ae.IsType(admin.ErrorConflictType))
+		}
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		var saved dbSSHHost
+		var indexed, deleted []string
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				if string(bucket) == string(sshHostnamesTable) {
+					return []byte("hostID"), nil
+				}
+				return oldData, nil
+			},
+			MCmpAndSwap: func(bucket, key, o, nu []byte) ([]byte, bool, error) {
+				if string(bucket) == string(sshHostnamesTable) {
+					assert.Nil(t, o)
+					assert.Equals(t, "hostID", string(nu))
+					indexed = append(indexed, string(key))
+					return nu, true, nil
+				}
+				assert.Equals(t, bucket, sshHostsTable)
+				assert.Equals(t, string(key), "hostID")
+				assert.Equals(t, oldData, o)
+				assert.FatalError(t, json.Unmarshal(nu, &saved))
+				return nu, true, nil
+			},
+			MDel: func(bucket, key []byte) error {
+				assert.Equals(t, bucket, sshHostnamesTable)
+				deleted = append(deleted, string(key))
+				return nil
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+
+		tags := []admin.SSHHostTag{{Name: "env", Value: "dev"}}
+		host := &admin.SSHHost{ID: "hostID", Hostname: "web2", Tags: tags}
+		assert.FatalError(t, d.UpdateSSHHost(context.Background(), host))
+		assert.Equals(t, "web2", saved.Hostname)
+		assert.Equals(t, tags, saved.Tags)
+		assert.Equals(t, createdAt, saved.CreatedAt)
+		assert.True(t, saved.UpdatedAt.After(createdAt))
+		assert.Equals(t, createdAt, host.CreatedAt)
+		assert.Equals(t, saved.UpdatedAt, host.UpdatedAt)
+		assert.Equals(t, []string{admin.DefaultAuthorityID + "/web2"}, indexed)
+		assert.Equals(t, []string{admin.DefaultAuthorityID + "/web1"}, deleted)
+	})
+
+	t.Run("ok/same hostname", func(t *testing.T) {
+		d := DB{db: &db.MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return oldData, nil
+			},
+			MCmpAndSwap: func(bucket, key, o, nu []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, sshHostsTable)
+				return nu, true, nil
+			},
+			MDel: func(bucket, key []byte) error {
+				return errors.New("unexpected delete")
+			},
+		}, authorityID: admin.DefaultAuthorityID}
+		assert.FatalError(t, d.UpdateSSHHost(context.Background(), &admin.SSHHost{ID: "hostID", Hostname: "WEB1"}))
+	})
+}
+
+func TestDB_DeleteSSHHost(t *testing.T) {
+	old := &dbSSHHost{ID: "hostID", AuthorityID: admin.DefaultAuthorityID, Hostname: "web1"}
+	oldData, err := json.Marshal(old)
+	assert.FatalError(t, err)
+
+	var saved dbSSHHost
+	var deleted string
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if string(bucket) == string(sshHostnamesTable) {
+				return []byte("hostID"), nil
+			}
+			return oldData, nil
+		},
+		MCmpAndSwap: func(bucket, key, o, nu []byte) ([]byte, bool, error) {
+			assert.FatalError(t, json.Unmarshal(nu, &saved))
+			return nu, true, nil
+		},
+		MDel: func(bucket, key []byte) error {
+			assert.Equals(t, bucket, sshHostnamesTable)
+			deleted = string(key)
+			return nil
+		},
+	}, authorityID: admin.DefaultAuthorityID}
+
+	assert.FatalError(t, d.DeleteSSHHost(context.Background(), "hostID"))
+	assert.False(t, saved.DeletedAt.IsZero())
+	assert.Equals(t, admin.DefaultAuthorityID+"/web1", deleted)
+}
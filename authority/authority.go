@@ -87,6 +87,20 @@ type Authority struct {
 	constraintsEngine *constraints.Engine
 	policyEngine      *policy.Engine
 
+	// CRL generator
+	crlTicker  *time.Ticker
+	crlStopper chan struct{}
+	crlMutex   sync.Mutex
+
+	// SSH key revocation list generator
+	sshKRLMutex sync.Mutex
+
+	// OCSP responder
+	ocspResponder *ocspResponder
+
+	// Nebula CA
+	nebulaCA *nebulaCA
+
 	adminMutex sync.RWMutex
 
 	// Do Not initialize the authority
@@ -441,6 +455,7 @@ func (a *Authority) init() error {
 	// Decrypt and load SSH keys
 	var tmplVars templates.Step
 	if a.config.SSH != nil {
+		tmplVars.SSH.RevokedKeys = a.config.SSH.RevokedKeys
 		if a.config.SSH.HostKey != "" {
 			signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
 				SigningKey: a.config.SSH.HostKey,
@@ -652,6 +667,28 @@ func (a *Authority) init() error {
 		a.templates.Data["Step"] = tmplVars
 	}
 
+	// Start the CRL generator, the configuration has already been validated.
+	if a.config.CRL.IsEnabled() {
+		if err := a.startCRLGenerator(); err != nil {
+			return err
+		}
+	}
+
+	// Initialize the OCSP responder, the configuration has already been
+	// validated.
+	if a.config.OCSP.IsEnabled() {
+		if err := a.initOCSPResponder(); err != nil {
+			return err
+		}
+	}
+
+	// Load the Nebula CA, the configuration has already been validated.
+	if a.config.Nebula.IsEnabled() {
+		if err := a.initNebulaCA(); err != nil {
+			return err
+		}
+	}
+
 	// JWT numeric dates are seconds.
 	a.startTime = time.Now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
@@ -710,6 +747,7 @@ func (a *Authority) IsAdminAPIEnabled() bool {
 
 // Shutdown safely shuts down any clients, databases, etc. held by the Authority.
 func (a *Authority) Shutdown() error {
+	a.stopCRLGenerator()
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
@@ -718,6 +756,7 @@ func (a *Authority) Shutdown() error {
 
 // CloseForReload closes internal services, to allow a safe reload.
 func (a *Authority) CloseForReload() {
+	a.stopCRLGenerator()
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
@@ -739,6 +778,90 @@ func (a *Authority) IsRevoked(sn string) (bool, error) {
 	return a.db.IsRevoked(sn)
 }
 
+// isRevokedFunc returns whether the leaf certificate of the given verified
+// chain has been revoked. Only the certificates issued by the authority, with a
+// chain to one of its roots, are in the revocation database, other CAs might
+// use the same serial numbers.
+func (a *Authority) isRevokedFunc(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+	if len(chain) == 0 || !a.isRoot(chain[len(chain)-1]) {
+		return false, nil
+	}
+	return a.IsRevoked(chain[0].SerialNumber.String())
+}
+
+// isRoot returns whether the given certificate is one of the roots of the
+// authority.
+func (a *Authority) isRoot(crt *x509.Certificate) bool {
+	for _, root := range a.rootX509Certs {
+		if bytes.Equal(root.Raw, crt.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldRotate returns whether or not a certificate should be renewed as soon
+// as possible because it was not issued by the current intermediate, e.g.
+// after the intermediate has been rotated.
+func (a *Authority) ShouldRotate(crt *x509.Certificate) bool {
+	if len(a.intermediateX509Certs) == 0 || len(crt.AuthorityKeyId) == 0 {
+		return false
+	}
+	issuer := a.intermediateX509Certs[0]
+	return len(issuer.SubjectKeyId) > 0 && !bytes.Equal(crt.AuthorityKeyId, issuer.SubjectKeyId)
+}
+
+// startCRLGenerator generates a new certificate revocation list and starts a
+// goroutine that will regenerate it periodically before it expires.
+func (a *Authority) startCRLGenerator() error {
+	if err := a.GenerateCertificateRevocationList(); err != nil {
+		return errors.Wrap(err, "error generating certificate revocation list")
+	}
+
+	// By default the CRL is regenerated after 2/3 of its validity.
+	renewPeriod := a.crlCacheDuration() * 2 / 3
+	if v := a.config.CRL.RenewPeriod; v != nil && v.Duration > 0 {
+		renewPeriod = v.Duration
+	}
+
+	a.crlStopper = make(chan struct{})
+	a.crlTicker = time.NewTicker(renewPeriod)
+	go func(ticker *time.Ticker, stopper chan struct{}) {
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.GenerateCertificateRevocationList(); err != nil {
+					log.Printf("error generating certificate revocation list: %v", err)
+				}
+			case <-stopper:
+				return
+			}
+		}
+	}(a.crlTicker, a.crlStopper)
+
+	return nil
+}
+
+// stopCRLGenerator stops the goroutine that regenerates the certificate
+// revocation list.
+func (a *Authority) stopCRLGenerator() {
+	if a.crlTicker != nil {
+		a.crlTicker.Stop()
+		close(a.crlStopper)
+		a.crlTicker = nil
+		a.crlStopper = nil
+	}
+}
+
+// crlCacheDuration returns the validity of a generated certificate revocation
+// list.
+func (a *Authority) crlCacheDuration() time.Duration {
+	if v := a.config.CRL.CacheDuration; v != nil && v.Duration > 0 {
+		return v.Duration
+	}
+	return config.DefaultCRLCacheDuration.Duration
+}
+
 // requiresDecrypter returns whether the Authority
 // requires a KMS that provides a crypto.Decrypter
 // Currently this is only required when SCEP is
@@ -1,10 +1,12 @@
 package authority
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"net"
 	"os"
@@ -18,6 +20,8 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/pemutil"
 )
 
@@ -450,3 +454,98 @@ func TestAuthority_GetID(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_ShouldRotate(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	rotated, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:  []string{"leaf.example.com"},
+		PublicKey: signer.Public(),
+	})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name          string
+		intermediates []*x509.Certificate
+		crt           *x509.Certificate
+		want          bool
+	}{
+		{"ok", []*x509.Certificate{ca.Intermediate}, leaf, false},
+		{"ok rotated", []*x509.Certificate{rotated.Intermediate}, leaf, true},
+		{"ok no intermediates", nil, leaf, false},
+		{"ok no authority key id", []*x509.Certificate{rotated.Intermediate}, &x509.Certificate{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{intermediateX509Certs: tt.intermediates}
+			if got := a.ShouldRotate(tt.crt); got != tt.want {
+				t.Errorf("Authority.ShouldRotate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthority_isRevokedFunc(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	other, err := minica.New()
+	assert.FatalError(t, err)
+	signer, err := keyutil.GenerateDefaultSigner()
+	assert.FatalError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:  []string{"leaf.example.com"},
+		PublicKey: signer.Public(),
+	})
+	assert.FatalError(t, err)
+	// A certificate issued by another CA with the same serial number.
+	otherLeaf, err := other.Sign(&x509.Certificate{
+		SerialNumber: leaf.SerialNumber,
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:     []string{"leaf.example.com"},
+		PublicKey:    signer.Public(),
+	})
+	assert.FatalError(t, err)
+
+	revokedDB := &db.MockAuthDB{
+		MIsRevoked: func(sn string) (bool, error) {
+			return sn == leaf.SerialNumber.String(), nil
+		},
+	}
+	failDB := &db.MockAuthDB{
+		MIsRevoked: func(sn string) (bool, error) {
+			return false, errors.New("force")
+		},
+	}
+
+	tests := []struct {
+		name    string
+		db      db.AuthDB
+		chain   []*x509.Certificate
+		want    bool
+		wantErr bool
+	}{
+		{"ok revoked", revokedDB, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}, true, false},
+		{"ok other ca", revokedDB, []*x509.Certificate{otherLeaf, other.Intermediate, other.Root}, false, false},
+		{"ok other ca error", failDB, []*x509.Certificate{otherLeaf, other.Intermediate, other.Root}, false, false},
+		{"ok empty chain", revokedDB, nil, false, false},
+		{"fail", failDB, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{db: tt.db, rootX509Certs: []*x509.Certificate{ca.Root}}
+			got, err := a.isRevokedFunc(context.Background(), tt.chain)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.isRevokedFunc() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Authority.isRevokedFunc() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
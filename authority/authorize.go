@@ -239,6 +239,12 @@ func (a *Authority) Authorize(ctx context.Context, token string) ([]provisioner.
 		}
 		_, signOpts, err := a.authorizeSSHRekey(ctx, token)
 		return signOpts, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
+	case provisioner.NebulaSignMethod:
+		if a.nebulaCA == nil {
+			return nil, errs.NotImplemented("authority.Authorize; nebula certificate flows are not enabled", opts...)
+		}
+		signOpts, err := a.authorizeNebulaSign(ctx, token)
+		return signOpts, errs.Wrap(http.StatusInternalServerError, err, "authority.Authorize", opts...)
 	default:
 		return nil, errs.InternalServer("authority.Authorize; method %d is not supported", append([]interface{}{m}, opts...)...)
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"time"
 
@@ -35,6 +36,15 @@ var (
 	// DefaultEnableSSHCA enable SSH CA features per provisioner or globally
 	// for all provisioners.
 	DefaultEnableSSHCA = false
+	// DefaultCRLCacheDuration is the default validity of a certificate
+	// revocation list.
+	DefaultCRLCacheDuration = &provisioner.Duration{Duration: 24 * time.Hour}
+	// DefaultOCSPCacheDuration is the default validity of a signed OCSP
+	// response.
+	DefaultOCSPCacheDuration = &provisioner.Duration{Duration: time.Hour}
+	// DefaultOCSPResponderDuration is the default validity of a delegated OCSP
+	// responder certificate.
+	DefaultOCSPResponderDuration = &provisioner.Duration{Duration: 24 * time.Hour}
 	// GlobalProvisionerClaims default claims for the Authority. Can be overridden
 	// by provisioner specific claims.
 	GlobalProvisionerClaims = provisioner.Claims{
@@ -72,6 +82,9 @@ type Config struct {
 	Password         string               `json:"password,omitempty"`
 	Templates        *templates.Templates `json:"templates,omitempty"`
 	CommonName       string               `json:"commonName,omitempty"`
+	CRL              *CRLConfig           `json:"crl,omitempty"`
+	OCSP             *OCSPConfig          `json:"ocsp,omitempty"`
+	Nebula           *NebulaConfig        `json:"nebula,omitempty"`
 	SkipValidation   bool                 `json:"-"`
 }
 
@@ -88,6 +101,136 @@ type ASN1DN struct {
 	CommonName         string `json:"commonName,omitempty"`
 }
 
+// CRLConfig represents the configuration options used to generate the
+// certificate revocation list (CRL).
+//
+// CacheDuration is the validity of a generated CRL, defaults to 24h. RenewPeriod
+// is the period used to generate a new CRL, it must be lower than the
+// CacheDuration and defaults to 2/3 of it. If GenerateOnRevoke is set, a new
+// CRL will be generated after each revocation. If DistributionPoint is set,
+// issued certificates will include it in the CRL distribution points
+// extension.
+type CRLConfig struct {
+	Enabled           bool                  `json:"enabled"`
+	GenerateOnRevoke  bool                  `json:"generateOnRevoke,omitempty"`
+	CacheDuration     *provisioner.Duration `json:"cacheDuration,omitempty"`
+	RenewPeriod       *provisioner.Duration `json:"renewPeriod,omitempty"`
+	DistributionPoint string                `json:"distributionPoint,omitempty"`
+}
+
+// IsEnabled returns if the CRL generation is enabled.
+func (c *CRLConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Validate validates the CRL configuration.
+func (c *CRLConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.CacheDuration != nil && c.CacheDuration.Duration < 0 {
+		return errors.New("crl.cacheDuration must be greater than or equal to 0")
+	}
+
+	if c.RenewPeriod != nil && c.RenewPeriod.Duration < 0 {
+		return errors.New("crl.renewPeriod must be greater than or equal to 0")
+	}
+
+	if c.RenewPeriod != nil && c.CacheDuration != nil &&
+		c.RenewPeriod.Duration > c.CacheDuration.Duration {
+		return errors.New("crl.cacheDuration must be greater than or equal to crl.renewPeriod")
+	}
+
+	if c.DistributionPoint != "" {
+		if u, err := url.Parse(c.DistributionPoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("crl.distributionPoint %s is not a valid url", c.DistributionPoint)
+		}
+	}
+
+	return nil
+}
+
+// OCSPConfig represents the configuration options of the OCSP responder.
+//
+// CacheDuration is the validity of a signed OCSP response, defaults to 1h. If
+// Delegated is set, responses will be signed by an OCSP signing certificate
+// issued by the intermediate at startup, ResponderDuration is the validity of
+// that certificate and defaults to 24h, it will be renewed before any response
+// outlives it. If not set, responses will be signed directly by the
+// intermediate. If ResponderURL is set, issued certificates will include it in
+// the authority information access extension.
+type OCSPConfig struct {
+	Enabled           bool                  `json:"enabled"`
+	Delegated         bool                  `json:"delegated,omitempty"`
+	CacheDuration     *provisioner.Duration `json:"cacheDuration,omitempty"`
+	ResponderDuration *provisioner.Duration `json:"responderDuration,omitempty"`
+	ResponderURL      string                `json:"responderURL,omitempty"`
+}
+
+// IsEnabled returns if the OCSP responder is enabled.
+func (c *OCSPConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Validate validates the OCSP configuration.
+func (c *OCSPConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if c.CacheDuration != nil && c.CacheDuration.Duration < 0 {
+		return errors.New("ocsp.cacheDuration must be greater than or equal to 0")
+	}
+
+	if c.ResponderDuration != nil && c.ResponderDuration.Duration < 0 {
+		return errors.New("ocsp.responderDuration must be greater than or equal to 0")
+	}
+
+	if c.ResponderDuration != nil && c.CacheDuration != nil &&
+		c.ResponderDuration.Duration > 0 && c.ResponderDuration.Duration < c.CacheDuration.Duration {
+		return errors.New("ocsp.responderDuration must be greater than or equal to ocsp.cacheDuration")
+	}
+
+	if c.ResponderURL != "" {
+		if u, err := url.Parse(c.ResponderURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("ocsp.responderURL %s is not a valid url", c.ResponderURL)
+		}
+	}
+
+	return nil
+}
+
+// NebulaConfig represents the configuration of the Nebula CA used to sign
+// Nebula certificates.
+//
+// Certificate is the path to the PEM encoded Nebula CA certificate, and Key is
+// the Ed25519 key of that certificate, it can be a file or a KMS URI. The key
+// is decrypted using the authority password.
+type NebulaConfig struct {
+	Certificate string `json:"crt"`
+	Key         string `json:"key"`
+}
+
+// IsEnabled returns if the signing of Nebula certificates is enabled.
+func (c *NebulaConfig) IsEnabled() bool {
+	return c != nil
+}
+
+// Validate validates the Nebula configuration.
+func (c *NebulaConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Certificate == "":
+		return errors.New("nebula.crt cannot be empty")
+	case c.Key == "":
+		return errors.New("nebula.key cannot be empty")
+	default:
+		return nil
+	}
+}
+
 // AuthConfig represents the configuration options for the authority. An
 // underlaying registration authority can also be configured using the
 // cas.Options.
@@ -146,6 +289,10 @@ func (c *AuthConfig) Validate(audiences provisioner.Audiences) error {
 		return errors.New("authority.backdate cannot be less than 0")
 	}
 
+	if err := c.Policy.GetSSHOptions().GetPermissions().Validate(); err != nil {
+		return errors.Wrap(err, "authority.policy.ssh.permissions is not valid")
+	}
+
 	return nil
 }
 
@@ -269,6 +416,21 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate crl config: nil is ok
+	if err := c.CRL.Validate(); err != nil {
+		return err
+	}
+
+	// Validate ocsp config: nil is ok
+	if err := c.OCSP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate nebula config: nil is ok
+	if err := c.Nebula.Validate(); err != nil {
+		return err
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
@@ -277,11 +439,12 @@ func (c *Config) Validate() error {
 // front so we cannot rely on the port.
 func (c *Config) GetAudiences() provisioner.Audiences {
 	audiences := provisioner.Audiences{
-		Sign:      []string{legacyAuthority},
-		Revoke:    []string{legacyAuthority},
-		SSHSign:   []string{},
-		SSHRevoke: []string{},
-		SSHRenew:  []string{},
+		Sign:       []string{legacyAuthority},
+		Revoke:     []string{legacyAuthority},
+		SSHSign:    []string{},
+		SSHRevoke:  []string{},
+		SSHRenew:   []string{},
+		NebulaSign: []string{},
 	}
 
 	for _, name := range c.DNSNames {
@@ -311,6 +474,9 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 		audiences.SSHRekey = append(audiences.SSHRekey,
 			fmt.Sprintf("https://%s/1.0/ssh/rekey", hostname),
 			fmt.Sprintf("https://%s/ssh/rekey", hostname))
+		audiences.NebulaSign = append(audiences.NebulaSign,
+			fmt.Sprintf("https://%s/1.0/nebula/sign", hostname),
+			fmt.Sprintf("https://%s/nebula/sign", hostname))
 	}
 
 	return audiences
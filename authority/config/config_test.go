@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	_ "github.com/smallstep/certificates/cas"
 	"go.step.sm/crypto/jose"
@@ -287,6 +289,23 @@ func TestAuthConfigValidate(t *testing.T) {
 				asn1dn: asn1dn,
 			}
 		},
+		"fail-ssh-permissions": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Policy: &policy.Options{
+						SSH: &policy.SSHPolicyOptions{
+							Permissions: &policy.SSHPermissionsOptions{
+								CriticalOptions: map[string]*policy.SSHPermissionOptions{
+									"source-address": {FromRemoteAddress: true, FromClaim: "ip"},
+								},
+							},
+						},
+					},
+				},
+				err: errors.New(`authority.policy.ssh.permissions is not valid: critical option "source-address" cannot have both fromRemoteAddress and fromClaim`),
+			}
+		},
 	}
 
 	for name, get := range tests {
@@ -360,3 +379,110 @@ func TestConfig_Audience(t *testing.T) {
 		})
 	}
 }
+
+func TestCRLConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		crl     *CRLConfig
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &CRLConfig{}, false},
+		{"ok", &CRLConfig{
+			Enabled:           true,
+			CacheDuration:     &provisioner.Duration{Duration: 24 * time.Hour},
+			RenewPeriod:       &provisioner.Duration{Duration: 16 * time.Hour},
+			DistributionPoint: "https://ca.example.com/1.0/crl",
+		}, false},
+		{"fail cacheDuration", &CRLConfig{
+			Enabled:       true,
+			CacheDuration: &provisioner.Duration{Duration: -1},
+		}, true},
+		{"fail renewPeriod", &CRLConfig{
+			Enabled:     true,
+			RenewPeriod: &provisioner.Duration{Duration: -1},
+		}, true},
+		{"fail renewPeriod > cacheDuration", &CRLConfig{
+			Enabled:       true,
+			CacheDuration: &provisioner.Duration{Duration: time.Hour},
+			RenewPeriod:   &provisioner.Duration{Duration: 2 * time.Hour},
+		}, true},
+		{"fail distributionPoint", &CRLConfig{
+			Enabled:           true,
+			DistributionPoint: "/1.0/crl",
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.crl.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CRLConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOCSPConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ocsp    *OCSPConfig
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok empty", &OCSPConfig{}, false},
+		{"ok", &OCSPConfig{
+			Enabled:           true,
+			Delegated:         true,
+			CacheDuration:     &provisioner.Duration{Duration: time.Hour},
+			ResponderDuration: &provisioner.Duration{Duration: 24 * time.Hour},
+			ResponderURL:      "https://ca.example.com/1.0/ocsp",
+		}, false},
+		{"fail cacheDuration", &OCSPConfig{
+			Enabled:       true,
+			CacheDuration: &provisioner.Duration{Duration: -1},
+		}, true},
+		{"fail responderDuration", &OCSPConfig{
+			Enabled:           true,
+			ResponderDuration: &provisioner.Duration{Duration: -1},
+		}, true},
+		{"fail responderDuration < cacheDuration", &OCSPConfig{
+			Enabled:           true,
+			CacheDuration:     &provisioner.Duration{Duration: 2 * time.Hour},
+			ResponderDuration: &provisioner.Duration{Duration: time.Hour},
+		}, true},
+		{"fail responderURL", &OCSPConfig{
+			Enabled:      true,
+			ResponderURL: "/1.0/ocsp",
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.ocsp.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("OCSPConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNebulaConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		nebula  *NebulaConfig
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &NebulaConfig{
+			Certificate: "testdata/nebula_ca.crt",
+			Key:         "awskms:key-id=1234",
+		}, false},
+		{"fail empty", &NebulaConfig{}, true},
+		{"fail crt", &NebulaConfig{Key: "testdata/nebula_ca.key"}, true},
+		{"fail key", &NebulaConfig{Certificate: "testdata/nebula_ca.crt"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.nebula.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("NebulaConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ type SSHConfig struct {
 	AddUserPrincipal string          `json:"addUserPrincipal,omitempty"`
 	AddUserCommand   string          `json:"addUserCommand,omitempty"`
 	Bastion          *Bastion        `json:"bastion,omitempty"`
+	RevokedKeys      string          `json:"revokedKeys,omitempty"`
 }
 
 // Bastion contains the custom properties used on bastion.
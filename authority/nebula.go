@@ -0,0 +1,214 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	nebula "github.com/slackhq/nebula/cert"
+	"google.golang.org/protobuf/proto"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// nebulaCA contains the Nebula CA certificate and the signer used to sign
+// Nebula certificates.
+type nebulaCA struct {
+	certificate *nebula.NebulaCertificate
+	fingerprint string
+	signer      crypto.Signer
+}
+
+// initNebulaCA loads the Nebula CA certificate and creates the signer with the
+// configured key.
+func (a *Authority) initNebulaCA() error {
+	b, err := os.ReadFile(a.config.Nebula.Certificate)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", a.config.Nebula.Certificate)
+	}
+	crt, _, err := nebula.UnmarshalNebulaCertificateFromPEM(b)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing %s", a.config.Nebula.Certificate)
+	}
+	if !crt.Details.IsCA {
+		return errors.Errorf("nebula certificate %s is not a CA", a.config.Nebula.Certificate)
+	}
+	fp, err := crt.Sha256Sum()
+	if err != nil {
+		return errors.Wrap(err, "error calculating nebula certificate fingerprint")
+	}
+
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.Nebula.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return err
+	}
+	if pub, ok := signer.Public().(ed25519.PublicKey); !ok || !bytes.Equal(pub, crt.Details.PublicKey) {
+		return errors.New("nebula key does not match the nebula certificate")
+	}
+
+	a.nebulaCA = &nebulaCA{
+		certificate: crt,
+		fingerprint: fp,
+		signer:      signer,
+	}
+	return nil
+}
+
+// authorizeNebulaSign loads the provisioner from the token and calls the
+// provisioner AuthorizeNebulaSign method.
+func (a *Authority) authorizeNebulaSign(ctx context.Context, token string) ([]provisioner.SignOption, error) {
+	p, err := a.authorizeToken(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeNebulaSign")
+	}
+	np, ok := p.(interface {
+		AuthorizeNebulaSign(ctx context.Context, token string) ([]provisioner.SignOption, error)
+	})
+	if !ok {
+		return nil, errs.Unauthorized("authority.authorizeNebulaSign: provisioner '%s' does not support nebula certificates", p.GetName())
+	}
+	signOpts, err := np.AuthorizeNebulaSign(ctx, token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "authority.authorizeNebulaSign")
+	}
+	return signOpts, nil
+}
+
+// SignNebula creates a Nebula certificate for the given X25519 public key,
+// signed by the Nebula CA.
+func (a *Authority) SignNebula(ctx context.Context, key []byte, opts provisioner.SignNebulaOptions, signOpts ...provisioner.SignOption) (*nebula.NebulaCertificate, error) {
+	if a.nebulaCA == nil {
+		return nil, errs.NotImplemented("authority.SignNebula: nebula certificate signing is not enabled")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errs.BadRequest("nebula public key must be an X25519 key")
+	}
+
+	var (
+		prov       provisioner.Interface
+		mods       []provisioner.NebulaCertModifier
+		validators []provisioner.NebulaCertValidator
+	)
+	for _, op := range signOpts {
+		switch o := op.(type) {
+		// add the provisioner to store it with the certificate
+		case provisioner.Interface:
+			prov = o
+
+		// modify the nebula.NebulaCertificate
+		case provisioner.NebulaCertModifier:
+			mods = append(mods, o)
+
+		// validate the nebula.NebulaCertificate
+		case provisioner.NebulaCertValidator:
+			validators = append(validators, o)
+
+		default:
+			return nil, errs.InternalServer("authority.SignNebula: invalid extra option type %T", o)
+		}
+	}
+
+	crt := &nebula.NebulaCertificate{
+		Details: nebula.NebulaCertificateDetails{
+			Subnets:   []*net.IPNet{},
+			PublicKey: key,
+			Issuer:    a.nebulaCA.fingerprint,
+		},
+	}
+	if err := opts.Modify(crt, opts); err != nil {
+		return nil, err
+	}
+
+	// Use provisioner modifiers.
+	for _, m := range mods {
+		if err := m.Modify(crt, opts); err != nil {
+			return nil, errs.ForbiddenErr(err, "error creating nebula certificate")
+		}
+	}
+
+	// Nebula certificates use seconds, and they cannot outlive the CA.
+	crt.Details.NotBefore = crt.Details.NotBefore.Truncate(time.Second)
+	crt.Details.NotAfter = crt.Details.NotAfter.Truncate(time.Second)
+	if crt.Details.NotAfter.After(a.nebulaCA.certificate.Details.NotAfter) {
+		crt.Details.NotAfter = a.nebulaCA.certificate.Details.NotAfter
+	}
+	if err := crt.CheckRootConstrains(a.nebulaCA.certificate); err != nil {
+		return nil, errs.ForbiddenErr(err, "error creating nebula certificate")
+	}
+
+	// User provisioners validators.
+	for _, v := range validators {
+		if err := v.Valid(crt, opts); err != nil {
+			return nil, errs.ForbiddenErr(err, "error validating nebula certificate")
+		}
+	}
+
+	if err := signNebulaCertificate(crt, a.nebulaCA.signer); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignNebula: error signing certificate")
+	}
+	if !crt.CheckSignature(a.nebulaCA.certificate.Details.PublicKey) {
+		return nil, errs.InternalServer("authority.SignNebula: error signing certificate: signature does not match")
+	}
+
+	if err := a.storeNebulaCertificate(prov, crt); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignNebula: error storing certificate in db")
+	}
+
+	return crt, nil
+}
+
+func (a *Authority) storeNebulaCertificate(prov provisioner.Interface, crt *nebula.NebulaCertificate) error {
+	// Store certificate in admindb or linkedca
+	if s, ok := a.adminDB.(db.NebulaCertificateStorer); ok {
+		return s.StoreNebulaCertificate(prov, crt)
+	}
+
+	// Store certificate in localdb
+	if s, ok := a.db.(db.NebulaCertificateStorer); ok {
+		return s.StoreNebulaCertificate(prov, crt)
+	}
+	return nil
+}
+
+// signNebulaCertificate signs the details of the given Nebula certificate.
+// NebulaCertificate.Sign requires an ed25519.PrivateKey, this method signs the
+// same protobuf encoded details using a crypto.Signer so the key can be in a
+// KMS.
+func signNebulaCertificate(crt *nebula.NebulaCertificate, signer crypto.Signer) error {
+	crt.Signature = nil
+	b, err := crt.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "error marshaling nebula certificate")
+	}
+	var raw nebula.RawNebulaCertificate
+	if err := proto.Unmarshal(b, &raw); err != nil {
+		return errors.Wrap(err, "error unmarshaling nebula certificate")
+	}
+	details, err := proto.Marshal(raw.Details)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling nebula certificate details")
+	}
+	sig, err := signer.Sign(rand.Reader, details, crypto.Hash(0))
+	if err != nil {
+		return err
+	}
+	crt.Signature = sig
+	return nil
+}
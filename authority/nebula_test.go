@@ -0,0 +1,294 @@
+package authority
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	nebula "github.com/slackhq/nebula/cert"
+
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x25519"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+func mustNebulaIPNet(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	ip, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipNet.IP = ip.To4()
+	return ipNet
+}
+
+func mustNebulaCA(t *testing.T, isCA bool) (*nebula.NebulaCertificate, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	crt := &nebula.NebulaCertificate{
+		Details: nebula.NebulaCertificateDetails{
+			Name:           "Nebula CA",
+			Ips:            []*net.IPNet{mustNebulaIPNet(t, "10.1.0.0/16")},
+			Subnets:        []*net.IPNet{},
+			Groups:         []string{"servers", "admins"},
+			InvertedGroups: map[string]struct{}{"servers": {}, "admins": {}},
+			NotBefore:      now.Add(-time.Minute),
+			NotAfter:       now.Add(24 * time.Hour),
+			PublicKey:      pub,
+			IsCA:           isCA,
+		},
+	}
+	if err := crt.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	return crt, priv
+}
+
+func mustNebulaAuthority(t *testing.T) (*Authority, *nebula.NebulaCertificate) {
+	t.Helper()
+	crt, priv := mustNebulaCA(t, true)
+	fp, err := crt.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testAuthority(t)
+	a.nebulaCA = &nebulaCA{
+		certificate: crt,
+		fingerprint: fp,
+		signer:      priv,
+	}
+	return a, crt
+}
+
+type nebulaTestModifier func(*nebula.NebulaCertificate)
+
+func (m nebulaTestModifier) Modify(crt *nebula.NebulaCertificate, _ provisioner.SignNebulaOptions) error {
+	m(crt)
+	return nil
+}
+
+type nebulaTestValidator func(*nebula.NebulaCertificate) error
+
+func (v nebulaTestValidator) Valid(crt *nebula.NebulaCertificate, _ provisioner.SignNebulaOptions) error {
+	return v(crt)
+}
+
+func TestAuthority_initNebulaCA(t *testing.T) {
+	dir := t.TempDir()
+	writeCA := func(t *testing.T, name string, isCA bool) (string, string) {
+		crt, priv := mustNebulaCA(t, isCA)
+		b, err := crt.MarshalToPEM()
+		assert.FatalError(t, err)
+		crtFile := filepath.Join(dir, name+".crt")
+		keyFile := filepath.Join(dir, name+".key")
+		assert.FatalError(t, os.WriteFile(crtFile, b, 0600))
+		_, err = pemutil.Serialize(priv, pemutil.WithPKCS8(true), pemutil.WithPassword([]byte("pass")), pemutil.ToFile(keyFile, 0600))
+		assert.FatalError(t, err)
+		return crtFile, keyFile
+	}
+
+	caCrt, caKey := writeCA(t, "ca", true)
+	leafCrt, leafKey := writeCA(t, "leaf", false)
+	_, otherKey := writeCA(t, "other", true)
+
+	tests := []struct {
+		name    string
+		config  *config.NebulaConfig
+		wantErr bool
+	}{
+		{"ok", &config.NebulaConfig{Certificate: caCrt, Key: caKey}, false},
+		{"fail missing", &config.NebulaConfig{Certificate: filepath.Join(dir, "missing.crt"), Key: caKey}, true},
+		{"fail parse", &config.NebulaConfig{Certificate: caKey, Key: caKey}, true},
+		{"fail not ca", &config.NebulaConfig{Certificate: leafCrt, Key: leafKey}, true},
+		{"fail key", &config.NebulaConfig{Certificate: caCrt, Key: filepath.Join(dir, "missing.key")}, true},
+		{"fail key mismatch", &config.NebulaConfig{Certificate: caCrt, Key: otherKey}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.config.Nebula = tt.config
+			err := a.initNebulaCA()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.initNebulaCA() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.NotNil(t, a.nebulaCA)
+				assert.NotNil(t, a.nebulaCA.signer)
+			}
+		})
+	}
+}
+
+func TestAuthority_SignNebula(t *testing.T) {
+	a, ca := mustNebulaAuthority(t)
+	caFingerprint, err := ca.Sha256Sum()
+	assert.FatalError(t, err)
+	pub, _, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	opts := provisioner.SignNebulaOptions{
+		Name:   "host.example.com",
+		IPs:    []string{"10.1.0.10/16"},
+		Groups: []string{"servers"},
+	}
+	validity := nebulaTestModifier(func(crt *nebula.NebulaCertificate) {
+		crt.Details.NotBefore = time.Now()
+		crt.Details.NotAfter = crt.Details.NotBefore.Add(time.Hour)
+	})
+
+	type args struct {
+		key      []byte
+		opts     provisioner.SignNebulaOptions
+		signOpts []provisioner.SignOption
+	}
+	tests := []struct {
+		name      string
+		authority *Authority
+		args      args
+		code      int
+		wantErr   bool
+	}{
+		{"ok", a, args{pub, opts, []provisioner.SignOption{validity}}, 0, false},
+		{"ok with validator", a, args{pub, opts, []provisioner.SignOption{validity, nebulaTestValidator(func(crt *nebula.NebulaCertificate) error {
+			if crt.Details.Name != "host.example.com" {
+				return errs.Forbidden("bad name")
+			}
+			return nil
+		})}}, 0, false},
+		{"ok capped", a, args{pub, opts, []provisioner.SignOption{nebulaTestModifier(func(crt *nebula.NebulaCertificate) {
+			crt.Details.NotBefore = time.Now()
+			crt.Details.NotAfter = crt.Details.NotBefore.Add(48 * time.Hour)
+		})}}, 0, false},
+		{"fail not enabled", testAuthority(t), args{pub, opts, []provisioner.SignOption{validity}}, http.StatusNotImplemented, true},
+		{"fail options", a, args{pub, provisioner.SignNebulaOptions{Name: "host.example.com"}, []provisioner.SignOption{validity}}, http.StatusBadRequest, true},
+		{"fail key", a, args{[]byte("foo"), opts, []provisioner.SignOption{validity}}, http.StatusBadRequest, true},
+		{"fail sign option", a, args{pub, opts, []provisioner.SignOption{"foo"}}, http.StatusInternalServerError, true},
+		{"fail ca ips", a, args{pub, provisioner.SignNebulaOptions{Name: "host.example.com", IPs: []string{"10.2.0.10/16"}}, []provisioner.SignOption{validity}}, http.StatusForbidden, true},
+		{"fail ca groups", a, args{pub, provisioner.SignNebulaOptions{Name: "host.example.com", IPs: []string{"10.1.0.10/16"}, Groups: []string{"other"}}, []provisioner.SignOption{validity}}, http.StatusForbidden, true},
+		{"fail validator", a, args{pub, opts, []provisioner.SignOption{validity, nebulaTestValidator(func(crt *nebula.NebulaCertificate) error {
+			return errs.Forbidden("bad name")
+		})}}, http.StatusForbidden, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.authority.SignNebula(context.Background(), tt.args.key, tt.args.opts, tt.args.signOpts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.SignNebula() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.code, sc.StatusCode())
+				}
+				return
+			}
+
+			pool, err := nebula.NewCAPoolFromBytes(mustNebulaPEM(t, ca))
+			assert.FatalError(t, err)
+			valid, err := got.Verify(time.Now(), pool)
+			assert.FatalError(t, err)
+			assert.True(t, valid)
+			assert.Equals(t, caFingerprint, got.Details.Issuer)
+			assert.Equals(t, "host.example.com", got.Details.Name)
+			assert.Equals(t, []byte(pub), got.Details.PublicKey)
+			assert.Equals(t, "10.1.0.10/16", got.Details.Ips[0].String())
+			assert.False(t, got.Details.IsCA)
+			assert.False(t, got.Details.NotAfter.After(ca.Details.NotAfter))
+
+			// The certificate can be encoded and decoded.
+			b, err := got.Marshal()
+			assert.FatalError(t, err)
+			crt, err := nebula.UnmarshalNebulaCertificate(b)
+			assert.FatalError(t, err)
+			assert.True(t, crt.CheckSignature(ca.Details.PublicKey))
+		})
+	}
+}
+
+func mustNebulaPEM(t *testing.T, crt *nebula.NebulaCertificate) []byte {
+	t.Helper()
+	b, err := crt.MarshalToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestAuthority_Authorize_nebulaSign(t *testing.T) {
+	a := testAuthority(t)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.NebulaSignMethod)
+	_, err := a.Authorize(ctx, "foo")
+	assert.Error(t, err)
+	var sc render.StatusCodedError
+	if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+		assert.Equals(t, http.StatusNotImplemented, sc.StatusCode())
+	}
+
+	a, _ = mustNebulaAuthority(t)
+	_, err = a.Authorize(ctx, "foo")
+	assert.Error(t, err)
+	if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+		assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+	}
+}
+
+func TestAuthority_SignNebula_store(t *testing.T) {
+	pub, _, err := x25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	opts := provisioner.SignNebulaOptions{
+		Name: "host.example.com",
+		IPs:  []string{"10.1.0.10/16"},
+	}
+	validity := nebulaTestModifier(func(crt *nebula.NebulaCertificate) {
+		crt.Details.NotBefore = time.Now()
+		crt.Details.NotAfter = crt.Details.NotBefore.Add(time.Hour)
+	})
+	prov := &provisioner.Nebula{Name: "nebula"}
+
+	t.Run("ok", func(t *testing.T) {
+		a, _ := mustNebulaAuthority(t)
+		var stored *nebula.NebulaCertificate
+		a.db = &db.MockAuthDB{
+			MStoreNebulaCertificate: func(p provisioner.Interface, crt *nebula.NebulaCertificate) error {
+				assert.Equals(t, prov, p)
+				stored = crt
+				return nil
+			},
+		}
+		got, err := a.SignNebula(context.Background(), pub, opts, prov, validity)
+		assert.FatalError(t, err)
+		assert.Equals(t, got, stored)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		a, _ := mustNebulaAuthority(t)
+		a.db = &db.MockAuthDB{
+			MStoreNebulaCertificate: func(p provisioner.Interface, crt *nebula.NebulaCertificate) error {
+				return errors.New("force")
+			},
+		}
+		_, err := a.SignNebula(context.Background(), pub, opts, prov, validity)
+		assert.Error(t, err)
+		var sc render.StatusCodedError
+		if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+			assert.Equals(t, http.StatusInternalServerError, sc.StatusCode())
+		}
+	})
+}
@@ -0,0 +1,400 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+
+	"go.step.sm/crypto/keyutil"
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/authority/config"
+	casapi "github.com/smallstep/certificates/cas/apiv1"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+// oidExtensionOCSPNoCheck is the id-pkix-ocsp-nocheck extension, it indicates
+// that clients do not need to check the revocation status of a delegated OCSP
+// responder certificate.
+var oidExtensionOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// OCSPResponse is a DER encoded OCSP response signed by the authority.
+type OCSPResponse struct {
+	Raw        []byte
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	hash       crypto.Hash
+}
+
+// maxOCSPCacheSize is the maximum number of pre-signed OCSP responses cached.
+const maxOCSPCacheSize = 100000
+
+// ocspResponder contains the certificates and the signer used to sign OCSP
+// responses, and the cache of pre-signed responses indexed by serial number.
+type ocspResponder struct {
+	mutex       sync.RWMutex
+	issuer      *x509.Certificate
+	certificate *x509.Certificate
+	signer      crypto.Signer
+	responses   *ocspResponseCache
+}
+
+// ocspResponseCache is the cache of pre-signed OCSP responses. The revision is
+// incremented on every invalidation, so a response created while a
+// certificate was being revoked is not stored.
+type ocspResponseCache struct {
+	mu        sync.Mutex
+	revision  uint64
+	responses map[string]*OCSPResponse
+}
+
+func newOCSPResponseCache() *ocspResponseCache {
+	return &ocspResponseCache{
+		responses: make(map[string]*OCSPResponse),
+	}
+}
+
+// Load returns the cached response for the given serial number, and the
+// current revision of the cache.
+func (c *ocspResponseCache) Load(sn string) (*OCSPResponse, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.responses[sn]
+	return resp, c.revision, ok
+}
+
+// Store stores the response if the cache has not been invalidated since the
+// given revision. Expired responses are removed when the cache is full, and
+// the response is not stored if it is still full.
+func (c *ocspResponseCache) Store(sn string, resp *OCSPResponse, revision uint64, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revision != revision {
+		return false
+	}
+	if _, ok := c.responses[sn]; !ok && len(c.responses) >= maxOCSPCacheSize {
+		for k, v := range c.responses {
+			if !now.Before(v.reuseUntil()) {
+				delete(c.responses, k)
+			}
+		}
+		if len(c.responses) >= maxOCSPCacheSize {
+			return false
+		}
+	}
+	c.responses[sn] = resp
+	return true
+}
+
+// Delete removes the response for the given serial number and increments
+// the revision.
+func (c *ocspResponseCache) Delete(sn string) {
+	c.mu.Lock()
+	c.revision++
+	delete(c.responses, sn)
+	c.mu.Unlock()
+}
+
+// reuseUntil returns the time until a cached response is reused, half of its
+// validity.
+func (r *OCSPResponse) reuseUntil() time.Time {
+	return r.ThisUpdate.Add(r.NextUpdate.Sub(r.ThisUpdate) / 2)
+}
+
+// initOCSPResponder initializes the OCSP responder. If the responder is
+// delegated a new OCSP signing certificate will be issued, if not, responses
+// will be signed with the intermediate certificate and key.
+func (a *Authority) initOCSPResponder() error {
+	r := &ocspResponder{
+		responses: newOCSPResponseCache(),
+	}
+
+	if a.config.OCSP.Delegated {
+		issuer, crt, signer, err := a.issueOCSPResponderCertificate()
+		if err != nil {
+			return errors.Wrap(err, "error issuing ocsp responder certificate")
+		}
+		r.issuer, r.certificate, r.signer = issuer, crt, signer
+		a.ocspResponder = r
+		return nil
+	}
+
+	// It currently mirrors the logic for the x509CAService.
+	var err error
+	issuers := a.intermediateX509Certs
+	if len(issuers) == 0 && a.config.IntermediateCert != "" {
+		if issuers, err = pemutil.ReadCertificateBundle(a.config.IntermediateCert); err != nil {
+			return err
+		}
+	}
+	if len(issuers) == 0 || a.config.IntermediateKey == "" {
+		return errors.New("ocsp responder requires an intermediate certificate and key, or a delegated responder")
+	}
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: a.config.IntermediateKey,
+		Password:   a.password,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.issuer, r.certificate, r.signer = issuers[0], issuers[0], signer
+	a.ocspResponder = r
+	return nil
+}
+
+// issueOCSPResponderCertificate creates a new key and a delegated OCSP
+// responder certificate signed by the intermediate. It returns the issuer, the
+// responder certificate and its signer.
+func (a *Authority) issueOCSPResponderCertificate() (*x509.Certificate, *x509.Certificate, crypto.Signer, error) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cr, err := x509util.CreateCertificateRequest(a.config.CommonName+" OCSP Responder", nil, signer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	template, err := x509util.NewCertificate(cr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	now := time.Now()
+	lifetime := a.ocspResponderDuration()
+	certTpl := template.GetCertificate()
+	certTpl.NotBefore = now.Add(-1 * time.Minute)
+	certTpl.NotAfter = now.Add(lifetime)
+	certTpl.KeyUsage = x509.KeyUsageDigitalSignature
+	certTpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	certTpl.ExtraExtensions = append(certTpl.ExtraExtensions, pkix.Extension{
+		Id:    oidExtensionOCSPNoCheck,
+		Value: asn1.NullBytes,
+	})
+
+	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
+		Template: certTpl,
+		CSR:      cr,
+		Lifetime: lifetime,
+		Backdate: 1 * time.Minute,
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(resp.CertificateChain) == 0 {
+		return nil, nil, nil, errors.New("certificate authority service did not return the certificate chain")
+	}
+
+	return resp.CertificateChain[0], resp.Certificate, signer, nil
+}
+
+// getOCSPSigner returns the issuer, the responder certificate, and the signer
+// used to sign OCSP responses. A delegated responder certificate is renewed if
+// a response created now would outlive it.
+func (a *Authority) getOCSPSigner(now time.Time, cacheDuration time.Duration) (*x509.Certificate, *x509.Certificate, crypto.Signer, error) {
+	r := a.ocspResponder
+	r.mutex.RLock()
+	issuer, crt, signer := r.issuer, r.certificate, r.signer
+	r.mutex.RUnlock()
+
+	if !a.config.OCSP.Delegated || now.Add(cacheDuration).Before(crt.NotAfter) {
+		return issuer, crt, signer, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// The certificate might have been renewed by another request.
+	if now.Add(cacheDuration).Before(r.certificate.NotAfter) {
+		return r.issuer, r.certificate, r.signer, nil
+	}
+
+	issuer, crt, signer, err := a.issueOCSPResponderCertificate()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error renewing ocsp responder certificate")
+	}
+	r.issuer, r.certificate, r.signer = issuer, crt, signer
+	return issuer, crt, signer, nil
+}
+
+// GetOCSPResponse returns a signed OCSP response with the status of the
+// certificate in the given request. Responses for good and revoked
+// certificates are cached and reused until they reach half of their validity.
+func (a *Authority) GetOCSPResponse(req *ocsp.Request) (*OCSPResponse, error) {
+	if !a.config.OCSP.IsEnabled() || a.ocspResponder == nil {
+		return nil, errs.NotFound("authority.GetOCSPResponse; ocsp responder is not enabled")
+	}
+	if req == nil || req.SerialNumber == nil || !req.HashAlgorithm.Available() {
+		return nil, errs.BadRequest("authority.GetOCSPResponse; ocsp request is not valid")
+	}
+
+	now := time.Now().Truncate(time.Second).UTC()
+	cacheDuration := a.ocspCacheDuration()
+	issuer, responder, signer, err := a.getOCSPSigner(now, cacheDuration)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+	if !matchesOCSPIssuer(req, issuer) {
+		return nil, errs.Unauthorized("authority.GetOCSPResponse; ocsp request is not for a certificate issued by this authority")
+	}
+
+	sn := req.SerialNumber.String()
+	cached, revision, ok := a.ocspResponder.responses.Load(sn)
+	if ok && cached.hash == req.HashAlgorithm && now.Before(cached.reuseUntil()) {
+		return cached, nil
+	}
+
+	template := ocsp.Response{
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(cacheDuration),
+		IssuerHash:   req.HashAlgorithm,
+	}
+	if a.config.OCSP.Delegated {
+		template.Certificate = responder
+	}
+
+	isRevoked, err := a.IsRevoked(sn)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+	}
+	if isRevoked {
+		// If the revocation information is not available, for example, if the
+		// certificate has been revoked in linkedca, the time of the response
+		// is used.
+		template.Status = ocsp.Revoked
+		template.RevokedAt = now
+		if statusDB, ok := a.db.(db.CertificateStatusDB); ok {
+			rci, err := statusDB.GetRevokedCertificate(sn)
+			switch {
+			case err == nil:
+				template.RevokedAt = rci.RevokedAt
+				template.RevocationReason = rci.ReasonCode
+			case !nosql.IsErrNotFound(err):
+				return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+			}
+		}
+	} else {
+		isIssued, err := a.isCertificateIssued(sn)
+		switch {
+		case errors.Is(err, db.ErrNotImplemented):
+			return nil, errs.NotImplemented("authority.GetOCSPResponse; no persistence layer configured")
+		case err != nil:
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse")
+		case isIssued:
+			template.Status = ocsp.Good
+		default:
+			template.Status = ocsp.Unknown
+		}
+	}
+
+	der, err := ocsp.CreateResponse(issuer, responder, template, signer)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetOCSPResponse; error creating ocsp response")
+	}
+
+	resp := &OCSPResponse{
+		Raw:        der,
+		ThisUpdate: template.ThisUpdate,
+		NextUpdate: template.NextUpdate,
+		hash:       req.HashAlgorithm,
+	}
+
+	// Do not cache unknown certificates, anyone can request them. The response
+	// is not cached if the certificate has been revoked since the status was
+	// read.
+	if template.Status != ocsp.Unknown {
+		a.ocspResponder.responses.Store(sn, resp, revision, now)
+	}
+
+	return resp, nil
+}
+
+// invalidateOCSPResponse removes the cached OCSP response for the given serial
+// number.
+func (a *Authority) invalidateOCSPResponse(sn string) {
+	if a.ocspResponder != nil {
+		a.ocspResponder.responses.Delete(sn)
+	}
+}
+
+// isCertificateIssued returns whether a certificate with the given serial
+// number has been issued by the authority.
+func (a *Authority) isCertificateIssued(sn string) (bool, error) {
+	// The certificate data is stored for signed certificates, but renewed
+	// certificates are only stored in the certificates table.
+	if statusDB, ok := a.db.(db.CertificateStatusDB); ok {
+		_, err := statusDB.GetCertificateData(sn)
+		if err == nil {
+			return true, nil
+		}
+		if !nosql.IsErrNotFound(err) {
+			return false, err
+		}
+	}
+	if _, err := a.db.GetCertificate(sn); err != nil {
+		if nosql.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ocspCacheDuration returns the validity of a signed OCSP response.
+func (a *Authority) ocspCacheDuration() time.Duration {
+	if v := a.config.OCSP.CacheDuration; v != nil && v.Duration > 0 {
+		return v.Duration
+	}
+	return config.DefaultOCSPCacheDuration.Duration
+}
+
+// ocspResponderDuration returns the validity of a delegated OCSP responder
+// certificate. It is always longer than the validity of a response, so the
+// certificate does not need to be renewed with every request.
+func (a *Authority) ocspResponderDuration() time.Duration {
+	d := config.DefaultOCSPResponderDuration.Duration
+	if v := a.config.OCSP.ResponderDuration; v != nil && v.Duration > 0 {
+		d = v.Duration
+	}
+	if cacheDuration := a.ocspCacheDuration(); d <= cacheDuration {
+		d = 2 * cacheDuration
+	}
+	return d
+}
+
+// matchesOCSPIssuer returns whether the issuer name and key hashes in the OCSP
+// request correspond to the given issuer.
+func matchesOCSPIssuer(req *ocsp.Request, issuer *x509.Certificate) bool {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	if !bytes.Equal(h.Sum(nil), req.IssuerKeyHash) {
+		return false
+	}
+
+	h.Reset()
+	h.Write(issuer.RawSubject)
+	return bytes.Equal(h.Sum(nil), req.IssuerNameHash)
+}
@@ -0,0 +1,292 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql/database"
+)
+
+func mustOCSPLeaf(t *testing.T, ca *minica.CA) *x509.Certificate {
+	t.Helper()
+	signer, err := keyutil.GenerateDefaultSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:  []string{"leaf.example.com"},
+		PublicKey: signer.Public(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt
+}
+
+func mustOCSPRequest(t *testing.T, crt, issuer *x509.Certificate) *ocsp.Request {
+	t.Helper()
+	b, err := ocsp.CreateRequest(crt, issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := ocsp.ParseRequest(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestAuthority_GetOCSPResponse(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := mustOCSPLeaf(t, ca)
+	otherLeaf := mustOCSPLeaf(t, otherCA)
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+
+	badRequest := mustOCSPRequest(t, leaf, ca.Intermediate)
+	badRequest.SerialNumber = nil
+
+	type fields struct {
+		ocsp *config.OCSPConfig
+		db   db.AuthDB
+	}
+	tests := []struct {
+		name          string
+		fields        fields
+		req           *ocsp.Request
+		wantStatus    int
+		wantReason    int
+		wantRevokedAt time.Time
+		wantErrStatus int
+	}{
+		{"ok good", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				assert.Equals(t, leaf.SerialNumber.String(), sn)
+				return false, nil
+			},
+			MGetCertificateData: func(sn string) (*db.CertificateData, error) {
+				return &db.CertificateData{}, nil
+			},
+		}}, mustOCSPRequest(t, leaf, ca.Intermediate), ocsp.Good, 0, time.Time{}, 0},
+		{"ok good renewed", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				return false, nil
+			},
+			MGetCertificateData: func(sn string) (*db.CertificateData, error) {
+				return nil, database.ErrNotFound
+			},
+			MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				return leaf, nil
+			},
+		}}, mustOCSPRequest(t, leaf, ca.Intermediate), ocsp.Good, 0, time.Time{}, 0},
+		{"ok unknown", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				return false, nil
+			},
+			MGetCertificateData: func(sn string) (*db.CertificateData, error) {
+				return nil, database.ErrNotFound
+			},
+			MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				return nil, database.ErrNotFound
+			},
+		}}, mustOCSPRequest(t, leaf, ca.Intermediate), ocsp.Unknown, 0, time.Time{}, 0},
+		{"ok revoked", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				return true, nil
+			},
+			MGetRevokedCertificate: func(sn string) (*db.RevokedCertificateInfo, error) {
+				return &db.RevokedCertificateInfo{Serial: sn, ReasonCode: ocsp.KeyCompromise, RevokedAt: revokedAt}, nil
+			},
+		}}, mustOCSPRequest(t, leaf, ca.Intermediate), ocsp.Revoked, ocsp.KeyCompromise, revokedAt, 0},
+		{"fail disabled", fields{nil, &db.MockAuthDB{}}, mustOCSPRequest(t, leaf, ca.Intermediate), 0, 0, time.Time{}, http.StatusNotFound},
+		{"fail request", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{}}, badRequest, 0, 0, time.Time{}, http.StatusBadRequest},
+		{"fail issuer", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{}}, mustOCSPRequest(t, otherLeaf, otherCA.Intermediate), 0, 0, time.Time{}, http.StatusUnauthorized},
+		{"fail isRevoked", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				return false, errors.New("force")
+			},
+		}}, mustOCSPRequest(t, leaf, ca.Intermediate), 0, 0, time.Time{}, http.StatusInternalServerError},
+		{"fail getCertificate", fields{&config.OCSPConfig{Enabled: true}, &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				return false, nil
+			},
+			MGetCertificateData: func(sn string) (*db.CertificateData, error) {
+				return nil, database.ErrNotFound
+			},
+			MGetCertificate: func(sn string) (*x509.Certificate, error) {
+				return nil, errors.New("force")
+			},
+		}}, mustOCSPRequest(t, leaf, ca.Intermediate), 0, 0, time.Time{}, http.StatusInternalServerError},
+		{"fail database", fields{&config.OCSPConfig{Enabled: true}, &db.SimpleDB{}}, mustOCSPRequest(t, leaf, ca.Intermediate), 0, 0, time.Time{}, http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config: &config.Config{OCSP: tt.fields.ocsp},
+				db:     tt.fields.db,
+				ocspResponder: &ocspResponder{
+					issuer:      ca.Intermediate,
+					certificate: ca.Intermediate,
+					signer:      ca.Signer,
+					responses:   newOCSPResponseCache(),
+				},
+			}
+
+			got, err := a.GetOCSPResponse(tt.req)
+			if tt.wantErrStatus != 0 {
+				if assert.Error(t, err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, tt.wantErrStatus, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+
+			resp, err := ocsp.ParseResponseForCert(got.Raw, leaf, ca.Intermediate)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantStatus, resp.Status)
+			assert.Equals(t, 0, leaf.SerialNumber.Cmp(resp.SerialNumber))
+			assert.True(t, got.ThisUpdate.Equal(resp.ThisUpdate))
+			assert.True(t, got.NextUpdate.Equal(resp.NextUpdate))
+			assert.Equals(t, time.Hour, resp.NextUpdate.Sub(resp.ThisUpdate))
+			if tt.wantStatus == ocsp.Revoked {
+				assert.Equals(t, tt.wantReason, resp.RevocationReason)
+				assert.True(t, tt.wantRevokedAt.Equal(resp.RevokedAt))
+			}
+
+			// Good and revoked responses are cached.
+			cached, err := a.GetOCSPResponse(tt.req)
+			assert.FatalError(t, err)
+			if tt.wantStatus == ocsp.Unknown {
+				_, _, ok := a.ocspResponder.responses.Load(leaf.SerialNumber.String())
+				assert.False(t, ok)
+			} else {
+				assert.True(t, got == cached)
+			}
+		})
+	}
+}
+
+func TestAuthority_GetOCSPResponse_delegated(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := mustOCSPLeaf(t, ca)
+
+	a, err := NewEmbedded(WithX509RootCerts(ca.Root), WithX509Signer(ca.Intermediate, ca.Signer), WithDatabase(&db.MockAuthDB{
+		MIsRevoked: func(sn string) (bool, error) {
+			return false, nil
+		},
+		MGetCertificateData: func(sn string) (*db.CertificateData, error) {
+			return &db.CertificateData{}, nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.config.OCSP = &config.OCSPConfig{Enabled: true, Delegated: true}
+	assert.FatalError(t, a.initOCSPResponder())
+
+	responder := a.ocspResponder.certificate
+	assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}, responder.ExtKeyUsage)
+	assert.Equals(t, 24*time.Hour+time.Minute, responder.NotAfter.Sub(responder.NotBefore))
+
+	got, err := a.GetOCSPResponse(mustOCSPRequest(t, leaf, ca.Intermediate))
+	assert.FatalError(t, err)
+
+	// ParseResponseForCert validates the responder certificate.
+	resp, err := ocsp.ParseResponseForCert(got.Raw, leaf, ca.Intermediate)
+	assert.FatalError(t, err)
+	assert.Equals(t, ocsp.Good, resp.Status)
+	assert.Equals(t, responder.Raw, resp.Certificate.Raw)
+
+	// The responder certificate is renewed if a response would outlive it.
+	a.ocspResponder.certificate.NotAfter = time.Now().Add(time.Minute)
+	a.invalidateOCSPResponse(leaf.SerialNumber.String())
+	got, err = a.GetOCSPResponse(mustOCSPRequest(t, leaf, ca.Intermediate))
+	assert.FatalError(t, err)
+	resp, err = ocsp.ParseResponseForCert(got.Raw, leaf, ca.Intermediate)
+	assert.FatalError(t, err)
+	assert.True(t, responder.SerialNumber.Cmp(resp.Certificate.SerialNumber) != 0)
+}
+
+func Test_withOCSPServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		ocsp     *config.OCSPConfig
+		crt      *x509.Certificate
+		expected []string
+	}{
+		{"ok", &config.OCSPConfig{Enabled: true, ResponderURL: "https://ca.example.com/1.0/ocsp"}, &x509.Certificate{}, []string{"https://ca.example.com/1.0/ocsp"}},
+		{"ok template", &config.OCSPConfig{Enabled: true, ResponderURL: "https://ca.example.com/1.0/ocsp"}, &x509.Certificate{OCSPServer: []string{"https://ocsp.example.com"}}, []string{"https://ocsp.example.com"}},
+		{"ok disabled", &config.OCSPConfig{ResponderURL: "https://ca.example.com/1.0/ocsp"}, &x509.Certificate{}, nil},
+		{"ok no url", &config.OCSPConfig{Enabled: true}, &x509.Certificate{}, nil},
+		{"ok nil", nil, &x509.Certificate{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.FatalError(t, withOCSPServer(tt.ocsp).Modify(tt.crt, provisioner.SignOptions{}))
+			assert.Equals(t, tt.expected, tt.crt.OCSPServer)
+		})
+	}
+}
+
+func Test_ocspResponseCache(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	valid := &OCSPResponse{ThisUpdate: now, NextUpdate: now.Add(time.Hour)}
+	expired := &OCSPResponse{ThisUpdate: now.Add(-2 * time.Hour), NextUpdate: now.Add(-time.Hour)}
+
+	c := newOCSPResponseCache()
+	_, revision, ok := c.Load("1")
+	assert.False(t, ok)
+	assert.True(t, c.Store("1", valid, revision, now))
+	got, _, ok := c.Load("1")
+	assert.True(t, ok)
+	assert.True(t, got == valid)
+
+	// A response read before an invalidation is not stored.
+	_, revision, _ = c.Load("2")
+	c.Delete("1")
+	assert.False(t, c.Store("2", valid, revision, now))
+	_, _, ok = c.Load("1")
+	assert.False(t, ok)
+	_, _, ok = c.Load("2")
+	assert.False(t, ok)
+
+	// Expired responses are evicted when the cache is full.
+	c = newOCSPResponseCache()
+	for i := 0; i < maxOCSPCacheSize; i++ {
+		c.responses[strconv.Itoa(i)] = valid
+	}
+	c.responses["0"] = expired
+	assert.True(t, c.Store("new", valid, 0, now))
+	_, _, ok = c.Load("0")
+	assert.False(t, ok)
+	assert.Equals(t, maxOCSPCacheSize, len(c.responses))
+	assert.False(t, c.Store("other", valid, 0, now))
+}
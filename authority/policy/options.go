@@ -107,6 +107,18 @@ type SSHPolicyOptions struct {
 	User *SSHUserCertificateOptions `json:"user,omitempty"`
 	// Host contains SSH host certificate options.
 	Host *SSHHostCertificateOptions `json:"host,omitempty"`
+	// Permissions contains the policy for the critical options and
+	// extensions of SSH user certificates.
+	Permissions *SSHPermissionsOptions `json:"permissions,omitempty"`
+}
+
+// GetPermissions returns the policy for the critical options and extensions
+// of SSH user certificates.
+func (o *SSHPolicyOptions) GetPermissions() *SSHPermissionsOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Permissions
 }
 
 // GetAllowedUserNameOptions returns the SSH allowed user name policy
@@ -192,3 +204,32 @@ func (o *SSHNameOptions) HasNames() bool {
 		len(o.EmailAddresses) > 0 ||
 		len(o.Principals) > 0
 }
+
+// SSHPermissionsOptions models the policy for the critical options and the
+// extensions of SSH user certificates. The keys of the maps are the names of
+// the critical options or extensions, e.g. "source-address" or "permit-pty".
+type SSHPermissionsOptions struct {
+	CriticalOptions map[string]*SSHPermissionOptions `json:"criticalOptions,omitempty"`
+	Extensions      map[string]*SSHPermissionOptions `json:"extensions,omitempty"`
+}
+
+// SSHPermissionOptions models the policy for a critical option or an
+// extension.
+type SSHPermissionOptions struct {
+	// Required fails the request if the certificate does not have the option.
+	Required bool `json:"required,omitempty"`
+	// Forbidden removes the option from the certificate.
+	Forbidden bool `json:"forbidden,omitempty"`
+	// Default is the value added if the certificate does not have the option.
+	Default *string `json:"default,omitempty"`
+	// Values is the list of allowed values, if empty any value is allowed.
+	Values []string `json:"values,omitempty"`
+	// FromRemoteAddress sets the IP address of the requester as the value if
+	// the certificate does not have the option. The address is the peer of
+	// the connection, forwarding headers set by proxies are not trusted.
+	FromRemoteAddress bool `json:"fromRemoteAddress,omitempty"`
+	// FromClaim sets the value of the given token claim as the value if the
+	// certificate does not have the option. Lists of strings are joined with
+	// commas.
+	FromClaim string `json:"fromClaim,omitempty"`
+}
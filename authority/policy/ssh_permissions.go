@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHRequestValues contains the values of a request that can be used to set
+// the critical options and extensions of an SSH certificate.
+type SSHRequestValues struct {
+	// RemoteAddress is the IP address of the requester.
+	RemoteAddress string
+	// Claims are the claims of the token used in the request.
+	Claims map[string]interface{}
+}
+
+// Validate validates the policy for the critical options and extensions.
+func (o *SSHPermissionsOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if err := validateSSHPermissions("critical option", o.CriticalOptions); err != nil {
+		return err
+	}
+	return validateSSHPermissions("extension", o.Extensions)
+}
+
+func validateSSHPermissions(kind string, m map[string]*SSHPermissionOptions) error {
+	for name, p := range m {
+		switch {
+		case name == "":
+			return fmt.Errorf("%s name cannot be empty", kind)
+		case p == nil:
+			return fmt.Errorf("%s %q cannot be empty", kind, name)
+		case p.Forbidden && (p.Required || p.Default != nil || len(p.Values) > 0 || p.FromRemoteAddress || p.FromClaim != ""):
+			return fmt.Errorf("%s %q cannot be forbidden and have other properties", kind, name)
+		case p.FromRemoteAddress && p.FromClaim != "":
+			return fmt.Errorf("%s %q cannot have both fromRemoteAddress and fromClaim", kind, name)
+		case p.Default != nil && len(p.Values) > 0 && !containsString(p.Values, *p.Default):
+			return fmt.Errorf("%s %q default value %q is not in the allowed values", kind, name, *p.Default)
+		}
+	}
+	return nil
+}
+
+// Apply applies the policy to the critical options and extensions of the
+// given certificate. Forbidden options are removed and missing options are
+// set using the request values or the default value. It returns an error if
+// a required option is missing or an option has a value that is not allowed.
+func (o *SSHPermissionsOptions) Apply(cert *ssh.Certificate, values SSHRequestValues) error {
+	if o == nil {
+		return nil
+	}
+	if cert.CriticalOptions == nil && len(o.CriticalOptions) > 0 {
+		cert.CriticalOptions = make(map[string]string)
+	}
+	if err := applySSHPermissions("critical option", o.CriticalOptions, cert.CriticalOptions, values); err != nil {
+		return err
+	}
+	if cert.Extensions == nil && len(o.Extensions) > 0 {
+		cert.Extensions = make(map[string]string)
+	}
+	return applySSHPermissions("extension", o.Extensions, cert.Extensions, values)
+}
+
+func applySSHPermissions(kind string, m map[string]*SSHPermissionOptions, permissions map[string]string, values SSHRequestValues) error {
+	// Sort the names so errors are deterministic.
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := m[name]
+		if p == nil {
+			continue
+		}
+		if p.Forbidden {
+			delete(permissions, name)
+			continue
+		}
+
+		v, ok := permissions[name]
+		if !ok {
+			if v, ok = p.value(values); ok {
+				permissions[name] = v
+			}
+		}
+
+		switch {
+		case !ok && p.Required:
+			return fmt.Errorf("%s %q is required", kind, name)
+		case ok && len(p.Values) > 0 && !containsString(p.Values, v):
+			return fmt.Errorf("%s %q value %q is not allowed", kind, name, v)
+		}
+	}
+	return nil
+}
+
+// value returns the value for a missing option.
+func (p *SSHPermissionOptions) value(values SSHRequestValues) (string, bool) {
+	switch {
+	case p.FromRemoteAddress:
+		if values.RemoteAddress != "" {
+			return values.RemoteAddress, true
+		}
+	case p.FromClaim != "":
+		switch v := values.Claims[p.FromClaim].(type) {
+		case string:
+			if v != "" {
+				return v, true
+			}
+		case []interface{}:
+			var s []string
+			for _, vv := range v {
+				if str, ok := vv.(string); ok && str != "" {
+					s = append(s, str)
+				}
+			}
+			if len(s) > 0 {
+				return strings.Join(s, ","), true
+			}
+		}
+	}
+	if p.Default != nil {
+		return *p.Default, true
+	}
+	return "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHPermissionsOptions_Validate(t *testing.T) {
+	value := "value"
+	tests := []struct {
+		name    string
+		options *SSHPermissionsOptions
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/empty", &SSHPermissionsOptions{}, false},
+		{"ok", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {Required: true, FromRemoteAddress: true},
+				"force-command":  {Default: &value, Values: []string{"value", "other"}},
+			},
+			Extensions: map[string]*SSHPermissionOptions{
+				"permit-port-forwarding": {Forbidden: true},
+				"permit-pty":             {FromClaim: "pty"},
+			},
+		}, false},
+		{"fail/empty name", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{"": {Required: true}},
+		}, true},
+		{"fail/nil policy", &SSHPermissionsOptions{
+			Extensions: map[string]*SSHPermissionOptions{"permit-pty": nil},
+		}, true},
+		{"fail/forbidden and required", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{"force-command": {Forbidden: true, Required: true}},
+		}, true},
+		{"fail/forbidden and default", &SSHPermissionsOptions{
+			Extensions: map[string]*SSHPermissionOptions{"permit-pty": {Forbidden: true, Default: &value}},
+		}, true},
+		{"fail/remote address and claim", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{"source-address": {FromRemoteAddress: true, FromClaim: "ip"}},
+		}, true},
+		{"fail/default not allowed", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{"force-command": {Default: &value, Values: []string{"other"}}},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHPermissionsOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHPermissionsOptions_Apply(t *testing.T) {
+	empty := ""
+	command := "/bin/true"
+	values := SSHRequestValues{
+		RemoteAddress: "127.0.0.1",
+		Claims: map[string]interface{}{
+			"ip":  "10.0.0.1",
+			"ips": []interface{}{"10.0.0.0/8", "192.168.1.1"},
+			"bad": 123,
+		},
+	}
+	tests := []struct {
+		name    string
+		options *SSHPermissionsOptions
+		cert    *ssh.Certificate
+		values  SSHRequestValues
+		want    ssh.Permissions
+		wantErr bool
+	}{
+		{"ok/nil", nil, &ssh.Certificate{}, values, ssh.Permissions{}, false},
+		{"ok/defaults", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"force-command": {Default: &command},
+			},
+			Extensions: map[string]*SSHPermissionOptions{
+				"permit-pty": {Default: &empty},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/bin/true"},
+			Extensions:      map[string]string{"permit-pty": ""},
+		}, false},
+		{"ok/keep value", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"force-command": {Default: &command, Values: []string{"/bin/true", "/bin/false"}},
+			},
+		}, &ssh.Certificate{Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/bin/false"},
+		}}, values, ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/bin/false"},
+		}, false},
+		{"ok/remote address", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {Required: true, FromRemoteAddress: true},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{
+			CriticalOptions: map[string]string{"source-address": "127.0.0.1"},
+		}, false},
+		{"ok/claim", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {Required: true, FromClaim: "ip"},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{
+			CriticalOptions: map[string]string{"source-address": "10.0.0.1"},
+		}, false},
+		{"ok/claim list", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {Required: true, FromClaim: "ips"},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{
+			CriticalOptions: map[string]string{"source-address": "10.0.0.0/8,192.168.1.1"},
+		}, false},
+		{"ok/claim default", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {FromClaim: "missing", Default: &command},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{
+			CriticalOptions: map[string]string{"source-address": "/bin/true"},
+		}, false},
+		{"ok/forbidden", &SSHPermissionsOptions{
+			Extensions: map[string]*SSHPermissionOptions{
+				"permit-port-forwarding": {Forbidden: true},
+			},
+		}, &ssh.Certificate{Permissions: ssh.Permissions{
+			Extensions: map[string]string{"permit-port-forwarding": "", "permit-pty": ""},
+		}}, values, ssh.Permissions{
+			Extensions: map[string]string{"permit-pty": ""},
+		}, false},
+		{"fail/required", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"force-command": {Required: true},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{}, true},
+		{"fail/remote address", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {Required: true, FromRemoteAddress: true},
+			},
+		}, &ssh.Certificate{}, SSHRequestValues{}, ssh.Permissions{}, true},
+		{"fail/claim type", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"source-address": {Required: true, FromClaim: "bad"},
+			},
+		}, &ssh.Certificate{}, values, ssh.Permissions{}, true},
+		{"fail/value", &SSHPermissionsOptions{
+			CriticalOptions: map[string]*SSHPermissionOptions{
+				"force-command": {Values: []string{"/bin/true"}},
+			},
+		}, &ssh.Certificate{Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{"force-command": "/bin/bash"},
+		}}, values, ssh.Permissions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Apply(tt.cert, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SSHPermissionsOptions.Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(tt.cert.Permissions, tt.want) {
+				t.Errorf("SSHPermissionsOptions.Apply() permissions = %v, want %v", tt.cert.Permissions, tt.want)
+			}
+		})
+	}
+}
@@ -99,10 +99,22 @@ type ACME struct {
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
-	Claims              *Claims  `json:"claims,omitempty"`
-	Options             *Options `json:"options,omitempty"`
+	// The tpm format requires this bundle, as there are no well-known roots for
+	// the TPM manufacturers.
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// EndorsementRoots contains a bundle of root certificates in PEM format
+	// of the TPM manufacturers, used by the tpm format to verify the
+	// endorsement key certificates. The attestation key certificates are
+	// verified with the AttestationRoots.
+	EndorsementRoots []byte `json:"endorsementRoots,omitempty"`
+	// DeviceInventory configures a webhook or a file used to confirm that the
+	// devices using the device-attest-01 challenge are enrolled. The data of
+	// the device is available in the certificate templates as .Device.
+	DeviceInventory     *DeviceInventory `json:"deviceInventory,omitempty"`
+	Claims              *Claims          `json:"claims,omitempty"`
+	Options             *Options         `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
+	endorsementRootPool *x509.CertPool
 	ctl                 *Controller
 }
 
@@ -171,33 +183,50 @@ func (p *ACME) Init(config Config) (err error) {
 		}
 	}
 
-	// Parse attestation roots.
-	// The pool will be nil if the there are not roots.
-	if rest := p.AttestationRoots; len(rest) > 0 {
-		var block *pem.Block
-		var hasCert bool
-		p.attestationRootPool = x509.NewCertPool()
-		for rest != nil {
-			block, rest = pem.Decode(rest)
-			if block == nil {
-				break
-			}
-			cert, err := x509.ParseCertificate(block.Bytes)
-			if err != nil {
-				return errors.New("error parsing attestationRoots: malformed certificate")
-			}
-			p.attestationRootPool.AddCert(cert)
-			hasCert = true
-		}
-		if !hasCert {
-			return errors.New("error parsing attestationRoots: no certificates found")
-		}
+	if err := p.DeviceInventory.Validate(); err != nil {
+		return err
+	}
+
+	// Parse attestation and endorsement roots.
+	// The pools will be nil if the there are not roots.
+	if p.attestationRootPool, err = parseRootPool(p.AttestationRoots, "attestationRoots"); err != nil {
+		return err
+	}
+	if p.endorsementRootPool, err = parseRootPool(p.EndorsementRoots, "endorsementRoots"); err != nil {
+		return err
 	}
 
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
 
+// parseRootPool returns a certificate pool with the certificates in the given
+// PEM bundle, or nil if the bundle is empty.
+func parseRootPool(rest []byte, name string) (*x509.CertPool, error) {
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	var block *pem.Block
+	var hasCert bool
+	pool := x509.NewCertPool()
+	for rest != nil {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Errorf("error parsing %s: malformed certificate", name)
+		}
+		pool.AddCert(cert)
+		hasCert = true
+	}
+	if !hasCert {
+		return nil, errors.Errorf("error parsing %s: no certificates found", name)
+	}
+	return pool, nil
+}
+
 // ACMEIdentifierType encodes ACME Identifier types
 type ACMEIdentifierType string
 
@@ -310,6 +339,21 @@ func (p *ACME) IsAttestationFormatEnabled(ctx context.Context, format ACMEAttest
 	return false
 }
 
+// LookupDevice returns the data of the device with the given permanent
+// identifier in the configured device inventory. It returns an error if the
+// device is not enrolled or if it has been decommissioned. If no device
+// inventory is configured, all devices are allowed and the data is nil.
+func (p *ACME) LookupDevice(ctx context.Context, permanentIdentifier string) (map[string]interface{}, error) {
+	if p.DeviceInventory == nil {
+		return nil, nil
+	}
+	device, err := p.DeviceInventory.Lookup(ctx, p.Name, permanentIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return device.Data, nil
+}
+
 // GetAttestationRoots returns certificate pool with the configured attestation
 // roots and reports if the pool contains at least one certificate.
 //
@@ -318,3 +362,10 @@ func (p *ACME) IsAttestationFormatEnabled(ctx context.Context, format ACMEAttest
 func (p *ACME) GetAttestationRoots() (*x509.CertPool, bool) {
 	return p.attestationRootPool, p.attestationRootPool != nil
 }
+
+// GetEndorsementRoots returns certificate pool with the configured
+// endorsement roots and reports if the pool contains at least one
+// certificate.
+func (p *ACME) GetEndorsementRoots() (*x509.CertPool, bool) {
+	return p.endorsementRootPool, p.endorsementRootPool != nil
+}
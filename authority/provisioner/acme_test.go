@@ -146,6 +146,12 @@ func TestACME_Init(t *testing.T) {
 				err: errors.New("error parsing attestationRoots: no certificates found"),
 			}
 		},
+		"fail-parse-endorsement-roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", EndorsementRoots: []byte("-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----")},
+				err: errors.New("error parsing endorsementRoots: malformed certificate"),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &ACME{Name: "foo", Type: "bar"},
@@ -159,6 +165,7 @@ func TestACME_Init(t *testing.T) {
 					Challenges:         []ACMEChallenge{DNS_01, DEVICE_ATTEST_01},
 					AttestationFormats: []ACMEAttestationFormat{APPLE, STEP},
 					AttestationRoots:   bytes.Join([][]byte{appleCA, yubicoCA}, []byte("\n")),
+					EndorsementRoots:   yubicoCA,
 				},
 			}
 		},
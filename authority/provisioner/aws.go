@@ -12,6 +12,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -216,11 +217,13 @@ type awsPayload struct {
 	Amazon   awsAmazonPayload `json:"amazon"`
 	SANs     []string         `json:"sans"`
 	document awsInstanceIdentityDocument
+	identity *awsIAMIdentity
 }
 
 type awsAmazonPayload struct {
-	Document  []byte `json:"document"`
-	Signature []byte `json:"signature"`
+	Document  []byte         `json:"document"`
+	Signature []byte         `json:"signature"`
+	IAM       *awsIAMRequest `json:"iam,omitempty"`
 }
 
 type awsInstanceIdentityDocument struct {
@@ -256,6 +259,10 @@ type awsInstanceIdentityDocument struct {
 // IIDRoots can be used to specify a path to the certificates used to verify the
 // identity certificate signature.
 //
+// If IAM is set, tokens with a signed sts:GetCallerIdentity request will also
+// be accepted, see AWSIAM. These tokens are not limited by TOFU and cannot be
+// used to sign SSH certificates.
+//
 // Amazon Identity docs are available at
 // https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
 type AWS struct {
@@ -269,6 +276,7 @@ type AWS struct {
 	IMDSVersions           []string `json:"imdsVersions"`
 	InstanceAge            Duration `json:"instanceAge,omitempty"`
 	IIDRoots               string   `json:"iidRoots,omitempty"`
+	IAM                    *AWSIAM  `json:"iam,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	config                 *awsConfig
@@ -295,6 +303,17 @@ func (p *AWS) GetTokenID(token string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	// IAM roles are usually shared by multiple workloads, so TOFU is never
+	// used with them. The signature of the STS request is used as the ID, so
+	// the request cannot be reused in a different token.
+	if payload.identity != nil {
+		sig, err := payload.Amazon.IAM.signature()
+		if err != nil {
+			return "", errs.Wrap(http.StatusUnauthorized, err, "aws.GetTokenID")
+		}
+		return strings.ToLower(sig), nil
+	}
+
 	// If TOFU is disabled create an ID for the token, so it cannot be reused.
 	// The timestamps, document and signatures should be mostly unique.
 	if p.DisableTrustOnFirstUse {
@@ -427,6 +446,14 @@ func (p *AWS) Init(config Config) (err error) {
 		}
 	}
 
+	// validate IAM configuration
+	if err := p.IAM.Validate(); err != nil {
+		return err
+	}
+	if p.IAM != nil && len(p.IAM.AllowedARNs) == 0 && len(p.Accounts) == 0 {
+		return errors.New("provisioner iam requires accounts or allowedARNs")
+	}
+
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
@@ -439,6 +466,9 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
 	}
+	if payload.identity != nil {
+		return p.authorizeIAMSign(token, payload)
+	}
 
 	doc := payload.document
 
@@ -487,6 +517,61 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	), nil
 }
 
+// authorizeIAMSign returns the sign options for a token with a signed
+// sts:GetCallerIdentity request.
+func (p *AWS) authorizeIAMSign(token string, payload *awsPayload) ([]SignOption, error) {
+	identity := payload.identity
+
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(payload.Claims.Subject)
+	data.Set("AWS", identity.templateData())
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// Enforce the ARN as the only SAN if configured. By default we'll accept
+	// the CN and SANs in the CSR.
+	var so []SignOption
+	if p.DisableCustomSANs {
+		arn := identity.ARN
+		if identity.RoleARN != "" {
+			arn = identity.RoleARN
+		}
+		u, err := url.Parse(arn)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+		}
+		so = append(so,
+			dnsNamesValidator(nil),
+			ipAddressesValidator(nil),
+			emailAddressesValidator(nil),
+			urisValidator([]*url.URL{u}),
+		)
+
+		// Template options
+		data.SetSANs([]string{arn})
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeAWS, p.Name, identity.Account, "ARN", identity.ARN),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		commonNameValidator(payload.Claims.Subject),
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+	), nil
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 // NOTE: This method does not actually validate the certificate or check it's
 // revocation status. Just confirms that the provisioner that created the
@@ -629,6 +714,9 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	if err := jwt.UnsafeClaimsWithoutVerification(&unsafeClaims); err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error unmarshaling claims")
 	}
+	if unsafeClaims.Amazon.IAM != nil {
+		return p.authorizeIAMToken(jwt, unsafeClaims.Amazon.IAM)
+	}
 
 	var payload awsPayload
 	if err := jwt.Claims(unsafeClaims.Amazon.Signature, &payload); err != nil {
@@ -705,6 +793,75 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 	return &payload, nil
 }
 
+// authorizeIAMToken validates a token with a signed sts:GetCallerIdentity
+// request. The token is signed using the authorization header of the request,
+// and the request is replayed against STS to get the identity of the caller.
+func (p *AWS) authorizeIAMToken(jwt *jose.JSONWebToken, iam *awsIAMRequest) (*awsPayload, error) {
+	if p.IAM == nil {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws iam tokens are not enabled for provisioner '%s'", p.GetName())
+	}
+
+	authorization := iam.header().Get("Authorization")
+	if authorization == "" {
+		return nil, errs.Unauthorized("aws.authorizeToken; aws iam request authorization header cannot be empty")
+	}
+
+	var payload awsPayload
+	if err := jwt.Claims([]byte(authorization), &payload); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error verifying claims")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no
+	// more than a few minutes.
+	if err := payload.ValidateWithLeeway(jose.Expected{
+		Issuer: awsIAMIssuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, errs.Wrapf(http.StatusUnauthorized, err, "aws.authorizeToken; invalid aws token")
+	}
+
+	// validate audiences with the defaults
+	if !matchesAudience(payload.Audience, p.ctl.Audiences.Sign) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid audience claim (aud)")
+	}
+
+	identity, err := p.IAM.GetCallerIdentity(payload.Amazon.IAM, p.ctl.Audiences.Sign)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "aws.authorizeToken; error validating aws iam request")
+	}
+
+	// Validate subject, it has to be known if disableCustomSANs is enabled
+	if p.DisableCustomSANs {
+		if payload.Subject != identity.ARN &&
+			payload.Subject != identity.Name &&
+			(identity.RoleARN == "" || payload.Subject != identity.RoleARN) {
+			return nil, errs.Unauthorized("aws.authorizeToken; invalid token - invalid subject claim (sub)")
+		}
+	}
+
+	// validate accounts
+	if len(p.Accounts) > 0 {
+		var found bool
+		for _, sa := range p.Accounts {
+			if sa == identity.Account {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("aws.authorizeToken; invalid aws iam identity - account is not valid")
+		}
+	}
+
+	// validate arns
+	if !p.IAM.Allowed(identity) {
+		return nil, errs.Unauthorized("aws.authorizeToken; invalid aws iam identity - arn is not allowed")
+	}
+
+	payload.identity = identity
+	return &payload, nil
+}
+
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
@@ -714,6 +871,9 @@ func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "aws.AuthorizeSSHSign")
 	}
+	if claims.identity != nil {
+		return nil, errs.Unauthorized("aws.AuthorizeSSHSign; aws iam tokens cannot be used to sign ssh certificates")
+	}
 
 	doc := claims.document
 	signOptions := []SignOption{}
@@ -765,5 +925,7 @@ func (p *AWS) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
 	), nil
 }
@@ -0,0 +1,314 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// awsIAMIssuer is the string used as issuer in the tokens with a signed
+	// sts:GetCallerIdentity request.
+	awsIAMIssuer = "sts.amazonaws.com"
+	// awsSTSEndpoint is the default endpoint used to replay the signed
+	// sts:GetCallerIdentity requests.
+	awsSTSEndpoint = "https://sts.amazonaws.com/"
+	// awsIAMAudienceHeader is the header that must be included in the signed
+	// headers of the request, its value binds the request to the audience of
+	// the token.
+	awsIAMAudienceHeader = "X-Step-Audience"
+	// awsIAMRequestMaxSkew is the maximum difference between the X-Amz-Date of
+	// the signed request and the current time.
+	awsIAMRequestMaxSkew = 5 * time.Minute
+	// awsAmzDateFormat is the format of the X-Amz-Date header.
+	awsAmzDateFormat = "20060102T150405Z"
+	// defaultAWSIAMTimeout is the default timeout used in the requests to STS.
+	defaultAWSIAMTimeout = 10 * time.Second
+	// awsIAMMaxBodySize is the maximum size of the STS responses.
+	awsIAMMaxBodySize = 1 << 20
+)
+
+// AWSIAM configures the AWS provisioner to accept tokens with a signed
+// sts:GetCallerIdentity request. These tokens allow workloads without an
+// instance identity document, like ECS tasks, Lambda functions or EKS pods, to
+// authenticate with the credentials of their IAM role.
+//
+// The CA replays the request against the STS endpoint, by default
+// https://sts.amazonaws.com/, and the returned ARN must match one of the
+// AllowedARNs patterns. Patterns use the syntax of path.Match, and are matched
+// against the returned ARN and, for assumed roles, the ARN of the role, e.g.
+// "arn:aws:iam::123456789012:role/*".
+type AWSIAM struct {
+	STSEndpoint string    `json:"stsEndpoint,omitempty"`
+	AllowedARNs []string  `json:"allowedARNs,omitempty"`
+	Timeout     *Duration `json:"timeout,omitempty"`
+	endpoint    string
+	client      *http.Client
+}
+
+// awsIAMRequest is the signed sts:GetCallerIdentity request sent in a token.
+// The request is always sent to the configured STS endpoint.
+type awsIAMRequest struct {
+	Method  string      `json:"method"`
+	Headers http.Header `json:"headers"`
+	Body    []byte      `json:"body"`
+}
+
+// awsIAMIdentity is the identity returned by sts:GetCallerIdentity.
+type awsIAMIdentity struct {
+	ARN         string
+	Account     string
+	UserID      string
+	Partition   string
+	Type        string
+	Name        string
+	SessionName string
+	RoleARN     string
+}
+
+// getCallerIdentityResponse is the XML response of sts:GetCallerIdentity.
+type getCallerIdentityResponse struct {
+	XMLName xml.Name `xml:"GetCallerIdentityResponse"`
+	Result  struct {
+		Arn     string `xml:"Arn"`
+		UserID  string `xml:"UserId"`
+		Account string `xml:"Account"`
+	} `xml:"GetCallerIdentityResult"`
+}
+
+// awsTemplateData is the data available in the templates under the AWS
+// variable.
+type awsTemplateData struct {
+	ARN         string
+	Account     string
+	UserID      string
+	Partition   string
+	Type        string
+	Name        string
+	SessionName string
+	RoleARN     string
+}
+
+// Validate validates and initializes the IAM configuration.
+func (c *AWSIAM) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	c.endpoint = c.STSEndpoint
+	if c.endpoint == "" {
+		c.endpoint = awsSTSEndpoint
+	}
+	if u, err := url.Parse(c.endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.Errorf("iam stsEndpoint %s is not valid", c.endpoint)
+	}
+	for _, pattern := range c.AllowedARNs {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "arn:") {
+			return errors.Errorf("iam allowedARNs pattern %s is not valid", pattern)
+		}
+	}
+
+	timeout := defaultAWSIAMTimeout
+	if c.Timeout != nil && c.Timeout.Value() > 0 {
+		timeout = c.Timeout.Value()
+	}
+	c.client = &http.Client{
+		Timeout: timeout,
+		// Redirects are not followed, the signed request is only valid for
+		// the STS endpoint.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return nil
+}
+
+// GetCallerIdentity replays the signed request against the STS endpoint and
+// returns the identity of the caller. The request must be a signed
+// sts:GetCallerIdentity and the audience header must be signed and match one
+// of the given audiences.
+func (c *AWSIAM) GetCallerIdentity(r *awsIAMRequest, audiences []string) (*awsIAMIdentity, error) {
+	if err := r.validate(audiences); err != nil {
+		return nil, err
+	}
+
+	endpoint := c.endpoint
+	if endpoint == "" {
+		endpoint = awsSTSEndpoint
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating sts request")
+	}
+	// The host of the endpoint is always used, requests signed for a
+	// different host will be rejected by STS.
+	for k, v := range r.header() {
+		if k != "Host" && k != "Content-Length" {
+			req.Header[k] = v
+		}
+	}
+
+	client := c.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultAWSIAMTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error doing sts request to %s", endpoint)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("sts request to %s failed with status code %d", endpoint, resp.StatusCode)
+	}
+
+	var res getCallerIdentityResponse
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, awsIAMMaxBodySize)).Decode(&res); err != nil {
+		return nil, errors.Wrapf(err, "error decoding sts response from %s", endpoint)
+	}
+	identity, err := parseAWSIAMIdentity(res.Result.Arn)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Account != res.Result.Account {
+		return nil, errors.Errorf("sts response account %s does not match arn %s", res.Result.Account, res.Result.Arn)
+	}
+	identity.UserID = res.Result.UserID
+	return identity, nil
+}
+
+// Allowed returns true if the identity matches one of the allowed patterns,
+// or if there are no patterns.
+func (c *AWSIAM) Allowed(identity *awsIAMIdentity) bool {
+	if len(c.AllowedARNs) == 0 {
+		return true
+	}
+	for _, pattern := range c.AllowedARNs {
+		if ok, _ := path.Match(pattern, identity.ARN); ok {
+			return true
+		}
+		if identity.RoleARN != "" {
+			if ok, _ := path.Match(pattern, identity.RoleARN); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// header returns the headers of the request with canonical keys.
+func (r *awsIAMRequest) header() http.Header {
+	header := make(http.Header, len(r.Headers))
+	for k, v := range r.Headers {
+		k = http.CanonicalHeaderKey(k)
+		header[k] = append(header[k], v...)
+	}
+	return header
+}
+
+// validate checks that the request is a recent sts:GetCallerIdentity request
+// bound to one of the given audiences.
+func (r *awsIAMRequest) validate(audiences []string) error {
+	if r.Method != "" && r.Method != http.MethodPost {
+		return errors.Errorf("sts request method %s is not valid", r.Method)
+	}
+	values, err := url.ParseQuery(string(r.Body))
+	if err != nil {
+		return errors.Wrap(err, "error parsing sts request body")
+	}
+	if action := values["Action"]; len(action) != 1 || action[0] != "GetCallerIdentity" {
+		return errors.Errorf("sts request action %s is not valid", strings.Join(action, ","))
+	}
+
+	header := r.header()
+	if !matchesAudience(header.Values(awsIAMAudienceHeader), audiences) || len(header.Values(awsIAMAudienceHeader)) != 1 {
+		return errors.Errorf("sts request header %s is not valid", awsIAMAudienceHeader)
+	}
+	signedHeaders, err := awsAuthorizationParam(header.Get("Authorization"), "SignedHeaders")
+	if err != nil {
+		return err
+	}
+	for _, h := range []string{awsIAMAudienceHeader, "X-Amz-Date"} {
+		if !containsFold(strings.Split(signedHeaders, ";"), h) {
+			return errors.Errorf("sts request header %s is not signed", h)
+		}
+	}
+
+	// Signed requests are valid for 15 minutes in STS, only recent requests
+	// are accepted to limit their reuse.
+	date, err := time.Parse(awsAmzDateFormat, header.Get("X-Amz-Date"))
+	if err != nil {
+		return errors.Wrap(err, "error parsing sts request header X-Amz-Date")
+	}
+	if d := time.Since(date); d > awsIAMRequestMaxSkew || d < -awsIAMRequestMaxSkew {
+		return errors.Errorf("sts request header X-Amz-Date %s is not valid", header.Get("X-Amz-Date"))
+	}
+	return nil
+}
+
+// signature returns the AWS Signature Version 4 signature of the request.
+func (r *awsIAMRequest) signature() (string, error) {
+	return awsAuthorizationParam(r.header().Get("Authorization"), "Signature")
+}
+
+// awsAuthorizationParam returns the value of the given parameter in an AWS
+// Signature Version 4 authorization header.
+func awsAuthorizationParam(authorization, name string) (string, error) {
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return "", errors.New("sts request authorization header is not valid")
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, "AWS4-HMAC-SHA256 "), ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, name+"=") && len(part) > len(name)+1 {
+			return strings.TrimPrefix(part, name+"="), nil
+		}
+	}
+	return "", errors.Errorf("sts request authorization header does not have %s", name)
+}
+
+// parseAWSIAMIdentity parses an IAM user, IAM role or STS assumed role ARN.
+// For assumed roles the ARN of the role is also set.
+func parseAWSIAMIdentity(arn string) (*awsIAMIdentity, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[1] == "" || parts[4] == "" {
+		return nil, errors.Errorf("arn %s is not valid", arn)
+	}
+	identity := &awsIAMIdentity{
+		ARN:       arn,
+		Partition: parts[1],
+		Account:   parts[4],
+	}
+	resource := strings.Split(parts[5], "/")
+	switch {
+	case parts[2] == "sts" && resource[0] == "assumed-role" && len(resource) == 3:
+		identity.Type = resource[0]
+		identity.Name = resource[1]
+		identity.SessionName = resource[2]
+		identity.RoleARN = "arn:" + identity.Partition + ":iam::" + identity.Account + ":role/" + identity.Name
+	case parts[2] == "iam" && (resource[0] == "user" || resource[0] == "role") && len(resource) >= 2:
+		identity.Type = resource[0]
+		identity.Name = resource[len(resource)-1]
+		if resource[0] == "role" {
+			identity.RoleARN = arn
+		}
+	default:
+		return nil, errors.Errorf("arn %s is not an iam user or role", arn)
+	}
+	for _, s := range resource {
+		if s == "" {
+			return nil, errors.Errorf("arn %s is not valid", arn)
+		}
+	}
+	return identity, nil
+}
+
+// templateData returns the data exposed to the templates.
+func (i *awsIAMIdentity) templateData() awsTemplateData {
+	return awsTemplateData(*i)
+}
@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -871,3 +872,199 @@ func TestAWS_AuthorizeRenew(t *testing.T) {
 		})
 	}
 }
+
+func TestAWS_Init_iam(t *testing.T) {
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+	tests := []struct {
+		name     string
+		accounts []string
+		iam      *AWSIAM
+		wantErr  bool
+	}{
+		{"ok/accounts", []string{"123456789012"}, &AWSIAM{}, false},
+		{"ok/allowedARNs", nil, &AWSIAM{AllowedARNs: []string{"arn:aws:iam::123456789012:role/*"}}, false},
+		{"ok/endpoint", nil, &AWSIAM{STSEndpoint: "https://sts.us-west-2.amazonaws.com", AllowedARNs: []string{"arn:aws:iam::123456789012:role/*"}}, false},
+		{"fail/allowlist", nil, &AWSIAM{}, true},
+		{"fail/endpoint", []string{"123456789012"}, &AWSIAM{STSEndpoint: "sts.amazonaws.com"}, true},
+		{"fail/allowedARNs", []string{"123456789012"}, &AWSIAM{AllowedARNs: []string{"my-role"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &AWS{
+				Type:     "AWS",
+				Name:     "name",
+				Accounts: tt.accounts,
+				IAM:      tt.iam,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("AWS.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAWS_AuthorizeSign_iam(t *testing.T) {
+	arn := "arn:aws:sts::123456789012:assumed-role/my-role/my-session"
+	roleARN := "arn:aws:iam::123456789012:role/my-role"
+	srv, hits := newFakeSTSServer(t, testAWSIAMAuthorization, arn, "123456789012")
+
+	newProvisioner := func(t *testing.T, accounts, allowedARNs []string, disableCustomSANs bool) *AWS {
+		t.Helper()
+		p, err := generateAWS()
+		assert.FatalError(t, err)
+		p.Accounts = accounts
+		p.DisableCustomSANs = disableCustomSANs
+		p.IAM = &AWSIAM{STSEndpoint: srv.URL, AllowedARNs: allowedARNs}
+		assert.FatalError(t, p.IAM.Validate())
+		return p
+	}
+	p1 := newProvisioner(t, []string{"123456789012"}, nil, false)
+	p2 := newProvisioner(t, nil, []string{"arn:aws:iam::123456789012:role/my-role"}, true)
+	p3 := newProvisioner(t, []string{"000000000000"}, nil, false)
+	p4 := newProvisioner(t, nil, []string{"arn:aws:iam::123456789012:role/other-role"}, false)
+	p5, err := generateAWS()
+	assert.FatalError(t, err)
+
+	audience := func(p *AWS) string {
+		return "https://ca.smallstep.com/1.0/sign#" + p.GetIDForToken()
+	}
+	mustToken := func(p *AWS, sub, iss, aud string, iam *awsIAMRequest, iat time.Time) string {
+		tok, err := generateAWSIAMToken(sub, iss, aud, iam, iat)
+		assert.FatalError(t, err)
+		return tok
+	}
+	newRequest := func(p *AWS) *awsIAMRequest {
+		return newAWSIAMRequest(testAWSIAMAuthorization, audience(p))
+	}
+
+	t1 := mustToken(p1, "foo.local", awsIAMIssuer, audience(p1), newRequest(p1), time.Now())
+	t2 := mustToken(p2, roleARN, awsIAMIssuer, audience(p2), newRequest(p2), time.Now())
+	t2Name := mustToken(p2, "my-role", awsIAMIssuer, audience(p2), newRequest(p2), time.Now())
+	t3 := mustToken(p3, "foo.local", awsIAMIssuer, audience(p3), newRequest(p3), time.Now())
+	t4 := mustToken(p4, "foo.local", awsIAMIssuer, audience(p4), newRequest(p4), time.Now())
+	t5 := mustToken(p5, "foo.local", awsIAMIssuer, audience(p5), newRequest(p5), time.Now())
+	failSubject := mustToken(p2, "foo.local", awsIAMIssuer, audience(p2), newRequest(p2), time.Now())
+	failIssuer := mustToken(p1, "foo.local", awsIssuer, audience(p1), newRequest(p1), time.Now())
+	failAudience := mustToken(p1, "foo.local", awsIAMIssuer, "https://ca.smallstep.com/1.0/sign#aws/other", newRequest(p1), time.Now())
+	failAudienceHeader := mustToken(p1, "foo.local", awsIAMIssuer, audience(p1), newAWSIAMRequest(testAWSIAMAuthorization, audience(p2)), time.Now())
+	failExp := mustToken(p1, "foo.local", awsIAMIssuer, audience(p1), newRequest(p1), time.Now().Add(-360*time.Second))
+	failSTS := mustToken(p1, "foo.local", awsIAMIssuer, audience(p1), newAWSIAMRequest(testAWSIAMAuthorization+"0", audience(p1)), time.Now())
+
+	// Token signed with a different authorization header.
+	failKey, err := generateAWSIAMToken("foo.local", awsIAMIssuer, audience(p1), newRequest(p1), time.Now())
+	assert.FatalError(t, err)
+	parts := strings.Split(failKey, ".")
+	failKey = parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))
+
+	type args struct {
+		token, cn string
+	}
+	tests := []struct {
+		name     string
+		aws      *AWS
+		args     args
+		wantLen  int
+		wantHits int32
+		code     int
+		wantErr  bool
+	}{
+		{"ok", p1, args{t1, "foo.local"}, 8, 1, http.StatusOK, false},
+		{"ok/disableCustomSANs", p2, args{t2, roleARN}, 12, 1, http.StatusOK, false},
+		{"ok/disableCustomSANs name", p2, args{t2Name, "my-role"}, 12, 1, http.StatusOK, false},
+		{"fail/account", p3, args{token: t3}, 0, 1, http.StatusUnauthorized, true},
+		{"fail/arn", p4, args{token: t4}, 0, 1, http.StatusUnauthorized, true},
+		{"fail/not enabled", p5, args{token: t5}, 0, 0, http.StatusUnauthorized, true},
+		{"fail/subject", p2, args{token: failSubject}, 0, 1, http.StatusUnauthorized, true},
+		{"fail/issuer", p1, args{token: failIssuer}, 0, 0, http.StatusUnauthorized, true},
+		{"fail/audience", p1, args{token: failAudience}, 0, 0, http.StatusUnauthorized, true},
+		{"fail/audience header", p1, args{token: failAudienceHeader}, 0, 0, http.StatusUnauthorized, true},
+		{"fail/exp", p1, args{token: failExp}, 0, 0, http.StatusUnauthorized, true},
+		{"fail/key", p1, args{token: failKey}, 0, 0, http.StatusUnauthorized, true},
+		{"fail/sts", p1, args{token: failSTS}, 0, 1, http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(hits, 0)
+			ctx := NewContextWithMethod(context.Background(), SignMethod)
+			got, err := tt.aws.AuthorizeSign(ctx, tt.args.token)
+			assert.Equals(t, tt.wantHits, atomic.LoadInt32(hits))
+			switch {
+			case (err != nil) != tt.wantErr:
+				t.Errorf("AWS.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			case err != nil:
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, sc.StatusCode(), tt.code)
+			default:
+				assert.Equals(t, tt.wantLen, len(got))
+				for _, o := range got {
+					switch v := o.(type) {
+					case *AWS:
+					case certificateOptionsFunc:
+					case *provisionerExtensionOption:
+						assert.Equals(t, v.Type, TypeAWS)
+						assert.Equals(t, v.Name, tt.aws.GetName())
+						assert.Equals(t, v.CredentialID, "123456789012")
+						assert.Equals(t, []string{"ARN", arn}, v.KeyValuePairs)
+					case profileDefaultDuration:
+						assert.Equals(t, time.Duration(v), tt.aws.ctl.Claimer.DefaultTLSCertDuration())
+					case commonNameValidator:
+						assert.Equals(t, string(v), tt.args.cn)
+					case defaultPublicKeyValidator:
+					case *validityValidator:
+						assert.Equals(t, v.min, tt.aws.ctl.Claimer.MinTLSCertDuration())
+						assert.Equals(t, v.max, tt.aws.ctl.Claimer.MaxTLSCertDuration())
+					case ipAddressesValidator:
+						assert.Equals(t, v, nil)
+					case emailAddressesValidator:
+						assert.Equals(t, v, nil)
+					case urisValidator:
+						assert.Equals(t, []*url.URL(v), []*url.URL{{Scheme: "arn", Opaque: "aws:iam::123456789012:role/my-role"}})
+					case dnsNamesValidator:
+						assert.Equals(t, v, nil)
+					case *x509NamePolicyValidator:
+						assert.Equals(t, nil, v.policyEngine)
+					default:
+						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAWS_iam_GetTokenID_AuthorizeSSHSign(t *testing.T) {
+	arn := "arn:aws:sts::123456789012:assumed-role/my-role/my-session"
+	srv, _ := newFakeSTSServer(t, testAWSIAMAuthorization, arn, "123456789012")
+
+	p, err := generateAWS()
+	assert.FatalError(t, err)
+	p.Accounts = []string{"123456789012"}
+	p.IAM = &AWSIAM{STSEndpoint: srv.URL}
+	assert.FatalError(t, p.IAM.Validate())
+
+	aud := "https://ca.smallstep.com/1.0/sign#" + p.GetIDForToken()
+	token, err := generateAWSIAMToken("foo.local", awsIAMIssuer, aud, newAWSIAMRequest(testAWSIAMAuthorization, aud), time.Now())
+	assert.FatalError(t, err)
+
+	// IAM tokens do not use TOFU, the signature of the request is the ID.
+	id, err := p.GetTokenID(token)
+	assert.FatalError(t, err)
+	assert.Equals(t, "5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", id)
+
+	// A token with the same request has the same ID.
+	other, err := generateAWSIAMToken("bar.local", awsIAMIssuer, aud, newAWSIAMRequest(testAWSIAMAuthorization, aud), time.Now())
+	assert.FatalError(t, err)
+	otherID, err := p.GetTokenID(other)
+	assert.FatalError(t, err)
+	assert.Equals(t, id, otherID)
+
+	// IAM tokens cannot sign SSH certificates.
+	_, err = p.AuthorizeSSHSign(context.Background(), token)
+	var sc render.StatusCodedError
+	assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
@@ -30,9 +29,13 @@ const azureIdentityTokenURL = "http://169.254.169.254/metadata/identity/oauth2/t
 // azureDefaultAudience is the default audience used.
 const azureDefaultAudience = "https://management.azure.com/"
 
-// azureXMSMirIDRegExp is the regular expression used to parse the xms_mirid claim.
-// Using case insensitive as resourceGroups appears as resourcegroups.
-var azureXMSMirIDRegExp = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.(Compute/virtualMachines|ManagedIdentity/userAssignedIdentities)/([^/]+)$`)
+// Resource types of the managed identities with specific attributes.
+const (
+	azureVirtualMachineType         = "Microsoft.Compute/virtualMachines"
+	azureVirtualMachineScaleSetType = "Microsoft.Compute/virtualMachineScaleSets"
+	azureScaleSetInstanceType       = "Microsoft.Compute/virtualMachineScaleSets/virtualMachines"
+	azureUserAssignedIdentityType   = "Microsoft.ManagedIdentity/userAssignedIdentities"
+)
 
 type azureConfig struct {
 	oidcDiscoveryURL string
@@ -67,6 +70,105 @@ type azurePayload struct {
 	TenantID         string `json:"tid"`
 	Version          string `json:"ver"`
 	XMSMirID         string `json:"xms_mirid"`
+	identity         *azureManagedIdentity
+}
+
+// azureManagedIdentity is the resource of a managed identity parsed from the
+// xms_mirid claim. The name is the name of the resource, and in scale set
+// instances the name of the instance, <scale-set>_<instance-id>.
+type azureManagedIdentity struct {
+	ResourceID             string
+	SubscriptionID         string
+	ResourceGroup          string
+	ResourceType           string
+	Name                   string
+	VirtualMachine         string
+	VirtualMachineScaleSet string
+	InstanceID             string
+	ManagedIdentity        string
+}
+
+// parseAzureXMSMirID parses the resource id in the xms_mirid claim. It
+// supports the system-assigned identities of virtual machines, scale sets and
+// scale set instances, and user-assigned identities, with ids like:
+//
+//	/subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Compute/virtualMachines/<name>
+//	/subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Compute/virtualMachineScaleSets/<name>
+//	/subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.Compute/virtualMachineScaleSets/<name>/virtualMachines/<instance-id>
+//	/subscriptions/<id>/resourceGroups/<group>/providers/Microsoft.ManagedIdentity/userAssignedIdentities/<name>
+func parseAzureXMSMirID(s string) (*azureManagedIdentity, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "/"), "/")
+	// Using case insensitive as resourceGroups appears as resourcegroups.
+	if len(parts) < 8 || len(parts)%2 != 0 ||
+		!strings.EqualFold(parts[0], "subscriptions") ||
+		!strings.EqualFold(parts[2], "resourceGroups") ||
+		!strings.EqualFold(parts[4], "providers") ||
+		!strings.HasPrefix(s, "/") {
+		return nil, errors.Errorf("invalid resource id %s", s)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return nil, errors.Errorf("invalid resource id %s", s)
+		}
+	}
+
+	identity := &azureManagedIdentity{
+		ResourceID:     s,
+		SubscriptionID: parts[1],
+		ResourceGroup:  parts[3],
+		Name:           parts[len(parts)-1],
+	}
+	types := []string{parts[5]}
+	for i := 6; i < len(parts); i += 2 {
+		types = append(types, parts[i])
+	}
+	identity.ResourceType = strings.Join(types, "/")
+
+	switch {
+	case strings.EqualFold(identity.ResourceType, azureVirtualMachineType):
+		identity.VirtualMachine = parts[7]
+	case strings.EqualFold(identity.ResourceType, azureVirtualMachineScaleSetType):
+		identity.VirtualMachineScaleSet = parts[7]
+	case strings.EqualFold(identity.ResourceType, azureScaleSetInstanceType):
+		identity.VirtualMachineScaleSet = parts[7]
+		identity.InstanceID = parts[9]
+		identity.VirtualMachine = parts[7] + "_" + parts[9]
+		identity.Name = identity.VirtualMachine
+	case strings.EqualFold(identity.ResourceType, azureUserAssignedIdentityType):
+		identity.ManagedIdentity = parts[7]
+	default:
+		return nil, errors.Errorf("unsupported resource type %s", identity.ResourceType)
+	}
+	return identity, nil
+}
+
+// principals returns the SSH principals of the identity, the name and the
+// scale set name if available.
+func (i *azureManagedIdentity) principals() []string {
+	principals := []string{i.Name}
+	if i.VirtualMachineScaleSet != "" && i.VirtualMachineScaleSet != i.Name {
+		principals = append(principals, i.VirtualMachineScaleSet)
+	}
+	return principals
+}
+
+// templateData returns the data exposed to the templates.
+func (i *azureManagedIdentity) templateData() azureTemplateData {
+	return azureTemplateData(*i)
+}
+
+// azureTemplateData is the data available in the templates under the Azure
+// variable.
+type azureTemplateData struct {
+	ResourceID             string
+	SubscriptionID         string
+	ResourceGroup          string
+	ResourceType           string
+	Name                   string
+	VirtualMachine         string
+	VirtualMachineScaleSet string
+	InstanceID             string
+	ManagedIdentity        string
 }
 
 // Azure is the provisioner that supports identity tokens created from the
@@ -81,27 +183,33 @@ type azurePayload struct {
 // with the same instance will be accepted. By default only the first request
 // will be accepted.
 //
+// If ManagedIdentities or VirtualMachineScaleSets are set, only the
+// user-assigned managed identities, and the scale sets and scale set instances
+// with the given names will be accepted.
+//
 // Microsoft Azure identity docs are available at
 // https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token
 // and https://docs.microsoft.com/en-us/azure/virtual-machines/windows/instance-metadata-service
 type Azure struct {
 	*base
-	ID                     string   `json:"-"`
-	Type                   string   `json:"type"`
-	Name                   string   `json:"name"`
-	TenantID               string   `json:"tenantID"`
-	ResourceGroups         []string `json:"resourceGroups"`
-	SubscriptionIDs        []string `json:"subscriptionIDs"`
-	ObjectIDs              []string `json:"objectIDs"`
-	Audience               string   `json:"audience,omitempty"`
-	DisableCustomSANs      bool     `json:"disableCustomSANs"`
-	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
-	Claims                 *Claims  `json:"claims,omitempty"`
-	Options                *Options `json:"options,omitempty"`
-	config                 *azureConfig
-	oidcConfig             openIDConfiguration
-	keyStore               *keyStore
-	ctl                    *Controller
+	ID                      string   `json:"-"`
+	Type                    string   `json:"type"`
+	Name                    string   `json:"name"`
+	TenantID                string   `json:"tenantID"`
+	ResourceGroups          []string `json:"resourceGroups"`
+	SubscriptionIDs         []string `json:"subscriptionIDs"`
+	ObjectIDs               []string `json:"objectIDs"`
+	ManagedIdentities       []string `json:"managedIdentities,omitempty"`
+	VirtualMachineScaleSets []string `json:"virtualMachineScaleSets,omitempty"`
+	Audience                string   `json:"audience,omitempty"`
+	DisableCustomSANs       bool     `json:"disableCustomSANs"`
+	DisableTrustOnFirstUse  bool     `json:"disableTrustOnFirstUse"`
+	Claims                  *Claims  `json:"claims,omitempty"`
+	Options                 *Options `json:"options,omitempty"`
+	config                  *azureConfig
+	oidcConfig              openIDConfiguration
+	keyStore                *keyStore
+	ctl                     *Controller
 }
 
 // GetID returns the provisioner unique identifier.
@@ -261,22 +369,30 @@ func (p *Azure) authorizeToken(token string) (*azurePayload, string, string, str
 		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; azure token validation failed - invalid tenant id claim (tid)")
 	}
 
-	re := azureXMSMirIDRegExp.FindStringSubmatch(claims.XMSMirID)
-	if len(re) != 5 {
+	identity, err := parseAzureXMSMirID(claims.XMSMirID)
+	if err != nil {
 		return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; error parsing xms_mirid claim - %s", claims.XMSMirID)
 	}
 
-	var subscription, group, name string
-	identityObjectID := claims.ObjectID
-	subscription, group, name = re[1], re[2], re[4]
+	// Filter by user-assigned managed identity or virtual machine scale set
+	// name. If any of the lists is set, the identity must be in one of them.
+	if len(p.ManagedIdentities) > 0 || len(p.VirtualMachineScaleSets) > 0 {
+		switch {
+		case identity.ManagedIdentity != "" && containsFold(p.ManagedIdentities, identity.ManagedIdentity):
+		case identity.VirtualMachineScaleSet != "" && containsFold(p.VirtualMachineScaleSets, identity.VirtualMachineScaleSet):
+		default:
+			return nil, "", "", "", "", errs.Unauthorized("azure.authorizeToken; azure token validation failed - invalid managed identity or virtual machine scale set")
+		}
+	}
 
-	return &claims, name, group, subscription, identityObjectID, nil
+	claims.identity = identity
+	return &claims, identity.Name, identity.ResourceGroup, identity.SubscriptionID, claims.ObjectID, nil
 }
 
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	_, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
+	claims, name, group, subscription, identityObjectID, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSign")
 	}
@@ -326,6 +442,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	// Template options
 	data := x509util.NewTemplateData()
 	data.SetCommonName(name)
+	data.Set("Azure", claims.identity.templateData())
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
@@ -380,7 +497,7 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		return nil, errs.Unauthorized("azure.AuthorizeSSHSign; sshCA is disabled for provisioner '%s'", p.GetName())
 	}
 
-	_, name, _, _, _, err := p.authorizeToken(token)
+	claims, name, _, _, _, err := p.authorizeToken(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "azure.AuthorizeSSHSign")
 	}
@@ -393,7 +510,7 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 	}
 
 	// Validated principals.
-	principals := []string{name}
+	principals := claims.identity.principals()
 
 	// Only enforce known principals if disable custom sans is true.
 	if p.DisableCustomSANs {
@@ -407,6 +524,7 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 
 	// Certificate templates.
 	data := sshutil.CreateTemplateData(sshutil.HostCert, name, principals)
+	data.Set("Azure", claims.identity.templateData())
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
@@ -431,9 +549,22 @@ func (p *Azure) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
 	), nil
 }
 
+// containsFold returns true if the list contains the given value, using case
+// insensitive comparisons as Azure resource names are case insensitive.
+func containsFold(list []string, value string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // assertConfig initializes the config if it has not been initialized
 func (p *Azure) assertConfig() {
 	if p.config == nil {
@@ -713,3 +713,145 @@ func TestAzure_assertConfig(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseAzureXMSMirID(t *testing.T) {
+	prefix := "/subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/"
+	tests := []struct {
+		name    string
+		mirID   string
+		want    *azureManagedIdentity
+		wantErr bool
+	}{
+		{"ok/vm", prefix + "Microsoft.Compute/virtualMachines/vm-1", &azureManagedIdentity{
+			ResourceID: prefix + "Microsoft.Compute/virtualMachines/vm-1", SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "Microsoft.Compute/virtualMachines", Name: "vm-1", VirtualMachine: "vm-1",
+		}, false},
+		{"ok/vm lowercase", "/subscriptions/subscriptionID/resourcegroups/resourceGroup/providers/microsoft.compute/virtualmachines/vm-1", &azureManagedIdentity{
+			ResourceID: "/subscriptions/subscriptionID/resourcegroups/resourceGroup/providers/microsoft.compute/virtualmachines/vm-1", SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "microsoft.compute/virtualmachines", Name: "vm-1", VirtualMachine: "vm-1",
+		}, false},
+		{"ok/vmss", prefix + "Microsoft.Compute/virtualMachineScaleSets/web", &azureManagedIdentity{
+			ResourceID: prefix + "Microsoft.Compute/virtualMachineScaleSets/web", SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "Microsoft.Compute/virtualMachineScaleSets", Name: "web", VirtualMachineScaleSet: "web",
+		}, false},
+		{"ok/vmss instance", prefix + "Microsoft.Compute/virtualMachineScaleSets/web/virtualMachines/3", &azureManagedIdentity{
+			ResourceID: prefix + "Microsoft.Compute/virtualMachineScaleSets/web/virtualMachines/3", SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "Microsoft.Compute/virtualMachineScaleSets/virtualMachines", Name: "web_3", VirtualMachine: "web_3", VirtualMachineScaleSet: "web", InstanceID: "3",
+		}, false},
+		{"ok/user-assigned", prefix + "Microsoft.ManagedIdentity/userAssignedIdentities/app", &azureManagedIdentity{
+			ResourceID: prefix + "Microsoft.ManagedIdentity/userAssignedIdentities/app", SubscriptionID: "subscriptionID", ResourceGroup: "resourceGroup",
+			ResourceType: "Microsoft.ManagedIdentity/userAssignedIdentities", Name: "app", ManagedIdentity: "app",
+		}, false},
+		{"fail/empty", "", nil, true},
+		{"fail/relative", "subscriptions/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/vm-1", nil, true},
+		{"fail/subscriptions", "/subscription/subscriptionID/resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/vm-1", nil, true},
+		{"fail/resourceGroups", "/subscriptions/subscriptionID/groups/resourceGroup/providers/Microsoft.Compute/virtualMachines/vm-1", nil, true},
+		{"fail/providers", "/subscriptions/subscriptionID/resourceGroups/resourceGroup/provider/Microsoft.Compute/virtualMachines/vm-1", nil, true},
+		{"fail/missing name", prefix + "Microsoft.Compute/virtualMachines", nil, true},
+		{"fail/empty name", prefix + "Microsoft.Compute/virtualMachines/", nil, true},
+		{"fail/other", prefix + "Microsoft.Web/sites/my-app", nil, true},
+		{"fail/vm extension", prefix + "Microsoft.Compute/virtualMachines/vm-1/extensions/ext", nil, true},
+		{"fail/empty segment", "/subscriptions//resourceGroups/resourceGroup/providers/Microsoft.Compute/virtualMachines/vm-1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAzureXMSMirID(tt.mirID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAzureXMSMirID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestAzure_AuthorizeSign_managedIdentities(t *testing.T) {
+	newProvisioner := func(t *testing.T, identities, scaleSets []string) *Azure {
+		t.Helper()
+		p, err := generateAzure()
+		assert.FatalError(t, err)
+		p.ManagedIdentities = identities
+		p.VirtualMachineScaleSets = scaleSets
+		return p
+	}
+	p1 := newProvisioner(t, nil, nil)
+	p2 := newProvisioner(t, []string{"App"}, []string{"Web"})
+	p2.DisableCustomSANs = true
+	p3 := newProvisioner(t, []string{"App"}, nil)
+	p4 := newProvisioner(t, nil, []string{"Web"})
+
+	mustToken := func(p *Azure, name, resourceType string) string {
+		tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+			p.TenantID, "subscriptionID", "resourceGroup", name, resourceType,
+			time.Now(), &p.keyStore.keySet.Keys[0])
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name    string
+		p       *Azure
+		token   string
+		cn      string
+		wantLen int
+		wantErr bool
+	}{
+		{"ok/vmss", p1, mustToken(p1, "web", "vmss"), "web", 7, false},
+		{"ok/vmss instance", p1, mustToken(p1, "web", "vmss-instance"), "web_3", 7, false},
+		{"ok/user-assigned", p1, mustToken(p1, "app", "uai"), "app", 7, false},
+		{"ok/allowed vmss", p2, mustToken(p2, "web", "vmss-instance"), "web_3", 12, false},
+		{"ok/allowed user-assigned", p2, mustToken(p2, "app", "uai"), "app", 12, false},
+		{"fail/vmss", p2, mustToken(p2, "db", "vmss"), "", 0, true},
+		{"fail/vmss instance", p2, mustToken(p2, "db", "vmss-instance"), "", 0, true},
+		{"fail/user-assigned", p2, mustToken(p2, "other", "uai"), "", 0, true},
+		{"fail/vm", p2, mustToken(p2, "vm-1", "vm"), "", 0, true},
+		{"fail/vm with identities", p3, mustToken(p3, "vm-1", "vm"), "", 0, true},
+		{"fail/vmss with identities", p3, mustToken(p3, "web", "vmss"), "", 0, true},
+		{"fail/vm with scale sets", p4, mustToken(p4, "vm-1", "vm"), "", 0, true},
+		{"fail/user-assigned with scale sets", p4, mustToken(p4, "app", "uai"), "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.AuthorizeSign(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Azure.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+				return
+			}
+			assert.Equals(t, tt.wantLen, len(got))
+			for _, o := range got {
+				switch v := o.(type) {
+				case commonNameValidator:
+					assert.Equals(t, tt.cn, string(v))
+				case dnsNamesValidator:
+					assert.Equals(t, []string{tt.cn}, []string(v))
+				}
+			}
+		})
+	}
+}
+
+func TestAzure_AuthorizeSSHSign_scaleSet(t *testing.T) {
+	p, err := generateAzure()
+	assert.FatalError(t, err)
+	p.DisableCustomSANs = true
+
+	tok, err := generateAzureToken("subject", p.oidcConfig.Issuer, azureDefaultAudience,
+		p.TenantID, "subscriptionID", "resourceGroup", "web", "vmss-instance",
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	opts, err := p.AuthorizeSSHSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	var found bool
+	for _, o := range opts {
+		if v, ok := o.(sshCertOptionsValidator); ok {
+			found = true
+			assert.Equals(t, []string{"web_3", "web"}, v.Principals)
+		}
+	}
+	assert.True(t, found, "sshCertOptionsValidator not found")
+}
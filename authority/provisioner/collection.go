@@ -83,6 +83,22 @@ func (c *Collection) LoadByTokenID(tokenProvisionerID string) (Interface, bool)
 
 // LoadByToken parses the token claims and loads the provisioner associated.
 func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims) (Interface, bool) {
+	// The ID will be just the clientID stored in azp, aud or tid.
+	var payload loadByTokenPayload
+	if err := token.UnsafeClaimsWithoutVerification(&payload); err != nil {
+		return nil, false
+	}
+
+	if p, ok := c.loadByToken(token, claims, &payload); ok {
+		return p, ok
+	}
+
+	// Bound projected service account tokens use the cluster issuer, fallback
+	// to the K8sSA provisioner if it is configured with that issuer.
+	return c.loadK8sSAByIssuer(payload.Issuer)
+}
+
+func (c *Collection) loadByToken(token *jose.JSONWebToken, claims *jose.Claims, payload *loadByTokenPayload) (Interface, bool) {
 	var audiences []string
 	// Get all audiences with the given fragment
 	fragment := extractFragment(claims.Audience)
@@ -104,12 +120,6 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 		return c.LoadByTokenID(claims.Issuer + ":" + token.Headers[0].KeyID)
 	}
 
-	// The ID will be just the clientID stored in azp, aud or tid.
-	var payload loadByTokenPayload
-	if err := token.UnsafeClaimsWithoutVerification(&payload); err != nil {
-		return nil, false
-	}
-
 	// Kubernetes Service Account tokens.
 	if payload.Issuer == k8sSAIssuer {
 		if p, ok := c.LoadByTokenID(K8sSAID); ok {
@@ -148,6 +158,22 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 	return c.LoadByTokenID(payload.Audience[0])
 }
 
+// loadK8sSAByIssuer returns the K8sSA provisioner if it is configured with the
+// given service account issuer.
+func (c *Collection) loadK8sSAByIssuer(issuer string) (Interface, bool) {
+	if issuer == "" {
+		return nil, false
+	}
+	p, ok := c.LoadByTokenID(K8sSAID)
+	if !ok {
+		return nil, false
+	}
+	if k, ok := p.(*K8sSA); ok && k.Issuer == issuer {
+		return p, true
+	}
+	return nil, false
+}
+
 // LoadByCertificate looks for the provisioner extension and extracts the
 // proper id to load the provisioner.
 func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool) {
@@ -105,6 +105,37 @@ func TestCollection_LoadByToken(t *testing.T) {
 	t5, c5, err := parseToken(token)
 	assert.FatalError(t, err)
 
+	// Bound projected service account tokens
+	p5, err := generateK8sSA(nil)
+	assert.FatalError(t, err)
+	p5.Issuer = "https://kubernetes.default.svc.cluster.local"
+	byID3 := new(sync.Map)
+	byID3.Store(p1.GetID(), p1)
+	byID3.Store(p3.GetID(), p3)
+	byID3.Store(p5.GetID(), p5)
+
+	newProjectedToken := func(iss, aud string) (*jose.JSONWebToken, *jose.Claims) {
+		claims := getK8sSAPayload()
+		claims.Claims = jose.Claims{
+			Issuer:   iss,
+			Subject:  "system:serviceaccount:ns-foo:san-foo",
+			Audience: jose.Audience{aud},
+		}
+		claims.Kubernetes = &k8sSAKubernetesClaims{
+			Namespace:      "ns-foo",
+			ServiceAccount: &k8sSAObjectReference{Name: "san-foo", UID: "sauid-foo"},
+		}
+		token, err := generateK8sSAToken(jwk, claims)
+		assert.FatalError(t, err)
+		tok, c, err := parseToken(token)
+		assert.FatalError(t, err)
+		return tok, c
+	}
+	t6, c6 := newProjectedToken(p5.Issuer, testAudiences.Sign[0])
+	t7, c7 := newProjectedToken(p5.Issuer, "my-audience")
+	t8, c8 := newProjectedToken(p3.configuration.Issuer, p3.ClientID)
+	t9, c9 := newProjectedToken("https://foo.cluster.local", testAudiences.Sign[0])
+
 	type fields struct {
 		byID      *sync.Map
 		audiences Audiences
@@ -127,6 +158,11 @@ func TestCollection_LoadByToken(t *testing.T) {
 		{"bad", fields{byID, testAudiences}, args{t4, c4}, nil, false},
 		{"fail", fields{byID, Audiences{Sign: []string{"https://foo"}}}, args{t1, c1}, nil, false},
 		{"fail-no-k8sSa-provisioner", fields{byID2, testAudiences}, args{t5, c5}, nil, false},
+		{"ok-k8sSa-projected", fields{byID3, testAudiences}, args{t6, c6}, p5, true},
+		{"ok-k8sSa-projected-audience", fields{byID3, testAudiences}, args{t7, c7}, p5, true},
+		{"ok-kubernetes-claim-other-provisioner", fields{byID3, testAudiences}, args{t8, c8}, p3, true},
+		{"fail-k8sSa-projected-issuer", fields{byID3, testAudiences}, args{t9, c9}, nil, false},
+		{"fail-k8sSa-projected-no-provisioner", fields{byID2, testAudiences}, args{t6, c6}, nil, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
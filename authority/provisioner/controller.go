@@ -22,7 +22,10 @@ type Controller struct {
 	IdentityFunc          GetIdentityFunc
 	AuthorizeRenewFunc    AuthorizeRenewFunc
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
+	IsRevokedFunc         IsRevokedFunc
 	policy                *policyEngine
+	sshHostKeyAttestation *SSHHostKeyAttestationOptions
+	sshStepUp             *SSHStepUpOptions
 }
 
 // NewController initializes a new provisioner controller.
@@ -35,6 +38,14 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 	if err != nil {
 		return nil, err
 	}
+	sshHostKeyAttestation := options.GetSSHOptions().GetHostKeyAttestation()
+	if err := sshHostKeyAttestation.Init(); err != nil {
+		return nil, err
+	}
+	sshStepUp := options.GetSSHOptions().GetStepUp()
+	if err := sshStepUp.Validate(); err != nil {
+		return nil, err
+	}
 	return &Controller{
 		Interface:             p,
 		Audiences:             &config.Audiences,
@@ -42,7 +53,10 @@ func NewController(p Interface, claims *Claims, config Config, options *Options)
 		IdentityFunc:          config.GetIdentityFunc,
 		AuthorizeRenewFunc:    config.AuthorizeRenewFunc,
 		AuthorizeSSHRenewFunc: config.AuthorizeSSHRenewFunc,
+		IsRevokedFunc:         config.IsRevokedFunc,
 		policy:                policy,
+		sshHostKeyAttestation: sshHostKeyAttestation,
+		sshStepUp:             sshStepUp,
 	}, nil
 }
 
@@ -72,6 +86,16 @@ func (c *Controller) AuthorizeSSHRenew(ctx context.Context, cert *ssh.Certificat
 	return DefaultAuthorizeSSHRenew(ctx, c, cert)
 }
 
+// IsRevoked returns true if the leaf certificate of the given verified chain
+// has been revoked in the authority. It always returns false if the controller
+// does not have an IsRevokedFunc.
+func (c *Controller) IsRevoked(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+	if c.IsRevokedFunc != nil {
+		return c.IsRevokedFunc(ctx, chain)
+	}
+	return false, nil
+}
+
 // Identity is the type representing an externally supplied identity that is used
 // by provisioners to populate certificate fields.
 type Identity struct {
@@ -90,6 +114,10 @@ type AuthorizeRenewFunc func(ctx context.Context, p *Controller, cert *x509.Cert
 // given SSH certificate is enabled.
 type AuthorizeSSHRenewFunc func(ctx context.Context, p *Controller, cert *ssh.Certificate) error
 
+// IsRevokedFunc is a function that returns true if the leaf certificate of the
+// given verified chain has been revoked.
+type IsRevokedFunc func(ctx context.Context, chain []*x509.Certificate) (bool, error)
+
 // DefaultIdentityFunc return a default identity depending on the provisioner
 // type. For OIDC email is always present and the usernames might
 // contain empty strings.
@@ -208,3 +236,17 @@ func (c *Controller) getPolicy() *policyEngine {
 	}
 	return c.policy
 }
+
+func (c *Controller) getSSHHostKeyAttestation() *SSHHostKeyAttestationOptions {
+	if c == nil {
+		return nil
+	}
+	return c.sshHostKeyAttestation
+}
+
+func (c *Controller) getSSHStepUp() *SSHStepUpOptions {
+	if c == nil {
+		return nil
+	}
+	return c.sshStepUp
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"fmt"
+	"math/big"
 	"reflect"
 	"testing"
 	"time"
@@ -125,6 +126,22 @@ func TestNewController(t *testing.T) {
 				},
 			},
 		}}, nil, true},
+		{"fail host key attestation options", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SSH: &SSHOptions{
+				HostKeyAttestation: &SSHHostKeyAttestationOptions{RequireTPM: true},
+			},
+		}}, nil, true},
+		{"fail step-up options", args{&JWK{}, nil, Config{
+			Claims:    globalProvisionerClaims,
+			Audiences: testAudiences,
+		}, &Options{
+			SSH: &SSHOptions{
+				StepUp: &SSHStepUpOptions{},
+			},
+		}}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -330,6 +347,43 @@ func TestController_AuthorizeSSHRenew(t *testing.T) {
 	}
 }
 
+func TestController_IsRevoked(t *testing.T) {
+	ctx := context.Background()
+	chain := []*x509.Certificate{{SerialNumber: big.NewInt(1234)}}
+	tests := []struct {
+		name          string
+		isRevokedFunc IsRevokedFunc
+		want          bool
+		wantErr       bool
+	}{
+		{"ok nil", nil, false, false},
+		{"ok revoked", func(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+			return chain[0].SerialNumber.String() == "1234", nil
+		}, true, false},
+		{"ok not revoked", func(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+			return chain[0].SerialNumber.String() == "5678", nil
+		}, false, false},
+		{"fail", func(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+			return false, fmt.Errorf("an error")
+		}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{
+				Interface:     &JWK{},
+				IsRevokedFunc: tt.isRevokedFunc,
+			}
+			got, err := c.IsRevoked(ctx, chain)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Controller.IsRevoked() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Controller.IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDefaultAuthorizeRenew(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now().Truncate(time.Second)
@@ -0,0 +1,243 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultCRLRefreshInterval is the interval used to refresh a CRL from a
+	// URL if it does not have a next update time.
+	defaultCRLRefreshInterval = time.Hour
+	// defaultCRLGracePeriod is the time an expired CRL from a URL is still
+	// used while it cannot be refreshed.
+	defaultCRLGracePeriod = 24 * time.Hour
+	// crlRetryInterval is the minimum time between two attempts to refresh an
+	// expired CRL from a URL.
+	crlRetryInterval = time.Minute
+	// defaultCRLTimeout is the timeout used to download a CRL.
+	defaultCRLTimeout = 10 * time.Second
+	// maxCRLSize is the maximum size of a CRL.
+	maxCRLSize = 50 << 20
+)
+
+// crlStore is a list of CRLs used to check if a certificate has been revoked.
+// The CRLs are loaded from files or http(s) URLs. Files are loaded again when
+// they change, and URLs after the next update time of the CRL.
+//
+// An expired CRL from a URL is refreshed in the background, and it is still
+// used until the refresh succeeds or the grace period ends. After that, the
+// CRL must be downloaded before checking a certificate.
+//
+// Each source has its own lock, so a slow download only blocks the requests
+// that need that CRL, and a CRL is downloaded once by concurrent requests.
+type crlStore struct {
+	sources []string
+	client  *http.Client
+	grace   time.Duration
+	locks   map[string]*sync.Mutex
+	mu      sync.RWMutex
+	entries map[string]*crlEntry
+	retries map[string]time.Time
+}
+
+type crlEntry struct {
+	list    *pkix.CertificateList
+	revoked map[string]struct{}
+	modTime time.Time
+	size    int64
+	expires time.Time
+}
+
+// newCRLStore initializes a CRL store with the given sources and loads them.
+func newCRLStore(sources []string) (*crlStore, error) {
+	s := &crlStore{
+		sources: sources,
+		client:  &http.Client{Timeout: defaultCRLTimeout},
+		grace:   defaultCRLGracePeriod,
+		locks:   make(map[string]*sync.Mutex, len(sources)),
+		entries: make(map[string]*crlEntry),
+		retries: make(map[string]time.Time),
+	}
+	for _, src := range sources {
+		s.locks[src] = new(sync.Mutex)
+	}
+	for _, src := range sources {
+		if _, err := s.get(src); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// IsRevoked returns true if any of the certificates in the chain has been
+// revoked by its issuer in one of the CRLs. The chain must be ordered, starting
+// with the leaf, and finishing with the root.
+func (s *crlStore) IsRevoked(chain []*x509.Certificate) (bool, error) {
+	var lists []*crlEntry
+	for _, src := range s.sources {
+		e, err := s.get(src)
+		if err != nil {
+			return false, err
+		}
+		lists = append(lists, e)
+	}
+
+	for i := 0; i+1 < len(chain); i++ {
+		crt, issuer := chain[i], chain[i+1]
+		for _, e := range lists {
+			if issuer.CheckCRLSignature(e.list) != nil {
+				continue
+			}
+			if _, ok := e.revoked[crt.SerialNumber.String()]; ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// get returns the CRL for the given source. It loads the CRL again if it has
+// changed or expired.
+func (s *crlStore) get(src string) (*crlEntry, error) {
+	if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
+		return s.getURL(src)
+	}
+
+	lock := s.locks[src]
+	lock.Lock()
+	defer lock.Unlock()
+	return s.getFile(src)
+}
+
+func (s *crlStore) load(src string) (*crlEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[src]
+	return e, ok
+}
+
+func (s *crlStore) store(src string, e *crlEntry) {
+	s.mu.Lock()
+	s.entries[src] = e
+	s.mu.Unlock()
+}
+
+func (s *crlStore) getURL(src string) (*crlEntry, error) {
+	now := time.Now()
+	if e, ok := s.load(src); ok && now.Before(e.expires.Add(s.grace)) {
+		if !now.Before(e.expires) {
+			s.refresh(src, now)
+		}
+		return e, nil
+	}
+
+	lock := s.locks[src]
+	lock.Lock()
+	defer lock.Unlock()
+
+	// The CRL might have been downloaded while waiting for the lock.
+	if e, ok := s.load(src); ok && time.Now().Before(e.expires) {
+		return e, nil
+	}
+	return s.download(src)
+}
+
+// refresh downloads an expired CRL in the background. Only one download is
+// attempted per retry interval, if it fails, the expired CRL is used until the
+// next attempt.
+func (s *crlStore) refresh(src string, now time.Time) {
+	s.mu.Lock()
+	if now.Before(s.retries[src]) {
+		s.mu.Unlock()
+		return
+	}
+	s.retries[src] = now.Add(crlRetryInterval)
+	s.mu.Unlock()
+
+	go func() {
+		lock := s.locks[src]
+		lock.Lock()
+		defer lock.Unlock()
+		if e, ok := s.load(src); ok && time.Now().Before(e.expires) {
+			return
+		}
+		_, _ = s.download(src)
+	}()
+}
+
+// download downloads and stores the CRL from the given URL.
+func (s *crlStore) download(src string) (*crlEntry, error) {
+	now := time.Now()
+	resp, err := s.client.Get(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading crl from %s", src)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error downloading crl from %s: status code %d", src, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxCRLSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading crl from %s", src)
+	}
+
+	e, err := newCRLEntry(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing crl from %s", src)
+	}
+	e.expires = now.Add(defaultCRLRefreshInterval)
+	if next := e.list.TBSCertList.NextUpdate; !next.IsZero() {
+		e.expires = next
+	}
+	s.store(src, e)
+	return e, nil
+}
+
+func (s *crlStore) getFile(src string) (*crlEntry, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", src)
+	}
+	if e, ok := s.load(src); ok && fi.ModTime().Equal(e.modTime) && fi.Size() == e.size {
+		return e, nil
+	}
+
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", src)
+	}
+	e, err := newCRLEntry(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", src)
+	}
+	e.modTime = fi.ModTime()
+	e.size = fi.Size()
+	s.store(src, e)
+	return e, nil
+}
+
+// newCRLEntry parses a PEM or DER encoded CRL.
+func newCRLEntry(b []byte) (*crlEntry, error) {
+	//nolint:staticcheck // x509.ParseRevocationList requires Go 1.19.
+	list, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, err
+	}
+	revoked := make(map[string]struct{}, len(list.TBSCertList.RevokedCertificates))
+	for _, rc := range list.TBSCertList.RevokedCertificates {
+		revoked[rc.SerialNumber.String()] = struct{}{}
+	}
+	return &crlEntry{
+		list:    list,
+		revoked: revoked,
+	}, nil
+}
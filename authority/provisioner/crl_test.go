@@ -0,0 +1,447 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+)
+
+// generateCRL returns a DER encoded CRL signed by the given issuer, with the
+// given serial numbers revoked.
+func generateCRL(t *testing.T, issuer *x509.Certificate, signer crypto.Signer, nextUpdate time.Time, serials ...*big.Int) []byte {
+	t.Helper()
+	var revoked []pkix.RevokedCertificate
+	for _, sn := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{
+			SerialNumber:   sn,
+			RevocationTime: time.Now(),
+		})
+	}
+	b, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Now().Add(-time.Minute),
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: revoked,
+	}, issuer, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// generateX5CLeaf returns a client certificate signed by the given CA, and a
+// JWK with its key.
+func generateX5CLeaf(t *testing.T, ca *minica.CA) (*x509.Certificate, *jose.JSONWebKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "leaf"},
+		DNSNames:    []string{"leaf"},
+		PublicKey:   key.Public(),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt, &jose.JSONWebKey{Key: key, KeyID: "leaf"}
+}
+
+func writeFile(t *testing.T, fn string, b []byte) {
+	t.Helper()
+	if err := os.WriteFile(fn, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_newCRLStore(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	der := generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Hour))
+	derFile := filepath.Join(dir, "crl.der")
+	writeFile(t, derFile, der)
+	pemFile := filepath.Join(dir, "crl.pem")
+	writeFile(t, pemFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}))
+	badFile := filepath.Join(dir, "bad.crl")
+	writeFile(t, badFile, []byte("foo"))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/crl":
+			_, _ = w.Write(der)
+		case "/bad":
+			_, _ = w.Write([]byte("foo"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		sources []string
+		wantErr bool
+	}{
+		{"ok/der", []string{derFile}, false},
+		{"ok/pem", []string{pemFile}, false},
+		{"ok/url", []string{srv.URL + "/crl"}, false},
+		{"ok/multiple", []string{derFile, pemFile, srv.URL + "/crl"}, false},
+		{"fail/missing", []string{filepath.Join(dir, "missing.crl")}, true},
+		{"fail/bad", []string{badFile}, true},
+		{"fail/url-bad", []string{srv.URL + "/bad"}, true},
+		{"fail/url-not-found", []string{srv.URL + "/missing"}, true},
+		{"fail/url", []string{"http://127.0.0.1:0/crl"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newCRLStore(tt.sources); (err != nil) != tt.wantErr {
+				t.Errorf("newCRLStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_crlStore_IsRevoked(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedLeaf, _ := generateX5CLeaf(t, ca)
+	leaf, _ := generateX5CLeaf(t, ca)
+	otherLeaf, _ := generateX5CLeaf(t, other)
+
+	dir := t.TempDir()
+	nextUpdate := time.Now().Add(time.Hour)
+	leafCRL := filepath.Join(dir, "leaf.crl")
+	writeFile(t, leafCRL, generateCRL(t, ca.Intermediate, ca.Signer, nextUpdate, revokedLeaf.SerialNumber))
+	intermediateCRL := filepath.Join(dir, "intermediate.crl")
+	writeFile(t, intermediateCRL, generateCRL(t, ca.Root, ca.RootSigner, nextUpdate, ca.Intermediate.SerialNumber))
+	// A CRL from another issuer with the same serial numbers.
+	otherCRL := filepath.Join(dir, "other.crl")
+	writeFile(t, otherCRL, generateCRL(t, other.Intermediate, other.Signer, nextUpdate, leaf.SerialNumber, otherLeaf.SerialNumber))
+
+	tests := []struct {
+		name    string
+		sources []string
+		chain   []*x509.Certificate
+		want    bool
+	}{
+		{"revoked leaf", []string{leafCRL}, []*x509.Certificate{revokedLeaf, ca.Intermediate, ca.Root}, true},
+		{"not revoked", []string{leafCRL}, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}, false},
+		{"revoked intermediate", []string{leafCRL, intermediateCRL}, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}, true},
+		{"other issuer", []string{otherCRL}, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}, false},
+		{"other issuer revoked", []string{leafCRL, otherCRL}, []*x509.Certificate{otherLeaf, other.Intermediate, other.Root}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newCRLStore(tt.sources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.IsRevoked(tt.chain)
+			if err != nil {
+				t.Fatalf("crlStore.IsRevoked() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("crlStore.IsRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_crlStore_reload(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := generateX5CLeaf(t, ca)
+	chain := []*x509.Certificate{leaf, ca.Intermediate, ca.Root}
+
+	// The CRL served by URL expires in a second.
+	var hits int32
+	crl := generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Second))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) > 1 {
+			crl = generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Hour), leaf.SerialNumber)
+		}
+		_, _ = w.Write(crl)
+	}))
+	defer srv.Close()
+
+	fn := filepath.Join(t.TempDir(), "leaf.crl")
+	writeFile(t, fn, generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Hour)))
+
+	assertRevoked := func(t *testing.T, s *crlStore, want bool) {
+		t.Helper()
+		got, err := s.IsRevoked(chain)
+		if err != nil {
+			t.Fatalf("crlStore.IsRevoked() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("crlStore.IsRevoked() = %v, want %v", got, want)
+		}
+	}
+
+	t.Run("file", func(t *testing.T) {
+		s, err := newCRLStore([]string{fn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertRevoked(t, s, false)
+
+		// The modification time is changed explicitly as the resolution of
+		// the file system might be too coarse.
+		writeFile(t, fn, generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Hour), leaf.SerialNumber))
+		future := time.Now().Add(time.Minute)
+		if err := os.Chtimes(fn, future, future); err != nil {
+			t.Fatal(err)
+		}
+		assertRevoked(t, s, true)
+
+		// Invalid CRLs are not ignored.
+		writeFile(t, fn, []byte("foo"))
+		if _, err := s.IsRevoked(chain); err == nil {
+			t.Error("crlStore.IsRevoked() error = nil, want error")
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		s, err := newCRLStore([]string{srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertRevoked(t, s, false)
+		if got := atomic.LoadInt32(&hits); got != 1 {
+			t.Errorf("crlStore hits = %d, want 1", got)
+		}
+		// The expired CRL is used while it is refreshed in the background.
+		time.Sleep(1100 * time.Millisecond)
+		assertRevoked(t, s, false)
+		waitForRevoked(t, s, chain)
+		assertRevoked(t, s, true)
+		if got := atomic.LoadInt32(&hits); got != 2 {
+			t.Errorf("crlStore hits = %d, want 2", got)
+		}
+	})
+}
+
+// waitForRevoked waits until the background refresh of the CRL revokes the
+// given chain.
+func waitForRevoked(t *testing.T, s *crlStore, chain []*x509.Certificate) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		revoked, err := s.IsRevoked(chain)
+		if err != nil {
+			t.Fatalf("crlStore.IsRevoked() error = %v", err)
+		}
+		if revoked {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("crlStore.IsRevoked() = false, want true")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_crlStore_backgroundRefresh(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := generateX5CLeaf(t, ca)
+	chain := []*x509.Certificate{leaf, ca.Intermediate, ca.Root}
+
+	// The first CRL expires in a second, and the next download blocks until
+	// all the requests have used the expired one.
+	var hits int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			_, _ = w.Write(generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Second)))
+			return
+		}
+		<-release
+		_, _ = w.Write(generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Hour), leaf.SerialNumber))
+	}))
+	defer srv.Close()
+
+	s, err := newCRLStore([]string{srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := s.IsRevoked(chain)
+			if err != nil {
+				t.Errorf("crlStore.IsRevoked() error = %v", err)
+			}
+			if got {
+				t.Error("crlStore.IsRevoked() = true, want false")
+			}
+		}()
+	}
+	wg.Wait()
+	close(release)
+
+	waitForRevoked(t, s, chain)
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Errorf("crlStore hits = %d, want 2", got)
+	}
+}
+
+func Test_crlStore_gracePeriod(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := generateX5CLeaf(t, ca)
+	chain := []*x509.Certificate{leaf, ca.Intermediate, ca.Root}
+
+	// The first CRL expires in a second, and the next downloads fail.
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			_, _ = w.Write(generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Second), leaf.SerialNumber))
+			return
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s, err := newCRLStore([]string{srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	// The expired CRL is used during the grace period, and the refresh is not
+	// retried before the retry interval.
+	for i := 0; i < 3; i++ {
+		got, err := s.IsRevoked(chain)
+		if err != nil {
+			t.Fatalf("crlStore.IsRevoked() error = %v", err)
+		}
+		if !got {
+			t.Error("crlStore.IsRevoked() = false, want true")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&hits) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Errorf("crlStore hits = %d, want 2", got)
+	}
+
+	// After the grace period the CRL must be downloaded.
+	s.grace = 0
+	if _, err := s.IsRevoked(chain); err == nil {
+		t.Error("crlStore.IsRevoked() error = nil, want error")
+	}
+}
+
+func TestX5C_authorizeToken_revoked(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedLeaf, revokedKey := generateX5CLeaf(t, ca)
+	leaf, key := generateX5CLeaf(t, ca)
+	crlFile := filepath.Join(t.TempDir(), "leaf.crl")
+	writeFile(t, crlFile, generateCRL(t, ca.Intermediate, ca.Signer, time.Now().Add(time.Hour), revokedLeaf.SerialNumber))
+
+	newProvisioner := func(t *testing.T, crls []string, fn IsRevokedFunc) *X5C {
+		p := &X5C{
+			Type:  "X5C",
+			Name:  "x5c",
+			Roots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+			CRLs:  crls,
+		}
+		if err := p.Init(Config{
+			Claims:        globalProvisionerClaims,
+			Audiences:     testAudiences,
+			IsRevokedFunc: fn,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	newToken := func(t *testing.T, crt *x509.Certificate, jwk *jose.JSONWebKey) string {
+		tok, err := generateToken("leaf", "x5c", testAudiences.Sign[0], "", []string{"leaf"}, time.Now(), jwk,
+			withX5CHdr([]*x509.Certificate{crt, ca.Intermediate}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	isRevoked := func(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+		return chain[0].SerialNumber.Cmp(revokedLeaf.SerialNumber) == 0, nil
+	}
+	isRevokedFail := func(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+		return false, errors.New("an error")
+	}
+
+	tests := []struct {
+		name    string
+		p       *X5C
+		token   string
+		wantErr string
+	}{
+		{"ok", newProvisioner(t, nil, nil), newToken(t, revokedLeaf, revokedKey), ""},
+		{"ok/db", newProvisioner(t, nil, isRevoked), newToken(t, leaf, key), ""},
+		{"ok/crl", newProvisioner(t, []string{crlFile}, nil), newToken(t, leaf, key), ""},
+		{"fail/db", newProvisioner(t, nil, isRevoked), newToken(t, revokedLeaf, revokedKey), "has been revoked"},
+		{"fail/db-error", newProvisioner(t, nil, isRevokedFail), newToken(t, leaf, key), "error checking x5c certificate revocation"},
+		{"fail/crl", newProvisioner(t, []string{crlFile}, nil), newToken(t, revokedLeaf, revokedKey), "has been revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.p.authorizeToken(context.Background(), tt.token, testAudiences.Sign)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("X5C.authorizeToken() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("X5C.authorizeToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
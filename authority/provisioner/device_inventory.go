@@ -0,0 +1,176 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultDeviceInventoryTimeout is the default timeout used in the requests to
+// a device inventory webhook.
+const defaultDeviceInventoryTimeout = 10 * time.Second
+
+var (
+	// ErrDeviceNotEnrolled is the error returned by a device inventory if the
+	// device is not enrolled.
+	ErrDeviceNotEnrolled = errors.New("device is not enrolled")
+	// ErrDeviceDecommissioned is the error returned by a device inventory if
+	// the device has been decommissioned.
+	ErrDeviceDecommissioned = errors.New("device is decommissioned")
+)
+
+// DeviceStatus is the status of a device in a device inventory.
+type DeviceStatus string
+
+const (
+	// DeviceStatusActive is the status of an enrolled device.
+	DeviceStatusActive DeviceStatus = "active"
+	// DeviceStatusDecommissioned is the status of a device that is not in use
+	// anymore and it must not get new certificates.
+	DeviceStatusDecommissioned DeviceStatus = "decommissioned"
+)
+
+// Device is a device in a device inventory.
+type Device struct {
+	PermanentIdentifier string                 `json:"permanentIdentifier"`
+	Status              DeviceStatus           `json:"status,omitempty"`
+	Data                map[string]interface{} `json:"data,omitempty"`
+}
+
+// DeviceLookupRequest is the body of the request sent to a device inventory
+// webhook.
+type DeviceLookupRequest struct {
+	Provisioner         string `json:"provisioner"`
+	PermanentIdentifier string `json:"permanentIdentifier"`
+}
+
+// DeviceInventory configures the inventory used by the ACME provisioner to
+// confirm that the devices using the device-attest-01 challenge are enrolled.
+//
+// The inventory can be a webhook or a local file with a JSON list of devices.
+// A webhook receives a POST request with a DeviceLookupRequest and it must
+// return a Device, or a 404 status code if the device is not enrolled.
+type DeviceInventory struct {
+	URL         string    `json:"url,omitempty"`
+	BearerToken string    `json:"bearerToken,omitempty"`
+	Timeout     *Duration `json:"timeout,omitempty"`
+	File        string    `json:"file,omitempty"`
+	client      *http.Client
+}
+
+// Validate validates and initializes the device inventory.
+func (d *DeviceInventory) Validate() error {
+	switch {
+	case d == nil:
+		return nil
+	case d.URL == "" && d.File == "":
+		return errors.New("deviceInventory must have a url or a file")
+	case d.URL != "" && d.File != "":
+		return errors.New("deviceInventory cannot have both a url and a file")
+	case d.URL != "" && !strings.HasPrefix(d.URL, "https://") && !strings.HasPrefix(d.URL, "http://"):
+		return errors.Errorf("deviceInventory url %s is not valid", d.URL)
+	}
+
+	timeout := defaultDeviceInventoryTimeout
+	if d.Timeout != nil && d.Timeout.Value() > 0 {
+		timeout = d.Timeout.Value()
+	}
+	d.client = &http.Client{Timeout: timeout}
+	return nil
+}
+
+// Lookup returns the device with the given permanent identifier. It returns
+// ErrDeviceNotEnrolled if the device is not in the inventory, and
+// ErrDeviceDecommissioned if the device has been decommissioned.
+func (d *DeviceInventory) Lookup(ctx context.Context, provisionerName, permanentIdentifier string) (*Device, error) {
+	var (
+		device *Device
+		err    error
+	)
+	if d.URL != "" {
+		device, err = d.lookupWebhook(ctx, provisionerName, permanentIdentifier)
+	} else {
+		device, err = d.lookupFile(permanentIdentifier)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch device.Status {
+	case "", DeviceStatusActive:
+		return device, nil
+	case DeviceStatusDecommissioned:
+		return nil, ErrDeviceDecommissioned
+	default:
+		return nil, errors.Errorf("device %s has an unexpected status %s", permanentIdentifier, device.Status)
+	}
+}
+
+func (d *DeviceInventory) lookupWebhook(ctx context.Context, provisionerName, permanentIdentifier string) (*Device, error) {
+	b, err := json.Marshal(DeviceLookupRequest{
+		Provisioner:         provisionerName,
+		PermanentIdentifier: permanentIdentifier,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling device lookup request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating device lookup request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+d.BearerToken)
+	}
+
+	client := d.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultDeviceInventoryTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error doing device lookup request to %s", d.URL)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrDeviceNotEnrolled
+	case resp.StatusCode >= 400:
+		return nil, errors.Errorf("device lookup request to %s failed with status code %d", d.URL, resp.StatusCode)
+	}
+
+	var device Device
+	if err := json.NewDecoder(resp.Body).Decode(&device); err != nil {
+		return nil, errors.Wrapf(err, "error decoding device lookup response from %s", d.URL)
+	}
+	if device.PermanentIdentifier != permanentIdentifier {
+		return nil, errors.Errorf("device lookup response from %s does not match the permanent identifier %s", d.URL, permanentIdentifier)
+	}
+	return &device, nil
+}
+
+// lookupFile reads the device inventory file on every lookup, so changes in
+// the inventory do not require a restart.
+func (d *DeviceInventory) lookupFile(permanentIdentifier string) (*Device, error) {
+	b, err := os.ReadFile(d.File)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", d.File)
+	}
+	var devices []Device
+	if err := json.Unmarshal(b, &devices); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", d.File)
+	}
+	for i := range devices {
+		if devices[i].PermanentIdentifier == permanentIdentifier {
+			return &devices[i], nil
+		}
+	}
+	return nil, ErrDeviceNotEnrolled
+}
@@ -0,0 +1,184 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceInventory_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *DeviceInventory
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok url", &DeviceInventory{URL: "https://inventory.example.com/lookup"}, false},
+		{"ok url timeout", &DeviceInventory{URL: "https://inventory.example.com/lookup", Timeout: &Duration{Duration: time.Second}}, false},
+		{"ok file", &DeviceInventory{File: "devices.json"}, false},
+		{"fail empty", &DeviceInventory{}, true},
+		{"fail url and file", &DeviceInventory{URL: "https://inventory.example.com/lookup", File: "devices.json"}, true},
+		{"fail url", &DeviceInventory{URL: "inventory.example.com/lookup"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.d.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("DeviceInventory.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeviceInventory_Lookup(t *testing.T) {
+	devices := []Device{
+		{PermanentIdentifier: "active", Status: DeviceStatusActive, Data: map[string]interface{}{"owner": "jane"}},
+		{PermanentIdentifier: "no-status"},
+		{PermanentIdentifier: "decommissioned", Status: DeviceStatusDecommissioned},
+		{PermanentIdentifier: "unknown", Status: "lost"},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req DeviceLookupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provisioner != "acme" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch req.PermanentIdentifier {
+		case "bad-json":
+			w.Write([]byte("{"))
+			return
+		case "mismatch":
+			json.NewEncoder(w).Encode(Device{PermanentIdentifier: "other"})
+			return
+		}
+		for _, d := range devices {
+			if d.PermanentIdentifier == req.PermanentIdentifier {
+				json.NewEncoder(w).Encode(d)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	b, err := json.Marshal(devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "devices.json")
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	badFile := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(badFile, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := &DeviceInventory{URL: srv.URL, BearerToken: "secret"}
+	if err := webhook.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	allowlist := &DeviceInventory{File: file}
+	if err := allowlist.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                string
+		d                   *DeviceInventory
+		permanentIdentifier string
+		want                *Device
+		wantErr             error
+	}{
+		{"ok webhook", webhook, "active", &devices[0], nil},
+		{"ok webhook no status", webhook, "no-status", &devices[1], nil},
+		{"ok file", allowlist, "active", &devices[0], nil},
+		{"ok file no status", allowlist, "no-status", &devices[1], nil},
+		{"fail webhook not enrolled", webhook, "missing", nil, ErrDeviceNotEnrolled},
+		{"fail webhook decommissioned", webhook, "decommissioned", nil, ErrDeviceDecommissioned},
+		{"fail webhook status", webhook, "unknown", nil, errors.New("device unknown has an unexpected status lost")},
+		{"fail webhook json", webhook, "bad-json", nil, errors.New("error decoding device lookup response")},
+		{"fail webhook mismatch", webhook, "mismatch", nil, errors.New("does not match the permanent identifier")},
+		{"fail webhook unauthorized", &DeviceInventory{URL: srv.URL}, "active", nil, errors.New("failed with status code 401")},
+		{"fail file not enrolled", allowlist, "missing", nil, ErrDeviceNotEnrolled},
+		{"fail file decommissioned", allowlist, "decommissioned", nil, ErrDeviceDecommissioned},
+		{"fail file missing", &DeviceInventory{File: filepath.Join(t.TempDir(), "missing.json")}, "active", nil, errors.New("error reading")},
+		{"fail file parse", &DeviceInventory{File: badFile}, "active", nil, errors.New("error parsing")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.d.Lookup(context.Background(), "acme", tt.permanentIdentifier)
+			if tt.wantErr != nil {
+				switch {
+				case err == nil:
+					t.Errorf("DeviceInventory.Lookup() error = nil, wantErr %v", tt.wantErr)
+				case errors.Is(tt.wantErr, ErrDeviceNotEnrolled), errors.Is(tt.wantErr, ErrDeviceDecommissioned):
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("DeviceInventory.Lookup() error = %v, wantErr %v", err, tt.wantErr)
+					}
+				default:
+					if !strings.Contains(err.Error(), tt.wantErr.Error()) {
+						t.Errorf("DeviceInventory.Lookup() error = %v, wantErr %v", err, tt.wantErr)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("DeviceInventory.Lookup() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DeviceInventory.Lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACME_LookupDevice(t *testing.T) {
+	b, err := json.Marshal([]Device{
+		{PermanentIdentifier: "1234", Data: map[string]interface{}{"owner": "jane"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "devices.json")
+	if err := os.WriteFile(file, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                string
+		p                   *ACME
+		permanentIdentifier string
+		want                map[string]interface{}
+		wantErr             bool
+	}{
+		{"ok no inventory", &ACME{Name: "acme"}, "1234", nil, false},
+		{"ok", &ACME{Name: "acme", DeviceInventory: &DeviceInventory{File: file}}, "1234", map[string]interface{}{"owner": "jane"}, false},
+		{"fail", &ACME{Name: "acme", DeviceInventory: &DeviceInventory{File: file}}, "5678", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.LookupDevice(context.Background(), tt.permanentIdentifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ACME.LookupDevice() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ACME.LookupDevice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
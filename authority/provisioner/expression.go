@@ -0,0 +1,456 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// claimExpression is a boolean expression evaluated against the claims of a
+// token. Expressions compare claims with literals or other claims, and can be
+// combined using "&&", "||", "!" and parentheses, for example:
+//
+//	repository == "org/x" && ref startsWith "refs/heads/main"
+//
+// Claims are referenced by name, and nested claims using dots, e.g.
+// context.namespace. Numbers, booleans and strings in double quotes can be
+// used as literals. The supported operators are "==", "!=", "startsWith",
+// "endsWith", "contains", "matches" with a regular expression, and "in" with a
+// list of literals like ["a", "b"]. A claim alone evaluates to true if it is
+// present and it is not false, zero or empty. Comparisons with a missing claim
+// are always false.
+type claimExpression struct {
+	source string
+	root   exprNode
+}
+
+// parseClaimExpression parses the given expression.
+func parseClaimExpression(s string) (*claimExpression, error) {
+	tokens, err := tokenizeExpression(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing expression %q", s)
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = errors.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing expression %q", s)
+	}
+	return &claimExpression{source: s, root: root}, nil
+}
+
+// Evaluate returns true if the claims satisfy the expression.
+func (e *claimExpression) Evaluate(claims map[string]interface{}) bool {
+	return e.root.eval(claims)
+}
+
+// String returns the source of the expression.
+func (e *claimExpression) String() string {
+	return e.source
+}
+
+type exprTokenType int
+
+const (
+	exprIdent exprTokenType = iota
+	exprString
+	exprNumber
+	exprOperator
+	exprPunct
+)
+
+type exprToken struct {
+	typ   exprTokenType
+	value string
+}
+
+func (t exprToken) String() string {
+	return fmt.Sprintf("%q", t.value)
+}
+
+func (t exprToken) is(typ exprTokenType, value string) bool {
+	return t.typ == typ && t.value == value
+}
+
+var exprWordOperators = map[string]bool{
+	"startsWith": true,
+	"endsWith":   true,
+	"contains":   true,
+	"matches":    true,
+	"in":         true,
+}
+
+func tokenizeExpression(s string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, errors.Errorf("invalid string %s", s[i:j+1])
+			}
+			tokens = append(tokens, exprToken{exprString, v})
+			i = j + 1
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"),
+			strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, exprToken{exprOperator, s[i : i+2]})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, exprToken{exprOperator, "!"})
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',':
+			tokens = append(tokens, exprToken{exprPunct, string(c)})
+			i++
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				return nil, errors.Errorf("invalid number %s", s[i:j])
+			}
+			tokens = append(tokens, exprToken{exprNumber, s[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || s[j] == '-' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			word := s[i:j]
+			if exprWordOperators[word] {
+				tokens = append(tokens, exprToken{exprOperator, word})
+			} else {
+				tokens = append(tokens, exprToken{exprIdent, word})
+			}
+			i = j
+		default:
+			return nil, errors.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return exprToken{}, false
+}
+
+func (p *exprParser) next() (exprToken, error) {
+	if p.pos < len(p.tokens) {
+		p.pos++
+		return p.tokens[p.pos-1], nil
+	}
+	return exprToken{}, errors.New("unexpected end of expression")
+}
+
+func (p *exprParser) accept(typ exprTokenType, value string) bool {
+	if t, ok := p.peek(); ok && t.is(typ, value) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(exprOperator, "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(exprOperator, "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept(exprOperator, "!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{x}, nil
+	}
+	if p.accept(exprPunct, "(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(exprPunct, ")") {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return x, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.peek()
+	if !ok || t.typ != exprOperator || t.value == "&&" || t.value == "||" || t.value == "!" {
+		return truthyNode{left}, nil
+	}
+	p.pos++
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	node := compareNode{op: t.value, left: left, right: right}
+	if t.value == "matches" {
+		lit, ok := right.(literal)
+		if !ok {
+			return nil, errors.New("matches requires a string literal")
+		}
+		s, ok := lit.value.(string)
+		if !ok {
+			return nil, errors.New("matches requires a string literal")
+		}
+		if node.re, err = regexp.Compile(s); err != nil {
+			return nil, errors.Wrapf(err, "invalid regular expression %q", s)
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseOperand() (operand, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.typ == exprString:
+		return literal{t.value}, nil
+	case t.typ == exprNumber:
+		f, _ := strconv.ParseFloat(t.value, 64)
+		return literal{f}, nil
+	case t.is(exprIdent, "true"):
+		return literal{true}, nil
+	case t.is(exprIdent, "false"):
+		return literal{false}, nil
+	case t.typ == exprIdent:
+		return claimRef(strings.Split(t.value, ".")), nil
+	case t.is(exprPunct, "["):
+		var list listLiteral
+		if p.accept(exprPunct, "]") {
+			return list, nil
+		}
+		for {
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			lit, ok := v.(literal)
+			if !ok {
+				return nil, errors.New("lists can only contain literals")
+			}
+			list = append(list, lit.value)
+			if p.accept(exprPunct, "]") {
+				return list, nil
+			}
+			if !p.accept(exprPunct, ",") {
+				return nil, errors.New("missing comma or closing bracket in list")
+			}
+		}
+	default:
+		return nil, errors.Errorf("unexpected %s", t)
+	}
+}
+
+type exprNode interface {
+	eval(claims map[string]interface{}) bool
+}
+
+type orNode struct{ left, right exprNode }
+
+func (n orNode) eval(claims map[string]interface{}) bool {
+	return n.left.eval(claims) || n.right.eval(claims)
+}
+
+type andNode struct{ left, right exprNode }
+
+func (n andNode) eval(claims map[string]interface{}) bool {
+	return n.left.eval(claims) && n.right.eval(claims)
+}
+
+type notNode struct{ x exprNode }
+
+func (n notNode) eval(claims map[string]interface{}) bool {
+	return !n.x.eval(claims)
+}
+
+type truthyNode struct{ x operand }
+
+func (n truthyNode) eval(claims map[string]interface{}) bool {
+	v, ok := n.x.resolve(claims)
+	if !ok {
+		return false
+	}
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case []interface{}:
+		return len(v) > 0
+	default:
+		return v != nil
+	}
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+	re          *regexp.Regexp
+}
+
+func (n compareNode) eval(claims map[string]interface{}) bool {
+	l, ok := n.left.resolve(claims)
+	if !ok {
+		return false
+	}
+	r, ok := n.right.resolve(claims)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(l, r)
+	case "!=":
+		return !exprEqual(l, r)
+	case "startsWith":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		return lok && rok && strings.HasPrefix(ls, rs)
+	case "endsWith":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		return lok && rok && strings.HasSuffix(ls, rs)
+	case "contains":
+		switch l := l.(type) {
+		case string:
+			rs, ok := r.(string)
+			return ok && strings.Contains(l, rs)
+		case []interface{}:
+			return exprIn(r, l)
+		default:
+			return false
+		}
+	case "matches":
+		ls, ok := l.(string)
+		return ok && n.re.MatchString(ls)
+	case "in":
+		list, ok := r.([]interface{})
+		return ok && exprIn(l, list)
+	default:
+		return false
+	}
+}
+
+// operand is a value in an expression.
+type operand interface {
+	resolve(claims map[string]interface{}) (interface{}, bool)
+}
+
+type literal struct{ value interface{} }
+
+func (l literal) resolve(map[string]interface{}) (interface{}, bool) {
+	return l.value, true
+}
+
+type listLiteral []interface{}
+
+func (l listLiteral) resolve(map[string]interface{}) (interface{}, bool) {
+	return []interface{}(l), true
+}
+
+// claimRef is a reference to a claim, nested claims are referenced with a path.
+type claimRef []string
+
+func (c claimRef) resolve(claims map[string]interface{}) (interface{}, bool) {
+	var v interface{} = claims
+	for _, name := range c {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok || v == nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func exprEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	default:
+		return false
+	}
+}
+
+func exprIn(v interface{}, list []interface{}) bool {
+	for _, e := range list {
+		if exprEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_parseClaimExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"ok/equal", `repository == "org/x"`, false},
+		{"ok/and-or", `repository == "org/x" && (ref startsWith "refs/heads/main" || ref_type == "tag")`, false},
+		{"ok/not", `!(event_name == "pull_request")`, false},
+		{"ok/in", `actor in ["alice", "bob"]`, false},
+		{"ok/matches", `ref matches "^refs/tags/v[0-9]+$"`, false},
+		{"ok/truthy", `runner_environment && !pull_request`, false},
+		{"ok/number", `run_attempt == 1`, false},
+		{"fail/empty", ``, true},
+		{"fail/unterminated-string", `repository == "org/x`, true},
+		{"fail/missing-operand", `repository ==`, true},
+		{"fail/missing-parenthesis", `(repository == "org/x"`, true},
+		{"fail/unexpected-token", `repository "org/x"`, true},
+		{"fail/unexpected-character", `repository = "org/x"`, true},
+		{"fail/matches-claim", `ref matches repository`, true},
+		{"fail/matches-regexp", `ref matches "["`, true},
+		{"fail/list", `actor in ["alice", bob]`, true},
+		{"fail/list-comma", `actor in ["alice" "bob"]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseClaimExpression(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseClaimExpression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_claimExpression_Evaluate(t *testing.T) {
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"sub": "repo:org/x:ref:refs/heads/main",
+		"aud": ["step-ca", "other"],
+		"repository": "org/x",
+		"ref": "refs/heads/main",
+		"ref_type": "branch",
+		"actor": "alice",
+		"run_attempt": 1,
+		"pull_request": false,
+		"runner_environment": "github-hosted",
+		"context": {"namespace": "org"}
+	}`), &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"equal", `repository == "org/x"`, true},
+		{"equal-false", `repository == "org/y"`, false},
+		{"not-equal", `repository != "org/y"`, true},
+		{"startsWith", `ref startsWith "refs/heads/"`, true},
+		{"endsWith", `ref endsWith "/main"`, true},
+		{"contains-string", `sub contains ":ref:"`, true},
+		{"contains-list", `aud contains "step-ca"`, true},
+		{"contains-list-false", `aud contains "foo"`, false},
+		{"matches", `ref matches "^refs/heads/(main|release)$"`, true},
+		{"in", `actor in ["alice", "bob"]`, true},
+		{"in-false", `actor in ["bob"]`, false},
+		{"in-claim", `"step-ca" in aud`, true},
+		{"number", `run_attempt == 1`, true},
+		{"bool", `pull_request == false`, true},
+		{"claims", `sub endsWith ref`, true},
+		{"nested", `context.namespace == "org"`, true},
+		{"truthy", `runner_environment`, true},
+		{"truthy-false", `pull_request`, false},
+		{"and", `repository == "org/x" && ref startsWith "refs/heads/main"`, true},
+		{"and-false", `repository == "org/x" && ref_type == "tag"`, false},
+		{"or", `ref_type == "tag" || actor == "alice"`, true},
+		{"not", `!(ref_type == "tag")`, true},
+		{"precedence", `ref_type == "tag" && actor == "bob" || repository == "org/x"`, true},
+		{"missing", `environment == "prod"`, false},
+		{"missing-not-equal", `environment != "prod"`, false},
+		{"missing-nested", `context.foo.bar == "prod"`, false},
+		{"missing-truthy", `environment`, false},
+		{"type-mismatch", `run_attempt == "1"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseClaimExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("parseClaimExpression() error = %v", err)
+			}
+			if got := e.Evaluate(claims); got != tt.want {
+				t.Errorf("claimExpression.Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
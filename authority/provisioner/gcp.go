@@ -41,6 +41,41 @@ type gcpGooglePayload struct {
 	ComputeEngine gcpComputeEnginePayload `json:"compute_engine"`
 }
 
+// isComputeEngine returns true if the token has the Compute Engine claims of
+// a token created in a VM.
+func (p *gcpPayload) isComputeEngine() bool {
+	return p.Google.ComputeEngine.InstanceID != ""
+}
+
+// templateData returns the data exposed to the templates on tokens without
+// Compute Engine claims.
+func (p *gcpPayload) templateData() gcpTemplateData {
+	return gcpTemplateData{
+		ServiceAccount: p.Email,
+		UniqueID:       p.Subject,
+		ProjectID:      gcpServiceAccountProject(p.Email),
+	}
+}
+
+// gcpTemplateData is the data available in the templates under the GCP
+// variable.
+type gcpTemplateData struct {
+	ServiceAccount string
+	UniqueID       string
+	ProjectID      string
+}
+
+// gcpServiceAccountProject returns the project id of user-managed service
+// accounts, with emails like name@project-id.iam.gserviceaccount.com. It
+// returns an empty string for other service accounts.
+func gcpServiceAccountProject(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i == -1 || !strings.HasSuffix(email, ".iam.gserviceaccount.com") {
+		return ""
+	}
+	return strings.TrimSuffix(email[i+1:], ".iam.gserviceaccount.com")
+}
+
 type gcpComputeEnginePayload struct {
 	InstanceID                string            `json:"instance_id"`
 	InstanceName              string            `json:"instance_name"`
@@ -76,6 +111,12 @@ func newGCPConfig() *gcpConfig {
 // If InstanceAge is set, only the instances with an instance_creation_timestamp
 // within the given period will be accepted.
 //
+// If AllowNonComputeEngine is true, Google-signed identity tokens without
+// Compute Engine claims, like the ones in GKE Workload Identity, Cloud Run or
+// Cloud Functions, will also be accepted if the service account is in
+// ServiceAccounts. These tokens are not limited by TOFU, the InstanceAge is not
+// checked, and they cannot be used to sign SSH certificates.
+//
 // Google Identity docs are available at
 // https://cloud.google.com/compute/docs/instances/verifying-instance-identity
 type GCP struct {
@@ -88,6 +129,7 @@ type GCP struct {
 	DisableCustomSANs      bool     `json:"disableCustomSANs"`
 	DisableTrustOnFirstUse bool     `json:"disableTrustOnFirstUse"`
 	InstanceAge            Duration `json:"instanceAge,omitempty"`
+	AllowNonComputeEngine  bool     `json:"allowNonComputeEngine,omitempty"`
 	Claims                 *Claims  `json:"claims,omitempty"`
 	Options                *Options `json:"options,omitempty"`
 	config                 *gcpConfig
@@ -112,7 +154,8 @@ func (p *GCP) GetIDForToken() string {
 
 // GetTokenID returns the identifier of the token. The default value for GCP the
 // SHA256 of "provisioner_id.instance_id", but if DisableTrustOnFirstUse is set
-// to true, then it will be the SHA256 of the token.
+// to true, or the token does not have Compute Engine claims, then it will be
+// the SHA256 of the token.
 func (p *GCP) GetTokenID(token string) (string, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
@@ -131,6 +174,13 @@ func (p *GCP) GetTokenID(token string) (string, error) {
 		return "", errors.Wrap(err, "error verifying claims")
 	}
 
+	// Service accounts are usually shared by multiple workloads, so TOFU is
+	// only used with Compute Engine instances.
+	if !claims.isComputeEngine() {
+		sum := sha256.Sum256([]byte(token))
+		return strings.ToLower(hex.EncodeToString(sum[:])), nil
+	}
+
 	// Create unique ID for Trust On First Use (TOFU). Only the first instance
 	// per provisioner is allowed as we don't have a way to trust the given
 	// sans.
@@ -202,6 +252,8 @@ func (p *GCP) Init(config Config) (err error) {
 		return errors.New("provisioner name cannot be empty")
 	case p.InstanceAge.Value() < 0:
 		return errors.New("provisioner instanceAge cannot be negative")
+	case p.AllowNonComputeEngine && len(p.ServiceAccounts) == 0:
+		return errors.New("provisioner allowNonComputeEngine requires serviceAccounts")
 	}
 
 	// Initialize config
@@ -224,6 +276,9 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
 	}
+	if !claims.isComputeEngine() {
+		return p.authorizeServiceAccountSign(token, claims)
+	}
 
 	ce := claims.Google.ComputeEngine
 
@@ -275,6 +330,55 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	), nil
 }
 
+// authorizeServiceAccountSign returns the sign options for a token without
+// Compute Engine claims. The service account email is the default common name
+// and the only SAN if DisableCustomSANs is true.
+func (p *GCP) authorizeServiceAccountSign(token string, claims *gcpPayload) ([]SignOption, error) {
+	// Template options
+	data := x509util.NewTemplateData()
+	data.SetCommonName(claims.Email)
+	data.Set("GCP", claims.templateData())
+	if v, err := unsafeParseSigned(token); err == nil {
+		data.SetToken(v)
+	}
+
+	// Enforce the service account as the common name and SAN if configured.
+	// By default we'll accept the CN and SANs in the CSR.
+	var so []SignOption
+	if p.DisableCustomSANs {
+		name := claims.Email[:strings.LastIndex(claims.Email, "@")]
+		so = append(so,
+			commonNameSliceValidator([]string{
+				claims.Email, name,
+			}),
+			dnsNamesValidator(nil),
+			ipAddressesValidator(nil),
+			emailAddressesValidator([]string{claims.Email}),
+			urisValidator(nil),
+		)
+
+		// Template SANs
+		data.SetSANs([]string{claims.Email})
+	}
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultIIDLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSign")
+	}
+
+	return append(so,
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeGCP, p.Name, claims.Subject, "ServiceAccount", claims.Email),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+	), nil
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 func (p *GCP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
 	return p.ctl.AuthorizeRenew(ctx, cert)
@@ -342,6 +446,12 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 		}
 	}
 
+	// Tokens without Compute Engine claims are validated using the service
+	// account.
+	if p.AllowNonComputeEngine && !claims.isComputeEngine() {
+		return p.authorizeServiceAccountToken(&claims)
+	}
+
 	// validate projects
 	if len(p.ProjectIDs) > 0 {
 		var found bool
@@ -377,6 +487,38 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 	return &claims, nil
 }
 
+// authorizeServiceAccountToken validates a token without Compute Engine
+// claims, like the ones in GKE Workload Identity, Cloud Run or Cloud Functions.
+// The service account has been already validated, and the project is derived
+// from the email of user-managed service accounts.
+func (p *GCP) authorizeServiceAccountToken(claims *gcpPayload) (*gcpPayload, error) {
+	switch {
+	case len(p.ServiceAccounts) == 0:
+		return nil, errs.Unauthorized("gcp.authorizeToken; gcp provisioner serviceAccounts cannot be empty")
+	case claims.Email == "" || !strings.Contains(claims.Email, "@"):
+		return nil, errs.Unauthorized("gcp.authorizeToken; gcp token email cannot be empty")
+	case !claims.EmailVerified:
+		return nil, errs.Unauthorized("gcp.authorizeToken; gcp token email is not verified")
+	}
+
+	// validate projects
+	if len(p.ProjectIDs) > 0 {
+		var found bool
+		projectID := gcpServiceAccountProject(claims.Email)
+		for _, pi := range p.ProjectIDs {
+			if pi == projectID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errs.Unauthorized("gcp.authorizeToken; invalid gcp token - invalid project id")
+		}
+	}
+
+	return claims, nil
+}
+
 // AuthorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
 	if !p.ctl.Claimer.IsSSHCAEnabled() {
@@ -386,6 +528,9 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "gcp.AuthorizeSSHSign")
 	}
+	if !claims.isComputeEngine() {
+		return nil, errs.Unauthorized("gcp.AuthorizeSSHSign; gcp tokens without compute engine claims cannot be used to sign ssh certificates")
+	}
 
 	ce := claims.Google.ComputeEngine
 	signOptions := []SignOption{}
@@ -437,5 +582,7 @@ func (p *GCP) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
 	), nil
 }
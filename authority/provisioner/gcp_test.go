@@ -170,11 +170,12 @@ func TestGCP_Init(t *testing.T) {
 	}
 	zero := Duration{Duration: 0}
 	type fields struct {
-		Type            string
-		Name            string
-		ServiceAccounts []string
-		InstanceAge     Duration
-		Claims          *Claims
+		Type                  string
+		Name                  string
+		ServiceAccounts       []string
+		InstanceAge           Duration
+		AllowNonComputeEngine bool
+		Claims                *Claims
 	}
 	type args struct {
 		config   Config
@@ -186,23 +187,26 @@ func TestGCP_Init(t *testing.T) {
 		args    args
 		wantErr bool
 	}{
-		{"ok", fields{"GCP", "name", nil, zero, nil}, args{config, srv.URL}, false},
-		{"ok", fields{"GCP", "name", []string{"service-account"}, zero, nil}, args{config, srv.URL}, false},
-		{"ok", fields{"GCP", "name", []string{"service-account"}, Duration{Duration: 1 * time.Minute}, nil}, args{config, srv.URL}, false},
-		{"bad type", fields{"", "name", nil, zero, nil}, args{config, srv.URL}, true},
-		{"bad name", fields{"GCP", "", nil, zero, nil}, args{config, srv.URL}, true},
-		{"bad duration", fields{"GCP", "name", nil, Duration{Duration: -1 * time.Minute}, nil}, args{config, srv.URL}, true},
-		{"bad claims", fields{"GCP", "name", nil, zero, badClaims}, args{config, srv.URL}, true},
-		{"bad certs", fields{"GCP", "name", nil, zero, nil}, args{config, srv.URL + "/error"}, true},
+		{"ok", fields{"GCP", "name", nil, zero, false, nil}, args{config, srv.URL}, false},
+		{"ok", fields{"GCP", "name", []string{"service-account"}, zero, false, nil}, args{config, srv.URL}, false},
+		{"ok", fields{"GCP", "name", []string{"service-account"}, Duration{Duration: 1 * time.Minute}, false, nil}, args{config, srv.URL}, false},
+		{"ok allowNonComputeEngine", fields{"GCP", "name", []string{"service-account"}, zero, true, nil}, args{config, srv.URL}, false},
+		{"bad type", fields{"", "name", nil, zero, false, nil}, args{config, srv.URL}, true},
+		{"bad name", fields{"GCP", "", nil, zero, false, nil}, args{config, srv.URL}, true},
+		{"bad duration", fields{"GCP", "name", nil, Duration{Duration: -1 * time.Minute}, false, nil}, args{config, srv.URL}, true},
+		{"bad claims", fields{"GCP", "name", nil, zero, false, badClaims}, args{config, srv.URL}, true},
+		{"bad allowNonComputeEngine", fields{"GCP", "name", nil, zero, true, nil}, args{config, srv.URL}, true},
+		{"bad certs", fields{"GCP", "name", nil, zero, false, nil}, args{config, srv.URL + "/error"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &GCP{
-				Type:            tt.fields.Type,
-				Name:            tt.fields.Name,
-				ServiceAccounts: tt.fields.ServiceAccounts,
-				InstanceAge:     tt.fields.InstanceAge,
-				Claims:          tt.fields.Claims,
+				Type:                  tt.fields.Type,
+				Name:                  tt.fields.Name,
+				ServiceAccounts:       tt.fields.ServiceAccounts,
+				InstanceAge:           tt.fields.InstanceAge,
+				AllowNonComputeEngine: tt.fields.AllowNonComputeEngine,
+				Claims:                tt.fields.Claims,
 				config: &gcpConfig{
 					CertsURL:    tt.args.certsURL,
 					IdentityURL: gcpIdentityURL,
@@ -746,3 +750,148 @@ func TestGCP_AuthorizeRenew(t *testing.T) {
 		})
 	}
 }
+
+func Test_gcpServiceAccountProject(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"ok", "app@my-project.iam.gserviceaccount.com", "my-project"},
+		{"default compute", "1234567890-compute@developer.gserviceaccount.com", ""},
+		{"app engine", "my-project@appspot.gserviceaccount.com", ""},
+		{"user", "jane@example.com", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gcpServiceAccountProject(tt.email); got != tt.want {
+				t.Errorf("gcpServiceAccountProject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCP_AuthorizeSign_nonComputeEngine(t *testing.T) {
+	email := "app@my-project.iam.gserviceaccount.com"
+	newProvisioner := func(t *testing.T) *GCP {
+		t.Helper()
+		p, err := generateGCP()
+		assert.FatalError(t, err)
+		p.ServiceAccounts = []string{email}
+		p.AllowNonComputeEngine = true
+		p.InstanceAge = Duration{1 * time.Minute}
+		return p
+	}
+
+	p1 := newProvisioner(t)
+	p2 := newProvisioner(t)
+	p2.DisableCustomSANs = true
+	p2.ProjectIDs = []string{"my-project"}
+	p3 := newProvisioner(t)
+	p3.ProjectIDs = []string{"other-project"}
+	p4 := newProvisioner(t)
+	p4.AllowNonComputeEngine = false
+
+	mustToken := func(p *GCP, sub, email string, emailVerified bool) string {
+		tok, err := generateGCPServiceAccountToken(sub, email, p.GetID(), emailVerified,
+			time.Now(), &p.keyStore.keySet.Keys[0])
+		assert.FatalError(t, err)
+		return tok
+	}
+
+	t1 := mustToken(p1, "1234567890", email, true)
+	t2 := mustToken(p2, "1234567890", email, true)
+	t3 := mustToken(p3, "1234567890", email, true)
+	t4 := mustToken(p4, "1234567890", email, true)
+	failServiceAccount := mustToken(p1, "1234567890", "other@my-project.iam.gserviceaccount.com", true)
+	failEmailVerified := mustToken(p1, "1234567890", email, false)
+
+	tests := []struct {
+		name    string
+		gcp     *GCP
+		token   string
+		wantLen int
+		code    int
+		wantErr bool
+	}{
+		{"ok", p1, t1, 7, http.StatusOK, false},
+		{"ok/disableCustomSANs", p2, t2, 12, http.StatusOK, false},
+		{"fail/project", p3, t3, 0, http.StatusUnauthorized, true},
+		{"fail/not allowed", p4, t4, 0, http.StatusUnauthorized, true},
+		{"fail/service account", p1, failServiceAccount, 0, http.StatusUnauthorized, true},
+		{"fail/email verified", p1, failEmailVerified, 0, http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContextWithMethod(context.Background(), SignMethod)
+			got, err := tt.gcp.AuthorizeSign(ctx, tt.token)
+			switch {
+			case (err != nil) != tt.wantErr:
+				t.Errorf("GCP.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			case err != nil:
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, sc.StatusCode(), tt.code)
+			default:
+				assert.Equals(t, tt.wantLen, len(got))
+				for _, o := range got {
+					switch v := o.(type) {
+					case *GCP:
+					case certificateOptionsFunc:
+					case *provisionerExtensionOption:
+						assert.Equals(t, v.Type, TypeGCP)
+						assert.Equals(t, v.Name, tt.gcp.GetName())
+						assert.Equals(t, v.CredentialID, "1234567890")
+						assert.Equals(t, []string{"ServiceAccount", email}, v.KeyValuePairs)
+					case profileDefaultDuration:
+						assert.Equals(t, time.Duration(v), tt.gcp.ctl.Claimer.DefaultTLSCertDuration())
+					case defaultPublicKeyValidator:
+					case *validityValidator:
+						assert.Equals(t, v.min, tt.gcp.ctl.Claimer.MinTLSCertDuration())
+						assert.Equals(t, v.max, tt.gcp.ctl.Claimer.MaxTLSCertDuration())
+					case commonNameSliceValidator:
+						assert.Equals(t, []string{email, "app"}, []string(v))
+					case dnsNamesValidator:
+						assert.Equals(t, v, nil)
+					case ipAddressesValidator:
+						assert.Equals(t, v, nil)
+					case emailAddressesValidator:
+						assert.Equals(t, []string{email}, []string(v))
+					case urisValidator:
+						assert.Equals(t, v, nil)
+					case *x509NamePolicyValidator:
+						assert.Equals(t, nil, v.policyEngine)
+					default:
+						assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGCP_nonComputeEngine_GetTokenID_AuthorizeSSHSign(t *testing.T) {
+	email := "app@my-project.iam.gserviceaccount.com"
+	p, err := generateGCP()
+	assert.FatalError(t, err)
+	p.ServiceAccounts = []string{email}
+	p.AllowNonComputeEngine = true
+
+	token, err := generateGCPServiceAccountToken("1234567890", email, p.GetID(), true,
+		time.Now(), &p.keyStore.keySet.Keys[0])
+	assert.FatalError(t, err)
+
+	// Tokens without compute engine claims do not use TOFU.
+	sum := sha256.Sum256([]byte(token))
+	id, err := p.GetTokenID(token)
+	assert.FatalError(t, err)
+	assert.Equals(t, strings.ToLower(hex.EncodeToString(sum[:])), id)
+
+	// Tokens without compute engine claims cannot sign SSH certificates.
+	_, err = p.AuthorizeSSHSign(context.Background(), token)
+	var sc render.StatusCodedError
+	assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+	assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+}
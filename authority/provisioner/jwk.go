@@ -278,9 +278,21 @@ func (p *JWK) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
+		// Apply the policy for the critical options and extensions
+		SSHPermissionsOption{Options: p.ctl.getPolicy().getSSHPermissions()},
+		// Allow step-up requests for additional principals
+		SSHStepUpOption{Options: p.ctl.getSSHStepUp()},
 	), nil
 }
 
+// AuthorizeSSHStepUp returns the list of SignOption used to sign the SSH user
+// certificate of an approved step-up request.
+func (p *JWK) AuthorizeSSHStepUp(ctx context.Context) ([]SignOption, error) {
+	return sshStepUpSignOptions(p, p.ctl)
+}
+
 // AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
 func (p *JWK) AuthorizeSSHRevoke(ctx context.Context, token string) error {
 	_, err := p.authorizeToken(token, p.ctl.Audiences.SSHRevoke)
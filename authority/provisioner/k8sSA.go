@@ -8,6 +8,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -38,6 +39,63 @@ type k8sSAPayload struct {
 	SecretName         string `json:"kubernetes.io/serviceaccount/secret.name,omitempty"`
 	ServiceAccountName string `json:"kubernetes.io/serviceaccount/service-account.name,omitempty"`
 	ServiceAccountUID  string `json:"kubernetes.io/serviceaccount/service-account.uid,omitempty"`
+	// Kubernetes is the nested claim used by bound projected service account
+	// tokens.
+	Kubernetes *k8sSAKubernetesClaims `json:"kubernetes.io,omitempty"`
+	// user is the user information returned by the TokenReview API.
+	user *tokenReviewUserInfo
+}
+
+// k8sSAKubernetesClaims represents the `kubernetes.io` claim present in bound
+// projected service account tokens.
+type k8sSAKubernetesClaims struct {
+	Namespace      string                `json:"namespace,omitempty"`
+	Pod            *k8sSAObjectReference `json:"pod,omitempty"`
+	Secret         *k8sSAObjectReference `json:"secret,omitempty"`
+	ServiceAccount *k8sSAObjectReference `json:"serviceaccount,omitempty"`
+}
+
+// k8sSAObjectReference is a reference to a Kubernetes object bound to a
+// projected service account token.
+type k8sSAObjectReference struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// k8sSATemplateData is the data exposed to the templates using the
+// `Kubernetes` key.
+type k8sSATemplateData struct {
+	Username           string
+	Groups             []string
+	Namespace          string
+	ServiceAccountName string
+	ServiceAccountUID  string
+	PodName            string
+	PodUID             string
+}
+
+// isProjected returns true if the payload belongs to a bound projected service
+// account token.
+func (p *k8sSAPayload) isProjected() bool {
+	return p.Kubernetes != nil
+}
+
+// templateData returns the data exposed to the templates.
+func (p *k8sSAPayload) templateData() k8sSATemplateData {
+	data := k8sSATemplateData{
+		Username:           p.Subject,
+		Namespace:          p.Namespace,
+		ServiceAccountName: p.ServiceAccountName,
+		ServiceAccountUID:  p.ServiceAccountUID,
+	}
+	if p.Kubernetes != nil && p.Kubernetes.Pod != nil {
+		data.PodName = p.Kubernetes.Pod.Name
+		data.PodUID = p.Kubernetes.Pod.UID
+	}
+	if p.user != nil {
+		data.Groups = p.user.Groups
+	}
+	return data
 }
 
 // K8sSA represents a Kubernetes ServiceAccount provisioner; an
@@ -50,9 +108,22 @@ type K8sSA struct {
 	PubKeys []byte   `json:"publicKeys,omitempty"`
 	Claims  *Claims  `json:"claims,omitempty"`
 	Options *Options `json:"options,omitempty"`
-	//kauthn    kauthn.AuthenticationV1Interface
-	pubKeys []interface{}
-	ctl     *Controller
+	// Issuer is the service account issuer of the cluster. If set, bound
+	// projected tokens with this issuer are accepted, and if no public keys
+	// are configured the keys are fetched using the OIDC discovery document of
+	// the issuer.
+	Issuer string `json:"issuer,omitempty"`
+	// Audiences are the audiences accepted in projected tokens. If empty, the
+	// CA audiences are used.
+	Audiences []string `json:"audiences,omitempty"`
+	// RequirePodBinding rejects projected tokens not bound to a pod.
+	RequirePodBinding bool `json:"requirePodBinding,omitempty"`
+	// TokenReview configures the validation of the tokens using the
+	// Kubernetes TokenReview API instead of the public keys.
+	TokenReview *K8sSATokenReview `json:"tokenReview,omitempty"`
+	pubKeys     []interface{}
+	keyStore    *keyStore
+	ctl         *Controller
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -121,23 +192,24 @@ func (p *K8sSA) Init(config Config) (err error) {
 			}
 			p.pubKeys = append(p.pubKeys, key)
 		}
-	} else {
-		// TODO: Use the TokenReview API if no pub keys provided. This will need to
-		// be configured with additional attributes in the K8sSA struct for
-		// connecting to the kubernetes API server.
-		return errors.New("K8s Service Account provisioner cannot be initialized without pub keys")
-	}
-	/*
-		// NOTE: Not sure if we should be doing this initialization here ...
-		// If you have a k8sSA provisioner defined in your config, but you're not
-		// in a kubernetes pod then your CA will fail to startup. Maybe we just postpone
-		// creating the authn until token validation time?
-		if err := checkAccess(k8s.AuthorizationV1()); err != nil {
-			return errors.Wrapf(err, "error verifying access to kubernetes authz service for provisioner %s", p.GetID())
+	}
+
+	if p.TokenReview != nil {
+		// NOTE: the access to the TokenReview API is not checked on startup, so
+		// the CA can start even if the kubernetes API server is not reachable.
+		if err := p.TokenReview.Validate(); err != nil {
+			return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
+		}
+	} else if p.Issuer != "" && p.pubKeys == nil {
+		// Get the keys from the cluster issuer if no pub keys are provided.
+		if p.keyStore, err = newIssuerKeyStore(p.Issuer); err != nil {
+			return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
 		}
+	}
 
-		p.kauthn = k8s.AuthenticationV1()
-	*/
+	if p.pubKeys == nil && p.keyStore == nil && p.TokenReview == nil {
+		return errors.New("K8s Service Account provisioner cannot be initialized without pub keys, issuer or tokenReview")
+	}
 
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
@@ -153,31 +225,17 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 			"k8ssa.authorizeToken; error parsing k8sSA token")
 	}
 
+	// The kubernetes API server validates the token in TokenReview mode.
+	if p.TokenReview != nil {
+		return p.reviewToken(jwt, token, audiences)
+	}
+
 	var (
 		valid  bool
 		claims k8sSAPayload
 	)
-	if p.pubKeys == nil {
-		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA TokenReview API integration not implemented")
-		/* NOTE: We plan to support the TokenReview API in a future release.
-		         Below is some code that should be useful when we prioritize
-				 this integration.
-
-			tr := kauthnApi.TokenReview{Spec: kauthnApi.TokenReviewSpec{Token: string(token)}}
-			rvw, err := p.kauthn.TokenReviews().Create(&tr)
-			if err != nil {
-				return nil, errors.Wrap(err, "error using kubernetes TokenReview API")
-			}
-			if rvw.Status.Error != "" {
-				return nil, errors.Errorf("error from kubernetes TokenReviewAPI: %s", rvw.Status.Error)
-			}
-			if !rvw.Status.Authenticated {
-				return nil, errors.New("error from kubernetes TokenReviewAPI: token could not be authenticated")
-			}
-			if err = jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
-				return nil, errors.Wrap(err, "error parsing claims")
-			}
-		*/
+	if p.pubKeys == nil && p.keyStore == nil {
+		return nil, errs.Unauthorized("k8ssa.authorizeToken; k8sSA provisioner '%s' has no keys to validate tokens", p.GetName())
 	}
 	for _, pk := range p.pubKeys {
 		if err = jwt.Claims(pk, &claims); err == nil {
@@ -185,16 +243,30 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 			break
 		}
 	}
+	if !valid && p.keyStore != nil {
+		for _, key := range p.keyStore.Get(jwt.Headers[0].KeyID) {
+			if err = jwt.Claims(key, &claims); err == nil {
+				valid = true
+				break
+			}
+		}
+	}
 	if !valid {
 		return nil, errs.Unauthorized("k8ssa.authorizeToken; error validating k8sSA token and extracting claims")
 	}
 
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
-	if err = claims.Validate(jose.Expected{
-		Issuer: k8sSAIssuer,
-	}); err != nil {
-		return nil, errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; invalid k8sSA token claims")
+	if claims.isProjected() {
+		if err := p.validateProjectedClaims(&claims, audiences); err != nil {
+			return nil, err
+		}
+	} else {
+		// According to "rfc7519 JSON Web Token" acceptable skew should be no
+		// more than a few minutes.
+		if err = claims.Validate(jose.Expected{
+			Issuer: k8sSAIssuer,
+		}); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; invalid k8sSA token claims")
+		}
 	}
 
 	if claims.Subject == "" {
@@ -204,6 +276,104 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 	return &claims, nil
 }
 
+// reviewToken validates the token using the TokenReview API and returns the
+// claims of the reviewed service account.
+func (p *K8sSA) reviewToken(jwt *jose.JSONWebToken, token string, audiences []string) (*k8sSAPayload, error) {
+	var claims k8sSAPayload
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; error parsing k8sSA token claims")
+	}
+
+	// Projected tokens are audience scoped, legacy tokens do not have an
+	// audience.
+	switch {
+	case !claims.isProjected():
+		audiences = nil
+	case len(p.Audiences) > 0:
+		audiences = p.Audiences
+	}
+
+	// Positive reviews are cached for the lifetime of the token.
+	var expiry time.Time
+	if claims.Expiry != nil {
+		expiry = claims.Expiry.Time()
+	}
+	user, err := p.TokenReview.Review(token, audiences, expiry)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; error reviewing k8sSA token")
+	}
+
+	namespace, name, ok := user.serviceAccount()
+	if !ok {
+		return nil, errs.Unauthorized("k8ssa.authorizeToken; user %s is not a service account", user.Username)
+	}
+	podName, podUID := user.extra(k8sSAPodNameExtra), user.extra(k8sSAPodUIDExtra)
+	if p.RequirePodBinding && (podName == "" || podUID == "") {
+		return nil, errs.Unauthorized("k8ssa.authorizeToken; invalid k8sSA token claims: token is not bound to a pod")
+	}
+
+	reviewed := &k8sSAPayload{
+		Claims:             claims.Claims,
+		Namespace:          namespace,
+		ServiceAccountName: name,
+		ServiceAccountUID:  user.UID,
+		Kubernetes: &k8sSAKubernetesClaims{
+			Namespace:      namespace,
+			ServiceAccount: &k8sSAObjectReference{Name: name, UID: user.UID},
+		},
+		user: user,
+	}
+	reviewed.Subject = user.Username
+	if podName != "" {
+		reviewed.Kubernetes.Pod = &k8sSAObjectReference{Name: podName, UID: podUID}
+	}
+	return reviewed, nil
+}
+
+// validateProjectedClaims validates the claims of a bound projected service
+// account token, and sets the legacy service account claims from the nested
+// `kubernetes.io` claim.
+func (p *K8sSA) validateProjectedClaims(claims *k8sSAPayload, audiences []string) error {
+	if p.Issuer == "" {
+		return errs.Unauthorized("k8ssa.authorizeToken; k8sSA provisioner '%s' does not accept projected tokens", p.GetName())
+	}
+
+	// Projected tokens are always time bound.
+	if claims.Expiry == nil {
+		return errs.Unauthorized("k8ssa.authorizeToken; invalid k8sSA token claims: missing expiration")
+	}
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Issuer: p.Issuer,
+		Time:   time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return errs.Wrap(http.StatusUnauthorized, err, "k8ssa.authorizeToken; invalid k8sSA token claims")
+	}
+
+	// Projected tokens are audience scoped.
+	if len(p.Audiences) > 0 {
+		audiences = p.Audiences
+	}
+	if !matchesAudience(claims.Audience, audiences) {
+		return errs.Unauthorized("k8ssa.authorizeToken; invalid k8sSA token claims: invalid audience claim (aud)")
+	}
+
+	k := claims.Kubernetes
+	if k.Namespace == "" || k.ServiceAccount == nil || k.ServiceAccount.Name == "" {
+		return errs.Unauthorized("k8ssa.authorizeToken; invalid k8sSA token claims: missing service account")
+	}
+	if p.RequirePodBinding && (k.Pod == nil || k.Pod.Name == "" || k.Pod.UID == "") {
+		return errs.Unauthorized("k8ssa.authorizeToken; invalid k8sSA token claims: token is not bound to a pod")
+	}
+
+	claims.Namespace = k.Namespace
+	claims.ServiceAccountName = k.ServiceAccount.Name
+	claims.ServiceAccountUID = k.ServiceAccount.UID
+	if k.Secret != nil {
+		claims.SecretName = k.Secret.Name
+	}
+	return nil
+}
+
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 func (p *K8sSA) AuthorizeRevoke(ctx context.Context, token string) error {
@@ -221,13 +391,20 @@ func (p *K8sSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 	// Add some values to use in custom templates.
 	data := x509util.NewTemplateData()
 	data.SetCommonName(claims.ServiceAccountName)
+	data.Set("Kubernetes", claims.templateData())
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
 
 	// Certificate templates: on K8sSA the default template is the certificate
-	// request.
-	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultAdminLeafTemplate)
+	// request. In TokenReview mode the subject and SANs are set from the
+	// reviewed service account.
+	defaultTemplate := x509util.DefaultAdminLeafTemplate
+	if claims.user != nil {
+		data.SetSANs([]string{claims.ServiceAccountName + "." + claims.Namespace + ".svc"})
+		defaultTemplate = x509util.DefaultLeafTemplate
+	}
+	templateOptions, err := CustomTemplateOptions(p.Options, data, defaultTemplate)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "k8ssa.AuthorizeSign")
 	}
@@ -263,6 +440,7 @@ func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 	// Certificate templates.
 	// Set some default variables to be used in the templates.
 	data := sshutil.CreateTemplateData(sshutil.HostCert, claims.ServiceAccountName, []string{claims.ServiceAccountName})
+	data.Set("Kubernetes", claims.templateData())
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
@@ -287,29 +465,17 @@ func (p *K8sSA) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOptio
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
+		// Apply the policy for the critical options and extensions
+		SSHPermissionsOption{Options: p.ctl.getPolicy().getSSHPermissions()},
+		// Allow step-up requests for additional principals
+		SSHStepUpOption{Options: p.ctl.getSSHStepUp()},
 	), nil
 }
 
-/*
-func checkAccess(authz kauthz.AuthorizationV1Interface) error {
-	r := &kauthzApi.SelfSubjectAccessReview{
-		Spec: kauthzApi.SelfSubjectAccessReviewSpec{
-			ResourceAttributes: &kauthzApi.ResourceAttributes{
-				Group:    "authentication.k8s.io",
-				Version:  "v1",
-				Resource: "tokenreviews",
-				Verb:     "create",
-			},
-		},
-	}
-	rvw, err := authz.SelfSubjectAccessReviews().Create(r)
-	if err != nil {
-		return err
-	}
-	if !rvw.Status.Allowed {
-		return fmt.Errorf("Unable to create kubernetes token reviews: %s", rvw.Status.Reason)
-	}
-
-	return nil
+// AuthorizeSSHStepUp returns the list of SignOption used to sign the SSH user
+// certificate of an approved step-up request.
+func (p *K8sSA) AuthorizeSSHStepUp(ctx context.Context) ([]SignOption, error) {
+	return sshStepUpSignOptions(p, p.ctl)
 }
-*/
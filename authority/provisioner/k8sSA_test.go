@@ -2,14 +2,21 @@ package provisioner
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
@@ -53,7 +60,7 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 				err:   errors.New("k8ssa.authorizeToken; error parsing k8sSA token"),
 			}
 		},
-		"fail/not-implemented": func(t *testing.T) test {
+		"fail/no-keys": func(t *testing.T) test {
 			jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
 			assert.FatalError(t, err)
 			p, err := generateK8sSA(nil)
@@ -65,7 +72,7 @@ func TestK8sSA_authorizeToken(t *testing.T) {
 			return test{
 				p:     p,
 				token: tok,
-				err:   errors.New("k8ssa.authorizeToken; k8sSA TokenReview API integration not implemented"),
+				err:   fmt.Errorf("k8ssa.authorizeToken; k8sSA provisioner '%s' has no keys to validate tokens", p.GetName()),
 				code:  http.StatusUnauthorized,
 			}
 		},
@@ -368,7 +375,7 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 			} else {
 				if assert.Nil(t, tc.err) {
 					if assert.NotNil(t, opts) {
-						assert.Len(t, 8, opts)
+						assert.Len(t, 11, opts)
 						for _, o := range opts {
 							switch v := o.(type) {
 							case Interface:
@@ -384,6 +391,12 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 							case *sshNamePolicyValidator:
 								assert.Equals(t, nil, v.userPolicyEngine)
 								assert.Equals(t, nil, v.hostPolicyEngine)
+							case SSHPermissionsOption:
+								assert.Nil(t, v.Options)
+							case SSHHostKeyAttestationOption:
+								assert.Nil(t, v.Options)
+							case SSHStepUpOption:
+								assert.Nil(t, v.Options)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
@@ -394,3 +407,427 @@ func TestK8sSA_AuthorizeSSHSign(t *testing.T) {
 		})
 	}
 }
+
+func TestK8sSA_Init(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(openIDConfiguration{Issuer: issuer, JWKSetURI: issuer + "/openid/v1/jwks"})
+		case "/openid/v1/jwks":
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	issuer = srv.URL
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *K8sSA
+		wantErr bool
+	}{
+		{"ok/issuer", &K8sSA{Type: "K8sSA", Name: K8sSAName, Issuer: srv.URL}, false},
+		{"fail/no-keys", &K8sSA{Type: "K8sSA", Name: K8sSAName}, true},
+		{"fail/issuer-mismatch", &K8sSA{Type: "K8sSA", Name: K8sSAName, Issuer: srv.URL + "/"}, true},
+		{"fail/issuer-not-found", &K8sSA{Type: "K8sSA", Name: K8sSAName, Issuer: srv.URL + "/foo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("K8sSA.Init() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.Len(t, 1, tt.p.keyStore.Get(jwk.KeyID))
+				tt.p.keyStore.Close()
+			}
+		})
+	}
+}
+
+func TestK8sSA_authorizeToken_projected(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	const issuer = "https://kubernetes.default.svc.cluster.local"
+	now := time.Now()
+	newProvisioner := func(t *testing.T) *K8sSA {
+		p, err := generateK8sSA(nil)
+		assert.FatalError(t, err)
+		p.Issuer = issuer
+		p.pubKeys = nil
+		p.keyStore = &keyStore{
+			keySet: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}},
+			expiry: now.Add(time.Hour),
+		}
+		return p
+	}
+	newClaims := func() *k8sSAPayload {
+		return &k8sSAPayload{
+			Claims: jose.Claims{
+				Issuer:    issuer,
+				Subject:   "system:serviceaccount:ns-foo:san-foo",
+				Audience:  jose.Audience{testAudiences.Sign[0]},
+				IssuedAt:  jose.NewNumericDate(now),
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(time.Hour)),
+			},
+			Kubernetes: &k8sSAKubernetesClaims{
+				Namespace:      "ns-foo",
+				Pod:            &k8sSAObjectReference{Name: "pod-foo", UID: "poduid-foo"},
+				ServiceAccount: &k8sSAObjectReference{Name: "san-foo", UID: "sauid-foo"},
+			},
+		}
+	}
+
+	type test struct {
+		p     *K8sSA
+		token string
+		err   error
+	}
+	tests := map[string]func(*testing.T) test{
+		"fail/no-issuer": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.Issuer = ""
+			tok, err := generateK8sSAToken(jwk, newClaims())
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				err:   fmt.Errorf("k8ssa.authorizeToken; k8sSA provisioner '%s' does not accept projected tokens", p.GetName()),
+			}
+		},
+		"fail/invalid-issuer": func(t *testing.T) test {
+			claims := newClaims()
+			claims.Issuer = "https://foo.cluster.local"
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     newProvisioner(t),
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: square/go-jose/jwt: validation failed, invalid issuer claim (iss)"),
+			}
+		},
+		"fail/no-expiry": func(t *testing.T) test {
+			claims := newClaims()
+			claims.Expiry = nil
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     newProvisioner(t),
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: missing expiration"),
+			}
+		},
+		"fail/expired": func(t *testing.T) test {
+			claims := newClaims()
+			claims.Expiry = jose.NewNumericDate(now.Add(-time.Hour))
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     newProvisioner(t),
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: square/go-jose/jwt: validation failed, token is expired (exp)"),
+			}
+		},
+		"fail/invalid-audience": func(t *testing.T) test {
+			claims := newClaims()
+			claims.Audience = jose.Audience{"https://kubernetes.default.svc.cluster.local"}
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     newProvisioner(t),
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: invalid audience claim (aud)"),
+			}
+		},
+		"fail/invalid-provisioner-audience": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.Audiences = []string{"step-ca"}
+			tok, err := generateK8sSAToken(jwk, newClaims())
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: invalid audience claim (aud)"),
+			}
+		},
+		"fail/missing-service-account": func(t *testing.T) test {
+			claims := newClaims()
+			claims.Kubernetes.ServiceAccount = nil
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     newProvisioner(t),
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: missing service account"),
+			}
+		},
+		"fail/pod-binding": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.RequirePodBinding = true
+			claims := newClaims()
+			claims.Kubernetes.Pod = nil
+			claims.Kubernetes.Secret = &k8sSAObjectReference{Name: "sn-foo", UID: "snuid-foo"}
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				err:   errors.New("k8ssa.authorizeToken; invalid k8sSA token claims: token is not bound to a pod"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			tok, err := generateK8sSAToken(jwk, newClaims())
+			assert.FatalError(t, err)
+			return test{
+				p:     newProvisioner(t),
+				token: tok,
+			}
+		},
+		"ok/provisioner-audience": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.Audiences = []string{"step-ca"}
+			p.RequirePodBinding = true
+			claims := newClaims()
+			claims.Audience = jose.Audience{"step-ca"}
+			tok, err := generateK8sSAToken(jwk, claims)
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+			}
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := tt(t)
+			claims, err := tc.p.authorizeToken(tc.token, testAudiences.Sign)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), http.StatusUnauthorized)
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, k8sSATemplateData{
+					Username:           "system:serviceaccount:ns-foo:san-foo",
+					Namespace:          "ns-foo",
+					ServiceAccountName: "san-foo",
+					ServiceAccountUID:  "sauid-foo",
+					PodName:            "pod-foo",
+					PodUID:             "poduid-foo",
+				}, claims.templateData())
+			}
+		})
+	}
+}
+
+func TestK8sSA_tokenReview(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	newToken := func(t *testing.T) string {
+		claims := getK8sSAPayload()
+		claims.Expiry = jose.NewNumericDate(now.Add(time.Hour))
+		tok, err := generateK8sSAToken(jwk, claims)
+		assert.FatalError(t, err)
+		return tok
+	}
+	newProjectedToken := func(t *testing.T, aud string) string {
+		claims := getK8sSAPayload()
+		claims.Audience = jose.Audience{aud}
+		claims.Expiry = jose.NewNumericDate(now.Add(time.Hour))
+		claims.Kubernetes = &k8sSAKubernetesClaims{
+			Namespace:      "ns-foo",
+			ServiceAccount: &k8sSAObjectReference{Name: "san-foo", UID: "sauid-foo"},
+		}
+		tok, err := generateK8sSAToken(jwk, claims)
+		assert.FatalError(t, err)
+		return tok
+	}
+	tok, unboundTok, userTok := newToken(t), newToken(t), newToken(t)
+	projectedTok := newProjectedToken(t, testAudiences.Sign[0])
+	otherAudienceTok := newProjectedToken(t, "https://other.example.com")
+	srv, _ := newFakeTokenReviewServer(t, "reviewer", map[string]tokenReviewStatus{
+		projectedTok: {Authenticated: true, Audiences: []string{testAudiences.Sign[0]}, User: tokenReviewUserInfo{
+			Username: "system:serviceaccount:ns-foo:san-foo",
+			UID:      "sauid-foo",
+		}},
+		otherAudienceTok: {Authenticated: true, Audiences: []string{"https://other.example.com"}, User: tokenReviewUserInfo{
+			Username: "system:serviceaccount:ns-foo:san-foo",
+			UID:      "sauid-foo",
+		}},
+		tok: {Authenticated: true, User: tokenReviewUserInfo{
+			Username: "system:serviceaccount:ns-foo:san-foo",
+			UID:      "sauid-foo",
+			Groups:   []string{"system:serviceaccounts"},
+			Extra: map[string][]string{
+				k8sSAPodNameExtra: {"pod-foo"},
+				k8sSAPodUIDExtra:  {"poduid-foo"},
+			},
+		}},
+		unboundTok: {Authenticated: true, User: tokenReviewUserInfo{
+			Username: "system:serviceaccount:ns-foo:san-foo",
+			UID:      "sauid-foo",
+		}},
+		userTok: {Authenticated: true, User: tokenReviewUserInfo{
+			Username: "jane@example.com",
+		}},
+	})
+	caFile := writeTokenReviewServerCA(t, srv)
+
+	newProvisioner := func(t *testing.T) *K8sSA {
+		p := &K8sSA{
+			Type: "K8sSA",
+			Name: K8sSAName,
+			TokenReview: &K8sSATokenReview{
+				Server:               srv.URL,
+				CertificateAuthority: caFile,
+				BearerToken:          "reviewer",
+			},
+		}
+		assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}))
+		return p
+	}
+
+	projectedData := &k8sSATemplateData{
+		Username:           "system:serviceaccount:ns-foo:san-foo",
+		Namespace:          "ns-foo",
+		ServiceAccountName: "san-foo",
+		ServiceAccountUID:  "sauid-foo",
+	}
+
+	type test struct {
+		p     *K8sSA
+		token string
+		data  *k8sSATemplateData
+		err   error
+	}
+	tests := map[string]func(*testing.T) test{
+		"fail/not-authenticated": func(t *testing.T) test {
+			return test{
+				p:     newProvisioner(t),
+				token: newToken(t),
+				err:   errors.New("k8ssa.AuthorizeSign: k8ssa.authorizeToken; error reviewing k8sSA token: token review failed: token is not authenticated"),
+			}
+		},
+		"fail/not-service-account": func(t *testing.T) test {
+			return test{
+				p:     newProvisioner(t),
+				token: userTok,
+				err:   errors.New("k8ssa.AuthorizeSign: k8ssa.authorizeToken; user jane@example.com is not a service account"),
+			}
+		},
+		"fail/pod-binding": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.RequirePodBinding = true
+			return test{
+				p:     p,
+				token: unboundTok,
+				err:   errors.New("k8ssa.AuthorizeSign: k8ssa.authorizeToken; invalid k8sSA token claims: token is not bound to a pod"),
+			}
+		},
+		"fail/projected-audience": func(t *testing.T) test {
+			return test{
+				p:     newProvisioner(t),
+				token: otherAudienceTok,
+				err:   errors.New("k8ssa.AuthorizeSign: k8ssa.authorizeToken; error reviewing k8sSA token: token review failed: token audiences do not match"),
+			}
+		},
+		"fail/projected-provisioner-audience": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.Audiences = []string{"https://other.example.com"}
+			return test{
+				p:     p,
+				token: projectedTok,
+				err:   errors.New("k8ssa.AuthorizeSign: k8ssa.authorizeToken; error reviewing k8sSA token: token review failed: token audiences do not match"),
+			}
+		},
+		"ok/projected-provisioner-audience": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.Audiences = []string{"https://other.example.com"}
+			return test{
+				p:     p,
+				token: otherAudienceTok,
+				data:  projectedData,
+			}
+		},
+		"ok/projected": func(t *testing.T) test {
+			return test{
+				p:     newProvisioner(t),
+				token: projectedTok,
+				data:  projectedData,
+			}
+		},
+		"ok": func(t *testing.T) test {
+			p := newProvisioner(t)
+			p.RequirePodBinding = true
+			return test{
+				p:     p,
+				token: tok,
+				data: &k8sSATemplateData{
+					Username:           "system:serviceaccount:ns-foo:san-foo",
+					Groups:             []string{"system:serviceaccounts"},
+					Namespace:          "ns-foo",
+					ServiceAccountName: "san-foo",
+					ServiceAccountUID:  "sauid-foo",
+					PodName:            "pod-foo",
+					PodUID:             "poduid-foo",
+				},
+			}
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := tt(t)
+			opts, err := tc.p.AuthorizeSign(context.Background(), tc.token)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), http.StatusUnauthorized)
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if !assert.Nil(t, tc.err) {
+				return
+			}
+
+			claims, err := tc.p.authorizeToken(tc.token, testAudiences.Sign)
+			assert.FatalError(t, err)
+			assert.Equals(t, *tc.data, claims.templateData())
+
+			// The subject and SANs are set from the reviewed service account.
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			assert.FatalError(t, err)
+			der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: "foo"},
+				DNSNames: []string{"foo.example.com"},
+			}, key)
+			assert.FatalError(t, err)
+			csr, err := x509.ParseCertificateRequest(der)
+			assert.FatalError(t, err)
+			for _, o := range opts {
+				if fn, ok := o.(certificateOptionsFunc); ok {
+					cert, err := x509util.NewCertificate(csr, fn(SignOptions{})...)
+					assert.FatalError(t, err)
+					crt := cert.GetCertificate()
+					assert.Equals(t, "san-foo", crt.Subject.CommonName)
+					assert.Equals(t, []string{"san-foo.ns-foo.svc"}, crt.DNSNames)
+				}
+			}
+		})
+	}
+}
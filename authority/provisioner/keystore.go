@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"sync"
@@ -45,6 +47,28 @@ func newKeyStore(uri string) (*keyStore, error) {
 	return ks, nil
 }
 
+// newIssuerKeyStore returns a key store with the keys published by the given
+// issuer using OIDC discovery.
+func newIssuerKeyStore(issuer string) (*keyStore, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", issuer)
+	}
+	u.Path = path.Join(u.Path, "/.well-known/openid-configuration")
+
+	var configuration openIDConfiguration
+	if err := getAndDecode(u.String(), &configuration); err != nil {
+		return nil, err
+	}
+	if err := configuration.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", u.String())
+	}
+	if configuration.Issuer != issuer {
+		return nil, errors.Errorf("error parsing %s: issuer %s does not match %s", u.String(), configuration.Issuer, issuer)
+	}
+	return newKeyStore(configuration.JWKSetURI)
+}
+
 func (ks *keyStore) Close() {
 	ks.timer.Stop()
 }
@@ -26,6 +26,8 @@ const (
 	SSHRevokeMethod
 	// SSHRekeyMethod is the method used to rekey SSH certificates.
 	SSHRekeyMethod
+	// NebulaSignMethod is the method used to sign Nebula certificates.
+	NebulaSignMethod
 )
 
 // String returns a string representation of the context method.
@@ -45,6 +47,8 @@ func (m Method) String() string {
 		return "ssh-revoke-method"
 	case SSHRekeyMethod:
 		return "ssh-rekey-method"
+	case NebulaSignMethod:
+		return "nebula-sign-method"
 	default:
 		return "unknown"
 	}
@@ -74,3 +78,18 @@ func TokenFromContext(ctx context.Context) (string, bool) {
 	token, ok := ctx.Value(tokenKey{}).(string)
 	return token, ok
 }
+
+type remoteAddressKey struct{}
+
+// NewContextWithRemoteAddress creates a new context with the IP address of the
+// requester.
+func NewContextWithRemoteAddress(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, remoteAddressKey{}, addr)
+}
+
+// RemoteAddressFromContext returns the IP address of the requester stored in
+// the given context.
+func RemoteAddressFromContext(ctx context.Context) (string, bool) {
+	addr, ok := ctx.Value(remoteAddressKey{}).(string)
+	return addr, ok
+}
@@ -3,9 +3,12 @@ package provisioner
 import (
 	"context"
 	"crypto/ed25519"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -35,15 +38,25 @@ const (
 // using XEd25519 defined at
 // https://signal.org/docs/specifications/xeddsa/#xeddsa and implemented by
 // go.step.sm/crypto/x25519.
+//
+// Certificates with a fingerprint in the Blocklist cannot sign tokens.
+//
+// The provisioner can also authorize the signing of Nebula certificates if the
+// authority has a Nebula CA. The IPs and groups of the new certificates must be
+// in the AllowedSubnets and AllowedGroups if they are set.
 type Nebula struct {
-	ID      string   `json:"-"`
-	Type    string   `json:"type"`
-	Name    string   `json:"name"`
-	Roots   []byte   `json:"roots"`
-	Claims  *Claims  `json:"claims,omitempty"`
-	Options *Options `json:"options,omitempty"`
-	caPool  *nebula.NebulaCAPool
-	ctl     *Controller
+	ID             string   `json:"-"`
+	Type           string   `json:"type"`
+	Name           string   `json:"name"`
+	Roots          []byte   `json:"roots"`
+	Blocklist      []string `json:"blocklist,omitempty"`
+	AllowedSubnets []string `json:"allowedSubnets,omitempty"`
+	AllowedGroups  []string `json:"allowedGroups,omitempty"`
+	Claims         *Claims  `json:"claims,omitempty"`
+	Options        *Options `json:"options,omitempty"`
+	caPool         *nebula.NebulaCAPool
+	allowedSubnets []*net.IPNet
+	ctl            *Controller
 }
 
 // Init verifies and initializes the Nebula provisioner.
@@ -61,6 +74,26 @@ func (p *Nebula) Init(config Config) (err error) {
 	if err != nil {
 		return errs.InternalServer("failed to create ca pool: %v", err)
 	}
+	for _, fp := range p.Blocklist {
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != sha256.Size {
+			return errors.Errorf("blocklist fingerprint %s is not a valid sha256 fingerprint", fp)
+		}
+		p.caPool.BlocklistFingerprint(strings.ToLower(fp))
+	}
+
+	p.allowedSubnets = make([]*net.IPNet, len(p.AllowedSubnets))
+	for i, s := range p.AllowedSubnets {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil || ip.To4() == nil {
+			return errors.Errorf("allowedSubnets %s is not a valid IPv4 CIDR", s)
+		}
+		p.allowedSubnets[i] = ipNet
+	}
+	for _, g := range p.AllowedGroups {
+		if g == "" {
+			return errors.New("allowedGroups cannot contain empty values")
+		}
+	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
 	p.ctl, err = NewController(p, p.Claims, config, p.Options)
@@ -262,9 +295,50 @@ func (p *Nebula) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOpti
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), nil),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
+		// Apply the policy for the critical options and extensions
+		SSHPermissionsOption{Options: p.ctl.getPolicy().getSSHPermissions()},
 	), nil
 }
 
+// AuthorizeNebulaSign returns the list of SignOption for a SignNebula request.
+//
+// If the token is signed by a Nebula host certificate, the new certificate
+// must have the same name, and the IPs and groups must be in the host
+// certificate. If the token is signed by a Nebula CA, the name must match the
+// subject of the token.
+func (p *Nebula) AuthorizeNebulaSign(ctx context.Context, token string) ([]SignOption, error) {
+	crt, claims, err := p.authorizeToken(token, p.ctl.Audiences.NebulaSign)
+	if err != nil {
+		return nil, err
+	}
+
+	v := nebulaCertValidator{
+		Name:    claims.Subject,
+		Subnets: p.allowedSubnets,
+		Groups:  p.AllowedGroups,
+	}
+	if !crt.Details.IsCA {
+		if claims.Subject != crt.Details.Name {
+			return nil, errs.Unauthorized("token is not valid: subject does not match the nebula certificate name")
+		}
+		v.Authorization = crt
+	}
+
+	return []SignOption{
+		p,
+		// modifiers
+		nebulaValidityModifier(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		v,
+		nebulaValidityValidator{
+			min: p.ctl.Claimer.MinTLSCertDuration(),
+			max: p.ctl.Claimer.MaxTLSCertDuration(),
+		},
+	}, nil
+}
+
 // AuthorizeRenew returns an error if the renewal is disabled.
 func (p *Nebula) AuthorizeRenew(ctx context.Context, crt *x509.Certificate) error {
 	return p.ctl.AuthorizeRenew(ctx, crt)
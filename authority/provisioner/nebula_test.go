@@ -20,6 +20,8 @@ import (
 	"go.step.sm/crypto/x25519"
 	"go.step.sm/crypto/x509util"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/policy"
 )
 
 func mustNebulaIPNet(t *testing.T, s string) *net.IPNet {
@@ -275,6 +277,91 @@ func TestNebula_Init(t *testing.T) {
 	}
 }
 
+func TestNebula_Init_blocklist(t *testing.T) {
+	nc, _ := mustNebulaCA(t)
+	ncPem, err := nc.MarshalToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := nc.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		blocklist []string
+		wantErr   bool
+	}{
+		{"ok", []string{fp}, false},
+		{"ok upper case", []string{strings.ToUpper(fp)}, false},
+		{"fail hex", []string{"foo"}, true},
+		{"fail length", []string{fp[:32]}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Nebula{
+				Type:      "Nebula",
+				Name:      "Nebulous",
+				Roots:     ncPem,
+				Blocklist: tt.blocklist,
+			}
+			err := p.Init(Config{
+				Claims:    globalProvisionerClaims,
+				Audiences: testAudiences,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Nebula.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !p.caPool.IsBlocklisted(nc) {
+				t.Error("Nebula.Init() did not blocklist the certificate")
+			}
+		})
+	}
+}
+
+func TestNebula_Init_allowlists(t *testing.T) {
+	nc, _ := mustNebulaCA(t)
+	ncPem, err := nc.MarshalToPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		allowedSubnets []string
+		allowedGroups  []string
+		wantErr        bool
+	}{
+		{"ok", []string{"10.1.1.0/24", "10.1.2.0/24"}, []string{"test", "servers"}, false},
+		{"ok empty", nil, nil, false},
+		{"fail subnet", []string{"10.1.1.0"}, nil, true},
+		{"fail ipv6", []string{"fd00::/64"}, nil, true},
+		{"fail group", nil, []string{"test", ""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Nebula{
+				Type:           "Nebula",
+				Name:           "Nebulous",
+				Roots:          ncPem,
+				AllowedSubnets: tt.allowedSubnets,
+				AllowedGroups:  tt.allowedGroups,
+			}
+			err := p.Init(Config{
+				Claims:    globalProvisionerClaims,
+				Audiences: testAudiences,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Nebula.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(p.allowedSubnets) != len(tt.allowedSubnets) {
+				t.Errorf("Nebula.Init() allowedSubnets = %v, want %v", p.allowedSubnets, tt.allowedSubnets)
+			}
+		})
+	}
+}
+
 func TestNebula_GetID(t *testing.T) {
 	type fields struct {
 		ID   string
@@ -478,6 +565,136 @@ func TestNebula_AuthorizeSign(t *testing.T) {
 	}
 }
 
+func TestNebula_AuthorizeNebulaSign(t *testing.T) {
+	ctx := context.TODO()
+	p, ca, signer := mustNebulaProvisioner(t)
+	crt, priv := mustNebulaCert(t, "test.lan", mustNebulaIPNet(t, "10.1.0.1/16"), []string{"test"}, ca, signer)
+	ok := mustNebulaToken(t, "test.lan", p.Name, p.ctl.Audiences.NebulaSign[0], now(), nil, crt, priv)
+	failAudience := mustNebulaToken(t, "test.lan", p.Name, p.ctl.Audiences.Sign[0], now(), nil, crt, priv)
+	failSubject := mustNebulaToken(t, "other.lan", p.Name, p.ctl.Audiences.NebulaSign[0], now(), nil, crt, priv)
+
+	// Tokens signed by a CA certificate, issued by the root.
+	caPub, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := ca.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate := &cert.NebulaCertificate{
+		Details: cert.NebulaCertificateDetails{
+			Name:      "TestIntermediate",
+			Groups:    []string{"test"},
+			Ips:       []*net.IPNet{mustNebulaIPNet(t, "10.1.0.0/16")},
+			Subnets:   []*net.IPNet{},
+			NotBefore: ca.Details.NotBefore,
+			NotAfter:  ca.Details.NotAfter,
+			PublicKey: caPub,
+			IsCA:      true,
+			Issuer:    issuer,
+		},
+	}
+	if err := intermediate.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	caDer, err := intermediate.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader(NebulaCertHeader, caDer)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: caPriv}, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	okCA, err := jose.Signed(sig).Claims(jose.Claims{
+		ID:        "the-jti",
+		Subject:   "new.lan",
+		Issuer:    p.Name,
+		IssuedAt:  jose.NewNumericDate(now()),
+		NotBefore: jose.NewNumericDate(now()),
+		Expiry:    jose.NewNumericDate(now().Add(5 * time.Minute)),
+		Audience:  []string{p.ctl.Audiences.NebulaSign[0]},
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pAllowlist, _, _ := mustNebulaProvisioner(t)
+	pAllowlist.caPool = p.caPool
+	pAllowlist.AllowedGroups = []string{"servers"}
+	pAllowlist.allowedSubnets = []*net.IPNet{mustNebulaIPNet(t, "10.1.2.0/24")}
+
+	type args struct {
+		ctx   context.Context
+		token string
+		opts  SignNebulaOptions
+	}
+	tests := []struct {
+		name         string
+		p            *Nebula
+		args         args
+		wantErr      bool
+		wantValidErr bool
+	}{
+		{"ok", p, args{ctx, ok, SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16"}, Groups: []string{"test"}}}, false, false},
+		{"ok no groups", p, args{ctx, ok, SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16"}}}, false, false},
+		{"ok ca", p, args{ctx, okCA, SignNebulaOptions{Name: "new.lan", IPs: []string{"10.1.0.2/16"}, Groups: []string{"test", "servers"}}}, false, false},
+		{"ok ca allowlist", pAllowlist, args{ctx, okCA, SignNebulaOptions{Name: "new.lan", IPs: []string{"10.1.2.10/16"}, Groups: []string{"servers"}}}, false, false},
+		{"fail token", p, args{ctx, "token", SignNebulaOptions{}}, true, false},
+		{"fail audience", p, args{ctx, failAudience, SignNebulaOptions{}}, true, false},
+		{"fail subject", p, args{ctx, failSubject, SignNebulaOptions{}}, true, false},
+		{"fail name", p, args{ctx, ok, SignNebulaOptions{Name: "other.lan", IPs: []string{"10.1.0.1/16"}}}, false, true},
+		{"fail ip", p, args{ctx, ok, SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.2/16"}}}, false, true},
+		{"fail ip mask", p, args{ctx, ok, SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/24"}}}, false, true},
+		{"fail group", p, args{ctx, ok, SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16"}, Groups: []string{"servers"}}}, false, true},
+		{"fail ca name", p, args{ctx, okCA, SignNebulaOptions{Name: "other.lan", IPs: []string{"10.1.0.2/16"}}}, false, true},
+		{"fail allowlist subnet", pAllowlist, args{ctx, okCA, SignNebulaOptions{Name: "new.lan", IPs: []string{"10.1.3.10/16"}}}, false, true},
+		{"fail allowlist group", pAllowlist, args{ctx, okCA, SignNebulaOptions{Name: "new.lan", IPs: []string{"10.1.2.10/16"}, Groups: []string{"test"}}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.AuthorizeNebulaSign(tt.args.ctx, tt.args.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Nebula.AuthorizeNebulaSign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// Apply the options to a new certificate.
+			nc := &cert.NebulaCertificate{}
+			if err := tt.args.opts.Modify(nc, tt.args.opts); err != nil {
+				t.Fatal(err)
+			}
+			var validErr error
+			for _, o := range got {
+				switch v := o.(type) {
+				case *Nebula:
+				case NebulaCertModifier:
+					if err := v.Modify(nc, tt.args.opts); err != nil {
+						t.Fatal(err)
+					}
+				case NebulaCertValidator:
+					if err := v.Valid(nc, tt.args.opts); err != nil && validErr == nil {
+						validErr = err
+					}
+				default:
+					t.Errorf("Nebula.AuthorizeNebulaSign() unexpected option %T", v)
+				}
+			}
+			if (validErr != nil) != tt.wantValidErr {
+				t.Errorf("Nebula.AuthorizeNebulaSign() validation error = %v, wantValidErr %v", validErr, tt.wantValidErr)
+			}
+			if d := nc.Details.NotAfter.Sub(nc.Details.NotBefore); d != p.ctl.Claimer.DefaultTLSCertDuration() {
+				t.Errorf("Nebula.AuthorizeNebulaSign() duration = %v, want %v", d, p.ctl.Claimer.DefaultTLSCertDuration())
+			}
+		})
+	}
+}
+
 func TestNebula_AuthorizeSSHSign(t *testing.T) {
 	ctx := context.TODO()
 	// Ok provisioner
@@ -517,32 +734,67 @@ func TestNebula_AuthorizeSSHSign(t *testing.T) {
 		},
 	}
 
+	// Provisioner with a policy for critical options and extensions
+	permissions := &policy.SSHPermissionsOptions{
+		Extensions: map[string]*policy.SSHPermissionOptions{
+			"permit-pty": {Forbidden: true},
+		},
+	}
+	pPermissions, _, _ := mustNebulaProvisioner(t)
+	pPermissions.Options = &Options{
+		SSH: &SSHOptions{Permissions: permissions},
+	}
+	if err := pPermissions.Init(Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: testAudiences,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pPermissions.caPool = p.caPool
+
 	type args struct {
 		ctx   context.Context
 		token string
 	}
 	tests := []struct {
-		name    string
-		p       *Nebula
-		args    args
-		wantErr bool
+		name            string
+		p               *Nebula
+		args            args
+		wantPermissions *policy.SSHPermissionsOptions
+		wantErr         bool
 	}{
-		{"ok", p, args{ctx, ok}, false},
-		{"ok no options", p, args{ctx, okNoOptions}, false},
-		{"ok with validity", p, args{ctx, okWithValidity}, false},
-		{"fail token", p, args{ctx, "token"}, true},
-		{"fail user", p, args{ctx, failUserCert}, true},
-		{"fail principals", p, args{ctx, failPrincipals}, true},
-		{"fail disabled", pDisabled, args{ctx, ok}, true},
-		{"fail template", pBadOptions, args{ctx, ok}, true},
+		{"ok", p, args{ctx, ok}, nil, false},
+		{"ok no options", p, args{ctx, okNoOptions}, nil, false},
+		{"ok with validity", p, args{ctx, okWithValidity}, nil, false},
+		{"ok with permissions", pPermissions, args{ctx, ok}, permissions, false},
+		{"fail token", p, args{ctx, "token"}, nil, true},
+		{"fail user", p, args{ctx, failUserCert}, nil, true},
+		{"fail principals", p, args{ctx, failPrincipals}, nil, true},
+		{"fail disabled", pDisabled, args{ctx, ok}, nil, true},
+		{"fail template", pBadOptions, args{ctx, ok}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.p.AuthorizeSSHSign(tt.args.ctx, tt.args.token)
+			got, err := tt.p.AuthorizeSSHSign(tt.args.ctx, tt.args.token)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Nebula.AuthorizeSSHSign() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.wantErr {
+				return
+			}
+			var found bool
+			for _, o := range got {
+				if v, ok := o.(SSHPermissionsOption); ok {
+					found = true
+					if !reflect.DeepEqual(v.Options, tt.wantPermissions) {
+						t.Errorf("Nebula.AuthorizeSSHSign() permissions = %v, want %v", v.Options, tt.wantPermissions)
+					}
+				}
+			}
+			if !found {
+				t.Error("Nebula.AuthorizeSSHSign() SSHPermissionsOption not found")
+			}
 		})
 	}
 }
@@ -762,6 +1014,21 @@ func TestNebula_authorizeToken(t *testing.T) {
 	// Provisioner with a different CA
 	p2, _, _ := mustNebulaProvisioner(t)
 
+	// Provisioner with the certificate blocklisted
+	fp, err := crt.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pBlocked := &Nebula{
+		Type:      p.Type,
+		Name:      p.Name,
+		Roots:     p.Roots,
+		Blocklist: []string{fp},
+	}
+	if err := pBlocked.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+		t.Fatal(err)
+	}
+
 	x509Claims := jose.Claims{
 		ID:        "[REPLACEME]",
 		Subject:   "test.lan",
@@ -820,6 +1087,7 @@ func TestNebula_authorizeToken(t *testing.T) {
 		{"fail claims iss", p, args{failIssuer, p.ctl.Audiences.Sign}, nil, nil, true},
 		{"fail claims aud", p, args{failAudience, p.ctl.Audiences.Sign}, nil, nil, true},
 		{"fail claims sub", p, args{failSubject, p.ctl.Audiences.Sign}, nil, nil, true},
+		{"fail blocklist", pBlocked, args{ok, p.ctl.Audiences.Sign}, nil, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -23,8 +23,10 @@ import (
 // openIDConfiguration contains the necessary properties in the
 // `/.well-known/openid-configuration` document.
 type openIDConfiguration struct {
-	Issuer    string `json:"issuer"`
-	JWKSetURI string `json:"jwks_uri"`
+	Issuer                        string   `json:"issuer"`
+	JWKSetURI                     string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint   string   `json:"device_authorization_endpoint,omitempty"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
 }
 
 // Validate validates the values in a well-known OpenID configuration endpoint.
@@ -49,6 +51,8 @@ type openIDPayload struct {
 	Hd              string   `json:"hd"`
 	Nonce           string   `json:"nonce"`
 	Groups          []string `json:"groups"`
+	ACR             string   `json:"acr"`
+	AMR             []string `json:"amr"`
 }
 
 func (o *openIDPayload) IsAdmin(admins []string) bool {
@@ -77,24 +81,50 @@ func (o *openIDPayload) IsAdmin(admins []string) bool {
 // OIDC represents an OAuth 2.0 OpenID Connect provider.
 //
 // ClientSecret is mandatory, but it can be an empty string.
+//
+// DeviceAuthorizationEndpoint, CodeChallengeMethods and Scopes are metadata
+// used by the clients to get a token. If the device authorization endpoint or
+// the PKCE code challenge methods are not set, they will be discovered from the
+// configuration endpoint; discovered values are kept apart from the configured
+// ones and are only reported in the JSON representation of the provisioner.
+// Headless clients can use the device authorization
+// grant (RFC 8628) if a device authorization endpoint is available.
+//
+// If ACRValues is set, the acr claim of the token must be one of the given
+// values. If AMRValues is set, the amr claim of the token must contain all the
+// given values, e.g. ["mfa"] can be used to require multi-factor
+// authentication.
+//
+// GroupHostTags maps the groups of a user to the SSH host tags, in the
+// name=value format, that the members of each group are entitled to. If it is
+// set, the hosts in the SSH host inventory that a user can access are limited
+// to the ones with those tags.
 type OIDC struct {
 	*base
-	ID                    string   `json:"-"`
-	Type                  string   `json:"type"`
-	Name                  string   `json:"name"`
-	ClientID              string   `json:"clientID"`
-	ClientSecret          string   `json:"clientSecret"`
-	ConfigurationEndpoint string   `json:"configurationEndpoint"`
-	TenantID              string   `json:"tenantID,omitempty"`
-	Admins                []string `json:"admins,omitempty"`
-	Domains               []string `json:"domains,omitempty"`
-	Groups                []string `json:"groups,omitempty"`
-	ListenAddress         string   `json:"listenAddress,omitempty"`
-	Claims                *Claims  `json:"claims,omitempty"`
-	Options               *Options `json:"options,omitempty"`
-	configuration         openIDConfiguration
-	keyStore              *keyStore
-	ctl                   *Controller
+	ID                          string              `json:"-"`
+	Type                        string              `json:"type"`
+	Name                        string              `json:"name"`
+	ClientID                    string              `json:"clientID"`
+	ClientSecret                string              `json:"clientSecret"`
+	ConfigurationEndpoint       string              `json:"configurationEndpoint"`
+	TenantID                    string              `json:"tenantID,omitempty"`
+	Admins                      []string            `json:"admins,omitempty"`
+	Domains                     []string            `json:"domains,omitempty"`
+	Groups                      []string            `json:"groups,omitempty"`
+	ListenAddress               string              `json:"listenAddress,omitempty"`
+	DeviceAuthorizationEndpoint string              `json:"deviceAuthorizationEndpoint,omitempty"`
+	CodeChallengeMethods        []string            `json:"codeChallengeMethods,omitempty"`
+	Scopes                      []string            `json:"scopes,omitempty"`
+	ACRValues                   []string            `json:"acrValues,omitempty"`
+	AMRValues                   []string            `json:"amrValues,omitempty"`
+	GroupHostTags               map[string][]string `json:"groupHostTags,omitempty"`
+	Claims                      *Claims             `json:"claims,omitempty"`
+	Options                     *Options            `json:"options,omitempty"`
+	configuration               openIDConfiguration
+	deviceAuthorizationEndpoint string
+	codeChallengeMethods        []string
+	keyStore                    *keyStore
+	ctl                         *Controller
 }
 
 func sanitizeEmail(email string) string {
@@ -153,6 +183,33 @@ func (o *OIDC) GetEncryptedKey() (kid, key string, ok bool) {
 	return "", "", false
 }
 
+// GetDeviceAuthorizationEndpoint returns the configured device authorization
+// endpoint, or the discovered one if it is not configured.
+func (o *OIDC) GetDeviceAuthorizationEndpoint() string {
+	return o.deviceAuthorizationEndpoint
+}
+
+// GetCodeChallengeMethods returns the configured PKCE code challenge methods,
+// or the discovered ones if they are not configured.
+func (o *OIDC) GetCodeChallengeMethods() []string {
+	return o.codeChallengeMethods
+}
+
+// MarshalJSON implements the json.Marshaler interface. It reports the device
+// authorization endpoint and code challenge methods that clients must use,
+// including the discovered ones, without modifying the configured fields.
+func (o *OIDC) MarshalJSON() ([]byte, error) {
+	type oidcAlias OIDC
+	v := oidcAlias(*o)
+	if v.DeviceAuthorizationEndpoint == "" {
+		v.DeviceAuthorizationEndpoint = o.deviceAuthorizationEndpoint
+	}
+	if len(v.CodeChallengeMethods) == 0 {
+		v.CodeChallengeMethods = o.codeChallengeMethods
+	}
+	return json.Marshal(v)
+}
+
 // Init validates and initializes the OIDC provider.
 func (o *OIDC) Init(config Config) (err error) {
 	switch {
@@ -173,6 +230,40 @@ func (o *OIDC) Init(config Config) (err error) {
 		}
 	}
 
+	// Validate client metadata and required authentication claims
+	if o.DeviceAuthorizationEndpoint != "" {
+		if u, err := url.Parse(o.DeviceAuthorizationEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("deviceAuthorizationEndpoint %s is not valid", o.DeviceAuthorizationEndpoint)
+		}
+	}
+	for _, m := range o.CodeChallengeMethods {
+		if !isSupportedCodeChallengeMethod(m) {
+			return errors.Errorf("codeChallengeMethods %s is not supported", m)
+		}
+	}
+	for _, s := range o.Scopes {
+		if s == "" || strings.ContainsAny(s, " \t\n") {
+			return errors.Errorf("scopes %q is not valid", s)
+		}
+	}
+	for _, v := range o.ACRValues {
+		if v == "" {
+			return errors.New("acrValues cannot contain empty values")
+		}
+	}
+	for _, v := range o.AMRValues {
+		if v == "" {
+			return errors.New("amrValues cannot contain empty values")
+		}
+	}
+	for group, tags := range o.GroupHostTags {
+		for _, tag := range tags {
+			if name, _, ok := strings.Cut(tag, "="); !ok || name == "" {
+				return errors.Errorf("groupHostTags %s tag %q is not valid", group, tag)
+			}
+		}
+	}
+
 	// Decode and validate openid-configuration endpoint
 	u, err := url.Parse(o.ConfigurationEndpoint)
 	if err != nil {
@@ -191,6 +282,19 @@ func (o *OIDC) Init(config Config) (err error) {
 	if o.TenantID != "" {
 		o.configuration.Issuer = strings.ReplaceAll(o.configuration.Issuer, "{tenantid}", o.TenantID)
 	}
+	// Discover client metadata if not configured
+	o.deviceAuthorizationEndpoint = o.DeviceAuthorizationEndpoint
+	if o.deviceAuthorizationEndpoint == "" {
+		o.deviceAuthorizationEndpoint = o.configuration.DeviceAuthorizationEndpoint
+	}
+	o.codeChallengeMethods = o.CodeChallengeMethods
+	if len(o.codeChallengeMethods) == 0 {
+		for _, m := range o.configuration.CodeChallengeMethodsSupported {
+			if isSupportedCodeChallengeMethod(m) {
+				o.codeChallengeMethods = append(o.codeChallengeMethods, m)
+			}
+		}
+	}
 	// Get JWK key set
 	o.keyStore, err = newKeyStore(o.configuration.JWKSetURI)
 	if err != nil {
@@ -249,9 +353,43 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 		}
 	}
 
+	// Filter by authentication context class reference
+	if len(o.ACRValues) > 0 {
+		var found bool
+		for _, acr := range o.ACRValues {
+			if acr == p.ACR {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid acr")
+		}
+	}
+
+	// Require all the authentication method references
+	for _, amr := range o.AMRValues {
+		var found bool
+		for _, m := range p.AMR {
+			if m == amr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errs.Unauthorized("validatePayload: oidc token payload validation failed: invalid amr")
+		}
+	}
+
 	return nil
 }
 
+// isSupportedCodeChallengeMethod returns true if the given PKCE code challenge
+// method is defined in RFC 7636.
+func isSupportedCodeChallengeMethod(method string) bool {
+	return method == "S256" || method == "plain"
+}
+
 // authorizeToken applies the most common provisioner authorization claims,
 // leaving the rest to context specific methods.
 func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
@@ -446,6 +584,11 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 			CertType:   SSHUserCert,
 			Principals: principals,
 		}))
+		// Limit the hosts in the inventory to the ones with the tags of the
+		// user groups.
+		if o.GroupHostTags != nil {
+			signOptions = append(signOptions, o.hostTags(claims.Groups))
+		}
 	}
 
 	return append(signOptions,
@@ -460,9 +603,36 @@ func (o *OIDC) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(o.ctl.getPolicy().getSSHHost(), o.ctl.getPolicy().getSSHUser()),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: o.ctl.getSSHHostKeyAttestation()},
+		// Apply the policy for the critical options and extensions
+		SSHPermissionsOption{Options: o.ctl.getPolicy().getSSHPermissions()},
+		// Allow step-up requests for additional principals
+		SSHStepUpOption{Options: o.ctl.getSSHStepUp()},
 	), nil
 }
 
+// AuthorizeSSHStepUp returns the list of SignOption used to sign the SSH user
+// certificate of an approved step-up request.
+func (o *OIDC) AuthorizeSSHStepUp(ctx context.Context) ([]SignOption, error) {
+	return sshStepUpSignOptions(o, o.ctl)
+}
+
+// hostTags returns the SSH host tags the given groups are entitled to.
+func (o *OIDC) hostTags(groups []string) SSHHostTagsOption {
+	tags := SSHHostTagsOption{}
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		for _, tag := range o.GroupHostTags[group] {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
 // AuthorizeSSHRevoke returns nil if the token is valid, false otherwise.
 func (o *OIDC) AuthorizeSSHRevoke(ctx context.Context, token string) error {
 	claims, err := o.authorizeToken(token)
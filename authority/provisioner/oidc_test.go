@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -139,6 +140,253 @@ func TestOIDC_Init(t *testing.T) {
 	}
 }
 
+func TestOIDC_Init_clientMetadata(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+
+	type fields struct {
+		ConfigurationEndpoint       string
+		DeviceAuthorizationEndpoint string
+		CodeChallengeMethods        []string
+		Scopes                      []string
+		ACRValues                   []string
+		AMRValues                   []string
+	}
+	tests := []struct {
+		name                            string
+		fields                          fields
+		wantDeviceAuthorizationEndpoint string
+		wantCodeChallengeMethods        []string
+		wantErr                         bool
+	}{
+		{"ok", fields{srv.URL, "", nil, nil, nil, nil}, "", nil, false},
+		{"ok discovered", fields{srv.URL + "/device", "", nil, nil, nil, nil}, srv.URL + "/device_authorization", []string{"plain", "S256"}, false},
+		{"ok configured", fields{srv.URL + "/device", "https://example.com/device", []string{"S256"}, []string{"openid", "email"}, []string{"phr"}, []string{"mfa"}}, "https://example.com/device", []string{"S256"}, false},
+		{"fail deviceAuthorizationEndpoint", fields{srv.URL, "/device", nil, nil, nil, nil}, "", nil, true},
+		{"fail codeChallengeMethods", fields{srv.URL, "", []string{"S512"}, nil, nil, nil}, "", nil, true},
+		{"fail scopes", fields{srv.URL, "", nil, []string{"openid email"}, nil, nil}, "", nil, true},
+		{"fail empty scopes", fields{srv.URL, "", nil, []string{""}, nil, nil}, "", nil, true},
+		{"fail acrValues", fields{srv.URL, "", nil, nil, []string{""}, nil}, "", nil, true},
+		{"fail amrValues", fields{srv.URL, "", nil, nil, nil, []string{""}}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                        "oidc",
+				Name:                        "name",
+				ClientID:                    "client-id",
+				ConfigurationEndpoint:       tt.fields.ConfigurationEndpoint,
+				DeviceAuthorizationEndpoint: tt.fields.DeviceAuthorizationEndpoint,
+				CodeChallengeMethods:        tt.fields.CodeChallengeMethods,
+				Scopes:                      tt.fields.Scopes,
+				ACRValues:                   tt.fields.ACRValues,
+				AMRValues:                   tt.fields.AMRValues,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Fatalf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Equals(t, tt.wantDeviceAuthorizationEndpoint, p.GetDeviceAuthorizationEndpoint())
+			assert.Equals(t, tt.wantCodeChallengeMethods, p.GetCodeChallengeMethods())
+
+			// Discovered values do not modify the configuration.
+			assert.Equals(t, tt.fields.DeviceAuthorizationEndpoint, p.DeviceAuthorizationEndpoint)
+			assert.Equals(t, tt.fields.CodeChallengeMethods, p.CodeChallengeMethods)
+
+			// The metadata is available in the /provisioners response.
+			b, err := json.Marshal(p)
+			assert.FatalError(t, err)
+			var m map[string]interface{}
+			assert.FatalError(t, json.Unmarshal(b, &m))
+			if tt.wantDeviceAuthorizationEndpoint != "" {
+				assert.Equals(t, tt.wantDeviceAuthorizationEndpoint, m["deviceAuthorizationEndpoint"])
+				assert.NotNil(t, m["codeChallengeMethods"])
+			} else {
+				assert.Nil(t, m["deviceAuthorizationEndpoint"])
+				assert.Nil(t, m["codeChallengeMethods"])
+			}
+		})
+	}
+}
+
+func TestOIDC_ValidatePayload_authenticationContext(t *testing.T) {
+	p1, err := generateOIDC()
+	assert.FatalError(t, err)
+	p2, err := generateOIDC()
+	assert.FatalError(t, err)
+	p2.ACRValues = []string{"phr", "phrh"}
+	p3, err := generateOIDC()
+	assert.FatalError(t, err)
+	p3.AMRValues = []string{"mfa"}
+	p4, err := generateOIDC()
+	assert.FatalError(t, err)
+	p4.Admins = []string{"admin@smallstep.com"}
+	p4.ACRValues = []string{"phr"}
+	p4.AMRValues = []string{"pwd", "otp"}
+
+	newPayload := func(p *OIDC, email, acr string, amr ...string) openIDPayload {
+		return openIDPayload{
+			Claims: jose.Claims{
+				Issuer:   p.configuration.Issuer,
+				Audience: jose.Audience{p.ClientID},
+				Expiry:   jose.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Email: email,
+			ACR:   acr,
+			AMR:   amr,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		prov    *OIDC
+		payload openIDPayload
+		wantErr bool
+	}{
+		{"ok", p1, newPayload(p1, "name@smallstep.com", ""), false},
+		{"ok acr", p2, newPayload(p2, "name@smallstep.com", "phrh"), false},
+		{"ok amr", p3, newPayload(p3, "name@smallstep.com", "", "pwd", "mfa"), false},
+		{"ok acr and amr", p4, newPayload(p4, "name@smallstep.com", "phr", "otp", "pwd"), false},
+		{"fail acr", p2, newPayload(p2, "name@smallstep.com", "0"), true},
+		{"fail missing acr", p2, newPayload(p2, "name@smallstep.com", ""), true},
+		{"fail amr", p3, newPayload(p3, "name@smallstep.com", "", "pwd"), true},
+		{"fail missing amr", p3, newPayload(p3, "name@smallstep.com", ""), true},
+		{"fail partial amr", p4, newPayload(p4, "name@smallstep.com", "phr", "pwd"), true},
+		{"fail admin acr", p4, newPayload(p4, "admin@smallstep.com", "", "pwd", "otp"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.prov.ValidatePayload(tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OIDC.ValidatePayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, http.StatusUnauthorized, sc.StatusCode())
+			}
+		})
+	}
+}
+
+func TestOIDC_Init_groupHostTags(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	config := Config{
+		Claims: globalProvisionerClaims,
+	}
+
+	tests := []struct {
+		name          string
+		groupHostTags map[string][]string
+		wantErr       bool
+	}{
+		{"ok", map[string][]string{"ops": {"env=prod", "role=web"}, "dev": {"env=dev"}}, false},
+		{"ok empty value", map[string][]string{"ops": {"web="}}, false},
+		{"ok empty", map[string][]string{"ops": {}}, false},
+		{"fail format", map[string][]string{"ops": {"env"}}, true},
+		{"fail name", map[string][]string{"ops": {"=prod"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDC{
+				Type:                  "oidc",
+				Name:                  "name",
+				ClientID:              "client-id",
+				ConfigurationEndpoint: srv.URL,
+				GroupHostTags:         tt.groupHostTags,
+			}
+			if err := p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("OIDC.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDC_hostTags(t *testing.T) {
+	p := &OIDC{
+		GroupHostTags: map[string][]string{
+			"ops": {"env=prod", "env=dev"},
+			"dev": {"env=dev", "role=web"},
+		},
+	}
+	tests := []struct {
+		name   string
+		groups []string
+		want   SSHHostTagsOption
+	}{
+		{"ok", []string{"ops"}, SSHHostTagsOption{"env=prod", "env=dev"}},
+		{"ok multiple", []string{"dev", "ops"}, SSHHostTagsOption{"env=dev", "role=web", "env=prod"}},
+		{"ok unknown", []string{"admins"}, SSHHostTagsOption{}},
+		{"ok no groups", nil, SSHHostTagsOption{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, p.hostTags(tt.groups))
+		})
+	}
+}
+
+func TestOIDC_AuthorizeSSHSign_hostTags(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p1, err := generateOIDC()
+	assert.FatalError(t, err)
+	p2, err := generateOIDC()
+	assert.FatalError(t, err)
+	p2.GroupHostTags = map[string][]string{"ops": {"env=prod"}}
+	p3, err := generateOIDC()
+	assert.FatalError(t, err)
+	p3.GroupHostTags = map[string][]string{"ops": {"env=prod"}}
+	p3.Admins = []string{"root@example.com"}
+
+	config := Config{Claims: globalProvisionerClaims}
+	for _, p := range []*OIDC{p1, p2, p3} {
+		p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+		assert.FatalError(t, p.Init(config))
+	}
+
+	t1, err := generateSimpleToken("the-issuer", p1.ClientID, &keys.Keys[0])
+	assert.FatalError(t, err)
+	t2, err := generateSimpleToken("the-issuer", p2.ClientID, &keys.Keys[0])
+	assert.FatalError(t, err)
+	t3, err := generateOIDCToken("subject", "the-issuer", p3.ClientID, "root@example.com", "", time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name  string
+		prov  *OIDC
+		token string
+		want  SSHHostTagsOption
+	}{
+		{"ok no host tags", p1, t1, nil},
+		{"ok user", p2, t2, SSHHostTagsOption{}},
+		{"ok admin", p3, t3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.prov.AuthorizeSSHSign(context.Background(), tt.token)
+			assert.FatalError(t, err)
+			var got SSHHostTagsOption
+			for _, o := range opts {
+				if v, ok := o.(SSHHostTagsOption); ok {
+					got = v
+				}
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
 func TestOIDC_authorizeToken(t *testing.T) {
 	srv := generateJWKServer(3)
 	defer srv.Close()
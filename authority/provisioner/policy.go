@@ -3,9 +3,10 @@ package provisioner
 import "github.com/smallstep/certificates/authority/policy"
 
 type policyEngine struct {
-	x509Policy    policy.X509Policy
-	sshHostPolicy policy.HostPolicy
-	sshUserPolicy policy.UserPolicy
+	x509Policy     policy.X509Policy
+	sshHostPolicy  policy.HostPolicy
+	sshUserPolicy  policy.UserPolicy
+	sshPermissions *policy.SSHPermissionsOptions
 }
 
 func newPolicyEngine(options *Options) (*policyEngine, error) {
@@ -36,10 +37,18 @@ func newPolicyEngine(options *Options) (*policyEngine, error) {
 		return nil, err
 	}
 
+	// Validate the policy for the critical options and extensions of SSH user
+	// certificates
+	sshPermissions := options.GetSSHOptions().GetPermissions()
+	if err := sshPermissions.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &policyEngine{
-		x509Policy:    x509Policy,
-		sshHostPolicy: sshHostPolicy,
-		sshUserPolicy: sshUserPolicy,
+		x509Policy:     x509Policy,
+		sshHostPolicy:  sshHostPolicy,
+		sshUserPolicy:  sshUserPolicy,
+		sshPermissions: sshPermissions,
 	}, nil
 }
 
@@ -63,3 +72,10 @@ func (p *policyEngine) getSSHUser() policy.UserPolicy {
 	}
 	return p.sshUserPolicy
 }
+
+func (p *policyEngine) getSSHPermissions() *policy.SSHPermissionsOptions {
+	if p == nil {
+		return nil
+	}
+	return p.sshPermissions
+}
@@ -0,0 +1,33 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/policy"
+)
+
+func Test_newPolicyEngine_sshPermissions(t *testing.T) {
+	permissions := &policy.SSHPermissionsOptions{
+		CriticalOptions: map[string]*policy.SSHPermissionOptions{
+			"source-address": {Required: true, FromRemoteAddress: true},
+		},
+	}
+	engine, err := newPolicyEngine(&Options{SSH: &SSHOptions{Permissions: permissions}})
+	assert.FatalError(t, err)
+	assert.Equals(t, permissions, engine.getSSHPermissions())
+
+	engine, err = newPolicyEngine(&Options{SSH: &SSHOptions{}})
+	assert.FatalError(t, err)
+	assert.Nil(t, engine.getSSHPermissions())
+
+	_, err = newPolicyEngine(&Options{SSH: &SSHOptions{Permissions: &policy.SSHPermissionsOptions{
+		Extensions: map[string]*policy.SSHPermissionOptions{
+			"permit-pty": {Forbidden: true, Required: true},
+		},
+	}}})
+	assert.Error(t, err)
+
+	var nilEngine *policyEngine
+	assert.Nil(t, nilEngine.getSSHPermissions())
+}
@@ -44,13 +44,14 @@ var ErrAllowTokenReuse = stderrors.New("allow token reuse")
 
 // Audiences stores all supported audiences by request type.
 type Audiences struct {
-	Sign      []string
-	Renew     []string
-	Revoke    []string
-	SSHSign   []string
-	SSHRevoke []string
-	SSHRenew  []string
-	SSHRekey  []string
+	Sign       []string
+	Renew      []string
+	Revoke     []string
+	SSHSign    []string
+	SSHRevoke  []string
+	SSHRenew   []string
+	SSHRekey   []string
+	NebulaSign []string
 }
 
 // All returns all supported audiences across all request types in one list.
@@ -62,6 +63,7 @@ func (a Audiences) All() (auds []string) {
 	auds = append(auds, a.SSHRevoke...)
 	auds = append(auds, a.SSHRenew...)
 	auds = append(auds, a.SSHRekey...)
+	auds = append(auds, a.NebulaSign...)
 	return
 }
 
@@ -69,13 +71,14 @@ func (a Audiences) All() (auds []string) {
 // given fragment.
 func (a Audiences) WithFragment(fragment string) Audiences {
 	ret := Audiences{
-		Sign:      make([]string, len(a.Sign)),
-		Renew:     make([]string, len(a.Renew)),
-		Revoke:    make([]string, len(a.Revoke)),
-		SSHSign:   make([]string, len(a.SSHSign)),
-		SSHRevoke: make([]string, len(a.SSHRevoke)),
-		SSHRenew:  make([]string, len(a.SSHRenew)),
-		SSHRekey:  make([]string, len(a.SSHRekey)),
+		Sign:       make([]string, len(a.Sign)),
+		Renew:      make([]string, len(a.Renew)),
+		Revoke:     make([]string, len(a.Revoke)),
+		SSHSign:    make([]string, len(a.SSHSign)),
+		SSHRevoke:  make([]string, len(a.SSHRevoke)),
+		SSHRenew:   make([]string, len(a.SSHRenew)),
+		SSHRekey:   make([]string, len(a.SSHRekey)),
+		NebulaSign: make([]string, len(a.NebulaSign)),
 	}
 	for i, s := range a.Sign {
 		if u, err := url.Parse(s); err == nil {
@@ -126,6 +129,13 @@ func (a Audiences) WithFragment(fragment string) Audiences {
 			ret.SSHRekey[i] = s
 		}
 	}
+	for i, s := range a.NebulaSign {
+		if u, err := url.Parse(s); err == nil {
+			ret.NebulaSign[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
+		} else {
+			ret.NebulaSign[i] = s
+		}
+	}
 	return ret
 }
 
@@ -166,6 +176,8 @@ const (
 	TypeSCEP Type = 10
 	// TypeNebula is used to indicate the Nebula provisioners
 	TypeNebula Type = 11
+	// TypeWIF is used to indicate the workload identity federation provisioners
+	TypeWIF Type = 12
 )
 
 // String returns the string representation of the type.
@@ -193,6 +205,8 @@ func (t Type) String() string {
 		return "SCEP"
 	case TypeNebula:
 		return "Nebula"
+	case TypeWIF:
+		return "WIF"
 	default:
 		return ""
 	}
@@ -222,6 +236,9 @@ type Config struct {
 	// AuthorizeSSHRenewFunc is a function that returns nil if a given SSH
 	// certificate can be renewed.
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
+	// IsRevokedFunc is a function that returns true if the leaf certificate of
+	// a verified chain has been revoked in the authority.
+	IsRevokedFunc IsRevokedFunc
 }
 
 type provisioner struct {
@@ -269,6 +286,8 @@ func (l *List) UnmarshalJSON(data []byte) error {
 			p = &SCEP{}
 		case "nebula":
 			p = &Nebula{}
+		case "wif":
+			p = &WIF{}
 		default:
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
@@ -1,7 +1,13 @@
 package provisioner
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -25,6 +31,18 @@ type SCEP struct {
 	// MinimumPublicKeyLength is the minimum length for public keys in CSRs
 	MinimumPublicKeyLength int `json:"minimumPublicKeyLength,omitempty"`
 
+	// DynamicChallenge enables the use of one-time challenge passwords created
+	// using the admin API.
+	DynamicChallenge bool `json:"dynamicChallenge,omitempty"`
+
+	// ChallengeWebhook configures an external service used to validate the
+	// challenge passwords, e.g. the ones issued by an MDM.
+	ChallengeWebhook *SCEPChallengeWebhook `json:"challengeWebhook,omitempty"`
+
+	// ManualApproval keeps new requests pending until they are approved using
+	// the admin API. Clients poll for the certificate using GetCertInitial.
+	ManualApproval bool `json:"manualApproval,omitempty"`
+
 	// Numerical identifier for the ContentEncryptionAlgorithm as defined in github.com/mozilla-services/pkcs7
 	// at https://github.com/mozilla-services/pkcs7/blob/33d05740a3526e382af6395d3513e73d4e66d1cb/encrypt.go#L63
 	// Defaults to 0, being DES-CBC
@@ -108,6 +126,10 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.New("only encryption algorithm identifiers from 0 to 4 are valid")
 	}
 
+	if err := s.ChallengeWebhook.Validate(); err != nil {
+		return err
+	}
+
 	// TODO: add other, SCEP specific, options?
 
 	s.ctl, err = NewController(s, s.Claims, config, s.Options)
@@ -131,11 +153,52 @@ func (s *SCEP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 	}, nil
 }
 
+// AuthorizeRenew returns an error if the renewal is disabled.
+// NOTE: This method does not actually validate the certificate or check it's
+// revocation status. Just confirms that the provisioner that created the
+// certificate was configured to allow renewals.
+func (s *SCEP) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return s.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// IsRenewalEnabled returns true if the provisioner accepts RenewalReq
+// messages.
+func (s *SCEP) IsRenewalEnabled() bool {
+	return !s.ctl.Claimer.IsDisableRenewal()
+}
+
+// RequiresApproval returns true if new requests must be approved using the
+// admin API before issuing a certificate.
+func (s *SCEP) RequiresApproval() bool {
+	return s.ManualApproval
+}
+
 // GetChallengePassword returns the challenge password
 func (s *SCEP) GetChallengePassword() string {
 	return s.secretChallengePassword
 }
 
+// HasDynamicChallenges returns true if the provisioner accepts one-time
+// challenge passwords created using the admin API.
+func (s *SCEP) HasDynamicChallenges() bool {
+	return s.DynamicChallenge
+}
+
+// HasChallengeWebhook returns true if the provisioner validates challenge
+// passwords using a webhook.
+func (s *SCEP) HasChallengeWebhook() bool {
+	return s.ChallengeWebhook != nil
+}
+
+// ValidateChallengeWebhook validates the challenge password using the
+// configured webhook. It returns false if there's no webhook configured.
+func (s *SCEP) ValidateChallengeWebhook(ctx context.Context, challenge, transactionID string, csr *x509.CertificateRequest) (bool, error) {
+	if s.ChallengeWebhook == nil {
+		return false, nil
+	}
+	return s.ChallengeWebhook.validate(ctx, s.Name, challenge, transactionID, csr)
+}
+
 // GetCapabilities returns the CA capabilities
 func (s *SCEP) GetCapabilities() []string {
 	return s.Capabilities
@@ -154,3 +217,97 @@ func (s *SCEP) ShouldIncludeRootInChain() bool {
 func (s *SCEP) GetContentEncryptionAlgorithm() int {
 	return s.encryptionAlgorithm
 }
+
+// defaultSCEPChallengeWebhookTimeout is the default timeout used in the
+// requests to a SCEP challenge webhook.
+const defaultSCEPChallengeWebhookTimeout = 10 * time.Second
+
+// SCEPChallengeWebhookRequest is the body of the request sent to a SCEP
+// challenge webhook. The CSR is the base64 encoded DER of the certificate
+// request.
+type SCEPChallengeWebhookRequest struct {
+	Provisioner   string `json:"provisioner"`
+	Challenge     string `json:"challenge"`
+	TransactionID string `json:"transactionID"`
+	CSR           string `json:"csr"`
+}
+
+// SCEPChallengeWebhookResponse is the body of the response returned by a SCEP
+// challenge webhook.
+type SCEPChallengeWebhookResponse struct {
+	Allow bool `json:"allow"`
+}
+
+// SCEPChallengeWebhook configures an external service that validates the
+// challenge passwords of a SCEP provisioner. The webhook receives a POST
+// request with a SCEPChallengeWebhookRequest and it must return a
+// SCEPChallengeWebhookResponse.
+type SCEPChallengeWebhook struct {
+	URL         string    `json:"url"`
+	BearerToken string    `json:"bearerToken,omitempty"`
+	Timeout     *Duration `json:"timeout,omitempty"`
+	client      *http.Client
+}
+
+// Validate validates and initializes the SCEP challenge webhook.
+func (w *SCEPChallengeWebhook) Validate() error {
+	switch {
+	case w == nil:
+		return nil
+	case w.URL == "":
+		return errors.New("challengeWebhook url cannot be empty")
+	case !strings.HasPrefix(w.URL, "https://") && !strings.HasPrefix(w.URL, "http://"):
+		return errors.Errorf("challengeWebhook url %s is not valid", w.URL)
+	}
+
+	timeout := defaultSCEPChallengeWebhookTimeout
+	if w.Timeout != nil && w.Timeout.Value() > 0 {
+		timeout = w.Timeout.Value()
+	}
+	w.client = &http.Client{Timeout: timeout}
+	return nil
+}
+
+func (w *SCEPChallengeWebhook) validate(ctx context.Context, provisionerName, challenge, transactionID string, csr *x509.CertificateRequest) (bool, error) {
+	var der []byte
+	if csr != nil {
+		der = csr.Raw
+	}
+	b, err := json.Marshal(SCEPChallengeWebhookRequest{
+		Provisioner:   provisionerName,
+		Challenge:     challenge,
+		TransactionID: transactionID,
+		CSR:           base64.StdEncoding.EncodeToString(der),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "error marshaling challenge webhook request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(b))
+	if err != nil {
+		return false, errors.Wrap(err, "error creating challenge webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.BearerToken)
+	}
+
+	client := w.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultSCEPChallengeWebhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, errors.Wrapf(err, "error doing challenge webhook request to %s", w.URL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return false, errors.Errorf("challenge webhook request to %s failed with status code %d", w.URL, resp.StatusCode)
+	}
+
+	var res SCEPChallengeWebhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return false, errors.Wrapf(err, "error decoding challenge webhook response from %s", w.URL)
+	}
+	return res.Allow, nil
+}
@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSCEPChallengeWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		w       *SCEPChallengeWebhook
+		wantErr bool
+	}{
+		{"ok nil", nil, false},
+		{"ok", &SCEPChallengeWebhook{URL: "https://mdm.example.com/scep"}, false},
+		{"ok timeout", &SCEPChallengeWebhook{URL: "https://mdm.example.com/scep", Timeout: &Duration{Duration: time.Second}}, false},
+		{"fail empty", &SCEPChallengeWebhook{}, true},
+		{"fail url", &SCEPChallengeWebhook{URL: "mdm.example.com/scep"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.w.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SCEPChallengeWebhook.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSCEP_ValidateChallengeWebhook(t *testing.T) {
+	csr := &x509.CertificateRequest{Raw: []byte("csr")}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req SCEPChallengeWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.Provisioner != "scep" || req.TransactionID != "transaction" || req.CSR != base64.StdEncoding.EncodeToString([]byte("csr")) {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.Challenge == "bad-json" {
+			w.Write([]byte("{"))
+			return
+		}
+		json.NewEncoder(w).Encode(SCEPChallengeWebhookResponse{
+			Allow: req.Challenge == "allowed",
+		})
+	}))
+	defer srv.Close()
+
+	webhook := &SCEPChallengeWebhook{URL: srv.URL, BearerToken: "secret"}
+	if err := webhook.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		p         *SCEP
+		challenge string
+		want      bool
+		wantErr   bool
+	}{
+		{"ok", &SCEP{Name: "scep", ChallengeWebhook: webhook}, "allowed", true, false},
+		{"ok denied", &SCEP{Name: "scep", ChallengeWebhook: webhook}, "denied", false, false},
+		{"ok no webhook", &SCEP{Name: "scep"}, "allowed", false, false},
+		{"fail json", &SCEP{Name: "scep", ChallengeWebhook: webhook}, "bad-json", false, true},
+		{"fail status", &SCEP{Name: "scep", ChallengeWebhook: &SCEPChallengeWebhook{URL: srv.URL}}, "allowed", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.p.ValidateChallengeWebhook(context.Background(), tt.challenge, "transaction", csr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SCEP.ValidateChallengeWebhook() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("SCEP.ValidateChallengeWebhook() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
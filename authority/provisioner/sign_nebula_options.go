@@ -0,0 +1,201 @@
+package provisioner
+
+import (
+	"net"
+	"time"
+
+	nebula "github.com/slackhq/nebula/cert"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// NebulaCertModifier is the interface used to change properties in a Nebula
+// certificate.
+type NebulaCertModifier interface {
+	SignOption
+	Modify(cert *nebula.NebulaCertificate, opts SignNebulaOptions) error
+}
+
+// NebulaCertValidator is the interface used to validate a Nebula certificate.
+type NebulaCertValidator interface {
+	SignOption
+	Valid(cert *nebula.NebulaCertificate, opts SignNebulaOptions) error
+}
+
+// SignNebulaOptions contains the options that can be passed to the SignNebula
+// method. IPs are the overlay addresses of the host in CIDR notation, e.g.
+// 10.1.0.10/16.
+type SignNebulaOptions struct {
+	Name      string       `json:"name"`
+	IPs       []string     `json:"ips"`
+	Groups    []string     `json:"groups,omitempty"`
+	NotBefore TimeDuration `json:"notBefore,omitempty"`
+	NotAfter  TimeDuration `json:"notAfter,omitempty"`
+}
+
+// Validate validates the given SignNebulaOptions.
+func (o SignNebulaOptions) Validate() error {
+	if o.Name == "" {
+		return errs.BadRequest("name cannot be empty")
+	}
+	if len(o.IPs) == 0 {
+		return errs.BadRequest("ips cannot be empty")
+	}
+	if _, err := o.ipNets(); err != nil {
+		return err
+	}
+	for _, g := range o.Groups {
+		if g == "" {
+			return errs.BadRequest("groups cannot contain empty values")
+		}
+	}
+	return nil
+}
+
+// Modify implements NebulaCertModifier and sets the name, IPs, groups and
+// validity in the Nebula certificate.
+func (o SignNebulaOptions) Modify(cert *nebula.NebulaCertificate, _ SignNebulaOptions) error {
+	ips, err := o.ipNets()
+	if err != nil {
+		return err
+	}
+
+	cert.Details.Name = o.Name
+	cert.Details.Ips = ips
+	cert.Details.Groups = o.Groups
+	cert.Details.InvertedGroups = make(map[string]struct{}, len(o.Groups))
+	for _, g := range o.Groups {
+		cert.Details.InvertedGroups[g] = struct{}{}
+	}
+
+	t := now()
+	if !o.NotBefore.IsZero() {
+		cert.Details.NotBefore = o.NotBefore.RelativeTime(t)
+	}
+	if !o.NotAfter.IsZero() {
+		cert.Details.NotAfter = o.NotAfter.RelativeTime(t)
+	}
+	if !cert.Details.NotBefore.IsZero() && !cert.Details.NotAfter.IsZero() &&
+		cert.Details.NotBefore.After(cert.Details.NotAfter) {
+		return errs.BadRequest("nebula certificate notBefore cannot be greater than notAfter")
+	}
+	return nil
+}
+
+func (o SignNebulaOptions) ipNets() ([]*net.IPNet, error) {
+	ips := make([]*net.IPNet, len(o.IPs))
+	for i, s := range o.IPs {
+		ip, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errs.BadRequest("ips %s is not a valid CIDR", s)
+		}
+		if ip = ip.To4(); ip == nil {
+			return nil, errs.BadRequest("ips %s is not an IPv4 address", s)
+		}
+		ipNet.IP = ip
+		ips[i] = ipNet
+	}
+	return ips, nil
+}
+
+// nebulaValidityModifier is a NebulaCertModifier that sets the default
+// validity of a Nebula certificate if it has not been set.
+type nebulaValidityModifier time.Duration
+
+// Modify implements NebulaCertModifier.
+func (m nebulaValidityModifier) Modify(cert *nebula.NebulaCertificate, _ SignNebulaOptions) error {
+	if cert.Details.NotBefore.IsZero() {
+		cert.Details.NotBefore = now()
+	}
+	if cert.Details.NotAfter.IsZero() {
+		cert.Details.NotAfter = cert.Details.NotBefore.Add(time.Duration(m))
+	}
+	return nil
+}
+
+// nebulaValidityValidator validates the duration of a Nebula certificate.
+type nebulaValidityValidator struct {
+	min time.Duration
+	max time.Duration
+}
+
+// Valid implements NebulaCertValidator.
+func (v nebulaValidityValidator) Valid(cert *nebula.NebulaCertificate, _ SignNebulaOptions) error {
+	d := cert.Details.NotAfter.Sub(cert.Details.NotBefore)
+	switch {
+	case d < v.min:
+		return errs.Forbidden("requested duration of %v is less than the authorized minimum certificate duration of %v", d, v.min)
+	case d > v.max:
+		return errs.Forbidden("requested duration of %v is more than the authorized maximum certificate duration of %v", d, v.max)
+	default:
+		return nil
+	}
+}
+
+// nebulaCertValidator validates the name, IPs and groups of a Nebula
+// certificate. If Subnets or Groups are set, the IPs and groups must be in
+// them. If Authorization is set, the IPs and groups must also be in that
+// certificate.
+type nebulaCertValidator struct {
+	Name          string
+	Subnets       []*net.IPNet
+	Groups        []string
+	Authorization *nebula.NebulaCertificate
+}
+
+// Valid implements NebulaCertValidator.
+func (v nebulaCertValidator) Valid(cert *nebula.NebulaCertificate, _ SignNebulaOptions) error {
+	if cert.Details.IsCA {
+		return errs.Forbidden("nebula certificate cannot be a CA")
+	}
+	if cert.Details.Name != v.Name {
+		return errs.Forbidden("nebula certificate name does not match - got %s, want %s", cert.Details.Name, v.Name)
+	}
+
+	for _, ip := range cert.Details.Ips {
+		if len(v.Subnets) > 0 && !nebulaSubnetsContain(v.Subnets, ip.IP) {
+			return errs.Forbidden("nebula certificate ip %s is not in the allowed subnets", ip)
+		}
+		if v.Authorization != nil && !nebulaIPsContain(v.Authorization.Details.Ips, ip) {
+			return errs.Forbidden("nebula certificate ip %s is not in the authorization certificate", ip)
+		}
+	}
+
+	for _, g := range cert.Details.Groups {
+		if len(v.Groups) > 0 && !nebulaGroupsContain(v.Groups, g) {
+			return errs.Forbidden("nebula certificate group %s is not allowed", g)
+		}
+		if v.Authorization != nil && !nebulaGroupsContain(v.Authorization.Details.Groups, g) {
+			return errs.Forbidden("nebula certificate group %s is not in the authorization certificate", g)
+		}
+	}
+
+	return nil
+}
+
+func nebulaSubnetsContain(subnets []*net.IPNet, ip net.IP) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func nebulaIPsContain(ips []*net.IPNet, ip *net.IPNet) bool {
+	for _, ipNet := range ips {
+		if ipNet.IP.Equal(ip.IP) && ipNet.Mask.String() == ip.Mask.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func nebulaGroupsContain(groups []string, group string) bool {
+	for _, g := range groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package provisioner
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/slackhq/nebula/cert"
+)
+
+func TestSignNebulaOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    SignNebulaOptions
+		wantErr bool
+	}{
+		{"ok", SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16"}}, false},
+		{"ok groups", SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16", "10.2.0.1/16"}, Groups: []string{"test", "servers"}}, false},
+		{"fail name", SignNebulaOptions{IPs: []string{"10.1.0.1/16"}}, true},
+		{"fail ips", SignNebulaOptions{Name: "test.lan"}, true},
+		{"fail cidr", SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1"}}, true},
+		{"fail ipv6", SignNebulaOptions{Name: "test.lan", IPs: []string{"fd00::1/64"}}, true},
+		{"fail groups", SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16"}, Groups: []string{""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SignNebulaOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignNebulaOptions_Modify(t *testing.T) {
+	tm, fn := mockNow()
+	defer fn()
+
+	tests := []struct {
+		name    string
+		opts    SignNebulaOptions
+		want    cert.NebulaCertificateDetails
+		wantErr bool
+	}{
+		{"ok", SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1/16"}, Groups: []string{"test"}}, cert.NebulaCertificateDetails{
+			Name:           "test.lan",
+			Ips:            []*net.IPNet{mustNebulaIPNet(t, "10.1.0.1/16")},
+			Groups:         []string{"test"},
+			InvertedGroups: map[string]struct{}{"test": {}},
+		}, false},
+		{"ok validity", SignNebulaOptions{
+			Name:      "test.lan",
+			IPs:       []string{"10.1.0.1/16"},
+			NotBefore: NewTimeDuration(tm.Add(time.Minute)),
+			NotAfter:  NewTimeDuration(tm.Add(time.Hour)),
+		}, cert.NebulaCertificateDetails{
+			Name:           "test.lan",
+			Ips:            []*net.IPNet{mustNebulaIPNet(t, "10.1.0.1/16")},
+			InvertedGroups: map[string]struct{}{},
+			NotBefore:      tm.Add(time.Minute),
+			NotAfter:       tm.Add(time.Hour),
+		}, false},
+		{"fail cidr", SignNebulaOptions{Name: "test.lan", IPs: []string{"10.1.0.1"}}, cert.NebulaCertificateDetails{}, true},
+		{"fail validity", SignNebulaOptions{
+			Name:      "test.lan",
+			IPs:       []string{"10.1.0.1/16"},
+			NotBefore: NewTimeDuration(tm.Add(time.Hour)),
+			NotAfter:  NewTimeDuration(tm.Add(time.Minute)),
+		}, cert.NebulaCertificateDetails{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := &cert.NebulaCertificate{}
+			err := tt.opts.Modify(nc, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignNebulaOptions.Modify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(nc.Details, tt.want) {
+				t.Errorf("SignNebulaOptions.Modify() = %v, want %v", nc.Details, tt.want)
+			}
+		})
+	}
+}
+
+func Test_nebulaValidityModifier_Modify(t *testing.T) {
+	tm, fn := mockNow()
+	defer fn()
+
+	tests := []struct {
+		name          string
+		m             nebulaValidityModifier
+		notBefore     time.Time
+		notAfter      time.Time
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+	}{
+		{"ok", nebulaValidityModifier(time.Hour), time.Time{}, time.Time{}, tm, tm.Add(time.Hour)},
+		{"ok notBefore", nebulaValidityModifier(time.Hour), tm.Add(time.Minute), time.Time{}, tm.Add(time.Minute), tm.Add(time.Minute + time.Hour)},
+		{"ok notAfter", nebulaValidityModifier(time.Hour), time.Time{}, tm.Add(2 * time.Hour), tm, tm.Add(2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := &cert.NebulaCertificate{}
+			nc.Details.NotBefore = tt.notBefore
+			nc.Details.NotAfter = tt.notAfter
+			if err := tt.m.Modify(nc, SignNebulaOptions{}); err != nil {
+				t.Fatalf("nebulaValidityModifier.Modify() error = %v", err)
+			}
+			if !nc.Details.NotBefore.Equal(tt.wantNotBefore) {
+				t.Errorf("nebulaValidityModifier.Modify() notBefore = %v, want %v", nc.Details.NotBefore, tt.wantNotBefore)
+			}
+			if !nc.Details.NotAfter.Equal(tt.wantNotAfter) {
+				t.Errorf("nebulaValidityModifier.Modify() notAfter = %v, want %v", nc.Details.NotAfter, tt.wantNotAfter)
+			}
+		})
+	}
+}
+
+func Test_nebulaValidityValidator_Valid(t *testing.T) {
+	tm := time.Now()
+	v := nebulaValidityValidator{min: 5 * time.Minute, max: 24 * time.Hour}
+	tests := []struct {
+		name    string
+		d       time.Duration
+		wantErr bool
+	}{
+		{"ok", time.Hour, false},
+		{"ok min", 5 * time.Minute, false},
+		{"ok max", 24 * time.Hour, false},
+		{"fail min", time.Minute, true},
+		{"fail max", 25 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nc := &cert.NebulaCertificate{}
+			nc.Details.NotBefore = tm
+			nc.Details.NotAfter = tm.Add(tt.d)
+			if err := v.Valid(nc, SignNebulaOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("nebulaValidityValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_nebulaCertValidator_Valid(t *testing.T) {
+	authorization := &cert.NebulaCertificate{
+		Details: cert.NebulaCertificateDetails{
+			Name:   "test.lan",
+			Ips:    []*net.IPNet{mustNebulaIPNet(t, "10.1.0.1/16")},
+			Groups: []string{"test", "servers"},
+		},
+	}
+	newCert := func(name string, ip string, groups ...string) *cert.NebulaCertificate {
+		return &cert.NebulaCertificate{
+			Details: cert.NebulaCertificateDetails{
+				Name:   name,
+				Ips:    []*net.IPNet{mustNebulaIPNet(t, ip)},
+				Groups: groups,
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		v       nebulaCertValidator
+		cert    *cert.NebulaCertificate
+		wantErr bool
+	}{
+		{"ok", nebulaCertValidator{Name: "test.lan"}, newCert("test.lan", "10.2.0.1/16", "any"), false},
+		{"ok authorization", nebulaCertValidator{Name: "test.lan", Authorization: authorization}, newCert("test.lan", "10.1.0.1/16", "servers"), false},
+		{"ok subnets", nebulaCertValidator{Name: "test.lan", Subnets: []*net.IPNet{mustNebulaIPNet(t, "10.1.0.0/24")}}, newCert("test.lan", "10.1.0.1/16"), false},
+		{"ok groups", nebulaCertValidator{Name: "test.lan", Groups: []string{"servers"}}, newCert("test.lan", "10.1.0.1/16", "servers"), false},
+		{"fail ca", nebulaCertValidator{Name: "test.lan"}, &cert.NebulaCertificate{Details: cert.NebulaCertificateDetails{Name: "test.lan", IsCA: true}}, true},
+		{"fail name", nebulaCertValidator{Name: "test.lan"}, newCert("other.lan", "10.1.0.1/16"), true},
+		{"fail authorization ip", nebulaCertValidator{Name: "test.lan", Authorization: authorization}, newCert("test.lan", "10.1.0.2/16"), true},
+		{"fail authorization group", nebulaCertValidator{Name: "test.lan", Authorization: authorization}, newCert("test.lan", "10.1.0.1/16", "admins"), true},
+		{"fail subnets", nebulaCertValidator{Name: "test.lan", Subnets: []*net.IPNet{mustNebulaIPNet(t, "10.1.1.0/24")}}, newCert("test.lan", "10.1.0.1/16"), true},
+		{"fail groups", nebulaCertValidator{Name: "test.lan", Groups: []string{"servers"}}, newCert("test.lan", "10.1.0.1/16", "Servers"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.v.Valid(tt.cert, SignNebulaOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("nebulaCertValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
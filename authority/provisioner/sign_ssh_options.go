@@ -44,6 +44,29 @@ type SSHCertOptionsValidator interface {
 	Valid(got SignSSHOptions) error
 }
 
+// SSHHostTagsOption is a SignOption with the SSH host tags, in the name=value
+// format, that a user is entitled to. If present, the authority only allows
+// the principals of a user certificate that are hosts in the SSH host
+// inventory if the host has one of these tags.
+type SSHHostTagsOption []string
+
+// Includes returns true if the given tag is one of the tags in the option.
+func (o SSHHostTagsOption) Includes(tag string) bool {
+	for _, t := range o {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SSHPermissionsOption is a SignOption with the provisioner policy for the
+// critical options and extensions of SSH user certificates. The policy is
+// applied by the authority, as it might require values from the request.
+type SSHPermissionsOption struct {
+	Options *policy.SSHPermissionsOptions
+}
+
 // SignSSHOptions contains the options that can be passed to the SignSSH method.
 type SignSSHOptions struct {
 	CertType     string          `json:"certType"`
@@ -53,6 +76,11 @@ type SignSSHOptions struct {
 	ValidBefore  TimeDuration    `json:"validBefore,omitempty"`
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 	Backdate     time.Duration   `json:"-"`
+
+	// AuthorizedHosts are the principals that the authority has authorized
+	// as hosts in the SSH host inventory using the SSHHostTagsOption. They
+	// are set only when the options are validated.
+	AuthorizedHosts []string `json:"-"`
 }
 
 // Validate validates the given SignSSHOptions.
@@ -313,6 +341,11 @@ type sshCertOptionsValidator SignSSHOptions
 // SSHOptions match.
 func (v sshCertOptionsValidator) Valid(got SignSSHOptions) error {
 	want := SignSSHOptions(v)
+	// Hosts authorized by the host tags are allowed as principals.
+	if len(want.Principals) > 0 && len(got.AuthorizedHosts) > 0 {
+		principals := make([]string, 0, len(want.Principals)+len(got.AuthorizedHosts))
+		want.Principals = append(append(principals, want.Principals...), got.AuthorizedHosts...)
+	}
 	return want.match(got)
 }
 
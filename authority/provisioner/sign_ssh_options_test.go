@@ -202,6 +202,28 @@ func TestSSHOptions_Match(t *testing.T) {
 	}
 }
 
+func Test_sshCertOptionsValidator_Valid(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       sshCertOptionsValidator
+		got     SignSSHOptions
+		wantErr bool
+	}{
+		{"ok", sshCertOptionsValidator{Principals: []string{"foo", "bar"}}, SignSSHOptions{Principals: []string{"foo"}}, false},
+		{"ok empty", sshCertOptionsValidator{Principals: []string{"foo"}}, SignSSHOptions{}, false},
+		{"ok authorized hosts", sshCertOptionsValidator{Principals: []string{"foo"}}, SignSSHOptions{Principals: []string{"foo", "web1"}, AuthorizedHosts: []string{"web1"}}, false},
+		{"fail", sshCertOptionsValidator{Principals: []string{"foo"}}, SignSSHOptions{Principals: []string{"foo", "web1"}}, true},
+		{"fail not authorized hosts", sshCertOptionsValidator{Principals: []string{"foo"}}, SignSSHOptions{Principals: []string{"foo", "web1", "web2"}, AuthorizedHosts: []string{"web1"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.v.Valid(tt.got); (err != nil) != tt.wantErr {
+				t.Errorf("sshCertOptionsValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_sshCertPrincipalsModifier_Modify(t *testing.T) {
 	type test struct {
 		modifier sshCertPrincipalsModifier
@@ -0,0 +1,291 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// spiffeScheme is the scheme of a SPIFFE ID.
+const spiffeScheme = "spiffe"
+
+// X5CSPIFFE configures an X5C provisioner to only accept tokens signed by
+// SPIFFE X509-SVIDs. The SPIFFE ID in the URI SAN of the SVID must belong to
+// the trust domain and, if configured, its path must match one of the allowed
+// paths.
+//
+// The allowed paths support the wildcards in path.Match, and a path ending in
+// "/*" matches any path below it, e.g. "/ns/prod/*" allows "/ns/prod/sa/web".
+//
+// The trust bundle can be loaded from a file with a SPIFFE bundle, as returned
+// by a SPIFFE bundle endpoint, or with PEM encoded certificates. The file is
+// reloaded when it changes.
+type X5CSPIFFE struct {
+	TrustDomain  string   `json:"trustDomain"`
+	AllowedPaths []string `json:"allowedPaths,omitempty"`
+	BundleFile   string   `json:"bundleFile,omitempty"`
+	bundle       *spiffeBundle
+}
+
+// Validate validates and initializes the SPIFFE configuration.
+func (s *X5CSPIFFE) Validate() error {
+	switch {
+	case s == nil:
+		return nil
+	case s.TrustDomain == "":
+		return errors.New("spiffe trustDomain cannot be empty")
+	case !isValidSPIFFETrustDomain(s.TrustDomain):
+		return errors.Errorf("spiffe trustDomain %s is not valid", s.TrustDomain)
+	}
+
+	for _, p := range s.AllowedPaths {
+		if !strings.HasPrefix(p, "/") {
+			return errors.Errorf("spiffe allowedPaths %s must start with a '/'", p)
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "spiffe allowedPaths %s is not valid", p)
+		}
+	}
+
+	if s.BundleFile != "" {
+		s.bundle = &spiffeBundle{filename: s.BundleFile}
+		if _, err := s.bundle.Pool(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify validates the SPIFFE ID of the given X509-SVID and returns it.
+func (s *X5CSPIFFE) Verify(svid *x509.Certificate) (*url.URL, error) {
+	if svid.IsCA {
+		return nil, errors.New("x509-svid cannot be a CA certificate")
+	}
+	if svid.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		return nil, errors.New("x509-svid cannot have the keyCertSign or cRLSign key usages")
+	}
+	if len(svid.URIs) != 1 {
+		return nil, errors.Errorf("x509-svid must have exactly one URI SAN, but it has %d", len(svid.URIs))
+	}
+
+	id := svid.URIs[0]
+	if err := validateSPIFFEID(id); err != nil {
+		return nil, err
+	}
+	if id.Host != s.TrustDomain {
+		return nil, errors.Errorf("spiffe id %s does not belong to the trust domain %s", id, s.TrustDomain)
+	}
+	if len(s.AllowedPaths) > 0 && !s.isAllowedPath(id.Path) {
+		return nil, errors.Errorf("spiffe id %s is not allowed", id)
+	}
+	return id, nil
+}
+
+func (s *X5CSPIFFE) isAllowedPath(p string) bool {
+	for _, pattern := range s.AllowedPaths {
+		if strings.HasSuffix(pattern, "/*") {
+			prefix := strings.TrimSuffix(pattern, "*")
+			if strings.HasPrefix(p, prefix) && len(p) > len(prefix) {
+				return true
+			}
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSPIFFEID validates that the given URL is a SPIFFE ID.
+func validateSPIFFEID(id *url.URL) error {
+	switch {
+	case id.Scheme != spiffeScheme:
+		return errors.Errorf("%s is not a spiffe id", id)
+	case !isValidSPIFFETrustDomain(id.Host):
+		return errors.Errorf("spiffe id %s has an invalid trust domain", id)
+	case id.User != nil, id.RawQuery != "", id.Fragment != "", id.Opaque != "":
+		return errors.Errorf("spiffe id %s cannot have user info, query or fragment", id)
+	case id.Path == "" || id.Path == "/":
+		return errors.Errorf("spiffe id %s must have a path", id)
+	case strings.HasSuffix(id.Path, "/"), strings.Contains(id.Path, "//"):
+		return errors.Errorf("spiffe id %s has an invalid path", id)
+	}
+	for _, segment := range strings.Split(id.Path[1:], "/") {
+		if segment == "." || segment == ".." {
+			return errors.Errorf("spiffe id %s has an invalid path", id)
+		}
+	}
+	return nil
+}
+
+// isValidSPIFFETrustDomain returns true if the trust domain only contains
+// lowercase letters, numbers, dots, dashes and underscores.
+func isValidSPIFFETrustDomain(td string) bool {
+	if td == "" {
+		return false
+	}
+	for _, c := range td {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// spiffeTemplateData is the data available in the templates under the SPIFFE
+// variable.
+type spiffeTemplateData struct {
+	ID          string
+	TrustDomain string
+	Path        string
+}
+
+func newSPIFFETemplateData(id *url.URL) spiffeTemplateData {
+	return spiffeTemplateData{
+		ID:          id.String(),
+		TrustDomain: id.Host,
+		Path:        id.Path,
+	}
+}
+
+// spiffeBundle is a trust bundle loaded from a file. The file is read again if
+// its modification time or size change. If the new file cannot be parsed, the
+// last valid bundle is used.
+type spiffeBundle struct {
+	filename string
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	pool     *x509.CertPool
+}
+
+// Pool returns the certificate pool with the roots in the bundle.
+func (b *spiffeBundle) Pool() (*x509.CertPool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fi, err := os.Stat(b.filename)
+	if err != nil {
+		if b.pool != nil {
+			return b.pool, nil
+		}
+		return nil, errors.Wrapf(err, "error reading %s", b.filename)
+	}
+	if b.pool != nil && fi.ModTime().Equal(b.modTime) && fi.Size() == b.size {
+		return b.pool, nil
+	}
+
+	data, err := os.ReadFile(b.filename)
+	if err != nil {
+		if b.pool != nil {
+			return b.pool, nil
+		}
+		return nil, errors.Wrapf(err, "error reading %s", b.filename)
+	}
+	certs, err := parseSPIFFEBundle(data)
+	if err != nil {
+		if b.pool != nil {
+			return b.pool, nil
+		}
+		return nil, errors.Wrapf(err, "error parsing %s", b.filename)
+	}
+
+	pool := x509.NewCertPool()
+	for _, crt := range certs {
+		pool.AddCert(crt)
+	}
+	b.pool = pool
+	b.modTime = fi.ModTime()
+	b.size = fi.Size()
+	return b.pool, nil
+}
+
+// spiffeBundleKeySet is the JWK set format used by SPIFFE bundle endpoints.
+type spiffeBundleKeySet struct {
+	Keys []struct {
+		Use string   `json:"use"`
+		X5c []string `json:"x5c"`
+	} `json:"keys"`
+}
+
+// parseSPIFFEBundle parses the X.509 authorities of a SPIFFE bundle in JWK set
+// format, or a list of PEM encoded certificates.
+func parseSPIFFEBundle(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		var ks spiffeBundleKeySet
+		if err := json.Unmarshal(data, &ks); err != nil {
+			return nil, errors.Wrap(err, "error parsing spiffe bundle")
+		}
+		for _, k := range ks.Keys {
+			// Skip JWT authorities.
+			if k.Use != "x509-svid" {
+				continue
+			}
+			if len(k.X5c) != 1 {
+				return nil, errors.New("error parsing spiffe bundle: x509-svid keys must have exactly one certificate")
+			}
+			der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing spiffe bundle")
+			}
+			crt, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing spiffe bundle")
+			}
+			certs = append(certs, crt)
+		}
+	} else {
+		var block *pem.Block
+		for len(data) > 0 {
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			crt, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing x509 certificate from PEM block")
+			}
+			certs = append(certs, crt)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("spiffe bundle does not contain any x509 authority")
+	}
+	return certs, nil
+}
+
+// spiffeIDValidator validates that the certificate contains the SPIFFE ID as
+// its only URI SAN.
+type spiffeIDValidator string
+
+// Valid implements the CertificateValidator interface.
+func (v spiffeIDValidator) Valid(cert *x509.Certificate, o SignOptions) error {
+	var found bool
+	for _, u := range cert.URIs {
+		if u.String() != string(v) {
+			return errors.Errorf("certificate URI SAN %s does not match the spiffe id %s", u, string(v))
+		}
+		found = true
+	}
+	if !found {
+		return errors.Errorf("certificate does not contain the spiffe id %s", string(v))
+	}
+	return nil
+}
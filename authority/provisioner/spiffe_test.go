@@ -0,0 +1,445 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+)
+
+func mustSPIFFEID(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// generateSVID returns an X509-SVID with the given URI SANs signed by the
+// given CA, and a JWK with its key.
+func generateSVID(t *testing.T, ca *minica.CA, uris ...string) (*x509.Certificate, *jose.JSONWebKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		PublicKey:   key.Public(),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, s := range uris {
+		template.URIs = append(template.URIs, mustSPIFFEID(t, s))
+	}
+	crt, err := ca.Sign(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crt, &jose.JSONWebKey{Key: key, KeyID: "svid"}
+}
+
+// writeSPIFFEBundle writes a SPIFFE bundle in JWK set format with the given
+// certificates.
+func writeSPIFFEBundle(t *testing.T, fn string, certs ...*x509.Certificate) {
+	t.Helper()
+	var ks spiffeBundleKeySet
+	for _, crt := range certs {
+		ks.Keys = append(ks.Keys, struct {
+			Use string   `json:"use"`
+			X5c []string `json:"x5c"`
+		}{"x509-svid", []string{base64.StdEncoding.EncodeToString(crt.Raw)}})
+	}
+	b, err := json.Marshal(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fn, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestX5CSPIFFE_Validate(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	bundleFile := filepath.Join(dir, "bundle.json")
+	writeSPIFFEBundle(t, bundleFile, ca.Root)
+	emptyFile := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(emptyFile, []byte(`{"keys":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		s       *X5CSPIFFE
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok", &X5CSPIFFE{TrustDomain: "example.org"}, false},
+		{"ok/paths", &X5CSPIFFE{TrustDomain: "example.org", AllowedPaths: []string{"/ns/prod/*", "/web"}}, false},
+		{"ok/bundle", &X5CSPIFFE{TrustDomain: "example.org", BundleFile: bundleFile}, false},
+		{"fail/trust-domain", &X5CSPIFFE{}, true},
+		{"fail/trust-domain-invalid", &X5CSPIFFE{TrustDomain: "Example.org"}, true},
+		{"fail/path", &X5CSPIFFE{TrustDomain: "example.org", AllowedPaths: []string{"ns/prod"}}, true},
+		{"fail/path-pattern", &X5CSPIFFE{TrustDomain: "example.org", AllowedPaths: []string{"/ns/[prod"}}, true},
+		{"fail/bundle-missing", &X5CSPIFFE{TrustDomain: "example.org", BundleFile: filepath.Join(dir, "missing.json")}, true},
+		{"fail/bundle-empty", &X5CSPIFFE{TrustDomain: "example.org", BundleFile: emptyFile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.s.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("X5CSPIFFE.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX5CSPIFFE_Verify(t *testing.T) {
+	s := &X5CSPIFFE{
+		TrustDomain:  "example.org",
+		AllowedPaths: []string{"/ns/prod/*", "/web", "/ns/*/sa/api"},
+	}
+	newCert := func(uris ...string) *x509.Certificate {
+		crt := &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature}
+		for _, u := range uris {
+			crt.URIs = append(crt.URIs, mustSPIFFEID(t, u))
+		}
+		return crt
+	}
+	ca := newCert("spiffe://example.org/web")
+	ca.IsCA = true
+	certSign := newCert("spiffe://example.org/web")
+	certSign.KeyUsage |= x509.KeyUsageCertSign
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		want    string
+		wantErr bool
+	}{
+		{"ok", newCert("spiffe://example.org/web"), "spiffe://example.org/web", false},
+		{"ok/prefix", newCert("spiffe://example.org/ns/prod/sa/web"), "spiffe://example.org/ns/prod/sa/web", false},
+		{"ok/match", newCert("spiffe://example.org/ns/dev/sa/api"), "spiffe://example.org/ns/dev/sa/api", false},
+		{"fail/not-allowed", newCert("spiffe://example.org/ns/dev/sa/web"), "", true},
+		{"fail/prefix", newCert("spiffe://example.org/ns/prod/"), "", true},
+		{"fail/trust-domain", newCert("spiffe://example.com/web"), "", true},
+		{"fail/scheme", newCert("https://example.org/web"), "", true},
+		{"fail/no-path", newCert("spiffe://example.org"), "", true},
+		{"fail/dot-segment", newCert("spiffe://example.org/ns/prod/../admin"), "", true},
+		{"fail/query", newCert("spiffe://example.org/web?foo=bar"), "", true},
+		{"fail/port", newCert("spiffe://example.org:8443/web"), "", true},
+		{"fail/no-uris", newCert(), "", true},
+		{"fail/multiple-uris", newCert("spiffe://example.org/web", "spiffe://example.org/ns/prod/sa/web"), "", true},
+		{"fail/ca", ca, "", true},
+		{"fail/cert-sign", certSign, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Verify(tt.cert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("X5CSPIFFE.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != "" && got.String() != tt.want {
+				t.Errorf("X5CSPIFFE.Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSPIFFEBundle(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "bundle.json")
+	writeSPIFFEBundle(t, fn, ca.Root, ca.Intermediate)
+	jwkSet, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw})...)
+	withJWTAuthority := []byte(`{"spiffe_sequence": 1, "keys": [
+		{"use": "jwt-svid", "kty": "EC", "kid": "foo"},
+		{"use": "x509-svid", "x5c": ["` + base64.StdEncoding.EncodeToString(ca.Root.Raw) + `"]}
+	]}`)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr bool
+	}{
+		{"ok/jwk-set", jwkSet, 2, false},
+		{"ok/pem", pemBundle, 2, false},
+		{"ok/jwt-authority", withJWTAuthority, 1, false},
+		{"fail/json", []byte(`{"keys":`), 0, true},
+		{"fail/x5c", []byte(`{"keys":[{"use":"x509-svid","x5c":[]}]}`), 0, true},
+		{"fail/base64", []byte(`{"keys":[{"use":"x509-svid","x5c":["%%%"]}]}`), 0, true},
+		{"fail/certificate", []byte(`{"keys":[{"use":"x509-svid","x5c":["Zm9v"]}]}`), 0, true},
+		{"fail/empty", []byte(""), 0, true},
+		{"fail/no-x509", []byte(`{"keys":[{"use":"jwt-svid"}]}`), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSPIFFEBundle(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSPIFFEBundle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseSPIFFEBundle() = %d certificates, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_spiffeBundle_reload(t *testing.T) {
+	ca1, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca2, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svid1, _ := generateSVID(t, ca1, "spiffe://example.org/web")
+	svid2, _ := generateSVID(t, ca2, "spiffe://example.org/web")
+
+	verify := func(pool *x509.CertPool, crt *x509.Certificate, intermediate *x509.Certificate) error {
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(intermediate)
+		_, err := crt.Verify(x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+
+	fn := filepath.Join(t.TempDir(), "bundle.json")
+	writeSPIFFEBundle(t, fn, ca1.Root)
+	b := &spiffeBundle{filename: fn}
+	pool, err := b.Pool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(pool, svid1, ca1.Intermediate); err != nil {
+		t.Errorf("spiffeBundle.Pool() does not verify svid1: %v", err)
+	}
+
+	// Rotate the bundle, the modification time is changed explicitly as the
+	// resolution of the file system might be too coarse.
+	writeSPIFFEBundle(t, fn, ca2.Root)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(fn, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if pool, err = b.Pool(); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(pool, svid1, ca1.Intermediate); err == nil {
+		t.Error("spiffeBundle.Pool() verifies svid1 after rotation")
+	}
+	if err := verify(pool, svid2, ca2.Intermediate); err != nil {
+		t.Errorf("spiffeBundle.Pool() does not verify svid2: %v", err)
+	}
+
+	// An invalid bundle keeps the last valid one.
+	if err := os.WriteFile(fn, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Minute)
+	if err := os.Chtimes(fn, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if pool, err = b.Pool(); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(pool, svid2, ca2.Intermediate); err != nil {
+		t.Errorf("spiffeBundle.Pool() does not verify svid2: %v", err)
+	}
+}
+
+func Test_spiffeSANs(t *testing.T) {
+	id := mustSPIFFEID(t, "spiffe://example.org/web")
+	tests := []struct {
+		name    string
+		sans    []string
+		want    []string
+		wantErr bool
+	}{
+		{"ok/empty", nil, []string{"spiffe://example.org/web"}, false},
+		{"ok/append", []string{"web.example.org", "127.0.0.1"}, []string{"web.example.org", "127.0.0.1", "spiffe://example.org/web"}, false},
+		{"ok/present", []string{"web.example.org", "spiffe://example.org/web"}, []string{"web.example.org", "spiffe://example.org/web"}, false},
+		{"fail/other-uri", []string{"spiffe://example.org/admin"}, nil, true},
+		{"fail/other-uri-present", []string{"spiffe://example.org/web", "https://example.org"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := spiffeSANs(tt.sans, id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("spiffeSANs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("spiffeSANs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_spiffeIDValidator_Valid(t *testing.T) {
+	v := spiffeIDValidator("spiffe://example.org/web")
+	tests := []struct {
+		name    string
+		uris    []string
+		wantErr bool
+	}{
+		{"ok", []string{"spiffe://example.org/web"}, false},
+		{"fail/missing", nil, true},
+		{"fail/other", []string{"spiffe://example.org/web", "spiffe://example.org/admin"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := &x509.Certificate{}
+			for _, u := range tt.uris {
+				cert.URIs = append(cert.URIs, mustSPIFFEID(t, u))
+			}
+			if err := v.Valid(cert, SignOptions{}); (err != nil) != tt.wantErr {
+				t.Errorf("spiffeIDValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX5C_AuthorizeSign_spiffe(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundleFile := filepath.Join(t.TempDir(), "bundle.json")
+	writeSPIFFEBundle(t, bundleFile, ca.Root)
+
+	p, err := generateX5C(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Roots = nil
+	p.SPIFFE = &X5CSPIFFE{
+		TrustDomain:  "example.org",
+		AllowedPaths: []string{"/ns/prod/*"},
+		BundleFile:   bundleFile,
+	}
+	if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+		t.Fatal(err)
+	}
+
+	newSVIDToken := func(t *testing.T, ca *minica.CA, crt *x509.Certificate, jwk *jose.JSONWebKey, sans []string) string {
+		tok, err := generateToken("web", p.GetName(), p.ctl.Audiences.Sign[0], "",
+			sans, time.Now(), jwk, withX5CHdr([]*x509.Certificate{crt, ca.Intermediate}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	newToken := func(t *testing.T, ca *minica.CA, sans []string, uris ...string) string {
+		crt, jwk := generateSVID(t, ca, uris...)
+		return newSVIDToken(t, ca, crt, jwk, sans)
+	}
+
+	// X509-SVID with client auth and one without client or server auth.
+	svidKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svidJWK := &jose.JSONWebKey{Key: svidKey, KeyID: "svid"}
+	newEKUToken := func(t *testing.T, eku x509.ExtKeyUsage) string {
+		crt, err := ca.Sign(&x509.Certificate{
+			PublicKey:   svidKey.Public(),
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{eku},
+			URIs:        []*url.URL{mustSPIFFEID(t, "spiffe://example.org/ns/prod/sa/web")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newSVIDToken(t, ca, crt, svidJWK, nil)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantSANs []string
+		wantErr  string
+	}{
+		{"ok", newToken(t, ca, nil, "spiffe://example.org/ns/prod/sa/web"),
+			[]string{"spiffe://example.org/ns/prod/sa/web"}, ""},
+		{"ok/sans", newToken(t, ca, []string{"web.example.org"}, "spiffe://example.org/ns/prod/sa/web"),
+			[]string{"web.example.org", "spiffe://example.org/ns/prod/sa/web"}, ""},
+		{"ok/client-auth", newEKUToken(t, x509.ExtKeyUsageClientAuth),
+			[]string{"spiffe://example.org/ns/prod/sa/web"}, ""},
+		{"fail/eku", newEKUToken(t, x509.ExtKeyUsageCodeSigning),
+			nil, "error verifying x5c certificate chain in token"},
+		{"fail/untrusted", newToken(t, other, nil, "spiffe://example.org/ns/prod/sa/web"),
+			nil, "error verifying x5c certificate chain in token"},
+		{"fail/not-allowed", newToken(t, ca, nil, "spiffe://example.org/ns/dev/sa/web"),
+			nil, "invalid x509-svid"},
+		{"fail/trust-domain", newToken(t, ca, nil, "spiffe://example.com/ns/prod/sa/web"),
+			nil, "invalid x509-svid"},
+		{"fail/other-uri", newToken(t, ca, []string{"spiffe://example.org/ns/prod/sa/admin"}, "spiffe://example.org/ns/prod/sa/web"),
+			nil, "does not match the spiffe id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := p.AuthorizeSign(context.Background(), tt.token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("X5C.AuthorizeSign() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("X5C.AuthorizeSign() error = %v", err)
+			}
+			if len(opts) != 10 {
+				t.Errorf("X5C.AuthorizeSign() options = %d, want 10", len(opts))
+			}
+			var found bool
+			for _, o := range opts {
+				switch v := o.(type) {
+				case defaultSANsValidator:
+					if strings.Join(v, ",") != strings.Join(tt.wantSANs, ",") {
+						t.Errorf("defaultSANsValidator = %v, want %v", v, tt.wantSANs)
+					}
+				case spiffeIDValidator:
+					found = true
+					if want := tt.wantSANs[len(tt.wantSANs)-1]; string(v) != want {
+						t.Errorf("spiffeIDValidator = %v, want %v", v, want)
+					}
+				}
+			}
+			if !found {
+				t.Error("X5C.AuthorizeSign() does not include the spiffeIDValidator")
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/internal/tpm"
+)
+
+// SSHHostKeyProof contains the proof of possession of the key in an SSH host
+// certificate request, and optionally a TPM attestation of the key.
+type SSHHostKeyProof struct {
+	// Signature is the signature of the one-time token with the host key in
+	// the SSH wire format.
+	Signature []byte `json:"signature"`
+	// Attestation is a TPM 2.0 attestation of the host key.
+	Attestation *SSHHostKeyAttestation `json:"attestation,omitempty"`
+}
+
+// SSHHostKeyAttestation is a TPM 2.0 attestation of an SSH host key. It has
+// the same fields as a WebAuthn TPM attestation statement, and the extra data
+// in certInfo must be the SHA-256 of the one-time token.
+type SSHHostKeyAttestation struct {
+	Ver      string   `json:"ver"`
+	Alg      int64    `json:"alg"`
+	X5C      [][]byte `json:"x5c"`
+	Sig      []byte   `json:"sig"`
+	CertInfo []byte   `json:"certInfo"`
+	PubArea  []byte   `json:"pubArea"`
+}
+
+type sshHostKeyProofKey struct{}
+
+// NewContextWithSSHHostKeyProof creates a new context with the proof of
+// possession of an SSH host key.
+func NewContextWithSSHHostKeyProof(ctx context.Context, proof *SSHHostKeyProof) context.Context {
+	return context.WithValue(ctx, sshHostKeyProofKey{}, proof)
+}
+
+// SSHHostKeyProofFromContext returns the proof of possession of an SSH host
+// key stored in the given context.
+func SSHHostKeyProofFromContext(ctx context.Context) (*SSHHostKeyProof, bool) {
+	proof, ok := ctx.Value(sshHostKeyProofKey{}).(*SSHHostKeyProof)
+	return proof, ok && proof != nil
+}
+
+// SSHHostKeyAttestationOptions requires a proof of possession of the key in
+// SSH host certificate requests, and optionally a TPM attestation of the key.
+type SSHHostKeyAttestationOptions struct {
+	// RequireTPM requires a TPM attestation of the host key.
+	RequireTPM bool `json:"requireTPM,omitempty"`
+
+	// AttestationRoots contains a bundle of root certificates in PEM format
+	// used to validate the TPM attestations. It is required to validate them,
+	// as there are no well-known roots for the TPM manufacturers.
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+
+	roots *x509.CertPool
+}
+
+// Init parses the attestation roots.
+func (o *SSHHostKeyAttestationOptions) Init() error {
+	if o == nil {
+		return nil
+	}
+
+	o.roots = nil
+	if rest := o.AttestationRoots; len(rest) > 0 {
+		var block *pem.Block
+		var hasCert bool
+		o.roots = x509.NewCertPool()
+		for rest != nil {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.New("error parsing hostKeyAttestation attestationRoots: malformed certificate")
+			}
+			o.roots.AddCert(cert)
+			hasCert = true
+		}
+		if !hasCert {
+			return errors.New("error parsing hostKeyAttestation attestationRoots: no certificates found")
+		}
+	}
+
+	if o.RequireTPM && o.roots == nil {
+		return errors.New("hostKeyAttestation attestationRoots are required with requireTPM")
+	}
+	return nil
+}
+
+// SSHHostKeyAttestationOption is a SignOption with the provisioner options to
+// validate the key in SSH host certificate requests. The options are applied
+// by the authority, as they require the proof sent in the request.
+type SSHHostKeyAttestationOption struct {
+	Options *SSHHostKeyAttestationOptions
+}
+
+// Verify validates that the proof contains a signature of the token with the
+// given host key and, if it is required or present, a TPM attestation of the
+// same key bound to the token.
+func (o *SSHHostKeyAttestationOptions) Verify(key ssh.PublicKey, token string, proof *SSHHostKeyProof) error {
+	if o == nil {
+		return nil
+	}
+	if proof == nil || len(proof.Signature) == 0 {
+		return errors.New("host key proof of possession is required")
+	}
+	if token == "" {
+		return errors.New("host key proof of possession requires a token")
+	}
+
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(proof.Signature, sig); err != nil {
+		return errors.Wrap(err, "error parsing host key signature")
+	}
+	if err := key.Verify([]byte(token), sig); err != nil {
+		return errors.Wrap(err, "host key signature is not valid")
+	}
+
+	switch {
+	case proof.Attestation != nil:
+		return o.verifyTPMAttestation(key, token, proof.Attestation)
+	case o.RequireTPM:
+		return errors.New("host key attestation is required")
+	default:
+		return nil
+	}
+}
+
+// verifyTPMAttestation validates the TPM attestation of the host key. The
+// attestation key certificate must chain to the attestation roots, the
+// certified key must be the host key generated by the TPM, and the extra data
+// must be the SHA-256 of the token.
+func (o *SSHHostKeyAttestationOptions) verifyTPMAttestation(key ssh.PublicKey, token string, att *SSHHostKeyAttestation) error {
+	if o.roots == nil {
+		return errors.New("host key attestation is not configured")
+	}
+	if att.Ver != "2.0" {
+		return errors.New("host key attestation ver must be 2.0")
+	}
+	if len(att.X5C) == 0 {
+		return errors.New("host key attestation x5c is empty")
+	}
+
+	akCert, err := x509.ParseCertificate(att.X5C[0])
+	if err != nil {
+		return errors.Wrap(err, "host key attestation x5c is malformed")
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range att.X5C[1:] {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.Wrap(err, "host key attestation x5c is malformed")
+		}
+		intermediates.AddCert(cert)
+	}
+	if _, err := akCert.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         o.roots,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "host key attestation x5c is not valid")
+	}
+	if akCert.IsCA {
+		return errors.New("host key attestation x5c is not valid: attestation key certificate is a CA")
+	}
+	var hasAIKUsage bool
+	for _, eku := range akCert.UnknownExtKeyUsage {
+		if eku.Equal(tpm.OIDTCGKpAIKCertificate) {
+			hasAIKUsage = true
+			break
+		}
+	}
+	if !hasAIKUsage {
+		return errors.New("host key attestation x5c is not valid: attestation key certificate does not have the tcg-kp-AIKCertificate extended key usage")
+	}
+
+	// Verify the signature of certInfo with the attestation key.
+	sigAlg, err := tpm.SignatureAlgorithm(att.Alg)
+	if err != nil {
+		return errors.Wrap(err, "host key attestation alg is not valid")
+	}
+	if err := akCert.CheckSignature(sigAlg, att.CertInfo, att.Sig); err != nil {
+		return errors.Wrap(err, "host key attestation signature is not valid")
+	}
+
+	// Verify that certInfo certifies the key in pubArea.
+	info, err := tpm.ParseCertifyInfo(att.CertInfo)
+	if err != nil {
+		return errors.Wrap(err, "host key attestation certInfo is malformed")
+	}
+	pub, err := tpm.ParsePublic(att.PubArea)
+	if err != nil {
+		return errors.Wrap(err, "host key attestation pubArea is malformed")
+	}
+	name, err := tpm.Name(pub.NameAlg, att.PubArea)
+	if err != nil {
+		return errors.Wrap(err, "host key attestation pubArea is malformed")
+	}
+	if subtle.ConstantTimeCompare(info.Name, name) != 1 {
+		return errors.New("host key attestation certInfo does not certify pubArea")
+	}
+
+	// A key imported into the TPM can also exist outside of it.
+	if err := pub.VerifyHardwareBound(); err != nil {
+		return errors.Wrap(err, "host key attestation pubArea is not valid")
+	}
+
+	// Verify the binding with the host key and the token.
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return errors.New("host key attestation does not support the host key type")
+	}
+	if k, ok := pub.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(cryptoKey.CryptoPublicKey()) {
+		return errors.New("host key attestation does not match the host key")
+	}
+	sum := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(info.ExtraData, sum[:]) != 1 {
+		return errors.New("host key attestation extra data does not match the token")
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+
+	"go.step.sm/crypto/minica"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/internal/tpm"
+	"github.com/smallstep/certificates/internal/tpm/tpmtest"
+)
+
+func TestSSHHostKeyAttestationOptions_Init(t *testing.T) {
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+
+	tests := []struct {
+		name    string
+		options *SSHHostKeyAttestationOptions
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok/proof of possession", &SSHHostKeyAttestationOptions{}, false},
+		{"ok/roots", &SSHHostKeyAttestationOptions{AttestationRoots: root}, false},
+		{"ok/require tpm", &SSHHostKeyAttestationOptions{RequireTPM: true, AttestationRoots: root}, false},
+		{"fail/require tpm without roots", &SSHHostKeyAttestationOptions{RequireTPM: true}, true},
+		{"fail/no certificates", &SSHHostKeyAttestationOptions{AttestationRoots: []byte("foo")}, true},
+		{"fail/malformed certificate", &SSHHostKeyAttestationOptions{AttestationRoots: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("foo")})}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Init(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHHostKeyAttestationOptions.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHHostKeyAttestationOptions_Verify(t *testing.T) {
+	const token = "the.one-time.token"
+
+	ca, err := minica.New()
+	assert.FatalError(t, err)
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	otherCA, err := minica.New()
+	assert.FatalError(t, err)
+	otherRoot := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCA.Root.Raw})
+
+	// Host key and proof of possession.
+	hostKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.FatalError(t, err)
+	hostPub := hostSigner.PublicKey()
+	sig, err := hostSigner.Sign(rand.Reader, []byte(token))
+	assert.FatalError(t, err)
+	signature := ssh.Marshal(sig)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	assert.FatalError(t, err)
+	otherSig, err := otherSigner.Sign(rand.Reader, []byte(token))
+	assert.FatalError(t, err)
+
+	// Attestation key and TPM attestation of the host key.
+	akSigner, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	makeAKCert := func(ekus []asn1.ObjectIdentifier) *x509.Certificate {
+		crt, err := ca.Sign(&x509.Certificate{
+			PublicKey:          akSigner.Public(),
+			UnknownExtKeyUsage: ekus,
+		})
+		assert.FatalError(t, err)
+		return crt
+	}
+	akCert := makeAKCert([]asn1.ObjectIdentifier{tpm.OIDTCGKpAIKCertificate})
+	noAIKCert := makeAKCert(nil)
+
+	sign := func(certInfo []byte) []byte {
+		sum := sha256.Sum256(certInfo)
+		sig, err := akSigner.Sign(rand.Reader, sum[:], crypto.SHA256)
+		assert.FatalError(t, err)
+		return sig
+	}
+	tokenSum := sha256.Sum256([]byte(token))
+	pubArea := tpmtest.Public(t, hostKey.Public())
+	name, err := tpm.Name(tpm.AlgSHA256, pubArea)
+	assert.FatalError(t, err)
+	otherPubArea := tpmtest.Public(t, otherKey.Public())
+	otherName, err := tpm.Name(tpm.AlgSHA256, otherPubArea)
+	assert.FatalError(t, err)
+	importedPubArea := tpmtest.PublicWithAttributes(t, hostKey.Public(), tpm.AttrFixedTPM|tpm.AttrFixedParent)
+	importedName, err := tpm.Name(tpm.AlgSHA256, importedPubArea)
+	assert.FatalError(t, err)
+
+	attestation := func(fn func(att *SSHHostKeyAttestation)) *SSHHostKeyAttestation {
+		certInfo := tpmtest.CertifyInfo(t, tokenSum[:], name)
+		att := &SSHHostKeyAttestation{
+			Ver:      "2.0",
+			Alg:      -7,
+			X5C:      [][]byte{akCert.Raw, ca.Intermediate.Raw},
+			Sig:      sign(certInfo),
+			CertInfo: certInfo,
+			PubArea:  pubArea,
+		}
+		if fn != nil {
+			fn(att)
+		}
+		return att
+	}
+	options := func(requireTPM bool, roots []byte) *SSHHostKeyAttestationOptions {
+		o := &SSHHostKeyAttestationOptions{RequireTPM: requireTPM, AttestationRoots: roots}
+		assert.FatalError(t, o.Init())
+		return o
+	}
+
+	tests := []struct {
+		name    string
+		options *SSHHostKeyAttestationOptions
+		token   string
+		proof   *SSHHostKeyProof
+		wantErr bool
+	}{
+		{"ok/nil", nil, token, nil, false},
+		{"ok/proof of possession", options(false, nil), token, &SSHHostKeyProof{Signature: signature}, false},
+		{"ok/attestation", options(false, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(nil)}, false},
+		{"ok/require tpm", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(nil)}, false},
+		{"fail/missing proof", options(false, nil), token, nil, true},
+		{"fail/missing signature", options(false, nil), token, &SSHHostKeyProof{}, true},
+		{"fail/missing token", options(false, nil), "", &SSHHostKeyProof{Signature: signature}, true},
+		{"fail/malformed signature", options(false, nil), token, &SSHHostKeyProof{Signature: []byte("foo")}, true},
+		{"fail/other key signature", options(false, nil), token, &SSHHostKeyProof{Signature: ssh.Marshal(otherSig)}, true},
+		{"fail/other token", options(false, nil), "other.token", &SSHHostKeyProof{Signature: signature}, true},
+		{"fail/require tpm", options(true, root), token, &SSHHostKeyProof{Signature: signature}, true},
+		{"fail/attestation not configured", options(false, nil), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(nil)}, true},
+		{"fail/ver", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.Ver = "1.0"
+		})}, true},
+		{"fail/x5c empty", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.X5C = nil
+		})}, true},
+		{"fail/x5c root", options(true, otherRoot), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(nil)}, true},
+		{"fail/x5c aik", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.X5C = [][]byte{noAIKCert.Raw, ca.Intermediate.Raw}
+		})}, true},
+		{"fail/alg", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.Alg = 0
+		})}, true},
+		{"fail/sig", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.Sig = sign([]byte("foo"))
+		})}, true},
+		{"fail/name", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.CertInfo = tpmtest.CertifyInfo(t, tokenSum[:], []byte("name"))
+			att.Sig = sign(att.CertInfo)
+		})}, true},
+		{"fail/other key", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.CertInfo = tpmtest.CertifyInfo(t, tokenSum[:], otherName)
+			att.Sig = sign(att.CertInfo)
+			att.PubArea = otherPubArea
+		})}, true},
+		{"fail/imported key", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.CertInfo = tpmtest.CertifyInfo(t, tokenSum[:], importedName)
+			att.Sig = sign(att.CertInfo)
+			att.PubArea = importedPubArea
+		})}, true},
+		{"fail/extra data", options(true, root), token, &SSHHostKeyProof{Signature: signature, Attestation: attestation(func(att *SSHHostKeyAttestation) {
+			att.CertInfo = tpmtest.CertifyInfo(t, []byte("extra data"), name)
+			att.Sig = sign(att.CertInfo)
+		})}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Verify(hostPub, tt.token, tt.proof); (err != nil) != tt.wantErr {
+				t.Errorf("SSHHostKeyAttestationOptions.Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHHostKeyProofFromContext(t *testing.T) {
+	proof := &SSHHostKeyProof{Signature: []byte("signature")}
+	got, ok := SSHHostKeyProofFromContext(NewContextWithSSHHostKeyProof(context.Background(), proof))
+	assert.True(t, ok)
+	assert.Equals(t, proof, got)
+
+	_, ok = SSHHostKeyProofFromContext(context.Background())
+	assert.False(t, ok)
+	_, ok = SSHHostKeyProofFromContext(NewContextWithSSHHostKeyProof(context.Background(), nil))
+	assert.False(t, ok)
+}
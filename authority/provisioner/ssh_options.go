@@ -41,6 +41,45 @@ type SSHOptions struct {
 
 	// Host contains SSH host certificate options.
 	Host *policy.SSHHostCertificateOptions `json:"-"`
+
+	// Permissions contains the policy for the critical options and extensions
+	// of SSH user certificates.
+	Permissions *policy.SSHPermissionsOptions `json:"permissions,omitempty"`
+
+	// HostKeyAttestation requires a proof of possession of the key, and
+	// optionally a TPM attestation, in SSH host certificate requests.
+	HostKeyAttestation *SSHHostKeyAttestationOptions `json:"hostKeyAttestation,omitempty"`
+
+	// StepUp allows users to request additional principals in SSH user
+	// certificates with the approval of an administrator.
+	StepUp *SSHStepUpOptions `json:"stepUp,omitempty"`
+}
+
+// GetPermissions returns the policy for the critical options and extensions
+// of SSH user certificates.
+func (o *SSHOptions) GetPermissions() *policy.SSHPermissionsOptions {
+	if o == nil {
+		return nil
+	}
+	return o.Permissions
+}
+
+// GetHostKeyAttestation returns the options to validate the key in SSH host
+// certificate requests.
+func (o *SSHOptions) GetHostKeyAttestation() *SSHHostKeyAttestationOptions {
+	if o == nil {
+		return nil
+	}
+	return o.HostKeyAttestation
+}
+
+// GetStepUp returns the options to request additional principals in SSH user
+// certificates.
+func (o *SSHOptions) GetStepUp() *SSHStepUpOptions {
+	if o == nil {
+		return nil
+	}
+	return o.StepUp
 }
 
 // GetAllowedUserNameOptions returns the SSHNameOptions that are
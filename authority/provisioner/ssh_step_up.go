@@ -0,0 +1,115 @@
+package provisioner
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// DefaultSSHStepUpDuration is the default validity of the SSH user
+// certificates issued for an approved step-up request.
+const DefaultSSHStepUpDuration = time.Hour
+
+// SSHStepUpOptions allows the users of a provisioner to request additional
+// principals in SSH user certificates. The requests must be approved by an
+// administrator before a short-lived certificate with the additional
+// principals is issued.
+type SSHStepUpOptions struct {
+	// Principals is the list of principals that can be requested.
+	Principals []string `json:"principals"`
+
+	// Duration is the validity of the certificates issued for approved
+	// requests. It defaults to one hour.
+	Duration *Duration `json:"duration,omitempty"`
+}
+
+// Validate validates the step-up options.
+func (o *SSHStepUpOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.Principals) == 0 {
+		return errors.New("stepUp principals cannot be empty")
+	}
+	for _, p := range o.Principals {
+		if p == "" {
+			return errors.New("stepUp principals cannot contain empty values")
+		}
+	}
+	if o.Duration != nil && o.Duration.Duration <= 0 {
+		return errors.New("stepUp duration must be greater than 0")
+	}
+	return nil
+}
+
+// GetDuration returns the validity of the certificates issued for approved
+// requests.
+func (o *SSHStepUpOptions) GetDuration() time.Duration {
+	if o == nil || o.Duration == nil {
+		return DefaultSSHStepUpDuration
+	}
+	return o.Duration.Duration
+}
+
+// Allow returns an error if any of the given principals cannot be requested.
+func (o *SSHStepUpOptions) Allow(principals []string) error {
+	if o == nil {
+		return errors.New("ssh step-up is not enabled")
+	}
+	if len(principals) == 0 {
+		return errors.New("ssh step-up requires at least one principal")
+	}
+	allowed := make(map[string]bool, len(o.Principals))
+	for _, p := range o.Principals {
+		allowed[p] = true
+	}
+	for _, p := range principals {
+		if !allowed[p] {
+			return errors.Errorf("ssh step-up principal %q is not allowed", p)
+		}
+	}
+	return nil
+}
+
+// SSHStepUpOption is a SignOption with the provisioner options to request
+// additional principals in SSH user certificates. The options are used by the
+// authority when a step-up request is created.
+type SSHStepUpOption struct {
+	Options *SSHStepUpOptions
+}
+
+// SSHStepUpAuthorizer is implemented by the provisioners that support SSH
+// step-up requests. AuthorizeSSHStepUp returns the options used to sign the
+// certificate of an approved request, the provisioner validators and the
+// current step-up options, as there is no token when the request is polled.
+type SSHStepUpAuthorizer interface {
+	AuthorizeSSHStepUp(ctx context.Context) ([]SignOption, error)
+}
+
+// sshStepUpSignOptions returns the sign options of an approved step-up
+// request for the given provisioner.
+func sshStepUpSignOptions(p Interface, ctl *Controller) ([]SignOption, error) {
+	if !ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("authorizeSSHStepUp; sshCA is disabled for provisioner '%s'", p.GetName())
+	}
+	stepUp := ctl.getSSHStepUp()
+	if stepUp == nil {
+		return nil, errs.Forbidden("authorizeSSHStepUp; ssh step-up is not enabled for provisioner '%s'", p.GetName())
+	}
+	return []SignOption{
+		p,
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{ctl.Claimer},
+		// Require all the fields in the SSH certificate
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(ctl.getPolicy().getSSHHost(), ctl.getPolicy().getSSHUser()),
+		// Validate the requested principals
+		SSHStepUpOption{Options: stepUp},
+	}, nil
+}
@@ -0,0 +1,126 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSSHStepUpOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SSHStepUpOptions
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok", &SSHStepUpOptions{Principals: []string{"root"}}, false},
+		{"ok/duration", &SSHStepUpOptions{Principals: []string{"root", "admin"}, Duration: &Duration{Duration: 15 * time.Minute}}, false},
+		{"fail/principals", &SSHStepUpOptions{}, true},
+		{"fail/empty principal", &SSHStepUpOptions{Principals: []string{"root", ""}}, true},
+		{"fail/duration", &SSHStepUpOptions{Principals: []string{"root"}, Duration: &Duration{Duration: -time.Minute}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("SSHStepUpOptions.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHStepUpOptions_GetDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *SSHStepUpOptions
+		want    time.Duration
+	}{
+		{"nil", nil, DefaultSSHStepUpDuration},
+		{"default", &SSHStepUpOptions{Principals: []string{"root"}}, DefaultSSHStepUpDuration},
+		{"duration", &SSHStepUpOptions{Principals: []string{"root"}, Duration: &Duration{Duration: 15 * time.Minute}}, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.GetDuration(); got != tt.want {
+				t.Errorf("SSHStepUpOptions.GetDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHStepUpOptions_Allow(t *testing.T) {
+	options := &SSHStepUpOptions{Principals: []string{"root", "admin"}}
+	tests := []struct {
+		name       string
+		options    *SSHStepUpOptions
+		principals []string
+		wantErr    bool
+	}{
+		{"ok", options, []string{"root"}, false},
+		{"ok/multiple", options, []string{"admin", "root"}, false},
+		{"fail/nil", nil, []string{"root"}, true},
+		{"fail/empty", options, nil, true},
+		{"fail/not allowed", options, []string{"root", "jane"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.options.Allow(tt.principals); (err != nil) != tt.wantErr {
+				t.Errorf("SSHStepUpOptions.Allow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWK_AuthorizeSSHStepUp(t *testing.T) {
+	disabled := false
+	disabledClaims := globalProvisionerClaims
+	disabledClaims.EnableSSHCA = &disabled
+	newJWK := func(t *testing.T, claims *Claims, options *Options) *JWK {
+		p, err := generateJWK()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Options = options
+		p.ctl, err = NewController(p, claims, Config{Audiences: testAudiences}, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	stepUp := &SSHStepUpOptions{Principals: []string{"root"}}
+	options := &Options{SSH: &SSHOptions{StepUp: stepUp}}
+
+	tests := []struct {
+		name    string
+		prov    *JWK
+		wantErr bool
+	}{
+		{"ok", newJWK(t, &globalProvisionerClaims, options), false},
+		{"fail/not enabled", newJWK(t, &globalProvisionerClaims, nil), true},
+		{"fail/sshCA disabled", newJWK(t, &disabledClaims, options), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.prov.AuthorizeSSHStepUp(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JWK.AuthorizeSSHStepUp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var hasProvisioner, hasNamePolicy, hasStepUp bool
+			for _, o := range got {
+				switch v := o.(type) {
+				case *JWK:
+					hasProvisioner = true
+				case *sshNamePolicyValidator:
+					hasNamePolicy = true
+				case SSHStepUpOption:
+					hasStepUp = v.Options == stepUp
+				}
+			}
+			if !hasProvisioner || !hasNamePolicy || !hasStepUp {
+				t.Errorf("JWK.AuthorizeSSHStepUp() = %v, want provisioner, name policy and step-up options", got)
+			}
+		})
+	}
+}
@@ -69,6 +69,8 @@ func signSSHCertificate(key crypto.PublicKey, opts SignSSHOptions, signOpts []Si
 			if err := o.Valid(opts); err != nil {
 				return nil, err
 			}
+		// the permissions policy and host key options are applied by the authority
+		case SSHPermissionsOption, SSHHostKeyAttestationOption, SSHStepUpOption:
 		default:
 			return nil, fmt.Errorf("signSSH: invalid extra option type %T", o)
 		}
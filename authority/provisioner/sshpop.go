@@ -27,10 +27,11 @@ type sshPOPPayload struct {
 // signature requests.
 type SSHPOP struct {
 	*base
-	ID         string  `json:"-"`
-	Type       string  `json:"type"`
-	Name       string  `json:"name"`
-	Claims     *Claims `json:"claims,omitempty"`
+	ID         string   `json:"-"`
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Claims     *Claims  `json:"claims,omitempty"`
+	Options    *Options `json:"options,omitempty"`
 	ctl        *Controller
 	sshPubKeys *SSHKeys
 }
@@ -97,7 +98,7 @@ func (p *SSHPOP) Init(config Config) (err error) {
 	p.sshPubKeys = config.SSHKeys
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
-	p.ctl, err = NewController(p, p.Claims, config, nil)
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
 	return
 }
 
@@ -229,6 +230,8 @@ func (p *SSHPOP) AuthorizeSSHRekey(ctx context.Context, token string) (*ssh.Cert
 		&sshCertValidityValidator{p.ctl.Claimer},
 		// Require and validate all the default fields in the SSH certificate.
 		&sshCertDefaultValidator{},
+		// Validate the proof of possession, and attestation, of the new key.
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
 	}, nil
 }
 
@@ -446,6 +446,23 @@ func TestSSHPOP_AuthorizeSSHRekey(t *testing.T) {
 				cert:  cert,
 			}
 		},
+		"ok/host-key-attestation": func(t *testing.T) test {
+			p, err := generateSSHPOP()
+			assert.FatalError(t, err)
+			p.Options = &Options{SSH: &SSHOptions{HostKeyAttestation: &SSHHostKeyAttestationOptions{}}}
+			p.ctl, err = NewController(p, p.Claims, Config{Audiences: testAudiences}, p.Options)
+			assert.FatalError(t, err)
+			cert, jwk, err := createSSHCert(&ssh.Certificate{Serial: 123455, CertType: ssh.HostCert}, sshHostSigner)
+			assert.FatalError(t, err)
+			tok, err := generateToken("123455", p.GetName(), testAudiences.SSHRekey[0], "",
+				[]string{"test.smallstep.com"}, time.Now(), jwk, withSSHPOPFile(cert))
+			assert.FatalError(t, err)
+			return test{
+				p:     p,
+				token: tok,
+				cert:  cert,
+			}
+		},
 	}
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -459,7 +476,7 @@ func TestSSHPOP_AuthorizeSSHRekey(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					assert.Len(t, 4, opts)
+					assert.Len(t, 5, opts)
 					for _, o := range opts {
 						switch v := o.(type) {
 						case Interface:
@@ -467,6 +484,8 @@ func TestSSHPOP_AuthorizeSSHRekey(t *testing.T) {
 						case *sshCertDefaultValidator:
 						case *sshCertValidityValidator:
 							assert.Equals(t, v.Claimer, tc.p.ctl.Claimer)
+						case SSHHostKeyAttestationOption:
+							assert.Equals(t, v.Options, tc.p.Options.GetSSHOptions().GetHostKeyAttestation())
 						default:
 							assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 						}
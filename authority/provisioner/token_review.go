@@ -0,0 +1,314 @@
+package provisioner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultTokenReviewTimeout is the default timeout used in the requests to
+	// the TokenReview API.
+	defaultTokenReviewTimeout = 10 * time.Second
+	// tokenReviewPath is the path of the TokenReview API.
+	tokenReviewPath = "/apis/authentication.k8s.io/v1/tokenreviews"
+	// k8sSAUsernamePrefix is the prefix of the username of a service account.
+	k8sSAUsernamePrefix = "system:serviceaccount:"
+	// k8sSAPodNameExtra and k8sSAPodUIDExtra are the keys of the extra user
+	// info with the pod bound to a service account token.
+	k8sSAPodNameExtra = "authentication.kubernetes.io/pod-name"
+	k8sSAPodUIDExtra  = "authentication.kubernetes.io/pod-uid"
+)
+
+// In-cluster defaults used if the TokenReview server is not configured.
+const (
+	inClusterServer    = "https://kubernetes.default.svc"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token" //nolint:gosec // file path
+)
+
+// K8sSATokenReview configures the K8sSA provisioner to validate tokens using
+// the Kubernetes TokenReview API.
+//
+// If the server is not set, the in-cluster configuration is used: the API
+// server at https://kubernetes.default.svc is called using the service account
+// token and CA mounted in the pod. The bearer token used to call the API must
+// be allowed to create tokenreviews.
+type K8sSATokenReview struct {
+	Server               string    `json:"server,omitempty"`
+	CertificateAuthority string    `json:"certificateAuthority,omitempty"`
+	BearerToken          string    `json:"bearerToken,omitempty"`
+	BearerTokenFile      string    `json:"bearerTokenFile,omitempty"`
+	Timeout              *Duration `json:"timeout,omitempty"`
+	server               string
+	tokenFile            string
+	client               *http.Client
+	cache                *tokenReviewCache
+}
+
+// tokenReview is the request and response of the TokenReview API.
+type tokenReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Spec       tokenReviewSpec    `json:"spec"`
+	Status     *tokenReviewStatus `json:"status,omitempty"`
+}
+
+type tokenReviewSpec struct {
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type tokenReviewStatus struct {
+	Authenticated bool                `json:"authenticated"`
+	User          tokenReviewUserInfo `json:"user"`
+	Audiences     []string            `json:"audiences,omitempty"`
+	Error         string              `json:"error,omitempty"`
+}
+
+// tokenReviewUserInfo is the user information of an authenticated token.
+type tokenReviewUserInfo struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// extra returns the first value of the given extra user info key.
+func (u *tokenReviewUserInfo) extra(key string) string {
+	if v := u.Extra[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// serviceAccount returns the namespace and name of the service account in the
+// username.
+func (u *tokenReviewUserInfo) serviceAccount() (namespace, name string, ok bool) {
+	if !strings.HasPrefix(u.Username, k8sSAUsernamePrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(u.Username, k8sSAUsernamePrefix), ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Validate validates and initializes the TokenReview configuration.
+func (r *K8sSATokenReview) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	r.server = r.Server
+	caFile, tokenFile := r.CertificateAuthority, r.BearerTokenFile
+	if r.server == "" {
+		r.server = inClusterServer
+		if caFile == "" {
+			caFile = inClusterCAFile
+		}
+		if tokenFile == "" && r.BearerToken == "" {
+			tokenFile = inClusterTokenFile
+		}
+	}
+	if u, err := url.Parse(r.server); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.Errorf("tokenReview server %s is not valid", r.server)
+	}
+	if r.BearerToken != "" && r.BearerTokenFile != "" {
+		return errors.New("tokenReview cannot have both a bearerToken and a bearerTokenFile")
+	}
+	r.tokenFile = tokenFile
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", caFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return errors.Errorf("error parsing %s: no certificates found", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	timeout := defaultTokenReviewTimeout
+	if r.Timeout != nil && r.Timeout.Value() > 0 {
+		timeout = r.Timeout.Value()
+	}
+	r.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	r.cache = newTokenReviewCache()
+	return nil
+}
+
+// Review validates the token using the TokenReview API and returns the user
+// information of the token. Positive results are cached by token and audiences
+// until the given expiration time, if any.
+func (r *K8sSATokenReview) Review(token string, audiences []string, expiry time.Time) (*tokenReviewUserInfo, error) {
+	if r.cache != nil {
+		if user, ok := r.cache.Get(token, audiences); ok {
+			return user, nil
+		}
+	}
+
+	status, err := r.review(token, audiences)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case status.Error != "":
+		return nil, errors.Errorf("token review failed: %s", status.Error)
+	case !status.Authenticated:
+		return nil, errors.New("token review failed: token is not authenticated")
+	case len(audiences) > 0 && !matchesAudience(status.Audiences, audiences):
+		return nil, errors.New("token review failed: token audiences do not match")
+	}
+
+	if r.cache != nil && !expiry.IsZero() {
+		r.cache.Add(token, audiences, &status.User, expiry)
+	}
+	return &status.User, nil
+}
+
+func (r *K8sSATokenReview) review(token string, audiences []string) (*tokenReviewStatus, error) {
+	b, err := json.Marshal(tokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+		Spec: tokenReviewSpec{
+			Token:     token,
+			Audiences: audiences,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling token review")
+	}
+
+	uri := strings.TrimSuffix(r.server, "/") + tokenReviewPath
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating token review request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	// The token file is read on every request, so rotated tokens are used.
+	bearerToken := r.BearerToken
+	if r.tokenFile != "" {
+		b, err := os.ReadFile(r.tokenFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", r.tokenFile)
+		}
+		bearerToken = strings.TrimSpace(string(b))
+	}
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	client := r.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTokenReviewTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error doing token review request to %s", uri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("token review request to %s failed with status code %d", uri, resp.StatusCode)
+	}
+
+	var rvw tokenReview
+	if err := json.NewDecoder(resp.Body).Decode(&rvw); err != nil {
+		return nil, errors.Wrapf(err, "error decoding token review response from %s", uri)
+	}
+	if rvw.Status == nil {
+		return nil, errors.Errorf("token review response from %s does not have a status", uri)
+	}
+	return rvw.Status, nil
+}
+
+// tokenReviewCache stores the user information of the reviewed tokens until
+// they expire.
+type tokenReviewCache struct {
+	mu      sync.Mutex
+	entries map[string]tokenReviewCacheEntry
+}
+
+type tokenReviewCacheEntry struct {
+	user   *tokenReviewUserInfo
+	expiry time.Time
+}
+
+func newTokenReviewCache() *tokenReviewCache {
+	return &tokenReviewCache{
+		entries: make(map[string]tokenReviewCacheEntry),
+	}
+}
+
+// Get returns the user information of a reviewed token if it has not expired.
+func (c *tokenReviewCache) Get(token string, audiences []string) (*tokenReviewUserInfo, bool) {
+	key := tokenReviewCacheKey(token, audiences)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expiry) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.user, true
+}
+
+// Add stores the user information of a reviewed token, and removes the
+// expired entries.
+func (c *tokenReviewCache) Add(token string, audiences []string, user *tokenReviewUserInfo, expiry time.Time) {
+	now := time.Now()
+	if now.After(expiry) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.After(e.expiry) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[tokenReviewCacheKey(token, audiences)] = tokenReviewCacheEntry{
+		user:   user,
+		expiry: expiry,
+	}
+}
+
+// tokenReviewCacheKey returns the key used to cache a token reviewed with the
+// given audiences, the tokens are not stored in memory.
+func tokenReviewCacheKey(token string, audiences []string) string {
+	h := sha256.New()
+	h.Write([]byte(token))
+	for _, aud := range audiences {
+		h.Write([]byte{0})
+		h.Write([]byte(aud))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
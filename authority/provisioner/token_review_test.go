@@ -0,0 +1,200 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakeTokenReviewServer returns a fake kubernetes API server implementing
+// the TokenReview API. The tokens in statuses are reviewed with the given
+// status, and any other token is not authenticated. The server also returns
+// the number of reviews done.
+func newFakeTokenReviewServer(t *testing.T, bearerToken string, statuses map[string]tokenReviewStatus) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != tokenReviewPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+bearerToken {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var rvw tokenReview
+		if err := json.NewDecoder(r.Body).Decode(&rvw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&hits, 1)
+		status, ok := statuses[rvw.Spec.Token]
+		if !ok {
+			status = tokenReviewStatus{Authenticated: false}
+		}
+		if status.Authenticated && status.Audiences == nil {
+			status.Audiences = rvw.Spec.Audiences
+		}
+		rvw.Status = &status
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rvw)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// writeTokenReviewServerCA writes the certificate of the fake API server and
+// returns the path of the file.
+func writeTokenReviewServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "ca.crt")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(fn, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestK8sSATokenReview_Validate(t *testing.T) {
+	srv, _ := newFakeTokenReviewServer(t, "reviewer", nil)
+	caFile := writeTokenReviewServerCA(t, srv)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("reviewer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		r       *K8sSATokenReview
+		wantErr bool
+	}{
+		{"ok/nil", nil, false},
+		{"ok", &K8sSATokenReview{Server: srv.URL, CertificateAuthority: caFile, BearerToken: "reviewer"}, false},
+		{"ok/token-file", &K8sSATokenReview{Server: srv.URL, CertificateAuthority: caFile, BearerTokenFile: tokenFile, Timeout: &Duration{time.Second}}, false},
+		{"fail/server", &K8sSATokenReview{Server: "kubernetes.default.svc", BearerToken: "reviewer"}, true},
+		{"fail/both-tokens", &K8sSATokenReview{Server: srv.URL, BearerToken: "reviewer", BearerTokenFile: tokenFile}, true},
+		{"fail/ca-missing", &K8sSATokenReview{Server: srv.URL, CertificateAuthority: filepath.Join(t.TempDir(), "missing.crt")}, true},
+		{"fail/ca-invalid", &K8sSATokenReview{Server: srv.URL, CertificateAuthority: tokenFile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.r.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("K8sSATokenReview.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestK8sSATokenReview_Review(t *testing.T) {
+	user := tokenReviewUserInfo{
+		Username: "system:serviceaccount:ns-foo:san-foo",
+		UID:      "sauid-foo",
+		Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:ns-foo"},
+	}
+	srv, hits := newFakeTokenReviewServer(t, "reviewer", map[string]tokenReviewStatus{
+		"token":          {Authenticated: true, User: user},
+		"token-audience": {Authenticated: true, User: user, Audiences: []string{"foo"}},
+		"token-error":    {Error: "token has expired"},
+	})
+	caFile := writeTokenReviewServerCA(t, srv)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("reviewer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newTokenReview := func(t *testing.T, r *K8sSATokenReview) *K8sSATokenReview {
+		if r.Server == "" {
+			r.Server = srv.URL
+		}
+		r.CertificateAuthority = caFile
+		if err := r.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	expiry := time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		r         *K8sSATokenReview
+		token     string
+		audiences []string
+		expiry    time.Time
+		want      *tokenReviewUserInfo
+		wantHits  int32
+		wantErr   string
+	}{
+		{"ok", &K8sSATokenReview{BearerToken: "reviewer"}, "token", nil, expiry, &user, 1, ""},
+		{"ok/token-file", &K8sSATokenReview{BearerTokenFile: tokenFile}, "token", []string{"step-ca"}, expiry, &user, 1, ""},
+		{"ok/no-expiry", &K8sSATokenReview{BearerToken: "reviewer"}, "token", nil, time.Time{}, &user, 2, ""},
+		{"fail/not-authenticated", &K8sSATokenReview{BearerToken: "reviewer"}, "foo", nil, expiry, nil, 2, "token review failed: token is not authenticated"},
+		{"fail/error", &K8sSATokenReview{BearerToken: "reviewer"}, "token-error", nil, expiry, nil, 2, "token review failed: token has expired"},
+		{"fail/audience", &K8sSATokenReview{BearerToken: "reviewer"}, "token-audience", []string{"step-ca"}, expiry, nil, 2, "token review failed: token audiences do not match"},
+		{"fail/unauthorized", &K8sSATokenReview{BearerToken: "foo"}, "token", nil, expiry, nil, 0, "failed with status code 401"},
+		{"fail/server", &K8sSATokenReview{Server: "https://127.0.0.1:0", BearerToken: "reviewer"}, "token", nil, expiry, nil, 0, "error doing token review request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTokenReview(t, tt.r)
+			atomic.StoreInt32(hits, 0)
+			// Reviews are done twice to check the cache.
+			for i := 0; i < 2; i++ {
+				got, err := r.Review(tt.token, tt.audiences, tt.expiry)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("K8sSATokenReview.Review() error = %v, wantErr %v", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("K8sSATokenReview.Review() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("K8sSATokenReview.Review() = %v, want %v", got, tt.want)
+				}
+			}
+			if got := atomic.LoadInt32(hits); got != tt.wantHits {
+				t.Errorf("K8sSATokenReview.Review() hits = %d, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func Test_tokenReviewCache(t *testing.T) {
+	user := &tokenReviewUserInfo{Username: "system:serviceaccount:ns-foo:san-foo"}
+	c := newTokenReviewCache()
+	c.Add("expired", nil, user, time.Now().Add(-time.Minute))
+	c.Add("token", nil, user, time.Now().Add(time.Minute))
+	c.Add("token-audience", []string{"step-ca"}, user, time.Now().Add(time.Minute))
+	c.entries[tokenReviewCacheKey("old", nil)] = tokenReviewCacheEntry{user: user, expiry: time.Now().Add(-time.Minute)}
+
+	if _, ok := c.Get("expired", nil); ok {
+		t.Error("tokenReviewCache.Get() expired token found")
+	}
+	if _, ok := c.Get("old", nil); ok {
+		t.Error("tokenReviewCache.Get() old token found")
+	}
+	if got, ok := c.Get("token", nil); !ok || got != user {
+		t.Errorf("tokenReviewCache.Get() = %v, %v, want %v, true", got, ok, user)
+	}
+	if got, ok := c.Get("token-audience", []string{"step-ca"}); !ok || got != user {
+		t.Errorf("tokenReviewCache.Get() = %v, %v, want %v, true", got, ok, user)
+	}
+	if _, ok := c.Get("token-audience", []string{"step-ca", "foo"}); ok {
+		t.Error("tokenReviewCache.Get() token with other audiences found")
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("tokenReviewCache entries = %d, want 2", len(c.entries))
+	}
+	if _, ok := c.entries["token"]; ok {
+		t.Error("tokenReviewCache stores the raw token")
+	}
+}
@@ -42,12 +42,13 @@ var (
 		AllowRenewalAfterExpiry: &defaultAllowRenewalAfterExpiry,
 	}
 	testAudiences = Audiences{
-		Sign:      []string{"https://ca.smallstep.com/1.0/sign", "https://ca.smallstep.com/sign"},
-		Revoke:    []string{"https://ca.smallstep.com/1.0/revoke", "https://ca.smallstep.com/revoke"},
-		SSHSign:   []string{"https://ca.smallstep.com/1.0/ssh/sign"},
-		SSHRevoke: []string{"https://ca.smallstep.com/1.0/ssh/revoke"},
-		SSHRenew:  []string{"https://ca.smallstep.com/1.0/ssh/renew"},
-		SSHRekey:  []string{"https://ca.smallstep.com/1.0/ssh/rekey"},
+		Sign:       []string{"https://ca.smallstep.com/1.0/sign", "https://ca.smallstep.com/sign"},
+		Revoke:     []string{"https://ca.smallstep.com/1.0/revoke", "https://ca.smallstep.com/revoke"},
+		SSHSign:    []string{"https://ca.smallstep.com/1.0/ssh/sign"},
+		SSHRevoke:  []string{"https://ca.smallstep.com/1.0/ssh/revoke"},
+		SSHRenew:   []string{"https://ca.smallstep.com/1.0/ssh/renew"},
+		SSHRekey:   []string{"https://ca.smallstep.com/1.0/ssh/rekey"},
+		NebulaSign: []string{"https://ca.smallstep.com/1.0/nebula/sign"},
 	}
 )
 
@@ -938,6 +939,34 @@ func generateGCPToken(sub, iss, aud, instanceID, instanceName, projectID, zone s
 	return jose.Signed(sig).Claims(claims).CompactSerialize()
 }
 
+func generateGCPServiceAccountToken(sub, email, aud string, emailVerified bool, iat time.Time, jwk *jose.JSONWebKey) (string, error) {
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID),
+	)
+	if err != nil {
+		return "", err
+	}
+	aud, err = generateSignAudience("https://ca.smallstep.com", aud)
+	if err != nil {
+		return "", err
+	}
+	claims := gcpPayload{
+		Claims: jose.Claims{
+			Subject:   sub,
+			Issuer:    "https://accounts.google.com",
+			IssuedAt:  jose.NewNumericDate(iat),
+			NotBefore: jose.NewNumericDate(iat),
+			Expiry:    jose.NewNumericDate(iat.Add(5 * time.Minute)),
+			Audience:  []string{aud},
+		},
+		AuthorizedParty: sub,
+		Email:           email,
+		EmailVerified:   emailVerified,
+	}
+	return jose.Signed(sig).Claims(claims).CompactSerialize()
+}
+
 func generateAWSToken(p *AWS, sub, iss, aud, accountID, instanceID, privateIP, region string, iat time.Time, key crypto.Signer) (string, error) {
 	doc, err := json.MarshalIndent(awsInstanceIdentityDocument{
 		AccountID:        accountID,
@@ -1008,6 +1037,10 @@ func generateAzureToken(sub, iss, aud, tenantID, subscriptionID, resourceGroup,
 		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/%s", subscriptionID, resourceGroup, resourceName)
 	} else if resourceType == "uai" {
 		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ManagedIdentity/userAssignedIdentities/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "vmss" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s", subscriptionID, resourceGroup, resourceName)
+	} else if resourceType == "vmss-instance" {
+		xmsMirID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s/virtualMachines/3", subscriptionID, resourceGroup, resourceName)
 	}
 
 	claims := azurePayload{
@@ -1093,6 +1126,13 @@ func generateJWKServer(n int) *httptest.Server {
 			writeJSON(w, hits)
 		case "/.well-known/openid-configuration":
 			writeJSON(w, openIDConfiguration{Issuer: "the-issuer", JWKSetURI: srv.URL + "/jwks_uri"})
+		case "/device/.well-known/openid-configuration":
+			writeJSON(w, openIDConfiguration{
+				Issuer:                        "the-issuer",
+				JWKSetURI:                     srv.URL + "/jwks_uri",
+				DeviceAuthorizationEndpoint:   srv.URL + "/device_authorization",
+				CodeChallengeMethodsSupported: []string{"plain", "S256", "S512"},
+			})
 		case "/common/.well-known/openid-configuration":
 			writeJSON(w, openIDConfiguration{Issuer: "https://login.microsoftonline.com/{tenantid}/v2.0", JWKSetURI: srv.URL + "/jwks_uri"})
 		case "/random":
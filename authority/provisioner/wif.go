@@ -0,0 +1,256 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/sshutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// WIF is a workload identity federation provisioner. It grants certificates to
+// workloads presenting a JWT issued by a trusted issuer, like the OIDC tokens
+// minted by CI systems like GitHub Actions, GitLab or Buildkite.
+//
+// The tokens are validated using the keys published at the JWKS URI of the
+// issuer, and the claims of the token must satisfy the configured expression,
+// e.g.:
+//
+//	repository == "org/x" && ref startsWith "refs/heads/main"
+//
+// All the token claims are available to the templates in the Token variable.
+// The audience of the tokens must be the configured audience, and it is used
+// to load the provisioner, so it must be unique.
+type WIF struct {
+	*base
+	ID         string   `json:"-"`
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Issuer     string   `json:"issuer"`
+	JWKSetURI  string   `json:"jwksURI,omitempty"`
+	Audience   string   `json:"audience"`
+	Expression string   `json:"expression,omitempty"`
+	Claims     *Claims  `json:"claims,omitempty"`
+	Options    *Options `json:"options,omitempty"`
+	expression *claimExpression
+	keyStore   *keyStore
+	ctl        *Controller
+}
+
+// GetID returns the provisioner unique identifier.
+func (p *WIF) GetID() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.GetIDForToken()
+}
+
+// GetIDForToken returns an identifier that will be used to load the provisioner
+// from a token. WIF provisioners are loaded using the audience of the token.
+func (p *WIF) GetIDForToken() string {
+	return p.Audience
+}
+
+// GetTokenID returns the identifier of the token, the jti claim if present.
+func (p *WIF) GetTokenID(ott string) (string, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing token")
+	}
+	var claims jose.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "error verifying claims")
+	}
+	return claims.ID, nil
+}
+
+// GetName returns the name of the provisioner.
+func (p *WIF) GetName() string {
+	return p.Name
+}
+
+// GetType returns the type of provisioner.
+func (p *WIF) GetType() Type {
+	return TypeWIF
+}
+
+// GetEncryptedKey is not available in a WIF provisioner.
+func (p *WIF) GetEncryptedKey() (kid, key string, ok bool) {
+	return "", "", false
+}
+
+// Init validates and initializes the WIF provisioner.
+func (p *WIF) Init(config Config) (err error) {
+	switch {
+	case p.Type == "":
+		return errors.New("provisioner type cannot be empty")
+	case p.Name == "":
+		return errors.New("provisioner name cannot be empty")
+	case p.Issuer == "":
+		return errors.New("provisioner issuer cannot be empty")
+	case p.Audience == "":
+		return errors.New("provisioner audience cannot be empty")
+	case p.Expression == "":
+		return errors.New("provisioner expression cannot be empty")
+	}
+
+	if p.expression, err = parseClaimExpression(p.Expression); err != nil {
+		return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
+	}
+
+	// Get the keys from the JWKS URI or from the OIDC discovery document of
+	// the issuer.
+	if p.JWKSetURI != "" {
+		p.keyStore, err = newKeyStore(p.JWKSetURI)
+	} else {
+		p.keyStore, err = newIssuerKeyStore(p.Issuer)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
+	}
+
+	p.ctl, err = NewController(p, p.Claims, config, p.Options)
+	return
+}
+
+// authorizeToken validates the token and returns the claims of the token.
+func (p *WIF) authorizeToken(token string) (*jose.Claims, map[string]interface{}, error) {
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, nil, errs.Wrap(http.StatusUnauthorized, err, "wif.authorizeToken; error parsing wif token")
+	}
+
+	var (
+		found  bool
+		claims jose.Claims
+		values map[string]interface{}
+	)
+	for _, key := range p.keyStore.Get(jwt.Headers[0].KeyID) {
+		if err := jwt.Claims(key, &claims, &values); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil, errs.Unauthorized("wif.authorizeToken; cannot validate wif token")
+	}
+
+	// According to "rfc7519 JSON Web Token" acceptable skew should be no more
+	// than a few minutes.
+	if claims.Expiry == nil {
+		return nil, nil, errs.Unauthorized("wif.authorizeToken; invalid wif token claims: missing expiration")
+	}
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Issuer:   p.Issuer,
+		Audience: jose.Audience{p.Audience},
+		Time:     time.Now().UTC(),
+	}, time.Minute); err != nil {
+		return nil, nil, errs.Wrap(http.StatusUnauthorized, err, "wif.authorizeToken; invalid wif token claims")
+	}
+	if claims.Subject == "" {
+		return nil, nil, errs.Unauthorized("wif.authorizeToken; wif token subject cannot be empty")
+	}
+
+	if !p.expression.Evaluate(values) {
+		return nil, nil, errs.Unauthorized("wif.authorizeToken; wif token claims do not match the expression")
+	}
+
+	return &claims, values, nil
+}
+
+// AuthorizeSign validates the given token and returns the sign options. The
+// subject of the token is used as the common name of the certificate.
+func (p *WIF) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
+	claims, values, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "wif.AuthorizeSign")
+	}
+
+	// Certificate templates
+	data := x509util.CreateTemplateData(claims.Subject, nil)
+	data.SetToken(values)
+
+	templateOptions, err := CustomTemplateOptions(p.Options, data, x509util.DefaultLeafTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "wif.AuthorizeSign")
+	}
+
+	return []SignOption{
+		p,
+		templateOptions,
+		// modifiers / withOptions
+		newProvisionerExtensionOption(TypeWIF, p.Name, p.Audience),
+		profileDefaultDuration(p.ctl.Claimer.DefaultTLSCertDuration()),
+		// validators
+		defaultPublicKeyValidator{},
+		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
+		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
+	}, nil
+}
+
+// AuthorizeRenew returns an error if the renewal is disabled.
+func (p *WIF) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	return p.ctl.AuthorizeRenew(ctx, cert)
+}
+
+// AuthorizeSSHSign validates the given token and returns the sign options for
+// an SSH user certificate. The subject of the token is used as the key id and
+// principal of the certificate.
+func (p *WIF) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption, error) {
+	if !p.ctl.Claimer.IsSSHCAEnabled() {
+		return nil, errs.Unauthorized("wif.AuthorizeSSHSign; sshCA is disabled for wif provisioner '%s'", p.GetName())
+	}
+	claims, values, err := p.authorizeToken(token)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "wif.AuthorizeSSHSign")
+	}
+
+	// Certificate templates.
+	principals := []string{claims.Subject}
+	data := sshutil.CreateTemplateData(sshutil.UserCert, claims.Subject, principals)
+	data.SetToken(values)
+
+	templateOptions, err := CustomSSHTemplateOptions(p.Options, data, sshutil.DefaultTemplate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "wif.AuthorizeSSHSign")
+	}
+
+	return []SignOption{
+		templateOptions,
+		p,
+		// Validate user SignSSHOptions.
+		sshCertOptionsValidator(SignSSHOptions{
+			CertType:   SSHUserCert,
+			Principals: principals,
+		}),
+		// Set the validity bounds if not set.
+		&sshDefaultDuration{p.ctl.Claimer},
+		// Validate public key
+		&sshDefaultPublicKeyValidator{},
+		// Validate the validity period.
+		&sshCertValidityValidator{p.ctl.Claimer},
+		// Require all the fields in the SSH certificate
+		&sshCertDefaultValidator{},
+		// Ensure that all principal names are allowed
+		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
+		// Apply the policy for the critical options and extensions
+		SSHPermissionsOption{Options: p.ctl.getPolicy().getSSHPermissions()},
+		// Allow step-up requests for additional principals
+		SSHStepUpOption{Options: p.ctl.getSSHStepUp()},
+	}, nil
+}
+
+// AuthorizeSSHStepUp returns the list of SignOption used to sign the SSH user
+// certificate of an approved step-up request.
+func (p *WIF) AuthorizeSSHStepUp(ctx context.Context) ([]SignOption, error) {
+	return sshStepUpSignOptions(p, p.ctl)
+}
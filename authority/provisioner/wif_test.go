@@ -0,0 +1,323 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+)
+
+func generateWIF(jwksURI string) (*WIF, error) {
+	p := &WIF{
+		Type:       "WIF",
+		Name:       "github-actions",
+		Issuer:     "https://token.actions.githubusercontent.com",
+		JWKSetURI:  jwksURI,
+		Audience:   "step-ca-github",
+		Expression: `repository == "org/x" && ref startsWith "refs/heads/main"`,
+	}
+	if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func generateWIFToken(jwk *jose.JSONWebKey, claims map[string]interface{}) (string, error) {
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", jwk.KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key}, so)
+	if err != nil {
+		return "", err
+	}
+	return jose.Signed(sig).Claims(claims).CompactSerialize()
+}
+
+func getWIFClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"jti":        "the-jti",
+		"iss":        "https://token.actions.githubusercontent.com",
+		"sub":        "repo:org/x:ref:refs/heads/main",
+		"aud":        "step-ca-github",
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+		"exp":        now.Add(5 * time.Minute).Unix(),
+		"repository": "org/x",
+		"ref":        "refs/heads/main",
+		"actor":      "alice",
+	}
+}
+
+func TestWIF_Getters(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	p, err := generateWIF(srv.URL + "/jwks_uri")
+	assert.FatalError(t, err)
+	assert.Equals(t, "step-ca-github", p.GetID())
+	assert.Equals(t, "step-ca-github", p.GetIDForToken())
+	assert.Equals(t, "github-actions", p.GetName())
+	assert.Equals(t, TypeWIF, p.GetType())
+	assert.Equals(t, "WIF", p.GetType().String())
+	kid, key, ok := p.GetEncryptedKey()
+	if kid != "" || key != "" || ok {
+		t.Errorf("WIF.GetEncryptedKey() = (%v, %v, %v), want (%v, %v, %v)", kid, key, ok, "", "", false)
+	}
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+	tok, err := generateWIFToken(&keys.Keys[0], getWIFClaims())
+	assert.FatalError(t, err)
+	id, err := p.GetTokenID(tok)
+	assert.FatalError(t, err)
+	assert.Equals(t, "the-jti", id)
+
+	// The provisioner is loaded by the audience of the token.
+	c := NewCollection(testAudiences)
+	assert.FatalError(t, c.Store(p))
+	jwt, claims, err := parseToken(tok)
+	assert.FatalError(t, err)
+	got, ok := c.LoadByToken(jwt, claims)
+	assert.True(t, ok)
+	assert.Equals(t, p, got)
+}
+
+func TestWIF_Init(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+	tests := []struct {
+		name    string
+		p       *WIF
+		wantErr bool
+	}{
+		{"ok", &WIF{Type: "WIF", Name: "name", Issuer: "the-issuer", Audience: "aud", JWKSetURI: srv.URL + "/jwks_uri", Expression: `ref == "refs/heads/main"`}, false},
+		{"fail/type", &WIF{Name: "name", Issuer: "the-issuer", Audience: "aud", JWKSetURI: srv.URL + "/jwks_uri"}, true},
+		{"fail/name", &WIF{Type: "WIF", Issuer: "the-issuer", Audience: "aud", JWKSetURI: srv.URL + "/jwks_uri"}, true},
+		{"fail/issuer", &WIF{Type: "WIF", Name: "name", Audience: "aud", JWKSetURI: srv.URL + "/jwks_uri"}, true},
+		{"fail/audience", &WIF{Type: "WIF", Name: "name", Issuer: "the-issuer", JWKSetURI: srv.URL + "/jwks_uri"}, true},
+		{"fail/no-expression", &WIF{Type: "WIF", Name: "name", Issuer: "the-issuer", Audience: "aud", JWKSetURI: srv.URL + "/jwks_uri"}, true},
+		{"fail/expression", &WIF{Type: "WIF", Name: "name", Issuer: "the-issuer", Audience: "aud", JWKSetURI: srv.URL + "/jwks_uri", Expression: `ref ==`}, true},
+		{"fail/jwks", &WIF{Type: "WIF", Name: "name", Issuer: "the-issuer", Audience: "aud", JWKSetURI: srv.URL + "/error", Expression: `ref == "refs/heads/main"`}, true},
+		{"fail/discovery", &WIF{Type: "WIF", Name: "name", Issuer: srv.URL, Audience: "aud", Expression: `ref == "refs/heads/main"`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Init(config); (err != nil) != tt.wantErr {
+				t.Errorf("WIF.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWIF_authorizeToken(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateWIF(srv.URL + "/jwks_uri")
+	assert.FatalError(t, err)
+
+	type test struct {
+		token string
+		err   error
+	}
+	tests := map[string]func(*testing.T) test{
+		"fail/bad-token": func(t *testing.T) test {
+			return test{
+				token: "foo",
+				err:   errors.New("wif.authorizeToken; error parsing wif token"),
+			}
+		},
+		"fail/unknown-key": func(t *testing.T) test {
+			jwk, err := generateJSONWebKey()
+			assert.FatalError(t, err)
+			tok, err := generateWIFToken(jwk, getWIFClaims())
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; cannot validate wif token"),
+			}
+		},
+		"fail/no-expiry": func(t *testing.T) test {
+			claims := getWIFClaims()
+			delete(claims, "exp")
+			tok, err := generateWIFToken(&keys.Keys[0], claims)
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; invalid wif token claims: missing expiration"),
+			}
+		},
+		"fail/expired": func(t *testing.T) test {
+			claims := getWIFClaims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			tok, err := generateWIFToken(&keys.Keys[0], claims)
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; invalid wif token claims: square/go-jose/jwt: validation failed, token is expired (exp)"),
+			}
+		},
+		"fail/issuer": func(t *testing.T) test {
+			claims := getWIFClaims()
+			claims["iss"] = "https://gitlab.com"
+			tok, err := generateWIFToken(&keys.Keys[0], claims)
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; invalid wif token claims: square/go-jose/jwt: validation failed, invalid issuer claim (iss)"),
+			}
+		},
+		"fail/audience": func(t *testing.T) test {
+			claims := getWIFClaims()
+			claims["aud"] = "foo"
+			tok, err := generateWIFToken(&keys.Keys[0], claims)
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; invalid wif token claims: square/go-jose/jwt: validation failed, invalid audience claim (aud)"),
+			}
+		},
+		"fail/subject": func(t *testing.T) test {
+			claims := getWIFClaims()
+			delete(claims, "sub")
+			tok, err := generateWIFToken(&keys.Keys[0], claims)
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; wif token subject cannot be empty"),
+			}
+		},
+		"fail/expression": func(t *testing.T) test {
+			claims := getWIFClaims()
+			claims["ref"] = "refs/heads/feature"
+			tok, err := generateWIFToken(&keys.Keys[1], claims)
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+				err:   errors.New("wif.authorizeToken; wif token claims do not match the expression"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			tok, err := generateWIFToken(&keys.Keys[1], getWIFClaims())
+			assert.FatalError(t, err)
+			return test{
+				token: tok,
+			}
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := tt(t)
+			claims, values, err := p.authorizeToken(tc.token)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					var sc render.StatusCodedError
+					assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), http.StatusUnauthorized)
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, "repo:org/x:ref:refs/heads/main", claims.Subject)
+				assert.Equals(t, "alice", values["actor"])
+			}
+		})
+	}
+}
+
+func TestWIF_AuthorizeSign(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateWIF(srv.URL + "/jwks_uri")
+	assert.FatalError(t, err)
+	tok, err := generateWIFToken(&keys.Keys[0], getWIFClaims())
+	assert.FatalError(t, err)
+
+	_, err = p.AuthorizeSign(context.Background(), "foo")
+	assert.HasPrefix(t, err.Error(), "wif.AuthorizeSign: wif.authorizeToken; error parsing wif token")
+
+	opts, err := p.AuthorizeSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	assert.Len(t, 7, opts)
+	for _, o := range opts {
+		switch v := o.(type) {
+		case *WIF:
+		case certificateOptionsFunc:
+		case *provisionerExtensionOption:
+			assert.Equals(t, v.Type, TypeWIF)
+			assert.Equals(t, v.Name, p.GetName())
+			assert.Equals(t, v.CredentialID, p.Audience)
+		case profileDefaultDuration:
+			assert.Equals(t, time.Duration(v), p.ctl.Claimer.DefaultTLSCertDuration())
+		case defaultPublicKeyValidator:
+		case *validityValidator:
+			assert.Equals(t, v.min, p.ctl.Claimer.MinTLSCertDuration())
+			assert.Equals(t, v.max, p.ctl.Claimer.MaxTLSCertDuration())
+		case *x509NamePolicyValidator:
+			assert.Equals(t, nil, v.policyEngine)
+		default:
+			assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
+		}
+	}
+}
+
+func TestWIF_AuthorizeSSHSign(t *testing.T) {
+	srv := generateJWKServer(1)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateWIF(srv.URL + "/jwks_uri")
+	assert.FatalError(t, err)
+	tok, err := generateWIFToken(&keys.Keys[0], getWIFClaims())
+	assert.FatalError(t, err)
+
+	opts, err := p.AuthorizeSSHSign(context.Background(), tok)
+	assert.FatalError(t, err)
+	assert.Len(t, 11, opts)
+	for _, o := range opts {
+		switch v := o.(type) {
+		case *WIF:
+		case sshCertificateOptionsFunc:
+		case sshCertOptionsValidator:
+			assert.Equals(t, SignSSHOptions(v), SignSSHOptions{CertType: SSHUserCert, Principals: []string{"repo:org/x:ref:refs/heads/main"}})
+		case *sshDefaultDuration:
+		case *sshDefaultPublicKeyValidator:
+		case *sshCertValidityValidator:
+		case *sshCertDefaultValidator:
+		case *sshNamePolicyValidator:
+		case SSHPermissionsOption:
+		case SSHHostKeyAttestationOption:
+		case SSHStepUpOption:
+		default:
+			assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
+		}
+	}
+
+	// sshCA disabled
+	disable := false
+	p.Claims = &Claims{EnableSSHCA: &disable}
+	p.ctl.Claimer, err = NewClaimer(p.Claims, globalProvisionerClaims)
+	assert.FatalError(t, err)
+	_, err = p.AuthorizeSSHSign(context.Background(), tok)
+	assert.HasPrefix(t, err.Error(), fmt.Sprintf("wif.AuthorizeSSHSign; sshCA is disabled for wif provisioner '%s'", p.GetName()))
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
@@ -19,23 +20,34 @@ import (
 // x5cPayload extends jwt.Claims with step attributes.
 type x5cPayload struct {
 	jose.Claims
-	SANs   []string     `json:"sans,omitempty"`
-	Step   *stepPayload `json:"step,omitempty"`
-	chains [][]*x509.Certificate
+	SANs     []string     `json:"sans,omitempty"`
+	Step     *stepPayload `json:"step,omitempty"`
+	chains   [][]*x509.Certificate
+	spiffeID *url.URL
 }
 
 // X5C is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
+//
+// If SPIFFE is configured, the tokens must be signed by an X509-SVID, and the
+// SPIFFE ID of the SVID is always added to the issued certificates.
+//
+// The certificate that signs the token must not be revoked in the authority, if
+// it was issued by it, or in any of the CRLs, files or http(s) URLs, configured
+// in the provisioner.
 type X5C struct {
 	*base
-	ID       string   `json:"-"`
-	Type     string   `json:"type"`
-	Name     string   `json:"name"`
-	Roots    []byte   `json:"roots"`
-	Claims   *Claims  `json:"claims,omitempty"`
-	Options  *Options `json:"options,omitempty"`
+	ID       string     `json:"-"`
+	Type     string     `json:"type"`
+	Name     string     `json:"name"`
+	Roots    []byte     `json:"roots,omitempty"`
+	SPIFFE   *X5CSPIFFE `json:"spiffe,omitempty"`
+	CRLs     []string   `json:"crls,omitempty"`
+	Claims   *Claims    `json:"claims,omitempty"`
+	Options  *Options   `json:"options,omitempty"`
 	ctl      *Controller
 	rootPool *x509.CertPool
+	crls     *crlStore
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -93,33 +105,48 @@ func (p *X5C) Init(config Config) (err error) {
 		return errors.New("provisioner type cannot be empty")
 	case p.Name == "":
 		return errors.New("provisioner name cannot be empty")
-	case len(p.Roots) == 0:
+	case len(p.Roots) == 0 && (p.SPIFFE == nil || p.SPIFFE.BundleFile == ""):
 		return errors.New("provisioner root(s) cannot be empty")
+	case len(p.Roots) > 0 && p.SPIFFE != nil && p.SPIFFE.BundleFile != "":
+		return errors.New("provisioner roots and spiffe bundleFile cannot be used together")
 	}
 
-	p.rootPool = x509.NewCertPool()
+	if err := p.SPIFFE.Validate(); err != nil {
+		return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
+	}
 
-	var (
-		block *pem.Block
-		rest  = p.Roots
-		count int
-	)
-	for rest != nil {
-		block, rest = pem.Decode(rest)
-		if block == nil {
-			break
+	// The roots are not used if the trust bundle is loaded from a file.
+	if len(p.Roots) > 0 {
+		p.rootPool = x509.NewCertPool()
+
+		var (
+			block *pem.Block
+			rest  = p.Roots
+			count int
+		)
+		for rest != nil {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.Wrap(err, "error parsing x509 certificate from PEM block")
+			}
+			count++
+			p.rootPool.AddCert(cert)
 		}
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return errors.Wrap(err, "error parsing x509 certificate from PEM block")
+
+		// Verify that at least one root was found.
+		if count == 0 {
+			return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
 		}
-		count++
-		p.rootPool.AddCert(cert)
 	}
 
-	// Verify that at least one root was found.
-	if count == 0 {
-		return errors.Errorf("no x509 certificates found in roots attribute for provisioner '%s'", p.GetName())
+	if len(p.CRLs) > 0 {
+		if p.crls, err = newCRLStore(p.CRLs); err != nil {
+			return errors.Wrapf(err, "error initializing provisioner '%s'", p.GetName())
+		}
 	}
 
 	config.Audiences = config.Audiences.WithFragment(p.GetIDForToken())
@@ -130,15 +157,27 @@ func (p *X5C) Init(config Config) (err error) {
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, error) {
+func (p *X5C) authorizeToken(ctx context.Context, token string, audiences []string) (*x5cPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; error parsing x5c token")
 	}
 
+	rootPool, keyUsages := p.rootPool, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if p.SPIFFE != nil {
+		// X509-SVIDs are commonly issued with the server auth extended key
+		// usage, so both are accepted.
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+		if p.SPIFFE.bundle != nil {
+			if rootPool, err = p.SPIFFE.bundle.Pool(); err != nil {
+				return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.authorizeToken; error loading spiffe bundle")
+			}
+		}
+	}
+
 	verifiedChains, err := jwt.Headers[0].Certificates(x509.VerifyOptions{
-		Roots:     p.rootPool,
-		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		Roots:     rootPool,
+		KeyUsages: keyUsages,
 	})
 	if err != nil {
 		return nil, errs.Wrap(http.StatusUnauthorized, err,
@@ -150,6 +189,13 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		return nil, errs.Unauthorized("x5c.authorizeToken; certificate used to sign x5c token cannot be used for digital signature")
 	}
 
+	var spiffeID *url.URL
+	if p.SPIFFE != nil {
+		if spiffeID, err = p.SPIFFE.Verify(leaf); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "x5c.authorizeToken; invalid x509-svid")
+		}
+	}
+
 	// Using the leaf certificates key to validate the claims accomplishes two
 	// things:
 	//   1. Asserts that the private key used to sign the token corresponds
@@ -179,25 +225,57 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		return nil, errs.Unauthorized("x5c.authorizeToken; x5c token subject cannot be empty")
 	}
 
+	// Check the revocation of the certificate once the token is validated.
+	revoked, err := p.isRevoked(ctx, verifiedChains[0])
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.authorizeToken; error checking x5c certificate revocation")
+	}
+	if revoked {
+		return nil, errs.Unauthorized("x5c.authorizeToken; certificate used to sign x5c token has been revoked")
+	}
+
 	// Save the verified chains on the x5c payload object.
 	claims.chains = verifiedChains
+	claims.spiffeID = spiffeID
 	return &claims, nil
 }
 
+// isRevoked returns true if the leaf certificate in the chain has been revoked
+// in the authority, or any of the certificates in the chain has been revoked in
+// the configured CRLs.
+func (p *X5C) isRevoked(ctx context.Context, chain []*x509.Certificate) (bool, error) {
+	revoked, err := p.ctl.IsRevoked(ctx, chain)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	if p.crls != nil {
+		return p.crls.IsRevoked(chain)
+	}
+	return false, nil
+}
+
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 func (p *X5C) AuthorizeRevoke(ctx context.Context, token string) error {
-	_, err := p.authorizeToken(token, p.ctl.Audiences.Revoke)
+	_, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Revoke)
 	return errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeRevoke")
 }
 
 // AuthorizeSign validates the given token.
 func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token, p.ctl.Audiences.Sign)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.Sign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSign")
 	}
 
+	// The SPIFFE ID of the X509-SVID is always added to the SANs, and it
+	// must be the only URI SAN.
+	if claims.spiffeID != nil {
+		if claims.SANs, err = spiffeSANs(claims.SANs, claims.spiffeID); err != nil {
+			return nil, errs.Wrap(http.StatusUnauthorized, err, "x5c.AuthorizeSign")
+		}
+	}
+
 	// NOTE: This is for backwards compatibility with older versions of cli
 	// and certificates. Older versions added the token subject as the only SAN
 	// in a CSR by default.
@@ -210,6 +288,9 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 	if v, err := unsafeParseSigned(token); err == nil {
 		data.SetToken(v)
 	}
+	if claims.spiffeID != nil {
+		data.Set("SPIFFE", newSPIFFETemplateData(claims.spiffeID))
+	}
 
 	// The X509 certificate will be available using the template variable
 	// AuthorizationCrt. For example {{ .AuthorizationCrt.DNSNames }} can be
@@ -230,7 +311,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		}
 	}
 
-	return []SignOption{
+	signOptions := []SignOption{
 		self,
 		templateOptions,
 		// modifiers / withOptions
@@ -245,7 +326,29 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		defaultPublicKeyValidator{},
 		newValidityValidator(p.ctl.Claimer.MinTLSCertDuration(), p.ctl.Claimer.MaxTLSCertDuration()),
 		newX509NamePolicyValidator(p.ctl.getPolicy().getX509()),
-	}, nil
+	}
+	if claims.spiffeID != nil {
+		// Ensure that custom templates preserve the SPIFFE ID.
+		signOptions = append(signOptions, spiffeIDValidator(claims.spiffeID.String()))
+	}
+	return signOptions, nil
+}
+
+// spiffeSANs returns the given SANs with the SPIFFE ID. It fails if the SANs
+// contain a URI other than the SPIFFE ID.
+func spiffeSANs(sans []string, spiffeID *url.URL) ([]string, error) {
+	var found bool
+	_, _, _, uris := x509util.SplitSANs(sans)
+	for _, u := range uris {
+		if u.String() != spiffeID.String() {
+			return nil, errors.Errorf("token SAN %s does not match the spiffe id %s", u, spiffeID)
+		}
+		found = true
+	}
+	if found {
+		return sans, nil
+	}
+	return append(sans, spiffeID.String()), nil
 }
 
 // AuthorizeRenew returns an error if the renewal is disabled.
@@ -259,7 +362,7 @@ func (p *X5C) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		return nil, errs.Unauthorized("x5c.AuthorizeSSHSign; sshCA is disabled for x5c provisioner '%s'", p.GetName())
 	}
 
-	claims, err := p.authorizeToken(token, p.ctl.Audiences.SSHSign)
+	claims, err := p.authorizeToken(ctx, token, p.ctl.Audiences.SSHSign)
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "x5c.AuthorizeSSHSign")
 	}
@@ -332,5 +435,17 @@ func (p *X5C) AuthorizeSSHSign(ctx context.Context, token string) ([]SignOption,
 		&sshCertDefaultValidator{},
 		// Ensure that all principal names are allowed
 		newSSHNamePolicyValidator(p.ctl.getPolicy().getSSHHost(), p.ctl.getPolicy().getSSHUser()),
+		// Validate the proof of possession of the host key
+		SSHHostKeyAttestationOption{Options: p.ctl.getSSHHostKeyAttestation()},
+		// Apply the policy for the critical options and extensions
+		SSHPermissionsOption{Options: p.ctl.getPolicy().getSSHPermissions()},
+		// Allow step-up requests for additional principals
+		SSHStepUpOption{Options: p.ctl.getSSHStepUp()},
 	), nil
 }
+
+// AuthorizeSSHStepUp returns the list of SignOption used to sign the SSH user
+// certificate of an approved step-up request.
+func (p *X5C) AuthorizeSSHStepUp(ctx context.Context) ([]SignOption, error) {
+	return sshStepUpSignOptions(p, p.ctl)
+}
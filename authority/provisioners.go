@@ -144,6 +144,7 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 		GetIdentityFunc:       a.getIdentityFunc,
 		AuthorizeRenewFunc:    a.authorizeRenewFunc,
 		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
+		IsRevokedFunc:         a.isRevokedFunc,
 	}, nil
 }
 
@@ -1027,6 +1028,11 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			SshTemplate:  sshTemplate,
 		}, nil
 	case *provisioner.X5C:
+		// Linked provisioners cannot store the SPIFFE settings, and dropping
+		// them would allow any certificate signed by the roots.
+		if p.SPIFFE != nil {
+			return nil, fmt.Errorf("provisioner %s: spiffe settings are not supported by linked provisioners", p.GetName())
+		}
 		x509Template, sshTemplate, err := provisionerOptionsToLinkedca(p.Options)
 		if err != nil {
 			return nil, err
@@ -251,3 +251,25 @@ func TestAuthority_LoadProvisionerByCertificate(t *testing.T) {
 		})
 	}
 }
+
+func TestProvisionerToLinkedca_x5c(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *provisioner.X5C
+		wantErr bool
+	}{
+		{"ok", &provisioner.X5C{Type: "X5C", Name: "x5c", Roots: []byte("roots")}, false},
+		{"fail/spiffe", &provisioner.X5C{Type: "X5C", Name: "x5c", Roots: []byte("roots"), SPIFFE: &provisioner.X5CSPIFFE{TrustDomain: "example.org"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProvisionerToLinkedca(tt.p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProvisionerToLinkedca() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Name != tt.p.Name {
+				t.Errorf("ProvisionerToLinkedca() name = %v, want %v", got.Name, tt.p.Name)
+			}
+		})
+	}
+}
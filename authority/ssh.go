@@ -12,10 +12,13 @@ import (
 
 	"golang.org/x/crypto/ssh"
 
+	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/sshutil"
 
+	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 	"github.com/smallstep/certificates/errs"
@@ -150,6 +153,8 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		certOptions []sshutil.Option
 		mods        []provisioner.SSHCertModifier
 		validators  []provisioner.SSHCertValidator
+		permissions []*policy.SSHPermissionsOptions
+		hostKeyOpts *provisioner.SSHHostKeyAttestationOptions
 	)
 
 	// Validate given options.
@@ -160,6 +165,25 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	// Set backdate with the configured value
 	opts.Backdate = a.config.AuthorityConfig.Backdate.Duration
 
+	// Authorize the principals that are hosts in the SSH host inventory. The
+	// provisioner validators check the final set of principals, including
+	// the authorized hosts.
+	hostPrincipals, err := a.authorizeSSHHostPrincipals(ctx, opts, signOpts)
+	if err != nil {
+		return nil, err
+	}
+	validateOpts := opts
+	if len(hostPrincipals) > 0 {
+		validateOpts.Principals = make([]string, 0, len(opts.Principals)+len(hostPrincipals))
+		validateOpts.Principals = append(validateOpts.Principals, opts.Principals...)
+		for _, p := range hostPrincipals {
+			if !containsString(validateOpts.Principals, p) {
+				validateOpts.Principals = append(validateOpts.Principals, p)
+			}
+		}
+		validateOpts.AuthorizedHosts = hostPrincipals
+	}
+
 	var prov provisioner.Interface
 	for _, op := range signOpts {
 		switch o := op.(type) {
@@ -181,10 +205,24 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 
 		// validate the given SSHOptions
 		case provisioner.SSHCertOptionsValidator:
-			if err := o.Valid(opts); err != nil {
+			if err := o.Valid(validateOpts); err != nil {
 				return nil, errs.BadRequestErr(err, "error validating ssh certificate options")
 			}
 
+		// host tags are used by authorizeSSHHostPrincipals
+		case provisioner.SSHHostTagsOption:
+
+		// provisioner policy for critical options and extensions
+		case provisioner.SSHPermissionsOption:
+			permissions = append(permissions, o.Options)
+
+		// provisioner options to validate the host key
+		case provisioner.SSHHostKeyAttestationOption:
+			hostKeyOpts = o.Options
+
+		// step-up options are used by CreateSSHStepUpRequest
+		case provisioner.SSHStepUpOption:
+
 		default:
 			return nil, errs.InternalServer("authority.SignSSH: invalid extra option type %T", o)
 		}
@@ -234,6 +272,33 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 		}
 	}
 
+	// Add the authorized hosts to the user certificate.
+	if certTpl.CertType == ssh.UserCert {
+		for _, p := range hostPrincipals {
+			if !containsString(certTpl.ValidPrincipals, p) {
+				certTpl.ValidPrincipals = append(certTpl.ValidPrincipals, p)
+			}
+		}
+	}
+
+	// Apply the provisioner and authority policies for critical options and
+	// extensions.
+	if certTpl.CertType == ssh.UserCert {
+		permissions = append(permissions, a.config.AuthorityConfig.Policy.GetSSHOptions().GetPermissions())
+		if err := applySSHPermissions(ctx, certTpl, permissions); err != nil {
+			return nil, errs.ForbiddenErr(err, "error applying ssh certificate permissions policy")
+		}
+	}
+
+	// Validate the proof of possession, and attestation, of the host key.
+	if certTpl.CertType == ssh.HostCert && hostKeyOpts != nil {
+		token, _ := provisioner.TokenFromContext(ctx)
+		proof, _ := provisioner.SSHHostKeyProofFromContext(ctx)
+		if err := hostKeyOpts.Verify(certTpl.Key, token, proof); err != nil {
+			return nil, errs.ForbiddenErr(err, "error validating ssh host key")
+		}
+	}
+
 	// Get signer from authority keys
 	var signer ssh.Signer
 	switch certTpl.CertType {
@@ -282,6 +347,80 @@ func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisi
 	return cert, nil
 }
 
+// authorizeSSHHostPrincipals validates the principals of a user certificate
+// that are hosts in the SSH host inventory against the host tags the user is
+// entitled to. It returns the authorized hosts, so they can be added to the
+// certificate. If the request does not have principals, all the hosts the
+// user is entitled to are returned.
+//
+// Principals are only checked if the provisioner sets the host tags of the
+// user, currently only OIDC provisioners with GroupHostTags do it. Other
+// provisioners validate the hostnames as any other principal.
+func (a *Authority) authorizeSSHHostPrincipals(ctx context.Context, opts provisioner.SignSSHOptions, signOpts []provisioner.SignOption) ([]string, error) {
+	var (
+		tags  provisioner.SSHHostTagsOption
+		found bool
+	)
+	for _, op := range signOpts {
+		if o, ok := op.(provisioner.SSHHostTagsOption); ok {
+			tags = append(tags, o...)
+			found = true
+		}
+	}
+	if !found || opts.CertType == provisioner.SSHHostCert {
+		return nil, nil
+	}
+
+	hostDB, ok := a.adminDB.(admin.SSHHostDB)
+	if !ok {
+		return nil, errs.NotImplemented("authority.SignSSH: ssh host inventory is not supported")
+	}
+
+	if len(opts.Principals) == 0 {
+		hosts, err := hostDB.GetSSHHosts(ctx)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error retrieving ssh hosts")
+		}
+		var entitled []string
+		for _, h := range hosts {
+			if hasSSHHostTag(h, tags) && !containsString(entitled, h.Hostname) {
+				entitled = append(entitled, h.Hostname)
+			}
+		}
+		return entitled, nil
+	}
+
+	var hostnames []string
+	for _, p := range opts.Principals {
+		h, err := hostDB.GetSSHHostByHostname(ctx, p)
+		if err != nil {
+			var ae *admin.Error
+			if errors.As(err, &ae) && ae.IsType(admin.ErrorNotFoundType) {
+				continue
+			}
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error retrieving ssh host %s", p)
+		}
+		switch {
+		case h == nil || h.Hostname != p:
+		case hasSSHHostTag(h, tags):
+			hostnames = append(hostnames, p)
+		default:
+			return nil, errs.Forbidden("authority.SignSSH: principal %s is not allowed", p)
+		}
+	}
+	return hostnames, nil
+}
+
+// hasSSHHostTag returns true if the host has one of the given tags.
+func hasSSHHostTag(h *admin.SSHHost, tags provisioner.SSHHostTagsOption) bool {
+	for _, t := range h.Tags {
+		if tags.Includes(t.String()) {
+			return true
+		}
+	}
+	return false
+}
+
 // isAllowedToSignSSHCertificate checks if the Authority is allowed to sign the SSH certificate.
 func (a *Authority) isAllowedToSignSSHCertificate(cert *ssh.Certificate) error {
 	return a.policyEngine.IsSSHCertificateAllowed(cert)
@@ -354,7 +493,10 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 
 // RekeySSH creates a signed SSH certificate using the old SSH certificate as a template.
 func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub ssh.PublicKey, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
-	var validators []provisioner.SSHCertValidator
+	var (
+		validators  []provisioner.SSHCertValidator
+		hostKeyOpts *provisioner.SSHHostKeyAttestationOptions
+	)
 
 	var prov provisioner.Interface
 	for _, op := range signOpts {
@@ -365,6 +507,9 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		// validate the ssh.Certificate
 		case provisioner.SSHCertValidator:
 			validators = append(validators, o)
+		// validate the proof of possession of the new host key
+		case provisioner.SSHHostKeyAttestationOption:
+			hostKeyOpts = o.Options
 		default:
 			return nil, errs.InternalServer("rekeySSH; invalid extra option type %T", o)
 		}
@@ -414,6 +559,15 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		return nil, errs.BadRequest("unexpected certificate type '%d'", cert.CertType)
 	}
 
+	// Validate the proof of possession, and attestation, of the new host key.
+	if cert.CertType == ssh.HostCert && hostKeyOpts != nil {
+		token, _ := provisioner.TokenFromContext(ctx)
+		proof, _ := provisioner.SSHHostKeyProofFromContext(ctx)
+		if err := hostKeyOpts.Verify(pub, token, proof); err != nil {
+			return nil, errs.ForbiddenErr(err, "error validating ssh host key")
+		}
+	}
+
 	var err error
 	// Sign certificate.
 	cert, err = sshutil.CreateCertificate(cert, signer)
@@ -594,7 +748,9 @@ func (a *Authority) CheckSSHHost(ctx context.Context, principal, token string) (
 	return exists, nil
 }
 
-// GetSSHHosts returns a list of valid host principals.
+// GetSSHHosts returns a list of valid host principals. If the admin database
+// has an SSH host inventory with hosts, it returns the hosts in the inventory
+// with their tags.
 func (a *Authority) GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]config.Host, error) {
 	if a.GetConfig().AuthorityConfig.DisableGetSSHHosts {
 		return nil, errs.New(http.StatusNotFound, "ssh hosts list api disabled")
@@ -603,6 +759,31 @@ func (a *Authority) GetSSHHosts(ctx context.Context, cert *x509.Certificate) ([]
 		hosts, err := a.sshGetHostsFunc(ctx, cert)
 		return hosts, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
 	}
+	// Use the hosts in the inventory if available.
+	if hostDB, ok := a.adminDB.(admin.SSHHostDB); ok {
+		inventory, err := hostDB.GetSSHHosts(ctx)
+		if err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
+		}
+		if len(inventory) > 0 {
+			hosts := make([]config.Host, len(inventory))
+			for i, h := range inventory {
+				hosts[i] = config.Host{
+					HostID:   h.ID,
+					Hostname: h.Hostname,
+				}
+				for _, t := range h.Tags {
+					hosts[i].HostTags = append(hosts[i].HostTags, config.HostTag{
+						ID:    t.String(),
+						Name:  t.Name,
+						Value: t.Value,
+					})
+				}
+			}
+			return hosts, nil
+		}
+	}
+
 	hostnames, err := a.db.GetSSHHostPrincipals()
 	if err != nil {
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "getSSHHosts")
@@ -631,3 +812,47 @@ func (a *Authority) getAddUserCommand(principal string) string {
 	}
 	return strings.ReplaceAll(cmd, "<principal>", principal)
 }
+
+// applySSHPermissions applies the given policies for critical options and
+// extensions to the certificate. The IP address of the requester and the
+// claims in the token are used to derive values if a policy requires it.
+func applySSHPermissions(ctx context.Context, cert *ssh.Certificate, permissions []*policy.SSHPermissionsOptions) error {
+	var values *policy.SSHRequestValues
+	for _, p := range permissions {
+		if p == nil {
+			continue
+		}
+		if values == nil {
+			values = sshRequestValues(ctx)
+		}
+		if err := p.Apply(cert, *values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sshRequestValues returns the values of the request stored in the context.
+// The token has already been validated, so the claims are not verified again.
+func sshRequestValues(ctx context.Context) *policy.SSHRequestValues {
+	values := new(policy.SSHRequestValues)
+	values.RemoteAddress, _ = provisioner.RemoteAddressFromContext(ctx)
+	if token, ok := provisioner.TokenFromContext(ctx); ok {
+		if jwt, err := jose.ParseSigned(token); err == nil {
+			var claims map[string]interface{}
+			if err := jwt.UnsafeClaimsWithoutVerification(&claims); err == nil {
+				values.Claims = claims
+			}
+		}
+	}
+	return values
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,313 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+)
+
+// OpenSSH key revocation list constants, see PROTOCOL.krl in the OpenSSH
+// sources.
+const (
+	sshKRLMagic         = "SSHKRL\n\x00"
+	sshKRLFormatVersion = 1
+
+	sshKRLSectionCertificates = 1
+
+	sshKRLSectionCertSerialList  = 0x20
+	sshKRLSectionCertSerialRange = 0x21
+	sshKRLSectionCertKeyID       = 0x23
+)
+
+// sshKRLSection contains the certificates revoked for a CA key.
+type sshKRLSection struct {
+	caKey   ssh.PublicKey
+	serials map[uint64]struct{}
+	keyIDs  map[string]struct{}
+}
+
+// GetSSHKeyRevocationList returns the latest OpenSSH key revocation list (KRL)
+// stored in the database. A new list is generated if there is none yet, or if
+// one of the certificates in it has expired.
+//
+// The version of the list is increased every time it is generated, on every
+// SSH revocation and when an expired certificate is removed, so it can be used
+// to answer conditional requests without reading the revoked certificates.
+func (a *Authority) GetSSHKeyRevocationList(ctx context.Context) (*db.SSHKeyRevocationListInfo, error) {
+	krlDB, err := a.sshKeyRevocationListDB()
+	if err != nil {
+		return nil, err
+	}
+
+	krlInfo, err := krlDB.GetSSHKRL()
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetSSHKeyRevocationList")
+	}
+	if krlInfo == nil || needsSSHKeyRevocationListUpdate(krlInfo, time.Now()) {
+		if krlInfo, err = a.generateSSHKeyRevocationList(krlDB, false); err != nil {
+			return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetSSHKeyRevocationList")
+		}
+	}
+	return krlInfo, nil
+}
+
+// GenerateSSHKeyRevocationList generates a new OpenSSH key revocation list with
+// all the revoked SSH certificates that have not expired yet, and stores it in
+// the database. It returns nil if SSH is not configured or if the database
+// does not support key revocation lists.
+func (a *Authority) GenerateSSHKeyRevocationList() error {
+	krlDB, err := a.sshKeyRevocationListDB()
+	if err != nil {
+		return nil
+	}
+	_, err = a.generateSSHKeyRevocationList(krlDB, true)
+	return err
+}
+
+// sshKeyRevocationListDB returns the database used to generate and store the
+// key revocation lists.
+func (a *Authority) sshKeyRevocationListDB() (db.SSHKeyRevocationListDB, error) {
+	if a.sshCAUserCertSignKey == nil && a.sshCAHostCertSignKey == nil {
+		return nil, errs.NotFound("authority.GetSSHKeyRevocationList; ssh is not configured")
+	}
+
+	// Revocations are stored in the linked CA.
+	if _, ok := a.adminDB.(interface {
+		RevokeSSH(*ssh.Certificate, *db.RevokedCertificateInfo) error
+	}); ok {
+		return nil, errs.NotImplemented("authority.GetSSHKeyRevocationList; ssh key revocation lists are not supported with a linked ca")
+	}
+
+	krlDB, ok := a.db.(db.SSHKeyRevocationListDB)
+	if !ok {
+		return nil, errs.NotImplemented("authority.GetSSHKeyRevocationList; database does not support ssh key revocation lists")
+	}
+	return krlDB, nil
+}
+
+// needsSSHKeyRevocationListUpdate returns true if a certificate in the given
+// key revocation list has expired.
+func needsSSHKeyRevocationListUpdate(krlInfo *db.SSHKeyRevocationListInfo, now time.Time) bool {
+	return !krlInfo.NextUpdate.IsZero() && !now.Before(krlInfo.NextUpdate)
+}
+
+// generateSSHKeyRevocationList generates and stores a new key revocation list.
+// If force is false, the stored list is returned if it is still up to date.
+//
+// The certificates are revoked by serial number for the CA key that signed
+// them. If the certificate is not stored in the database, the serial number is
+// revoked for all the SSH CA keys in the authority. Key ids revoked explicitly
+// are also included.
+func (a *Authority) generateSSHKeyRevocationList(krlDB db.SSHKeyRevocationListDB, force bool) (*db.SSHKeyRevocationListInfo, error) {
+	// Only one list can be generated at the same time, so the version is
+	// always increased.
+	a.sshKRLMutex.Lock()
+	defer a.sshKRLMutex.Unlock()
+
+	now := time.Now().UTC()
+	current, err := krlDB.GetSSHKRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving ssh key revocation list")
+	}
+	if !force && current != nil && !needsSSHKeyRevocationListUpdate(current, now) {
+		return current, nil
+	}
+
+	revokedList, err := krlDB.GetRevokedSSHCertificates()
+	if err != nil {
+		return nil, errors.Wrap(err, "error retrieving revoked ssh certificates")
+	}
+
+	// The keys used if the certificate is not available.
+	var defaultKeys []ssh.PublicKey
+	if a.sshCAUserCertSignKey != nil {
+		defaultKeys = append(defaultKeys, a.sshCAUserCertSignKey.PublicKey())
+	}
+	if a.sshCAHostCertSignKey != nil {
+		defaultKeys = append(defaultKeys, a.sshCAHostCertSignKey.PublicKey())
+	}
+
+	var nextUpdate time.Time
+	sections := make(map[string]*sshKRLSection)
+	getSection := func(key ssh.PublicKey) *sshKRLSection {
+		k := string(key.Marshal())
+		if s, ok := sections[k]; ok {
+			return s
+		}
+		s := &sshKRLSection{
+			caKey:   key,
+			serials: make(map[uint64]struct{}),
+			keyIDs:  make(map[string]struct{}),
+		}
+		sections[k] = s
+		return s
+	}
+
+	for _, rci := range revokedList {
+		if !rci.ExpiresAt.IsZero() && !now.Before(rci.ExpiresAt) {
+			continue
+		}
+
+		serial, err := strconv.ParseUint(rci.Serial, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		keys := defaultKeys
+		expiresAt := rci.ExpiresAt
+		if crt, err := krlDB.GetSSHCertificate(rci.Serial); err == nil {
+			if isSSHCertificateExpired(crt, now) {
+				continue
+			}
+			keys = []ssh.PublicKey{crt.SignatureKey}
+			if expiresAt.IsZero() && crt.ValidBefore != ssh.CertTimeInfinity && crt.ValidBefore <= math.MaxInt64 {
+				expiresAt = time.Unix(int64(crt.ValidBefore), 0).UTC()
+			}
+		}
+
+		// The list must be updated when the first certificate expires.
+		if !expiresAt.IsZero() && (nextUpdate.IsZero() || expiresAt.Before(nextUpdate)) {
+			nextUpdate = expiresAt
+		}
+
+		for _, key := range keys {
+			s := getSection(key)
+			// Serial number 0 cannot be revoked in a KRL.
+			if serial != 0 {
+				s.serials[serial] = struct{}{}
+			}
+			if rci.KeyID != "" {
+				s.keyIDs[rci.KeyID] = struct{}{}
+			}
+		}
+	}
+
+	list := make([]*sshKRLSection, 0, len(sections))
+	for _, s := range sections {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].caKey.Marshal(), list[j].caKey.Marshal()) < 0
+	})
+
+	// The version must be monotonically increasing, the generation time is
+	// used so it also increases if the stored list is lost.
+	generatedDate := uint64(now.Unix())
+	version := generatedDate
+	if current != nil && current.Version >= version {
+		version = current.Version + 1
+	}
+
+	krlInfo := &db.SSHKeyRevocationListInfo{
+		Version:    version,
+		NextUpdate: nextUpdate,
+		Data:       marshalSSHKeyRevocationList(version, generatedDate, list),
+	}
+	if err := krlDB.StoreSSHKRL(krlInfo); err != nil {
+		return nil, errors.Wrap(err, "error storing ssh key revocation list")
+	}
+	return krlInfo, nil
+}
+
+// isSSHCertificateExpired returns true if the SSH certificate is expired at the
+// given time.
+func isSSHCertificateExpired(crt *ssh.Certificate, now time.Time) bool {
+	return crt.ValidBefore != ssh.CertTimeInfinity && uint64(now.Unix()) >= crt.ValidBefore
+}
+
+// marshalSSHKeyRevocationList returns the binary format of an OpenSSH KRL.
+// Consecutive serial numbers are encoded as ranges and the rest as a list.
+func marshalSSHKeyRevocationList(version, generatedDate uint64, sections []*sshKRLSection) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(sshKRLMagic)
+	writeKRLUint32(&buf, sshKRLFormatVersion)
+	writeKRLUint64(&buf, version)       // krl_version
+	writeKRLUint64(&buf, generatedDate) // generated_date
+	writeKRLUint64(&buf, 0)             // flags
+	writeKRLString(&buf, nil)           // reserved
+	writeKRLString(&buf, nil)           // comment
+
+	for _, s := range sections {
+		var section bytes.Buffer
+		writeKRLString(&section, s.caKey.Marshal())
+		writeKRLString(&section, nil) // reserved
+
+		serials := make([]uint64, 0, len(s.serials))
+		for serial := range s.serials {
+			serials = append(serials, serial)
+		}
+		sort.Slice(serials, func(i, j int) bool {
+			return serials[i] < serials[j]
+		})
+
+		var serialList, serialRanges bytes.Buffer
+		for i := 0; i < len(serials); {
+			j := i
+			for j+1 < len(serials) && serials[j+1] == serials[j]+1 {
+				j++
+			}
+			if i == j {
+				writeKRLUint64(&serialList, serials[i])
+			} else {
+				writeKRLUint64(&serialRanges, serials[i])
+				writeKRLUint64(&serialRanges, serials[j])
+			}
+			i = j + 1
+		}
+		if serialList.Len() > 0 {
+			section.WriteByte(sshKRLSectionCertSerialList)
+			writeKRLString(&section, serialList.Bytes())
+		}
+		if serialRanges.Len() > 0 {
+			section.WriteByte(sshKRLSectionCertSerialRange)
+			writeKRLString(&section, serialRanges.Bytes())
+		}
+
+		if len(s.keyIDs) > 0 {
+			keyIDs := make([]string, 0, len(s.keyIDs))
+			for keyID := range s.keyIDs {
+				keyIDs = append(keyIDs, keyID)
+			}
+			sort.Strings(keyIDs)
+			var keyIDList bytes.Buffer
+			for _, keyID := range keyIDs {
+				writeKRLString(&keyIDList, []byte(keyID))
+			}
+			section.WriteByte(sshKRLSectionCertKeyID)
+			writeKRLString(&section, keyIDList.Bytes())
+		}
+
+		buf.WriteByte(sshKRLSectionCertificates)
+		writeKRLString(&buf, section.Bytes())
+	}
+
+	return buf.Bytes()
+}
+
+func writeKRLUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeKRLUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeKRLString(buf *bytes.Buffer, s []byte) {
+	writeKRLUint32(buf, uint32(len(s)))
+	buf.Write(s)
+}
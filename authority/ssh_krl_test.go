@@ -0,0 +1,307 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/db"
+)
+
+// testKRL is a decoded OpenSSH key revocation list.
+type testKRL struct {
+	Version       uint64
+	GeneratedDate uint64
+	Sections      map[string]*testKRLSection
+}
+
+type testKRLSection struct {
+	Serials []uint64
+	Ranges  [][2]uint64
+	KeyIDs  []string
+}
+
+func mustSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.FatalError(t, err)
+	return signer
+}
+
+func parseTestKRL(t *testing.T, b []byte) *testKRL {
+	t.Helper()
+	readUint32 := func(b []byte) (uint32, []byte) {
+		if len(b) < 4 {
+			t.Fatal("krl too short")
+		}
+		return binary.BigEndian.Uint32(b), b[4:]
+	}
+	readUint64 := func(b []byte) (uint64, []byte) {
+		if len(b) < 8 {
+			t.Fatal("krl too short")
+		}
+		return binary.BigEndian.Uint64(b), b[8:]
+	}
+	readString := func(b []byte) ([]byte, []byte) {
+		n, b := readUint32(b)
+		if uint32(len(b)) < n {
+			t.Fatal("krl too short")
+		}
+		return b[:n], b[n:]
+	}
+
+	if !bytes.HasPrefix(b, []byte(sshKRLMagic)) {
+		t.Fatal("krl magic not found")
+	}
+	b = b[len(sshKRLMagic):]
+	krl := &testKRL{Sections: make(map[string]*testKRLSection)}
+	formatVersion, b := readUint32(b)
+	assert.Equals(t, uint32(1), formatVersion)
+	krl.Version, b = readUint64(b)
+	krl.GeneratedDate, b = readUint64(b)
+	flags, b := readUint64(b)
+	assert.Equals(t, uint64(0), flags)
+	_, b = readString(b) // reserved
+	_, b = readString(b) // comment
+
+	for len(b) > 0 {
+		assert.Equals(t, byte(sshKRLSectionCertificates), b[0])
+		var data []byte
+		data, b = readString(b[1:])
+		caKey, data := readString(data)
+		_, data = readString(data) // reserved
+		section := new(testKRLSection)
+		for len(data) > 0 {
+			typ := data[0]
+			var sub []byte
+			sub, data = readString(data[1:])
+			for len(sub) > 0 {
+				switch typ {
+				case sshKRLSectionCertSerialList:
+					var serial uint64
+					serial, sub = readUint64(sub)
+					section.Serials = append(section.Serials, serial)
+				case sshKRLSectionCertSerialRange:
+					var lo, hi uint64
+					lo, sub = readUint64(sub)
+					hi, sub = readUint64(sub)
+					section.Ranges = append(section.Ranges, [2]uint64{lo, hi})
+				case sshKRLSectionCertKeyID:
+					var keyID []byte
+					keyID, sub = readString(sub)
+					section.KeyIDs = append(section.KeyIDs, string(keyID))
+				default:
+					t.Fatalf("unexpected krl section %x", typ)
+				}
+			}
+		}
+		krl.Sections[string(caKey)] = section
+	}
+	return krl
+}
+
+func TestAuthority_GetSSHKeyRevocationList(t *testing.T) {
+	userSigner := mustSSHSigner(t)
+	hostSigner := mustSSHSigner(t)
+	otherSigner := mustSSHSigner(t)
+	userKey := string(userSigner.PublicKey().Marshal())
+	hostKey := string(hostSigner.PublicKey().Marshal())
+	otherKey := string(otherSigner.PublicKey().Marshal())
+
+	now := time.Now().UTC()
+	revokedAt := now.Add(-time.Hour).Truncate(time.Second)
+	lastRevokedAt := now.Add(-time.Minute).Truncate(time.Second)
+	future := uint64(now.Add(time.Hour).Unix())
+	past := uint64(now.Add(-time.Minute).Unix())
+
+	certs := map[string]*ssh.Certificate{
+		"10": {Serial: 10, SignatureKey: userSigner.PublicKey(), ValidBefore: future},
+		"11": {Serial: 11, SignatureKey: userSigner.PublicKey(), ValidBefore: future},
+		"12": {Serial: 12, SignatureKey: userSigner.PublicKey(), ValidBefore: ssh.CertTimeInfinity},
+		"20": {Serial: 20, SignatureKey: userSigner.PublicKey(), ValidBefore: future},
+		"30": {Serial: 30, SignatureKey: hostSigner.PublicKey(), ValidBefore: future},
+		"40": {Serial: 40, SignatureKey: otherSigner.PublicKey(), ValidBefore: future},
+		"50": {Serial: 50, SignatureKey: userSigner.PublicKey(), ValidBefore: past},
+	}
+	revoked := []*db.RevokedCertificateInfo{
+		{Serial: "10", RevokedAt: revokedAt},
+		{Serial: "11", RevokedAt: revokedAt},
+		{Serial: "12", RevokedAt: revokedAt},
+		{Serial: "20", RevokedAt: revokedAt, KeyID: "bob@example.com"},
+		{Serial: "30", RevokedAt: revokedAt},
+		{Serial: "40", RevokedAt: lastRevokedAt},
+		{Serial: "50", RevokedAt: revokedAt},
+		{Serial: "60", RevokedAt: revokedAt},
+		{Serial: "70", RevokedAt: revokedAt, ExpiresAt: now.Add(-time.Minute)},
+		{Serial: "0", RevokedAt: revokedAt, KeyID: "alice@example.com"},
+		{Serial: "foo", RevokedAt: revokedAt},
+	}
+	newKRLDB := func() *db.MockAuthDB {
+		var stored *db.SSHKeyRevocationListInfo
+		return &db.MockAuthDB{
+			MGetRevokedSSHCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return revoked, nil
+			},
+			MGetSSHCertificate: func(serial string) (*ssh.Certificate, error) {
+				if crt, ok := certs[serial]; ok {
+					return crt, nil
+				}
+				return nil, errors.New("not found")
+			},
+			MGetSSHKRL: func() (*db.SSHKeyRevocationListInfo, error) {
+				return stored, nil
+			},
+			MStoreSSHKRL: func(krlInfo *db.SSHKeyRevocationListInfo) error {
+				stored = krlInfo
+				return nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		userKey        ssh.Signer
+		hostKey        ssh.Signer
+		db             db.AuthDB
+		want           map[string]*testKRLSection
+		wantNextUpdate time.Time
+		wantErrCode    int
+	}{
+		{"ok", userSigner, hostSigner, newKRLDB(), map[string]*testKRLSection{
+			userKey: {
+				Serials: []uint64{20, 60},
+				Ranges:  [][2]uint64{{10, 12}},
+				KeyIDs:  []string{"alice@example.com", "bob@example.com"},
+			},
+			hostKey: {
+				Serials: []uint64{30, 60},
+				KeyIDs:  []string{"alice@example.com"},
+			},
+			otherKey: {
+				Serials: []uint64{40},
+			},
+		}, time.Unix(int64(future), 0).UTC(), 0},
+		{"ok empty", userSigner, nil, &db.MockAuthDB{
+			MGetRevokedSSHCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return []*db.RevokedCertificateInfo{}, nil
+			},
+		}, map[string]*testKRLSection{}, time.Time{}, 0},
+		{"fail not configured", nil, nil, newKRLDB(), nil, time.Time{}, http.StatusNotFound},
+		{"fail db not implemented", userSigner, hostSigner, &db.SimpleDB{}, nil, time.Time{}, http.StatusNotImplemented},
+		{"fail db", userSigner, hostSigner, &db.MockAuthDB{
+			MGetRevokedSSHCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return nil, errors.New("force")
+			},
+		}, nil, time.Time{}, http.StatusInternalServerError},
+		{"fail get krl", userSigner, hostSigner, &db.MockAuthDB{
+			MGetSSHKRL: func() (*db.SSHKeyRevocationListInfo, error) {
+				return nil, errors.New("force")
+			},
+		}, nil, time.Time{}, http.StatusInternalServerError},
+		{"fail store krl", userSigner, hostSigner, &db.MockAuthDB{
+			MGetRevokedSSHCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return []*db.RevokedCertificateInfo{}, nil
+			},
+			MStoreSSHKRL: func(krlInfo *db.SSHKeyRevocationListInfo) error {
+				return errors.New("force")
+			},
+		}, nil, time.Time{}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t, WithDatabase(tt.db))
+			a.sshCAUserCertSignKey = tt.userKey
+			a.sshCAHostCertSignKey = tt.hostKey
+
+			got, err := a.GetSSHKeyRevocationList(context.Background())
+			if err != nil {
+				var sc render.StatusCodedError
+				assert.Fatal(t, errors.As(err, &sc), "error does not implement StatusCodedError interface")
+				assert.Equals(t, tt.wantErrCode, sc.StatusCode())
+				return
+			}
+			assert.Equals(t, 0, tt.wantErrCode)
+
+			krl := parseTestKRL(t, got.Data)
+			if !reflect.DeepEqual(tt.want, krl.Sections) {
+				t.Errorf("Authority.GetSSHKeyRevocationList() = %+v, want %+v", krl.Sections, tt.want)
+			}
+			assert.Equals(t, got.Version, krl.Version)
+			assert.True(t, krl.Version >= uint64(now.Unix()))
+			assert.True(t, krl.GeneratedDate >= uint64(now.Unix()))
+			assert.Equals(t, tt.wantNextUpdate, got.NextUpdate)
+		})
+	}
+}
+
+func TestAuthority_GetSSHKeyRevocationList_update(t *testing.T) {
+	signer := mustSSHSigner(t)
+	now := time.Now().UTC()
+
+	var stored *db.SSHKeyRevocationListInfo
+	var generated int
+	revoked := []*db.RevokedCertificateInfo{
+		{Serial: "10", RevokedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MGetRevokedSSHCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+			generated++
+			return revoked, nil
+		},
+		MGetSSHCertificate: func(serial string) (*ssh.Certificate, error) {
+			return nil, errors.New("not found")
+		},
+		MGetSSHKRL: func() (*db.SSHKeyRevocationListInfo, error) {
+			return stored, nil
+		},
+		MStoreSSHKRL: func(krlInfo *db.SSHKeyRevocationListInfo) error {
+			stored = krlInfo
+			return nil
+		},
+	}))
+	a.sshCAUserCertSignKey = signer
+
+	// The first request generates the list.
+	krl1, err := a.GetSSHKeyRevocationList(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, generated)
+	assert.Equals(t, []uint64{10}, parseTestKRL(t, krl1.Data).Sections[string(signer.PublicKey().Marshal())].Serials)
+
+	// The stored list is used until something changes.
+	krl2, err := a.GetSSHKeyRevocationList(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, generated)
+	assert.Equals(t, krl1, krl2)
+
+	// A revocation generates a new version.
+	revoked = append(revoked, &db.RevokedCertificateInfo{Serial: "20", RevokedAt: now})
+	assert.FatalError(t, a.GenerateSSHKeyRevocationList())
+	krl3, err := a.GetSSHKeyRevocationList(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, generated)
+	assert.True(t, krl3.Version > krl2.Version)
+	assert.Equals(t, []uint64{10, 20}, parseTestKRL(t, krl3.Data).Sections[string(signer.PublicKey().Marshal())].Serials)
+
+	// An expired certificate is removed with a new version.
+	revoked[0].ExpiresAt = now.Add(-time.Minute)
+	stored.NextUpdate = now.Add(-time.Minute)
+	krl4, err := a.GetSSHKeyRevocationList(context.Background())
+	assert.FatalError(t, err)
+	assert.Equals(t, 3, generated)
+	assert.True(t, krl4.Version > krl3.Version)
+	assert.Equals(t, time.Time{}, krl4.NextUpdate)
+	assert.Equals(t, []uint64{20}, parseTestKRL(t, krl4.Data).Sections[string(signer.PublicKey().Marshal())].Serials)
+}
@@ -0,0 +1,322 @@
+package authority
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.step.sm/crypto/randutil"
+	"go.step.sm/crypto/sshutil"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql"
+)
+
+// CreateSSHStepUpRequest stores a request for additional principals in an
+// SSH user certificate. The given certificate must be the one just signed
+// using the given sign options, it is used as the template of the
+// certificate issued once the request is approved by an administrator.
+func (a *Authority) CreateSSHStepUpRequest(ctx context.Context, cert *ssh.Certificate, principals []string, justification string, signOpts ...provisioner.SignOption) (*db.SSHStepUpRequest, error) {
+	if cert.CertType != ssh.UserCert {
+		return nil, errs.BadRequest("ssh step-up requests are only supported for user certificates")
+	}
+	if justification == "" {
+		return nil, errs.BadRequest("ssh step-up requests require a justification")
+	}
+
+	var prov provisioner.Interface
+	var stepUp *provisioner.SSHStepUpOptions
+	var permissions []*policy.SSHPermissionsOptions
+	for _, op := range signOpts {
+		switch o := op.(type) {
+		case provisioner.Interface:
+			prov = o
+		case provisioner.SSHStepUpOption:
+			stepUp = o.Options
+		case provisioner.SSHPermissionsOption:
+			permissions = append(permissions, o.Options)
+		}
+	}
+	if prov == nil || stepUp == nil {
+		return nil, errs.Forbidden("ssh step-up requests are not enabled for this provisioner")
+	}
+	if err := stepUp.Allow(principals); err != nil {
+		return nil, errs.ForbiddenErr(err, err.Error())
+	}
+
+	// Apply the provisioner and authority policies for critical options and
+	// extensions. They are applied now, as the values of the sign request are
+	// not available when the certificate is signed, and the result is stored
+	// in the request.
+	certTpl := newSSHStepUpTemplate(cert, principals, nil, time.Now(), 0, stepUp.GetDuration())
+	permissions = append(permissions, a.config.AuthorityConfig.Policy.GetSSHOptions().GetPermissions())
+	if err := applySSHPermissions(ctx, certTpl, permissions); err != nil {
+		return nil, errs.ForbiddenErr(err, "error applying ssh certificate permissions policy")
+	}
+
+	// Check the authority policy before storing the request.
+	if err := a.isAllowedToSignSSHCertificate(certTpl); err != nil {
+		var ee *errs.Error
+		if errors.As(err, &ee) {
+			return nil, ee
+		}
+		return nil, errs.InternalServerErr(err,
+			errs.WithMessage("authority.CreateSSHStepUpRequest: error creating ssh step-up request"),
+		)
+	}
+
+	requestDB, ok := a.db.(db.SSHStepUpRequestDB)
+	if !ok {
+		return nil, errs.NotImplemented("authority.CreateSSHStepUpRequest; database does not support ssh step-up requests")
+	}
+
+	id, err := randutil.Alphanumeric(32)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.CreateSSHStepUpRequest")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	req := &db.SSHStepUpRequest{
+		ID:            id,
+		Provisioner:   prov.GetName(),
+		KeyID:         cert.KeyId,
+		Principals:    principals,
+		Justification: justification,
+		Certificate:   cert.Marshal(),
+		Permissions:   &certTpl.Permissions,
+		Duration:      stepUp.GetDuration(),
+		Status:        db.SSHStepUpRequestPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ExpiresAt:     time.Unix(int64(cert.ValidBefore), 0).UTC(),
+	}
+	if err := requestDB.CreateSSHStepUpRequest(req); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.CreateSSHStepUpRequest: error storing ssh step-up request")
+	}
+
+	return req, nil
+}
+
+// PollSSHStepUpRequest returns the SSH step-up request with the given ID and,
+// if it has been approved, the SSH user certificate with the additional
+// principals. The certificate is signed the first time the requester polls
+// for an approved request, and the same certificate is returned afterwards.
+func (a *Authority) PollSSHStepUpRequest(ctx context.Context, id string) (*db.SSHStepUpRequest, *ssh.Certificate, error) {
+	requestDB, ok := a.db.(db.SSHStepUpRequestDB)
+	if !ok {
+		return nil, nil, errs.NotImplemented("authority.PollSSHStepUpRequest; database does not support ssh step-up requests")
+	}
+
+	req, err := requestDB.GetSSHStepUpRequest(id)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, errs.NotFound("ssh step-up request %s not found", id)
+	case err != nil:
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest")
+	}
+
+	now := time.Now()
+	switch req.Status {
+	case db.SSHStepUpRequestPending:
+		if now.After(req.ExpiresAt) {
+			return nil, nil, errs.Forbidden("ssh step-up request %s has expired", id)
+		}
+		return req, nil, nil
+	case db.SSHStepUpRequestIssuing:
+		// The certificate is being signed by a concurrent request.
+		return req, nil, nil
+	case db.SSHStepUpRequestRejected:
+		return nil, nil, errs.Forbidden("ssh step-up request %s has been rejected", id)
+	case db.SSHStepUpRequestIssued:
+		cert, err := parseSSHCertificate(req.IssuedCertificate)
+		if err != nil {
+			return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest: error parsing issued certificate")
+		}
+		return req, cert, nil
+	case db.SSHStepUpRequestApproved:
+		if now.After(req.ExpiresAt) {
+			return nil, nil, errs.Forbidden("ssh step-up request %s has expired", id)
+		}
+	default:
+		return nil, nil, errs.InternalServer("authority.PollSSHStepUpRequest: unexpected ssh step-up request status %s", req.Status)
+	}
+
+	// Claim the request, so only one poll signs the certificate.
+	issuing := *req
+	issuing.Status = db.SSHStepUpRequestIssuing
+	issuing.UpdatedAt = now.UTC().Truncate(time.Second)
+	switch err := requestDB.UpdateSSHStepUpRequest(&issuing, db.SSHStepUpRequestApproved); {
+	case errors.Is(err, db.ErrAlreadyExists):
+		// The request has been claimed by a concurrent request.
+		return a.PollSSHStepUpRequest(ctx, id)
+	case err != nil:
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest: error updating ssh step-up request")
+	}
+
+	cert, err := a.signSSHStepUpRequest(ctx, req, now)
+	if err != nil {
+		// Release the request so it can be signed in another poll.
+		approved := issuing
+		approved.Status = db.SSHStepUpRequestApproved
+		if uerr := requestDB.UpdateSSHStepUpRequest(&approved, db.SSHStepUpRequestIssuing); uerr != nil {
+			return nil, nil, errs.Wrap(http.StatusInternalServerError, uerr, "authority.PollSSHStepUpRequest: error releasing ssh step-up request")
+		}
+		return nil, nil, err
+	}
+
+	issued := issuing
+	issued.Status = db.SSHStepUpRequestIssued
+	issued.SerialNumber = strconv.FormatUint(cert.Serial, 10)
+	issued.IssuedCertificate = cert.Marshal()
+	if err := requestDB.UpdateSSHStepUpRequest(&issued, db.SSHStepUpRequestIssuing); err != nil {
+		return nil, nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest: error updating ssh step-up request")
+	}
+
+	return &issued, cert, nil
+}
+
+// signSSHStepUpRequest signs a new SSH user certificate using the certificate
+// in the request as a template and adding the requested principals.
+func (a *Authority) signSSHStepUpRequest(ctx context.Context, req *db.SSHStepUpRequest, now time.Time) (*ssh.Certificate, error) {
+	if a.sshCAUserCertSignKey == nil {
+		return nil, errs.NotImplemented("authority.PollSSHStepUpRequest: user certificate signing is not enabled")
+	}
+
+	parent, err := parseSSHCertificate(req.Certificate)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest: error parsing request certificate")
+	}
+	if err := a.authorizeSSHCertificate(ctx, parent); err != nil {
+		return nil, err
+	}
+
+	prov, err := a.LoadProvisionerByName(req.Provisioner)
+	if err != nil {
+		return nil, errs.ForbiddenErr(err, "provisioner %s not found", req.Provisioner)
+	}
+	authorizer, ok := prov.(provisioner.SSHStepUpAuthorizer)
+	if !ok {
+		return nil, errs.Forbidden("ssh step-up requests are not enabled for provisioner %s", req.Provisioner)
+	}
+	signOpts, err := authorizer.AuthorizeSSHStepUp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provisioner options may have changed since the request was
+	// created, check them again.
+	var validators []provisioner.SSHCertValidator
+	for _, op := range signOpts {
+		switch o := op.(type) {
+		case provisioner.SSHCertValidator:
+			validators = append(validators, o)
+		case provisioner.SSHStepUpOption:
+			if err := o.Options.Allow(req.Principals); err != nil {
+				return nil, errs.ForbiddenErr(err, err.Error())
+			}
+		}
+	}
+
+	backdate := a.config.AuthorityConfig.Backdate.Duration
+	certTpl := newSSHStepUpTemplate(parent, req.Principals, req.Permissions, now, backdate, req.Duration)
+
+	// Check if authority is allowed to sign the certificate
+	if err := a.isAllowedToSignSSHCertificate(certTpl); err != nil {
+		var ee *errs.Error
+		if errors.As(err, &ee) {
+			return nil, ee
+		}
+		return nil, errs.InternalServerErr(err,
+			errs.WithMessage("authority.PollSSHStepUpRequest: error creating ssh certificate"),
+		)
+	}
+
+	cert, err := sshutil.CreateCertificate(certTpl, a.sshCAUserCertSignKey)
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest: error signing certificate")
+	}
+
+	// User provisioners validators.
+	opts := provisioner.SignSSHOptions{
+		CertType:   provisioner.SSHUserCert,
+		KeyID:      cert.KeyId,
+		Principals: cert.ValidPrincipals,
+		Backdate:   backdate,
+	}
+	for _, v := range validators {
+		if err := v.Valid(cert, opts); err != nil {
+			return nil, errs.ForbiddenErr(err, "error validating ssh certificate")
+		}
+	}
+
+	if err := a.storeRenewedSSHCertificate(prov, parent, cert); err != nil && !errors.Is(err, db.ErrNotImplemented) {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.PollSSHStepUpRequest: error storing certificate in db")
+	}
+
+	return cert, nil
+}
+
+// newSSHStepUpTemplate returns the template of a step-up certificate. It
+// copies the key and key ID of the parent certificate and adds the given
+// principals to the ones in it. If the permissions are not given, the ones in
+// the parent certificate are used.
+func newSSHStepUpTemplate(parent *ssh.Certificate, principals []string, permissions *ssh.Permissions, now time.Time, backdate, duration time.Duration) *ssh.Certificate {
+	if permissions == nil {
+		permissions = &parent.Permissions
+	}
+	validPrincipals := append([]string{}, parent.ValidPrincipals...)
+	for _, p := range principals {
+		if !containsString(validPrincipals, p) {
+			validPrincipals = append(validPrincipals, p)
+		}
+	}
+
+	// Nonce and serial will be automatically generated on signing.
+	return &ssh.Certificate{
+		Key:             parent.Key,
+		CertType:        ssh.UserCert,
+		KeyId:           parent.KeyId,
+		ValidPrincipals: validPrincipals,
+		Permissions:     copySSHPermissions(*permissions),
+		Reserved:        parent.Reserved,
+		ValidAfter:      uint64(now.Add(-backdate).Unix()),
+		ValidBefore:     uint64(now.Add(duration).Unix()),
+	}
+}
+
+// copySSHPermissions returns a copy of the given permissions, so the policies
+// applied to a template do not modify the certificate it is created from.
+func copySSHPermissions(p ssh.Permissions) ssh.Permissions {
+	var c ssh.Permissions
+	if p.CriticalOptions != nil {
+		c.CriticalOptions = make(map[string]string, len(p.CriticalOptions))
+		for k, v := range p.CriticalOptions {
+			c.CriticalOptions[k] = v
+		}
+	}
+	if p.Extensions != nil {
+		c.Extensions = make(map[string]string, len(p.Extensions))
+		for k, v := range p.Extensions {
+			c.Extensions[k] = v
+		}
+	}
+	return c
+}
+
+func parseSSHCertificate(b []byte) (*ssh.Certificate, error) {
+	pub, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("public key is not an ssh certificate")
+	}
+	return cert, nil
+}
@@ -0,0 +1,379 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/policy"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/nosql/database"
+)
+
+// newSSHStepUpCertificate returns a user certificate signed by the given
+// signer, valid until the given time.
+func newSSHStepUpCertificate(t *testing.T, signer ssh.Signer, certType uint32, validBefore time.Time) *ssh.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          1234,
+		CertType:        certType,
+		KeyId:           "jane@example.com",
+		ValidPrincipals: []string{"jane"},
+		ValidAfter:      uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(validBefore.Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{"permit-pty": ""},
+		},
+	}
+	assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+	return cert
+}
+
+func TestAuthority_CreateSSHStepUpRequest(t *testing.T) {
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	validBefore := time.Now().Add(time.Hour).Truncate(time.Second)
+	userCert := newSSHStepUpCertificate(t, signer, ssh.UserCert, validBefore)
+	hostCert := newSSHStepUpCertificate(t, signer, ssh.HostCert, validBefore)
+
+	prov := &provisioner.JWK{Name: "step-cli"}
+	stepUp := provisioner.SSHStepUpOption{Options: &provisioner.SSHStepUpOptions{
+		Principals: []string{"root", "admin"},
+		Duration:   &provisioner.Duration{Duration: 15 * time.Minute},
+	}}
+	empty := ""
+	permissions := provisioner.SSHPermissionsOption{Options: &policy.SSHPermissionsOptions{
+		Extensions: map[string]*policy.SSHPermissionOptions{
+			"permit-pty":              {Forbidden: true},
+			"permit-agent-forwarding": {Default: &empty},
+		},
+	}}
+	requiredPermissions := provisioner.SSHPermissionsOption{Options: &policy.SSHPermissionsOptions{
+		CriticalOptions: map[string]*policy.SSHPermissionOptions{
+			"force-command": {Required: true},
+		},
+	}}
+
+	tests := []struct {
+		name          string
+		authDB        db.AuthDB
+		cert          *ssh.Certificate
+		principals    []string
+		justification string
+		signOpts      []provisioner.SignOption
+		want          *db.SSHStepUpRequest
+		statusCode    int
+	}{
+		{"ok", &db.MockAuthDB{}, userCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, stepUp}, &db.SSHStepUpRequest{
+			Provisioner:   "step-cli",
+			KeyID:         "jane@example.com",
+			Principals:    []string{"root"},
+			Justification: "incident 1234",
+			Certificate:   userCert.Marshal(),
+			Permissions:   &ssh.Permissions{Extensions: map[string]string{"permit-pty": ""}},
+			Duration:      15 * time.Minute,
+			Status:        db.SSHStepUpRequestPending,
+			ExpiresAt:     validBefore.UTC(),
+		}, 0},
+		{"ok/permissions", &db.MockAuthDB{}, userCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, stepUp, permissions}, &db.SSHStepUpRequest{
+			Provisioner:   "step-cli",
+			KeyID:         "jane@example.com",
+			Principals:    []string{"root"},
+			Justification: "incident 1234",
+			Certificate:   userCert.Marshal(),
+			Permissions:   &ssh.Permissions{Extensions: map[string]string{"permit-agent-forwarding": ""}},
+			Duration:      15 * time.Minute,
+			Status:        db.SSHStepUpRequestPending,
+			ExpiresAt:     validBefore.UTC(),
+		}, 0},
+		{"fail/permissions", &db.MockAuthDB{}, userCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, stepUp, requiredPermissions}, nil, http.StatusForbidden},
+		{"fail/host certificate", &db.MockAuthDB{}, hostCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, stepUp}, nil, http.StatusBadRequest},
+		{"fail/justification", &db.MockAuthDB{}, userCert, []string{"root"}, "", []provisioner.SignOption{prov, stepUp}, nil, http.StatusBadRequest},
+		{"fail/not enabled", &db.MockAuthDB{}, userCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, provisioner.SSHStepUpOption{}}, nil, http.StatusForbidden},
+		{"fail/principal", &db.MockAuthDB{}, userCert, []string{"root", "other"}, "incident 1234", []provisioner.SignOption{prov, stepUp}, nil, http.StatusForbidden},
+		{"fail/not implemented", &db.SimpleDB{}, userCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, stepUp}, nil, http.StatusNotImplemented},
+		{"fail/db", &db.MockAuthDB{Err: errors.New("force")}, userCert, []string{"root"}, "incident 1234", []provisioner.SignOption{prov, stepUp}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.db = tt.authDB
+
+			got, err := a.CreateSSHStepUpRequest(context.Background(), tt.cert, tt.principals, tt.justification, tt.signOpts...)
+			if tt.statusCode != 0 {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc), "error does not implement StatusCodedError interface") {
+					assert.Equals(t, tt.statusCode, sc.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Len(t, 32, got.ID)
+			assert.False(t, got.CreatedAt.IsZero())
+			assert.Equals(t, got.CreatedAt, got.UpdatedAt)
+			got.ID, got.CreatedAt, got.UpdatedAt = "", time.Time{}, time.Time{}
+			assert.Equals(t, tt.want, got)
+			// The policies are not applied to the regular certificate.
+			assert.Equals(t, map[string]string{"permit-pty": ""}, tt.cert.Extensions)
+		})
+	}
+}
+
+func TestAuthority_PollSSHStepUpRequest(t *testing.T) {
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	parent := newSSHStepUpCertificate(t, signer, ssh.UserCert, now.Add(time.Hour))
+	issuedCert := *parent
+	issuedCert.Serial = 5678
+	issuedCert.ValidPrincipals = []string{"jane", "root"}
+	issuedCert.ValidBefore = uint64(now.Add(15 * time.Minute).Unix())
+	assert.FatalError(t, issuedCert.SignCert(rand.Reader, signer))
+	newRequest := func(status db.SSHStepUpRequestStatus, expiresAt time.Time) *db.SSHStepUpRequest {
+		req := &db.SSHStepUpRequest{
+			ID:            "id",
+			Provisioner:   "step-cli",
+			KeyID:         "jane@example.com",
+			Principals:    []string{"root"},
+			Justification: "incident 1234",
+			Certificate:   parent.Marshal(),
+			Duration:      15 * time.Minute,
+			Status:        status,
+			ExpiresAt:     expiresAt,
+		}
+		if status == db.SSHStepUpRequestIssued {
+			req.SerialNumber = "1234"
+			req.IssuedCertificate = issuedCert.Marshal()
+		}
+		return req
+	}
+	isNotRevoked := func(sn string) (bool, error) {
+		return false, nil
+	}
+	stepUp := &provisioner.SSHStepUpOptions{
+		Principals: []string{"root"},
+		Duration:   &provisioner.Duration{Duration: 15 * time.Minute},
+	}
+
+	tests := []struct {
+		name       string
+		authDB     db.AuthDB
+		wantStatus db.SSHStepUpRequestStatus
+		wantCert   bool
+		statusCode int
+		options    *provisioner.Options
+	}{
+		{"ok/pending", &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestPending, now.Add(time.Hour))}, db.SSHStepUpRequestPending, false, 0, nil},
+		{"ok/issued", &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestIssued, now.Add(time.Hour))}, db.SSHStepUpRequestIssued, true, 0, nil},
+		{"ok/issuing", &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestIssuing, now.Add(time.Hour))}, db.SSHStepUpRequestIssuing, false, 0, nil},
+		{"ok/approved", &db.MockAuthDB{
+			Ret1:          newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func() func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				var claimed bool
+				return func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+					if !claimed {
+						// The request is claimed before signing.
+						claimed = true
+						assert.Equals(t, db.SSHStepUpRequestApproved, status)
+						assert.Equals(t, db.SSHStepUpRequestIssuing, req.Status)
+						assert.Nil(t, req.IssuedCertificate)
+						return nil
+					}
+					assert.Equals(t, db.SSHStepUpRequestIssuing, status)
+					assert.Equals(t, db.SSHStepUpRequestIssued, req.Status)
+					assert.NotEquals(t, "", req.SerialNumber)
+					assert.NotNil(t, req.IssuedCertificate)
+					return nil
+				}
+			}(),
+		}, db.SSHStepUpRequestIssued, true, 0, nil},
+		{"ok/approved concurrent", &db.MockAuthDB{
+			MGetSSHStepUpRequest: func() func(id string) (*db.SSHStepUpRequest, error) {
+				var polled bool
+				return func(id string) (*db.SSHStepUpRequest, error) {
+					if polled {
+						return newRequest(db.SSHStepUpRequestIssued, now.Add(time.Hour)), nil
+					}
+					polled = true
+					return newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)), nil
+				}
+			}(),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				return db.ErrAlreadyExists
+			},
+		}, db.SSHStepUpRequestIssued, true, 0, nil},
+		{"fail/not implemented", &db.SimpleDB{}, "", false, http.StatusNotImplemented, nil},
+		{"fail/not found", &db.MockAuthDB{Err: database.ErrNotFound}, "", false, http.StatusNotFound, nil},
+		{"fail/db", &db.MockAuthDB{Err: errors.New("force")}, "", false, http.StatusInternalServerError, nil},
+		{"fail/pending expired", &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestPending, now.Add(-time.Minute))}, "", false, http.StatusForbidden, nil},
+		{"fail/rejected", &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestRejected, now.Add(time.Hour))}, "", false, http.StatusForbidden, nil},
+		{"fail/approved expired", &db.MockAuthDB{Ret1: newRequest(db.SSHStepUpRequestApproved, now.Add(-time.Minute))}, "", false, http.StatusForbidden, nil},
+		{"fail/approved revoked", &db.MockAuthDB{
+			Ret1: newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: func(sn string) (bool, error) {
+				assert.Equals(t, "1234", sn)
+				return true, nil
+			},
+			MUpdateSSHStepUpRequest: func() func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				var claimed bool
+				return func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+					if !claimed {
+						claimed = true
+						return nil
+					}
+					// The request is released after a signing error.
+					assert.Equals(t, db.SSHStepUpRequestIssuing, status)
+					assert.Equals(t, db.SSHStepUpRequestApproved, req.Status)
+					return nil
+				}
+			}(),
+		}, "", false, http.StatusUnauthorized, nil},
+		{"fail/approved release", &db.MockAuthDB{
+			Ret1: newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: func(sn string) (bool, error) {
+				return true, nil
+			},
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				if req.Status == db.SSHStepUpRequestApproved {
+					return errors.New("force")
+				}
+				return nil
+			},
+		}, "", false, http.StatusInternalServerError, nil},
+		{"fail/approved provisioner", &db.MockAuthDB{
+			MGetSSHStepUpRequest: func(id string) (*db.SSHStepUpRequest, error) {
+				req := newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour))
+				req.Provisioner = "missing"
+				return req, nil
+			},
+			MIsSSHRevoked: isNotRevoked,
+		}, "", false, http.StatusForbidden, nil},
+		{"ok/approved permissions", &db.MockAuthDB{
+			MGetSSHStepUpRequest: func(id string) (*db.SSHStepUpRequest, error) {
+				req := newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour))
+				req.Permissions = &ssh.Permissions{Extensions: map[string]string{"permit-agent-forwarding": ""}}
+				return req, nil
+			},
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				return nil
+			},
+		}, db.SSHStepUpRequestIssued, true, 0, nil},
+		{"fail/approved not enabled", &db.MockAuthDB{
+			Ret1:          newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				return nil
+			},
+		}, "", false, http.StatusForbidden, &provisioner.Options{}},
+		{"fail/approved principal", &db.MockAuthDB{
+			Ret1:          newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				return nil
+			},
+		}, "", false, http.StatusForbidden, &provisioner.Options{SSH: &provisioner.SSHOptions{
+			StepUp: &provisioner.SSHStepUpOptions{Principals: []string{"admin"}},
+		}}},
+		{"fail/approved policy", &db.MockAuthDB{
+			Ret1:          newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				return nil
+			},
+		}, "", false, http.StatusForbidden, &provisioner.Options{SSH: &provisioner.SSHOptions{
+			StepUp: stepUp,
+			User: &policy.SSHUserCertificateOptions{
+				DeniedNames: &policy.SSHNameOptions{Principals: []string{"root"}},
+			},
+		}}},
+		{"fail/approved update", &db.MockAuthDB{
+			Ret1:          newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				return errors.New("force")
+			},
+		}, "", false, http.StatusInternalServerError, nil},
+		{"fail/approved issued update", &db.MockAuthDB{
+			Ret1:          newRequest(db.SSHStepUpRequestApproved, now.Add(time.Hour)),
+			MIsSSHRevoked: isNotRevoked,
+			MUpdateSSHStepUpRequest: func(req *db.SSHStepUpRequest, status db.SSHStepUpRequestStatus) error {
+				if req.Status == db.SSHStepUpRequestIssued {
+					return errors.New("force")
+				}
+				return nil
+			},
+		}, "", false, http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.db = tt.authDB
+			a.sshCAUserCertSignKey = signer
+
+			// Enable the step-up requests in the provisioner.
+			p, err := a.LoadProvisionerByName("step-cli")
+			assert.FatalError(t, err)
+			jwk := p.(*provisioner.JWK)
+			jwk.Options = tt.options
+			if jwk.Options == nil {
+				jwk.Options = &provisioner.Options{SSH: &provisioner.SSHOptions{StepUp: stepUp}}
+			}
+			config, err := a.generateProvisionerConfig(context.Background())
+			assert.FatalError(t, err)
+			assert.FatalError(t, jwk.Init(config))
+
+			req, cert, err := a.PollSSHStepUpRequest(context.Background(), "id")
+			if tt.statusCode != 0 {
+				// Policy errors are converted to an errs.Error using errors.As.
+				var ee *errs.Error
+				if assert.True(t, errors.As(err, &ee), "error cannot be converted to errs.Error") {
+					assert.Equals(t, tt.statusCode, ee.StatusCode())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantStatus, req.Status)
+			if !tt.wantCert {
+				assert.Nil(t, cert)
+				return
+			}
+			if assert.NotNil(t, cert) {
+				assert.Equals(t, parent.Key.Marshal(), cert.Key.Marshal())
+				assert.Equals(t, uint32(ssh.UserCert), cert.CertType)
+				assert.Equals(t, "jane@example.com", cert.KeyId)
+				assert.Equals(t, []string{"jane", "root"}, cert.ValidPrincipals)
+				permissions := parent.Permissions
+				if req.Permissions != nil {
+					permissions = *req.Permissions
+				}
+				assert.Equals(t, permissions.Extensions, cert.Extensions)
+				assert.True(t, cert.ValidBefore <= uint64(time.Now().Add(15*time.Minute).Unix()))
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -20,6 +21,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
@@ -89,6 +91,29 @@ func (m sshTestOptionsModifier) Modify(cert *ssh.Certificate, opts provisioner.S
 	return errors.New(string(m))
 }
 
+// sshTestPrincipalsValidator only allows the given principals in the request.
+type sshTestPrincipalsValidator []string
+
+func (v sshTestPrincipalsValidator) Valid(opts provisioner.SignSSHOptions) error {
+	for _, p := range opts.Principals {
+		if !containsString(v, p) {
+			return fmt.Errorf("principal %s is not allowed", p)
+		}
+	}
+	return nil
+}
+
+// sshTestDefaultPrincipalsModifier sets the given principals if the
+// certificate does not have any.
+type sshTestDefaultPrincipalsModifier []string
+
+func (m sshTestDefaultPrincipalsModifier) Modify(cert *ssh.Certificate, _ provisioner.SignSSHOptions) error {
+	if len(cert.ValidPrincipals) == 0 {
+		cert.ValidPrincipals = m
+	}
+	return nil
+}
+
 func TestAuthority_initHostOnly(t *testing.T) {
 	auth := testAuthority(t, func(a *Authority) error {
 		a.config.SSH.UserKey = ""
@@ -303,6 +328,265 @@ func TestAuthority_SignSSH(t *testing.T) {
 	}
 }
 
+func TestAuthority_SignSSH_hostTags(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}))
+	assert.FatalError(t, err)
+	hostTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.HostCert, "key-id", []string{"web2"}))
+	assert.FatalError(t, err)
+	// The admin template uses the principals in the request.
+	requestTemplate, err := provisioner.CustomSSHTemplateOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}), sshutil.DefaultAdminTemplate)
+	assert.FatalError(t, err)
+
+	hosts := []*admin.SSHHost{
+		{ID: "1", Hostname: "web1", Tags: []admin.SSHHostTag{{Name: "env", Value: "prod"}, {Name: "role", Value: "web"}}},
+		{ID: "2", Hostname: "web2", Tags: []admin.SSHHostTag{{Name: "env", Value: "dev"}, {Name: "role", Value: "web"}}},
+		{ID: "3", Hostname: "db1", Tags: []admin.SSHHostTag{{Name: "env", Value: "prod"}, {Name: "role", Value: "db"}}},
+	}
+	inventory := &admin.MockDB{
+		MockGetSSHHosts: func(ctx context.Context) ([]*admin.SSHHost, error) {
+			return hosts, nil
+		},
+		MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+			for _, h := range hosts {
+				if strings.EqualFold(h.Hostname, hostname) {
+					return h, nil
+				}
+			}
+			return nil, admin.NewError(admin.ErrorNotFoundType, "ssh host %s not found", hostname)
+		},
+	}
+	failInventory := &admin.MockDB{
+		MockError: errors.New("force"),
+	}
+	failHostnameInventory := &admin.MockDB{
+		MockGetSSHHostByHostname: func(ctx context.Context, hostname string) (*admin.SSHHost, error) {
+			return nil, errors.New("force")
+		},
+	}
+
+	tests := []struct {
+		name     string
+		adminDB  admin.DB
+		opts     provisioner.SignSSHOptions
+		signOpts []provisioner.SignOption
+		want     []string
+		wantErr  bool
+	}{
+		{"ok/no tags", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "web2"}}, []provisioner.SignOption{userTemplate}, []string{"user"}, false},
+		{"ok/default principals", inventory, provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, []string{"user", "web1", "db1"}, false},
+		{"ok/default principals multiple tags", inventory, provisioner.SignSSHOptions{}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"role=db"}, provisioner.SSHHostTagsOption{"env=dev"}}, []string{"user", "web2", "db1"}, false},
+		{"ok/no entitled hosts", inventory, provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{}}, []string{"user"}, false},
+		{"ok/requested host", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "web1"}}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"role=web"}}, []string{"user", "web1"}, false},
+		{"ok/requested principal not in inventory", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "other"}}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"role=web"}}, []string{"user"}, false},
+		{"ok/requested host case", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "WEB2"}}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, []string{"user"}, false},
+		{"ok/requested host validated", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "web1"}}, []provisioner.SignOption{userTemplate, sshTestPrincipalsValidator{"user", "web1"}, provisioner.SSHHostTagsOption{"role=web"}}, []string{"user", "web1"}, false},
+		{"ok/default principals validated", inventory, provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, sshTestPrincipalsValidator{"web1", "db1"}, provisioner.SSHHostTagsOption{"env=prod"}}, []string{"user", "web1", "db1"}, false},
+		{"ok/only requested hosts", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"web1"}}, []provisioner.SignOption{requestTemplate, sshTestPrincipalsValidator{"user", "web1"}, sshTestDefaultPrincipalsModifier{"user"}, provisioner.SSHHostTagsOption{"role=web"}}, []string{"web1"}, false},
+		{"ok/host names without tags", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"web2"}}, []provisioner.SignOption{requestTemplate, sshTestPrincipalsValidator{"web2"}}, []string{"web2"}, false},
+		{"ok/host certificate", nil, provisioner.SignSSHOptions{CertType: "host", Principals: []string{"web2"}}, []provisioner.SignOption{hostTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, []string{"web2"}, false},
+		{"fail/requested host", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "web2"}}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, nil, true},
+		{"fail/requested host not validated", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"user", "web1"}}, []provisioner.SignOption{userTemplate, sshTestPrincipalsValidator{"user"}, provisioner.SSHHostTagsOption{"role=web"}}, nil, true},
+		{"fail/default principals not validated", inventory, provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, sshTestPrincipalsValidator{"web1"}, provisioner.SSHHostTagsOption{"env=prod"}}, nil, true},
+		{"fail/host names without tags", inventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"web2"}}, []provisioner.SignOption{requestTemplate, sshTestPrincipalsValidator{"user"}}, nil, true},
+		{"fail/no inventory", nil, provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, nil, true},
+		{"fail/inventory", failInventory, provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, nil, true},
+		{"fail/inventory hostname", failHostnameInventory, provisioner.SignSSHOptions{CertType: "user", Principals: []string{"web1"}}, []provisioner.SignOption{userTemplate, provisioner.SSHHostTagsOption{"env=prod"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.sshCAUserCertSignKey = signer
+			a.sshCAHostCertSignKey = signer
+			a.adminDB = tt.adminDB
+
+			got, err := a.SignSSH(context.Background(), pub, tt.opts, tt.signOpts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.SignSSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equals(t, tt.want, got.ValidPrincipals)
+			}
+		})
+	}
+}
+
+func TestAuthority_SignSSH_permissions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	assert.FatalError(t, err)
+	token, err := jose.Signed(sig).Claims(map[string]interface{}{
+		"sub":        "user",
+		"source_ips": []string{"10.0.0.0/8", "192.168.1.1"},
+	}).CompactSerialize()
+	assert.FatalError(t, err)
+
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}))
+	assert.FatalError(t, err)
+	hostTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.HostCert, "key-id", []string{"host"}))
+	assert.FatalError(t, err)
+
+	command := "/bin/true"
+	permissions := func(critical, extensions map[string]*policy.SSHPermissionOptions) *policy.SSHPermissionsOptions {
+		return &policy.SSHPermissionsOptions{CriticalOptions: critical, Extensions: extensions}
+	}
+	ctx := provisioner.NewContextWithRemoteAddress(context.Background(), "127.0.0.1")
+	ctx = provisioner.NewContextWithToken(ctx, token)
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		authority      *policy.SSHPermissionsOptions
+		provisioner    *policy.SSHPermissionsOptions
+		opts           provisioner.SignSSHOptions
+		template       provisioner.SignOption
+		wantCritical   map[string]string
+		wantExtensions map[string]string
+		wantErr        bool
+	}{
+		{"ok/no policy", ctx, nil, nil, provisioner.SignSSHOptions{CertType: "user"}, userTemplate, nil, map[string]string{
+			"permit-X11-forwarding": "", "permit-agent-forwarding": "", "permit-port-forwarding": "", "permit-pty": "", "permit-user-rc": "",
+		}, false},
+		{"ok/remote address", ctx, permissions(map[string]*policy.SSHPermissionOptions{
+			"source-address": {Required: true, FromRemoteAddress: true},
+		}, nil), nil, provisioner.SignSSHOptions{CertType: "user"}, userTemplate, map[string]string{"source-address": "127.0.0.1"}, map[string]string{
+			"permit-X11-forwarding": "", "permit-agent-forwarding": "", "permit-port-forwarding": "", "permit-pty": "", "permit-user-rc": "",
+		}, false},
+		{"ok/claim", ctx, nil, permissions(map[string]*policy.SSHPermissionOptions{
+			"source-address": {Required: true, FromClaim: "source_ips"},
+		}, nil), provisioner.SignSSHOptions{CertType: "user"}, userTemplate, map[string]string{"source-address": "10.0.0.0/8,192.168.1.1"}, map[string]string{
+			"permit-X11-forwarding": "", "permit-agent-forwarding": "", "permit-port-forwarding": "", "permit-pty": "", "permit-user-rc": "",
+		}, false},
+		{"ok/provisioner and authority", ctx, permissions(map[string]*policy.SSHPermissionOptions{
+			"source-address": {FromRemoteAddress: true},
+		}, map[string]*policy.SSHPermissionOptions{
+			"permit-port-forwarding": {Forbidden: true},
+		}), permissions(map[string]*policy.SSHPermissionOptions{
+			"force-command": {Default: &command},
+		}, map[string]*policy.SSHPermissionOptions{
+			"permit-X11-forwarding": {Forbidden: true},
+		}), provisioner.SignSSHOptions{CertType: "user"}, userTemplate, map[string]string{"source-address": "127.0.0.1", "force-command": "/bin/true"}, map[string]string{
+			"permit-agent-forwarding": "", "permit-pty": "", "permit-user-rc": "",
+		}, false},
+		{"ok/host certificate", ctx, permissions(map[string]*policy.SSHPermissionOptions{
+			"source-address": {Required: true},
+		}, nil), nil, provisioner.SignSSHOptions{CertType: "host"}, hostTemplate, nil, nil, false},
+		{"fail/required", context.Background(), permissions(map[string]*policy.SSHPermissionOptions{
+			"source-address": {Required: true, FromRemoteAddress: true},
+		}, nil), nil, provisioner.SignSSHOptions{CertType: "user"}, userTemplate, nil, nil, true},
+		{"fail/provisioner values", ctx, nil, permissions(nil, map[string]*policy.SSHPermissionOptions{
+			"permit-pty": {Values: []string{"yes"}},
+		}), provisioner.SignSSHOptions{CertType: "user"}, userTemplate, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.sshCAUserCertSignKey = signer
+			a.sshCAHostCertSignKey = signer
+			a.config.AuthorityConfig.Policy = &policy.Options{
+				SSH: &policy.SSHPolicyOptions{Permissions: tt.authority},
+			}
+
+			got, err := a.SignSSH(tt.ctx, pub, tt.opts, tt.template, provisioner.SSHPermissionsOption{Options: tt.provisioner})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.SignSSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equals(t, tt.wantCritical, got.CriticalOptions)
+				assert.Equals(t, tt.wantExtensions, got.Extensions)
+			} else {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc)) {
+					assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_SignSSH_hostKeyAttestation(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(key)
+	assert.FatalError(t, err)
+	pub := hostSigner.PublicKey()
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(signKey)
+	assert.FatalError(t, err)
+
+	const token = "the.one-time.token"
+	sig, err := hostSigner.Sign(rand.Reader, []byte(token))
+	assert.FatalError(t, err)
+	proof := &provisioner.SSHHostKeyProof{Signature: ssh.Marshal(sig)}
+	badSig, err := signer.Sign(rand.Reader, []byte(token))
+	assert.FatalError(t, err)
+	badProof := &provisioner.SSHHostKeyProof{Signature: ssh.Marshal(badSig)}
+
+	userTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.UserCert, "key-id", []string{"user"}))
+	assert.FatalError(t, err)
+	hostTemplate, err := provisioner.TemplateSSHOptions(nil, sshutil.CreateTemplateData(sshutil.HostCert, "key-id", []string{"host"}))
+	assert.FatalError(t, err)
+
+	newContext := func(proof *provisioner.SSHHostKeyProof) context.Context {
+		ctx := provisioner.NewContextWithToken(context.Background(), token)
+		if proof != nil {
+			ctx = provisioner.NewContextWithSSHHostKeyProof(ctx, proof)
+		}
+		return ctx
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		opts     provisioner.SignSSHOptions
+		signOpts []provisioner.SignOption
+		wantErr  bool
+	}{
+		{"ok/not configured", newContext(nil), provisioner.SignSSHOptions{CertType: "host"}, []provisioner.SignOption{hostTemplate, provisioner.SSHHostKeyAttestationOption{}}, false},
+		{"ok/proof", newContext(proof), provisioner.SignSSHOptions{CertType: "host"}, []provisioner.SignOption{hostTemplate, provisioner.SSHHostKeyAttestationOption{Options: &provisioner.SSHHostKeyAttestationOptions{}}}, false},
+		{"ok/user certificate", newContext(nil), provisioner.SignSSHOptions{CertType: "user"}, []provisioner.SignOption{userTemplate, provisioner.SSHHostKeyAttestationOption{Options: &provisioner.SSHHostKeyAttestationOptions{}}}, false},
+		{"fail/missing proof", newContext(nil), provisioner.SignSSHOptions{CertType: "host"}, []provisioner.SignOption{hostTemplate, provisioner.SSHHostKeyAttestationOption{Options: &provisioner.SSHHostKeyAttestationOptions{}}}, true},
+		{"fail/bad proof", newContext(badProof), provisioner.SignSSHOptions{CertType: "host"}, []provisioner.SignOption{hostTemplate, provisioner.SSHHostKeyAttestationOption{Options: &provisioner.SSHHostKeyAttestationOptions{}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.sshCAUserCertSignKey = signer
+			a.sshCAHostCertSignKey = signer
+
+			got, err := a.SignSSH(tt.ctx, pub, tt.opts, tt.signOpts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.SignSSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equals(t, pub.Marshal(), got.Key.Marshal())
+			} else {
+				var sc render.StatusCodedError
+				if assert.True(t, errors.As(err, &sc)) {
+					assert.Equals(t, http.StatusForbidden, sc.StatusCode())
+				}
+			}
+		})
+	}
+}
+
 func TestAuthority_SignSSHAddUser(t *testing.T) {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	assert.FatalError(t, err)
@@ -820,6 +1104,48 @@ func TestAuthority_GetSSHHosts(t *testing.T) {
 				code: http.StatusInternalServerError,
 			}
 		},
+		"fail/inventory-get-fail": func(t *testing.T) *test {
+			return &test{
+				auth: testAuthority(t, WithAdminDB(&admin.MockDB{
+					MockError: errors.New("force"),
+				})),
+				cert: &x509.Certificate{},
+				err:  errors.New("getSSHHosts: force"),
+				code: http.StatusInternalServerError,
+			}
+		},
+		"ok/inventory": func(t *testing.T) *test {
+			return &test{
+				auth: testAuthority(t, WithAdminDB(&admin.MockDB{
+					MockRet1: []*admin.SSHHost{
+						{ID: "1", Hostname: "foo", Tags: []admin.SSHHostTag{{Name: "env", Value: "prod"}}},
+						{ID: "2", Hostname: "bar"},
+					},
+				})),
+				cert: &x509.Certificate{},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, []Host{
+						{HostID: "1", Hostname: "foo", HostTags: []HostTag{{ID: "env=prod", Name: "env", Value: "prod"}}},
+						{HostID: "2", Hostname: "bar"},
+					})
+				},
+			}
+		},
+		"ok/empty-inventory": func(t *testing.T) *test {
+			return &test{
+				auth: testAuthority(t, WithAdminDB(&admin.MockDB{}), WithDatabase(&db.MockAuthDB{
+					MGetSSHHostPrincipals: func() ([]string, error) {
+						return []string{"foo"}, nil
+					},
+				})),
+				cert: &x509.Certificate{},
+				cmp: func(got []Host) {
+					assert.Equals(t, got, []Host{
+						{Hostname: "foo"},
+					})
+				},
+			}
+		},
 		"ok": func(t *testing.T) *test {
 			return &test{
 				auth: testAuthority(t, WithDatabase(&db.MockAuthDB{
@@ -878,6 +1204,20 @@ func TestAuthority_RekeySSH(t *testing.T) {
 		CertType: ssh.UserCert,
 	}
 
+	const token = "the.one-time.token"
+	keySigner, err := ssh.NewSignerFromKey(key)
+	assert.FatalError(t, err)
+	sig, err := keySigner.Sign(rand.Reader, []byte(token))
+	assert.FatalError(t, err)
+	hostKeyContext := func(proof *provisioner.SSHHostKeyProof) context.Context {
+		ctx := provisioner.NewContextWithToken(context.Background(), token)
+		if proof != nil {
+			ctx = provisioner.NewContextWithSSHHostKeyProof(ctx, proof)
+		}
+		return ctx
+	}
+	hostKeyOpts := provisioner.SSHHostKeyAttestationOption{Options: &provisioner.SSHHostKeyAttestationOptions{}}
+
 	now := time.Now().UTC()
 
 	a := testAuthority(t)
@@ -888,6 +1228,7 @@ func TestAuthority_RekeySSH(t *testing.T) {
 	}
 
 	type test struct {
+		ctx        context.Context
 		auth       *Authority
 		userSigner ssh.Signer
 		hostSigner ssh.Signer
@@ -1033,6 +1374,53 @@ func TestAuthority_RekeySSH(t *testing.T) {
 				code:       http.StatusInternalServerError,
 			}
 		},
+		"fail/host-key-proof": func(t *testing.T) *test {
+			return &test{
+				ctx:        hostKeyContext(nil),
+				userSigner: signer,
+				hostSigner: signer,
+				cert:       &ssh.Certificate{ValidAfter: uint64(now.Unix()), ValidBefore: uint64(now.Add(10 * time.Minute).Unix()), CertType: ssh.HostCert},
+				key:        pub,
+				signOpts:   []provisioner.SignOption{hostKeyOpts},
+				err:        errors.New("host key proof of possession is required"),
+				code:       http.StatusForbidden,
+			}
+		},
+		"fail/host-key-proof-other-key": func(t *testing.T) *test {
+			otherSig, err := signer.Sign(rand.Reader, []byte(token))
+			assert.FatalError(t, err)
+			return &test{
+				ctx:        hostKeyContext(&provisioner.SSHHostKeyProof{Signature: ssh.Marshal(otherSig)}),
+				userSigner: signer,
+				hostSigner: signer,
+				cert:       &ssh.Certificate{ValidAfter: uint64(now.Unix()), ValidBefore: uint64(now.Add(10 * time.Minute).Unix()), CertType: ssh.HostCert},
+				key:        pub,
+				signOpts:   []provisioner.SignOption{hostKeyOpts},
+				err:        errors.New("host key signature is not valid"),
+				code:       http.StatusForbidden,
+			}
+		},
+		"ok/host-key-proof": func(t *testing.T) *test {
+			return &test{
+				ctx:        hostKeyContext(&provisioner.SSHHostKeyProof{Signature: ssh.Marshal(sig)}),
+				userSigner: signer,
+				hostSigner: signer,
+				cert: &ssh.Certificate{
+					ValidAfter:      uint64(now.Unix()),
+					ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+					CertType:        ssh.HostCert,
+					ValidPrincipals: []string{"foo.internal"},
+					KeyId:           "foo.internal",
+				},
+				key:      pub,
+				signOpts: []provisioner.SignOption{hostKeyOpts},
+				cmpResult: func(old, n *ssh.Certificate) {
+					assert.Equals(t, n.CertType, old.CertType)
+					assert.Equals(t, n.ValidPrincipals, old.ValidPrincipals)
+					assert.Equals(t, n.Key.Marshal(), pub.Marshal())
+				},
+			}
+		},
 		"ok": func(t *testing.T) *test {
 			va1 := now.Add(-24 * time.Hour)
 			vb1 := now.Add(-23 * time.Hour)
@@ -1074,7 +1462,11 @@ func TestAuthority_RekeySSH(t *testing.T) {
 			a.sshCAUserCertSignKey = tc.userSigner
 			a.sshCAHostCertSignKey = tc.hostSigner
 
-			cert, err := auth.RekeySSH(context.Background(), tc.cert, tc.key, tc.signOpts...)
+			ctx := tc.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			cert, err := auth.RekeySSH(ctx, tc.cert, tc.key, tc.signOpts...)
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
 					var sc render.StatusCodedError
@@ -5,11 +5,15 @@ import (
 	"crypto"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log"
+	"math"
+	"math/big"
 	"net"
 	"net/http"
 	"strings"
@@ -71,6 +75,36 @@ func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
 	}
 }
 
+// withCRLDistributionPoint returns a certificate modifier that adds the
+// configured CRL distribution point to the certificate if the template does
+// not define one.
+func withCRLDistributionPoint(crl *config.CRLConfig) provisioner.CertificateModifierFunc {
+	return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+		if !crl.IsEnabled() || crl.DistributionPoint == "" {
+			return nil
+		}
+		if len(crt.CRLDistributionPoints) == 0 {
+			crt.CRLDistributionPoints = []string{crl.DistributionPoint}
+		}
+		return nil
+	}
+}
+
+// withOCSPServer returns a certificate modifier that adds the configured OCSP
+// responder to the authority information access extension of the certificate
+// if the template does not define one.
+func withOCSPServer(ocspConfig *config.OCSPConfig) provisioner.CertificateModifierFunc {
+	return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+		if !ocspConfig.IsEnabled() || ocspConfig.ResponderURL == "" {
+			return nil
+		}
+		if len(crt.OCSPServer) == 0 {
+			crt.OCSPServer = []string{ocspConfig.ResponderURL}
+		}
+		return nil
+	}
+}
+
 // Sign creates a signed certificate from a certificate signing request.
 func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	var (
@@ -171,6 +205,22 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		)
 	}
 
+	// Set CRL distribution point
+	if err := withCRLDistributionPoint(a.config.CRL).Modify(leaf, signOpts); err != nil {
+		return nil, errs.ApplyOptions(
+			errs.ForbiddenErr(err, "error creating certificate"),
+			opts...,
+		)
+	}
+
+	// Set OCSP responder
+	if err := withOCSPServer(a.config.OCSP).Modify(leaf, signOpts); err != nil {
+		return nil, errs.ApplyOptions(
+			errs.ForbiddenErr(err, "error creating certificate"),
+			opts...,
+		)
+	}
+
 	for _, m := range certModifiers {
 		if err := m.Modify(leaf, signOpts); err != nil {
 			return nil, errs.ApplyOptions(
@@ -453,14 +503,17 @@ type RevokeOptions struct {
 	ACME        bool
 	Crt         *x509.Certificate
 	OTT         string
+	// KeyID is an optional key id to revoke in SSH revocations. It must be
+	// the key id of the revoked certificate, and all the certificates with
+	// this key id will be included in the key revocation list.
+	KeyID string
 }
 
 // Revoke revokes a certificate.
 //
 // NOTE: Only supports passive revocation - prevent existing certificates from
-// being renewed.
-//
-// TODO: Add OCSP and CRL support.
+// being renewed. If enabled, revoked certificates will be added to the
+// certificate revocation list and reported by the OCSP responder.
 func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error {
 	opts := []interface{}{
 		errs.WithKeyVal("serialNumber", revokeOpts.Serial),
@@ -526,7 +579,44 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 	}
 
 	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
-		err = a.revokeSSH(nil, rci)
+		// Store the expiration of the certificate if it is available, so it
+		// can be removed from the key revocation list once it has expired.
+		var revokedCert *ssh.Certificate
+		if krlDB, ok := a.db.(db.SSHKeyRevocationListDB); ok && rci.Serial != "" {
+			revokedCert, _ = krlDB.GetSSHCertificate(rci.Serial)
+			if revokedCert != nil && revokedCert.ValidBefore != ssh.CertTimeInfinity && revokedCert.ValidBefore <= math.MaxInt64 {
+				rci.ExpiresAt = time.Unix(int64(revokedCert.ValidBefore), 0).UTC()
+			}
+		}
+
+		// The key id revokes all the certificates with it, so it must be the
+		// key id of the revoked certificate.
+		if revokeOpts.KeyID != "" {
+			if revokedCert == nil {
+				return errs.ApplyOptions(
+					errs.BadRequest("cannot revoke key id '%s' without the certificate", revokeOpts.KeyID),
+					opts...,
+				)
+			}
+			if revokedCert.KeyId != revokeOpts.KeyID {
+				return errs.ApplyOptions(
+					errs.BadRequest("key id '%s' does not match the certificate", revokeOpts.KeyID),
+					opts...,
+				)
+			}
+			rci.KeyID = revokedCert.KeyId
+		}
+		err = a.revokeSSH(revokedCert, rci)
+
+		// Generate a new key revocation list so the revocation is published
+		// immediately. The revocation has already been stored, so an error
+		// here is only logged and the list will be generated on the next
+		// request.
+		if err == nil {
+			if err := a.GenerateSSHKeyRevocationList(); err != nil {
+				log.Printf("error generating ssh key revocation list: %v", err)
+			}
+		}
 	} else {
 		// Revoke an X.509 certificate using CAS. If the certificate is not
 		// provided we will try to read it from the db. If the read fails we
@@ -552,8 +642,28 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke", opts...)
 		}
 
+		// Store the expiration of the certificate, so it can be removed from
+		// the CRL once it has expired.
+		if revokedCert != nil {
+			rci.ExpiresAt = revokedCert.NotAfter
+		}
+
 		// Save as revoked in the Db.
 		err = a.revoke(revokedCert, rci)
+
+		// Discard the cached OCSP response, the next one will be revoked.
+		if err == nil {
+			a.invalidateOCSPResponse(rci.Serial)
+		}
+
+		// Generate a new CRL so the revocation is published immediately. The
+		// revocation has already been stored, so an error here is only logged
+		// and the CRL will be regenerated before it expires.
+		if err == nil && a.config.CRL.IsEnabled() && a.config.CRL.GenerateOnRevoke {
+			if err := a.GenerateCertificateRevocationList(); err != nil {
+				log.Printf("error generating certificate revocation list: %v", err)
+			}
+		}
 	}
 	switch {
 	case err == nil:
@@ -588,6 +698,126 @@ func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateIn
 	return a.db.RevokeSSH(rci)
 }
 
+// oidExtensionReasonCode is the CRL entry extension used to specify the
+// revocation reason.
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// GetCertificateRevocationList returns the DER encoded certificate revocation
+// list stored in the database.
+func (a *Authority) GetCertificateRevocationList() ([]byte, error) {
+	if !a.config.CRL.IsEnabled() {
+		return nil, errs.NotFound("authority.GetCertificateRevocationList; certificate revocation lists are not enabled")
+	}
+
+	crlDB, ok := a.db.(db.CertificateRevocationListDB)
+	if !ok {
+		return nil, errs.NotImplemented("authority.GetCertificateRevocationList; database does not support certificate revocation lists")
+	}
+
+	crlInfo, err := crlDB.GetCRL()
+	if err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.GetCertificateRevocationList")
+	}
+	if crlInfo == nil {
+		return nil, errs.NotFound("authority.GetCertificateRevocationList; certificate revocation list has not been generated")
+	}
+
+	return crlInfo.DER, nil
+}
+
+// GenerateCertificateRevocationList generates and signs a new certificate
+// revocation list with all the revoked certificates that have not expired yet,
+// and stores it in the database. It returns nil if certificate revocation
+// lists are not enabled.
+func (a *Authority) GenerateCertificateRevocationList() error {
+	if !a.config.CRL.IsEnabled() {
+		return nil
+	}
+
+	crlDB, ok := a.db.(db.CertificateRevocationListDB)
+	if !ok {
+		return errors.New("database does not support certificate revocation lists")
+	}
+
+	crlGenerator, ok := a.x509CAService.(casapi.CertificateAuthorityCRLGenerator)
+	if !ok {
+		return errors.New("certificate authority service does not support certificate revocation lists")
+	}
+
+	// Only one CRL can be generated at the same time, so the CRL number is
+	// always increased.
+	a.crlMutex.Lock()
+	defer a.crlMutex.Unlock()
+
+	crlInfo, err := crlDB.GetCRL()
+	if err != nil {
+		return errors.Wrap(err, "error retrieving certificate revocation list")
+	}
+
+	revokedList, err := crlDB.GetRevokedCertificates()
+	if err != nil {
+		return errors.Wrap(err, "error retrieving revoked certificates")
+	}
+
+	now := time.Now().Truncate(time.Second).UTC()
+	revokedCertificates := make([]pkix.RevokedCertificate, 0, len(revokedList))
+	for _, rci := range revokedList {
+		// Expired certificates do not need to be in the CRL.
+		if !rci.ExpiresAt.IsZero() && rci.ExpiresAt.Before(now) {
+			continue
+		}
+		sn, ok := new(big.Int).SetString(rci.Serial, 10)
+		if !ok {
+			log.Printf("error adding serial number %s to the certificate revocation list: invalid serial number", rci.Serial)
+			continue
+		}
+		rc := pkix.RevokedCertificate{
+			SerialNumber:   sn,
+			RevocationTime: rci.RevokedAt,
+		}
+		if rci.ReasonCode > 0 {
+			b, err := asn1.Marshal(asn1.Enumerated(rci.ReasonCode))
+			if err != nil {
+				return errors.Wrap(err, "error marshaling revocation reason")
+			}
+			rc.Extensions = []pkix.Extension{
+				{Id: oidExtensionReasonCode, Value: b},
+			}
+		}
+		revokedCertificates = append(revokedCertificates, rc)
+	}
+
+	// The CRL number must be monotonically increasing.
+	number := int64(1)
+	if crlInfo != nil {
+		number = crlInfo.Number + 1
+	}
+
+	duration := a.crlCacheDuration()
+	resp, err := crlGenerator.CreateCRL(&casapi.CreateCRLRequest{
+		RevocationList: &x509.RevocationList{
+			RevokedCertificates: revokedCertificates,
+			Number:              big.NewInt(number),
+			ThisUpdate:          now,
+			NextUpdate:          now.Add(duration),
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating certificate revocation list")
+	}
+
+	if err := crlDB.StoreCRL(&db.CertificateRevocationListInfo{
+		Number:    number,
+		ExpiresAt: now.Add(duration),
+		Duration:  duration,
+		DER:       resp.CRL,
+	}); err != nil {
+		return errors.Wrap(err, "error storing certificate revocation list")
+	}
+
+	return nil
+}
+
 // GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS server.
 func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 	fatal := func(err error) (*tls.Certificate, error) {
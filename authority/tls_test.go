@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
@@ -18,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/crypto/ssh"
 	"gopkg.in/square/go-jose.v2/jwt"
 
 	"go.step.sm/crypto/jose"
@@ -28,6 +30,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas/softcas"
@@ -1487,6 +1490,29 @@ func TestAuthority_Revoke(t *testing.T) {
 				},
 			}
 		},
+		"ok/mTLS crl error": func() test {
+			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+					return nil, errors.New("force")
+				},
+			}))
+			_a.config.CRL = &config.CRLConfig{Enabled: true, GenerateOnRevoke: true}
+
+			crt, err := pemutil.ReadCertificate("./testdata/certs/foo.crt")
+			assert.FatalError(t, err)
+
+			return test{
+				auth: _a,
+				ctx:  tlsRevokeCtx,
+				opts: &RevokeOptions{
+					Crt:        crt,
+					Serial:     "102012593071130646873265215610956555026",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					MTLS:       true,
+				},
+			}
+		},
 		"ok/mTLS-no-provisioner": func() test {
 			_a := testAuthority(t, WithDatabase(&db.MockAuthDB{}))
 
@@ -1530,6 +1556,119 @@ func TestAuthority_Revoke(t *testing.T) {
 				},
 			}
 		},
+		"fail/ssh key id mismatch": func() test {
+			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MGetSSHCertificate: func(serial string) (*ssh.Certificate, error) {
+					return &ssh.Certificate{Serial: 1234, KeyId: "bob@example.com"}, nil
+				},
+				MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+					return errors.New("unexpected revocation")
+				},
+			}))
+
+			cl := jwt.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jwt.NewNumericDate(now),
+				Expiry:    jwt.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "46",
+			}
+			raw, err := jwt.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+			return test{
+				auth: a,
+				ctx:  provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRevokeMethod),
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					OTT:        raw,
+					KeyID:      "alice@example.com",
+				},
+				err:  errors.New("key id 'alice@example.com' does not match the certificate"),
+				code: http.StatusBadRequest,
+				checkErrDetails: func(err *errs.Error) {
+					assert.Equals(t, err.Details["token"], raw)
+					assert.Equals(t, err.Details["tokenID"], "46")
+				},
+			}
+		},
+		"fail/ssh key id without certificate": func() test {
+			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MGetSSHCertificate: func(serial string) (*ssh.Certificate, error) {
+					return nil, errors.New("not found")
+				},
+				MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+					return errors.New("unexpected revocation")
+				},
+			}))
+
+			cl := jwt.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jwt.NewNumericDate(now),
+				Expiry:    jwt.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "47",
+			}
+			raw, err := jwt.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+			return test{
+				auth: a,
+				ctx:  provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRevokeMethod),
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					OTT:        raw,
+					KeyID:      "bob@example.com",
+				},
+				err:  errors.New("cannot revoke key id 'bob@example.com' without the certificate"),
+				code: http.StatusBadRequest,
+				checkErrDetails: func(err *errs.Error) {
+					assert.Equals(t, err.Details["token"], raw)
+					assert.Equals(t, err.Details["tokenID"], "47")
+				},
+			}
+		},
+		"ok/ssh with key id": func() test {
+			validBefore := uint64(now.Add(time.Hour).Unix())
+			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+				MGetSSHCertificate: func(serial string) (*ssh.Certificate, error) {
+					assert.Equals(t, "sn", serial)
+					return &ssh.Certificate{Serial: 1234, KeyId: "bob@example.com", ValidBefore: validBefore}, nil
+				},
+				MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+					assert.Equals(t, "sn", rci.Serial)
+					assert.Equals(t, "bob@example.com", rci.KeyID)
+					assert.Equals(t, time.Unix(int64(validBefore), 0).UTC(), rci.ExpiresAt)
+					return nil
+				},
+			}))
+
+			cl := jwt.Claims{
+				Subject:   "sn",
+				Issuer:    validIssuer,
+				NotBefore: jwt.NewNumericDate(now),
+				Expiry:    jwt.NewNumericDate(now.Add(time.Minute)),
+				Audience:  validAudience,
+				ID:        "45",
+			}
+			raw, err := jwt.Signed(sig).Claims(cl).CompactSerialize()
+			assert.FatalError(t, err)
+			return test{
+				auth: a,
+				ctx:  provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRevokeMethod),
+				opts: &RevokeOptions{
+					Serial:     "sn",
+					ReasonCode: reasonCode,
+					Reason:     reason,
+					OTT:        raw,
+					KeyID:      "bob@example.com",
+				},
+			}
+		},
 		"ok/ssh": func() test {
 			a := testAuthority(t, WithDatabase(&db.MockAuthDB{
 				MRevoke: func(rci *db.RevokedCertificateInfo) error {
@@ -1578,7 +1717,7 @@ func TestAuthority_Revoke(t *testing.T) {
 					assert.Equals(t, ctxErr.Details["reasonCode"], tc.opts.ReasonCode)
 					assert.Equals(t, ctxErr.Details["reason"], tc.opts.Reason)
 					assert.Equals(t, ctxErr.Details["MTLS"], tc.opts.MTLS)
-					assert.Equals(t, ctxErr.Details["context"], provisioner.RevokeMethod.String())
+					assert.Equals(t, ctxErr.Details["context"], provisioner.MethodFromContext(tc.ctx).String())
 
 					if tc.checkErrDetails != nil {
 						tc.checkErrDetails(ctxErr)
@@ -1591,6 +1730,62 @@ func TestAuthority_Revoke(t *testing.T) {
 	}
 }
 
+func TestAuthority_Revoke_sshKeyRevocationList(t *testing.T) {
+	now := time.Now().UTC()
+	jwk, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+
+	var revoked []*db.RevokedCertificateInfo
+	var stored *db.SSHKeyRevocationListInfo
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MRevokeSSH: func(rci *db.RevokedCertificateInfo) error {
+			revoked = append(revoked, rci)
+			return nil
+		},
+		MGetSSHCertificate: func(serial string) (*ssh.Certificate, error) {
+			return nil, errors.New("not found")
+		},
+		MGetRevokedSSHCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+			return revoked, nil
+		},
+		MGetSSHKRL: func() (*db.SSHKeyRevocationListInfo, error) {
+			return stored, nil
+		},
+		MStoreSSHKRL: func(krlInfo *db.SSHKeyRevocationListInfo) error {
+			stored = krlInfo
+			return nil
+		},
+	}))
+	signer, err := ssh.NewSignerFromKey(jwk.Key)
+	assert.FatalError(t, err)
+	a.sshCAUserCertSignKey = signer
+
+	raw, err := jwt.Signed(sig).Claims(jwt.Claims{
+		Subject:   "1234",
+		Issuer:    "step-cli",
+		NotBefore: jwt.NewNumericDate(now),
+		Expiry:    jwt.NewNumericDate(now.Add(time.Minute)),
+		Audience:  testAudiences.Revoke,
+		ID:        "48",
+	}).CompactSerialize()
+	assert.FatalError(t, err)
+
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SSHRevokeMethod)
+	assert.FatalError(t, a.Revoke(ctx, &RevokeOptions{
+		Serial: "1234",
+		OTT:    raw,
+	}))
+
+	// The list is published with the revocation.
+	if assert.NotNil(t, stored) {
+		assert.True(t, stored.Version > 0)
+		assert.True(t, bytes.Contains(stored.Data, signer.PublicKey().Marshal()))
+	}
+}
+
 func TestAuthority_constraints(t *testing.T) {
 	ca, err := minica.New(
 		minica.WithIntermediateTemplate(`{
@@ -1673,3 +1868,155 @@ func TestAuthority_constraints(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GenerateCertificateRevocationList(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	revokedCerts := []*db.RevokedCertificateInfo{
+		{Serial: "1234", ReasonCode: 1, RevokedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{Serial: "5678", RevokedAt: now.Add(-time.Hour)},
+		{Serial: "9012", RevokedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+	}
+
+	type fields struct {
+		crl *config.CRLConfig
+		db  db.AuthDB
+	}
+	tests := []struct {
+		name       string
+		fields     fields
+		wantNumber int64
+		wantSerial []string
+		wantErr    bool
+	}{
+		{"ok", fields{&config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, nil
+			},
+			MGetRevokedCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return revokedCerts, nil
+			},
+		}}, 1, []string{"1234", "5678"}, false},
+		{"ok next number", fields{&config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return &db.CertificateRevocationListInfo{Number: 10}, nil
+			},
+			MGetRevokedCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return nil, nil
+			},
+		}}, 11, nil, false},
+		{"ok disabled", fields{nil, &db.MockAuthDB{}}, 0, nil, false},
+		{"fail database", fields{&config.CRLConfig{Enabled: true}, &db.SimpleDB{}}, 0, nil, true},
+		{"fail getCRL", fields{&config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, errors.New("force")
+			},
+		}}, 0, nil, true},
+		{"fail getRevokedCertificates", fields{&config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, nil
+			},
+			MGetRevokedCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return nil, errors.New("force")
+			},
+		}}, 0, nil, true},
+		{"fail storeCRL", fields{&config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, nil
+			},
+			MGetRevokedCertificates: func() ([]*db.RevokedCertificateInfo, error) {
+				return nil, nil
+			},
+			MStoreCRL: func(*db.CertificateRevocationListInfo) error {
+				return errors.New("force")
+			},
+		}}, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored *db.CertificateRevocationListInfo
+			if m, ok := tt.fields.db.(*db.MockAuthDB); ok && m.MStoreCRL == nil {
+				m.MStoreCRL = func(crlInfo *db.CertificateRevocationListInfo) error {
+					stored = crlInfo
+					return nil
+				}
+			}
+
+			a, err := NewEmbedded(WithX509RootCerts(ca.Root), WithX509Signer(ca.Intermediate, ca.Signer), WithDatabase(tt.fields.db))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.config.CRL = tt.fields.crl
+
+			if err := a.GenerateCertificateRevocationList(); (err != nil) != tt.wantErr {
+				t.Errorf("Authority.GenerateCertificateRevocationList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantNumber == 0 {
+				assert.Nil(t, stored)
+				return
+			}
+
+			if assert.NotNil(t, stored) {
+				assert.Equals(t, tt.wantNumber, stored.Number)
+				assert.Equals(t, 24*time.Hour, stored.Duration)
+				crl, err := x509.ParseCRL(stored.DER)
+				assert.FatalError(t, err)
+				assert.FatalError(t, ca.Intermediate.CheckCRLSignature(crl))
+				var serials []string
+				for _, rc := range crl.TBSCertList.RevokedCertificates {
+					serials = append(serials, rc.SerialNumber.String())
+				}
+				assert.Equals(t, tt.wantSerial, serials)
+			}
+		})
+	}
+}
+
+func TestAuthority_GetCertificateRevocationList(t *testing.T) {
+	tests := []struct {
+		name    string
+		crl     *config.CRLConfig
+		db      db.AuthDB
+		want    []byte
+		wantErr bool
+	}{
+		{"ok", &config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return &db.CertificateRevocationListInfo{Number: 1, DER: []byte("the crl")}, nil
+			},
+		}, []byte("the crl"), false},
+		{"fail disabled", nil, &db.MockAuthDB{}, nil, true},
+		{"fail database", &config.CRLConfig{Enabled: true}, &db.SimpleDB{}, nil, true},
+		{"fail getCRL", &config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, errors.New("force")
+			},
+		}, nil, true},
+		{"fail not generated", &config.CRLConfig{Enabled: true}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, nil
+			},
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				config: &config.Config{CRL: tt.crl},
+				db:     tt.db,
+			}
+			got, err := a.GetCertificateRevocationList()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.GetCertificateRevocationList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authority.GetCertificateRevocationList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1164,6 +1164,31 @@ retry:
 	return &hosts, nil
 }
 
+// SSHStepUp performs the GET /ssh/step-up/{id} request to the CA. The
+// certificate in the response is only set once the step-up request has been
+// approved.
+func (c *Client) SSHStepUp(id string) (*api.SSHStepUpResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/ssh/step-up/" + url.PathEscape(id)})
+retry:
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "client GET %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var stepUp api.SSHStepUpResponse
+	if err := readJSON(resp.Body, &stepUp); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &stepUp, nil
+}
+
 // SSHBastion performs the POST /ssh/bastion request to the CA.
 func (c *Client) SSHBastion(req *api.SSHBastionRequest) (*api.SSHBastionResponse, error) {
 	var retried bool
@@ -1191,6 +1216,34 @@ retry:
 	return &bastion, nil
 }
 
+// NebulaSign performs the POST /nebula/sign request to the CA and returns the
+// api.NebulaSignResponse struct.
+func (c *Client) NebulaSign(req *api.NebulaSignRequest) (*api.NebulaSignResponse, error) {
+	var retried bool
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.NebulaSign; error marshaling request")
+	}
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/nebula/sign"})
+retry:
+	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "client.NebulaSign; client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) {
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var sign api.NebulaSignResponse
+	if err := readJSON(resp.Body, &sign); err != nil {
+		return nil, errors.Wrapf(err, "client.NebulaSign; error reading %s", u)
+	}
+	return &sign, nil
+}
+
 // RootFingerprint is a helper method that returns the current root fingerprint.
 // It does an health connection and gets the fingerprint from the TLS verified
 // chains.
@@ -3,6 +3,7 @@ package ca
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
@@ -10,6 +11,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -17,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	nebula "github.com/slackhq/nebula/cert"
 	"go.step.sm/crypto/x509util"
 	"golang.org/x/crypto/ssh"
 
@@ -969,6 +972,87 @@ func TestClient_SSHRoots(t *testing.T) {
 	}
 }
 
+func TestClient_SSHStepUp(t *testing.T) {
+	signer, err := ssh.NewSignerFromKey(mustKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(mustKey().Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.UserCert,
+		KeyId:           "jane@example.com",
+		ValidPrincipals: []string{"jane", "root"},
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		t.Fatal(err)
+	}
+	// Use the parsed certificate to compare it with the response.
+	pub, err := ssh.ParsePublicKey(cert.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert = pub.(*ssh.Certificate)
+
+	expiresAt := time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC)
+	pending := &api.SSHStepUpResponse{ID: "id", Status: "pending", ExpiresAt: expiresAt}
+	issued := &api.SSHStepUpResponse{ID: "id", Status: "issued", ExpiresAt: expiresAt, Certificate: &api.SSHCertificate{Certificate: cert}}
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		err          error
+	}{
+		{"ok pending", pending, 202, false, nil},
+		{"ok issued", issued, 200, false, nil},
+		{"not found", errs.NotFound("force"), 404, true, errors.New(errs.NotFoundDefaultMsg)},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equals(t, "/ssh/step-up/id", req.URL.Path)
+				render.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.SSHStepUp("id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.SSHStepUp() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.SSHStepUp() = %v, want nil", got)
+				}
+				sc, ok := err.(render.StatusCodedError)
+				assert.Fatal(t, ok, "error does not implement StatusCodedError interface")
+				assert.Equals(t, sc.StatusCode(), tt.responseCode)
+				assert.HasPrefix(t, tt.err.Error(), err.Error())
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.SSHStepUp() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
 func Test_parseEndpoint(t *testing.T) {
 	expected1 := &url.URL{Scheme: "https", Host: "ca.smallstep.com"}
 	expected2 := &url.URL{Scheme: "https", Host: "ca.smallstep.com", Path: "/1.0/sign"}
@@ -1069,6 +1153,88 @@ func TestClient_RootFingerprintWithServer(t *testing.T) {
 	assert.Equals(t, "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7", fp)
 }
 
+func TestClient_NebulaSign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	_, ipNet, err := net.ParseCIDR("10.1.0.10/16")
+	assert.FatalError(t, err)
+	ipNet.IP = net.ParseIP("10.1.0.10").To4()
+	crt := &nebula.NebulaCertificate{
+		Details: nebula.NebulaCertificateDetails{
+			Name:      "host.local",
+			Ips:       []*net.IPNet{ipNet},
+			NotBefore: time.Now(),
+			NotAfter:  time.Now().Add(time.Hour),
+			PublicKey: pub,
+		},
+	}
+	assert.FatalError(t, crt.Sign(priv))
+	ok := &api.NebulaSignResponse{
+		Certificate: api.NebulaCertificate{NebulaCertificate: crt},
+	}
+	request := &api.NebulaSignRequest{
+		OTT:       "the-ott",
+		PublicKey: pub,
+		Name:      "host.local",
+		IPs:       []string{"10.1.0.10/16"},
+	}
+
+	tests := []struct {
+		name         string
+		request      *api.NebulaSignRequest
+		response     interface{}
+		responseCode int
+		wantErr      bool
+		err          error
+	}{
+		{"ok", request, ok, 200, false, nil},
+		{"bad-response", request, "bad json", 200, true, nil},
+		{"bad-request", &api.NebulaSignRequest{}, errs.BadRequest("force"), 400, true, errors.New(errs.BadRequestPrefix)},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				render.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.NebulaSign(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.NebulaSign() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.NebulaSign() = %v, want nil", got)
+				}
+				if tt.responseCode != 200 {
+					sc, ok := err.(render.StatusCodedError)
+					assert.Fatal(t, ok, "error does not implement StatusCodedError interface")
+					assert.Equals(t, sc.StatusCode(), tt.responseCode)
+					assert.HasPrefix(t, err.Error(), tt.err.Error())
+				}
+			default:
+				want, err := crt.Sha256Sum()
+				assert.FatalError(t, err)
+				fp, err := got.Certificate.Sha256Sum()
+				assert.FatalError(t, err)
+				assert.Equals(t, want, fp)
+			}
+		})
+	}
+}
+
 func TestClient_SSHBastion(t *testing.T) {
 	ok := &api.SSHBastionResponse{
 		Hostname: "host.local",
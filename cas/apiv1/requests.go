@@ -118,6 +118,18 @@ type GetCertificateAuthorityResponse struct {
 	RootCertificate *x509.Certificate
 }
 
+// CreateCRLRequest is the request used to sign a certificate revocation
+// list.
+type CreateCRLRequest struct {
+	RevocationList *x509.RevocationList
+}
+
+// CreateCRLResponse is the response to a create CRL request. It contains the
+// DER encoded certificate revocation list.
+type CreateCRLResponse struct {
+	CRL []byte
+}
+
 // CreateKeyRequest is the request used to generate a new key using a KMS.
 type CreateKeyRequest = apiv1.CreateKeyRequest
 
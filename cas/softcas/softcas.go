@@ -3,6 +3,7 @@ package softcas
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"time"
@@ -132,6 +133,34 @@ func (c *SoftCAS) RevokeCertificate(req *apiv1.RevokeCertificateRequest) (*apiv1
 	}, nil
 }
 
+// CreateCRL signs the given revocation list using Golang or KMS crypto.
+func (c *SoftCAS) CreateCRL(req *apiv1.CreateCRLRequest) (*apiv1.CreateCRLResponse, error) {
+	if req.RevocationList == nil {
+		return nil, errors.New("createCRLRequest `revocationList` cannot be nil")
+	}
+
+	chain, signer, err := c.getCertSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	// Signers can specify the signature algorithm.
+	if req.RevocationList.SignatureAlgorithm == 0 {
+		if sa, ok := signer.(apiv1.SignatureAlgorithmGetter); ok {
+			req.RevocationList.SignatureAlgorithm = sa.SignatureAlgorithm()
+		}
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, req.RevocationList, chain[0], signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate revocation list")
+	}
+
+	return &apiv1.CreateCRLResponse{
+		CRL: crl,
+	}, nil
+}
+
 // CreateCertificateAuthority creates a root or an intermediate certificate.
 func (c *SoftCAS) CreateCertificateAuthority(req *apiv1.CreateCertificateAuthorityRequest) (*apiv1.CreateCertificateAuthorityResponse, error) {
 	switch {
@@ -646,6 +646,75 @@ func TestSoftCAS_RevokeCertificate(t *testing.T) {
 	}
 }
 
+func TestSoftCAS_CreateCRL(t *testing.T) {
+	revocationList := func() *x509.RevocationList {
+		return &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: testNow,
+			NextUpdate: testNow.Add(24 * time.Hour),
+			RevokedCertificates: []pkix.RevokedCertificate{
+				{SerialNumber: big.NewInt(1234), RevocationTime: testNow},
+			},
+		}
+	}
+	type fields struct {
+		Issuer            *x509.Certificate
+		Signer            crypto.Signer
+		CertificateSigner func() ([]*x509.Certificate, crypto.Signer, error)
+	}
+	type args struct {
+		req *apiv1.CreateCRLRequest
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+	}{
+		{"ok", fields{testIssuer, testSigner, nil}, args{&apiv1.CreateCRLRequest{
+			RevocationList: revocationList(),
+		}}, false},
+		{"ok with callback", fields{nil, nil, testCertificateSigner}, args{&apiv1.CreateCRLRequest{
+			RevocationList: revocationList(),
+		}}, false},
+		{"fail revocationList", fields{testIssuer, testSigner, nil}, args{&apiv1.CreateCRLRequest{}}, true},
+		{"fail with callback", fields{nil, nil, testFailCertificateSigner}, args{&apiv1.CreateCRLRequest{
+			RevocationList: revocationList(),
+		}}, true},
+		{"fail sign", fields{testIssuer, &badSigner{}, nil}, args{&apiv1.CreateCRLRequest{
+			RevocationList: revocationList(),
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &SoftCAS{
+				CertificateChain:  []*x509.Certificate{tt.fields.Issuer},
+				Signer:            tt.fields.Signer,
+				CertificateSigner: tt.fields.CertificateSigner,
+			}
+			got, err := c.CreateCRL(tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SoftCAS.CreateCRL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			crl, err := x509.ParseCRL(got.CRL)
+			if err != nil {
+				t.Errorf("x509.ParseCRL() error = %v", err)
+				return
+			}
+			if err := testIssuer.CheckCRLSignature(crl); err != nil {
+				t.Errorf("x509.Certificate.CheckCRLSignature() error = %v", err)
+			}
+			if len(crl.TBSCertList.RevokedCertificates) != 1 {
+				t.Errorf("SoftCAS.CreateCRL() revoked certificates = %d, want 1", len(crl.TBSCertList.RevokedCertificates))
+			}
+		})
+	}
+}
+
 func Test_now(t *testing.T) {
 	t0 := time.Now()
 	t1 := now()
@@ -2,13 +2,16 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	nebula "github.com/slackhq/nebula/cert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/nosql"
 	"github.com/smallstep/nosql/database"
@@ -25,8 +28,19 @@ var (
 	sshHostsTable          = []byte("ssh_hosts")
 	sshUsersTable          = []byte("ssh_users")
 	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	crlTable               = []byte("x509_crl")
+	sshKRLTable            = []byte("ssh_krl")
+	scepChallengesTable    = []byte("scep_challenges")
+	scepRequestsTable      = []byte("scep_requests")
+	sshStepUpRequestsTable = []byte("ssh_step_up_requests")
+	nebulaCertsTable       = []byte("nebula_certs")
+	nebulaCertsDataTable   = []byte("nebula_certs_data")
 )
 
+var crlKey = []byte("crl")
+
+var sshKRLKey = []byte("krl")
+
 // ErrAlreadyExists can be returned if the DB attempts to set a key that has
 // been previously set.
 var ErrAlreadyExists = errors.New("already exists")
@@ -80,6 +94,33 @@ func MustFromContext(ctx context.Context) AuthDB {
 	}
 }
 
+// CertificateRevocationListDB is an extension of AuthDB that allows to list
+// the revoked certificates and to store and retrieve the latest certificate
+// revocation list.
+type CertificateRevocationListDB interface {
+	GetRevokedCertificates() ([]*RevokedCertificateInfo, error)
+	GetCRL() (*CertificateRevocationListInfo, error)
+	StoreCRL(*CertificateRevocationListInfo) error
+}
+
+// SSHKeyRevocationListDB is an extension of AuthDB that allows to list the
+// revoked SSH certificates and to retrieve the stored SSH certificates, it is
+// used to generate and store OpenSSH key revocation lists.
+type SSHKeyRevocationListDB interface {
+	GetRevokedSSHCertificates() ([]*RevokedCertificateInfo, error)
+	GetSSHCertificate(serial string) (*ssh.Certificate, error)
+	GetSSHKRL() (*SSHKeyRevocationListInfo, error)
+	StoreSSHKRL(*SSHKeyRevocationListInfo) error
+}
+
+// CertificateStatusDB is an extension of AuthDB that allows to retrieve the
+// data stored for an issued certificate and the revocation information of a
+// revoked one.
+type CertificateStatusDB interface {
+	GetCertificateData(serialNumber string) (*CertificateData, error)
+	GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error)
+}
+
 // CertificateStorer is an extension of AuthDB that allows to store
 // certificates.
 type CertificateStorer interface {
@@ -87,6 +128,39 @@ type CertificateStorer interface {
 	StoreSSHCertificate(crt *ssh.Certificate) error
 }
 
+// NebulaCertificateStorer is an extension of AuthDB that allows to store
+// Nebula certificates.
+type NebulaCertificateStorer interface {
+	StoreNebulaCertificate(p provisioner.Interface, crt *nebula.NebulaCertificate) error
+}
+
+// SCEPChallengeDB is an extension of AuthDB that allows to store and consume
+// the dynamic challenge passwords used by SCEP provisioners.
+type SCEPChallengeDB interface {
+	CreateSCEPChallenge(ch *SCEPChallenge) error
+	GetSCEPChallenge(id string) (*SCEPChallenge, error)
+	UseSCEPChallenge(id string) error
+}
+
+// SCEPRequestDB is an extension of AuthDB that allows to store the SCEP
+// requests that require a manual approval.
+type SCEPRequestDB interface {
+	CreateSCEPRequest(req *SCEPRequest) error
+	GetSCEPRequest(id string) (*SCEPRequest, error)
+	GetSCEPRequests() ([]*SCEPRequest, error)
+	UpdateSCEPRequest(req *SCEPRequest, status SCEPRequestStatus) error
+}
+
+// SSHStepUpRequestDB is an extension of AuthDB that allows to store the
+// requests for additional principals in SSH user certificates that require
+// the approval of an administrator.
+type SSHStepUpRequestDB interface {
+	CreateSSHStepUpRequest(req *SSHStepUpRequest) error
+	GetSSHStepUpRequest(id string) (*SSHStepUpRequest, error)
+	GetSSHStepUpRequests() ([]*SSHStepUpRequest, error)
+	UpdateSSHStepUpRequest(req *SSHStepUpRequest, status SSHStepUpRequestStatus) error
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
@@ -113,7 +187,9 @@ func New(c *Config) (AuthDB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable,
+		revokedSSHCertsTable, certsDataTable, crlTable, sshKRLTable,
+		scepChallengesTable, scepRequestsTable, sshStepUpRequestsTable,
+		nebulaCertsTable, nebulaCertsDataTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -133,9 +209,127 @@ type RevokedCertificateInfo struct {
 	ReasonCode    int
 	Reason        string
 	RevokedAt     time.Time
+	ExpiresAt     time.Time
 	TokenID       string
 	MTLS          bool
 	ACME          bool
+	KeyID         string `json:",omitempty"`
+}
+
+// CertificateRevocationListInfo contains the latest certificate revocation
+// list generated by the authority and the information required to generate
+// the next one.
+type CertificateRevocationListInfo struct {
+	Number    int64
+	ExpiresAt time.Time
+	Duration  time.Duration
+	DER       []byte
+}
+
+// SSHKeyRevocationListInfo contains the latest OpenSSH key revocation list
+// generated. NextUpdate is the time when the first certificate in the list
+// expires, and it is zero if none of them expires.
+type SSHKeyRevocationListInfo struct {
+	Version    uint64
+	NextUpdate time.Time
+	Data       []byte
+}
+
+// SCEPChallenge contains the information of a dynamic challenge password used
+// by a SCEP provisioner. The challenge password is not stored, the ID is the
+// hex encoded SHA-256 of it.
+type SCEPChallenge struct {
+	ID          string
+	Provisioner string
+	Subject     string   `json:",omitempty"`
+	SANs        []string `json:",omitempty"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	UsedAt      time.Time
+}
+
+// SCEPRequestStatus is the status of a SCEP request.
+type SCEPRequestStatus string
+
+const (
+	// SCEPRequestPending is the status of a request waiting for approval.
+	SCEPRequestPending SCEPRequestStatus = "pending"
+	// SCEPRequestApproved is the status of an approved request. The
+	// certificate will be issued the next time the client polls for it.
+	SCEPRequestApproved SCEPRequestStatus = "approved"
+	// SCEPRequestRejected is the status of a rejected request.
+	SCEPRequestRejected SCEPRequestStatus = "rejected"
+	// SCEPRequestIssuing is the status of an approved request claimed by a
+	// client poll that is signing the certificate.
+	SCEPRequestIssuing SCEPRequestStatus = "issuing"
+	// SCEPRequestIssued is the status of a request with a certificate issued.
+	SCEPRequestIssued SCEPRequestStatus = "issued"
+)
+
+// SCEPRequest contains the information of a SCEP request that requires a
+// manual approval. The ID is derived from the name of the provisioner and the
+// transaction ID of the request using SCEPRequestID. The SignerKey is the
+// public key of the certificate that signed the request, polls must be signed
+// with the same key.
+type SCEPRequest struct {
+	ID            string
+	Provisioner   string
+	TransactionID string
+	CSR           []byte
+	SignerKey     []byte
+	Status        SCEPRequestStatus
+	SerialNumber  string `json:",omitempty"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// SCEPRequestID returns the identifier used to store a SCEP request. SCEP
+// transaction IDs are usually base64 encoded, so the identifier is the hex
+// encoded SHA-256 of the provisioner name and the transaction ID.
+func SCEPRequestID(provisionerName, transactionID string) string {
+	sum := sha256.Sum256([]byte(provisionerName + "/" + transactionID))
+	return hex.EncodeToString(sum[:])
+}
+
+// SSHStepUpRequestStatus is the status of an SSH step-up request.
+type SSHStepUpRequestStatus string
+
+const (
+	// SSHStepUpRequestPending is the status of a request waiting for approval.
+	SSHStepUpRequestPending SSHStepUpRequestStatus = "pending"
+	// SSHStepUpRequestApproved is the status of an approved request. The
+	// certificate will be issued the next time the requester polls for it.
+	SSHStepUpRequestApproved SSHStepUpRequestStatus = "approved"
+	// SSHStepUpRequestIssuing is the status of an approved request claimed by
+	// a poll that is signing the certificate.
+	SSHStepUpRequestIssuing SSHStepUpRequestStatus = "issuing"
+	// SSHStepUpRequestRejected is the status of a rejected request.
+	SSHStepUpRequestRejected SSHStepUpRequestStatus = "rejected"
+	// SSHStepUpRequestIssued is the status of a request with a certificate
+	// issued.
+	SSHStepUpRequestIssued SSHStepUpRequestStatus = "issued"
+)
+
+// SSHStepUpRequest contains the information of a request for additional
+// principals in an SSH user certificate. The certificate issued for an
+// approved request uses the SSH user certificate signed with the request as
+// a template, adding the requested principals.
+type SSHStepUpRequest struct {
+	ID                string
+	Provisioner       string
+	KeyID             string
+	Principals        []string
+	Justification     string
+	Certificate       []byte
+	Permissions       *ssh.Permissions `json:",omitempty"`
+	Duration          time.Duration
+	Status            SSHStepUpRequestStatus
+	ReviewedBy        string `json:",omitempty"`
+	SerialNumber      string `json:",omitempty"`
+	IssuedCertificate []byte `json:",omitempty"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	ExpiresAt         time.Time
 }
 
 // IsRevoked returns whether or not a certificate with the given identifier
@@ -220,6 +414,114 @@ func (db *DB) RevokeSSH(rci *RevokedCertificateInfo) error {
 	}
 }
 
+// GetRevokedCertificates returns the information of all the revoked X.509
+// certificates.
+func (db *DB) GetRevokedCertificates() ([]*RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedCertsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	revokedCerts := make([]*RevokedCertificateInfo, 0, len(entries))
+	for _, e := range entries {
+		rci := new(RevokedCertificateInfo)
+		if err := json.Unmarshal(e.Value, rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revoked certificate info %s", e.Key)
+		}
+		revokedCerts = append(revokedCerts, rci)
+	}
+	return revokedCerts, nil
+}
+
+// GetRevokedSSHCertificates returns the information of all the revoked SSH
+// certificates.
+func (db *DB) GetRevokedSSHCertificates() ([]*RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedSSHCertsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	revokedCerts := make([]*RevokedCertificateInfo, 0, len(entries))
+	for _, e := range entries {
+		rci := new(RevokedCertificateInfo)
+		if err := json.Unmarshal(e.Value, rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revoked ssh certificate info %s", e.Key)
+		}
+		revokedCerts = append(revokedCerts, rci)
+	}
+	return revokedCerts, nil
+}
+
+// GetRevokedCertificate returns the revocation information of the X.509
+// certificate with the given serial number.
+func (db *DB) GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(serialNumber))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	rci := new(RevokedCertificateInfo)
+	if err := json.Unmarshal(b, rci); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling revoked certificate info %s", serialNumber)
+	}
+	return rci, nil
+}
+
+// GetCRL returns the latest certificate revocation list stored. It will return
+// nil if a certificate revocation list has not been generated yet.
+func (db *DB) GetCRL() (*CertificateRevocationListInfo, error) {
+	b, err := db.Get(crlTable, crlKey)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	crlInfo := new(CertificateRevocationListInfo)
+	if err := json.Unmarshal(b, crlInfo); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling certificate revocation list info")
+	}
+	return crlInfo, nil
+}
+
+// StoreCRL stores the given certificate revocation list as the latest one.
+func (db *DB) StoreCRL(crlInfo *CertificateRevocationListInfo) error {
+	b, err := json.Marshal(crlInfo)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling certificate revocation list info")
+	}
+	if err := db.Set(crlTable, crlKey, b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetSSHKRL returns the latest OpenSSH key revocation list stored. It will
+// return nil if a key revocation list has not been generated yet.
+func (db *DB) GetSSHKRL() (*SSHKeyRevocationListInfo, error) {
+	b, err := db.Get(sshKRLTable, sshKRLKey)
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	krlInfo := new(SSHKeyRevocationListInfo)
+	if err := json.Unmarshal(b, krlInfo); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling ssh key revocation list info")
+	}
+	return krlInfo, nil
+}
+
+// StoreSSHKRL stores the given OpenSSH key revocation list as the latest one.
+func (db *DB) StoreSSHKRL(krlInfo *SSHKeyRevocationListInfo) error {
+	b, err := json.Marshal(krlInfo)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh key revocation list info")
+	}
+	if err := db.Set(sshKRLTable, sshKRLKey, b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
 // GetCertificate retrieves a certificate by the serial number.
 func (db *DB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
 	asn1Data, err := db.Get(certsTable, []byte(serialNumber))
@@ -306,6 +608,234 @@ func (db *DB) UseToken(id, tok string) (bool, error) {
 	return swapped, nil
 }
 
+// CreateSCEPChallenge stores a new SCEP challenge. It returns ErrAlreadyExists
+// if a challenge with the same ID has been previously stored.
+func (db *DB) CreateSCEPChallenge(ch *SCEPChallenge) error {
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge")
+	}
+
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, []byte(ch.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// GetSCEPChallenge returns the SCEP challenge with the given ID.
+func (db *DB) GetSCEPChallenge(id string) (*SCEPChallenge, error) {
+	b, err := db.Get(scepChallengesTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	ch := new(SCEPChallenge)
+	if err := json.Unmarshal(b, ch); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling scep challenge %s", id)
+	}
+	return ch, nil
+}
+
+// UseSCEPChallenge marks the SCEP challenge with the given ID as used. It
+// returns ErrAlreadyExists if the challenge has been used before.
+func (db *DB) UseSCEPChallenge(id string) error {
+	old, err := db.Get(scepChallengesTable, []byte(id))
+	if err != nil {
+		return errors.Wrap(err, "database Get error")
+	}
+	ch := new(SCEPChallenge)
+	if err := json.Unmarshal(old, ch); err != nil {
+		return errors.Wrapf(err, "error unmarshaling scep challenge %s", id)
+	}
+	if !ch.UsedAt.IsZero() {
+		return ErrAlreadyExists
+	}
+
+	ch.UsedAt = time.Now().UTC().Truncate(time.Second)
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep challenge")
+	}
+
+	// Compare with the original value so concurrent requests cannot use the
+	// same challenge twice.
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, []byte(id), old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// CreateSCEPRequest stores a new SCEP request. It returns ErrAlreadyExists if
+// a request with the same ID has been previously stored.
+func (db *DB) CreateSCEPRequest(req *SCEPRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep request")
+	}
+
+	_, swapped, err := db.CmpAndSwap(scepRequestsTable, []byte(req.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// GetSCEPRequest returns the SCEP request with the given ID.
+func (db *DB) GetSCEPRequest(id string) (*SCEPRequest, error) {
+	b, err := db.Get(scepRequestsTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	req := new(SCEPRequest)
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling scep request %s", id)
+	}
+	return req, nil
+}
+
+// GetSCEPRequests returns all the stored SCEP requests.
+func (db *DB) GetSCEPRequests() ([]*SCEPRequest, error) {
+	entries, err := db.List(scepRequestsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	reqs := make([]*SCEPRequest, 0, len(entries))
+	for _, e := range entries {
+		req := new(SCEPRequest)
+		if err := json.Unmarshal(e.Value, req); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling scep request %s", e.Key)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// UpdateSCEPRequest stores the given SCEP request if the status of the stored
+// one is the given status. It returns ErrAlreadyExists if the status has
+// changed.
+func (db *DB) UpdateSCEPRequest(req *SCEPRequest, status SCEPRequestStatus) error {
+	old, err := db.Get(scepRequestsTable, []byte(req.ID))
+	if err != nil {
+		return errors.Wrap(err, "database Get error")
+	}
+	current := new(SCEPRequest)
+	if err := json.Unmarshal(old, current); err != nil {
+		return errors.Wrapf(err, "error unmarshaling scep request %s", req.ID)
+	}
+	if current.Status != status {
+		return ErrAlreadyExists
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling scep request")
+	}
+
+	_, swapped, err := db.CmpAndSwap(scepRequestsTable, []byte(req.ID), old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// CreateSSHStepUpRequest stores a new SSH step-up request. It returns
+// ErrAlreadyExists if a request with the same ID already exists.
+func (db *DB) CreateSSHStepUpRequest(req *SSHStepUpRequest) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh step-up request")
+	}
+
+	_, swapped, err := db.CmpAndSwap(sshStepUpRequestsTable, []byte(req.ID), nil, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
+// GetSSHStepUpRequest returns the SSH step-up request with the given ID.
+func (db *DB) GetSSHStepUpRequest(id string) (*SSHStepUpRequest, error) {
+	b, err := db.Get(sshStepUpRequestsTable, []byte(id))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	req := new(SSHStepUpRequest)
+	if err := json.Unmarshal(b, req); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling ssh step-up request %s", id)
+	}
+	return req, nil
+}
+
+// GetSSHStepUpRequests returns all the stored SSH step-up requests.
+func (db *DB) GetSSHStepUpRequests() ([]*SSHStepUpRequest, error) {
+	entries, err := db.List(sshStepUpRequestsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	reqs := make([]*SSHStepUpRequest, 0, len(entries))
+	for _, e := range entries {
+		req := new(SSHStepUpRequest)
+		if err := json.Unmarshal(e.Value, req); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling ssh step-up request %s", e.Key)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// UpdateSSHStepUpRequest stores the given SSH step-up request if the status
+// of the stored one is the given status. It returns ErrAlreadyExists if the
+// status has changed.
+func (db *DB) UpdateSSHStepUpRequest(req *SSHStepUpRequest, status SSHStepUpRequestStatus) error {
+	old, err := db.Get(sshStepUpRequestsTable, []byte(req.ID))
+	if err != nil {
+		return errors.Wrap(err, "database Get error")
+	}
+	current := new(SSHStepUpRequest)
+	if err := json.Unmarshal(old, current); err != nil {
+		return errors.Wrapf(err, "error unmarshaling ssh step-up request %s", req.ID)
+	}
+	if current.Status != status {
+		return ErrAlreadyExists
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling ssh step-up request")
+	}
+
+	_, swapped, err := db.CmpAndSwap(sshStepUpRequestsTable, []byte(req.ID), old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped:
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
+
 // IsSSHHost returns if a principal is present in the ssh hosts table.
 func (db *DB) IsSSHHost(principal string) (bool, error) {
 	if _, err := db.Get(sshHostsTable, []byte(strings.ToLower(principal))); err != nil {
@@ -322,6 +852,40 @@ type sshHostPrincipalData struct {
 	Expiry uint64
 }
 
+// StoreNebulaCertificate stores a Nebula certificate and the provisioner that
+// authorized it. Nebula certificates do not have a serial number, so they are
+// stored by fingerprint.
+func (db *DB) StoreNebulaCertificate(p provisioner.Interface, crt *nebula.NebulaCertificate) error {
+	fp, err := crt.Sha256Sum()
+	if err != nil {
+		return errors.Wrap(err, "error calculating nebula certificate fingerprint")
+	}
+	raw, err := crt.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "error marshaling nebula certificate")
+	}
+	data := &CertificateData{}
+	if p != nil {
+		data.Provisioner = &ProvisionerData{
+			ID:   p.GetID(),
+			Name: p.GetName(),
+			Type: p.GetType().String(),
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling json")
+	}
+	// Add certificate and certificate data in one transaction.
+	tx := new(database.Tx)
+	tx.Set(nebulaCertsTable, []byte(fp), raw)
+	tx.Set(nebulaCertsDataTable, []byte(fp), b)
+	if err := db.Update(tx); err != nil {
+		return errors.Wrap(err, "database Update error")
+	}
+	return nil
+}
+
 // StoreSSHCertificate stores an SSH certificate.
 func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
 	serial := strconv.FormatUint(crt.Serial, 10)
@@ -350,6 +914,23 @@ func (db *DB) StoreSSHCertificate(crt *ssh.Certificate) error {
 	return nil
 }
 
+// GetSSHCertificate retrieves an SSH certificate by its serial number.
+func (db *DB) GetSSHCertificate(serial string) (*ssh.Certificate, error) {
+	b, err := db.Get(sshCertsTable, []byte(serial))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	pub, err := ssh.ParsePublicKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing ssh certificate %s", serial)
+	}
+	crt, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.Errorf("error parsing ssh certificate %s: unexpected type %T", serial, pub)
+	}
+	return crt, nil
+}
+
 // GetSSHHostPrincipals gets a list of all valid host principals.
 func (db *DB) GetSSHHostPrincipals() ([]string, error) {
 	entries, err := db.List(sshHostPrincipalsTable)
@@ -382,20 +963,40 @@ func (db *DB) Shutdown() error {
 
 // MockAuthDB mocks the AuthDB interface. //
 type MockAuthDB struct {
-	Err                   error
-	Ret1                  interface{}
-	MIsRevoked            func(string) (bool, error)
-	MIsSSHRevoked         func(string) (bool, error)
-	MRevoke               func(rci *RevokedCertificateInfo) error
-	MRevokeSSH            func(rci *RevokedCertificateInfo) error
-	MGetCertificate       func(serialNumber string) (*x509.Certificate, error)
-	MGetCertificateData   func(serialNumber string) (*CertificateData, error)
-	MStoreCertificate     func(crt *x509.Certificate) error
-	MUseToken             func(id, tok string) (bool, error)
-	MIsSSHHost            func(principal string) (bool, error)
-	MStoreSSHCertificate  func(crt *ssh.Certificate) error
-	MGetSSHHostPrincipals func() ([]string, error)
-	MShutdown             func() error
+	Err                        error
+	Ret1                       interface{}
+	MIsRevoked                 func(string) (bool, error)
+	MIsSSHRevoked              func(string) (bool, error)
+	MRevoke                    func(rci *RevokedCertificateInfo) error
+	MRevokeSSH                 func(rci *RevokedCertificateInfo) error
+	MGetCertificate            func(serialNumber string) (*x509.Certificate, error)
+	MGetCertificateData        func(serialNumber string) (*CertificateData, error)
+	MStoreCertificate          func(crt *x509.Certificate) error
+	MUseToken                  func(id, tok string) (bool, error)
+	MIsSSHHost                 func(principal string) (bool, error)
+	MStoreSSHCertificate       func(crt *ssh.Certificate) error
+	MStoreNebulaCertificate    func(p provisioner.Interface, crt *nebula.NebulaCertificate) error
+	MGetSSHHostPrincipals      func() ([]string, error)
+	MShutdown                  func() error
+	MGetRevokedCertificates    func() ([]*RevokedCertificateInfo, error)
+	MGetCRL                    func() (*CertificateRevocationListInfo, error)
+	MStoreCRL                  func(*CertificateRevocationListInfo) error
+	MGetRevokedCertificate     func(serialNumber string) (*RevokedCertificateInfo, error)
+	MGetRevokedSSHCertificates func() ([]*RevokedCertificateInfo, error)
+	MGetSSHCertificate         func(serial string) (*ssh.Certificate, error)
+	MGetSSHKRL                 func() (*SSHKeyRevocationListInfo, error)
+	MStoreSSHKRL               func(*SSHKeyRevocationListInfo) error
+	MCreateSCEPChallenge       func(ch *SCEPChallenge) error
+	MGetSCEPChallenge          func(id string) (*SCEPChallenge, error)
+	MUseSCEPChallenge          func(id string) error
+	MCreateSCEPRequest         func(req *SCEPRequest) error
+	MGetSCEPRequest            func(id string) (*SCEPRequest, error)
+	MGetSCEPRequests           func() ([]*SCEPRequest, error)
+	MUpdateSCEPRequest         func(req *SCEPRequest, status SCEPRequestStatus) error
+	MCreateSSHStepUpRequest    func(req *SSHStepUpRequest) error
+	MGetSSHStepUpRequest       func(id string) (*SSHStepUpRequest, error)
+	MGetSSHStepUpRequests      func() ([]*SSHStepUpRequest, error)
+	MUpdateSSHStepUpRequest    func(req *SSHStepUpRequest, status SSHStepUpRequestStatus) error
 }
 
 // IsRevoked mock.
@@ -441,6 +1042,191 @@ func (m *MockAuthDB) RevokeSSH(rci *RevokedCertificateInfo) error {
 	return m.Err
 }
 
+// GetRevokedCertificates mock.
+func (m *MockAuthDB) GetRevokedCertificates() ([]*RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificates != nil {
+		return m.MGetRevokedCertificates()
+	}
+	if rcis, ok := m.Ret1.([]*RevokedCertificateInfo); ok {
+		return rcis, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetRevokedCertificate mock.
+func (m *MockAuthDB) GetRevokedCertificate(serialNumber string) (*RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificate != nil {
+		return m.MGetRevokedCertificate(serialNumber)
+	}
+	if rci, ok := m.Ret1.(*RevokedCertificateInfo); ok {
+		return rci, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetRevokedSSHCertificates mock.
+func (m *MockAuthDB) GetRevokedSSHCertificates() ([]*RevokedCertificateInfo, error) {
+	if m.MGetRevokedSSHCertificates != nil {
+		return m.MGetRevokedSSHCertificates()
+	}
+	if rcis, ok := m.Ret1.([]*RevokedCertificateInfo); ok {
+		return rcis, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetSSHCertificate mock.
+func (m *MockAuthDB) GetSSHCertificate(serial string) (*ssh.Certificate, error) {
+	if m.MGetSSHCertificate != nil {
+		return m.MGetSSHCertificate(serial)
+	}
+	if crt, ok := m.Ret1.(*ssh.Certificate); ok {
+		return crt, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetCRL mock.
+func (m *MockAuthDB) GetCRL() (*CertificateRevocationListInfo, error) {
+	if m.MGetCRL != nil {
+		return m.MGetCRL()
+	}
+	if crlInfo, ok := m.Ret1.(*CertificateRevocationListInfo); ok {
+		return crlInfo, m.Err
+	}
+	return nil, m.Err
+}
+
+// StoreCRL mock.
+func (m *MockAuthDB) StoreCRL(crlInfo *CertificateRevocationListInfo) error {
+	if m.MStoreCRL != nil {
+		return m.MStoreCRL(crlInfo)
+	}
+	return m.Err
+}
+
+// GetSSHKRL mock.
+func (m *MockAuthDB) GetSSHKRL() (*SSHKeyRevocationListInfo, error) {
+	if m.MGetSSHKRL != nil {
+		return m.MGetSSHKRL()
+	}
+	if krlInfo, ok := m.Ret1.(*SSHKeyRevocationListInfo); ok {
+		return krlInfo, m.Err
+	}
+	return nil, m.Err
+}
+
+// StoreSSHKRL mock.
+func (m *MockAuthDB) StoreSSHKRL(krlInfo *SSHKeyRevocationListInfo) error {
+	if m.MStoreSSHKRL != nil {
+		return m.MStoreSSHKRL(krlInfo)
+	}
+	return m.Err
+}
+
+// CreateSCEPChallenge mock.
+func (m *MockAuthDB) CreateSCEPChallenge(ch *SCEPChallenge) error {
+	if m.MCreateSCEPChallenge != nil {
+		return m.MCreateSCEPChallenge(ch)
+	}
+	return m.Err
+}
+
+// GetSCEPChallenge mock.
+func (m *MockAuthDB) GetSCEPChallenge(id string) (*SCEPChallenge, error) {
+	if m.MGetSCEPChallenge != nil {
+		return m.MGetSCEPChallenge(id)
+	}
+	if ch, ok := m.Ret1.(*SCEPChallenge); ok {
+		return ch, m.Err
+	}
+	return nil, m.Err
+}
+
+// UseSCEPChallenge mock.
+func (m *MockAuthDB) UseSCEPChallenge(id string) error {
+	if m.MUseSCEPChallenge != nil {
+		return m.MUseSCEPChallenge(id)
+	}
+	return m.Err
+}
+
+// CreateSCEPRequest mock.
+func (m *MockAuthDB) CreateSCEPRequest(req *SCEPRequest) error {
+	if m.MCreateSCEPRequest != nil {
+		return m.MCreateSCEPRequest(req)
+	}
+	return m.Err
+}
+
+// GetSCEPRequest mock.
+func (m *MockAuthDB) GetSCEPRequest(id string) (*SCEPRequest, error) {
+	if m.MGetSCEPRequest != nil {
+		return m.MGetSCEPRequest(id)
+	}
+	if req, ok := m.Ret1.(*SCEPRequest); ok {
+		return req, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetSCEPRequests mock.
+func (m *MockAuthDB) GetSCEPRequests() ([]*SCEPRequest, error) {
+	if m.MGetSCEPRequests != nil {
+		return m.MGetSCEPRequests()
+	}
+	if reqs, ok := m.Ret1.([]*SCEPRequest); ok {
+		return reqs, m.Err
+	}
+	return nil, m.Err
+}
+
+// UpdateSCEPRequest mock.
+func (m *MockAuthDB) UpdateSCEPRequest(req *SCEPRequest, status SCEPRequestStatus) error {
+	if m.MUpdateSCEPRequest != nil {
+		return m.MUpdateSCEPRequest(req, status)
+	}
+	return m.Err
+}
+
+// CreateSSHStepUpRequest mock.
+func (m *MockAuthDB) CreateSSHStepUpRequest(req *SSHStepUpRequest) error {
+	if m.MCreateSSHStepUpRequest != nil {
+		return m.MCreateSSHStepUpRequest(req)
+	}
+	return m.Err
+}
+
+// GetSSHStepUpRequest mock.
+func (m *MockAuthDB) GetSSHStepUpRequest(id string) (*SSHStepUpRequest, error) {
+	if m.MGetSSHStepUpRequest != nil {
+		return m.MGetSSHStepUpRequest(id)
+	}
+	if req, ok := m.Ret1.(*SSHStepUpRequest); ok {
+		return req, m.Err
+	}
+	return nil, m.Err
+}
+
+// GetSSHStepUpRequests mock.
+func (m *MockAuthDB) GetSSHStepUpRequests() ([]*SSHStepUpRequest, error) {
+	if m.MGetSSHStepUpRequests != nil {
+		return m.MGetSSHStepUpRequests()
+	}
+	if reqs, ok := m.Ret1.([]*SSHStepUpRequest); ok {
+		return reqs, m.Err
+	}
+	return nil, m.Err
+}
+
+// UpdateSSHStepUpRequest mock.
+func (m *MockAuthDB) UpdateSSHStepUpRequest(req *SSHStepUpRequest, status SSHStepUpRequestStatus) error {
+	if m.MUpdateSSHStepUpRequest != nil {
+		return m.MUpdateSSHStepUpRequest(req, status)
+	}
+	return m.Err
+}
+
 // GetCertificate mock.
 func (m *MockAuthDB) GetCertificate(serialNumber string) (*x509.Certificate, error) {
 	if m.MGetCertificate != nil {
@@ -484,6 +1270,14 @@ func (m *MockAuthDB) StoreSSHCertificate(crt *ssh.Certificate) error {
 	return m.Err
 }
 
+// StoreNebulaCertificate mock.
+func (m *MockAuthDB) StoreNebulaCertificate(p provisioner.Interface, crt *nebula.NebulaCertificate) error {
+	if m.MStoreNebulaCertificate != nil {
+		return m.MStoreNebulaCertificate(p, crt)
+	}
+	return m.Err
+}
+
 // GetSSHHostPrincipals mock.
 func (m *MockAuthDB) GetSSHHostPrincipals() ([]string, error) {
 	if m.MGetSSHHostPrincipals != nil {
@@ -1,16 +1,22 @@
 package db
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
+	nebula "github.com/slackhq/nebula/cert"
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/nosql"
 	"github.com/smallstep/nosql/database"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestIsRevoked(t *testing.T) {
@@ -234,6 +240,65 @@ func TestDB_StoreCertificateChain(t *testing.T) {
 	}
 }
 
+func TestDB_StoreNebulaCertificate(t *testing.T) {
+	p := &provisioner.Nebula{
+		ID:   "some-id",
+		Name: "nebula",
+		Type: "Nebula",
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt := &nebula.NebulaCertificate{
+		Details: nebula.NebulaCertificateDetails{
+			Name:      "host.example.com",
+			PublicKey: pub,
+		},
+	}
+	fp, err := crt.Sha256Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := crt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		db      nosql.DB
+		wantErr bool
+	}{
+		{"ok", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				if len(tx.Operations) != 2 {
+					t.Fatal("unexpected number of operations")
+				}
+				assert.Equals(t, []byte("nebula_certs"), tx.Operations[0].Bucket)
+				assert.Equals(t, []byte(fp), tx.Operations[0].Key)
+				assert.Equals(t, raw, tx.Operations[0].Value)
+				assert.Equals(t, []byte("nebula_certs_data"), tx.Operations[1].Bucket)
+				assert.Equals(t, []byte(fp), tx.Operations[1].Key)
+				assert.Equals(t, []byte(`{"provisioner":{"id":"some-id","name":"nebula","type":"Nebula"}}`), tx.Operations[1].Value)
+				return nil
+			},
+		}, false},
+		{"fail", &MockNoSQLDB{
+			MUpdate: func(tx *database.Tx) error {
+				return errors.New("test error")
+			},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &DB{DB: tt.db, isUp: true}
+			if err := d.StoreNebulaCertificate(p, crt); (err != nil) != tt.wantErr {
+				t.Errorf("DB.StoreNebulaCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestDB_GetCertificateData(t *testing.T) {
 	type fields struct {
 		DB   nosql.DB
@@ -293,3 +358,1169 @@ func TestDB_GetCertificateData(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_GetRevokedCertificates(t *testing.T) {
+	revokedAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    []*RevokedCertificateInfo
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, bucket, []byte("revoked_x509_certs"))
+				return []*database.Entry{
+					{Key: []byte("1234"), Value: []byte(`{"Serial":"1234","ReasonCode":1,"RevokedAt":"2022-10-01T00:00:00Z"}`)},
+				}, nil
+			},
+		}, true}, []*RevokedCertificateInfo{
+			{Serial: "1234", ReasonCode: 1, RevokedAt: revokedAt},
+		}, false},
+		{"ok empty", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{}, nil
+			},
+		}, true}, []*RevokedCertificateInfo{}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{
+					{Key: []byte("1234"), Value: []byte(`{"bad-json"}`)},
+				}, nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetRevokedCertificates()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetRevokedCertificates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetRevokedCertificates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetRevokedSSHCertificates(t *testing.T) {
+	revokedAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    []*RevokedCertificateInfo
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, bucket, []byte("revoked_ssh_certs"))
+				return []*database.Entry{
+					{Key: []byte("1234"), Value: []byte(`{"Serial":"1234","ReasonCode":1,"RevokedAt":"2022-10-01T00:00:00Z"}`)},
+					{Key: []byte("5678"), Value: []byte(`{"Serial":"5678","RevokedAt":"2022-10-01T00:00:00Z","KeyID":"bob@example.com"}`)},
+				}, nil
+			},
+		}, true}, []*RevokedCertificateInfo{
+			{Serial: "1234", ReasonCode: 1, RevokedAt: revokedAt},
+			{Serial: "5678", RevokedAt: revokedAt, KeyID: "bob@example.com"},
+		}, false},
+		{"ok empty", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{}, nil
+			},
+		}, true}, []*RevokedCertificateInfo{}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{
+					{Key: []byte("1234"), Value: []byte(`{"bad-json"}`)},
+				}, nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetRevokedSSHCertificates()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetRevokedSSHCertificates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetRevokedSSHCertificates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHCertificate(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.FatalError(t, err)
+	crt := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		Serial:          1234,
+		CertType:        ssh.UserCert,
+		KeyId:           "bob@example.com",
+		ValidPrincipals: []string{"bob"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	assert.FatalError(t, crt.SignCert(rand.Reader, signer))
+
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *ssh.Certificate
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("ssh_certs"))
+				assert.Equals(t, key, []byte("1234"))
+				return crt.Marshal(), nil
+			},
+		}, true}, crt, false},
+		{"fail not found", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, nil, true},
+		{"fail parse", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte("foo"), nil
+			},
+		}, true}, nil, true},
+		{"fail not certificate", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return signer.PublicKey().Marshal(), nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSSHCertificate("1234")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSSHCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want == nil {
+				assert.Nil(t, got)
+			} else {
+				assert.Equals(t, tt.want.Marshal(), got.Marshal())
+			}
+		})
+	}
+}
+
+func TestDB_GetRevokedCertificate(t *testing.T) {
+	revokedAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name         string
+		fields       fields
+		serialNumber string
+		want         *RevokedCertificateInfo
+		wantErr      bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("revoked_x509_certs"))
+				assert.Equals(t, key, []byte("1234"))
+				return []byte(`{"Serial":"1234","ReasonCode":1,"RevokedAt":"2022-10-01T00:00:00Z"}`), nil
+			},
+		}, true}, "1234", &RevokedCertificateInfo{
+			Serial: "1234", ReasonCode: 1, RevokedAt: revokedAt,
+		}, false},
+		{"fail not found", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, "1234", nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, "1234", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetRevokedCertificate(tt.serialNumber)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetRevokedCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetRevokedCertificate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetCRL(t *testing.T) {
+	expiresAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *CertificateRevocationListInfo
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("x509_crl"))
+				assert.Equals(t, key, []byte("crl"))
+				return []byte(`{"Number":2,"ExpiresAt":"2022-10-01T00:00:00Z","Duration":3600000000000,"DER":"AQID"}`), nil
+			},
+		}, true}, &CertificateRevocationListInfo{
+			Number:    2,
+			ExpiresAt: expiresAt,
+			Duration:  time.Hour,
+			DER:       []byte{1, 2, 3},
+		}, false},
+		{"ok not found", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, nil, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetCRL()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetCRL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetCRL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_StoreCRL(t *testing.T) {
+	crlInfo := &CertificateRevocationListInfo{
+		Number:    2,
+		ExpiresAt: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		Duration:  time.Hour,
+		DER:       []byte{1, 2, 3},
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MSet: func(bucket, key, value []byte) error {
+				assert.Equals(t, bucket, []byte("x509_crl"))
+				assert.Equals(t, key, []byte("crl"))
+				assert.Equals(t, value, []byte(`{"Number":2,"ExpiresAt":"2022-10-01T00:00:00Z","Duration":3600000000000,"DER":"AQID"}`))
+				return nil
+			},
+		}, true}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MSet: func(bucket, key, value []byte) error {
+				return errors.New("an error")
+			},
+		}, true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			if err := db.StoreCRL(crlInfo); (err != nil) != tt.wantErr {
+				t.Errorf("DB.StoreCRL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHKRL(t *testing.T) {
+	nextUpdate := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *SSHKeyRevocationListInfo
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("ssh_krl"))
+				assert.Equals(t, key, []byte("krl"))
+				return []byte(`{"Version":2,"NextUpdate":"2022-10-01T00:00:00Z","Data":"AQID"}`), nil
+			},
+		}, true}, &SSHKeyRevocationListInfo{
+			Version:    2,
+			NextUpdate: nextUpdate,
+			Data:       []byte{1, 2, 3},
+		}, false},
+		{"ok not found", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, nil, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSSHKRL()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSSHKRL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSSHKRL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_StoreSSHKRL(t *testing.T) {
+	krlInfo := &SSHKeyRevocationListInfo{
+		Version:    2,
+		NextUpdate: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		Data:       []byte{1, 2, 3},
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MSet: func(bucket, key, value []byte) error {
+				assert.Equals(t, bucket, []byte("ssh_krl"))
+				assert.Equals(t, key, []byte("krl"))
+				assert.Equals(t, value, []byte(`{"Version":2,"NextUpdate":"2022-10-01T00:00:00Z","Data":"AQID"}`))
+				return nil
+			},
+		}, true}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MSet: func(bucket, key, value []byte) error {
+				return errors.New("an error")
+			},
+		}, true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			if err := db.StoreSSHKRL(krlInfo); (err != nil) != tt.wantErr {
+				t.Errorf("DB.StoreSSHKRL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_CreateSCEPChallenge(t *testing.T) {
+	ch := &SCEPChallenge{
+		ID:          "id",
+		Provisioner: "scep",
+		CreatedAt:   time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2022, 10, 1, 1, 0, 0, 0, time.UTC),
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, []byte("scep_challenges"))
+				assert.Equals(t, key, []byte("id"))
+				assert.Nil(t, old)
+				assert.Equals(t, newval, []byte(`{"ID":"id","Provisioner":"scep","CreatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T01:00:00Z","UsedAt":"0001-01-01T00:00:00Z"}`))
+				return newval, true, nil
+			},
+		}, true}, nil},
+		{"fail exists", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return []byte("foo"), false, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail db", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, true}, errors.New("error AuthDB CmpAndSwap: an error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			err := db.CreateSCEPChallenge(ch)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("DB.CreateSCEPChallenge() error = %v, wantErr nil", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Errorf("DB.CreateSCEPChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_GetSCEPChallenge(t *testing.T) {
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *SCEPChallenge
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("scep_challenges"))
+				assert.Equals(t, key, []byte("id"))
+				return []byte(`{"ID":"id","Provisioner":"scep","Subject":"device","SANs":["device.example.com"],"CreatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T01:00:00Z","UsedAt":"0001-01-01T00:00:00Z"}`), nil
+			},
+		}, true}, &SCEPChallenge{
+			ID:          "id",
+			Provisioner: "scep",
+			Subject:     "device",
+			SANs:        []string{"device.example.com"},
+			CreatedAt:   time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+			ExpiresAt:   time.Date(2022, 10, 1, 1, 0, 0, 0, time.UTC),
+		}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSCEPChallenge("id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSCEPChallenge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSCEPChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_UseSCEPChallenge(t *testing.T) {
+	unused := []byte(`{"ID":"id","Provisioner":"scep","CreatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T01:00:00Z","UsedAt":"0001-01-01T00:00:00Z"}`)
+	used := []byte(`{"ID":"id","Provisioner":"scep","CreatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T01:00:00Z","UsedAt":"2022-10-01T00:30:00Z"}`)
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("scep_challenges"))
+				assert.Equals(t, key, []byte("id"))
+				return unused, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, []byte("scep_challenges"))
+				assert.Equals(t, key, []byte("id"))
+				assert.Equals(t, old, unused)
+				ch := new(SCEPChallenge)
+				assert.FatalError(t, json.Unmarshal(newval, ch))
+				assert.False(t, ch.UsedAt.IsZero())
+				return newval, true, nil
+			},
+		}, true}, nil},
+		{"fail used", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return used, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail swapped", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return unused, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return used, false, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail get", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, errors.New("database Get error: an error")},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, errors.New("error unmarshaling scep challenge id: invalid character '}' after object key")},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return unused, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, true}, errors.New("error AuthDB CmpAndSwap: an error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			err := db.UseSCEPChallenge("id")
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("DB.UseSCEPChallenge() error = %v, wantErr nil", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Errorf("DB.UseSCEPChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_CreateSCEPRequest(t *testing.T) {
+	req := &SCEPRequest{
+		ID:            "id",
+		Provisioner:   "scep",
+		TransactionID: "transaction",
+		CSR:           []byte("csr"),
+		SignerKey:     []byte("key"),
+		Status:        SCEPRequestPending,
+		CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, []byte("scep_requests"))
+				assert.Equals(t, key, []byte("id"))
+				assert.Nil(t, old)
+				assert.Equals(t, newval, []byte(`{"ID":"id","Provisioner":"scep","TransactionID":"transaction","CSR":"Y3Ny","SignerKey":"a2V5","Status":"pending","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:00:00Z"}`))
+				return newval, true, nil
+			},
+		}, true}, nil},
+		{"fail exists", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return []byte("foo"), false, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail db", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, true}, errors.New("error AuthDB CmpAndSwap: an error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			err := db.CreateSCEPRequest(req)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("DB.CreateSCEPRequest() error = %v, wantErr nil", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Errorf("DB.CreateSCEPRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_GetSCEPRequest(t *testing.T) {
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *SCEPRequest
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("scep_requests"))
+				assert.Equals(t, key, []byte("id"))
+				return []byte(`{"ID":"id","Provisioner":"scep","TransactionID":"transaction","CSR":"Y3Ny","SignerKey":"a2V5","Status":"issued","SerialNumber":"1234","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:30:00Z"}`), nil
+			},
+		}, true}, &SCEPRequest{
+			ID:            "id",
+			Provisioner:   "scep",
+			TransactionID: "transaction",
+			CSR:           []byte("csr"),
+			SignerKey:     []byte("key"),
+			Status:        SCEPRequestIssued,
+			SerialNumber:  "1234",
+			CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt:     time.Date(2022, 10, 1, 0, 30, 0, 0, time.UTC),
+		}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSCEPRequest("id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSCEPRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSCEPRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetSCEPRequests(t *testing.T) {
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    []*SCEPRequest
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, bucket, []byte("scep_requests"))
+				return []*database.Entry{
+					{Key: []byte("id"), Value: []byte(`{"ID":"id","Provisioner":"scep","TransactionID":"transaction","CSR":"Y3Ny","SignerKey":"a2V5","Status":"pending","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:00:00Z"}`)},
+				}, nil
+			},
+		}, true}, []*SCEPRequest{
+			{
+				ID:            "id",
+				Provisioner:   "scep",
+				TransactionID: "transaction",
+				CSR:           []byte("csr"),
+				SignerKey:     []byte("key"),
+				Status:        SCEPRequestPending,
+				CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+				UpdatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+			},
+		}, false},
+		{"ok empty", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{}, nil
+			},
+		}, true}, []*SCEPRequest{}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{
+					{Key: []byte("id"), Value: []byte(`{"bad-json"}`)},
+				}, nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSCEPRequests()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSCEPRequests() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSCEPRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateSCEPRequest(t *testing.T) {
+	pending := []byte(`{"ID":"id","Provisioner":"scep","TransactionID":"transaction","CSR":"Y3Ny","SignerKey":"a2V5","Status":"pending","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:00:00Z"}`)
+	approved := []byte(`{"ID":"id","Provisioner":"scep","TransactionID":"transaction","CSR":"Y3Ny","SignerKey":"a2V5","Status":"approved","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:30:00Z"}`)
+	req := &SCEPRequest{
+		ID:            "id",
+		Provisioner:   "scep",
+		TransactionID: "transaction",
+		CSR:           []byte("csr"),
+		SignerKey:     []byte("key"),
+		Status:        SCEPRequestApproved,
+		CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:     time.Date(2022, 10, 1, 0, 30, 0, 0, time.UTC),
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("scep_requests"))
+				assert.Equals(t, key, []byte("id"))
+				return pending, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, []byte("scep_requests"))
+				assert.Equals(t, key, []byte("id"))
+				assert.Equals(t, old, pending)
+				assert.Equals(t, newval, approved)
+				return newval, true, nil
+			},
+		}, true}, nil},
+		{"fail status", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return approved, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail swapped", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return pending, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return approved, false, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail get", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, errors.New("database Get error: an error")},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, errors.New("error unmarshaling scep request id: invalid character '}' after object key")},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return pending, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, true}, errors.New("error AuthDB CmpAndSwap: an error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			err := db.UpdateSCEPRequest(req, SCEPRequestPending)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("DB.UpdateSCEPRequest() error = %v, wantErr nil", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Errorf("DB.UpdateSCEPRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_CreateSSHStepUpRequest(t *testing.T) {
+	req := &SSHStepUpRequest{
+		ID:            "id",
+		Provisioner:   "jwk",
+		KeyID:         "jane@example.com",
+		Principals:    []string{"root"},
+		Justification: "incident 1234",
+		Certificate:   []byte("cert"),
+		Duration:      time.Hour,
+		Status:        SSHStepUpRequestPending,
+		CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:     time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC),
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, []byte("ssh_step_up_requests"))
+				assert.Equals(t, key, []byte("id"))
+				assert.Nil(t, old)
+				assert.Equals(t, newval, []byte(`{"ID":"id","Provisioner":"jwk","KeyID":"jane@example.com","Principals":["root"],"Justification":"incident 1234","Certificate":"Y2VydA==","Duration":3600000000000,"Status":"pending","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T16:00:00Z"}`))
+				return newval, true, nil
+			},
+		}, true}, nil},
+		{"fail exists", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return []byte("foo"), false, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail db", fields{&MockNoSQLDB{
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, true}, errors.New("error AuthDB CmpAndSwap: an error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			err := db.CreateSSHStepUpRequest(req)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("DB.CreateSSHStepUpRequest() error = %v, wantErr nil", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Errorf("DB.CreateSSHStepUpRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHStepUpRequest(t *testing.T) {
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    *SSHStepUpRequest
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("ssh_step_up_requests"))
+				assert.Equals(t, key, []byte("id"))
+				return []byte(`{"ID":"id","Provisioner":"jwk","KeyID":"jane@example.com","Principals":["root"],"Justification":"incident 1234","Certificate":"Y2VydA==","Duration":3600000000000,"Status":"issued","ReviewedBy":"admin@example.com","SerialNumber":"1234","IssuedCertificate":"aXNzdWVk","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:30:00Z","ExpiresAt":"2022-10-01T16:00:00Z"}`), nil
+			},
+		}, true}, &SSHStepUpRequest{
+			ID:                "id",
+			Provisioner:       "jwk",
+			KeyID:             "jane@example.com",
+			Principals:        []string{"root"},
+			Justification:     "incident 1234",
+			Certificate:       []byte("cert"),
+			Duration:          time.Hour,
+			Status:            SSHStepUpRequestIssued,
+			ReviewedBy:        "admin@example.com",
+			SerialNumber:      "1234",
+			IssuedCertificate: []byte("issued"),
+			CreatedAt:         time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt:         time.Date(2022, 10, 1, 0, 30, 0, 0, time.UTC),
+			ExpiresAt:         time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC),
+		}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, database.ErrNotFound
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSSHStepUpRequest("id")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSSHStepUpRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSSHStepUpRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_GetSSHStepUpRequests(t *testing.T) {
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		want    []*SSHStepUpRequest
+		wantErr bool
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				assert.Equals(t, bucket, []byte("ssh_step_up_requests"))
+				return []*database.Entry{
+					{Key: []byte("id"), Value: []byte(`{"ID":"id","Provisioner":"jwk","KeyID":"jane@example.com","Principals":["root"],"Justification":"incident 1234","Certificate":"Y2VydA==","Duration":3600000000000,"Status":"pending","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T16:00:00Z"}`)},
+				}, nil
+			},
+		}, true}, []*SSHStepUpRequest{
+			{
+				ID:            "id",
+				Provisioner:   "jwk",
+				KeyID:         "jane@example.com",
+				Principals:    []string{"root"},
+				Justification: "incident 1234",
+				Certificate:   []byte("cert"),
+				Duration:      time.Hour,
+				Status:        SSHStepUpRequestPending,
+				CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+				UpdatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+				ExpiresAt:     time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC),
+			},
+		}, false},
+		{"ok empty", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{}, nil
+			},
+		}, true}, []*SSHStepUpRequest{}, false},
+		{"fail db", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, nil, true},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MList: func(bucket []byte) ([]*database.Entry, error) {
+				return []*database.Entry{
+					{Key: []byte("id"), Value: []byte(`{"bad-json"}`)},
+				}, nil
+			},
+		}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			got, err := db.GetSSHStepUpRequests()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DB.GetSSHStepUpRequests() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DB.GetSSHStepUpRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDB_UpdateSSHStepUpRequest(t *testing.T) {
+	pending := []byte(`{"ID":"id","Provisioner":"jwk","KeyID":"jane@example.com","Principals":["root"],"Justification":"incident 1234","Certificate":"Y2VydA==","Duration":3600000000000,"Status":"pending","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:00:00Z","ExpiresAt":"2022-10-01T16:00:00Z"}`)
+	approved := []byte(`{"ID":"id","Provisioner":"jwk","KeyID":"jane@example.com","Principals":["root"],"Justification":"incident 1234","Certificate":"Y2VydA==","Duration":3600000000000,"Status":"approved","ReviewedBy":"admin@example.com","CreatedAt":"2022-10-01T00:00:00Z","UpdatedAt":"2022-10-01T00:30:00Z","ExpiresAt":"2022-10-01T16:00:00Z"}`)
+	req := &SSHStepUpRequest{
+		ID:            "id",
+		Provisioner:   "jwk",
+		KeyID:         "jane@example.com",
+		Principals:    []string{"root"},
+		Justification: "incident 1234",
+		Certificate:   []byte("cert"),
+		Duration:      time.Hour,
+		Status:        SSHStepUpRequestApproved,
+		ReviewedBy:    "admin@example.com",
+		CreatedAt:     time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:     time.Date(2022, 10, 1, 0, 30, 0, 0, time.UTC),
+		ExpiresAt:     time.Date(2022, 10, 1, 16, 0, 0, 0, time.UTC),
+	}
+	type fields struct {
+		DB   nosql.DB
+		isUp bool
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr error
+	}{
+		{"ok", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				assert.Equals(t, bucket, []byte("ssh_step_up_requests"))
+				assert.Equals(t, key, []byte("id"))
+				return pending, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				assert.Equals(t, bucket, []byte("ssh_step_up_requests"))
+				assert.Equals(t, key, []byte("id"))
+				assert.Equals(t, old, pending)
+				assert.Equals(t, newval, approved)
+				return newval, true, nil
+			},
+		}, true}, nil},
+		{"fail status", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return approved, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail swapped", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return pending, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return approved, false, nil
+			},
+		}, true}, ErrAlreadyExists},
+		{"fail get", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return nil, errors.New("an error")
+			},
+		}, true}, errors.New("database Get error: an error")},
+		{"fail unmarshal", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return []byte(`{"bad-json"}`), nil
+			},
+		}, true}, errors.New("error unmarshaling ssh step-up request id: invalid character '}' after object key")},
+		{"fail db", fields{&MockNoSQLDB{
+			MGet: func(bucket, key []byte) ([]byte, error) {
+				return pending, nil
+			},
+			MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+				return nil, false, errors.New("an error")
+			},
+		}, true}, errors.New("error AuthDB CmpAndSwap: an error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{
+				DB:   tt.fields.DB,
+				isUp: tt.fields.isUp,
+			}
+			err := db.UpdateSSHStepUpRequest(req, SSHStepUpRequestPending)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("DB.UpdateSSHStepUpRequest() error = %v, wantErr nil", err)
+			case tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()):
+				t.Errorf("DB.UpdateSSHStepUpRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,447 @@
+// Package tpm implements the parsing of the TPM 2.0 structures used in key
+// attestations.
+package tpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TPM 2.0 constants used to parse the structures in a TPM attestation
+// statement. They are defined in the TPM 2.0 Library, Part 2: Structures.
+const (
+	GeneratedValue  uint32 = 0xff544347
+	STAttestCertify uint16 = 0x8017
+
+	AlgRSA    uint16 = 0x0001
+	AlgSHA1   uint16 = 0x0004
+	AlgSHA256 uint16 = 0x000B
+	AlgSHA384 uint16 = 0x000C
+	AlgSHA512 uint16 = 0x000D
+	AlgNull   uint16 = 0x0010
+	AlgECDAA  uint16 = 0x001A
+	AlgECC    uint16 = 0x0023
+
+	ECCNistP256 uint16 = 0x0003
+	ECCNistP384 uint16 = 0x0004
+	ECCNistP521 uint16 = 0x0005
+)
+
+// TPMA_OBJECT attributes of a key, defined in the TPM 2.0 Library, Part 2:
+// Structures.
+const (
+	AttrFixedTPM            uint32 = 0x00000002
+	AttrFixedParent         uint32 = 0x00000010
+	AttrSensitiveDataOrigin uint32 = 0x00000020
+)
+
+// OIDTCGKpAIKCertificate is the extended key usage of the attestation key
+// certificates, tcg-kp-AIKCertificate.
+var OIDTCGKpAIKCertificate = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
+
+// OIDPermanentIdentifier is the otherName type used to encode a permanent
+// identifier in the subject alternative names as defined in RFC 4043.
+var OIDPermanentIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 8, 3}
+
+// OIDEKPermanentIdentifier is the assigner of the permanent identifiers
+// derived from an endorsement key, tcg-on-ekPermIdSha256, defined in the TCG
+// TPM 2.0 Keys for Device Identity and Attestation specification.
+var OIDEKPermanentIdentifier = asn1.ObjectIdentifier{2, 23, 133, 12, 1}
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// PermanentIdentifier is a permanent identifier as defined in RFC 4043.
+type PermanentIdentifier struct {
+	Value    string
+	Assigner asn1.ObjectIdentifier
+}
+
+// CertifyInfo contains the fields of a TPMS_ATTEST structure of type
+// TPM_ST_ATTEST_CERTIFY used to validate a TPM attestation.
+type CertifyInfo struct {
+	ExtraData []byte
+	Name      []byte
+}
+
+// Public contains the public key, the name algorithm and the object
+// attributes of a TPMT_PUBLIC structure.
+type Public struct {
+	NameAlg          uint16
+	ObjectAttributes uint32
+	PublicKey        crypto.PublicKey
+}
+
+// VerifyHardwareBound returns an error if the key can have been imported into
+// the TPM or duplicated from it. A key generated by the TPM that cannot leave
+// it has the fixedTPM, fixedParent and sensitiveDataOrigin attributes.
+func (p *Public) VerifyHardwareBound() error {
+	const want = AttrFixedTPM | AttrFixedParent | AttrSensitiveDataOrigin
+	if p.ObjectAttributes&want != want {
+		return errors.Errorf("key is not bound to the tpm: object attributes %#x", p.ObjectAttributes)
+	}
+	return nil
+}
+
+// reader reads TPM 2.0 structures, all integers are encoded in big-endian.
+type reader struct {
+	*bytes.Reader
+}
+
+func (r *reader) uint16() (uint16, error) {
+	var v uint16
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func (r *reader) uint32() (uint32, error) {
+	var v uint32
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+// sized reads a TPM2B structure, a buffer prefixed with its uint16 size.
+func (r *reader) sized() ([]byte, error) {
+	size, err := r.uint16()
+	if err != nil {
+		return nil, err
+	}
+	if int(size) > r.Len() {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := make([]byte, size)
+	if _, err := r.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// skip discards n bytes.
+func (r *reader) skip(n int) error {
+	if n > r.Len() {
+		return errors.New("unexpected end of data")
+	}
+	_, err := r.Seek(int64(n), 1)
+	return err
+}
+
+// ParseCertifyInfo parses a TPMS_ATTEST structure and returns the extra
+// data and the name of the certified object. Only attestations of type
+// TPM_ST_ATTEST_CERTIFY are supported.
+func ParseCertifyInfo(b []byte) (*CertifyInfo, error) {
+	r := &reader{bytes.NewReader(b)}
+	magic, err := r.uint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading magic")
+	}
+	if magic != GeneratedValue {
+		return nil, errors.Errorf("unexpected magic %#x", magic)
+	}
+	typ, err := r.uint16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading type")
+	}
+	if typ != STAttestCertify {
+		return nil, errors.Errorf("unexpected type %#x", typ)
+	}
+	// qualifiedSigner
+	if _, err := r.sized(); err != nil {
+		return nil, errors.Wrap(err, "error reading qualified signer")
+	}
+	extraData, err := r.sized()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading extra data")
+	}
+	// clockInfo (17 bytes) and firmwareVersion (8 bytes)
+	if err := r.skip(25); err != nil {
+		return nil, errors.Wrap(err, "error reading clock info")
+	}
+	name, err := r.sized()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading name")
+	}
+	// qualifiedName
+	if _, err := r.sized(); err != nil {
+		return nil, errors.Wrap(err, "error reading qualified name")
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected trailing data")
+	}
+	return &CertifyInfo{
+		ExtraData: extraData,
+		Name:      name,
+	}, nil
+}
+
+// ParsePublic parses a TPMT_PUBLIC structure with an RSA or an ECC key.
+func ParsePublic(b []byte) (*Public, error) {
+	r := &reader{bytes.NewReader(b)}
+	typ, err := r.uint16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading type")
+	}
+	nameAlg, err := r.uint16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading name algorithm")
+	}
+	objectAttributes, err := r.uint32()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading object attributes")
+	}
+	// authPolicy
+	if _, err := r.sized(); err != nil {
+		return nil, errors.Wrap(err, "error reading auth policy")
+	}
+	// symmetric: algorithm, and keyBits and mode if the algorithm is not null.
+	sym, err := r.uint16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading symmetric algorithm")
+	}
+	if sym != AlgNull {
+		if err := r.skip(4); err != nil {
+			return nil, errors.Wrap(err, "error reading symmetric algorithm")
+		}
+	}
+	// scheme: algorithm, and hash algorithm if the algorithm is not null.
+	scheme, err := r.uint16()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading scheme")
+	}
+	switch scheme {
+	case AlgNull:
+	case AlgECDAA:
+		return nil, errors.New("unsupported scheme ECDAA")
+	default:
+		if err := r.skip(2); err != nil {
+			return nil, errors.Wrap(err, "error reading scheme")
+		}
+	}
+
+	var pub crypto.PublicKey
+	switch typ {
+	case AlgRSA:
+		keyBits, err := r.uint16()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading key bits")
+		}
+		exponent, err := r.uint32()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading exponent")
+		}
+		// An exponent of zero indicates the default exponent 2^16 + 1.
+		if exponent == 0 {
+			exponent = 65537
+		}
+		n, err := r.sized()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading modulus")
+		}
+		if len(n)*8 != int(keyBits) {
+			return nil, errors.Errorf("unexpected modulus size %d", len(n)*8)
+		}
+		pub = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent),
+		}
+	case AlgECC:
+		curveID, err := r.uint16()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading curve")
+		}
+		// kdf: algorithm, and hash algorithm if the algorithm is not null.
+		kdf, err := r.uint16()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading kdf")
+		}
+		if kdf != AlgNull {
+			if err := r.skip(2); err != nil {
+				return nil, errors.Wrap(err, "error reading kdf")
+			}
+		}
+		var curve elliptic.Curve
+		switch curveID {
+		case ECCNistP256:
+			curve = elliptic.P256()
+		case ECCNistP384:
+			curve = elliptic.P384()
+		case ECCNistP521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %#x", curveID)
+		}
+		x, err := r.sized()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading x coordinate")
+		}
+		y, err := r.sized()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading y coordinate")
+		}
+		key := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+		pub = key
+	default:
+		return nil, errors.Errorf("unsupported key type %#x", typ)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected trailing data")
+	}
+
+	return &Public{
+		NameAlg:          nameAlg,
+		ObjectAttributes: objectAttributes,
+		PublicKey:        pub,
+	}, nil
+}
+
+// Name returns the TPM name of the object with the given TPMT_PUBLIC
+// structure, the name algorithm followed by the digest of the structure.
+func Name(nameAlg uint16, pubArea []byte) ([]byte, error) {
+	var h crypto.Hash
+	switch nameAlg {
+	case AlgSHA1:
+		h = crypto.SHA1
+	case AlgSHA256:
+		h = crypto.SHA256
+	case AlgSHA384:
+		h = crypto.SHA384
+	case AlgSHA512:
+		h = crypto.SHA512
+	default:
+		return nil, errors.Errorf("unsupported name algorithm %#x", nameAlg)
+	}
+	hh := h.New()
+	hh.Write(pubArea)
+	name := make([]byte, 2, 2+h.Size())
+	binary.BigEndian.PutUint16(name, nameAlg)
+	return hh.Sum(name), nil
+}
+
+// EKPermanentIdentifier returns the permanent identifier of the endorsement
+// key in the given certificate, with the tcg-on-ekPermIdSha256 assigner and
+// the hex-encoded SHA-256 digest of the endorsement key as the value.
+// Attestation CAs add it to the certificates of the attestation keys bound to
+// the endorsement key after the credential activation.
+func EKPermanentIdentifier(ekCert *x509.Certificate) PermanentIdentifier {
+	sum := sha256.Sum256(ekCert.RawSubjectPublicKeyInfo)
+	return PermanentIdentifier{
+		Value:    hex.EncodeToString(sum[:]),
+		Assigner: OIDEKPermanentIdentifier,
+	}
+}
+
+// Equal reports whether both permanent identifiers have the same assigner
+// and value. Values are compared case-insensitively, as the hex encoding of a
+// digest can use both cases.
+func (p PermanentIdentifier) Equal(o PermanentIdentifier) bool {
+	return p.Assigner.Equal(o.Assigner) && strings.EqualFold(p.Value, o.Value)
+}
+
+// SignatureAlgorithm returns the x509 signature algorithm for the given
+// COSE algorithm identifier.
+func SignatureAlgorithm(alg int64) (x509.SignatureAlgorithm, error) {
+	switch alg {
+	case -7:
+		return x509.ECDSAWithSHA256, nil
+	case -35:
+		return x509.ECDSAWithSHA384, nil
+	case -36:
+		return x509.ECDSAWithSHA512, nil
+	case -257:
+		return x509.SHA256WithRSA, nil
+	case -258:
+		return x509.SHA384WithRSA, nil
+	case -259:
+		return x509.SHA512WithRSA, nil
+	case -37:
+		return x509.SHA256WithRSAPSS, nil
+	case -38:
+		return x509.SHA384WithRSAPSS, nil
+	case -39:
+		return x509.SHA512WithRSAPSS, nil
+	default:
+		return x509.UnknownSignatureAlgorithm, errors.Errorf("unsupported algorithm %d", alg)
+	}
+}
+
+// PermanentIdentifiers returns the values of the permanent identifiers in the
+// subject alternative names of a certificate.
+func PermanentIdentifiers(crt *x509.Certificate) ([]string, error) {
+	pids, err := ParsePermanentIdentifiers(crt)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, pid := range pids {
+		if pid.Value != "" {
+			ids = append(ids, pid.Value)
+		}
+	}
+	return ids, nil
+}
+
+// ParsePermanentIdentifiers returns the permanent identifiers in the subject
+// alternative names of a certificate.
+func ParsePermanentIdentifiers(crt *x509.Certificate) ([]PermanentIdentifier, error) {
+	var pids []PermanentIdentifier
+	for _, ext := range crt.Extensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		rest, err := asn1.Unmarshal(ext.Value, &seq)
+		if err != nil {
+			return nil, err
+		} else if len(rest) != 0 {
+			return nil, errors.New("trailing data after subject alternative names")
+		}
+		rest = seq.Bytes
+		for len(rest) > 0 {
+			var gn asn1.RawValue
+			if rest, err = asn1.Unmarshal(rest, &gn); err != nil {
+				return nil, err
+			}
+			// otherName [0] { type-id OBJECT IDENTIFIER, value [0] EXPLICIT ANY }
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+			var oid asn1.ObjectIdentifier
+			value, err := asn1.Unmarshal(gn.Bytes, &oid)
+			if err != nil {
+				return nil, err
+			}
+			if !oid.Equal(OIDPermanentIdentifier) {
+				continue
+			}
+			var pi struct {
+				IdentifierValue string                `asn1:"utf8,optional"`
+				Assigner        asn1.ObjectIdentifier `asn1:"optional"`
+			}
+			if _, err := asn1.UnmarshalWithParams(value, &pi, "explicit,tag:0"); err != nil {
+				return nil, err
+			}
+			pids = append(pids, PermanentIdentifier{
+				Value:    pi.IdentifierValue,
+				Assigner: pi.Assigner,
+			})
+		}
+	}
+	return pids, nil
+}
@@ -0,0 +1,263 @@
+package tpm_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/smallstep/certificates/internal/tpm"
+	"github.com/smallstep/certificates/internal/tpm/tpmtest"
+)
+
+func TestParsePublic(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPubArea := tpmtest.Public(t, ecKey.Public())
+
+	badCurve := append([]byte{}, ecPubArea...)
+	binary.BigEndian.PutUint16(badCurve[16:], 0x0010)
+	badPoint := append([]byte{}, ecPubArea...)
+	badPoint[len(badPoint)-1] ^= 0xff
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *tpm.Public
+		wantErr bool
+	}{
+		{"ok ecdsa", ecPubArea, &tpm.Public{NameAlg: tpm.AlgSHA256, ObjectAttributes: tpmtest.DefaultAttributes, PublicKey: ecKey.Public()}, false},
+		{"ok rsa", tpmtest.Public(t, rsaKey.Public()), &tpm.Public{NameAlg: tpm.AlgSHA256, ObjectAttributes: tpmtest.DefaultAttributes, PublicKey: rsaKey.Public()}, false},
+		{"fail empty", []byte{}, nil, true},
+		{"fail short", ecPubArea[:len(ecPubArea)-1], nil, true},
+		{"fail trailing data", append(append([]byte{}, ecPubArea...), 0), nil, true},
+		{"fail key type", append([]byte{0x00, 0x08}, ecPubArea[2:]...), nil, true},
+		{"fail curve", badCurve, nil, true},
+		{"fail point", badPoint, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpm.ParsePublic(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePublic() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePublic() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublic_VerifyHardwareBound(t *testing.T) {
+	tests := []struct {
+		name    string
+		attrs   uint32
+		wantErr bool
+	}{
+		{"ok", tpmtest.DefaultAttributes, false},
+		{"ok all", tpm.AttrFixedTPM | tpm.AttrFixedParent | tpm.AttrSensitiveDataOrigin, false},
+		{"fail imported", tpm.AttrFixedTPM | tpm.AttrFixedParent, true},
+		{"fail duplicable", tpm.AttrFixedParent | tpm.AttrSensitiveDataOrigin, true},
+		{"fail fixedParent", tpm.AttrFixedTPM | tpm.AttrSensitiveDataOrigin, true},
+		{"fail none", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &tpm.Public{ObjectAttributes: tt.attrs}
+			if err := p.VerifyHardwareBound(); (err != nil) != tt.wantErr {
+				t.Errorf("Public.VerifyHardwareBound() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCertifyInfo(t *testing.T) {
+	certInfo := tpmtest.CertifyInfo(t, []byte("extra data"), []byte("name"))
+
+	badMagic := append([]byte{}, certInfo...)
+	badMagic[0] = 0
+	badType := append([]byte{}, certInfo...)
+	binary.BigEndian.PutUint16(badType[4:], 0x8018)
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *tpm.CertifyInfo
+		wantErr bool
+	}{
+		{"ok", certInfo, &tpm.CertifyInfo{ExtraData: []byte("extra data"), Name: []byte("name")}, false},
+		{"fail empty", []byte{}, nil, true},
+		{"fail magic", badMagic, nil, true},
+		{"fail type", badType, nil, true},
+		{"fail short", certInfo[:len(certInfo)-1], nil, true},
+		{"fail trailing data", append(append([]byte{}, certInfo...), 0), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpm.ParseCertifyInfo(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCertifyInfo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCertifyInfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+	sum := sha256.Sum256([]byte("pubArea"))
+	tests := []struct {
+		name    string
+		nameAlg uint16
+		want    []byte
+		wantErr bool
+	}{
+		{"ok", tpm.AlgSHA256, append([]byte{0x00, 0x0B}, sum[:]...), false},
+		{"fail", tpm.AlgNull, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpm.Name(tt.nameAlg, []byte("pubArea"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Name() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Name() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     int64
+		want    x509.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"ok ES256", -7, x509.ECDSAWithSHA256, false},
+		{"ok ES384", -35, x509.ECDSAWithSHA384, false},
+		{"ok ES512", -36, x509.ECDSAWithSHA512, false},
+		{"ok RS256", -257, x509.SHA256WithRSA, false},
+		{"ok RS384", -258, x509.SHA384WithRSA, false},
+		{"ok RS512", -259, x509.SHA512WithRSA, false},
+		{"ok PS256", -37, x509.SHA256WithRSAPSS, false},
+		{"ok PS384", -38, x509.SHA384WithRSAPSS, false},
+		{"ok PS512", -39, x509.SHA512WithRSAPSS, false},
+		{"fail EdDSA", -8, x509.UnknownSignatureAlgorithm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpm.SignatureAlgorithm(tt.alg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SignatureAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("SignatureAlgorithm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermanentIdentifiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		crt     *x509.Certificate
+		want    []string
+		wantErr bool
+	}{
+		{"ok", &x509.Certificate{Extensions: []pkix.Extension{tpmtest.PermanentIdentifierExtension(t, "ek-1234")}}, []string{"ek-1234"}, false},
+		{"ok none", &x509.Certificate{}, nil, false},
+		{"fail", &x509.Certificate{Extensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: []byte("bad")}}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpm.PermanentIdentifiers(tt.crt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PermanentIdentifiers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PermanentIdentifiers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePermanentIdentifiers(t *testing.T) {
+	ekID := tpm.PermanentIdentifier{Value: "ek-1234", Assigner: tpm.OIDEKPermanentIdentifier}
+	tests := []struct {
+		name    string
+		crt     *x509.Certificate
+		want    []tpm.PermanentIdentifier
+		wantErr bool
+	}{
+		{"ok", &x509.Certificate{Extensions: []pkix.Extension{tpmtest.PermanentIdentifierExtension(t, "ek-1234")}}, []tpm.PermanentIdentifier{{Value: "ek-1234"}}, false},
+		{"ok assigner", &x509.Certificate{Extensions: []pkix.Extension{tpmtest.PermanentIdentifiersExtension(t, ekID, tpm.PermanentIdentifier{Value: "1234"})}}, []tpm.PermanentIdentifier{ekID, {Value: "1234"}}, false},
+		{"ok none", &x509.Certificate{}, nil, false},
+		{"fail", &x509.Certificate{Extensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: []byte("bad")}}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpm.ParsePermanentIdentifiers(tt.crt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePermanentIdentifiers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePermanentIdentifiers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEKPermanentIdentifier(t *testing.T) {
+	crt := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("spki")}
+	sum := sha256.Sum256([]byte("spki"))
+	want := tpm.PermanentIdentifier{Value: hex.EncodeToString(sum[:]), Assigner: tpm.OIDEKPermanentIdentifier}
+	if got := tpm.EKPermanentIdentifier(crt); !reflect.DeepEqual(got, want) {
+		t.Errorf("EKPermanentIdentifier() = %v, want %v", got, want)
+	}
+}
+
+func TestPermanentIdentifier_Equal(t *testing.T) {
+	id := tpm.PermanentIdentifier{Value: "abcdef", Assigner: tpm.OIDEKPermanentIdentifier}
+	tests := []struct {
+		name string
+		o    tpm.PermanentIdentifier
+		want bool
+	}{
+		{"ok", tpm.PermanentIdentifier{Value: "abcdef", Assigner: tpm.OIDEKPermanentIdentifier}, true},
+		{"ok case", tpm.PermanentIdentifier{Value: "ABCDEF", Assigner: tpm.OIDEKPermanentIdentifier}, true},
+		{"fail value", tpm.PermanentIdentifier{Value: "abcd", Assigner: tpm.OIDEKPermanentIdentifier}, false},
+		{"fail assigner", tpm.PermanentIdentifier{Value: "abcdef", Assigner: asn1.ObjectIdentifier{1, 2, 3}}, false},
+		{"fail no assigner", tpm.PermanentIdentifier{Value: "abcdef"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := id.Equal(tt.o); got != tt.want {
+				t.Errorf("PermanentIdentifier.Equal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
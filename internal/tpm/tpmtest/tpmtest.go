@@ -0,0 +1,121 @@
+// Package tpmtest implements helpers to create the TPM 2.0 structures of a key
+// attestation in tests.
+package tpmtest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"testing"
+
+	"github.com/smallstep/certificates/internal/tpm"
+)
+
+func writeTPM2B(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint16(len(b)))
+	buf.Write(b)
+}
+
+// DefaultAttributes are the object attributes of a signing key generated by
+// the TPM: sign, userWithAuth, sensitiveDataOrigin, fixedParent and fixedTPM.
+const DefaultAttributes uint32 = 0x00040072
+
+// Public returns the TPMT_PUBLIC structure of an RSA or ECDSA key generated by
+// the TPM.
+func Public(t *testing.T, pub crypto.PublicKey) []byte {
+	t.Helper()
+	return PublicWithAttributes(t, pub, DefaultAttributes)
+}
+
+// PublicWithAttributes returns the TPMT_PUBLIC structure of an RSA or ECDSA
+// key with the given object attributes.
+func PublicWithAttributes(t *testing.T, pub crypto.PublicKey, attrs uint32) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		binary.Write(buf, binary.BigEndian, tpm.AlgRSA)
+		binary.Write(buf, binary.BigEndian, tpm.AlgSHA256)
+		binary.Write(buf, binary.BigEndian, attrs)
+		writeTPM2B(buf, nil)
+		binary.Write(buf, binary.BigEndian, tpm.AlgNull)
+		binary.Write(buf, binary.BigEndian, uint16(0x0014)) // RSASSA
+		binary.Write(buf, binary.BigEndian, tpm.AlgSHA256)
+		binary.Write(buf, binary.BigEndian, uint16(k.Size()*8))
+		binary.Write(buf, binary.BigEndian, uint32(0))
+		writeTPM2B(buf, k.N.Bytes())
+	case *ecdsa.PublicKey:
+		binary.Write(buf, binary.BigEndian, tpm.AlgECC)
+		binary.Write(buf, binary.BigEndian, tpm.AlgSHA256)
+		binary.Write(buf, binary.BigEndian, attrs)
+		writeTPM2B(buf, nil)
+		binary.Write(buf, binary.BigEndian, tpm.AlgNull)
+		binary.Write(buf, binary.BigEndian, uint16(0x0018)) // ECDSA
+		binary.Write(buf, binary.BigEndian, tpm.AlgSHA256)
+		binary.Write(buf, binary.BigEndian, tpm.ECCNistP256)
+		binary.Write(buf, binary.BigEndian, tpm.AlgNull)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		writeTPM2B(buf, k.X.FillBytes(make([]byte, size)))
+		writeTPM2B(buf, k.Y.FillBytes(make([]byte, size)))
+	default:
+		t.Fatalf("unsupported key type %T", pub)
+	}
+	return buf.Bytes()
+}
+
+// CertifyInfo returns a TPMS_ATTEST structure of type certify.
+func CertifyInfo(t *testing.T, extraData, name []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, tpm.GeneratedValue)
+	binary.Write(buf, binary.BigEndian, tpm.STAttestCertify)
+	writeTPM2B(buf, []byte("qualified signer"))
+	writeTPM2B(buf, extraData)
+	buf.Write(make([]byte, 25))
+	writeTPM2B(buf, name)
+	writeTPM2B(buf, []byte("qualified name"))
+	return buf.Bytes()
+}
+
+// PermanentIdentifierExtension returns a subject alternative name
+// extension with the given permanent identifier.
+func PermanentIdentifierExtension(t *testing.T, id string) pkix.Extension {
+	t.Helper()
+	return PermanentIdentifiersExtension(t, tpm.PermanentIdentifier{Value: id})
+}
+
+// PermanentIdentifiersExtension returns a subject alternative name extension
+// with the given permanent identifiers.
+func PermanentIdentifiersExtension(t *testing.T, pids ...tpm.PermanentIdentifier) pkix.Extension {
+	t.Helper()
+	typeID, err := asn1.Marshal(tpm.OIDPermanentIdentifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("tpm.example.com")},
+	}
+	for _, pid := range pids {
+		pi, err := asn1.Marshal(struct {
+			IdentifierValue string                `asn1:"utf8,optional"`
+			Assigner        asn1.ObjectIdentifier `asn1:"optional"`
+		}{pid.Value, pid.Assigner})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: pi})
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(typeID, value...)})
+	}
+	san, err := asn1.Marshal(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: san}
+}
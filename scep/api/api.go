@@ -14,7 +14,6 @@ import (
 
 	"github.com/go-chi/chi"
 	microscep "github.com/micromdm/scep/v2/scep"
-	"go.mozilla.org/pkcs7"
 
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/log"
@@ -274,45 +273,68 @@ func GetCACaps(ctx context.Context) (Response, error) {
 
 // PKIOperation performs PKI operations and returns a SCEP response
 func PKIOperation(ctx context.Context, req request) (Response, error) {
-	// parse the message using microscep implementation
-	microMsg, err := microscep.ParsePKIMessage(req.Message)
+	// parse the message; unlike the microscep implementation, this also
+	// accepts GetCertInitial messages.
+	msg, err := scep.ParsePKIMessage(req.Message)
 	if err != nil {
 		// return the error, because we can't use the msg for creating a CertRep
 		return Response{}, err
 	}
 
-	// this is essentially doing the same as microscep.ParsePKIMessage, but
-	// gives us access to the p7 itself in scep.PKIMessage. Essentially a small
-	// wrapper for the microscep implementation.
-	p7, err := pkcs7.Parse(microMsg.Raw)
-	if err != nil {
-		return Response{}, err
-	}
-
-	// copy over properties to our internal PKIMessage
-	msg := &scep.PKIMessage{
-		TransactionID: microMsg.TransactionID,
-		MessageType:   microMsg.MessageType,
-		SenderNonce:   microMsg.SenderNonce,
-		Raw:           microMsg.Raw,
-		P7:            p7,
-	}
-
 	auth := scep.MustFromContext(ctx)
 	if err := auth.DecryptPKIEnvelope(ctx, msg); err != nil {
 		return Response{}, err
 	}
 
 	// NOTE: at this point we have sufficient information for returning nicely signed CertReps
+
+	switch msg.MessageType {
+	case microscep.CertPoll:
+		// GetCertInitial polls for a request pending approval.
+		certRep, err := auth.PollCertificate(ctx, msg)
+		if err != nil {
+			return createFailureResponse(ctx, nil, msg, microscep.BadRequest, fmt.Errorf("error when polling certificate: %w", err))
+		}
+		return newCertRepResponse(certRep), nil
+	case microscep.GetCert:
+		certRep, err := auth.GetCert(ctx, msg)
+		if err != nil {
+			return createFailureResponse(ctx, nil, msg, microscep.BadCertID, fmt.Errorf("error when retrieving certificate: %w", err))
+		}
+		return newCertRepResponse(certRep), nil
+	case microscep.GetCRL:
+		certRep, err := auth.GetCRL(ctx, msg)
+		if err != nil {
+			return createFailureResponse(ctx, nil, msg, microscep.BadCertID, fmt.Errorf("error when retrieving certificate revocation list: %w", err))
+		}
+		return newCertRepResponse(certRep), nil
+	}
+
 	csr := msg.CSRReqMessage.CSR
 
-	// NOTE: we're blocking the RenewalReq if the challenge does not match, because otherwise we don't have any authentication.
-	// The macOS SCEP client performs renewals using PKCSreq. The CertNanny SCEP client will use PKCSreq with challenge too, it seems,
-	// even if using the renewal flow as described in the README.md. MicroMDM SCEP client also only does PKCSreq by default, unless
-	// a certificate exists; then it will use RenewalReq. Adding the challenge check here may be a small breaking change for clients.
-	// We'll have to see how it works out.
-	if msg.MessageType == microscep.PKCSReq || msg.MessageType == microscep.RenewalReq {
-		challengeMatches, err := auth.MatchChallengePassword(ctx, msg.CSRReqMessage.ChallengePassword)
+	// NOTE: the macOS SCEP client performs renewals using PKCSreq. The CertNanny SCEP client will use PKCSreq with challenge too, it seems,
+	// even if using the renewal flow as described in the README.md. These requests are authenticated with the challenge. The MicroMDM
+	// SCEP client uses RenewalReq if a certificate exists; these requests are authenticated with the existing certificate, and the
+	// challenge, which clients SHOULD omit, is not checked.
+	if msg.MessageType == microscep.RenewalReq {
+		if err := auth.AuthorizeRenewal(ctx, msg); err != nil {
+			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, fmt.Errorf("error when authorizing renewal: %w", err))
+		}
+	} else {
+		// A client resending a request that is pending approval gets the
+		// reply for the stored request. Its challenge has already been
+		// consumed, so it cannot be validated again.
+		if auth.RequiresApproval(ctx) {
+			certRep, found, err := auth.ResendPendingRequest(ctx, csr, msg)
+			if err != nil {
+				return createFailureResponse(ctx, csr, msg, microscep.BadRequest, fmt.Errorf("error when processing resent request: %w", err))
+			}
+			if found {
+				return newCertRepResponse(certRep), nil
+			}
+		}
+
+		challengeMatches, err := auth.MatchChallengePassword(ctx, msg.CSRReqMessage.ChallengePassword, string(msg.TransactionID), csr)
 		if err != nil {
 			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("error when checking password"))
 		}
@@ -320,28 +342,44 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 			// TODO: can this be returned safely to the client? In the end, if the password was correct, that gains a bit of info too.
 			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("wrong password provided"))
 		}
-	}
 
-	// TODO: authorize renewal: we can authorize renewals with the challenge password (if reusable secrets are used).
-	// Renewals OPTIONALLY include the challenge if the existing cert is used as authentication, but client SHOULD omit the challenge.
-	// This means that for renewal requests we should check the certificate provided to be signed before by the CA. We could
-	// enforce use of the challenge if we want too. That way we could be more flexible in terms of authentication scheme (i.e. reusing
-	// tokens from other provisioners, calling a webhook, storing multiple secrets, allowing them to be multi-use, etc).
-	// Authentication by the (self-signed) certificate with an optional challenge is required; supporting renewals incl. verification
-	// of the client cert is not.
+		// Dynamic challenges can only be used once. The challenge is consumed
+		// atomically before the certificate is signed or the request is
+		// stored, so concurrent requests cannot reuse it.
+		if err := auth.ConsumeChallengePassword(ctx, msg.CSRReqMessage.ChallengePassword); err != nil {
+			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("error when using password"))
+		}
+	}
 
-	certRep, err := auth.SignCSR(ctx, csr, msg)
-	if err != nil {
-		return createFailureResponse(ctx, csr, msg, microscep.BadRequest, fmt.Errorf("error when signing new certificate: %w", err))
+	// New requests are kept pending until approved if the provisioner
+	// requires it. Renewals are authenticated with an issued certificate, so
+	// they don't require a new approval.
+	var certRep *scep.PKIMessage
+	if msg.MessageType != microscep.RenewalReq && auth.RequiresApproval(ctx) {
+		certRep, err = auth.CreatePendingRequest(ctx, csr, msg)
+		if err != nil {
+			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, fmt.Errorf("error when storing pending request: %w", err))
+		}
+	} else {
+		certRep, err = auth.SignCSR(ctx, csr, msg)
+		if err != nil {
+			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, fmt.Errorf("error when signing new certificate: %w", err))
+		}
 	}
 
+	return newCertRepResponse(certRep), nil
+}
+
+// newCertRepResponse returns the response for a CertRep message.
+func newCertRepResponse(certRep *scep.PKIMessage) Response {
 	res := Response{
-		Operation:   opnPKIOperation,
-		Data:        certRep.Raw,
-		Certificate: certRep.Certificate,
+		Operation: opnPKIOperation,
+		Data:      certRep.Raw,
 	}
-
-	return res, nil
+	if certRep.CertRepMessage != nil {
+		res.Certificate = certRep.Certificate
+	}
+	return res
 }
 
 func formatCapabilities(caps []string) []byte {
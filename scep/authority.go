@@ -1,12 +1,17 @@
 package scep
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"time"
 
 	microx509util "github.com/micromdm/scep/v2/cryptoutil/x509util"
 	microscep "github.com/micromdm/scep/v2/scep"
@@ -15,6 +20,8 @@ import (
 	"go.step.sm/crypto/x509util"
 
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql/database"
 )
 
 // Authority is the layer that handles all SCEP interactions.
@@ -220,8 +227,17 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 			ChallengePassword: cp,
 		}
 		return nil
-	case microscep.GetCRL, microscep.GetCert, microscep.CertPoll:
-		return errors.New("not implemented")
+	case microscep.CertPoll:
+		// GetCertInitial requests are matched with the pending request using
+		// the transaction ID, the issuer and subject are not required.
+		return nil
+	case microscep.GetCRL, microscep.GetCert:
+		ias, err := parseIssuerAndSerial(msg.pkiEnvelope)
+		if err != nil {
+			return fmt.Errorf("parse issuer and serial number from pkiEnvelope: %w", err)
+		}
+		msg.IssuerAndSerial = ias
+		return nil
 	}
 
 	return nil
@@ -230,18 +246,13 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 // SignCSR creates an x509.Certificate based on a CSR template and Cert Authority credentials
 // returns a new PKIMessage with CertRep data
 func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) (*PKIMessage, error) {
-	// TODO: intermediate storage of the request? In SCEP it's possible to request a csr/certificate
-	// to be signed, which can be performed asynchronously / out-of-band. In that case a client can
-	// poll for the status. It seems to be similar as what can happen in ACME, so might want to model
-	// the implementation after the one in the ACME authority. Requires storage, etc.
-
 	p, err := provisionerFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// check if CSRReqMessage has already been decrypted
-	if msg.CSRReqMessage.CSR == nil {
+	if csr == nil {
 		if err := a.DecryptPKIEnvelope(ctx, msg); err != nil {
 			return nil, err
 		}
@@ -295,14 +306,24 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	}
 
 	// take the issued certificate (only); https://tools.ietf.org/html/rfc8894#section-3.3.2
-	cert := certChain[0]
+	return a.createSuccessResponse(p, certChain[0], msg)
+}
 
-	// and create a degenerate cert structure
+// createSuccessResponse creates a CertRep message with the given certificate.
+func (a *Authority) createSuccessResponse(p Provisioner, cert *x509.Certificate, msg *PKIMessage) (*PKIMessage, error) {
+	// create a degenerate cert structure
 	deg, err := microscep.DegenerateCertificates([]*x509.Certificate{cert})
 	if err != nil {
 		return nil, err
 	}
 
+	return a.createEnvelopedResponse(p, deg, cert, msg)
+}
+
+// createEnvelopedResponse creates a CertRep message with the SUCCESS status
+// and the given degenerate PKCS#7 structure encrypted for the requester. The
+// certificate is optional, it's only set when a certificate is returned.
+func (a *Authority) createEnvelopedResponse(p Provisioner, deg []byte, cert *x509.Certificate, msg *PKIMessage) (*PKIMessage, error) {
 	// apparently the pkcs7 library uses a global default setting for the content encryption
 	// algorithm to use when en- or decrypting data. We need to restore the current setting after
 	// the cryptographic operation, so that other usages of the library are not influenced by
@@ -310,10 +331,10 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	encryptionAlgorithmToRestore := pkcs7.ContentEncryptionAlgorithm
 	pkcs7.ContentEncryptionAlgorithm = p.GetContentEncryptionAlgorithm()
 	e7, err := pkcs7.Encrypt(deg, msg.P7.Certificates)
+	pkcs7.ContentEncryptionAlgorithm = encryptionAlgorithmToRestore
 	if err != nil {
 		return nil, err
 	}
-	pkcs7.ContentEncryptionAlgorithm = encryptionAlgorithmToRestore
 
 	// PKIMessageAttributes to be signed
 	config := pkcs7.SignerInfoConfig{
@@ -349,7 +370,9 @@ func (a *Authority) SignCSR(ctx context.Context, csr *x509.CertificateRequest, m
 	// add the certificate into the signed data type
 	// this cert must be added before the signedData because the recipient will expect it
 	// as the first certificate in the array
-	signedData.AddCertificate(cert)
+	if cert != nil {
+		signedData.AddCertificate(cert)
+	}
 
 	authCert := a.intermediateCertificate
 
@@ -448,24 +471,565 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, csr *x509.Certifi
 	return crepMsg, nil
 }
 
-// MatchChallengePassword verifies a SCEP challenge password
-func (a *Authority) MatchChallengePassword(ctx context.Context, password string) (bool, error) {
+// CreatePendingResponse creates an appropriately signed reply with the PENDING
+// status for requests that have not been approved yet.
+func (a *Authority) CreatePendingResponse(ctx context.Context, msg *PKIMessage) (*PKIMessage, error) {
+	config := pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{
+				Type:  oidSCEPtransactionID,
+				Value: msg.TransactionID,
+			},
+			{
+				Type:  oidSCEPpkiStatus,
+				Value: microscep.PENDING,
+			},
+			{
+				Type:  oidSCEPmessageType,
+				Value: microscep.CertRep,
+			},
+			{
+				Type:  oidSCEPsenderNonce,
+				Value: msg.SenderNonce,
+			},
+			{
+				Type:  oidSCEPrecipientNonce,
+				Value: msg.SenderNonce,
+			},
+		},
+	}
+
+	signedData, err := pkcs7.NewSignedData(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// sign the attributes
+	if err := signedData.AddSigner(a.intermediateCertificate, a.service.signer, config); err != nil {
+		return nil, err
+	}
+
+	certRepBytes, err := signedData.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &CertRepMessage{
+		PKIStatus:      microscep.PENDING,
+		RecipientNonce: microscep.RecipientNonce(msg.SenderNonce),
+	}
+
+	// create a CertRep message from the original
+	crepMsg := &PKIMessage{
+		Raw:            certRepBytes,
+		TransactionID:  msg.TransactionID,
+		MessageType:    microscep.CertRep,
+		CertRepMessage: cr,
+	}
+
+	return crepMsg, nil
+}
+
+// AuthorizeRenewal authorizes a RenewalReq message. Renewals are authenticated
+// with the existing certificate used to sign the message instead of a
+// challenge password. The certificate must have been issued by the same
+// provisioner, it cannot be revoked, and the CSR cannot request names that
+// are not in the certificate.
+func (a *Authority) AuthorizeRenewal(ctx context.Context, msg *PKIMessage) error {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	cert := msg.P7.GetOnlySigner()
+	if cert == nil {
+		return errors.New("renewal request must be signed by the certificate to renew")
+	}
+	if a.intermediateCertificate == nil {
+		return errors.New("no intermediate certificate available in SCEP authority")
+	}
+	if err := cert.CheckSignatureFrom(a.intermediateCertificate); err != nil {
+		return fmt.Errorf("renewal request is not signed by a certificate issued by the CA: %w", err)
+	}
+	if ext, ok := provisioner.GetProvisionerExtension(cert); !ok || ext.Type != provisioner.TypeSCEP || ext.Name != p.GetName() {
+		return fmt.Errorf("certificate was not issued by provisioner %s", p.GetName())
+	}
+	if err := p.AuthorizeRenew(ctx, cert); err != nil {
+		return err
+	}
+
+	if authDB, ok := db.FromContext(ctx); ok {
+		isRevoked, err := authDB.IsRevoked(cert.SerialNumber.String())
+		if err != nil {
+			return fmt.Errorf("error checking certificate revocation: %w", err)
+		}
+		if isRevoked {
+			return errors.New("certificate has been revoked")
+		}
+	}
+
+	csr := msg.CSRReqMessage.CSR
+	if csr.Subject.CommonName != cert.Subject.CommonName {
+		return fmt.Errorf("certificate request subject %q does not match certificate subject %q", csr.Subject.CommonName, cert.Subject.CommonName)
+	}
+	certSANs := subjectAltNames(cert.DNSNames, cert.EmailAddresses, cert.IPAddresses, cert.URIs)
+	for _, san := range CSRSANs(csr) {
+		if !containsString(certSANs, san) {
+			return fmt.Errorf("certificate request name %s is not in the certificate", san)
+		}
+	}
+
+	return nil
+}
+
+// RequiresApproval returns true if new requests to the provisioner in the
+// context must be approved before issuing a certificate.
+func (a *Authority) RequiresApproval(ctx context.Context) bool {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return p.RequiresApproval()
+}
+
+// CreatePendingRequest stores a request that requires a manual approval and
+// returns a CertRep message with the PENDING status. If the client retries a
+// request that has already been stored, the reply depends on the status of the
+// stored request.
+func (a *Authority) CreatePendingRequest(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) (*PKIMessage, error) {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	requestDB, ok := scepRequestDBFromContext(ctx)
+	if !ok {
+		return nil, errors.New("database does not support pending scep requests")
+	}
+	signerKey, err := requestSignerKey(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	req := &db.SCEPRequest{
+		ID:            db.SCEPRequestID(p.GetName(), string(msg.TransactionID)),
+		Provisioner:   p.GetName(),
+		TransactionID: string(msg.TransactionID),
+		CSR:           csr.Raw,
+		SignerKey:     signerKey,
+		Status:        db.SCEPRequestPending,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	switch err := requestDB.CreateSCEPRequest(req); {
+	case errors.Is(err, db.ErrAlreadyExists):
+		stored, err := requestDB.GetSCEPRequest(req.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving scep request: %w", err)
+		}
+		return a.processResentRequest(ctx, requestDB, stored, csr, msg)
+	case err != nil:
+		return nil, fmt.Errorf("error storing scep request: %w", err)
+	default:
+		return a.CreatePendingResponse(ctx, msg)
+	}
+}
+
+// ResendPendingRequest returns the reply for a request with the same
+// transaction ID as the given message that has already been stored, and
+// reports whether the request was found. The challenge of a resent request
+// has already been consumed, so this must be checked before validating it.
+func (a *Authority) ResendPendingRequest(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) (*PKIMessage, bool, error) {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	requestDB, ok := scepRequestDBFromContext(ctx)
+	if !ok {
+		return nil, false, nil
+	}
+
+	stored, err := requestDB.GetSCEPRequest(db.SCEPRequestID(p.GetName(), string(msg.TransactionID)))
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, fmt.Errorf("error retrieving scep request: %w", err)
+	}
+
+	certRep, err := a.processResentRequest(ctx, requestDB, stored, csr, msg)
+	return certRep, true, err
+}
+
+// processResentRequest creates the reply for a request that has been resent
+// by the client. The request must have the same CSR as the stored one.
+func (a *Authority) processResentRequest(ctx context.Context, requestDB db.SCEPRequestDB, stored *db.SCEPRequest, csr *x509.CertificateRequest, msg *PKIMessage) (*PKIMessage, error) {
+	if !bytes.Equal(stored.CSR, csr.Raw) {
+		return nil, fmt.Errorf("transaction %s is already in use", msg.TransactionID)
+	}
+	return a.processRequest(ctx, requestDB, stored, msg)
+}
+
+// PollCertificate handles GetCertInitial messages. It returns a CertRep
+// message with the PENDING status if the request has not been approved yet,
+// or the certificate if it has been approved.
+func (a *Authority) PollCertificate(ctx context.Context, msg *PKIMessage) (*PKIMessage, error) {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	requestDB, ok := scepRequestDBFromContext(ctx)
+	if !ok {
+		return nil, errors.New("database does not support pending scep requests")
+	}
+
+	req, err := requestDB.GetSCEPRequest(db.SCEPRequestID(p.GetName(), string(msg.TransactionID)))
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, fmt.Errorf("transaction %s not found", msg.TransactionID)
+	case err != nil:
+		return nil, fmt.Errorf("error retrieving scep request: %w", err)
+	}
+
+	return a.processRequest(ctx, requestDB, req, msg)
+}
+
+// processRequest creates the reply for a stored request depending on its
+// status. Approved requests are signed the first time the client asks for
+// them. The message must be signed with the same key as the original request.
+func (a *Authority) processRequest(ctx context.Context, requestDB db.SCEPRequestDB, req *db.SCEPRequest, msg *PKIMessage) (*PKIMessage, error) {
+	signerKey, err := requestSignerKey(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.SignerKey) == 0 || subtle.ConstantTimeCompare(req.SignerKey, signerKey) != 1 {
+		return nil, fmt.Errorf("transaction %s not found", msg.TransactionID)
+	}
+
+	switch req.Status {
+	case db.SCEPRequestPending, db.SCEPRequestIssuing:
+		return a.CreatePendingResponse(ctx, msg)
+	case db.SCEPRequestRejected:
+		return nil, errors.New("request has been rejected")
+	case db.SCEPRequestApproved:
+		return a.issueRequest(ctx, requestDB, req, msg)
+	case db.SCEPRequestIssued:
+		p, err := provisionerFromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		authDB, ok := db.FromContext(ctx)
+		if !ok {
+			return nil, errors.New("database is not available")
+		}
+		cert, err := authDB.GetCertificate(req.SerialNumber)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving certificate %s: %w", req.SerialNumber, err)
+		}
+		return a.createSuccessResponse(p, cert, msg)
+	default:
+		return nil, fmt.Errorf("unexpected scep request status %s", req.Status)
+	}
+}
+
+// issueRequest signs the certificate of an approved request. The request is
+// claimed first, moving it to the issuing status, so only one of concurrent
+// polls signs a certificate; the others get a PENDING reply, or the
+// certificate if it has already been issued.
+func (a *Authority) issueRequest(ctx context.Context, requestDB db.SCEPRequestDB, req *db.SCEPRequest, msg *PKIMessage) (*PKIMessage, error) {
+	csr, err := x509.ParseCertificateRequest(req.CSR)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing stored certificate request: %w", err)
+	}
+
+	issuing := *req
+	issuing.Status = db.SCEPRequestIssuing
+	issuing.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	switch err := requestDB.UpdateSCEPRequest(&issuing, db.SCEPRequestApproved); {
+	case errors.Is(err, db.ErrAlreadyExists):
+		stored, err := requestDB.GetSCEPRequest(req.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving scep request: %w", err)
+		}
+		if stored.Status == db.SCEPRequestApproved {
+			return nil, errors.New("error claiming scep request")
+		}
+		return a.processRequest(ctx, requestDB, stored, msg)
+	case err != nil:
+		return nil, fmt.Errorf("error updating scep request: %w", err)
+	}
+
+	certRep, err := a.SignCSR(ctx, csr, msg)
+	if err != nil {
+		// Release the request so it can be signed in another poll.
+		approved := issuing
+		approved.Status = db.SCEPRequestApproved
+		approved.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+		if uerr := requestDB.UpdateSCEPRequest(&approved, db.SCEPRequestIssuing); uerr != nil {
+			return nil, fmt.Errorf("%w; error releasing scep request: %v", err, uerr)
+		}
+		return nil, err
+	}
+
+	issued := issuing
+	issued.Status = db.SCEPRequestIssued
+	issued.SerialNumber = certRep.Certificate.SerialNumber.String()
+	issued.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := requestDB.UpdateSCEPRequest(&issued, db.SCEPRequestIssuing); err != nil {
+		return nil, fmt.Errorf("error updating scep request: %w", err)
+	}
+	return certRep, nil
+}
+
+// requestSignerKey returns the public key of the certificate that signed a
+// SCEP message.
+func requestSignerKey(msg *PKIMessage) ([]byte, error) {
+	if msg.P7 == nil {
+		return nil, errors.New("message is not signed")
+	}
+	signer := msg.P7.GetOnlySigner()
+	if signer == nil {
+		return nil, errors.New("message must have exactly one signer")
+	}
+	return signer.RawSubjectPublicKeyInfo, nil
+}
+
+// GetCert handles GetCert messages. It returns the certificate with the
+// issuer and serial number in the request.
+func (a *Authority) GetCert(ctx context.Context, msg *PKIMessage) (*PKIMessage, error) {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	authDB, ok := db.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("database is not available")
+	}
+
+	serialNumber := msg.IssuerAndSerial.SerialNumber.String()
+	cert, err := authDB.GetCertificate(serialNumber)
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, fmt.Errorf("certificate %s not found", serialNumber)
+	case err != nil:
+		return nil, fmt.Errorf("error retrieving certificate %s: %w", serialNumber, err)
+	case !bytes.Equal(cert.RawIssuer, msg.IssuerAndSerial.RawIssuer):
+		return nil, fmt.Errorf("certificate %s not found", serialNumber)
+	}
+
+	return a.createSuccessResponse(p, cert, msg)
+}
+
+// GetCRL handles GetCRL messages. It returns the latest certificate
+// revocation list if the issuer in the request is the CA.
+func (a *Authority) GetCRL(ctx context.Context, msg *PKIMessage) (*PKIMessage, error) {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if a.intermediateCertificate == nil {
+		return nil, errors.New("no intermediate certificate available in SCEP authority")
+	}
+	if !bytes.Equal(a.intermediateCertificate.RawSubject, msg.IssuerAndSerial.RawIssuer) {
+		return nil, errors.New("certificate revocation list not found for issuer")
+	}
+
+	authDB, ok := db.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("database is not available")
+	}
+	crlDB, ok := authDB.(db.CertificateRevocationListDB)
+	if !ok {
+		return nil, errors.New("database does not support certificate revocation lists")
+	}
+	crlInfo, err := crlDB.GetCRL()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving certificate revocation list: %w", err)
+	}
+	if crlInfo == nil {
+		return nil, errors.New("certificate revocation list has not been generated")
+	}
+
+	deg, err := degenerateCRL(crlInfo.DER)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.createEnvelopedResponse(p, deg, nil, msg)
+}
+
+// scepRequestDBFromContext returns the authority database from the context if
+// it supports storing pending requests.
+func scepRequestDBFromContext(ctx context.Context) (db.SCEPRequestDB, bool) {
+	authDB, ok := db.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	requestDB, ok := authDB.(db.SCEPRequestDB)
+	return requestDB, ok
+}
+
+// MatchChallengePassword verifies a SCEP challenge password. The password can
+// be the static challenge of the provisioner, a dynamic challenge created
+// using the admin API, or a challenge validated by the provisioner webhook.
+func (a *Authority) MatchChallengePassword(ctx context.Context, password, transactionID string, csr *x509.CertificateRequest) (bool, error) {
 	p, err := provisionerFromContext(ctx)
 	if err != nil {
 		return false, err
 	}
 
-	if subtle.ConstantTimeCompare([]byte(p.GetChallengePassword()), []byte(password)) == 1 {
-		return true, nil
+	// An empty static challenge is only accepted if there's no other way to
+	// validate the challenge.
+	staticPassword := p.GetChallengePassword()
+	if staticPassword != "" || (!p.HasDynamicChallenges() && !p.HasChallengeWebhook()) {
+		if subtle.ConstantTimeCompare([]byte(staticPassword), []byte(password)) == 1 {
+			return true, nil
+		}
+	}
+
+	if p.HasDynamicChallenges() && password != "" {
+		if challengeDB, ok := scepChallengeDBFromContext(ctx); ok {
+			ch, err := getSCEPChallenge(challengeDB, password)
+			if err != nil {
+				return false, err
+			}
+			if ch != nil {
+				return matchSCEPChallenge(ch, p.GetName(), csr), nil
+			}
+		}
 	}
 
-	// TODO: support dynamic challenges, i.e. a list of challenges instead of one?
-	// That's probably a bit harder to configure, though; likely requires some data store
-	// that can be interacted with more easily, via some internal API, for example.
+	if p.HasChallengeWebhook() {
+		return p.ValidateChallengeWebhook(ctx, password, transactionID, csr)
+	}
 
 	return false, nil
 }
 
+// ConsumeChallengePassword marks a dynamic challenge password as used, so it
+// cannot be used in another enrollment. It does nothing if the password is not
+// a dynamic challenge.
+func (a *Authority) ConsumeChallengePassword(ctx context.Context, password string) error {
+	p, err := provisionerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.HasDynamicChallenges() || password == "" {
+		return nil
+	}
+
+	challengeDB, ok := scepChallengeDBFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	ch, err := getSCEPChallenge(challengeDB, password)
+	if err != nil || ch == nil {
+		return err
+	}
+	if err := challengeDB.UseSCEPChallenge(ch.ID); err != nil {
+		return fmt.Errorf("error using scep challenge: %w", err)
+	}
+	return nil
+}
+
+// ChallengeID returns the identifier used to store a dynamic challenge
+// password.
+func ChallengeID(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// scepChallengeDBFromContext returns the authority database from the context
+// if it supports dynamic challenges.
+func scepChallengeDBFromContext(ctx context.Context) (db.SCEPChallengeDB, bool) {
+	authDB, ok := db.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	challengeDB, ok := authDB.(db.SCEPChallengeDB)
+	return challengeDB, ok
+}
+
+// getSCEPChallenge returns the dynamic challenge for the given password. It
+// returns nil if the challenge does not exist.
+func getSCEPChallenge(challengeDB db.SCEPChallengeDB, password string) (*db.SCEPChallenge, error) {
+	ch, err := challengeDB.GetSCEPChallenge(ChallengeID(password))
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("error retrieving scep challenge: %w", err)
+	default:
+		return ch, nil
+	}
+}
+
+// matchSCEPChallenge checks that the dynamic challenge belongs to the
+// provisioner, that it can still be used, and that the CSR matches the subject
+// and SANs the challenge is bound to.
+func matchSCEPChallenge(ch *db.SCEPChallenge, provisionerName string, csr *x509.CertificateRequest) bool {
+	switch {
+	case ch.Provisioner != provisionerName:
+		return false
+	case !ch.UsedAt.IsZero():
+		return false
+	case time.Now().After(ch.ExpiresAt):
+		return false
+	}
+
+	if ch.Subject == "" && len(ch.SANs) == 0 {
+		return true
+	}
+	if csr == nil {
+		return false
+	}
+	if ch.Subject != "" && csr.Subject.CommonName != ch.Subject {
+		return false
+	}
+	if len(ch.SANs) > 0 {
+		sans := CSRSANs(csr)
+		if len(sans) == 0 {
+			return false
+		}
+		for _, san := range sans {
+			if !containsString(ch.SANs, san) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CSRSANs returns the string representation of the subject alternative names
+// in the CSR.
+func CSRSANs(csr *x509.CertificateRequest) []string {
+	return subjectAltNames(csr.DNSNames, csr.EmailAddresses, csr.IPAddresses, csr.URIs)
+}
+
+// subjectAltNames returns the string representation of the given subject
+// alternative names.
+func subjectAltNames(dnsNames, emailAddresses []string, ips []net.IP, uris []*url.URL) []string {
+	var sans []string
+	sans = append(sans, dnsNames...)
+	sans = append(sans, emailAddresses...)
+	for _, ip := range ips {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range uris {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCACaps returns the CA capabilities
 func (a *Authority) GetCACaps(ctx context.Context) []string {
 	p, err := provisionerFromContext(ctx)
@@ -475,14 +1039,24 @@ func (a *Authority) GetCACaps(ctx context.Context) []string {
 
 	caps := p.GetCapabilities()
 	if len(caps) == 0 {
-		return defaultCapabilities
+		caps = defaultCapabilities
 	}
 
 	// TODO: validate the caps? Ensure they are the right format according to RFC?
-	// TODO: ensure that the capabilities are actually "enforced"/"verified" in code too:
-	// check that only parts of the spec are used in the implementation belonging to the capabilities.
-	// For example for renewals, which we could disable in the provisioner, should then also
-	// not be reported in cacaps operation.
 
-	return caps
+	// Only advertise the capabilities the provisioner actually supports.
+	supported := make([]string, 0, len(caps))
+	for _, c := range caps {
+		switch c {
+		case "Renewal":
+			if !p.IsRenewalEnabled() {
+				continue
+			}
+		case "GetNextCACert":
+			continue
+		}
+		supported = append(supported, c)
+	}
+
+	return supported
 }
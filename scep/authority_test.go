@@ -0,0 +1,786 @@
+package scep
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	microscep "github.com/micromdm/scep/v2/scep"
+	"go.mozilla.org/pkcs7"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql/database"
+)
+
+type mockProvisioner struct {
+	Provisioner
+	name                      string
+	challengePassword         string
+	dynamicChallenges         bool
+	challengeWebhook          bool
+	mValidateChallengeWebhook func(ctx context.Context, challenge, transactionID string, csr *x509.CertificateRequest) (bool, error)
+	capabilities              []string
+	renewalDisabled           bool
+	requiresApproval          bool
+	mAuthorizeRenew           func(ctx context.Context, cert *x509.Certificate) error
+	encryptionAlgorithm       int
+}
+
+func (m *mockProvisioner) GetName() string {
+	return m.name
+}
+
+func (m *mockProvisioner) GetChallengePassword() string {
+	return m.challengePassword
+}
+
+func (m *mockProvisioner) HasDynamicChallenges() bool {
+	return m.dynamicChallenges
+}
+
+func (m *mockProvisioner) HasChallengeWebhook() bool {
+	return m.challengeWebhook
+}
+
+func (m *mockProvisioner) ValidateChallengeWebhook(ctx context.Context, challenge, transactionID string, csr *x509.CertificateRequest) (bool, error) {
+	if m.mValidateChallengeWebhook != nil {
+		return m.mValidateChallengeWebhook(ctx, challenge, transactionID, csr)
+	}
+	return false, nil
+}
+
+func (m *mockProvisioner) GetCapabilities() []string {
+	return m.capabilities
+}
+
+func (m *mockProvisioner) IsRenewalEnabled() bool {
+	return !m.renewalDisabled
+}
+
+func (m *mockProvisioner) GetContentEncryptionAlgorithm() int {
+	return m.encryptionAlgorithm
+}
+
+func (m *mockProvisioner) RequiresApproval() bool {
+	return m.requiresApproval
+}
+
+func (m *mockProvisioner) AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error {
+	if m.mAuthorizeRenew != nil {
+		return m.mAuthorizeRenew(ctx, cert)
+	}
+	return nil
+}
+
+var _ Provisioner = (*mockProvisioner)(nil)
+var _ Provisioner = (*provisioner.SCEP)(nil)
+
+func newChallengeContext(p Provisioner, authDB db.AuthDB) context.Context {
+	ctx := context.WithValue(context.Background(), ProvisionerContextKey, p)
+	if authDB != nil {
+		ctx = db.NewContext(ctx, authDB)
+	}
+	return ctx
+}
+
+func TestAuthority_MatchChallengePassword(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	csr := &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "device"},
+		DNSNames:    []string{"device.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:        []*url.URL{{Scheme: "urn", Opaque: "device:1234"}},
+	}
+	challengeDB := func(ch *db.SCEPChallenge, err error) db.AuthDB {
+		return &db.MockAuthDB{
+			MGetSCEPChallenge: func(id string) (*db.SCEPChallenge, error) {
+				if id != ChallengeID("dynamic") {
+					return nil, database.ErrNotFound
+				}
+				return ch, err
+			},
+		}
+	}
+	webhook := func(ctx context.Context, challenge, transactionID string, csr *x509.CertificateRequest) (bool, error) {
+		if transactionID != "transaction" {
+			return false, errors.New("unexpected transaction")
+		}
+		return challenge == "webhook", nil
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{"ok static", newChallengeContext(&mockProvisioner{challengePassword: "static"}, nil), "static", true, false},
+		{"ok empty static", newChallengeContext(&mockProvisioner{}, nil), "", true, false},
+		{"ok dynamic", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: future,
+		}, nil)), "dynamic", true, false},
+		{"ok dynamic bound", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: future, Subject: "device", SANs: []string{"device.example.com", "10.0.0.1", "urn:device:1234", "other.example.com"},
+		}, nil)), "dynamic", true, false},
+		{"ok dynamic with static", newChallengeContext(&mockProvisioner{name: "scep", challengePassword: "static", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: future,
+		}, nil)), "dynamic", true, false},
+		{"ok webhook", newChallengeContext(&mockProvisioner{challengeWebhook: true, mValidateChallengeWebhook: webhook}, nil), "webhook", true, false},
+		{"ok webhook with dynamic", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true, challengeWebhook: true, mValidateChallengeWebhook: webhook}, challengeDB(nil, nil)), "webhook", true, false},
+		{"fail static", newChallengeContext(&mockProvisioner{challengePassword: "static"}, nil), "wrong", false, false},
+		{"fail empty static with dynamic", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(nil, nil)), "", false, false},
+		{"fail empty static with webhook", newChallengeContext(&mockProvisioner{challengeWebhook: true, mValidateChallengeWebhook: webhook}, nil), "", false, false},
+		{"fail dynamic not found", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(nil, nil)), "wrong", false, false},
+		{"fail dynamic no db", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, nil), "dynamic", false, false},
+		{"fail dynamic provisioner", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "other", ExpiresAt: future,
+		}, nil)), "dynamic", false, false},
+		{"fail dynamic expired", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: past,
+		}, nil)), "dynamic", false, false},
+		{"fail dynamic used", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: future, UsedAt: past,
+		}, nil)), "dynamic", false, false},
+		{"fail dynamic subject", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: future, Subject: "other",
+		}, nil)), "dynamic", false, false},
+		{"fail dynamic sans", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(&db.SCEPChallenge{
+			Provisioner: "scep", ExpiresAt: future, SANs: []string{"device.example.com"},
+		}, nil)), "dynamic", false, false},
+		{"fail dynamic db", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(nil, errors.New("force"))), "dynamic", false, true},
+		{"fail webhook", newChallengeContext(&mockProvisioner{challengeWebhook: true, mValidateChallengeWebhook: webhook}, nil), "wrong", false, false},
+		{"fail no provisioner", context.Background(), "static", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{}
+			got, err := a.MatchChallengePassword(tt.ctx, tt.password, "transaction", csr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.MatchChallengePassword() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Authority.MatchChallengePassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthority_ConsumeChallengePassword(t *testing.T) {
+	var usedID string
+	challengeDB := func(useErr error) db.AuthDB {
+		return &db.MockAuthDB{
+			MGetSCEPChallenge: func(id string) (*db.SCEPChallenge, error) {
+				if id != ChallengeID("dynamic") {
+					return nil, database.ErrNotFound
+				}
+				return &db.SCEPChallenge{ID: id, Provisioner: "scep"}, nil
+			},
+			MUseSCEPChallenge: func(id string) error {
+				usedID = id
+				return useErr
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		password string
+		wantUsed string
+		wantErr  bool
+	}{
+		{"ok", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(nil)), "dynamic", ChallengeID("dynamic"), false},
+		{"ok static", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(nil)), "static", "", false},
+		{"ok not dynamic", newChallengeContext(&mockProvisioner{name: "scep"}, challengeDB(nil)), "dynamic", "", false},
+		{"ok no db", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, nil), "dynamic", "", false},
+		{"fail used", newChallengeContext(&mockProvisioner{name: "scep", dynamicChallenges: true}, challengeDB(db.ErrAlreadyExists)), "dynamic", ChallengeID("dynamic"), true},
+		{"fail no provisioner", context.Background(), "dynamic", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usedID = ""
+			a := &Authority{}
+			if err := a.ConsumeChallengePassword(tt.ctx, tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("Authority.ConsumeChallengePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if usedID != tt.wantUsed {
+				t.Errorf("Authority.ConsumeChallengePassword() used = %v, want %v", usedID, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func mustCertificate(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func mustCSR(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "device"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func mustSignedPKCS7(t *testing.T, cert *x509.Certificate, signer crypto.Signer) *pkcs7.PKCS7 {
+	t.Helper()
+	sd, err := pkcs7.NewSignedData([]byte("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert != nil {
+		if err := sd.AddSigner(cert, signer, pkcs7.SignerInfoConfig{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	der, err := sd.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p7
+}
+
+func TestAuthority_GetCACaps(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{"ok default", newChallengeContext(&mockProvisioner{}, nil), defaultCapabilities},
+		{"ok no provisioner", context.Background(), defaultCapabilities},
+		{"ok configured", newChallengeContext(&mockProvisioner{capabilities: []string{"Renewal", "SHA-256", "GetNextCACert"}}, nil), []string{"Renewal", "SHA-256"}},
+		{"ok renewal disabled", newChallengeContext(&mockProvisioner{renewalDisabled: true}, nil), []string{"SHA-1", "SHA-256", "AES", "DES3", "SCEPStandard", "POSTPKIOperation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{}
+			if got := a.GetCACaps(tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authority.GetCACaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthority_AuthorizeRenewal(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := mustCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}}, caKey.Public(), caKey)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLeaf := func(provisionerName string, parent *x509.Certificate, signer crypto.Signer) *x509.Certificate {
+		ext, err := (&provisioner.Extension{Type: provisioner.TypeSCEP, Name: provisionerName}).ToExtension()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mustCertificate(t, &x509.Certificate{
+			SerialNumber:    big.NewInt(1234),
+			Subject:         pkix.Name{CommonName: "device"},
+			DNSNames:        []string{"device.example.com"},
+			NotBefore:       time.Now().Add(-time.Minute),
+			NotAfter:        time.Now().Add(time.Minute),
+			ExtraExtensions: []pkix.Extension{ext},
+		}, parent, key.Public(), signer)
+	}
+	leaf := newLeaf("scep", ca, caKey)
+	otherLeaf := newLeaf("other", ca, caKey)
+	selfSigned := newLeaf("scep", &x509.Certificate{Subject: pkix.Name{CommonName: "device"}}, key)
+
+	newMessage := func(cert *x509.Certificate, csr *x509.CertificateRequest) *PKIMessage {
+		return &PKIMessage{
+			P7:            mustSignedPKCS7(t, cert, key),
+			CSRReqMessage: &microscep.CSRReqMessage{CSR: csr},
+		}
+	}
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "device"},
+		DNSNames: []string{"device.example.com"},
+	}
+	revokedDB := func(revoked bool, err error) db.AuthDB {
+		return &db.MockAuthDB{
+			MIsRevoked: func(sn string) (bool, error) {
+				if sn != "1234" {
+					return false, errors.New("unexpected serial number")
+				}
+				return revoked, err
+			},
+		}
+	}
+	p := &mockProvisioner{name: "scep"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		msg     *PKIMessage
+		wantErr bool
+	}{
+		{"ok", newChallengeContext(p, nil), newMessage(leaf, csr), false},
+		{"ok not revoked", newChallengeContext(p, revokedDB(false, nil)), newMessage(leaf, csr), false},
+		{"ok no sans", newChallengeContext(p, nil), newMessage(leaf, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}}), false},
+		{"fail no provisioner", context.Background(), newMessage(leaf, csr), true},
+		{"fail no signer", newChallengeContext(p, nil), newMessage(nil, csr), true},
+		{"fail self-signed", newChallengeContext(p, nil), newMessage(selfSigned, csr), true},
+		{"fail other provisioner", newChallengeContext(p, nil), newMessage(otherLeaf, csr), true},
+		{"fail authorize renew", newChallengeContext(&mockProvisioner{name: "scep", mAuthorizeRenew: func(ctx context.Context, cert *x509.Certificate) error {
+			return errors.New("renew is disabled")
+		}}, nil), newMessage(leaf, csr), true},
+		{"fail revoked", newChallengeContext(p, revokedDB(true, nil)), newMessage(leaf, csr), true},
+		{"fail revoked db", newChallengeContext(p, revokedDB(false, errors.New("force"))), newMessage(leaf, csr), true},
+		{"fail subject", newChallengeContext(p, nil), newMessage(leaf, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"device.example.com"},
+		}), true},
+		{"fail sans", newChallengeContext(p, nil), newMessage(leaf, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "device"}, DNSNames: []string{"device.example.com", "other.example.com"},
+		}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{intermediateCertificate: ca}
+			if err := a.AuthorizeRenewal(tt.ctx, tt.msg); (err != nil) != tt.wantErr {
+				t.Errorf("Authority.AuthorizeRenewal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthority_PollCertificate(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := mustCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}}, caKey.Public(), caKey)
+
+	// Self-signed certificates of the SCEP client and of another client.
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	clientCert := mustCertificate(t, clientTemplate, clientTemplate, clientKey.Public(), clientKey)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert := mustCertificate(t, clientTemplate, clientTemplate, otherKey.Public(), otherKey)
+
+	p := &mockProvisioner{name: "scep", requiresApproval: true}
+	id := db.SCEPRequestID("scep", "transaction")
+	csr := mustCSR(t)
+	newRequest := func(status db.SCEPRequestStatus) *db.SCEPRequest {
+		return &db.SCEPRequest{ID: id, Provisioner: "scep", TransactionID: "transaction", CSR: csr, SignerKey: clientCert.RawSubjectPublicKeyInfo, Status: status}
+	}
+	requestDB := func(status db.SCEPRequestStatus, err error) db.AuthDB {
+		return &db.MockAuthDB{
+			MGetSCEPRequest: func(got string) (*db.SCEPRequest, error) {
+				if got != id {
+					return nil, database.ErrNotFound
+				}
+				if err != nil {
+					return nil, err
+				}
+				return newRequest(status), nil
+			},
+		}
+	}
+	// claimedDB returns a request that is approved the first time it is
+	// retrieved, and that another poll has claimed afterwards.
+	claimedDB := func(claimedStatus db.SCEPRequestStatus) db.AuthDB {
+		var polled bool
+		return &db.MockAuthDB{
+			MGetSCEPRequest: func(got string) (*db.SCEPRequest, error) {
+				if polled {
+					return newRequest(claimedStatus), nil
+				}
+				polled = true
+				return newRequest(db.SCEPRequestApproved), nil
+			},
+			MUpdateSCEPRequest: func(req *db.SCEPRequest, status db.SCEPRequestStatus) error {
+				if req.Status != db.SCEPRequestIssuing || status != db.SCEPRequestApproved {
+					t.Errorf("UpdateSCEPRequest() status = %s -> %s, want %s -> %s", status, req.Status, db.SCEPRequestApproved, db.SCEPRequestIssuing)
+				}
+				return db.ErrAlreadyExists
+			},
+		}
+	}
+	approvedDB := func(csr []byte, updateErr error) db.AuthDB {
+		return &db.MockAuthDB{
+			MGetSCEPRequest: func(got string) (*db.SCEPRequest, error) {
+				req := newRequest(db.SCEPRequestApproved)
+				req.CSR = csr
+				return req, nil
+			},
+			MUpdateSCEPRequest: func(req *db.SCEPRequest, status db.SCEPRequestStatus) error {
+				return updateErr
+			},
+		}
+	}
+	newMessage := func(cert *x509.Certificate, key crypto.Signer) *PKIMessage {
+		msg := &PKIMessage{
+			TransactionID: "transaction",
+			MessageType:   microscep.CertPoll,
+			SenderNonce:   []byte("nonce"),
+		}
+		if cert != nil {
+			msg.P7 = mustSignedPKCS7(t, cert, key)
+		}
+		return msg
+	}
+	msg := newMessage(clientCert, clientKey)
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		msg        *PKIMessage
+		wantStatus microscep.PKIStatus
+		wantErr    bool
+	}{
+		{"ok pending", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), msg, microscep.PENDING, false},
+		{"ok issuing", newChallengeContext(p, requestDB(db.SCEPRequestIssuing, nil)), msg, microscep.PENDING, false},
+		{"ok approved claimed", newChallengeContext(p, claimedDB(db.SCEPRequestIssuing)), msg, microscep.PENDING, false},
+		{"fail approved claimed rejected", newChallengeContext(p, claimedDB(db.SCEPRequestRejected)), msg, "", true},
+		{"fail approved release", newChallengeContext(p, claimedDB(db.SCEPRequestApproved)), msg, "", true},
+		{"fail approved csr", newChallengeContext(p, approvedDB([]byte("csr"), nil)), msg, "", true},
+		{"fail approved claim", newChallengeContext(p, approvedDB(csr, errors.New("force"))), msg, "", true},
+		{"fail rejected", newChallengeContext(p, requestDB(db.SCEPRequestRejected, nil)), msg, "", true},
+		{"fail unknown status", newChallengeContext(p, requestDB("foo", nil)), msg, "", true},
+		{"fail other signer", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), newMessage(otherCert, otherKey), "", true},
+		{"fail not signed", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), newMessage(nil, nil), "", true},
+		{"fail not found", newChallengeContext(&mockProvisioner{name: "other"}, requestDB(db.SCEPRequestPending, nil)), msg, "", true},
+		{"fail db", newChallengeContext(p, requestDB(db.SCEPRequestPending, errors.New("force"))), msg, "", true},
+		{"fail no db", newChallengeContext(p, nil), msg, "", true},
+		{"fail no provisioner", context.Background(), msg, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				intermediateCertificate: ca,
+				service:                 &Service{signer: caKey},
+			}
+			got, err := a.PollCertificate(tt.ctx, tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.PollCertificate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				if got.CertRepMessage == nil || got.PKIStatus != tt.wantStatus {
+					t.Errorf("Authority.PollCertificate() status = %v, want %v", got.CertRepMessage, tt.wantStatus)
+				}
+				if got.TransactionID != tt.msg.TransactionID {
+					t.Errorf("Authority.PollCertificate() transactionID = %v, want %v", got.TransactionID, tt.msg.TransactionID)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_ResendPendingRequest(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := mustCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}}, caKey.Public(), caKey)
+
+	// Self-signed certificates of the SCEP client and of another client.
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	clientCert := mustCertificate(t, clientTemplate, clientTemplate, clientKey.Public(), clientKey)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert := mustCertificate(t, clientTemplate, clientTemplate, otherKey.Public(), otherKey)
+
+	p := &mockProvisioner{name: "scep", requiresApproval: true, dynamicChallenges: true}
+	id := db.SCEPRequestID("scep", "transaction")
+	csrDER := mustCSR(t)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCSR, err := x509.ParseCertificateRequest(mustCSR(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestDB := func(status db.SCEPRequestStatus, err error) db.AuthDB {
+		return &db.MockAuthDB{
+			MGetSCEPRequest: func(got string) (*db.SCEPRequest, error) {
+				if got != id {
+					return nil, database.ErrNotFound
+				}
+				if err != nil {
+					return nil, err
+				}
+				return &db.SCEPRequest{ID: id, Provisioner: "scep", TransactionID: "transaction", CSR: csrDER, SignerKey: clientCert.RawSubjectPublicKeyInfo, Status: status}, nil
+			},
+		}
+	}
+	newMessage := func(transactionID string, cert *x509.Certificate, key crypto.Signer) *PKIMessage {
+		return &PKIMessage{
+			TransactionID: microscep.TransactionID(transactionID),
+			MessageType:   microscep.PKCSReq,
+			SenderNonce:   []byte("nonce"),
+			P7:            mustSignedPKCS7(t, cert, key),
+		}
+	}
+	msg := newMessage("transaction", clientCert, clientKey)
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		csr        *x509.CertificateRequest
+		msg        *PKIMessage
+		wantFound  bool
+		wantStatus microscep.PKIStatus
+		wantErr    bool
+	}{
+		{"ok pending", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), csr, msg, true, microscep.PENDING, false},
+		{"ok issuing", newChallengeContext(p, requestDB(db.SCEPRequestIssuing, nil)), csr, msg, true, microscep.PENDING, false},
+		{"ok not found", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), csr, newMessage("other", clientCert, clientKey), false, "", false},
+		{"ok no db", newChallengeContext(p, nil), csr, msg, false, "", false},
+		{"fail other csr", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), otherCSR, msg, true, "", true},
+		{"fail other signer", newChallengeContext(p, requestDB(db.SCEPRequestPending, nil)), csr, newMessage("transaction", otherCert, otherKey), true, "", true},
+		{"fail rejected", newChallengeContext(p, requestDB(db.SCEPRequestRejected, nil)), csr, msg, true, "", true},
+		{"fail db", newChallengeContext(p, requestDB(db.SCEPRequestPending, errors.New("force"))), csr, msg, false, "", true},
+		{"fail no provisioner", context.Background(), csr, msg, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Authority{
+				intermediateCertificate: ca,
+				service:                 &Service{signer: caKey},
+			}
+			got, found, err := a.ResendPendingRequest(tt.ctx, tt.csr, tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Authority.ResendPendingRequest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("Authority.ResendPendingRequest() found = %v, want %v", found, tt.wantFound)
+			}
+			if err == nil && found {
+				if got.CertRepMessage == nil || got.PKIStatus != tt.wantStatus {
+					t.Errorf("Authority.ResendPendingRequest() status = %v, want %v", got.CertRepMessage, tt.wantStatus)
+				}
+				if got.TransactionID != tt.msg.TransactionID {
+					t.Errorf("Authority.ResendPendingRequest() transactionID = %v, want %v", got.TransactionID, tt.msg.TransactionID)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_GetCertAndGetCRL(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := mustCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Intermediate CA"}}, caKey.Public(), caKey)
+	leaf := mustCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Minute),
+	}, ca, caKey.Public(), caKey)
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SCEP clients use RSA keys, the response is encrypted for them.
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := mustCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(5678),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Minute),
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}, clientKey.Public(), clientKey)
+
+	newMessage := func(issuer []byte, serial int64) *PKIMessage {
+		return &PKIMessage{
+			TransactionID: "transaction",
+			SenderNonce:   []byte("nonce"),
+			P7:            &pkcs7.PKCS7{Certificates: []*x509.Certificate{client}},
+			IssuerAndSerial: &IssuerAndSerial{
+				RawIssuer:    issuer,
+				SerialNumber: big.NewInt(serial),
+			},
+		}
+	}
+	authDB := &db.MockAuthDB{
+		MGetCertificate: func(serialNumber string) (*x509.Certificate, error) {
+			if serialNumber != "1234" {
+				return nil, database.ErrNotFound
+			}
+			return leaf, nil
+		},
+		MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+			return &db.CertificateRevocationListInfo{Number: 1, DER: crlDER}, nil
+		},
+	}
+	ctx := newChallengeContext(&mockProvisioner{name: "scep", encryptionAlgorithm: pkcs7.EncryptionAlgorithmAES256CBC}, authDB)
+	a := &Authority{
+		intermediateCertificate: ca,
+		service:                 &Service{signer: caKey},
+	}
+
+	decrypt := func(t *testing.T, certRep *PKIMessage) *pkcs7.PKCS7 {
+		t.Helper()
+		p7, err := pkcs7.Parse(certRep.Raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e7, err := pkcs7.Parse(p7.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deg, err := e7.Decrypt(client, clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p7, err = pkcs7.Parse(deg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p7
+	}
+
+	t.Run("GetCert", func(t *testing.T) {
+		certRep, err := a.GetCert(ctx, newMessage(ca.RawSubject, 1234))
+		if err != nil {
+			t.Fatalf("Authority.GetCert() error = %v", err)
+		}
+		if certRep.PKIStatus != microscep.SUCCESS || certRep.Certificate != leaf {
+			t.Errorf("Authority.GetCert() = %v, want %v", certRep.CertRepMessage, leaf)
+		}
+		if p7 := decrypt(t, certRep); len(p7.Certificates) != 1 || !p7.Certificates[0].Equal(leaf) {
+			t.Errorf("Authority.GetCert() certificates = %v, want %v", p7.Certificates, leaf)
+		}
+
+		if _, err := a.GetCert(ctx, newMessage(ca.RawSubject, 1)); err == nil {
+			t.Error("Authority.GetCert() error = nil, want not found")
+		}
+		if _, err := a.GetCert(ctx, newMessage(client.RawSubject, 1234)); err == nil {
+			t.Error("Authority.GetCert() error = nil, want issuer mismatch")
+		}
+		if _, err := a.GetCert(newChallengeContext(&mockProvisioner{name: "scep"}, nil), newMessage(ca.RawSubject, 1234)); err == nil {
+			t.Error("Authority.GetCert() error = nil, want no database")
+		}
+	})
+
+	t.Run("GetCRL", func(t *testing.T) {
+		certRep, err := a.GetCRL(ctx, newMessage(ca.RawSubject, 1234))
+		if err != nil {
+			t.Fatalf("Authority.GetCRL() error = %v", err)
+		}
+		if certRep.PKIStatus != microscep.SUCCESS || certRep.Certificate != nil {
+			t.Errorf("Authority.GetCRL() = %v", certRep.CertRepMessage)
+		}
+		if p7 := decrypt(t, certRep); len(p7.CRLs) != 1 || len(p7.Certificates) != 0 {
+			t.Errorf("Authority.GetCRL() crls = %d, certificates = %d, want 1 and 0", len(p7.CRLs), len(p7.Certificates))
+		}
+
+		if _, err := a.GetCRL(ctx, newMessage(client.RawSubject, 1234)); err == nil {
+			t.Error("Authority.GetCRL() error = nil, want issuer mismatch")
+		}
+		noCRL := newChallengeContext(&mockProvisioner{name: "scep"}, &db.MockAuthDB{
+			MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+				return nil, nil
+			},
+		})
+		if _, err := a.GetCRL(noCRL, newMessage(ca.RawSubject, 1234)); err == nil {
+			t.Error("Authority.GetCRL() error = nil, want not generated")
+		}
+	})
+}
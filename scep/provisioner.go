@@ -2,6 +2,7 @@ package scep
 
 import (
 	"context"
+	"crypto/x509"
 	"time"
 
 	"github.com/smallstep/certificates/authority/provisioner"
@@ -11,6 +12,7 @@ import (
 // only those methods required by the SCEP api/authority.
 type Provisioner interface {
 	AuthorizeSign(ctx context.Context, token string) ([]provisioner.SignOption, error)
+	AuthorizeRenew(ctx context.Context, cert *x509.Certificate) error
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
 	GetOptions() *provisioner.Options
@@ -18,4 +20,9 @@ type Provisioner interface {
 	GetCapabilities() []string
 	ShouldIncludeRootInChain() bool
 	GetContentEncryptionAlgorithm() int
+	HasDynamicChallenges() bool
+	HasChallengeWebhook() bool
+	ValidateChallengeWebhook(ctx context.Context, challenge, transactionID string, csr *x509.CertificateRequest) (bool, error)
+	IsRenewalEnabled() bool
+	RequiresApproval() bool
 }
@@ -3,7 +3,11 @@ package scep
 
 import (
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
 
 	microscep "github.com/micromdm/scep/v2/scep"
 	"go.mozilla.org/pkcs7"
@@ -53,6 +57,78 @@ type PKIMessage struct {
 
 	// Used to sign message
 	Recipients []*x509.Certificate
+
+	// IssuerAndSerial is the content of GetCert and GetCRL messages
+	IssuerAndSerial *IssuerAndSerial
+}
+
+// IssuerAndSerial is the issuer and serial number of a certificate used in
+// GetCert and GetCRL messages.
+type IssuerAndSerial struct {
+	// RawIssuer is the DER encoded issuer name
+	RawIssuer    []byte
+	SerialNumber *big.Int
+}
+
+type issuerAndSerialASN1 struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// parseIssuerAndSerial parses the DER encoded IssuerAndSerialNumber structure
+// defined in RFC 8894, section 3.3.3.
+func parseIssuerAndSerial(der []byte) (*IssuerAndSerial, error) {
+	var ias issuerAndSerialASN1
+	rest, err := asn1.Unmarshal(der, &ias)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(rest) > 0:
+		return nil, errors.New("trailing data after issuer and serial number")
+	case ias.SerialNumber == nil:
+		return nil, errors.New("missing serial number")
+	}
+	return &IssuerAndSerial{
+		RawIssuer:    ias.Issuer.FullBytes,
+		SerialNumber: ias.SerialNumber,
+	}, nil
+}
+
+type degenerateContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type degenerateSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      degenerateContentInfo
+	CRLs             asn1.RawValue
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+type degenerateContent struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// degenerateCRL creates a degenerate PKCS#7 signed data structure without
+// signers with the given DER encoded certificate revocation list. It's the
+// equivalent of microscep.DegenerateCertificates for GetCRL replies.
+func degenerateCRL(crl []byte) ([]byte, error) {
+	inner, err := asn1.Marshal(degenerateSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{},
+		ContentInfo:      degenerateContentInfo{ContentType: pkcs7.OIDData},
+		CRLs:             asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: crl},
+		SignerInfos:      []asn1.RawValue{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signed data: %w", err)
+	}
+	return asn1.Marshal(degenerateContent{
+		ContentType: pkcs7.OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
 }
 
 // CertRepMessage is a type of PKIMessage
@@ -65,3 +141,49 @@ type CertRepMessage struct {
 
 	degenerate []byte
 }
+
+// ParsePKIMessage parses a SCEP PKIMessage and verifies its signature. Unlike
+// microscep.ParsePKIMessage, it also accepts GetCertInitial (CertPoll),
+// GetCert and GetCRL messages.
+func ParsePKIMessage(data []byte) (*PKIMessage, error) {
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 data: %w", err)
+	}
+	if err := p7.Verify(); err != nil {
+		return nil, fmt.Errorf("error verifying pkcs7 signature: %w", err)
+	}
+
+	var tID microscep.TransactionID
+	if err := p7.UnmarshalSignedAttribute(oidSCEPtransactionID, &tID); err != nil {
+		return nil, fmt.Errorf("error parsing transactionID attribute: %w", err)
+	}
+
+	var msgType microscep.MessageType
+	if err := p7.UnmarshalSignedAttribute(oidSCEPmessageType, &msgType); err != nil {
+		return nil, fmt.Errorf("error parsing messageType attribute: %w", err)
+	}
+
+	switch msgType {
+	case microscep.PKCSReq, microscep.UpdateReq, microscep.RenewalReq, microscep.CertPoll,
+		microscep.GetCert, microscep.GetCRL:
+	default:
+		return nil, fmt.Errorf("unsupported message type %s", msgType)
+	}
+
+	var sn microscep.SenderNonce
+	if err := p7.UnmarshalSignedAttribute(oidSCEPsenderNonce, &sn); err != nil {
+		return nil, fmt.Errorf("error parsing senderNonce attribute: %w", err)
+	}
+	if len(sn) == 0 {
+		return nil, errors.New("scep pkiMessage must include senderNonce attribute")
+	}
+
+	return &PKIMessage{
+		TransactionID: tID,
+		MessageType:   msgType,
+		SenderNonce:   sn,
+		Raw:           data,
+		P7:            p7,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package scep
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+func Test_parseIssuerAndSerial(t *testing.T) {
+	issuer, err := asn1.Marshal(pkix.Name{CommonName: "Intermediate CA"}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMarshal := func(v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	ias := mustMarshal(issuerAndSerialASN1{
+		Issuer:       asn1.RawValue{FullBytes: issuer},
+		SerialNumber: big.NewInt(1234),
+	})
+
+	tests := []struct {
+		name    string
+		der     []byte
+		want    *IssuerAndSerial
+		wantErr bool
+	}{
+		{"ok", ias, &IssuerAndSerial{RawIssuer: issuer, SerialNumber: big.NewInt(1234)}, false},
+		{"fail trailing data", append(append([]byte{}, ias...), 0x00), nil, true},
+		{"fail asn1", []byte("foo"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIssuerAndSerial(tt.der)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseIssuerAndSerial() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIssuerAndSerial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_degenerateCRL(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "Intermediate CA"},
+		SubjectKeyId: []byte("subject-key-id"),
+		KeyUsage:     x509.KeyUsageCRLSign,
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, issuer, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deg, err := degenerateCRL(crl)
+	if err != nil {
+		t.Fatalf("degenerateCRL() error = %v", err)
+	}
+	p7, err := pkcs7.Parse(deg)
+	if err != nil {
+		t.Fatalf("pkcs7.Parse() error = %v", err)
+	}
+	if len(p7.CRLs) != 1 || len(p7.Certificates) != 0 || len(p7.Signers) != 0 {
+		t.Fatalf("degenerateCRL() crls = %d, certificates = %d, signers = %d, want 1, 0 and 0", len(p7.CRLs), len(p7.Certificates), len(p7.Signers))
+	}
+	if got := p7.CRLs[0].TBSCertList.Raw; !bytes.Contains(crl, got) {
+		t.Errorf("degenerateCRL() crl = %x, want %x", got, crl)
+	}
+}
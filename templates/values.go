@@ -19,6 +19,9 @@ type StepSSH struct {
 	UserKey           ssh.PublicKey
 	HostFederatedKeys []ssh.PublicKey
 	UserFederatedKeys []ssh.PublicKey
+	// RevokedKeys is the path in the hosts of the key revocation list
+	// available at /ssh/krl, if configured.
+	RevokedKeys string
 }
 
 // DefaultSSHTemplates contains the configuration of default templates used on ssh.
@@ -126,7 +129,10 @@ var DefaultSSHTemplateData = map[string]string{
 	"sshd_config.tpl": `Match all
 	TrustedUserCAKeys /etc/ssh/ca.pub
 	HostCertificate /etc/ssh/{{.User.Certificate}}
-	HostKey /etc/ssh/{{.User.Key}}`,
+	HostKey /etc/ssh/{{.User.Key}}
+{{- if .Step.SSH.RevokedKeys }}
+	RevokedKeys {{.Step.SSH.RevokedKeys}}
+{{- end }}`,
 
 	// ca.tpl contains the public key used to authorized clients
 	"ca.tpl": `{{.Step.SSH.UserKey.Type}} {{.Step.SSH.UserKey.Marshal | toString | b64enc}}
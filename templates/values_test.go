@@ -50,3 +50,32 @@ func TestDefaultTemplates(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultSSHTemplateData_sshdConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		revokedKeys string
+		want        string
+	}{
+		{"ok", "", "Match all\n\tTrustedUserCAKeys /etc/ssh/ca.pub\n\tHostCertificate /etc/ssh/host-cert.pub\n\tHostKey /etc/ssh/host"},
+		{"ok revokedKeys", "/etc/ssh/revoked_keys", "Match all\n\tTrustedUserCAKeys /etc/ssh/ca.pub\n\tHostCertificate /etc/ssh/host-cert.pub\n\tHostKey /etc/ssh/host\n\tRevokedKeys /etc/ssh/revoked_keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &Template{Name: "sshd_config.tpl", Type: Snippet}
+			if err := tmpl.LoadBytes([]byte(DefaultSSHTemplateData["sshd_config.tpl"])); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tmpl.Render(map[string]interface{}{
+				"Step": &Step{SSH: StepSSH{RevokedKeys: tt.revokedKeys}},
+				"User": map[string]string{"Certificate": "host-cert.pub", "Key": "host"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Template.Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}